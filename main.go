@@ -8,23 +8,45 @@ import (
 	"sync"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/archive"
 	"github.com/develar/app-builder/pkg/archive/zipx"
+	"github.com/develar/app-builder/pkg/asar"
 	"github.com/develar/app-builder/pkg/blockmap"
 	"github.com/develar/app-builder/pkg/codesign"
+	"github.com/develar/app-builder/pkg/codesign/gpg"
+	"github.com/develar/app-builder/pkg/codesign/mac"
+	"github.com/develar/app-builder/pkg/codesign/windows"
+	"github.com/develar/app-builder/pkg/config"
+	"github.com/develar/app-builder/pkg/delta"
 	"github.com/develar/app-builder/pkg/download"
 	"github.com/develar/app-builder/pkg/electron"
 	"github.com/develar/app-builder/pkg/elfExecStack"
 	"github.com/develar/app-builder/pkg/fs"
 	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/linuxDesktop"
 	"github.com/develar/app-builder/pkg/linuxTools"
 	"github.com/develar/app-builder/pkg/log-cli"
+	"github.com/develar/app-builder/pkg/macho"
 	"github.com/develar/app-builder/pkg/node-modules"
 	"github.com/develar/app-builder/pkg/package-format/appimage"
+	"github.com/develar/app-builder/pkg/package-format/deb"
 	"github.com/develar/app-builder/pkg/package-format/dmg"
+	"github.com/develar/app-builder/pkg/package-format/msix"
+	"github.com/develar/app-builder/pkg/package-format/nsis"
+	"github.com/develar/app-builder/pkg/package-format/pacman"
 	"github.com/develar/app-builder/pkg/package-format/proton-native"
+	"github.com/develar/app-builder/pkg/package-format/rpm"
 	"github.com/develar/app-builder/pkg/package-format/snap"
+	"github.com/develar/app-builder/pkg/pe"
+	"github.com/develar/app-builder/pkg/pipeline"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/progress"
 	"github.com/develar/app-builder/pkg/publisher"
 	"github.com/develar/app-builder/pkg/remoteBuild"
+	"github.com/develar/app-builder/pkg/server"
+	"github.com/develar/app-builder/pkg/squashfs"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/app-builder/pkg/universal"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/app-builder/pkg/wine"
 	"github.com/develar/errors"
@@ -42,10 +64,19 @@ func main() {
 	}
 
 	var app = kingpin.New("app-builder", "app-builder").Version("2.6.2")
+	log_cli.ConfigureLogFormatFlag(app)
+	progress.ConfigureFlags(app)
+	trace.ConfigureFlags(app)
+	util.ConfigureKeepTempFlag(app)
 
 	node_modules.ConfigureCommand(app)
+	node_modules.ConfigurePruneCommand(app)
+	node_modules.ConfigureNativeModulesCommand(app)
 	//codesign.ConfigureCommand(app)
 	publisher.ConfigurePublishToS3Command(app)
+	publisher.ConfigurePublishToGitHubCommand(app)
+	publisher.ConfigurePublishToHttpCommand(app)
+	publisher.ConfigureUpdateInfoCommand(app)
 	remoteBuild.ConfigureBuildCommand(app)
 
 	download.ConfigureCommand(app)
@@ -53,32 +84,72 @@ func main() {
 
 	electron.ConfigureCommand(app)
 	electron.ConfigureUnpackCommand(app)
+	electron.ConfigureResolveCommand(app)
+	electron.ConfigureFusesCommand(app)
 
 	zipx.ConfigureUnzipCommand(app)
+	archive.ConfigureArchiveCommand(app)
+	asar.ConfigureCommand(app)
 	proton_native.ConfigureCommand(app)
 
 	configurePrefetchToolsCommand(app)
+	config.ConfigureValidateCommand(app)
 
 	ConfigureCopyCommand(app)
+	fs.ConfigureHashCommand(app)
+	fs.ConfigureHashDirCommand(app)
 	appimage.ConfigureCommand(app)
 	snap.ConfigureCommand(app)
+	nsis.ConfigureDataCommand(app)
+	nsis.ConfigureWebPackageCommand(app)
+	msix.ConfigureCommand(app)
+	deb.ConfigureCommand(app)
+	rpm.ConfigureCommand(app)
+	pacman.ConfigureCommand(app)
+	pe.ConfigureCommand(app)
+	pe.ConfigureInfoCommand(app)
+	plist.ConfigureCommand(app)
+	universal.ConfigureCommand(app)
+	macho.ConfigureInfoCommand(app)
+	linuxDesktop.ConfigureCommand(app)
+	squashfs.ConfigureCommand(app)
 
 	err := icons.ConfigureCommand(app)
 	if err != nil {
 		util.LogErrorAndExit(err)
 	}
+	icons.ConfigureBatchCommand(app)
+	icons.ConfigureCollectIconsCommand(app)
+	icons.ConfigureIcnsInfoCommand(app)
+	icons.ConfigureNsisAssetsCommand(app)
 
 	dmg.ConfigureCommand(app)
+	dmg.ConfigureBackgroundCommand(app)
 	elfExecStack.ConfigureCommand(app)
 	blockmap.ConfigureCommand(app)
+	blockmap.ConfigureApplyCommand(app)
+	delta.ConfigureCommand(app)
+	delta.ConfigureApplyCommand(app)
 	codesign.ConfigureCertificateInfoCommand(app)
+	windows.ConfigureCommand(app)
+	mac.ConfigureSignCommand(app)
+	mac.ConfigureNotarizeCommand(app)
+	gpg.ConfigureCommand(app)
 
 	wine.ConfigureCommand(app)
+	server.ConfigureCommand(app)
+	pipeline.ConfigureCommand(app)
 
 	_, err = app.Parse(os.Args[1:])
+	trace.Finish(err)
 	if err != nil {
 		util.LogErrorAndExit(err)
 	}
+	util.DefaultTempDirManager.Cleanup()
+	// e.g. watch mode is stopped by cancel without error, but caller must be able to distinguish it from completion
+	if util.IsCancelled() {
+		os.Exit(util.CancelExitCode())
+	}
 }
 
 func ConfigureCopyCommand(app *kingpin.Application) {
@@ -86,10 +157,14 @@ func ConfigureCopyCommand(app *kingpin.Application) {
 	from := command.Flag("from", "").Required().Short('f').String()
 	to := command.Flag("to", "").Required().Short('t').String()
 	isUseHardLinks := command.Flag("hard-link", "Whether to use hard-links if possible").Bool()
+	isUseReflink := command.Flag("reflink", "Whether to use copy-on-write clone (APFS clonefile, Linux FICLONE) if possible").Default("true").Bool()
+	isPreserveTimes := command.Flag("preserve-times", "Whether to preserve modification times").Default("true").Bool()
 
 	command.Action(func(context *kingpin.ParseContext) error {
 		var fileCopier fs.FileCopier
 		fileCopier.IsUseHardLinks = *isUseHardLinks
+		fileCopier.IsUseReflink = *isUseReflink
+		fileCopier.IsPreserveTimes = *isPreserveTimes
 		return errors.WithStack(fileCopier.CopyDirOrFile(*from, *to))
 	})
 }
@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/archive/zipx"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/preflight"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+func ConfigureArchiveCommand(app *kingpin.Application) {
+	command := app.Command("archive", "Pack directory into zip or 7z archive, output is reproducible for the same input (stable file order, stripped timestamps)")
+	inDir := command.Flag("input", "directory to pack").Short('i').Required().String()
+	outFile := command.Flag("output", "output file").Short('o').Required().String()
+	format := command.Flag("format", "archive format, determined by output file extension if not specified").Short('f').Enum("zip", "7z")
+	compressionLevel := command.Flag("compression-level", "compression level, 0 (store) - 9 (ultra)").Short('c').Default("9").Int()
+	isDryRun := command.Flag("dry-run", "write plan (files to pack and total size) as JSON without writing anything").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		archiveFormat := *format
+		if len(archiveFormat) == 0 {
+			archiveFormat = strings.TrimPrefix(filepath.Ext(*outFile), ".")
+		}
+		if *isDryRun {
+			plan, err := PlanArchive(*inDir, *outFile, archiveFormat, *compressionLevel)
+			if err != nil {
+				return err
+			}
+			return util.WriteJsonToStdOut(plan)
+		}
+
+		err := preflight.CheckPackaging([]string{*inDir}, "", "", *outFile)
+		if err != nil {
+			return preflight.WriteUserError(err)
+		}
+		return Archive(util.RootContext(), *inDir, *outFile, archiveFormat, *compressionLevel)
+	})
+}
+
+// ArchivePlan is written instead of archive in dry-run mode
+type ArchivePlan struct {
+	Input            string `json:"input"`
+	Output           string `json:"output"`
+	Format           string `json:"format"`
+	CompressionLevel int    `json:"compressionLevel"`
+
+	Files int `json:"files"`
+	Dirs  int `json:"dirs"`
+	// total size of files to pack (estimated work)
+	Size int64 `json:"size"`
+}
+
+// PlanArchive validates arguments the same way as Archive and collects what would be packed
+func PlanArchive(dir string, outFile string, format string, compressionLevel int) (*ArchivePlan, error) {
+	if format != "zip" && format != "7z" {
+		return nil, errors.Errorf("unsupported archive format: %s", format)
+	}
+	if compressionLevel < 0 || compressionLevel > 9 {
+		return nil, errors.Errorf("compression level must be in range 0-9, got %d", compressionLevel)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	outFile, err = filepath.Abs(outFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan := &ArchivePlan{Input: dir, Output: outFile, Format: format, CompressionLevel: compressionLevel}
+	ioOutFile := fs.LongPath(outFile)
+	rootDir := fs.LongPath(dir)
+	err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// out file can be inside of dir
+		if path == rootDir || path == ioOutFile {
+			return nil
+		}
+
+		if info.IsDir() {
+			plan.Dirs++
+		} else {
+			plan.Files++
+			plan.Size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return plan, nil
+}
+
+// incomplete archive is removed on cancel
+func Archive(ctx context.Context, dir string, outFile string, format string, compressionLevel int) error {
+	ctx, span := trace.Start(ctx, "archive")
+	span.SetAttribute("format", format)
+	span.SetAttribute("file", filepath.Base(outFile))
+	span.SetAttribute("compressionLevel", compressionLevel)
+	err := archive(ctx, dir, outFile, format, compressionLevel)
+	span.End(err)
+	return err
+}
+
+func archive(ctx context.Context, dir string, outFile string, format string, compressionLevel int) error {
+	// archive is always created from scratch (7za updates existing archive)
+	err := os.Remove(outFile)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	switch format {
+	case "zip":
+		return zipx.Zip(ctx, dir, outFile, compressionLevel)
+	case "7z":
+		return Archive7z(ctx, dir, outFile, compressionLevel, true)
+	default:
+		return errors.Errorf("unsupported archive format: %s", format)
+	}
+}
+
+// Archive7z packs dir into 7z archive. Not solid archive is larger, but changed file affects only its own block (better for differential download).
+// Existing out file is not removed. Incomplete archive is removed on cancel.
+func Archive7z(ctx context.Context, dir string, outFile string, compressionLevel int, isSolid bool) error {
+	err := archive7z(ctx, dir, outFile, compressionLevel, isSolid)
+	if err != nil && ctx.Err() != nil {
+		_ = os.Remove(outFile)
+	}
+	return err
+}
+
+func archive7z(ctx context.Context, dir string, outFile string, compressionLevel int, isSolid bool) error {
+	if compressionLevel < 0 || compressionLevel > 9 {
+		return errors.Errorf("compression level must be in range 0-9, got %d", compressionLevel)
+	}
+
+	outFile, err := filepath.Abs(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// 7za sorts files by type (extension) and order of directory listing is not guaranteed, so, explicit sorted list is passed
+	listFile, err := writeFileList(dir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+
+	args := []string{"a", "-bd", "-t7z", "-mx=" + strconv.Itoa(compressionLevel),
+		// strip timestamps
+		"-mtm=off", "-mtc=off", "-mta=off",
+		// keep order of list file
+		"-mqs=off",
+		"-snl",
+	}
+	if !isSolid {
+		args = append(args, "-ms=off")
+	}
+	args = append(args, outFile, "@"+listFile)
+	// 7za doesn't report progress in machine-readable form, only the final event is reported
+	reporter := progress.Start("archive", outFile, 0)
+	_, err = util.Execute(exec.CommandContext(ctx, util.Get7zPath(), args...), dir)
+	reporter.Finish(err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func writeFileList(dir string) (string, error) {
+	var names []string
+	// filepath.Walk walks files in lexical order
+	// names are relative, so, extended-length form (long paths on Windows) doesn't affect the list
+	dir = fs.LongPath(dir)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, relativePath)
+		return nil
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	listFile, err := util.TempFile("", ".txt")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(listFile, []byte(strings.Join(names, "\n")), 0644)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return listFile, nil
+}
@@ -0,0 +1,118 @@
+package archive
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// CompressionExtension returns file extension of compressed file (e.g. ".xz"), empty for "none"
+func CompressionExtension(compression string) string {
+	switch compression {
+	case "gzip":
+		return ".gz"
+	case "xz":
+		return ".xz"
+	case "zstd":
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// NewCompressWriter returns writer that compresses data to out, writer must be closed to flush data.
+// Gzip is built-in, xz (XZ_PATH env, installed xz or 7za) and zstd (installed or downloaded) are external processes.
+func NewCompressWriter(out io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "none":
+		return nopWriteCloser{out}, nil
+	case "gzip":
+		writer, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+		return writer, errors.WithStack(err)
+	case "xz":
+		command, err := createXzCommand()
+		if err != nil {
+			return nil, err
+		}
+		return startCompressProcess(command, out)
+	case "zstd":
+		command, err := createZstdCommand()
+		if err != nil {
+			return nil, err
+		}
+		return startCompressProcess(command, out)
+	default:
+		return nil, errors.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+func createXzCommand() (*exec.Cmd, error) {
+	path := os.Getenv("XZ_PATH")
+	if len(path) == 0 {
+		installedPath, err := exec.LookPath("xz")
+		if err != nil {
+			// -an: archive name is not used, data is written to stdout
+			return exec.Command(util.Get7zPath(), "a", "-an", "-txz", "-mx=9", "-si", "-so"), nil
+		}
+		path = installedPath
+	}
+	return exec.Command(path, "-z", "-c", "-9", "-T0"), nil
+}
+
+func createZstdCommand() (*exec.Cmd, error) {
+	path, err := exec.LookPath("zstd")
+	if err != nil {
+		path, err = download.GetZstd()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return exec.Command(path, "-c", "-q", "-19", "-T0"), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type processWriter struct {
+	io.WriteCloser
+
+	command     *exec.Cmd
+	errorOutput *strings.Builder
+}
+
+func startCompressProcess(command *exec.Cmd, out io.Writer) (io.WriteCloser, error) {
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	errorOutput := &strings.Builder{}
+	command.Stdout = out
+	command.Stderr = errorOutput
+	err = command.Start()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &processWriter{WriteCloser: stdin, command: command, errorOutput: errorOutput}, nil
+}
+
+// closes stdin and waits until all compressed data is written
+func (t *processWriter) Close() error {
+	err := t.WriteCloser.Close()
+	waitErr := t.command.Wait()
+	if waitErr != nil {
+		return errors.Errorf("%s failed: %v\nerror output: %s", t.command.Path, waitErr, strings.TrimSpace(t.errorOutput.String()))
+	}
+	return errors.WithStack(err)
+}
@@ -2,11 +2,15 @@ package zipx
 
 import (
 	"archive/zip"
+	"encoding/binary"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"unicode/utf8"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/develar/app-builder/pkg/fs"
@@ -15,10 +19,25 @@ import (
 	"github.com/develar/go-fs-util"
 	"github.com/oxtoacart/bpool"
 	"github.com/phayes/permbits"
+	"golang.org/x/text/encoding/charmap"
 )
 
+// Info-ZIP Unicode Path Extra Field
+const unicodePathExtraId = 0x7075
+
+// UnzipSummary describes what was written (excluded files are not counted)
+type UnzipSummary struct {
+	OutputDir string `json:"outputDir"`
+	Files     int64  `json:"files"`
+	Dirs      int64  `json:"dirs"`
+	Symlinks  int64  `json:"symlinks"`
+	// total size of written files (symlinks are not counted)
+	Size     int64 `json:"size"`
+	Excluded int64 `json:"excluded,omitempty"`
+}
+
 func ConfigureUnzipCommand(app *kingpin.Application) {
-	command := app.Command("unzip", "")
+	command := app.Command("unzip", "Extract zip preserving symlinks and permissions (summary is written as JSON).")
 	src := command.Flag("input", "").Short('i').Required().String()
 	dest := command.Flag("output", "").Short('o').Required().String()
 
@@ -29,12 +48,12 @@ func ConfigureUnzipCommand(app *kingpin.Application) {
 			return err
 		}
 
-		err = Unzip(*src, *dest, nil)
+		summary, err := UnzipWithSummary(*src, *dest, nil)
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return util.WriteJsonToStdOut(summary)
 	})
 }
 
@@ -44,24 +63,42 @@ const concurrency = 4
 // https://github.com/mholt/archiver/issues/21
 // dest must be an empty dir
 func Unzip(src string, outputDir string, excludedFiles map[string]bool) error {
+	_, err := UnzipWithSummary(src, outputDir, excludedFiles)
+	return err
+}
+
+func UnzipWithSummary(src string, outputDir string, excludedFiles map[string]bool) (*UnzipSummary, error) {
 	if len(src) == 0 {
-		return errors.New("input zip file name is empty")
+		return nil, errors.New("input zip file name is empty")
 	}
 
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		// return as is without stack to allow client easily compare error with known zip errors
-		return err
+		return nil, err
 	}
 
 	defer util.Close(r)
 
+	err = os.MkdirAll(fs.LongPath(outputDir), 0777)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// output dir itself can be a symlink (e.g. /tmp on macOS)
+	realOutputDir, err := filepath.EvalSymlinks(outputDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	extractor := &Extractor{
 		outputDir:     filepath.Clean(outputDir),
+		realOutputDir: realOutputDir,
 		excludedFiles: excludedFiles,
 
 		createdDirs: make(map[string]bool),
 		bufferPool:  bpool.NewBytePool(concurrency, 64*1024),
+		summary:     &UnzipSummary{OutputDir: filepath.Clean(outputDir)},
 	}
 
 	extractor.createdDirs[extractor.outputDir] = true
@@ -87,6 +124,7 @@ func Unzip(src string, outputDir string, excludedFiles map[string]bool) error {
 		if extractor.excludedFiles != nil {
 			_, isExcluded := extractor.excludedFiles[filePath]
 			if isExcluded {
+				atomic.AddInt64(&extractor.summary.Excluded, 1)
 				return nil, nil
 			}
 		}
@@ -98,26 +136,56 @@ func Unzip(src string, outputDir string, excludedFiles map[string]bool) error {
 				return nil, errors.WithStack(err)
 			}
 
+			_, err = extractor.checkRealDir(fileDir)
+			if err != nil {
+				return nil, err
+			}
+
 			lastCreatedDir = fileDir
 		}
 
+		if (zipFile.Mode() & os.ModeSymlink) != 0 {
+			// created after all files and dirs are written, so, nothing is written through the link
+			extractor.symlinks = append(extractor.symlinks, symlinkEntry{zipFile: zipFile, path: filePath})
+			return nil, nil
+		}
+
 		return func() error {
 			return extractor.extractAndWriteFile(zipFile, filePath)
 		}, nil
 	})
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 
-	return nil
+	// in the order of the zip, link target can be another link
+	for _, entry := range extractor.symlinks {
+		err = extractor.extractSymlink(entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return extractor.summary, nil
 }
 
 type Extractor struct {
 	outputDir     string
+	realOutputDir string
 	excludedFiles map[string]bool
 
 	createdDirs map[string]bool
 	bufferPool  *bpool.BytePool
+
+	// counters are updated atomically (files are written in parallel)
+	summary *UnzipSummary
+
+	symlinks []symlinkEntry
+}
+
+type symlinkEntry struct {
+	zipFile *zip.File
+	path    string
 }
 
 func (t *Extractor) createDirIfNeed(dirPath string) error {
@@ -126,7 +194,7 @@ func (t *Extractor) createDirIfNeed(dirPath string) error {
 		return nil
 	}
 
-	err := os.MkdirAll(dirPath, 0777)
+	err := os.MkdirAll(fs.LongPath(dirPath), 0777)
 	if err != nil {
 		return err
 	}
@@ -201,34 +269,107 @@ func (t *Extractor) addWithParentsToCreated(dir string) {
 
 func (t *Extractor) computeExtractPath(zipFile *zip.File) (string, error) {
 	// #nosec G305
-	filePath := filepath.Join(t.outputDir, zipFile.Name)
-	if strings.HasPrefix(filePath, t.outputDir) {
+	filePath := filepath.Join(t.outputDir, decodeName(zipFile))
+	if t.isInOutputDir(filePath) {
 		return filePath, nil
 	} else {
 		return "", errors.Errorf("%s: illegal file path", filePath)
 	}
 }
 
+func (t *Extractor) isInOutputDir(path string) bool {
+	return isInDir(t.outputDir, path)
+}
+
+func isInDir(dir string, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
+
+// path is checked after symlinks are resolved, so, entry cannot be written outside of output dir through a link (e.g. existing one in the output dir)
+func (t *Extractor) checkRealDir(dir string) (string, error) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if !isInDir(t.realOutputDir, realDir) {
+		return "", errors.Errorf("%s: illegal file path (resolved to %s)", dir, realDir)
+	}
+	return realDir, nil
+}
+
+// names are UTF-8 if flag is set, otherwise Info-ZIP Unicode Path extra field or CP437 (legacy zip tools and Windows Explorer)
+func decodeName(zipFile *zip.File) string {
+	if zipFile.Flags&0x800 != 0 {
+		return zipFile.Name
+	}
+
+	if name, ok := readUnicodePathExtra(zipFile.Extra, zipFile.Name); ok {
+		return name
+	}
+
+	if !zipFile.NonUTF8 || utf8.ValidString(zipFile.Name) {
+		return zipFile.Name
+	}
+
+	name, err := charmap.CodePage437.NewDecoder().String(zipFile.Name)
+	if err != nil {
+		return zipFile.Name
+	}
+	return name
+}
+
+// field is ignored if CRC32 of the name does not match (name was changed by tool that is not aware of extra field)
+func readUnicodePathExtra(extra []byte, name string) (string, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+
+		data := extra[:size]
+		extra = extra[size:]
+		// version (1) + name crc32 (4) + UTF-8 name
+		if id != unicodePathExtraId || len(data) < 5 || data[0] != 1 {
+			continue
+		}
+
+		if binary.LittleEndian.Uint32(data[1:5]) != crc32.ChecksumIEEE([]byte(name)) || !utf8.Valid(data[5:]) {
+			return "", false
+		}
+		return string(data[5:]), true
+	}
+	return "", false
+}
+
 func (t *Extractor) extractDir(zipFile *zip.File) error {
 	filePath, err := t.computeExtractPath(zipFile)
 	if err != nil {
 		return err
 	}
 
-	err = os.MkdirAll(filePath, 0777)
+	// paths are kept as is for bookkeeping, extended-length form is used only for IO (long paths on Windows)
+	ioPath := fs.LongPath(filePath)
+	err = os.MkdirAll(ioPath, 0777)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.checkRealDir(filePath)
 	if err != nil {
 		return err
 	}
 
 	perm := zipFile.Mode()
 	if perm != 0755 {
-		isChanged, err := util.FixPermissions(filePath, permbits.FileMode(perm))
+		isChanged, err := util.FixPermissions(ioPath, permbits.FileMode(perm))
 		if err != nil {
 			return err
 		}
 
 		if !isChanged {
-			err = fs.SetDirPermsIfNeed(filePath, perm)
+			err = fs.SetDirPermsIfNeed(ioPath, perm)
 			if err != nil {
 				return err
 			}
@@ -236,6 +377,7 @@ func (t *Extractor) extractDir(zipFile *zip.File) error {
 	}
 
 	t.addWithParentsToCreated(filePath)
+	atomic.AddInt64(&t.summary.Dirs, 1)
 	return nil
 }
 
@@ -247,19 +389,33 @@ func (t *Extractor) extractAndWriteFile(zipFile *zip.File, filePath string) erro
 
 	defer util.Close(file)
 
-	if (zipFile.FileInfo().Mode() & os.ModeSymlink) != 0 {
-		return t.createSymlink(file, zipFile, filePath)
-	}
-
 	buffer := t.bufferPool.Get()
-	err = fsutil.WriteFile(file, filePath, zipFile.Mode(), buffer)
+	err = fsutil.WriteFile(file, fs.LongPath(filePath), zipFile.Mode(), buffer)
 	t.bufferPool.Put(buffer)
 	if err != nil {
 		return err
 	}
+
+	atomic.AddInt64(&t.summary.Files, 1)
+	atomic.AddInt64(&t.summary.Size, int64(zipFile.UncompressedSize64))
 	return nil
 }
 
+func (t *Extractor) extractSymlink(entry symlinkEntry) error {
+	// dir was created for another entry (e.g. a/b/c is extracted, but a/b is a link)
+	if t.createdDirs[entry.path] {
+		return errors.Errorf("%s: illegal symlink, other entries are extracted under it", entry.path)
+	}
+
+	reader, err := entry.zipFile.Open()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+	return t.createSymlink(reader, entry.zipFile, entry.path)
+}
+
 func (t *Extractor) createSymlink(reader io.Reader, zipFile *zip.File, filePath string) error {
 	buffer := make([]byte, zipFile.FileInfo().Size())
 	_, err := io.ReadFull(reader, buffer)
@@ -267,5 +423,30 @@ func (t *Extractor) createSymlink(reader io.Reader, zipFile *zip.File, filePath
 		return err
 	}
 
-	return os.Symlink(string(buffer), filePath)
+	// target is resolved against the real parent (parent path can contain links extracted before)
+	realParent, err := t.checkRealDir(filepath.Dir(filePath))
+	if err != nil {
+		return err
+	}
+
+	target := string(buffer)
+	resolvedTarget := filepath.Join(realParent, target)
+	if filepath.IsAbs(target) || !isInDir(t.realOutputDir, resolvedTarget) {
+		return errors.Errorf("%s: illegal symlink target %s", filePath, target)
+	}
+
+	// output dir is not required to be empty, existing file is replaced as regular files are
+	ioPath := fs.LongPath(filePath)
+	err = os.Remove(ioPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	err = os.Symlink(target, ioPath)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	atomic.AddInt64(&t.summary.Symlinks, 1)
+	return nil
 }
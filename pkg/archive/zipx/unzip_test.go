@@ -0,0 +1,154 @@
+package zipx
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+type testZipEntry struct {
+	header  zip.FileHeader
+	content string
+}
+
+func writeTestZip(g *GomegaWithT, file string, entries []testZipEntry) {
+	outFile, err := os.Create(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer outFile.Close()
+
+	writer := zip.NewWriter(outFile)
+	for index := range entries {
+		entry := &entries[index]
+		if entry.header.Mode() == 0 {
+			entry.header.SetMode(0644)
+		}
+		entryWriter, err := writer.CreateHeader(&entry.header)
+		g.Expect(err).NotTo(HaveOccurred())
+		_, err = entryWriter.Write([]byte(entry.content))
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	g.Expect(writer.Close()).NotTo(HaveOccurred())
+}
+
+func symlinkHeader(name string) zip.FileHeader {
+	header := zip.FileHeader{Name: name}
+	header.SetMode(os.ModeSymlink | 0777)
+	return header
+}
+
+func TestUnzipSummaryAndNames(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "unzip")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// "ü" is 0x81 in CP437
+	legacyName := zip.FileHeader{Name: "\x81ber.txt", NonUTF8: true}
+
+	unicodeName := "Grüße.txt"
+	extra := make([]byte, 9)
+	binary.LittleEndian.PutUint16(extra, unicodePathExtraId)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(5+len(unicodeName)))
+	extra[4] = 1
+	binary.LittleEndian.PutUint32(extra[5:], crc32.ChecksumIEEE([]byte("Grusse.txt")))
+	extraName := zip.FileHeader{Name: "Grusse.txt", NonUTF8: true, Extra: append(extra, unicodeName...)}
+
+	executable := zip.FileHeader{Name: "Electron.app/Contents/MacOS/Electron"}
+	executable.SetMode(0755)
+
+	zipFile := filepath.Join(tmpDir, "test.zip")
+	writeTestZip(g, zipFile, []testZipEntry{
+		{header: executable, content: "binary"},
+		{header: symlinkHeader("Electron.app/Contents/Frameworks/Current"), content: "../MacOS"},
+		{header: legacyName, content: "legacy"},
+		{header: extraName, content: "extra"},
+	})
+
+	outDir := filepath.Join(tmpDir, "out")
+	summary, err := UnzipWithSummary(zipFile, outDir, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*summary).To(Equal(UnzipSummary{OutputDir: outDir, Files: 3, Symlinks: 1, Size: int64(len("binary") + len("legacy") + len("extra"))}))
+
+	info, err := os.Stat(filepath.Join(outDir, "Electron.app", "Contents", "MacOS", "Electron"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	target, err := os.Readlink(filepath.Join(outDir, "Electron.app", "Contents", "Frameworks", "Current"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(target).To(Equal("../MacOS"))
+
+	g.Expect(filepath.Join(outDir, "über.txt")).To(BeAnExistingFile())
+	g.Expect(filepath.Join(outDir, unicodeName)).To(BeAnExistingFile())
+
+	// extract again to the same dir, existing symlink is replaced
+	_, err = UnzipWithSummary(zipFile, outDir, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestUnzipRejectsEscapingEntries(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "unzip")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	outDir := filepath.Join(tmpDir, "out")
+
+	zipFile := filepath.Join(tmpDir, "path.zip")
+	writeTestZip(g, zipFile, []testZipEntry{{header: zip.FileHeader{Name: "../out-evil/file.txt"}, content: "evil"}})
+	err = Unzip(zipFile, outDir, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("illegal file path")))
+
+	zipFile = filepath.Join(tmpDir, "symlink.zip")
+	writeTestZip(g, zipFile, []testZipEntry{{header: symlinkHeader("link"), content: "/etc"}})
+	err = Unzip(zipFile, outDir, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("illegal symlink target")))
+	g.Expect(filepath.Join(tmpDir, "out-evil")).NotTo(BeAnExistingFile())
+}
+
+func TestUnzipRejectsChainedSymlinks(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "unzip")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	outDir := filepath.Join(tmpDir, "a", "out")
+
+	// each link target is inside output dir if checked as text, but a/b/c resolves to the parent of output dir
+	entries := []testZipEntry{
+		{header: symlinkHeader("a/b"), content: ".."},
+		{header: symlinkHeader("a/b/c"), content: ".."},
+		{header: zip.FileHeader{Name: "a/b/c/evil"}, content: "evil"},
+	}
+	// files are written in parallel, make sure that links are not created in time by chance
+	for i := 0; i < 200; i++ {
+		entries = append(entries, testZipEntry{header: zip.FileHeader{Name: fmt.Sprintf("filler/%d.txt", i)}, content: "filler"})
+	}
+
+	zipFile := filepath.Join(tmpDir, "chain.zip")
+	writeTestZip(g, zipFile, entries)
+	err = Unzip(zipFile, outDir, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("illegal symlink")))
+	g.Expect(filepath.Join(tmpDir, "evil")).NotTo(BeAnExistingFile())
+	g.Expect(filepath.Join(tmpDir, "a", "evil")).NotTo(BeAnExistingFile())
+
+	// link existing in the output dir is not followed
+	outDir = filepath.Join(tmpDir, "existing")
+	g.Expect(os.MkdirAll(outDir, 0777)).To(Succeed())
+	g.Expect(os.Symlink(tmpDir, filepath.Join(outDir, "link"))).To(Succeed())
+
+	zipFile = filepath.Join(tmpDir, "existing.zip")
+	writeTestZip(g, zipFile, []testZipEntry{{header: zip.FileHeader{Name: "link/evil"}, content: "evil"}})
+	err = Unzip(zipFile, outDir, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("illegal file path")))
+	g.Expect(filepath.Join(tmpDir, "evil")).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,166 @@
+package zipx
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// minimal date that can be represented in the MS-DOS format, used for all entries to get reproducible archive
+var fixedModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Zip packs content of dir into outFile. Output depends only on the file names, content and executable bit:
+// entries are sorted by name, timestamps are stripped and permissions are normalized (0755 or 0644).
+// Compression level 0 means store (no compression), 1-9 - deflate level. Incomplete archive is removed on cancel.
+func Zip(ctx context.Context, dir string, outFile string, compressionLevel int) error {
+	if compressionLevel < flate.NoCompression || compressionLevel > flate.BestCompression {
+		return errors.Errorf("compression level must be in range 0-9, got %d", compressionLevel)
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// out file can be inside of dir
+	outFile, err = filepath.Abs(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	reporter := progress.Start("archive", outFile, 0)
+	// extended-length form on Windows (long paths in node_modules), entry names are relative, so, not affected
+	dir = fs.LongPath(dir)
+	if reporter != nil {
+		reporter.SetTotal(computeTotalSize(dir))
+	}
+
+	err = doZip(ctx, dir, fs.LongPath(outFile), compressionLevel, reporter)
+	reporter.Finish(err)
+	if err != nil && ctx.Err() != nil {
+		_ = os.Remove(fs.LongPath(outFile))
+	}
+	return err
+}
+
+func doZip(ctx context.Context, dir string, outFile string, compressionLevel int, reporter *progress.Reporter) error {
+	fileDescriptor, err := fsutil.CreateFile(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	bufferedWriter := bufio.NewWriterSize(fileDescriptor, 64*1024)
+	zipWriter := zip.NewWriter(bufferedWriter)
+	zipWriter.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, compressionLevel)
+	})
+
+	// filepath.Walk walks files in lexical order, so, order of entries is stable
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if path == dir || path == outFile {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return writeZipEntry(zipWriter, path, filepath.ToSlash(relativePath), info, compressionLevel, reporter)
+	})
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if err != nil {
+		return errors.WithStack(fsutil.CloseAndCheckError(err, fileDescriptor))
+	}
+	return errors.WithStack(fileDescriptor.Close())
+}
+
+// total size of regular files (progress is reported in bytes of input), 0 (unknown) on error
+func computeTotalSize(dir string) int64 {
+	var result int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			result += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+	return result
+}
+
+func writeZipEntry(zipWriter *zip.Writer, path string, name string, info os.FileInfo, compressionLevel int, reporter *progress.Reporter) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Modified: fixedModTime,
+		Method:   zip.Deflate,
+	}
+
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		header.Name += "/"
+		header.Method = zip.Store
+		header.SetMode(os.ModeDir | 0755)
+	case mode&os.ModeSymlink != 0:
+		header.Method = zip.Store
+		header.SetMode(os.ModeSymlink | 0755)
+	case mode&0111 != 0:
+		header.SetMode(0755)
+	default:
+		header.SetMode(0644)
+	}
+
+	if compressionLevel == flate.NoCompression {
+		header.Method = zip.Store
+	}
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mode.IsDir():
+		return nil
+	case mode&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(writer, target)
+		return err
+	default:
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer util.Close(file)
+		_, err = io.Copy(&progress.Writer{Writer: writer, Reporter: reporter}, file)
+		return err
+	}
+}
@@ -0,0 +1,84 @@
+package zipx
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestZipIsReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "zip")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	g.Expect(os.MkdirAll(filepath.Join(sourceDir, "b", "empty"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(sourceDir, "b", "file.txt"), []byte("hello"), 0600)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(sourceDir, "a.sh"), []byte("#!/bin/sh"), 0700)).NotTo(HaveOccurred())
+	g.Expect(os.Symlink("a.sh", filepath.Join(sourceDir, "link"))).NotTo(HaveOccurred())
+
+	firstZip := filepath.Join(tmpDir, "first.zip")
+	g.Expect(Zip(context.Background(), sourceDir, firstZip, 9)).NotTo(HaveOccurred())
+
+	// timestamps must not affect output
+	later := time.Now().Add(time.Hour)
+	g.Expect(os.Chtimes(filepath.Join(sourceDir, "b", "file.txt"), later, later)).NotTo(HaveOccurred())
+	g.Expect(os.Chtimes(filepath.Join(sourceDir, "b"), later, later)).NotTo(HaveOccurred())
+
+	secondZip := filepath.Join(tmpDir, "second.zip")
+	g.Expect(Zip(context.Background(), sourceDir, secondZip, 9)).NotTo(HaveOccurred())
+
+	firstData, err := ioutil.ReadFile(firstZip)
+	g.Expect(err).NotTo(HaveOccurred())
+	secondData, err := ioutil.ReadFile(secondZip)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bytes.Equal(firstData, secondData)).To(BeTrue())
+
+	outDir := filepath.Join(tmpDir, "out")
+	g.Expect(Unzip(firstZip, outDir, nil)).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(filepath.Join(outDir, "b", "file.txt"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("hello"))
+
+	info, err := os.Stat(filepath.Join(outDir, "a.sh"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	target, err := os.Readlink(filepath.Join(outDir, "link"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(target).To(Equal("a.sh"))
+
+	info, err = os.Stat(filepath.Join(outDir, "b", "empty"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.IsDir()).To(BeTrue())
+}
+
+func TestZipCancelled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "zip")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	g.Expect(os.MkdirAll(sourceDir, 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(sourceDir, "file.txt"), []byte("hello"), 0644)).NotTo(HaveOccurred())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	outFile := filepath.Join(tmpDir, "out.zip")
+	err = Zip(ctx, sourceDir, outFile, 9)
+	g.Expect(errors.Cause(err)).To(Equal(context.Canceled))
+	// incomplete archive is removed
+	g.Expect(outFile).NotTo(BeAnExistingFile())
+}
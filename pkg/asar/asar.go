@@ -0,0 +1,147 @@
+package asar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// https://github.com/electron/asar
+// archive starts with two Chromium pickles: the first one contains size of the second one, the second one - header JSON.
+// File data follows the header, file offset in the header is relative to the end of header.
+
+const (
+	integrityAlgorithm = "SHA256"
+	integrityBlockSize = 4 * 1024 * 1024
+)
+
+// encoding/json is used instead of jsoniter - keys of JSON object must be sorted to get the same header for the same input
+type Node struct {
+	// not nil for directory
+	Files map[string]*Node `json:"files"`
+
+	Size       *int64     `json:"size,omitempty"`
+	Offset     string     `json:"offset,omitempty"`
+	Unpacked   bool       `json:"unpacked,omitempty"`
+	Executable bool       `json:"executable,omitempty"`
+	Integrity  *Integrity `json:"integrity,omitempty"`
+
+	// path relative to the archive root
+	Link string `json:"link,omitempty"`
+}
+
+type Integrity struct {
+	Algorithm string   `json:"algorithm"`
+	Hash      string   `json:"hash"`
+	BlockSize int      `json:"blockSize"`
+	Blocks    []string `json:"blocks"`
+}
+
+func (t *Node) IsDir() bool {
+	return t.Files != nil
+}
+
+func (t *Node) IsLink() bool {
+	return len(t.Link) != 0
+}
+
+// "files" must be written only for directory (empty directory is written as {"files":{}})
+func (t *Node) MarshalJSON() ([]byte, error) {
+	var files *map[string]*Node
+	if t.Files != nil {
+		files = &t.Files
+	}
+	return json.Marshal(&struct {
+		Files      *map[string]*Node `json:"files,omitempty"`
+		Size       *int64            `json:"size,omitempty"`
+		Offset     string            `json:"offset,omitempty"`
+		Unpacked   bool              `json:"unpacked,omitempty"`
+		Executable bool              `json:"executable,omitempty"`
+		Integrity  *Integrity        `json:"integrity,omitempty"`
+		Link       string            `json:"link,omitempty"`
+	}{files, t.Size, t.Offset, t.Unpacked, t.Executable, t.Integrity, t.Link})
+}
+
+func encodeHeader(root *Node) ([]byte, error) {
+	headerString, err := json.Marshal(root)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// header pickle: payload size, string length, string, padding to 4 bytes
+	alignedLength := (len(headerString) + 3) &^ 3
+	headerPickleSize := 4 + 4 + alignedLength
+
+	result := make([]byte, 8+headerPickleSize)
+	// size pickle: payload size (4), header pickle size
+	binary.LittleEndian.PutUint32(result[0:], 4)
+	binary.LittleEndian.PutUint32(result[4:], uint32(headerPickleSize))
+	binary.LittleEndian.PutUint32(result[8:], uint32(4+alignedLength))
+	binary.LittleEndian.PutUint32(result[12:], uint32(len(headerString)))
+	copy(result[16:], headerString)
+	return result, nil
+}
+
+type Archive struct {
+	Root *Node
+	// SHA-256 (hex) of header JSON, as checked by Electron asar integrity validation
+	HeaderHash string
+
+	file string
+	// offset of file data (size of header)
+	dataOffset int64
+}
+
+func ReadArchive(file string) (*Archive, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(reader)
+
+	sizePickle := make([]byte, 8)
+	_, err = io.ReadFull(reader, sizePickle)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read asar header of "+file)
+	}
+
+	headerPickleSize := binary.LittleEndian.Uint32(sizePickle[4:])
+	if binary.LittleEndian.Uint32(sizePickle) != 4 || headerPickleSize < 8 || headerPickleSize > 512*1024*1024 {
+		return nil, errors.Errorf("%s is not an asar archive", file)
+	}
+
+	headerPickle := make([]byte, headerPickleSize)
+	_, err = io.ReadFull(reader, headerPickle)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read asar header of "+file)
+	}
+
+	headerLength := binary.LittleEndian.Uint32(headerPickle[4:])
+	if int(headerLength) > len(headerPickle)-8 {
+		return nil, errors.Errorf("%s is not an asar archive", file)
+	}
+
+	root := &Node{}
+	err = json.NewDecoder(bytes.NewReader(headerPickle[8 : 8+headerLength])).Decode(root)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot decode asar header of "+file)
+	}
+	if !root.IsDir() {
+		return nil, errors.Errorf("%s is not an asar archive", file)
+	}
+
+	headerHash := sha256.Sum256(headerPickle[8 : 8+headerLength])
+	return &Archive{
+		Root:       root,
+		HeaderHash: hex.EncodeToString(headerHash[:]),
+		file:       file,
+		dataOffset: int64(8 + headerPickleSize),
+	}, nil
+}
@@ -0,0 +1,150 @@
+package asar
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func createTestDir(g *GomegaWithT, dir string) {
+	g.Expect(os.MkdirAll(filepath.Join(dir, "lib", "empty"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "index.js"), []byte("console.log(1)"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "lib", "empty.txt"), nil, 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "lib", "tool"), []byte("#!/bin/sh"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "lib", "addon.node"), []byte("binary"), 0644)).NotTo(HaveOccurred())
+	g.Expect(os.Symlink("../index.js", filepath.Join(dir, "lib", "link.js"))).NotTo(HaveOccurred())
+}
+
+func TestPackAndExtract(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "asar")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "app")
+	createTestDir(g, sourceDir)
+
+	asarFile := filepath.Join(tmpDir, "app.asar")
+	g.Expect(Pack(sourceDir, asarFile, []string{"*.node"})).NotTo(HaveOccurred())
+
+	_, err = os.Stat(filepath.Join(tmpDir, "app.asar.unpacked", "lib", "addon.node"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	archive, err := ReadArchive(asarFile)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	tool, err := archive.Find("lib/tool")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tool.Executable).To(BeTrue())
+	g.Expect(tool.Integrity.Algorithm).To(Equal("SHA256"))
+	g.Expect(tool.Integrity.Blocks).To(HaveLen(1))
+
+	emptyFile, err := archive.Find("lib/empty.txt")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*emptyFile.Size).To(Equal(int64(0)))
+	// sha256 of empty data
+	g.Expect(emptyFile.Integrity.Hash).To(Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+
+	addon, err := archive.Find("lib/addon.node")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(addon.Unpacked).To(BeTrue())
+	g.Expect(addon.Offset).To(BeEmpty())
+
+	link, err := archive.Find("lib/link.js")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(link.Link).To(Equal("index.js"))
+
+	emptyDir, err := archive.Find("lib/empty")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(emptyDir.IsDir()).To(BeTrue())
+
+	outDir := filepath.Join(tmpDir, "out")
+	g.Expect(archive.Extract("", outDir)).NotTo(HaveOccurred())
+
+	for _, name := range []string{"index.js", "lib/tool", "lib/addon.node", "lib/link.js"} {
+		expected, err := ioutil.ReadFile(filepath.Join(sourceDir, filepath.FromSlash(name)))
+		g.Expect(err).NotTo(HaveOccurred())
+		actual, err := ioutil.ReadFile(filepath.Join(outDir, filepath.FromSlash(name)))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(actual).To(Equal(expected))
+	}
+
+	info, err := os.Stat(filepath.Join(outDir, "lib", "tool"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	info, err = os.Stat(filepath.Join(outDir, "lib", "empty"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.IsDir()).To(BeTrue())
+}
+
+func TestHeaderFormat(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "asar")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "app")
+	g.Expect(os.MkdirAll(filepath.Join(sourceDir, "b"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("a"), 0644)).NotTo(HaveOccurred())
+
+	asarFile := filepath.Join(tmpDir, "app.asar")
+	g.Expect(Pack(sourceDir, asarFile, nil)).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(asarFile)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	headerLength := binary.LittleEndian.Uint32(data[12:])
+	header := string(data[16 : 16+headerLength])
+	g.Expect(header).To(Equal(`{"files":{"a.txt":{"size":1,"offset":"0","integrity":{"algorithm":"SHA256","hash":"ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb","blockSize":4194304,"blocks":["ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"]}},"b":{"files":{}}}}`))
+	g.Expect(strings.HasSuffix(string(data), "a")).To(BeTrue())
+}
+
+func TestGlob(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	match := func(pattern string, path string) bool {
+		matcher, err := compileGlob(pattern)
+		g.Expect(err).NotTo(HaveOccurred())
+		return matcher.match(path)
+	}
+
+	g.Expect(match("*.node", "node_modules/foo/build/Release/foo.node")).To(BeTrue())
+	g.Expect(match("*.node", "foo.nodejs")).To(BeFalse())
+	g.Expect(match("node_modules/foo/**", "node_modules/foo/lib/index.js")).To(BeTrue())
+	g.Expect(match("node_modules/foo/**", "node_modules/foobar/index.js")).To(BeFalse())
+	g.Expect(match("**/bin/*", "node_modules/foo/bin/tool")).To(BeTrue())
+	g.Expect(match("**/bin/*", "bin/tool")).To(BeTrue())
+	g.Expect(match("lib/*.{dll,so}", "lib/a.so")).To(BeTrue())
+	g.Expect(match("lib/*.{dll,so}", "lib/sub/a.so")).To(BeFalse())
+}
+
+func TestExtractRejectsPathOutsideOutDir(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "asar")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	outDir := filepath.Join(tmpDir, "out")
+
+	archive := &Archive{Root: &Node{Files: map[string]*Node{"..": {Files: map[string]*Node{"evil.js": {Link: "index.js"}}}}}}
+	err = archive.Extract("", outDir)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("illegal file path"))
+
+	archive = &Archive{Root: &Node{Files: map[string]*Node{"lib": {Files: map[string]*Node{"link": {Link: "../../etc"}}}}}}
+	err = archive.Extract("", outDir)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("illegal symlink target"))
+
+	_, err = os.Lstat(filepath.Join(outDir, "lib", "link"))
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+}
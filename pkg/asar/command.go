@@ -0,0 +1,113 @@
+package asar
+
+import (
+	"os"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type ListEntry struct {
+	Name       string `json:"name"`
+	Size       int64  `json:"size,omitempty"`
+	IsDir      bool   `json:"isDir,omitempty"`
+	Link       string `json:"link,omitempty"`
+	Unpacked   bool   `json:"unpacked,omitempty"`
+	Executable bool   `json:"executable,omitempty"`
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	configurePackCommand(app)
+	configureExtractCommand(app)
+	configureListCommand(app)
+	configureIntegrityCommand(app)
+}
+
+func configurePackCommand(app *kingpin.Application) {
+	command := app.Command("asar-pack", "Create asar archive from directory")
+	inDir := command.Flag("input", "directory to pack").Short('i').Required().String()
+	outFile := command.Flag("output", "output asar file").Short('o').Required().String()
+	unpack := command.Flag("unpack", "glob pattern of files to unpack (copy to <output>.unpacked), can be specified several times").Strings()
+	isPrintIntegrity := command.Flag("integrity", "print header integrity (JSON) of created archive").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		err := Pack(*inDir, *outFile, *unpack)
+		if err != nil || !*isPrintIntegrity {
+			return err
+		}
+
+		archive, err := ReadArchive(*outFile)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(HeaderIntegrity{Algorithm: integrityAlgorithm, Hash: archive.HeaderHash})
+	})
+}
+
+func configureExtractCommand(app *kingpin.Application) {
+	command := app.Command("asar-extract", "Extract asar archive or one entry of it")
+	inFile := command.Flag("input", "asar file").Short('i').Required().String()
+	outDir := command.Flag("output", "output directory").Short('o').String()
+	entry := command.Flag("entry", "entry to extract (path relative to the archive root), file content is written to stdout if output is not specified").Short('e').String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		archive, err := ReadArchive(*inFile)
+		if err != nil {
+			return err
+		}
+
+		if len(*outDir) != 0 {
+			return archive.Extract(*entry, *outDir)
+		}
+
+		if len(*entry) == 0 {
+			return errors.New("output directory or entry must be specified")
+		}
+
+		node, err := archive.Find(*entry)
+		if err != nil {
+			return err
+		}
+		reader, err := archive.OpenFile(*entry, node)
+		if err != nil {
+			return err
+		}
+		defer util.Close(reader)
+
+		_, err = os.Stdout.ReadFrom(reader)
+		return errors.WithStack(err)
+	})
+}
+
+func configureListCommand(app *kingpin.Application) {
+	command := app.Command("asar-list", "List entries of asar archive")
+	inFile := command.Flag("input", "asar file").Short('i').Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		archive, err := ReadArchive(*inFile)
+		if err != nil {
+			return err
+		}
+
+		entries := make([]ListEntry, 0)
+		err = archive.Walk(func(name string, node *Node) error {
+			entry := ListEntry{
+				Name:       name,
+				IsDir:      node.IsDir(),
+				Link:       node.Link,
+				Unpacked:   node.Unpacked,
+				Executable: node.Executable,
+			}
+			if node.Size != nil {
+				entry.Size = *node.Size
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(entries)
+	})
+}
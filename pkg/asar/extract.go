@@ -0,0 +1,162 @@
+package asar
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+type nodeVisitor func(name string, node *Node) error
+
+// Walk visits all entries, sorted by name, name is relative to the archive root (forward slashes)
+func (t *Archive) Walk(visitor nodeVisitor) error {
+	return walkNode("", t.Root, visitor)
+}
+
+func walkNode(parentName string, parent *Node, visitor nodeVisitor) error {
+	names := make([]string, 0, len(parent.Files))
+	for name := range parent.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		node := parent.Files[name]
+		if len(parentName) != 0 {
+			name = parentName + "/" + name
+		}
+
+		err := visitor(name, node)
+		if err != nil {
+			return err
+		}
+		if node.IsDir() {
+			err = walkNode(name, node, visitor)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// links are not followed
+func (t *Archive) Find(name string) (*Node, error) {
+	node := t.Root
+	for _, segment := range strings.Split(strings.Trim(filepath.ToSlash(name), "/"), "/") {
+		if len(segment) == 0 || segment == "." {
+			continue
+		}
+		if !node.IsDir() {
+			return nil, errors.Errorf("%s: %s is not a directory", t.file, name)
+		}
+		node = node.Files[segment]
+		if node == nil {
+			return nil, errors.Errorf("%s: %s not found", t.file, name)
+		}
+	}
+	return node, nil
+}
+
+// OpenFile returns reader of file data, unpacked file is read from <archive>.unpacked dir
+func (t *Archive) OpenFile(name string, node *Node) (io.ReadCloser, error) {
+	if node.IsDir() || node.IsLink() || node.Size == nil {
+		return nil, errors.Errorf("%s: %s is not a file", t.file, name)
+	}
+
+	if node.Unpacked {
+		file, err := os.Open(filepath.Join(t.file+".unpacked", filepath.FromSlash(name)))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return file, nil
+	}
+
+	offset, err := strconv.ParseInt(node.Offset, 10, 64)
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid offset of "+name)
+	}
+
+	file, err := os.Open(t.file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &sectionReadCloser{
+		Reader: io.NewSectionReader(file, t.dataOffset+offset, *node.Size),
+		file:   file,
+	}, nil
+}
+
+type sectionReadCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func (t *sectionReadCloser) Close() error {
+	return t.file.Close()
+}
+
+// Extract extracts entry (the whole archive if entry is empty) to outDir
+func (t *Archive) Extract(entry string, outDir string) error {
+	node, err := t.Find(entry)
+	if err != nil {
+		return err
+	}
+
+	outDir = filepath.Clean(outDir)
+	entry = strings.Trim(filepath.ToSlash(entry), "/")
+	if !node.IsDir() {
+		return t.extractNode(entry, node, filepath.Join(outDir, filepath.Base(filepath.FromSlash(entry))), outDir)
+	}
+
+	err = fsutil.EnsureDir(outDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return walkNode(entry, node, func(name string, node *Node) error {
+		return t.extractNode(name, node, filepath.Join(outDir, filepath.FromSlash(strings.TrimPrefix(name[len(entry):], "/"))), outDir)
+	})
+}
+
+// names and links are not validated on read, so, header can contain "..", absolute links and so on
+func (t *Archive) extractNode(name string, node *Node, outFile string, outDir string) error {
+	if !isInDir(outDir, outFile) {
+		return errors.Errorf("%s: illegal file path %s", t.file, name)
+	}
+
+	switch {
+	case node.IsDir():
+		return errors.WithStack(fsutil.EnsureDir(outFile))
+
+	case node.IsLink():
+		// link is relative to the archive root
+		linkTarget, err := filepath.Rel(filepath.Dir(filepath.FromSlash(name)), filepath.FromSlash(node.Link))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		// otherwise subsequent entries can be written outside of output dir through the link
+		if filepath.IsAbs(node.Link) || !isInDir(outDir, filepath.Join(filepath.Dir(outFile), linkTarget)) {
+			return errors.Errorf("%s: illegal symlink target %s of %s", t.file, node.Link, name)
+		}
+		return errors.WithStack(os.Symlink(linkTarget, outFile))
+
+	default:
+		reader, err := t.OpenFile(name, node)
+		if err != nil {
+			return err
+		}
+		defer util.Close(reader)
+		return errors.WithStack(fsutil.WriteFile(reader, outFile, fileMode(node), make([]byte, 32*1024)))
+	}
+}
+
+func isInDir(dir string, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(os.PathSeparator))
+}
@@ -0,0 +1,98 @@
+package asar
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+// minimatch-like pattern (as used by electron-builder asarUnpack): **, *, ?, {a,b}.
+// Pattern without slash is matched against the file name (matchBase), otherwise against the path relative to the archive root.
+type globMatcher struct {
+	expression  *regexp.Regexp
+	isMatchBase bool
+}
+
+func compileGlobs(patterns []string) ([]*globMatcher, error) {
+	var result []*globMatcher
+	for _, pattern := range patterns {
+		matcher, err := compileGlob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, matcher)
+	}
+	return result, nil
+}
+
+func compileGlob(pattern string) (*globMatcher, error) {
+	pattern = strings.TrimPrefix(strings.Replace(pattern, "\\", "/", -1), "./")
+	var builder strings.Builder
+	builder.WriteString("^")
+	braceDepth := 0
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			builder.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			builder.WriteString(".*")
+			i++
+		case c == '*':
+			builder.WriteString("[^/]*")
+		case c == '?':
+			builder.WriteString("[^/]")
+		case c == '{':
+			braceDepth++
+			builder.WriteString("(?:")
+		case c == '}' && braceDepth > 0:
+			braceDepth--
+			builder.WriteString(")")
+		case c == ',' && braceDepth > 0:
+			builder.WriteString("|")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	builder.WriteString("$")
+
+	expression, err := regexp.Compile(builder.String())
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid pattern "+pattern)
+	}
+	return &globMatcher{
+		expression:  expression,
+		isMatchBase: !strings.Contains(pattern, "/"),
+	}, nil
+}
+
+// path uses forward slashes
+func (t *globMatcher) match(path string) bool {
+	if t.isMatchBase {
+		path = path[strings.LastIndex(path, "/")+1:]
+	}
+	return t.expression.MatchString(path)
+}
+
+// Globs is a set of compiled patterns (see globMatcher)
+type Globs []*globMatcher
+
+func CompileGlobs(patterns []string) (Globs, error) {
+	return compileGlobs(patterns)
+}
+
+// Match reports whether path (relative, forward slashes) is matched by one of patterns
+func (t Globs) Match(path string) bool {
+	return matchAny(t, path)
+}
+
+func matchAny(matchers []*globMatcher, path string) bool {
+	for _, matcher := range matchers {
+		if matcher.match(path) {
+			return true
+		}
+	}
+	return false
+}
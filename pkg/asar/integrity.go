@@ -0,0 +1,153 @@
+package asar
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/pe"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/errors"
+)
+
+// InfoPlistIntegrityKey is the key of Info.plist with header hashes of archives (keys are relative to Contents, e.g. Resources/app.asar)
+const InfoPlistIntegrityKey = "ElectronAsarIntegrity"
+
+type HeaderIntegrity struct {
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
+type ArchiveIntegrity struct {
+	// relative to resources dir, forward slashes
+	File string `json:"file"`
+	HeaderIntegrity
+}
+
+// WindowsArchiveIntegrity is an item of INTEGRITY/ELECTRONASAR resource, file is relative to the executable dir (backslashes)
+type WindowsArchiveIntegrity struct {
+	File      string `json:"file"`
+	Algorithm string `json:"alg"`
+	Value     string `json:"value"`
+}
+
+type IntegrityManifest struct {
+	Archives []ArchiveIntegrity `json:"archives"`
+	// ElectronAsarIntegrity value of Info.plist (macOS)
+	InfoPlist map[string]HeaderIntegrity `json:"infoPlist"`
+	// INTEGRITY/ELECTRONASAR resource of executable (Windows)
+	WindowsResource []WindowsArchiveIntegrity `json:"windowsResource"`
+}
+
+func configureIntegrityCommand(app *kingpin.Application) {
+	command := app.Command("asar-integrity", "Compute asar header hashes checked by Electron (asar integrity fuse) and write Info.plist key (macOS) or executable resource (Windows)")
+	resourcesDir := command.Flag("resources-dir", "directory with archives (Contents/Resources on macOS, resources on Windows)").Required().String()
+	archives := command.Flag("archive", "archive path relative to resources dir, can be specified several times (default: all asar files of resources dir)").Strings()
+	infoPlist := command.Flag("info-plist", "Info.plist to update").String()
+	executable := command.Flag("executable", "Windows executable to embed integrity resource into").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		manifest, err := ComputeIntegrityManifest(*resourcesDir, *archives)
+		if err != nil {
+			return err
+		}
+
+		if len(*infoPlist) != 0 {
+			err = manifest.WriteInfoPlist(*infoPlist)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(*executable) != 0 {
+			err = manifest.WriteExecutableResource(*executable)
+			if err != nil {
+				return err
+			}
+		}
+
+		// encoding/json - manifest contains map
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = os.Stdout.Write(data)
+		return errors.WithStack(err)
+	})
+}
+
+// ComputeIntegrityManifest computes header hashes of archives (paths relative to resources dir), all asar files of resources dir are used if not specified
+func ComputeIntegrityManifest(resourcesDir string, archives []string) (*IntegrityManifest, error) {
+	if len(archives) == 0 {
+		files, err := ioutil.ReadDir(resourcesDir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, file := range files {
+			if file.Mode().IsRegular() && strings.HasSuffix(file.Name(), ".asar") {
+				archives = append(archives, file.Name())
+			}
+		}
+		if len(archives) == 0 {
+			return nil, errors.Errorf("no asar archives in %s", resourcesDir)
+		}
+	}
+
+	result := &IntegrityManifest{
+		Archives:        make([]ArchiveIntegrity, 0, len(archives)),
+		InfoPlist:       make(map[string]HeaderIntegrity),
+		WindowsResource: make([]WindowsArchiveIntegrity, 0, len(archives)),
+	}
+
+	sorted := make([]string, 0, len(archives))
+	for _, archive := range archives {
+		sorted = append(sorted, filepath.ToSlash(archive))
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		archive, err := ReadArchive(filepath.Join(resourcesDir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+
+		integrity := HeaderIntegrity{Algorithm: integrityAlgorithm, Hash: archive.HeaderHash}
+		result.Archives = append(result.Archives, ArchiveIntegrity{File: name, HeaderIntegrity: integrity})
+		result.InfoPlist["Resources/"+name] = integrity
+		result.WindowsResource = append(result.WindowsResource, WindowsArchiveIntegrity{
+			File:      "resources\\" + strings.Replace(name, "/", "\\", -1),
+			Algorithm: strings.ToLower(integrityAlgorithm),
+			Value:     archive.HeaderHash,
+		})
+	}
+	return result, nil
+}
+
+// WriteInfoPlist replaces ElectronAsarIntegrity of Info.plist, format of file is preserved
+func (t *IntegrityManifest) WriteInfoPlist(file string) error {
+	dict, format, err := plist.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	value := make(map[string]interface{}, len(t.InfoPlist))
+	for name, integrity := range t.InfoPlist {
+		value[name] = map[string]interface{}{"algorithm": integrity.Algorithm, "hash": integrity.Hash}
+	}
+	dict[InfoPlistIntegrityKey] = value
+	return plist.WriteFile(file, dict, format)
+}
+
+// WriteExecutableResource embeds (replaces) INTEGRITY/ELECTRONASAR resource, executable must be signed after that
+func (t *IntegrityManifest) WriteExecutableResource(file string) error {
+	data, err := json.Marshal(t.WindowsResource)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return pe.EditFile(file, file, &pe.EditOptions{AsarIntegrity: data})
+}
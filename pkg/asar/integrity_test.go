@@ -0,0 +1,57 @@
+package asar
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/plist"
+	. "github.com/onsi/gomega"
+)
+
+func TestIntegrityManifest(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "asar-integrity")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "app")
+	createTestDir(g, sourceDir)
+	resourcesDir := filepath.Join(tmpDir, "Resources")
+	g.Expect(Pack(sourceDir, filepath.Join(resourcesDir, "app.asar"), []string{"*.node"})).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(resourcesDir, "icon.icns"), []byte("icon"), 0644)).To(Succeed())
+
+	// hash of header JSON (without pickle)
+	data, err := ioutil.ReadFile(filepath.Join(resourcesDir, "app.asar"))
+	g.Expect(err).NotTo(HaveOccurred())
+	headerLength := binary.LittleEndian.Uint32(data[12:])
+	expectedHash := sha256.Sum256(data[16 : 16+headerLength])
+	hash := hex.EncodeToString(expectedHash[:])
+
+	manifest, err := ComputeIntegrityManifest(resourcesDir, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifest.Archives).To(Equal([]ArchiveIntegrity{{File: "app.asar", HeaderIntegrity: HeaderIntegrity{Algorithm: "SHA256", Hash: hash}}}))
+	g.Expect(manifest.InfoPlist).To(Equal(map[string]HeaderIntegrity{"Resources/app.asar": {Algorithm: "SHA256", Hash: hash}}))
+	g.Expect(manifest.WindowsResource).To(Equal([]WindowsArchiveIntegrity{{File: "resources\\app.asar", Algorithm: "sha256", Value: hash}}))
+
+	infoPlist := filepath.Join(tmpDir, "Info.plist")
+	g.Expect(plist.WriteFile(infoPlist, map[string]interface{}{"CFBundleName": "Test"}, plist.BinaryFormat)).To(Succeed())
+	g.Expect(manifest.WriteInfoPlist(infoPlist)).To(Succeed())
+	dict, format, err := plist.ReadFile(infoPlist)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(format).To(Equal(plist.BinaryFormat))
+	g.Expect(dict["CFBundleName"]).To(Equal("Test"))
+	g.Expect(dict[InfoPlistIntegrityKey]).To(Equal(map[string]interface{}{
+		"Resources/app.asar": map[string]interface{}{"algorithm": "SHA256", "hash": hash},
+	}))
+
+	_, err = ComputeIntegrityManifest(sourceDir, nil)
+	g.Expect(err).To(HaveOccurred())
+	_, err = ComputeIntegrityManifest(resourcesDir, []string{"icon.icns"})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,288 @@
+package asar
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+type packFile struct {
+	path string
+	// relative to the archive root, forward slashes
+	name string
+	node *Node
+}
+
+// Pack creates asar archive from dir. Files matched by one of unpackPatterns are copied to <outFile>.unpacked dir instead.
+func Pack(dir string, outFile string, unpackPatterns []string) error {
+	unpackMatchers, err := compileGlobs(unpackPatterns)
+	if err != nil {
+		return err
+	}
+	return pack(dir, outFile, func(name string) bool {
+		return matchAny(unpackMatchers, name)
+	})
+}
+
+// PackWithUnpacked is the same as Pack, but files to unpack are specified by names relative to the archive root (e.g. to repack extracted archive)
+func PackWithUnpacked(dir string, outFile string, unpackedNames map[string]bool) error {
+	return pack(dir, outFile, func(name string) bool {
+		return unpackedNames[name]
+	})
+}
+
+func pack(dir string, outFile string, isUnpacked func(name string) bool) error {
+	_, span := trace.Start(context.Background(), "asar")
+	span.SetAttribute("file", filepath.Base(outFile))
+	err := doPack(dir, outFile, isUnpacked)
+	span.End(err)
+	return err
+}
+
+func doPack(dir string, outFile string, isUnpacked func(name string) bool) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	outFile, err = filepath.Abs(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	unpackedDir := outFile + ".unpacked"
+	err = os.RemoveAll(unpackedDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	root, files, err := collectFiles(dir, outFile, isUnpacked)
+	if err != nil {
+		return err
+	}
+
+	err = util.MapAsync(len(files), func(taskIndex int) (func() error, error) {
+		file := files[taskIndex]
+		return func() error {
+			integrity, err := computeIntegrity(file.path)
+			if err != nil {
+				return err
+			}
+			file.node.Integrity = integrity
+
+			if file.node.Unpacked {
+				err = fsutil.CopyFile(file.path, filepath.Join(unpackedDir, filepath.FromSlash(file.name)), fileMode(file.node))
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var offset int64
+	for _, file := range files {
+		if !file.node.Unpacked {
+			file.node.Offset = strconv.FormatInt(offset, 10)
+			offset += *file.node.Size
+		}
+	}
+
+	header, err := encodeHeader(root)
+	if err != nil {
+		return err
+	}
+
+	outFileDescriptor, err := fsutil.CreateFile(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = writeArchive(outFileDescriptor, header, files)
+	if err != nil {
+		return errors.WithStack(fsutil.CloseAndCheckError(err, outFileDescriptor))
+	}
+	err = outFileDescriptor.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.WithFields(log.Fields{
+		"file":      outFile,
+		"fileCount": len(files),
+	}).Debug("asar created")
+	return nil
+}
+
+func collectFiles(dir string, outFile string, isUnpacked func(name string) bool) (*Node, []*packFile, error) {
+	root := &Node{Files: make(map[string]*Node)}
+	nameToDir := map[string]*Node{"": root}
+	var files []*packFile
+	isUnixMode := runtime.GOOS != "windows"
+
+	// filepath.Walk walks files in lexical order, so, file data is written in a stable order
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		if path == outFile || path == outFile+".unpacked" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(relativePath)
+		parentName := ""
+		baseName := name
+		if index := strings.LastIndexByte(name, '/'); index != -1 {
+			parentName = name[:index]
+			baseName = name[index+1:]
+		}
+		parent := nameToDir[parentName]
+
+		node := &Node{}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := resolveLink(dir, path)
+			if err != nil {
+				return err
+			}
+			node.Link = link
+		case info.IsDir():
+			node.Files = make(map[string]*Node)
+			nameToDir[name] = node
+		default:
+			size := info.Size()
+			node.Size = &size
+			node.Unpacked = isUnpacked(name)
+			node.Executable = isUnixMode && info.Mode()&0100 != 0
+			files = append(files, &packFile{path: path, name: name, node: node})
+		}
+		parent.Files[baseName] = node
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return root, files, nil
+}
+
+// link is stored relative to the archive root, link to a file outside of the archive is not allowed
+func resolveLink(dir string, path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	relativeTarget, err := filepath.Rel(dir, target)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if relativeTarget == ".." || strings.HasPrefix(relativeTarget, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("%s: link %s points outside of %s", path, target, dir)
+	}
+	return filepath.ToSlash(relativeTarget), nil
+}
+
+func computeIntegrity(file string) (*Integrity, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(reader)
+
+	fileHash := sha256.New()
+	blockHash := sha256.New()
+	integrity := &Integrity{
+		Algorithm: integrityAlgorithm,
+		BlockSize: integrityBlockSize,
+		Blocks:    []string{},
+	}
+	for {
+		copied, err := io.CopyN(io.MultiWriter(fileHash, blockHash), reader, integrityBlockSize)
+		if err != nil && err != io.EOF {
+			return nil, errors.WithStack(err)
+		}
+		// empty file has one block (hash of empty data)
+		if copied > 0 || len(integrity.Blocks) == 0 {
+			integrity.Blocks = append(integrity.Blocks, hex.EncodeToString(blockHash.Sum(nil)))
+			blockHash.Reset()
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	integrity.Hash = hex.EncodeToString(fileHash.Sum(nil))
+	return integrity, nil
+}
+
+func writeArchive(writer io.Writer, header []byte, files []*packFile) error {
+	bufferedWriter := bufio.NewWriterSize(writer, 64*1024)
+	_, err := bufferedWriter.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.node.Unpacked {
+			continue
+		}
+
+		err = copyFileTo(file.path, *file.node.Size, bufferedWriter)
+		if err != nil {
+			return err
+		}
+	}
+	return bufferedWriter.Flush()
+}
+
+func copyFileTo(file string, size int64, writer io.Writer) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer util.Close(reader)
+
+	// file must be not modified during packing, otherwise offsets in the header are wrong
+	copied, err := io.Copy(writer, io.LimitReader(reader, size))
+	if err != nil {
+		return err
+	}
+	if copied != size {
+		return errors.Errorf("%s: size changed during packing (expected %d, got %d)", file, size, copied)
+	}
+	return nil
+}
+
+func fileMode(node *Node) os.FileMode {
+	if node.Executable {
+		return 0755
+	}
+	return 0644
+}
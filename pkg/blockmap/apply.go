@@ -0,0 +1,221 @@
+package blockmap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/app-builder/pkg/util/httpclient"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+)
+
+type ApplyResult struct {
+	Size           int64 `json:"size"`
+	CopiedSize     int64 `json:"copiedSize"`
+	DownloadedSize int64 `json:"downloadedSize"`
+}
+
+type blockOperationKind int
+
+const (
+	copyBlock blockOperationKind = iota
+	downloadBlock
+)
+
+// continuous range of the new file, taken either from old file (copy) or from remote file (download)
+type blockOperation struct {
+	kind blockOperationKind
+	// offset in the old file for copy, offset in the remote file for download
+	start int64
+	end   int64
+}
+
+// ApplyBlockMap reconstructs new file (described by newBlockMapFile) using blocks of old file and downloads only changed blocks from url.
+// Old file is chunked using DefaultChunkerConfiguration, so, blocks are comparable only if new block map was built using the same configuration.
+func ApplyBlockMap(oldFile string, newBlockMapFile string, url string, outFile string, expectedSha512 string) (*ApplyResult, error) {
+	newBlockMap, err := ReadBlockMap(newBlockMapFile)
+	if err != nil {
+		return nil, err
+	}
+
+	oldChecksums, oldSizes, _, err := computeBlocks(oldFile, DefaultChunkerConfiguration)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	operations, err := computeOperations(oldChecksums, oldSizes, newBlockMap)
+	if err != nil {
+		return nil, err
+	}
+
+	oldFileDescriptor, err := os.Open(oldFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(oldFileDescriptor)
+
+	outFileDescriptor, err := fsutil.CreateFile(outFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &ApplyResult{}
+	hash := sha512.New()
+	writer := bufio.NewWriter(io.MultiWriter(outFileDescriptor, hash))
+	client := httpclient.NewClient()
+	for _, operation := range operations {
+		length := operation.end - operation.start
+		if operation.kind == copyBlock {
+			_, err = io.Copy(writer, io.NewSectionReader(oldFileDescriptor, operation.start, length))
+			result.CopiedSize += length
+		} else {
+			err = downloadRange(client, url, operation.start, operation.end, writer)
+			result.DownloadedSize += length
+		}
+		if err != nil {
+			return nil, fsutil.CloseAndCheckError(err, outFileDescriptor)
+		}
+		result.Size += length
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return nil, fsutil.CloseAndCheckError(err, outFileDescriptor)
+	}
+	err = outFileDescriptor.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	actualSha512 := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+	if actualSha512 != expectedSha512 {
+		_ = os.Remove(outFile)
+		return nil, errors.Errorf("sha512 checksum mismatch for reconstructed file %s, expected %s, got %s", outFile, expectedSha512, actualSha512)
+	}
+
+	log.WithFields(log.Fields{
+		"file":       outFile,
+		"size":       result.Size,
+		"copied":     result.CopiedSize,
+		"downloaded": result.DownloadedSize,
+	}).Debug("file reconstructed from block map")
+	return result, nil
+}
+
+// adjacent blocks of the same kind are merged to reduce number of requests
+func computeOperations(oldChecksums *[]string, oldSizes *[]int, newBlockMap *BlockMap) ([]blockOperation, error) {
+	checksumToOldOffset := make(map[string]int64)
+	var offset int64
+	for index, checksum := range *oldChecksums {
+		key := blockKey(checksum, (*oldSizes)[index])
+		if _, exists := checksumToOldOffset[key]; !exists {
+			checksumToOldOffset[key] = offset
+		}
+		offset += int64((*oldSizes)[index])
+	}
+
+	var operations []blockOperation
+	for _, file := range newBlockMap.Files {
+		if len(file.Checksums) != len(file.Sizes) {
+			return nil, errors.Errorf("invalid block map: number of checksums (%d) doesn't match number of sizes (%d)", len(file.Checksums), len(file.Sizes))
+		}
+
+		newOffset := int64(file.Offset)
+		for index, checksum := range file.Checksums {
+			size := int64(file.Sizes[index])
+
+			operation := blockOperation{kind: downloadBlock, start: newOffset, end: newOffset + size}
+			oldOffset, exists := checksumToOldOffset[blockKey(checksum, file.Sizes[index])]
+			if exists {
+				operation = blockOperation{kind: copyBlock, start: oldOffset, end: oldOffset + size}
+			}
+			newOffset += size
+
+			if len(operations) > 0 {
+				last := &operations[len(operations)-1]
+				if last.kind == operation.kind && last.end == operation.start {
+					last.end = operation.end
+					continue
+				}
+			}
+			operations = append(operations, operation)
+		}
+	}
+	return operations, nil
+}
+
+func blockKey(checksum string, size int) string {
+	return fmt.Sprintf("%s-%d", checksum, size)
+}
+
+// end is exclusive
+func downloadRange(client *http.Client, url string, start int64, end int64, writer io.Writer) error {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer util.Close(response.Body)
+
+	if response.StatusCode != http.StatusPartialContent {
+		return errors.Errorf("cannot download range %d-%d of %s: server responded with %s, range requests must be supported", start, end-1, url, response.Status)
+	}
+
+	copied, err := io.Copy(writer, io.LimitReader(response.Body, end-start))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if copied != end-start {
+		return errors.Errorf("cannot download range %d-%d of %s: expected %d bytes, got %d", start, end-1, url, end-start, copied)
+	}
+	return nil
+}
+
+// block map file can be compressed using gzip or deflate (see BuildBlockMap) or not compressed
+func ReadBlockMap(file string) (*BlockMap, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var reader io.Reader
+	switch {
+	case len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer util.Close(gzipReader)
+		reader = gzipReader
+	case len(data) > 0 && data[0] == '{':
+		reader = bytes.NewReader(data)
+	default:
+		flateReader := flate.NewReader(bytes.NewReader(data))
+		defer util.Close(flateReader)
+		reader = flateReader
+	}
+
+	blockMap := &BlockMap{}
+	err = jsoniter.ConfigFastest.NewDecoder(reader).Decode(blockMap)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot decode block map "+file)
+	}
+	return blockMap, nil
+}
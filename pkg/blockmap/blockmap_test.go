@@ -1,11 +1,18 @@
 package blockmap_test
 
 import (
+	"bytes"
 	"crypto/sha512"
 	"encoding/base64"
 	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/json-iterator/go"
 	. "github.com/onsi/ginkgo"
@@ -46,4 +53,46 @@ var _ = Describe("Blockmap", func() {
 		//noinspection SpellCheckingInspection
 		Expect(string(serializedInputInfo)).To(Equal("{\"size\":13423,\"sha512\":\"zPFW3WAFUKFvAfBdNXHDIuZekSW/qf33lf5OgKXBKg9oOobwVH9X/DRHExC9087Cxkp3nqFrwtreWZHLso3D6g==\",\"blockMapSize\":107}"))
 	})
+	It("apply", func() {
+		tmpDir, err := ioutil.TempDir("", "apply-blockmap")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+
+		random := rand.New(rand.NewSource(42))
+		oldData := make([]byte, 512*1024)
+		random.Read(oldData)
+		inserted := make([]byte, 10*1024)
+		random.Read(inserted)
+		newData := append(append(append([]byte{}, oldData[:200*1024]...), inserted...), oldData[200*1024:]...)
+
+		oldFile := filepath.Join(tmpDir, "old")
+		newFile := filepath.Join(tmpDir, "new")
+		blockMapFile := filepath.Join(tmpDir, "new.blockmap")
+		Expect(ioutil.WriteFile(oldFile, oldData, 0644)).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(newFile, newData, 0644)).NotTo(HaveOccurred())
+
+		inputInfo, err := BuildBlockMap(newFile, DefaultChunkerConfiguration, GZIP, blockMapFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			http.ServeContent(writer, request, "new", time.Time{}, bytes.NewReader(newData))
+		}))
+		defer server.Close()
+
+		outFile := filepath.Join(tmpDir, "out")
+		result, err := ApplyBlockMap(oldFile, blockMapFile, server.URL, outFile, inputInfo.Sha512)
+		Expect(err).NotTo(HaveOccurred())
+
+		outData, err := ioutil.ReadFile(outFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(outData, newData)).To(BeTrue())
+		Expect(result.Size).To(Equal(int64(len(newData))))
+		Expect(result.CopiedSize + result.DownloadedSize).To(Equal(result.Size))
+		Expect(result.DownloadedSize).To(BeNumerically("<", len(newData)/4))
+
+		_, err = ApplyBlockMap(oldFile, blockMapFile, server.URL, outFile, "wrong")
+		Expect(err).To(HaveOccurred())
+		_, err = os.Stat(outFile)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
 })
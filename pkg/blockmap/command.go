@@ -31,3 +31,20 @@ func ConfigureCommand(app *kingpin.Application) {
 		return util.WriteJsonToStdOut(inputInfo)
 	})
 }
+
+func ConfigureApplyCommand(app *kingpin.Application) {
+	command := app.Command("apply-blockmap", "Reconstructs new file from old file and block map of new file, only changed blocks are downloaded (HTTP Range requests)")
+	oldFile := command.Flag("old", "old (local) file").Required().String()
+	blockMapFile := command.Flag("blockmap", "block map of new file").Short('b').Required().String()
+	url := command.Flag("url", "URL of new file").Short('u').Required().String()
+	outFile := command.Flag("output", "output file").Short('o').Required().String()
+	sha512 := command.Flag("sha512", "expected sha512 (base64) of new file").Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := ApplyBlockMap(*oldFile, *blockMapFile, *url, *outFile, *sha512)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
@@ -0,0 +1,226 @@
+package gpg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/credentials"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// SignOptions of detached signing. If key is specified, it is imported into the temporary keyring (user keyring is not modified), user keyring is used otherwise.
+type SignOptions struct {
+	// armored or binary private key (base64 is decoded)
+	Key        []byte
+	KeyId      string
+	Passphrase string
+}
+
+type SignResult struct {
+	File      string `json:"file"`
+	Signature string `json:"signature"`
+}
+
+// GetGpgPath returns GPG_PATH env or gpg
+func GetGpgPath() string {
+	result := os.Getenv("GPG_PATH")
+	if len(result) == 0 {
+		result = "gpg"
+	}
+	return result
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("sign", "Sign artifacts.")
+	gpgCommand := command.Command("gpg", "Produce detached ASCII armored signatures (<file>.asc) using gpg.")
+	files := gpgCommand.Arg("files", "The files to sign (AppImage, deb, rpm, latest-linux.yml).").Required().Strings()
+	keyFile := gpgCommand.Flag("key-file", "The private key file.").String()
+	key := gpgCommand.Flag("key", "The private key (armored or base64).").Envar("GPG_PRIVATE_KEY").String()
+	keyId := gpgCommand.Flag("key-id", "The key id (default key is used if not specified).").Envar("GPG_KEY_ID").String()
+	passphrase := gpgCommand.Flag("passphrase", "The passphrase of private key (default: GPG_PASSPHRASE from the credential store or env).").String()
+
+	gpgCommand.Action(func(context *kingpin.ParseContext) error {
+		credentials.Fill(passphrase, "GPG_PASSPHRASE")
+		options := &SignOptions{KeyId: *keyId, Passphrase: *passphrase}
+		if len(*keyFile) != 0 {
+			data, err := ioutil.ReadFile(*keyFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			options.Key = data
+		} else if len(*key) != 0 {
+			options.Key = []byte(*key)
+		}
+
+		result, err := Sign(*files, options)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// Sign writes <file>.asc for every file
+func Sign(files []string, options *SignOptions) ([]SignResult, error) {
+	homeDir, err := prepareHomeDir(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(homeDir) != 0 {
+		defer removeHomeDir(homeDir)
+	}
+
+	result := make([]SignResult, len(files))
+	reporter := progress.Start("sign", "", int64(len(files)))
+	err = progress.MapAsync(reporter, len(files), func(taskIndex int) (func() error, error) {
+		file := files[taskIndex]
+		return func() error {
+			signatureFile := file + ".asc"
+			err := run(createSignArgs(homeDir, file, signatureFile, true, options), options.Passphrase)
+			if err != nil {
+				return errors.Wrapf(err, "cannot sign %s", file)
+			}
+			result[taskIndex] = SignResult{File: file, Signature: signatureFile}
+			return nil
+		}, nil
+	})
+	reporter.Finish(err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SignData returns binary (not armored) detached signature of data (e.g. RPM header)
+func SignData(data []byte, options *SignOptions) ([]byte, error) {
+	homeDir, err := prepareHomeDir(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(homeDir) != 0 {
+		defer removeHomeDir(homeDir)
+	}
+
+	tempDir, err := util.TempDir("", ".gpg-data")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	dataFile := filepath.Join(tempDir, "data")
+	err = ioutil.WriteFile(dataFile, data, 0600)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	signatureFile := dataFile + ".sig"
+	err = run(createSignArgs(homeDir, dataFile, signatureFile, false, options), options.Passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot sign data")
+	}
+
+	result, err := ioutil.ReadFile(signatureFile)
+	return result, errors.WithStack(err)
+}
+
+// key is imported into the temporary home dir if specified, empty home dir means user keyring
+func prepareHomeDir(options *SignOptions) (string, error) {
+	if len(options.Key) == 0 {
+		return "", nil
+	}
+
+	homeDir, err := util.TempDir("", ".gnupg")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	err = importKey(homeDir, decodeKey(options.Key), options.Passphrase)
+	if err != nil {
+		removeHomeDir(homeDir)
+		return "", err
+	}
+	return homeDir, nil
+}
+
+// key from env is often base64 encoded (CI secrets cannot contain new lines)
+func decodeKey(key []byte) []byte {
+	trimmed := bytes.TrimSpace(key)
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		return trimmed
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(string(trimmed))
+	if err != nil {
+		return key
+	}
+	return decoded
+}
+
+func importKey(homeDir string, key []byte, passphrase string) error {
+	keyFile := filepath.Join(homeDir, "key")
+	err := ioutil.WriteFile(keyFile, key, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	args := append(createBaseArgs(homeDir, passphrase), "--import", keyFile)
+	err = run(args, passphrase)
+	if err != nil {
+		return errors.Wrap(err, "cannot import private key")
+	}
+	return nil
+}
+
+// passphrase is passed using stdin, not args
+func createBaseArgs(homeDir string, passphrase string) []string {
+	args := []string{"--batch", "--yes"}
+	if len(homeDir) != 0 {
+		args = append(args, "--homedir", homeDir)
+	}
+	if len(passphrase) != 0 {
+		args = append(args, "--pinentry-mode", "loopback", "--passphrase-fd", "0")
+	}
+	return args
+}
+
+func createSignArgs(homeDir string, file string, signatureFile string, isArmor bool, options *SignOptions) []string {
+	args := createBaseArgs(homeDir, options.Passphrase)
+	if len(options.KeyId) != 0 {
+		args = append(args, "--local-user", options.KeyId)
+	}
+	if isArmor {
+		args = append(args, "--armor")
+	}
+	return append(args, "--digest-algo", "sha256", "--detach-sign", "--output", signatureFile, file)
+}
+
+func run(args []string, passphrase string) error {
+	command := exec.Command(GetGpgPath(), args...)
+	if len(passphrase) != 0 {
+		command.Stdin = strings.NewReader(passphrase + "\n")
+	}
+	_, err := util.Execute(command, "")
+	return err
+}
+
+// gpg-agent is started for the temporary home dir and must be stopped
+func removeHomeDir(homeDir string) {
+	err := exec.Command("gpgconf", "--homedir", homeDir, "--kill", "gpg-agent").Run()
+	if err != nil {
+		log.WithError(err).Debug("cannot stop gpg-agent")
+	}
+
+	err = os.RemoveAll(homeDir)
+	if err != nil {
+		log.WithError(err).WithField("dir", homeDir).Warn("cannot remove temporary gpg home dir")
+	}
+}
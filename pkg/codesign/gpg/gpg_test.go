@@ -0,0 +1,54 @@
+package gpg
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSignWithImportedKey(t *testing.T) {
+	if _, err := exec.LookPath(GetGpgPath()); err != nil {
+		t.Skip("gpg is not installed")
+	}
+
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "gpg")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// key is generated in a separate home dir to check that the temporary keyring is used for signing
+	keyHomeDir := filepath.Join(tmpDir, "key-home")
+	g.Expect(os.Mkdir(keyHomeDir, 0700)).NotTo(HaveOccurred())
+	defer removeHomeDir(keyHomeDir)
+	g.Expect(exec.Command(GetGpgPath(), "--batch", "--homedir", keyHomeDir, "--pinentry-mode", "loopback", "--passphrase", "secret", "--quick-gen-key", "Test <test@example.com>", "ed25519", "sign", "never").Run()).NotTo(HaveOccurred())
+	key, err := exec.Command(GetGpgPath(), "--batch", "--homedir", keyHomeDir, "--pinentry-mode", "loopback", "--passphrase", "secret", "--armor", "--export-secret-keys").Output()
+	g.Expect(err).NotTo(HaveOccurred())
+
+	file := filepath.Join(tmpDir, "latest-linux.yml")
+	g.Expect(ioutil.WriteFile(file, []byte("version: 1.0.0\n"), 0644)).NotTo(HaveOccurred())
+
+	result, err := Sign([]string{file}, &SignOptions{Key: []byte(base64.StdEncoding.EncodeToString(key)), Passphrase: "secret"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal([]SignResult{{File: file, Signature: file + ".asc"}}))
+
+	signature, err := ioutil.ReadFile(file + ".asc")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(signature)).To(HavePrefix("-----BEGIN PGP SIGNATURE-----"))
+	g.Expect(exec.Command(GetGpgPath(), "--batch", "--homedir", keyHomeDir, "--verify", file+".asc", file).Run()).NotTo(HaveOccurred())
+
+	_, err = Sign([]string{file}, &SignOptions{Key: key, Passphrase: "wrong"})
+	g.Expect(err).To(HaveOccurred())
+
+	// binary signature of data (e.g. RPM header)
+	signature, err = SignData([]byte("header"), &SignOptions{Key: key, Passphrase: "secret"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(file+".sig", signature, 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(file, []byte("header"), 0644)).NotTo(HaveOccurred())
+	g.Expect(exec.Command(GetGpgPath(), "--batch", "--homedir", keyHomeDir, "--verify", file+".sig", file).Run()).NotTo(HaveOccurred())
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+// +build darwin
+
+package mac
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func detachFromTerminal(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
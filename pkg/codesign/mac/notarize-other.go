@@ -0,0 +1,12 @@
+//go:build !darwin
+// +build !darwin
+
+package mac
+
+import (
+	"os/exec"
+)
+
+// notarytool is available only on macOS
+func detachFromTerminal(command *exec.Cmd) {
+}
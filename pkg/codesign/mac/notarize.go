@@ -0,0 +1,230 @@
+package mac
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/credentials"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// credentials: Apple ID (app-specific password), App Store Connect API key or keychain profile (stored using notarytool store-credentials)
+type NotarizeOptions struct {
+	AppleId  string
+	Password string
+	TeamId   string
+
+	ApiKey       string
+	ApiKeyId     string
+	ApiKeyIssuer string
+
+	KeychainProfile string
+	Keychain        string
+
+	IsStaple bool
+}
+
+type NotarizeResult struct {
+	Id      string `json:"id"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// reported by Apple if status is not Accepted
+	Issues    []NotarizeIssue `json:"issues,omitempty"`
+	IsStapled bool            `json:"stapled"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+type NotarizeIssue struct {
+	Severity     string `json:"severity"`
+	Path         string `json:"path,omitempty"`
+	Message      string `json:"message"`
+	Architecture string `json:"architecture,omitempty"`
+	DocUrl       string `json:"docUrl,omitempty"`
+}
+
+type notarytoolLog struct {
+	Status        string          `json:"status"`
+	StatusSummary string          `json:"statusSummary"`
+	Issues        []NotarizeIssue `json:"issues"`
+}
+
+func ConfigureNotarizeCommand(app *kingpin.Application) {
+	command := app.Command("notarize", "Submit app bundle, DMG or PKG to Apple notary service and staple the ticket (result is written as JSON).")
+	file := command.Flag("file", "The app bundle, DMG, PKG or ZIP.").Required().String()
+	appleId := command.Flag("apple-id", "The Apple ID.").Envar("APPLE_ID").String()
+	password := command.Flag("password", "The app-specific password (default: APPLE_APP_SPECIFIC_PASSWORD from the credential store or env).").String()
+	teamId := command.Flag("team-id", "The team ID.").Envar("APPLE_TEAM_ID").String()
+	apiKey := command.Flag("api-key", "The App Store Connect API key file (.p8).").Envar("APPLE_API_KEY").String()
+	apiKeyId := command.Flag("api-key-id", "The App Store Connect API key ID.").Envar("APPLE_API_KEY_ID").String()
+	apiKeyIssuer := command.Flag("api-key-issuer", "The App Store Connect API issuer ID.").Envar("APPLE_API_ISSUER").String()
+	keychainProfile := command.Flag("keychain-profile", "The notarytool keychain profile.").Envar("APPLE_KEYCHAIN_PROFILE").String()
+	keychain := command.Flag("keychain", "The keychain of keychain profile.").String()
+	isStaple := command.Flag("staple", "Staple the ticket on success.").Default("true").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		if len(*apiKey) == 0 && len(*keychainProfile) == 0 {
+			credentials.Fill(password, "APPLE_APP_SPECIFIC_PASSWORD")
+		}
+		result, err := Notarize(*file, &NotarizeOptions{
+			AppleId:         *appleId,
+			Password:        *password,
+			TeamId:          *teamId,
+			ApiKey:          *apiKey,
+			ApiKeyId:        *apiKeyId,
+			ApiKeyIssuer:    *apiKeyIssuer,
+			KeychainProfile: *keychainProfile,
+			Keychain:        *keychain,
+			IsStaple:        *isStaple,
+		})
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// Notarize returns result with error if Apple rejected submission (not as error)
+func Notarize(file string, options *NotarizeOptions) (*NotarizeResult, error) {
+	credentials, err := options.credentialArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	reporter := progress.Start("notarize", file, 0)
+	result, err := notarize(file, options, credentials)
+	reporter.Finish(err)
+	return result, err
+}
+
+func notarize(file string, options *NotarizeOptions, credentials []string) (*NotarizeResult, error) {
+	// app bundle must be zipped (ditto preserves extended attributes and symlinks)
+	submitFile := file
+	if strings.HasSuffix(file, ".app") {
+		tempDir, err := util.TempDir("", ".notarize")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer removeTempDir(tempDir)
+
+		submitFile = filepath.Join(tempDir, strings.TrimSuffix(filepath.Base(file), ".app")+".zip")
+		_, err = util.Execute(exec.Command("ditto", "-c", "-k", "--sequesterRsrc", "--keepParent", file, submitFile), "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithField("file", file).Info("submitting to Apple notary service")
+	password := options.passwordToPrompt()
+	output, err := runNotarytool(append([]string{"submit", submitFile, "--wait", "--output-format", "json"}, credentials...), password)
+	// non-zero exit code if status is not Accepted, but result is still printed
+	result := &NotarizeResult{}
+	if parseErr := json.Unmarshal(output, result); parseErr != nil || len(result.Id) == 0 {
+		if err == nil {
+			err = errors.Errorf("cannot parse notarytool output: %s", string(output))
+		}
+		return nil, err
+	}
+
+	if result.Status != "Accepted" {
+		result.Error = "notarization failed: " + result.Status
+		result.ErrorCode = "ERR_NOTARIZATION_FAILED"
+		result.Issues, result.Message = fetchNotarizeIssues(result.Id, credentials, password, result.Message)
+		return result, nil
+	}
+
+	if options.IsStaple {
+		_, err = util.Execute(exec.Command("xcrun", "stapler", "staple", file), "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot staple %s", file)
+		}
+		result.IsStapled = true
+	}
+	return result, nil
+}
+
+// log is only for diagnostic, so, error is logged and message from submit is used
+func fetchNotarizeIssues(id string, credentials []string, password string, message string) ([]NotarizeIssue, string) {
+	output, err := runNotarytool(append([]string{"log", id, "--output-format", "json"}, credentials...), password)
+	if err != nil {
+		log.WithError(err).Warn("cannot get notarization log")
+		return nil, message
+	}
+
+	var notaryLog notarytoolLog
+	err = json.Unmarshal(output, &notaryLog)
+	if err != nil {
+		log.WithError(err).Warn("cannot parse notarization log")
+		return nil, message
+	}
+
+	if len(notaryLog.StatusSummary) != 0 {
+		message = notaryLog.StatusSummary
+	}
+	return notaryLog.Issues, message
+}
+
+func (t *NotarizeOptions) credentialArgs() ([]string, error) {
+	var result []string
+	switch {
+	case len(t.KeychainProfile) != 0:
+		result = []string{"--keychain-profile", t.KeychainProfile}
+		if len(t.Keychain) != 0 {
+			result = append(result, "--keychain", t.Keychain)
+		}
+	case len(t.ApiKey) != 0:
+		if len(t.ApiKeyId) == 0 || len(t.ApiKeyIssuer) == 0 {
+			return nil, errors.New("API key ID and issuer must be specified for API key")
+		}
+		result = []string{"--key", t.ApiKey, "--key-id", t.ApiKeyId, "--issuer", t.ApiKeyIssuer}
+	case len(t.AppleId) != 0:
+		if len(t.Password) == 0 || len(t.TeamId) == 0 {
+			return nil, errors.New("app-specific password and team ID must be specified for Apple ID")
+		}
+		// password is not passed in args (visible in the process list), notarytool prompts for it and reads stdin (see runNotarytool)
+		result = []string{"--apple-id", t.AppleId, "--team-id", t.TeamId}
+	default:
+		return nil, errors.New("Apple ID, API key or keychain profile must be specified")
+	}
+	return result, nil
+}
+
+// app-specific password is used only for Apple ID (see credentialArgs)
+func (t *NotarizeOptions) passwordToPrompt() string {
+	if len(t.KeychainProfile) != 0 || len(t.ApiKey) != 0 {
+		return ""
+	}
+	return t.Password
+}
+
+// stdout is returned even if notarytool failed
+func runNotarytool(args []string, password string) ([]byte, error) {
+	command := exec.Command("xcrun", append([]string{"notarytool"}, args...)...)
+	if len(password) != 0 {
+		command.Stdin = strings.NewReader(password + "\n")
+		// without controlling terminal password prompt reads stdin instead of terminal
+		detachFromTerminal(command)
+	}
+	var errorOutput strings.Builder
+	command.Stderr = &errorOutput
+	output, err := command.Output()
+	if err == nil {
+		return output, nil
+	}
+	return output, errors.Errorf("notarytool %s failed: %v\noutput: %s\nerror output: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)), strings.TrimSpace(errorOutput.String()))
+}
+
+func removeTempDir(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Warn("cannot remove temporary dir")
+	}
+}
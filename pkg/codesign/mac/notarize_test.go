@@ -0,0 +1,24 @@
+package mac
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNotarizeCredentialArgs(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	args, err := (&NotarizeOptions{AppleId: "foo@example.com", Password: "secret", TeamId: "TEAM"}).credentialArgs()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args).To(Equal([]string{"--apple-id", "foo@example.com", "--team-id", "TEAM"}))
+
+	_, err = (&NotarizeOptions{AppleId: "foo@example.com", TeamId: "TEAM"}).credentialArgs()
+	g.Expect(err).To(HaveOccurred())
+
+	args, err = (&NotarizeOptions{KeychainProfile: "profile", Password: "secret"}).credentialArgs()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args).To(Equal([]string{"--keychain-profile", "profile"}))
+	g.Expect((&NotarizeOptions{KeychainProfile: "profile", Password: "secret"}).passwordToPrompt()).To(BeEmpty())
+	g.Expect((&NotarizeOptions{AppleId: "foo@example.com", Password: "secret"}).passwordToPrompt()).To(Equal("secret"))
+}
@@ -0,0 +1,228 @@
+package mac
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// nested bundles, signed after their content
+var bundleExtensions = []string{".app", ".framework", ".appex", ".xpc", ".plugin", ".bundle"}
+
+var machOMagics = [][]byte{
+	{0xfe, 0xed, 0xfa, 0xce},
+	{0xfe, 0xed, 0xfa, 0xcf},
+	{0xce, 0xfa, 0xed, 0xfe},
+	{0xcf, 0xfa, 0xed, 0xfe},
+	// universal
+	{0xca, 0xfe, 0xba, 0xbe},
+}
+
+type SignOptions struct {
+	Identity string
+	Keychain string
+	// for the app itself
+	Entitlements string
+	// for nested bundles and binaries (default is Entitlements)
+	EntitlementsInherit string
+	IsHardenedRuntime   bool
+	IsTimestamp         bool
+	// copied to Contents/embedded.provisionprofile
+	ProvisioningProfile string
+}
+
+type signItem struct {
+	path  string
+	depth int
+}
+
+func ConfigureSignCommand(app *kingpin.Application) {
+	command := app.Command("sign-mac", "Deep sign macOS app bundle (nested binaries and bundles are signed inside-out).")
+	appPath := command.Flag("app", "The app bundle.").Required().String()
+	identity := command.Flag("identity", "The signing identity (name or SHA-1 hash).").Required().String()
+	keychain := command.Flag("keychain", "The keychain to search identity in.").String()
+	entitlements := command.Flag("entitlements", "The entitlements of the app.").String()
+	entitlementsInherit := command.Flag("entitlements-inherit", "The entitlements of nested code (entitlements of the app by default).").String()
+	isHardenedRuntime := command.Flag("hardened-runtime", "Enable hardened runtime (required for notarization).").Default("true").Bool()
+	isTimestamp := command.Flag("timestamp", "Request secure timestamp (required for notarization).").Default("true").Bool()
+	provisioningProfile := command.Flag("provisioning-profile", "The provisioning profile to embed.").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		return Sign(*appPath, &SignOptions{
+			Identity:            *identity,
+			Keychain:            *keychain,
+			Entitlements:        *entitlements,
+			EntitlementsInherit: *entitlementsInherit,
+			IsHardenedRuntime:   *isHardenedRuntime,
+			IsTimestamp:         *isTimestamp,
+			ProvisioningProfile: *provisioningProfile,
+		})
+	})
+}
+
+// Sign signs nested code from the deepest level (code of the same level is signed in parallel), the app itself is signed last
+func Sign(appPath string, options *SignOptions) error {
+	if len(options.ProvisioningProfile) != 0 {
+		var fileCopier fs.FileCopier
+		err := fileCopier.CopyDirOrFile(options.ProvisioningProfile, filepath.Join(appPath, "Contents", "embedded.provisionprofile"))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	items, err := collectSignItems(appPath)
+	if err != nil {
+		return err
+	}
+
+	inheritEntitlements := options.EntitlementsInherit
+	if len(inheritEntitlements) == 0 {
+		inheritEntitlements = options.Entitlements
+	}
+
+	reporter := progress.Start("sign", appPath, int64(len(items)+1))
+	err = signLevels(items, options, inheritEntitlements, reporter)
+	if err == nil {
+		err = runCodesign(appPath, options, options.Entitlements)
+		reporter.Add(1)
+	}
+	reporter.Finish(err)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"app": appPath, "nested": len(items)}).Info("signed")
+	return nil
+}
+
+func signLevels(items []signItem, options *SignOptions, entitlements string, reporter *progress.Reporter) error {
+	for start := 0; start < len(items); {
+		end := start
+		for end < len(items) && items[end].depth == items[start].depth {
+			end++
+		}
+
+		level := items[start:end]
+		err := progress.MapAsync(reporter, len(level), func(taskIndex int) (func() error, error) {
+			item := level[taskIndex]
+			return func() error {
+				return runCodesign(item.path, options, entitlements)
+			}, nil
+		})
+		if err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// sorted by depth (the deepest first), symlinks are not followed
+func collectSignItems(appPath string) ([]signItem, error) {
+	var result []signItem
+	err := filepath.Walk(appPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == appPath {
+			return err
+		}
+
+		if info.IsDir() {
+			if isBundle(path) {
+				result = append(result, signItem{path: path})
+			}
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		isMachO, err := isMachOFile(path)
+		if err != nil {
+			return err
+		}
+		if isMachO {
+			result = append(result, signItem{path: path})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for index := range result {
+		relativePath, err := filepath.Rel(appPath, result[index].path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		result[index].depth = strings.Count(filepath.ToSlash(relativePath), "/") + 1
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].depth > result[j].depth
+	})
+	return result, nil
+}
+
+func isBundle(path string) bool {
+	extension := filepath.Ext(path)
+	for _, bundleExtension := range bundleExtensions {
+		if extension == bundleExtension {
+			return true
+		}
+	}
+	return false
+}
+
+func isMachOFile(file string) (bool, error) {
+	header, err := fs.ReadFile(file, 4)
+	if err != nil {
+		if errors.Cause(err) == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, magic := range machOMagics {
+		if bytes.Equal(header, magic) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func createCodesignArgs(path string, options *SignOptions, entitlements string) []string {
+	args := []string{"--sign", options.Identity, "--force"}
+	if len(options.Keychain) != 0 {
+		args = append(args, "--keychain", options.Keychain)
+	}
+	if options.IsHardenedRuntime {
+		args = append(args, "--options", "runtime")
+	}
+	if options.IsTimestamp {
+		args = append(args, "--timestamp")
+	}
+	if len(entitlements) != 0 {
+		args = append(args, "--entitlements", entitlements)
+	}
+	return append(args, path)
+}
+
+func runCodesign(path string, options *SignOptions, entitlements string) error {
+	_, err := util.Execute(exec.Command("codesign", createCodesignArgs(path, options, entitlements)...), "")
+	if err != nil {
+		return errors.Wrapf(err, "cannot sign %s", path)
+	}
+	log.WithField("path", path).Debug("signed")
+	return nil
+}
@@ -0,0 +1,66 @@
+package mac
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCollectSignItemsInsideOut(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "sign")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appPath := filepath.Join(tmpDir, "Test.app")
+	machO := []byte{0xcf, 0xfa, 0xed, 0xfe, 0, 0, 0, 0}
+	files := map[string][]byte{
+		"Contents/MacOS/Test": machO,
+		"Contents/Info.plist": []byte("<plist/>"),
+		"Contents/Frameworks/Helper.app/Contents/MacOS/Helper":                machO,
+		"Contents/Frameworks/Lib.framework/Versions/A/Lib":                    machO,
+		"Contents/Resources/app.asar.unpacked/node_modules/native/addon.node": machO,
+		"Contents/Resources/empty":                                            nil,
+	}
+	for name, data := range files {
+		file := filepath.Join(appPath, filepath.FromSlash(name))
+		g.Expect(os.MkdirAll(filepath.Dir(file), 0755)).NotTo(HaveOccurred())
+		g.Expect(ioutil.WriteFile(file, data, 0755)).NotTo(HaveOccurred())
+	}
+	g.Expect(os.Symlink("A", filepath.Join(appPath, "Contents", "Frameworks", "Lib.framework", "Versions", "Current"))).NotTo(HaveOccurred())
+
+	items, err := collectSignItems(appPath)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var paths []string
+	for _, item := range items {
+		relativePath, err := filepath.Rel(appPath, item.path)
+		g.Expect(err).NotTo(HaveOccurred())
+		paths = append(paths, filepath.ToSlash(relativePath))
+	}
+	g.Expect(paths).To(Equal([]string{
+		"Contents/Frameworks/Helper.app/Contents/MacOS/Helper",
+		"Contents/Frameworks/Lib.framework/Versions/A/Lib",
+		"Contents/Resources/app.asar.unpacked/node_modules/native/addon.node",
+		"Contents/Frameworks/Helper.app",
+		"Contents/Frameworks/Lib.framework",
+		"Contents/MacOS/Test",
+	}))
+}
+
+func TestNotarizeCredentials(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	args, err := (&NotarizeOptions{ApiKey: "key.p8", ApiKeyId: "id", ApiKeyIssuer: "issuer"}).credentialArgs()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args).To(Equal([]string{"--key", "key.p8", "--key-id", "id", "--issuer", "issuer"}))
+
+	_, err = (&NotarizeOptions{AppleId: "user@example.com"}).credentialArgs()
+	g.Expect(err).To(HaveOccurred())
+	_, err = (&NotarizeOptions{}).credentialArgs()
+	g.Expect(err).To(HaveOccurred())
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/credentials"
 	"github.com/develar/app-builder/pkg/download"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
@@ -25,9 +26,10 @@ import (
 func ConfigureCertificateInfoCommand(app *kingpin.Application) {
 	command := app.Command("certificate-info", "Read information about code signing certificate")
 	inFile := command.Flag("input", "input file").Short('i').Required().String()
-	password := command.Flag("password", "password").Short('p').String()
+	password := command.Flag("password", "password (default: CSC_KEY_PASSWORD from the credential store or env)").Short('p').String()
 
 	command.Action(func(context *kingpin.ParseContext) error {
+		credentials.Fill(password, "CSC_KEY_PASSWORD")
 		return readInfo(*inFile, *password)
 	})
 }
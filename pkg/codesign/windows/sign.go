@@ -0,0 +1,324 @@
+package windows
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/credentials"
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+const defaultTimestampServer = "http://timestamp.digicert.com"
+
+// SignOptions of signing PE files (exe, dll, node). Certificate is either a PKCS #12 file or (signtool only) a certificate from the store.
+type SignOptions struct {
+	CertificateFile     string
+	CertificatePassword string
+	// signtool only, certificate from the store by subject name or SHA-1 thumbprint
+	CertificateSubjectName string
+	CertificateSha1        string
+
+	// sha1 and sha256 for dual signing (default), sha1 signature is the primary one, sha256 is appended (nested)
+	Hashes []string
+	// tried in order on failure, sha1 is timestamped using Authenticode protocol, sha256 using RFC 3161
+	TimestampServers []string
+	// number of attempts if timestamp server cannot be reached (delay is doubled after each attempt)
+	Retries      int
+	InitialDelay time.Duration
+
+	// description shown in UAC dialog
+	Name string
+	Url  string
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("sign-windows", "Sign PE files using signtool (on Windows) or osslsigncode.")
+	files := command.Flag("input", "The file to sign (can be specified several times, files are signed in parallel).").Short('i').Required().Strings()
+	certificateFile := command.Flag("certificate-file", "The PKCS #12 certificate file.").String()
+	certificatePassword := command.Flag("certificate-password", "The certificate password (default: WIN_CSC_KEY_PASSWORD from the credential store or env).").String()
+	subjectName := command.Flag("subject-name", "The subject name of certificate from the store (signtool only).").String()
+	certificateSha1 := command.Flag("certificate-sha1", "The SHA-1 thumbprint of certificate from the store (signtool only).").String()
+	hashes := command.Flag("hash", "The signature hash algorithm (sha1 and sha256 by default, dual signing).").Enums("sha1", "sha256")
+	timestampServers := command.Flag("timestamp-server", "The timestamp server (can be specified several times, tried in order on failure).").Strings()
+	retries := command.Flag("retries", "The number of attempts if timestamp server cannot be reached.").Default("3").Int()
+	name := command.Flag("name", "The description of signed content.").String()
+	url := command.Flag("url", "The URL of signed content description.").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		credentials.Fill(certificatePassword, "WIN_CSC_KEY_PASSWORD")
+		return Sign(*files, &SignOptions{
+			CertificateFile:        *certificateFile,
+			CertificatePassword:    *certificatePassword,
+			CertificateSubjectName: *subjectName,
+			CertificateSha1:        *certificateSha1,
+			Hashes:                 *hashes,
+			TimestampServers:       *timestampServers,
+			Retries:                *retries,
+			Name:                   *name,
+			Url:                    *url,
+		})
+	})
+}
+
+// Sign signs files in parallel (in place)
+func Sign(files []string, options *SignOptions) error {
+	err := options.normalize()
+	if err != nil {
+		return err
+	}
+
+	tool, err := resolveSignTool(options)
+	if err != nil {
+		return err
+	}
+
+	reporter := progress.Start("sign", "", int64(len(files)))
+	err = progress.MapAsync(reporter, len(files), func(taskIndex int) (func() error, error) {
+		file := files[taskIndex]
+		return func() error {
+			for index, hash := range options.Hashes {
+				err := signWithRetry(tool, file, hash, index > 0, options)
+				if err != nil {
+					return err
+				}
+			}
+			log.WithField("file", file).Info("signed")
+			return nil
+		}, nil
+	})
+	reporter.Finish(err)
+	return err
+}
+
+func (t *SignOptions) normalize() error {
+	if len(t.CertificateFile) == 0 && len(t.CertificateSubjectName) == 0 && len(t.CertificateSha1) == 0 {
+		return errors.New("certificate file, subject name or SHA-1 thumbprint must be specified")
+	}
+	if len(t.Hashes) == 0 {
+		t.Hashes = []string{"sha1", "sha256"}
+	}
+	for _, hash := range t.Hashes {
+		if hash != "sha1" && hash != "sha256" {
+			return errors.Errorf("unsupported signature hash algorithm %q", hash)
+		}
+	}
+	if len(t.TimestampServers) == 0 {
+		t.TimestampServers = []string{defaultTimestampServer}
+	}
+	if t.Retries <= 0 {
+		t.Retries = 1
+	}
+	if t.InitialDelay <= 0 {
+		t.InitialDelay = time.Second
+	}
+	return nil
+}
+
+// timestamp server is rotated on each attempt, other errors are not retried
+func signWithRetry(tool *signTool, file string, hash string, isNested bool, options *SignOptions) error {
+	policy := util.RetryPolicy{
+		MaxAttempts:  options.Retries,
+		InitialDelay: options.InitialDelay,
+		Multiplier:   2,
+		Jitter:       0.2,
+		IsRetryable:  isTimestampError,
+	}
+	getTimestampServer := func(attempt int) string {
+		return options.TimestampServers[(attempt-1)%len(options.TimestampServers)]
+	}
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		log.WithFields(log.Fields{
+			"file":            file,
+			"hash":            hash,
+			"timestampServer": getTimestampServer(attempt),
+			"attempt":         attempt,
+			"delay":           delay,
+		}).Warn("cannot timestamp signature, retrying")
+	}
+	return util.Retry(util.RootContext(), policy, func(attempt int) error {
+		return tool.sign(file, hash, isNested, getTimestampServer(attempt), options)
+	})
+}
+
+// only output is checked, args contain timestamp server URL
+func isTimestampError(err error) bool {
+	toolError, ok := errors.Cause(err).(*signToolError)
+	if !ok {
+		return false
+	}
+	output := strings.ToLower(toolError.output)
+	return strings.Contains(output, "timestamp") || strings.Contains(output, "tsa")
+}
+
+type signTool struct {
+	path       string
+	isSigntool bool
+}
+
+type signToolError struct {
+	tool   string
+	args   []string
+	output string
+	cause  error
+}
+
+func (t *signToolError) Error() string {
+	return fmt.Sprintf("%s failed: %v\nargs: %s\noutput: %s", t.tool, t.cause, strings.Join(t.args, " "), t.output)
+}
+
+// SIGNTOOL_PATH or OSSLSIGNCODE_PATH env to use custom tool, otherwise signtool from winCodeSign on Windows and osslsigncode (installed or from winCodeSign) on other OS
+func resolveSignTool(options *SignOptions) (*signTool, error) {
+	if util.GetCurrentOs() == util.WINDOWS {
+		path := os.Getenv("SIGNTOOL_PATH")
+		if len(path) == 0 {
+			vendor, err := download.DownloadWinCodeSign()
+			if err != nil {
+				return nil, err
+			}
+
+			arch := "ia32"
+			if runtime.GOARCH == "amd64" {
+				arch = "x64"
+			}
+			path = filepath.Join(vendor, "windows-10", arch, "signtool.exe")
+		}
+		return &signTool{path: path, isSigntool: true}, nil
+	}
+
+	if len(options.CertificateFile) == 0 {
+		return nil, errors.New("certificate from the store can be used only on Windows, specify certificate file")
+	}
+
+	path := os.Getenv("OSSLSIGNCODE_PATH")
+	if len(path) == 0 {
+		installedPath, err := exec.LookPath("osslsigncode")
+		if err == nil {
+			path = installedPath
+		} else {
+			vendor, err := download.DownloadWinCodeSign()
+			if err != nil {
+				return nil, err
+			}
+
+			if util.GetCurrentOs() == util.MAC {
+				path = filepath.Join(vendor, "darwin", "10.12", "osslsigncode")
+			} else {
+				path = filepath.Join(vendor, "linux", "osslsigncode")
+			}
+		}
+	}
+	return &signTool{path: path}, nil
+}
+
+func (t *signTool) sign(file string, hash string, isNested bool, timestampServer string, options *SignOptions) error {
+	if t.isSigntool {
+		return t.run(t.createSigntoolArgs(file, hash, isNested, timestampServer, options), options)
+	}
+
+	// osslsigncode cannot sign in place
+	outFile := file + ".signed"
+	err := t.run(t.createOsslsigncodeArgs(file, outFile, hash, isNested, timestampServer, options), options)
+	if err != nil {
+		removeFile(outFile)
+		return err
+	}
+	return fs.RenameWithRetry(outFile, file)
+}
+
+func (t *signTool) createSigntoolArgs(file string, hash string, isNested bool, timestampServer string, options *SignOptions) []string {
+	args := []string{"sign"}
+	switch {
+	case len(options.CertificateFile) != 0:
+		args = append(args, "/f", options.CertificateFile)
+		// signtool cannot read password from env or stdin
+		if len(options.CertificatePassword) != 0 {
+			args = append(args, "/p", options.CertificatePassword)
+		}
+	case len(options.CertificateSha1) != 0:
+		args = append(args, "/sha1", options.CertificateSha1)
+	default:
+		args = append(args, "/n", options.CertificateSubjectName)
+	}
+
+	args = append(args, "/fd", hash)
+	if hash == "sha1" {
+		args = append(args, "/t", timestampServer)
+	} else {
+		args = append(args, "/tr", timestampServer, "/td", hash)
+	}
+	if isNested {
+		args = append(args, "/as")
+	}
+	if len(options.Name) != 0 {
+		args = append(args, "/d", options.Name)
+	}
+	if len(options.Url) != 0 {
+		args = append(args, "/du", options.Url)
+	}
+	return append(args, file)
+}
+
+func (t *signTool) createOsslsigncodeArgs(file string, outFile string, hash string, isNested bool, timestampServer string, options *SignOptions) []string {
+	args := []string{"sign", "-pkcs12", options.CertificateFile}
+	// password is written to stdin, so, it is not visible in the process list
+	if len(options.CertificatePassword) != 0 {
+		args = append(args, "-readpass", "/dev/stdin")
+	}
+
+	args = append(args, "-h", hash)
+	if hash == "sha1" {
+		args = append(args, "-t", timestampServer)
+	} else {
+		args = append(args, "-ts", timestampServer)
+	}
+	if isNested {
+		args = append(args, "-nest")
+	}
+	if len(options.Name) != 0 {
+		args = append(args, "-n", options.Name)
+	}
+	if len(options.Url) != 0 {
+		args = append(args, "-i", options.Url)
+	}
+	return append(args, "-in", file, "-out", outFile)
+}
+
+// password is not included in the error (util.Execute reports args)
+func (t *signTool) run(args []string, options *SignOptions) error {
+	password := options.CertificatePassword
+	command := exec.Command(t.path, args...)
+	if !t.isSigntool && len(password) != 0 {
+		command.Stdin = strings.NewReader(password)
+	}
+	output, err := command.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+
+	safeArgs := make([]string, len(args))
+	for index, arg := range args {
+		if len(password) != 0 && arg == password {
+			arg = "<hidden>"
+		}
+		safeArgs[index] = arg
+	}
+	return errors.WithStack(&signToolError{tool: filepath.Base(t.path), args: safeArgs, output: strings.TrimSpace(string(output)), cause: err})
+}
+
+func removeFile(file string) {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("file", file).Warn("cannot remove file")
+	}
+}
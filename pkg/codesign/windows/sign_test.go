@@ -0,0 +1,75 @@
+package windows
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// fake osslsigncode fails to timestamp on the first call, then appends hash and nested flag to the copy of input,
+// password must be read from stdin
+const fakeOsslsigncode = `#!/bin/sh
+if [ ! -f "$FAKE_STATE" ]; then
+  touch "$FAKE_STATE"
+  echo "Failed to get timestamp"
+  exit 1
+fi
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -in) in="$2"; shift ;;
+    -out) out="$2"; shift ;;
+    -h) hash="$2"; shift ;;
+    -nest) nest=" nested" ;;
+    -pass) echo "password in args"; exit 1 ;;
+    -readpass) pass=$(cat "$2"); shift ;;
+  esac
+  shift
+done
+if [ "$pass" != "secret" ]; then
+  echo "wrong password"
+  exit 1
+fi
+cp "$in" "$out"
+echo "$hash$nest" >> "$out"
+`
+
+func TestSignUsingOsslsigncode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signtool is used on Windows")
+	}
+
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "sign")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	toolFile := filepath.Join(tmpDir, "osslsigncode")
+	g.Expect(ioutil.WriteFile(toolFile, []byte(fakeOsslsigncode), 0755)).NotTo(HaveOccurred())
+	g.Expect(os.Setenv("OSSLSIGNCODE_PATH", toolFile)).NotTo(HaveOccurred())
+	defer os.Unsetenv("OSSLSIGNCODE_PATH")
+	g.Expect(os.Setenv("FAKE_STATE", filepath.Join(tmpDir, "state"))).NotTo(HaveOccurred())
+	defer os.Unsetenv("FAKE_STATE")
+
+	file := filepath.Join(tmpDir, "app.exe")
+	g.Expect(ioutil.WriteFile(file, []byte("MZ\n"), 0644)).NotTo(HaveOccurred())
+
+	options := &SignOptions{CertificateFile: "cert.p12", CertificatePassword: "secret", Retries: 2, InitialDelay: time.Millisecond}
+	g.Expect(Sign([]string{file}, options)).NotTo(HaveOccurred())
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("MZ\nsha1\nsha256 nested\n"))
+	g.Expect(file + ".signed").NotTo(BeAnExistingFile())
+
+	// single attempt, password is not passed in args
+	g.Expect(os.Remove(filepath.Join(tmpDir, "state"))).NotTo(HaveOccurred())
+	err = Sign([]string{filepath.Join(tmpDir, "missing.exe")}, &SignOptions{CertificateFile: "cert.p12", CertificatePassword: "secret", Retries: 1})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).NotTo(ContainSubstring("secret"))
+	g.Expect(err.Error()).To(ContainSubstring("-readpass /dev/stdin"))
+}
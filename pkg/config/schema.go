@@ -0,0 +1,510 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/develar/errors"
+)
+
+// subset of JSON Schema used by the configuration schema:
+// type, enum, properties, required, additionalProperties, unevaluatedProperties (only properties of allOf and $ref are evaluated),
+// items, anyOf, oneOf, allOf, $ref (#/definitions/ only), minimum, maximum and pattern
+//
+//go:embed schema.json
+var embeddedSchema []byte
+
+var (
+	rootSchema          *Schema
+	rootSchemaError     error
+	rootSchemaParseOnce sync.Once
+)
+
+type Schema struct {
+	Ref         string             `json:"$ref"`
+	Type        schemaTypes        `json:"type"`
+	Enum        []interface{}      `json:"enum"`
+	Properties  map[string]*Schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Items       *Schema            `json:"items"`
+	AnyOf       []*Schema          `json:"anyOf"`
+	OneOf       []*Schema          `json:"oneOf"`
+	AllOf       []*Schema          `json:"allOf"`
+	Minimum     *float64           `json:"minimum"`
+	Maximum     *float64           `json:"maximum"`
+	Pattern     string             `json:"pattern"`
+	Definitions map[string]*Schema `json:"definitions"`
+
+	AdditionalProperties  *additionalProperties `json:"additionalProperties"`
+	UnevaluatedProperties *bool                 `json:"unevaluatedProperties"`
+
+	pattern *regexp.Regexp
+}
+
+// string or array of strings
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*t = []string{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// boolean or schema
+type additionalProperties struct {
+	isAllowed bool
+	schema    *Schema
+}
+
+func (t *additionalProperties) UnmarshalJSON(data []byte) error {
+	if json.Unmarshal(data, &t.isAllowed) == nil {
+		return nil
+	}
+	t.isAllowed = true
+	return json.Unmarshal(data, &t.schema)
+}
+
+type ValidationError struct {
+	// e.g. mac.target[0].arch, empty for the root
+	Path       string `json:"path"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+func (t ValidationError) String() string {
+	path := t.Path
+	if len(path) == 0 {
+		path = "configuration"
+	}
+	result := path + ": " + t.Message
+	if len(t.Suggestion) != 0 {
+		result += " (" + t.Suggestion + ")"
+	}
+	return result
+}
+
+func GetSchema() (*Schema, error) {
+	rootSchemaParseOnce.Do(func() {
+		rootSchema, rootSchemaError = ParseSchema(embeddedSchema)
+	})
+	return rootSchema, rootSchemaError
+}
+
+func ParseSchema(data []byte) (*Schema, error) {
+	var schema Schema
+	err := json.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse schema")
+	}
+
+	validator := &schemaValidator{root: &schema}
+	err = validator.prepare(&schema)
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// Validate checks value decoded from JSON (or converted to JSON types) against schema, errors are sorted by path
+func (t *Schema) Validate(value interface{}) []ValidationError {
+	validator := &schemaValidator{root: t}
+	errorList, _ := validator.validate(t, value, "")
+	sort.SliceStable(errorList, func(i, j int) bool {
+		return errorList[i].Path < errorList[j].Path
+	})
+	return errorList
+}
+
+type schemaValidator struct {
+	root *Schema
+}
+
+// compiles patterns and checks that references are resolvable
+func (t *schemaValidator) prepare(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+
+	if len(schema.Ref) != 0 {
+		_, err := t.resolve(schema.Ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(schema.Pattern) != 0 {
+		var err error
+		schema.pattern, err = regexp.Compile(schema.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "invalid pattern %q", schema.Pattern)
+		}
+	}
+
+	children := []*Schema{schema.Items}
+	children = append(children, schema.AnyOf...)
+	children = append(children, schema.OneOf...)
+	children = append(children, schema.AllOf...)
+	if schema.AdditionalProperties != nil {
+		children = append(children, schema.AdditionalProperties.schema)
+	}
+	for _, child := range schema.Properties {
+		children = append(children, child)
+	}
+	for _, child := range schema.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		err := t.prepare(child)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *schemaValidator) resolve(ref string) (*Schema, error) {
+	const prefix = "#/definitions/"
+	if !strings.HasPrefix(ref, prefix) {
+		return nil, errors.Errorf("unsupported schema reference %q", ref)
+	}
+	result := t.root.Definitions[strings.TrimPrefix(ref, prefix)]
+	if result == nil {
+		return nil, errors.Errorf("schema reference %q is not resolved", ref)
+	}
+	return result, nil
+}
+
+// returns errors and names of evaluated properties (for unevaluatedProperties of the parent schema)
+func (t *schemaValidator) validate(schema *Schema, value interface{}, path string) ([]ValidationError, map[string]bool) {
+	if len(schema.Ref) != 0 {
+		// references are checked by prepare
+		resolved, _ := t.resolve(schema.Ref)
+		return t.validate(resolved, value, path)
+	}
+
+	if len(schema.Type) != 0 && !matchesType(schema.Type, value) {
+		return []ValidationError{{Path: path, Message: fmt.Sprintf("must be %s, got %s", strings.Join(schema.Type, " or "), typeOf(value))}}, nil
+	}
+
+	var result []ValidationError
+	if len(schema.Enum) != 0 && !containsValue(schema.Enum, value) {
+		result = append(result, ValidationError{Path: path, Message: "must be one of " + formatEnum(schema.Enum), Suggestion: suggestEnum(schema.Enum, value)})
+	}
+
+	evaluated := make(map[string]bool)
+	switch v := value.(type) {
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			result = append(result, ValidationError{Path: path, Message: fmt.Sprintf("must be >= %v", *schema.Minimum)})
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			result = append(result, ValidationError{Path: path, Message: fmt.Sprintf("must be <= %v", *schema.Maximum)})
+		}
+
+	case string:
+		if schema.pattern != nil && !schema.pattern.MatchString(v) {
+			result = append(result, ValidationError{Path: path, Message: fmt.Sprintf("must match pattern %s", schema.Pattern)})
+		}
+
+	case []interface{}:
+		if schema.Items != nil {
+			for index, item := range v {
+				itemErrors, _ := t.validate(schema.Items, item, path+"["+strconv.Itoa(index)+"]")
+				result = append(result, itemErrors...)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				result = append(result, ValidationError{Path: path, Message: fmt.Sprintf("required property %q is missing", name)})
+			}
+		}
+
+		for _, name := range sortedKeys(v) {
+			propertySchema := schema.Properties[name]
+			if propertySchema != nil {
+				evaluated[name] = true
+				propertyErrors, _ := t.validate(propertySchema, v[name], joinPath(path, name))
+				result = append(result, propertyErrors...)
+			} else if schema.AdditionalProperties != nil && schema.AdditionalProperties.schema != nil {
+				evaluated[name] = true
+				propertyErrors, _ := t.validate(schema.AdditionalProperties.schema, v[name], joinPath(path, name))
+				result = append(result, propertyErrors...)
+			}
+		}
+	}
+
+	for _, subSchema := range schema.AllOf {
+		subErrors, subEvaluated := t.validate(subSchema, value, path)
+		result = append(result, subErrors...)
+		for name := range subEvaluated {
+			evaluated[name] = true
+		}
+	}
+
+	if len(schema.AnyOf) != 0 {
+		subErrors, subEvaluated := t.validateAlternatives(schema.AnyOf, value, path, false)
+		result = append(result, subErrors...)
+		for name := range subEvaluated {
+			evaluated[name] = true
+		}
+	}
+	if len(schema.OneOf) != 0 {
+		subErrors, subEvaluated := t.validateAlternatives(schema.OneOf, value, path, true)
+		result = append(result, subErrors...)
+		for name := range subEvaluated {
+			evaluated[name] = true
+		}
+	}
+
+	if object, ok := value.(map[string]interface{}); ok {
+		isAdditionalForbidden := schema.AdditionalProperties != nil && !schema.AdditionalProperties.isAllowed
+		isUnevaluatedForbidden := schema.UnevaluatedProperties != nil && !*schema.UnevaluatedProperties
+		if isAdditionalForbidden || isUnevaluatedForbidden {
+			for _, name := range sortedKeys(object) {
+				if isAdditionalForbidden && schema.Properties[name] == nil || isUnevaluatedForbidden && !evaluated[name] {
+					result = append(result, ValidationError{Path: joinPath(path, name), Message: "unknown property", Suggestion: t.suggestProperty(name, t.knownProperties(schema))})
+				}
+			}
+		}
+	}
+	return result, evaluated
+}
+
+// if no alternative matches, errors of the most suitable one (type matches, the least number of errors) are reported
+func (t *schemaValidator) validateAlternatives(alternatives []*Schema, value interface{}, path string, isOnlyOne bool) ([]ValidationError, map[string]bool) {
+	var bestErrors []ValidationError
+	var matched []map[string]bool
+	var expectedTypes []string
+	for _, alternative := range alternatives {
+		alternativeErrors, evaluated := t.validate(alternative, value, path)
+		if len(alternativeErrors) == 0 {
+			matched = append(matched, evaluated)
+			continue
+		}
+
+		types := t.typesOf(alternative)
+		if len(types) != 0 && !matchesType(types, value) {
+			expectedTypes = append(expectedTypes, types...)
+			continue
+		}
+		if bestErrors == nil || len(alternativeErrors) < len(bestErrors) {
+			bestErrors = alternativeErrors
+		}
+	}
+
+	switch {
+	case len(matched) == 1 || (len(matched) > 1 && !isOnlyOne):
+		return nil, matched[0]
+	case len(matched) > 1:
+		return []ValidationError{{Path: path, Message: "must match exactly one schema, but matches several"}}, nil
+	case bestErrors != nil:
+		return bestErrors, nil
+	default:
+		return []ValidationError{{Path: path, Message: fmt.Sprintf("must be %s, got %s", strings.Join(uniqueStrings(expectedTypes), " or "), typeOf(value))}}, nil
+	}
+}
+
+// type of schema (types of alternatives if not specified), empty if any type is allowed
+func (t *schemaValidator) typesOf(schema *Schema) []string {
+	if len(schema.Ref) != 0 {
+		resolved, _ := t.resolve(schema.Ref)
+		return t.typesOf(resolved)
+	}
+	if len(schema.Type) != 0 {
+		return schema.Type
+	}
+
+	var result []string
+	for _, alternative := range append(append([]*Schema{}, schema.AnyOf...), schema.OneOf...) {
+		types := t.typesOf(alternative)
+		if len(types) == 0 {
+			return nil
+		}
+		result = append(result, types...)
+	}
+	return result
+}
+
+func (t *schemaValidator) knownProperties(schema *Schema) []string {
+	var result []string
+	for name := range schema.Properties {
+		result = append(result, name)
+	}
+	for _, subSchema := range schema.AllOf {
+		if len(subSchema.Ref) != 0 {
+			subSchema, _ = t.resolve(subSchema.Ref)
+		}
+		result = append(result, t.knownProperties(subSchema)...)
+	}
+	return result
+}
+
+func (t *schemaValidator) suggestProperty(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/3 + 1
+	if bestDistance < 2 {
+		bestDistance = 2
+	}
+	for _, candidate := range candidates {
+		if strings.EqualFold(candidate, name) {
+			return fmt.Sprintf("did you mean %q?", candidate)
+		}
+		distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate))
+		if distance <= bestDistance && (len(best) == 0 || distance < bestDistance || candidate < best) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+	if len(best) != 0 {
+		return fmt.Sprintf("did you mean %q?", best)
+	}
+	if t.root.Properties[name] != nil {
+		return fmt.Sprintf("%q is a top-level option", name)
+	}
+	return ""
+}
+
+func suggestEnum(values []interface{}, value interface{}) string {
+	s, ok := value.(string)
+	if !ok {
+		return ""
+	}
+
+	var candidates []string
+	for _, item := range values {
+		if itemString, ok := item.(string); ok {
+			candidates = append(candidates, itemString)
+		}
+	}
+	return (&schemaValidator{root: &Schema{}}).suggestProperty(s, candidates)
+}
+
+func matchesType(types []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, item := range values {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatEnum(values []interface{}) string {
+	var result []string
+	for _, item := range values {
+		data, _ := json.Marshal(item)
+		result = append(result, string(data))
+	}
+	return strings.Join(result, ", ")
+}
+
+// name is quoted if it is not an identifier
+func joinPath(path string, name string) string {
+	isIdentifier := len(name) != 0
+	for index, c := range name {
+		if !(c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (index > 0 && c >= '0' && c <= '9')) {
+			isIdentifier = false
+			break
+		}
+	}
+
+	if !isIdentifier {
+		return path + "[" + strconv.Quote(name) + "]"
+	}
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	result := make([]string, 0, len(object))
+	for key := range object {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func uniqueStrings(list []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, item := range list {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func validateTestConfig(g *GomegaWithT, data string) []ValidationError {
+	var value interface{}
+	g.Expect(json.Unmarshal([]byte(data), &value)).To(Succeed())
+	schema, err := GetSchema()
+	g.Expect(err).NotTo(HaveOccurred())
+	return schema.Validate(value)
+}
+
+func TestValidateValidConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(validateTestConfig(g, `{
+		"appId": "com.example.app",
+		"extends": null,
+		"files": ["dist/**/*", {"from": "build", "filter": "*.js"}],
+		"asar": {"smartUnpack": true},
+		"publish": {"provider": "github", "owner": "example"},
+		"mac": {"target": [{"target": "dmg", "arch": ["x64", "arm64"]}], "hardenedRuntime": true, "icon": "build/icon.icns"},
+		"win": {"target": "nsis", "publisherName": ["Example"]},
+		"nsis": {"oneClick": false, "createDesktopShortcut": "always"},
+		"dmg": {"window": {"width": 540, "height": 380}, "contents": [{"x": 130, "y": 220}]},
+		"extraMetadata": {"main": "index.js"}
+	}`)).To(BeEmpty())
+}
+
+func TestValidateInvalidConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	errorList := validateTestConfig(g, `{
+		"productname": "Test",
+		"compression": "ultra",
+		"mac": {"target": [{"target": "dmg", "arch": "x86"}], "hardendRuntime": true, "nsis": {}},
+		"win": {"target": 1},
+		"dmg": {"contents": [{"x": 1}], "iconSize": -1},
+		"asar": "yes"
+	}`)
+	g.Expect(errorList).To(Equal([]ValidationError{
+		{Path: "asar", Message: "must be boolean or object or null, got string"},
+		{Path: "compression", Message: `must be one of "store", "normal", "maximum", null`},
+		{Path: "dmg.contents[0]", Message: `required property "y" is missing`},
+		{Path: "dmg.iconSize", Message: "must be >= 0"},
+		{Path: "mac.hardendRuntime", Message: "unknown property", Suggestion: `did you mean "hardenedRuntime"?`},
+		{Path: "mac.nsis", Message: "unknown property", Suggestion: `"nsis" is a top-level option`},
+		{Path: "mac.target[0].arch", Message: `must be one of "x64", "ia32", "armv7l", "arm64", "universal"`, Suggestion: `did you mean "x64"?`},
+		{Path: "productname", Message: "unknown property", Suggestion: `did you mean "productName"?`},
+		{Path: "win.target", Message: "must be string or object or array or null, got integer"},
+	}))
+}
+
+func TestJoinPath(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(joinPath("", "mac")).To(Equal("mac"))
+	g.Expect(joinPath("mac", "extendInfo")).To(Equal("mac.extendInfo"))
+	g.Expect(joinPath("mac.extendInfo", "NSCamera Usage")).To(Equal(`mac.extendInfo["NSCamera Usage"]`))
+}
+
+func TestValidateFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "validate-config")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	yamlFile := filepath.Join(tmpDir, "electron-builder.yml")
+	g.Expect(ioutil.WriteFile(yamlFile, []byte("appId: com.example\ndmg:\n  iconSize: 100\n  window:\n    widht: 10\n"), 0644)).To(Succeed())
+	result, err := ValidateFile(yamlFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Errors).To(Equal([]ValidationError{{Path: "dmg.window.widht", Message: "unknown property", Suggestion: `did you mean "width"?`}}))
+
+	packageFile := filepath.Join(tmpDir, "package.json")
+	g.Expect(ioutil.WriteFile(packageFile, []byte(`{"name": "test", "build": {"appId": "com.example"}}`), 0644)).To(Succeed())
+	result, err = ValidateFile(packageFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Errors).To(BeEmpty())
+}
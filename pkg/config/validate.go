@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type ValidationResult struct {
+	File   string            `json:"file"`
+	Errors []ValidationError `json:"errors"`
+}
+
+func ConfigureValidateCommand(app *kingpin.Application) {
+	command := app.Command("validate-config", "Validate electron-builder configuration (JSON, JSON5, YAML, TOML or build field of package.json) against the embedded schema")
+	file := command.Arg("file", "configuration file").Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := ValidateFile(*file)
+		if err != nil {
+			return err
+		}
+
+		err = util.WriteJsonToStdOut(result)
+		if err != nil {
+			return err
+		}
+
+		if len(result.Errors) != 0 {
+			messages := make([]string, 0, len(result.Errors))
+			for _, validationError := range result.Errors {
+				messages = append(messages, "  "+validationError.String())
+			}
+			return util.NewMessageError(fmt.Sprintf("invalid configuration %s:\n%s", *file, strings.Join(messages, "\n")), "ERR_INVALID_CONFIGURATION")
+		}
+		return nil
+	})
+}
+
+func ValidateFile(file string) (*ValidationResult, error) {
+	value, err := readConfigValue(file)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := GetSchema()
+	if err != nil {
+		return nil, err
+	}
+	return &ValidationResult{File: file, Errors: append([]ValidationError{}, schema.Validate(value)...)}, nil
+}
+
+// configuration of package.json is the build field
+func readConfigValue(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	value, err := util.ParseConfig(data, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if filepath.Base(file) == "package.json" {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s must contain an object", file)
+		}
+		build, ok := object["build"]
+		if !ok {
+			return nil, errors.Errorf("%s doesn't contain build configuration", file)
+		}
+		value = build
+	}
+	return value, nil
+}
@@ -0,0 +1,56 @@
+package credentials
+
+import (
+	"os"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/log-cli"
+	"github.com/develar/errors"
+)
+
+// Service is the service (macOS Keychain, libsecret) or target name prefix (Windows Credential Manager) of stored secrets,
+// account is the name of environment variable (e.g. WIN_CSC_KEY_PASSWORD), so, the same name is used in both places.
+//
+// macOS: security add-generic-password -s app-builder -a GH_TOKEN -w
+// Windows: cmdkey /generic:app-builder:GH_TOKEN /user:GH_TOKEN /pass
+// Linux: secret-tool store --label=GH_TOKEN service app-builder account GH_TOKEN
+const Service = "app-builder"
+
+var ErrNotFound = errors.New("credential not found")
+
+type store interface {
+	get(account string) (string, error)
+}
+
+// platform store, replaced in tests
+var defaultStore store = platformStore{}
+
+// Get returns secret from the credential store of OS, environment variable with the account name is used as fallback
+func Get(account string) (string, error) {
+	value, err := defaultStore.get(account)
+	switch {
+	case err == nil:
+		log.WithField("account", account).Debug("credential is read from the credential store")
+		return value, nil
+	case err != ErrNotFound:
+		log.WithError(err).WithField("account", account).Warn("cannot read credential store, environment variable is used")
+	}
+
+	value = os.Getenv(account)
+	if len(value) == 0 {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Fill sets value (if not explicitly specified) to the secret of account, it is not an error if secret is not found.
+// Value is redacted in log output.
+func Fill(value *string, account string) {
+	if len(*value) == 0 {
+		secret, err := Get(account)
+		if err == nil {
+			*value = secret
+		}
+	}
+	log_cli.Redact(*value)
+}
@@ -0,0 +1,57 @@
+package credentials
+
+import (
+	"os"
+	"testing"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+type mapStore map[string]string
+
+func (t mapStore) get(account string) (string, error) {
+	if account == "BROKEN" {
+		return "", errors.New("keychain is locked")
+	}
+
+	value, ok := t[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func TestGet(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	defaultStore = mapStore{"STORED": "from-store"}
+	defer func() {
+		defaultStore = platformStore{}
+	}()
+
+	for _, name := range []string{"STORED", "ONLY_ENV", "BROKEN"} {
+		g.Expect(os.Setenv(name, "from-env")).NotTo(HaveOccurred())
+		defer os.Unsetenv(name)
+	}
+
+	g.Expect(Get("STORED")).To(Equal("from-store"))
+	g.Expect(Get("ONLY_ENV")).To(Equal("from-env"))
+	// store error is not fatal
+	g.Expect(Get("BROKEN")).To(Equal("from-env"))
+
+	_, err := Get("MISSING")
+	g.Expect(err).To(Equal(ErrNotFound))
+
+	value := "explicit"
+	Fill(&value, "STORED")
+	g.Expect(value).To(Equal("explicit"))
+
+	value = ""
+	Fill(&value, "STORED")
+	g.Expect(value).To(Equal("from-store"))
+
+	value = ""
+	Fill(&value, "MISSING")
+	g.Expect(value).To(BeEmpty())
+}
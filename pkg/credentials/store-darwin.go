@@ -0,0 +1,26 @@
+//go:build darwin
+// +build darwin
+
+package credentials
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+type platformStore struct {
+}
+
+// security exits with 44 if item is not found
+func (platformStore) get(account string) (string, error) {
+	output, err := exec.Command("security", "find-generic-password", "-s", Service, "-a", account, "-w").Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 44 {
+			return "", ErrNotFound
+		}
+		return "", errors.WithStack(err)
+	}
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
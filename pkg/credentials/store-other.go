@@ -0,0 +1,36 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package credentials
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+)
+
+type platformStore struct {
+}
+
+// libsecret (GNOME Keyring, KWallet) via secret-tool, not found secret is reported by exit code 1 without output
+func (platformStore) get(account string) (string, error) {
+	secretTool, err := exec.LookPath("secret-tool")
+	if err != nil {
+		log.Debug("secret-tool is not installed, credential store is not used")
+		return "", ErrNotFound
+	}
+
+	output, err := exec.Command(secretTool, "lookup", "service", Service, "account", account).Output()
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 && len(strings.TrimSpace(string(exitError.Stderr))) == 0 {
+			return "", ErrNotFound
+		}
+		return "", errors.WithStack(err)
+	}
+	if len(output) == 0 {
+		return "", ErrNotFound
+	}
+	return string(output), nil
+}
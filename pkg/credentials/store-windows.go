@@ -0,0 +1,81 @@
+//go:build windows
+// +build windows
+
+package credentials
+
+import (
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+
+	"github.com/develar/errors"
+)
+
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW = advapi32.NewProc("CredReadW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1
+	errorNotFound   = 1168
+)
+
+// CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+type platformStore struct {
+}
+
+// generic credential with target name app-builder:<account>
+func (platformStore) get(account string) (string, error) {
+	targetName, err := syscall.UTF16PtrFromString(Service + ":" + account)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var result *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&result)))
+	if r == 0 {
+		if errno, ok := err.(syscall.Errno); ok && errno == errorNotFound {
+			return "", ErrNotFound
+		}
+		return "", errors.WithStack(err)
+	}
+
+	defer procCredFree.Call(uintptr(unsafe.Pointer(result)))
+
+	if result.CredentialBlobSize == 0 {
+		return "", nil
+	}
+	blob := make([]byte, result.CredentialBlobSize)
+	copy(blob, (*[1 << 20]byte)(unsafe.Pointer(result.CredentialBlob))[:result.CredentialBlobSize:result.CredentialBlobSize])
+	return decodeBlob(blob), nil
+}
+
+// cmdkey and Credential Manager UI store password as UTF-16, other tools as UTF-8
+func decodeBlob(blob []byte) string {
+	if len(blob)%2 != 0 || blob[1] != 0 {
+		return string(blob)
+	}
+
+	chars := make([]uint16, len(blob)/2)
+	for index := range chars {
+		chars[index] = uint16(blob[index*2]) | uint16(blob[index*2+1])<<8
+	}
+	return string(utf16.Decode(chars))
+}
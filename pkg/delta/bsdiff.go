@@ -0,0 +1,317 @@
+package delta
+
+import (
+	"bytes"
+)
+
+// bsdiff (http://www.daemonology.net/bsdiff/) of a single chunk: new data is described as sequence of controls,
+// every control adds diff bytes to old data at the current position, then copies extra bytes and seeks in old data
+type control struct {
+	diffLength  int64
+	extraLength int64
+	seek        int64
+}
+
+type chunkPatch struct {
+	controls []control
+	diff     []byte
+	extra    []byte
+}
+
+func diffChunk(old []byte, new []byte) *chunkPatch {
+	result := &chunkPatch{diff: make([]byte, 0, len(new)/4), extra: make([]byte, 0, len(new)/4)}
+	suffixes := suffixSort(old)
+
+	oldSize := len(old)
+	newSize := len(new)
+	var scan, length, pos, lastScan, lastPos, lastOffset int
+	for scan < newSize {
+		oldScore := 0
+		scan += length
+		for scsc := scan; scan < newSize; scan++ {
+			pos, length = search(suffixes, old, new[scan:], 0, oldSize)
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastOffset < oldSize && old[scsc+lastOffset] == new[scsc] {
+					oldScore++
+				}
+			}
+
+			if (length == oldScore && length != 0) || length > oldScore+8 {
+				break
+			}
+
+			if scan+lastOffset < oldSize && old[scan+lastOffset] == new[scan] {
+				oldScore--
+			}
+		}
+
+		if length == oldScore && scan != newSize {
+			continue
+		}
+
+		// extend match forward from the last position
+		s, bestForward, lengthForward := 0, 0, 0
+		for i := 0; lastScan+i < scan && lastPos+i < oldSize; {
+			if old[lastPos+i] == new[lastScan+i] {
+				s++
+			}
+			i++
+			if s*2-i > bestForward*2-lengthForward {
+				bestForward = s
+				lengthForward = i
+			}
+		}
+
+		// extend match backward from the found position
+		lengthBackward := 0
+		if scan < newSize {
+			s, bestBackward := 0, 0
+			for i := 1; scan >= lastScan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > bestBackward*2-lengthBackward {
+					bestBackward = s
+					lengthBackward = i
+				}
+			}
+		}
+
+		if lastScan+lengthForward > scan-lengthBackward {
+			overlap := (lastScan + lengthForward) - (scan - lengthBackward)
+			s, bestSplit, lengthSplit := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastScan+lengthForward-overlap+i] == old[lastPos+lengthForward-overlap+i] {
+					s++
+				}
+				if new[scan-lengthBackward+i] == old[pos-lengthBackward+i] {
+					s--
+				}
+				if s > bestSplit {
+					bestSplit = s
+					lengthSplit = i + 1
+				}
+			}
+			lengthForward += lengthSplit - overlap
+			lengthBackward -= lengthSplit
+		}
+
+		for i := 0; i < lengthForward; i++ {
+			result.diff = append(result.diff, new[lastScan+i]-old[lastPos+i])
+		}
+		result.extra = append(result.extra, new[lastScan+lengthForward:scan-lengthBackward]...)
+		result.controls = append(result.controls, control{
+			diffLength:  int64(lengthForward),
+			extraLength: int64((scan - lengthBackward) - (lastScan + lengthForward)),
+			seek:        int64((pos - lengthBackward) - (lastPos + lengthForward)),
+		})
+
+		lastScan = scan - lengthBackward
+		lastPos = pos - lengthBackward
+		lastOffset = pos - scan
+	}
+	return result
+}
+
+func matchLength(old []byte, new []byte) int {
+	i := 0
+	for i < len(old) && i < len(new) && old[i] == new[i] {
+		i++
+	}
+	return i
+}
+
+// binary search of the longest match of new in old using suffix array
+func search(suffixes []int32, old []byte, new []byte, start int, end int) (int, int) {
+	for end-start >= 2 {
+		middle := start + (end-start)/2
+		suffix := old[suffixes[middle]:]
+		n := len(suffix)
+		if len(new) < n {
+			n = len(new)
+		}
+		if bytes.Compare(suffix[:n], new[:n]) < 0 {
+			start = middle
+		} else {
+			end = middle
+		}
+	}
+
+	startLength := matchLength(old[suffixes[start]:], new)
+	endLength := matchLength(old[suffixes[end]:], new)
+	if startLength > endLength {
+		return int(suffixes[start]), startLength
+	}
+	return int(suffixes[end]), endLength
+}
+
+// suffix array (including empty suffix) using Larsson-Sadakane qsufsort, 2 int32 per byte of data
+func suffixSort(data []byte) []int32 {
+	n := len(data)
+	suffixes := make([]int32, n+1)
+	groups := make([]int32, n+1)
+
+	var buckets [256]int32
+	for _, c := range data {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	copy(buckets[1:], buckets[:255])
+	buckets[0] = 0
+
+	for i, c := range data {
+		buckets[c]++
+		suffixes[buckets[c]] = int32(i)
+	}
+	suffixes[0] = int32(n)
+	for i, c := range data {
+		groups[i] = buckets[c]
+	}
+	groups[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			suffixes[buckets[i]] = -1
+		}
+	}
+	suffixes[0] = -1
+
+	// negative value is length of sorted group
+	for h := 1; suffixes[0] != -int32(n+1); h += h {
+		length := 0
+		i := 0
+		for i < n+1 {
+			if suffixes[i] < 0 {
+				length -= int(suffixes[i])
+				i -= int(suffixes[i])
+			} else {
+				if length != 0 {
+					suffixes[i-length] = -int32(length)
+				}
+				length = int(groups[suffixes[i]]) + 1 - i
+				splitGroup(suffixes, groups, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			suffixes[i-length] = -int32(length)
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		suffixes[groups[i]] = int32(i)
+	}
+	return suffixes
+}
+
+func splitGroup(suffixes []int32, groups []int32, start int, length int, h int) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := 1
+			x := groups[int(suffixes[k])+h]
+			for i := 1; k+i < start+length; i++ {
+				value := groups[int(suffixes[k+i])+h]
+				if value < x {
+					x = value
+					j = 0
+				}
+				if value == x {
+					suffixes[k+j], suffixes[k+i] = suffixes[k+i], suffixes[k+j]
+					j++
+				}
+			}
+			for i := 0; i < j; i++ {
+				groups[suffixes[k+i]] = int32(k + j - 1)
+			}
+			if j == 1 {
+				suffixes[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := groups[int(suffixes[start+length/2])+h]
+	lessEnd, equalEnd := 0, 0
+	for i := start; i < start+length; i++ {
+		value := groups[int(suffixes[i])+h]
+		if value < x {
+			lessEnd++
+		}
+		if value == x {
+			equalEnd++
+		}
+	}
+	lessEnd += start
+	equalEnd += lessEnd
+
+	i, j, k := start, 0, 0
+	for i < lessEnd {
+		value := groups[int(suffixes[i])+h]
+		if value < x {
+			i++
+		} else if value == x {
+			suffixes[i], suffixes[lessEnd+j] = suffixes[lessEnd+j], suffixes[i]
+			j++
+		} else {
+			suffixes[i], suffixes[equalEnd+k] = suffixes[equalEnd+k], suffixes[i]
+			k++
+		}
+	}
+	for lessEnd+j < equalEnd {
+		if groups[int(suffixes[lessEnd+j])+h] == x {
+			j++
+		} else {
+			suffixes[lessEnd+j], suffixes[equalEnd+k] = suffixes[equalEnd+k], suffixes[lessEnd+j]
+			k++
+		}
+	}
+
+	if lessEnd > start {
+		splitGroup(suffixes, groups, start, lessEnd-start, h)
+	}
+	for i := 0; i < equalEnd-lessEnd; i++ {
+		groups[suffixes[lessEnd+i]] = int32(equalEnd - 1)
+	}
+	if lessEnd == equalEnd-1 {
+		suffixes[lessEnd] = -1
+	}
+	if start+length > equalEnd {
+		splitGroup(suffixes, groups, equalEnd, start+length-equalEnd, h)
+	}
+}
+
+// applyChunk reconstructs new chunk of newLength from old window
+func applyChunk(old []byte, patch *chunkPatch, newLength int64) ([]byte, error) {
+	result := make([]byte, 0, newLength)
+	var oldPos, diffPos, extraPos int64
+	for _, c := range patch.controls {
+		if c.diffLength < 0 || c.extraLength < 0 ||
+			diffPos+c.diffLength > int64(len(patch.diff)) || extraPos+c.extraLength > int64(len(patch.extra)) ||
+			int64(len(result))+c.diffLength+c.extraLength > newLength {
+			return nil, errCorrupted
+		}
+
+		for i := int64(0); i < c.diffLength; i++ {
+			b := patch.diff[diffPos+i]
+			if oldPos+i >= 0 && oldPos+i < int64(len(old)) {
+				b += old[oldPos+i]
+			}
+			result = append(result, b)
+		}
+		diffPos += c.diffLength
+		oldPos += c.diffLength
+
+		result = append(result, patch.extra[extraPos:extraPos+c.extraLength]...)
+		extraPos += c.extraLength
+		oldPos += c.seek
+	}
+
+	if int64(len(result)) != newLength {
+		return nil, errCorrupted
+	}
+	return result, nil
+}
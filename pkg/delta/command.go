@@ -0,0 +1,43 @@
+package delta
+
+import (
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/util"
+)
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("delta", "Generates binary patch (chunked bsdiff) to reconstruct new file from old file, memory usage is limited by processing new file in chunks")
+	oldFile := command.Flag("old", "old file").Required().String()
+	newFile := command.Flag("new", "new file").Required().String()
+	outFile := command.Flag("output", "output patch file").Short('o').Required().String()
+	memoryLimit := command.Flag("memory-limit", "approximate memory limit in MB (determines chunk size, bigger chunks produce smaller patches for moved data)").Default("512").Int64()
+	compression := command.Flag("compression", "compression, one of: deflate, none").Short('c').Default("deflate").Enum("deflate", "none")
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		options := Options{MemoryLimit: *memoryLimit * 1024 * 1024, Compression: Deflate}
+		if *compression == "none" {
+			options.Compression = NoCompression
+		}
+
+		result, err := CreateDelta(*oldFile, *newFile, *outFile, options)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+func ConfigureApplyCommand(app *kingpin.Application) {
+	command := app.Command("apply-delta", "Reconstructs new file from old file and patch generated by delta command")
+	oldFile := command.Flag("old", "old file").Required().String()
+	patchFile := command.Flag("patch", "patch file").Short('p').Required().String()
+	outFile := command.Flag("output", "output file").Short('o').Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := ApplyDelta(*oldFile, *patchFile, *outFile)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
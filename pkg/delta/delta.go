@@ -0,0 +1,393 @@
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// Patch file is header followed by chunkHeader and compressed data (controls as varints, diff bytes, extra bytes) of every chunk.
+// New file is split into chunks, every chunk is diffed against the window of old file at the proportional offset
+// (extended by half of chunk size on both sides), so, memory usage doesn't depend on file size.
+var magic = [8]byte{'A', 'B', 'D', 'E', 'L', 'T', 'A', 1}
+
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Deflate
+)
+
+const (
+	DefaultMemoryLimit = 512 * 1024 * 1024
+
+	minChunkSize = 1024 * 1024
+	// window must be addressable by int32 suffix array
+	maxChunkSize = 256 * 1024 * 1024
+)
+
+var errCorrupted = errors.New("patch is corrupted")
+
+type header struct {
+	Magic       [8]byte
+	Compression Compression
+	_           [7]byte
+	OldSize     int64
+	NewSize     int64
+	ChunkSize   int64
+	ChunkCount  int64
+	OldSha512   [sha512.Size]byte
+	NewSha512   [sha512.Size]byte
+}
+
+type chunkHeader struct {
+	OldStart      int64
+	OldLength     int64
+	NewLength     int64
+	ControlLength int64
+	DiffLength    int64
+	ExtraLength   int64
+	// compressed size of controls, diff and extra
+	DataLength int64
+}
+
+type Options struct {
+	// approximate max memory usage, chunk size is derived from it
+	MemoryLimit int64
+	Compression Compression
+}
+
+type Result struct {
+	File      string `json:"file"`
+	OldSize   int64  `json:"oldSize"`
+	NewSize   int64  `json:"newSize"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunkSize"`
+	Chunks    int64  `json:"chunks"`
+	// base64 as in update info
+	OldSha512 string `json:"oldSha512"`
+	NewSha512 string `json:"newSha512"`
+}
+
+// old window (2 chunks) + suffix sort (2 int32 per byte of window) + new chunk + diff and extra + compression buffers
+func chunkSizeForMemoryLimit(memoryLimit int64) int64 {
+	if memoryLimit <= 0 {
+		memoryLimit = DefaultMemoryLimit
+	}
+	chunkSize := memoryLimit / 24
+	if chunkSize < minChunkSize {
+		return minChunkSize
+	}
+	if chunkSize > maxChunkSize {
+		return maxChunkSize
+	}
+	return chunkSize
+}
+
+// old window for chunk of new file at newStart
+func oldWindow(oldSize int64, newSize int64, chunkSize int64, newStart int64) (int64, int64) {
+	start := newStart
+	if newSize != 0 {
+		// float to not overflow for large files
+		start = int64(float64(newStart) / float64(newSize) * float64(oldSize))
+	}
+	start -= chunkSize / 2
+	if start < 0 {
+		start = 0
+	}
+	end := start + chunkSize*2
+	if end > oldSize {
+		end = oldSize
+		start = end - chunkSize*2
+		if start < 0 {
+			start = 0
+		}
+	}
+	return start, end - start
+}
+
+// CreateDelta writes patch to reconstruct newFile from oldFile
+func CreateDelta(oldFile string, newFile string, outFile string, options Options) (*Result, error) {
+	oldDescriptor, err := os.Open(oldFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(oldDescriptor)
+
+	newDescriptor, err := os.Open(newFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(newDescriptor)
+
+	h := header{Magic: magic, Compression: options.Compression, ChunkSize: chunkSizeForMemoryLimit(options.MemoryLimit)}
+	h.OldSize, err = hashFile(oldDescriptor, h.OldSha512[:])
+	if err != nil {
+		return nil, err
+	}
+	h.NewSize, err = hashFile(newDescriptor, h.NewSha512[:])
+	if err != nil {
+		return nil, err
+	}
+	h.ChunkCount = (h.NewSize + h.ChunkSize - 1) / h.ChunkSize
+
+	err = fs.WriteFileAtomicWith(outFile, 0644, func(writer *os.File) error {
+		bufferedWriter := bufio.NewWriter(writer)
+		err := binary.Write(bufferedWriter, binary.LittleEndian, &h)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for newStart := int64(0); newStart < h.NewSize; newStart += h.ChunkSize {
+			err = writeChunk(bufferedWriter, oldDescriptor, newDescriptor, &h, newStart)
+			if err != nil {
+				return err
+			}
+		}
+		return errors.WithStack(bufferedWriter.Flush())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(outFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &Result{
+		File:      outFile,
+		OldSize:   h.OldSize,
+		NewSize:   h.NewSize,
+		Size:      info.Size(),
+		ChunkSize: h.ChunkSize,
+		Chunks:    h.ChunkCount,
+		OldSha512: base64.StdEncoding.EncodeToString(h.OldSha512[:]),
+		NewSha512: base64.StdEncoding.EncodeToString(h.NewSha512[:]),
+	}
+	if result.Size >= result.NewSize {
+		log.WithFields(log.Fields{"patch": result.Size, "new": result.NewSize}).Warn("patch is not smaller than new file")
+	}
+	return result, nil
+}
+
+func writeChunk(writer io.Writer, oldDescriptor *os.File, newDescriptor *os.File, h *header, newStart int64) error {
+	chunk := chunkHeader{NewLength: h.ChunkSize}
+	if newStart+chunk.NewLength > h.NewSize {
+		chunk.NewLength = h.NewSize - newStart
+	}
+	chunk.OldStart, chunk.OldLength = oldWindow(h.OldSize, h.NewSize, h.ChunkSize, newStart)
+
+	old, err := readRange(oldDescriptor, chunk.OldStart, chunk.OldLength)
+	if err != nil {
+		return err
+	}
+	new, err := readRange(newDescriptor, newStart, chunk.NewLength)
+	if err != nil {
+		return err
+	}
+
+	patch := diffChunk(old, new)
+
+	var controls []byte
+	buffer := make([]byte, binary.MaxVarintLen64)
+	for _, c := range patch.controls {
+		controls = append(controls, buffer[:binary.PutVarint(buffer, c.diffLength)]...)
+		controls = append(controls, buffer[:binary.PutVarint(buffer, c.extraLength)]...)
+		controls = append(controls, buffer[:binary.PutVarint(buffer, c.seek)]...)
+	}
+	chunk.ControlLength = int64(len(controls))
+	chunk.DiffLength = int64(len(patch.diff))
+	chunk.ExtraLength = int64(len(patch.extra))
+
+	var data bytes.Buffer
+	var dataWriter io.Writer = &data
+	var compressor *flate.Writer
+	if h.Compression == Deflate {
+		compressor, err = flate.NewWriter(&data, flate.BestCompression)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		dataWriter = compressor
+	}
+	for _, part := range [][]byte{controls, patch.diff, patch.extra} {
+		_, err = dataWriter.Write(part)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if compressor != nil {
+		err = compressor.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	chunk.DataLength = int64(data.Len())
+
+	err = binary.Write(writer, binary.LittleEndian, &chunk)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = writer.Write(data.Bytes())
+	return errors.WithStack(err)
+}
+
+// ApplyDelta reconstructs new file from old file and patch, checksums of old and new file are verified
+func ApplyDelta(oldFile string, patchFile string, outFile string) (*Result, error) {
+	patchDescriptor, err := os.Open(patchFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(patchDescriptor)
+
+	reader := bufio.NewReader(patchDescriptor)
+	var h header
+	err = binary.Read(reader, binary.LittleEndian, &h)
+	if err != nil || h.Magic != magic {
+		return nil, errors.Errorf("%s is not a delta patch", patchFile)
+	}
+	if h.Compression != NoCompression && h.Compression != Deflate {
+		return nil, errors.Errorf("unsupported compression %d of patch %s", h.Compression, patchFile)
+	}
+	if h.ChunkSize <= 0 || h.ChunkSize > maxChunkSize || h.ChunkCount != (h.NewSize+h.ChunkSize-1)/h.ChunkSize {
+		return nil, errors.WithMessage(errCorrupted, patchFile)
+	}
+
+	oldDescriptor, err := os.Open(oldFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(oldDescriptor)
+
+	var oldSha512 [sha512.Size]byte
+	oldSize, err := hashFile(oldDescriptor, oldSha512[:])
+	if err != nil {
+		return nil, err
+	}
+	if oldSize != h.OldSize || oldSha512 != h.OldSha512 {
+		return nil, errors.Errorf("patch %s cannot be applied to %s: old file differs from the file patch was created for", patchFile, oldFile)
+	}
+
+	hash := sha512.New()
+	err = fs.WriteFileAtomicWith(outFile, 0644, func(writer *os.File) error {
+		outWriter := bufio.NewWriter(io.MultiWriter(writer, hash))
+		for i := int64(0); i < h.ChunkCount; i++ {
+			data, err := readChunk(reader, oldDescriptor, &h)
+			if err != nil {
+				return errors.WithMessage(err, patchFile)
+			}
+			_, err = outWriter.Write(data)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		err := outWriter.Flush()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !bytes.Equal(hash.Sum(nil), h.NewSha512[:]) {
+			return errors.Errorf("sha512 checksum mismatch for reconstructed file %s", outFile)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := patchDescriptor.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Result{
+		File:      outFile,
+		OldSize:   h.OldSize,
+		NewSize:   h.NewSize,
+		Size:      info.Size(),
+		ChunkSize: h.ChunkSize,
+		Chunks:    h.ChunkCount,
+		OldSha512: base64.StdEncoding.EncodeToString(h.OldSha512[:]),
+		NewSha512: base64.StdEncoding.EncodeToString(h.NewSha512[:]),
+	}, nil
+}
+
+func readChunk(reader io.Reader, oldDescriptor *os.File, h *header) ([]byte, error) {
+	var chunk chunkHeader
+	err := binary.Read(reader, binary.LittleEndian, &chunk)
+	if err != nil {
+		return nil, errCorrupted
+	}
+
+	if chunk.OldStart < 0 || chunk.OldLength < 0 || chunk.OldStart+chunk.OldLength > h.OldSize || chunk.OldLength > 2*h.ChunkSize ||
+		chunk.NewLength <= 0 || chunk.NewLength > h.ChunkSize ||
+		chunk.ControlLength < 0 || chunk.DiffLength < 0 || chunk.DiffLength > chunk.NewLength || chunk.ExtraLength < 0 || chunk.ExtraLength > chunk.NewLength ||
+		chunk.ControlLength > 3*binary.MaxVarintLen64*(chunk.NewLength+1) || chunk.DataLength < 0 {
+		return nil, errCorrupted
+	}
+
+	var dataReader io.Reader = io.LimitReader(reader, chunk.DataLength)
+	if h.Compression == Deflate {
+		dataReader = flate.NewReader(dataReader)
+	}
+
+	data := make([]byte, chunk.ControlLength+chunk.DiffLength+chunk.ExtraLength)
+	_, err = io.ReadFull(dataReader, data)
+	if err != nil {
+		return nil, errCorrupted
+	}
+	// rest of compressed data (end of stream marker) must be consumed
+	_, err = io.Copy(ioutil.Discard, dataReader)
+	if err != nil {
+		return nil, errCorrupted
+	}
+
+	patch := &chunkPatch{diff: data[chunk.ControlLength : chunk.ControlLength+chunk.DiffLength], extra: data[chunk.ControlLength+chunk.DiffLength:]}
+	controlReader := bytes.NewReader(data[:chunk.ControlLength])
+	for controlReader.Len() > 0 {
+		var c control
+		for _, value := range []*int64{&c.diffLength, &c.extraLength, &c.seek} {
+			*value, err = binary.ReadVarint(controlReader)
+			if err != nil {
+				return nil, errCorrupted
+			}
+		}
+		patch.controls = append(patch.controls, c)
+	}
+
+	old, err := readRange(oldDescriptor, chunk.OldStart, chunk.OldLength)
+	if err != nil {
+		return nil, err
+	}
+	return applyChunk(old, patch, chunk.NewLength)
+}
+
+func readRange(file *os.File, start int64, length int64) ([]byte, error) {
+	data := make([]byte, length)
+	_, err := file.ReadAt(data, start)
+	if err != nil && !(err == io.EOF && length == 0) {
+		return nil, errors.WithStack(err)
+	}
+	return data, nil
+}
+
+// returns size
+func hashFile(file *os.File, result []byte) (int64, error) {
+	hash := sha512.New()
+	size, err := io.Copy(hash, io.NewSectionReader(file, 0, 1<<62))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	copy(result, hash.Sum(nil))
+	return size, nil
+}
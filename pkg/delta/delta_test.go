@@ -0,0 +1,130 @@
+package delta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSuffixSort(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, data := range []string{"", "a", "banana", "mississippi", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"} {
+		expected := make([]int32, len(data)+1)
+		for i := range expected {
+			expected[i] = int32(i)
+		}
+		sort.Slice(expected, func(i, j int) bool { return data[expected[i]:] < data[expected[j]:] })
+		g.Expect(suffixSort([]byte(data))).To(Equal(expected), data)
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "delta")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	random := rand.New(rand.NewSource(42))
+	old := make([]byte, 3*minChunkSize+1000)
+	random.Read(old)
+
+	// insertion, deletion, modification and appended data
+	new := append([]byte{}, old[:5000]...)
+	new = append(new, []byte("inserted data")...)
+	new = append(new, old[5000:minChunkSize]...)
+	new = append(new, old[minChunkSize+4096:]...)
+	for i := 2 * minChunkSize; i < 2*minChunkSize+100; i++ {
+		new[i] ^= 0xff
+	}
+	extra := make([]byte, 20000)
+	random.Read(extra)
+	new = append(new, extra...)
+
+	oldFile := filepath.Join(tmpDir, "old")
+	newFile := filepath.Join(tmpDir, "new")
+	g.Expect(ioutil.WriteFile(oldFile, old, 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(newFile, new, 0644)).NotTo(HaveOccurred())
+
+	for _, compression := range []Compression{Deflate, NoCompression} {
+		patchFile := filepath.Join(tmpDir, "patch")
+		result, err := CreateDelta(oldFile, newFile, patchFile, Options{MemoryLimit: 1, Compression: compression})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.ChunkSize).To(Equal(int64(minChunkSize)))
+		g.Expect(result.Chunks).To(Equal(int64(4)))
+		g.Expect(result.NewSize).To(Equal(int64(len(new))))
+		if compression == Deflate {
+			g.Expect(result.Size).To(BeNumerically("<", 100000))
+		}
+
+		outFile := filepath.Join(tmpDir, "out")
+		_, err = ApplyDelta(oldFile, patchFile, outFile)
+		g.Expect(err).NotTo(HaveOccurred())
+		data, err := ioutil.ReadFile(outFile)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(bytes.Equal(data, new)).To(BeTrue())
+	}
+}
+
+func TestDeltaEmptyFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "delta")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	emptyFile := filepath.Join(tmpDir, "empty")
+	dataFile := filepath.Join(tmpDir, "data")
+	g.Expect(ioutil.WriteFile(emptyFile, nil, 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(dataFile, []byte("hello world"), 0644)).NotTo(HaveOccurred())
+
+	for _, files := range [][]string{{emptyFile, dataFile}, {dataFile, emptyFile}} {
+		patchFile := filepath.Join(tmpDir, "patch")
+		_, err = CreateDelta(files[0], files[1], patchFile, Options{})
+		g.Expect(err).NotTo(HaveOccurred())
+
+		outFile := filepath.Join(tmpDir, "out")
+		_, err = ApplyDelta(files[0], patchFile, outFile)
+		g.Expect(err).NotTo(HaveOccurred())
+
+		expected, err := ioutil.ReadFile(files[1])
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(ioutil.ReadFile(outFile)).To(Equal(expected))
+	}
+}
+
+func TestApplyDeltaToOtherFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "delta")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	oldFile := filepath.Join(tmpDir, "old")
+	newFile := filepath.Join(tmpDir, "new")
+	patchFile := filepath.Join(tmpDir, "patch")
+	g.Expect(ioutil.WriteFile(oldFile, []byte("hello world"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(newFile, []byte("hello new world"), 0644)).NotTo(HaveOccurred())
+
+	_, err = CreateDelta(oldFile, newFile, patchFile, Options{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(ioutil.WriteFile(oldFile, []byte("hello other world"), 0644)).NotTo(HaveOccurred())
+	outFile := filepath.Join(tmpDir, "out")
+	_, err = ApplyDelta(oldFile, patchFile, outFile)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("old file differs"))
+	_, err = os.Stat(outFile)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	_, err = ApplyDelta(oldFile, oldFile, outFile)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("is not a delta patch"))
+}
@@ -1,8 +1,6 @@
 package download
 
 import (
-	"crypto/sha512"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"os"
@@ -18,8 +16,11 @@ type ActualLocation struct {
 	Url            string
 	OutFileName    string
 	isAcceptRanges bool
+	// all parts are downloaded to part files (kept if download is interrupted) and first part is renamed to OutFileName on completion
+	isResumable bool
 	StatusCode     int
 	ContentLength  int64
+	ContentType    string
 	Parts          []*Part
 }
 
@@ -67,16 +68,17 @@ func (actualLocation *ActualLocation) computeParts(minPartSize int64) {
 		}
 
 		var name string
-		if i == 0 {
+		if i == 0 && !actualLocation.isResumable {
 			name = actualLocation.OutFileName
 		} else {
 			name = fmt.Sprintf("%s.part%d", actualLocation.OutFileName, i)
 		}
 
 		actualLocation.Parts[i] = &Part{
-			Name:  name,
-			Start: start,
-			End:   end,
+			Name:        name,
+			Start:       start,
+			End:         end,
+			isResumable: actualLocation.isResumable,
 		}
 
 		start = end
@@ -86,13 +88,18 @@ func (actualLocation *ActualLocation) computeParts(minPartSize int64) {
 func (actualLocation *ActualLocation) deleteUnnecessaryParts() {
 	for i := len(actualLocation.Parts) - 1; i >= 0; i-- {
 		if actualLocation.Parts[i].Skip {
+			// part file may exist if download was resumed
+			err := removeFileIfExists(actualLocation.Parts[i].Name)
+			if err != nil {
+				log.WithError(err).Warn("cannot delete part file")
+			}
 			actualLocation.Parts = append(actualLocation.Parts[:i], actualLocation.Parts[i+1:]...)
 		}
 	}
 }
 
-func (actualLocation *ActualLocation) concatenateParts(expectedSha512 string) error {
-	hasCheckSum := len(expectedSha512) != 0
+func (actualLocation *ActualLocation) concatenateParts(checksum Checksum) error {
+	hasCheckSum := !checksum.IsEmpty()
 
 	fileMode := os.O_APPEND
 	if hasCheckSum {
@@ -117,7 +124,7 @@ func (actualLocation *ActualLocation) concatenateParts(expectedSha512 string) er
 	defer util.Close(totalFile)
 
 	buf := make([]byte, 32*1024)
-	inputHash := sha512.New()
+	inputHash := checksum.newHash()
 	if hasCheckSum {
 		_, err = io.CopyBuffer(inputHash, totalFile, buf)
 		if err != nil {
@@ -155,11 +162,24 @@ func (actualLocation *ActualLocation) concatenateParts(expectedSha512 string) er
 	}
 
 	if hasCheckSum {
-		actualCheckSum := base64.StdEncoding.EncodeToString((inputHash).Sum(nil))
-		if actualCheckSum != expectedSha512 {
-			return errors.Errorf("sha512 checksum mismatch, expected %s, got %s", expectedSha512, actualCheckSum)
-		}
+		return checksum.verify(inputHash)
+	}
+
+	return nil
+}
+
+func (actualLocation *ActualLocation) verifySize() error {
+	if actualLocation.ContentLength < 0 {
+		return nil
+	}
+
+	fileInfo, err := os.Stat(actualLocation.OutFileName)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
+	if fileInfo.Size() != actualLocation.ContentLength {
+		return errors.Errorf("size mismatch, expected %d, got %d", actualLocation.ContentLength, fileInfo.Size())
+	}
 	return nil
 }
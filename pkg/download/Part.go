@@ -9,12 +9,14 @@ import (
 	"time"
 
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/progress"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
 )
 
-const maxAttemptNumber = 3
+// the first attempt and 3 retries of interrupted part download
+var partRetryPolicy = util.RetryPolicy{MaxAttempts: 4, InitialDelay: 2 * time.Second, Multiplier: 2, Jitter: 0.2}
 
 type Part struct {
 	Name string
@@ -24,6 +26,10 @@ type Part struct {
 
 	Skip   bool
 	isFail bool
+
+	isResumable  bool
+	initialStart int64
+	progress     *progress.Reporter
 }
 
 func (part *Part) getRange() string {
@@ -31,6 +37,19 @@ func (part *Part) getRange() string {
 }
 
 func (part *Part) download(context context.Context, url string, index int, client *http.Client) error {
+	fileFlags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	resumedLength := int64(0)
+	if part.isResumable {
+		isComplete, err := part.resume()
+		if err != nil || isComplete {
+			return err
+		}
+
+		resumedLength = part.Start - part.initialStart
+		// data is always appended, so, it is correct for both resume and retry
+		fileFlags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
 	// request cannot be reused because Range header is set
 	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
@@ -51,53 +70,89 @@ func (part *Part) download(context context.Context, url string, index int, clien
 		return nil
 	}
 
-	partFile, err := os.OpenFile(part.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	partFile, err := os.OpenFile(part.Name, fileFlags, 0666)
 	if err != nil {
 		return fsutil.CloseAndCheckError(err, response.Body)
 	}
 
 	defer util.Close(partFile)
 
+	if resumedLength > 0 && response.StatusCode == http.StatusOK {
+		// server sent the whole file instead of requested range
+		err = partFile.Truncate(0)
+		if err != nil {
+			return fsutil.CloseAndCheckError(err, response.Body)
+		}
+		part.progress.Add(-resumedLength)
+	}
+
 	buf := make([]byte, 32*1024)
-	for attemptNumber := 0; ; attemptNumber++ {
-		if attemptNumber != 0 {
-			time.Sleep(2 * time.Second)
-			log.Infof("retrying (%d)", attemptNumber)
+	policy := partRetryPolicy
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		log.WithError(err).WithFields(log.Fields{"index": index, "attempt": attempt, "delay": delay}).Info("part download failed, retrying")
+	}
+	return util.Retry(request.Context(), policy, func(attempt int) error {
+		if attempt > 1 {
+			var err error
 			response, err = part.doRequest(request, client, index)
-			if err != nil {
-				if response != nil {
-					err = fsutil.CloseAndCheckError(err, response.Body)
-				}
-				if attemptNumber == maxAttemptNumber {
-					return errors.WithStack(err)
-				}
-				continue
+			if err != nil || response == nil {
+				return err
 			}
 		}
 
-		written, err := writeToFile(partFile, response, &buf)
+		written, err := writeToFile(&progress.Writer{Writer: partFile, Reporter: part.progress}, response, &buf)
 		if err == nil || request.Context().Err() != nil {
 			return nil
 		}
 
-		if attemptNumber == maxAttemptNumber {
-			return errors.WithStack(err)
-		}
-
+		// next attempt continues from the written position
 		if part.End > 0 {
 			part.Start += written
-			_, err = partFile.Seek(part.Start, io.SeekStart)
-			if err != nil {
-				return errors.WithStack(err)
+			_, seekErr := partFile.Seek(part.Start, io.SeekStart)
+			if seekErr != nil {
+				return util.NonRetryable(errors.WithStack(seekErr))
 			}
 			request.Header.Set("Range", part.getRange())
 		} else {
-			_, err = partFile.Seek(0, io.SeekStart)
-			if err != nil {
-				return errors.WithStack(err)
+			_, seekErr := partFile.Seek(0, io.SeekStart)
+			if seekErr != nil {
+				return util.NonRetryable(errors.WithStack(seekErr))
 			}
 		}
+		return errors.WithStack(err)
+	})
+}
+
+// existing part file of interrupted download is continued
+func (part *Part) resume() (bool, error) {
+	part.initialStart = part.Start
+	if part.End <= 0 {
+		return false, nil
+	}
+
+	fileInfo, err := os.Stat(part.Name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
 	}
+
+	existingLength := fileInfo.Size()
+	expectedLength := part.End - part.Start
+	if existingLength > expectedLength {
+		// corrupted, download again
+		return false, errors.WithStack(os.Truncate(part.Name, 0))
+	}
+
+	part.progress.Add(existingLength)
+	if existingLength == expectedLength {
+		log.WithField("part", part.Name).Debug("part is already downloaded")
+		return true, nil
+	}
+
+	part.Start += existingLength
+	return false, nil
 }
 
 func (part *Part) doRequest(request *http.Request, client *http.Client, index int) (*http.Response, error) {
@@ -129,7 +184,7 @@ func (part *Part) doRequest(request *http.Request, client *http.Client, index in
 	}
 }
 
-func writeToFile(file *os.File, response *http.Response, buffer *[]byte) (int64, error) {
+func writeToFile(file io.Writer, response *http.Response, buffer *[]byte) (int64, error) {
 	defer util.Close(response.Body)
 	return io.CopyBuffer(file, response.Body, *buffer)
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
@@ -160,7 +161,7 @@ func CheckCache(filePath string, cacheDir string, logFields log.Fielder) (bool,
 }
 
 func RenameToFinalFile(tempFile string, filePath string, logFields log.Fielder) {
-	err := os.Rename(tempFile, filePath)
+	err := fs.RenameWithRetry(tempFile, filePath)
 	if err != nil {
 		log.WithFields(logFields).WithFields(log.Fields{
 			"tempFile": tempFile,
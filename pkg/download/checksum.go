@@ -0,0 +1,53 @@
+package download
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+// sha512 is expected in base64 (npm-style), sha256 in hex (SHASUMS256.txt) or base64
+type Checksum struct {
+	Sha512 string
+	Sha256 string
+}
+
+func (t Checksum) IsEmpty() bool {
+	return len(t.Sha512) == 0 && len(t.Sha256) == 0
+}
+
+// sha512 is preferred if both are specified
+func (t Checksum) newHash() hash.Hash {
+	if len(t.Sha512) != 0 {
+		return sha512.New()
+	}
+	return sha256.New()
+}
+
+func (t Checksum) verify(actualHash hash.Hash) error {
+	actual := actualHash.Sum(nil)
+	if len(t.Sha512) != 0 {
+		actualCheckSum := base64.StdEncoding.EncodeToString(actual)
+		if actualCheckSum != t.Sha512 {
+			return errors.Errorf("sha512 checksum mismatch, expected %s, got %s", t.Sha512, actualCheckSum)
+		}
+		return nil
+	}
+
+	var actualCheckSum string
+	if len(t.Sha256) == hex.EncodedLen(sha256.Size) {
+		actualCheckSum = hex.EncodeToString(actual)
+	} else {
+		actualCheckSum = base64.StdEncoding.EncodeToString(actual)
+	}
+
+	if !strings.EqualFold(actualCheckSum, t.Sha256) {
+		return errors.Errorf("sha256 checksum mismatch, expected %s, got %s", t.Sha256, actualCheckSum)
+	}
+	return nil
+}
@@ -1,15 +1,20 @@
 package download
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"path/filepath"
 	"runtime"
 	"time"
 
 	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/progress"
 	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/app-builder/pkg/util/httpclient"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
 	"github.com/dustin/go-humanize"
@@ -36,25 +41,49 @@ func ConfigureCommand(app *kingpin.Application) {
 	command := app.Command("download", "Download file.")
 	fileUrl := command.Flag("url", "The URL.").Short('u').Required().String()
 	output := command.Flag("output", "The output file.").Short('o').Required().String()
-	sha512 := command.Flag("sha512", "The expected sha512 of file.").String()
+	sha512 := command.Flag("sha512", "The expected sha512 of file (base64).").String()
+	sha256 := command.Flag("sha256", "The expected sha256 of file (hex or base64).").String()
+	isProgress := command.Flag("progress", "Report progress as JSON lines to stdout.").Bool()
 
 	command.Action(func(context *kingpin.ParseContext) error {
-		return NewDownloader().Download(*fileUrl, *output, *sha512)
+		downloader := NewDownloader()
+		if *isProgress {
+			downloader.ProgressWriter = os.Stdout
+		}
+		return downloader.DownloadWithChecksum(*fileUrl, *output, Checksum{Sha512: *sha512, Sha256: *sha256})
 	})
 }
 
 type Downloader struct {
 	client    *http.Client
 	Transport *http.Transport
+
+	// if set, progress is reported as JSON lines (see progress.Event), global progress output is used otherwise
+	ProgressWriter io.Writer
+	// if not set, root context is used (download is cancelled on SIGINT or SIGTERM), downloaded parts are kept to resume
+	Context context.Context
+}
+
+func (t *Downloader) getContext() context.Context {
+	if t.Context == nil {
+		return util.RootContext()
+	}
+	return t.Context
+}
+
+func (t *Downloader) createProgressReporter(url string, total int64) *progress.Reporter {
+	if t.ProgressWriter == nil {
+		return progress.Start("download", url, total)
+	}
+	return progress.NewReporter(t.ProgressWriter, "download", url, total)
 }
 
 func NewDownloader() *Downloader {
-	return NewDownloaderWithTransport(&http.Transport{
-		Proxy:               util.ProxyFromEnvironmentAndNpm,
-		MaxIdleConns:        64,
-		MaxIdleConnsPerHost: 64,
-		IdleConnTimeout:     30 * time.Second,
-	})
+	transport := httpclient.NewTransport()
+	transport.MaxIdleConns = 64
+	transport.MaxIdleConnsPerHost = 64
+	transport.IdleConnTimeout = 30 * time.Second
+	return NewDownloaderWithTransport(transport)
 }
 
 func NewDownloaderWithTransport(transport *http.Transport) *Downloader {
@@ -70,6 +99,10 @@ func NewDownloaderWithTransport(transport *http.Transport) *Downloader {
 }
 
 func (t *Downloader) Download(url string, output string, sha512 string) error {
+	return t.DownloadWithChecksum(url, output, Checksum{Sha512: sha512})
+}
+
+func (t *Downloader) DownloadWithChecksum(url string, output string, checksum Checksum) error {
 	start := time.Now()
 
 	actualLocation, err := t.follow(url, userAgent, output)
@@ -77,7 +110,7 @@ func (t *Downloader) Download(url string, output string, sha512 string) error {
 		return errors.WithStack(err)
 	}
 
-	err = t.DownloadResolved(actualLocation, sha512, url)
+	err = t.downloadResolved(actualLocation, checksum, url)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -90,15 +123,35 @@ func (t *Downloader) Download(url string, output string, sha512 string) error {
 	return err
 }
 
+// Resolve follows redirects and returns location to download (content length and type can be checked before download)
+func (t *Downloader) Resolve(url string, output string) (*ActualLocation, error) {
+	return t.follow(url, userAgent, output)
+}
+
 func (t *Downloader) DownloadResolved(location *ActualLocation, sha512 string, urlToLog string) error {
+	return t.downloadResolved(location, Checksum{Sha512: sha512}, urlToLog)
+}
+
+func (t *Downloader) downloadResolved(location *ActualLocation, checksum Checksum, urlToLog string) error {
 	err := fsutil.EnsureDir(filepath.Dir(location.OutFileName))
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	downloadContext, cancel := util.CreateContext()
+	downloadContext, cancel := context.WithCancel(t.getContext())
+	defer cancel()
+
+	err = location.prepareResume()
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
 	location.computeParts(minPartSize)
+	reporter := t.createProgressReporter(urlToLog, location.ContentLength)
+	for _, part := range location.Parts {
+		part.progress = reporter
+	}
+
 	log.WithFields(&log.Fields{
 		"url":   urlToLog,
 		"size":  humanize.Bytes(uint64(location.ContentLength)),
@@ -120,6 +173,7 @@ func (t *Downloader) DownloadResolved(location *ActualLocation, sha512 string, u
 	})
 
 	if err != nil {
+		reporter.Finish(err)
 		return errors.WithStack(err)
 	}
 
@@ -131,7 +185,23 @@ func (t *Downloader) DownloadResolved(location *ActualLocation, sha512 string, u
 	}
 
 	location.deleteUnnecessaryParts()
-	err = location.concatenateParts(sha512)
+	err = location.concatenateParts(checksum)
+	if err != nil {
+		reporter.Finish(err)
+		location.discardResume()
+		// corrupted file must be not used
+		removeError := removeFileIfExists(location.Parts[0].Name)
+		if removeError != nil {
+			log.WithError(removeError).Warn("cannot delete downloaded file")
+		}
+		return errors.WithStack(err)
+	}
+
+	err = location.completeResume()
+	if err == nil {
+		err = location.verifySize()
+	}
+	reporter.Finish(err)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -151,7 +221,7 @@ func (t *Downloader) follow(initialUrl, userAgent, outFileName string) (*ActualL
 
 		// should use GET instead of HEAD because ContentLength maybe omitted for HEAD requests
 		// https://stackoverflow.com/questions/3854842/content-length-header-with-head-requests
-		req, err := http.NewRequest(http.MethodGet, currentUrl, nil)
+		req, err := http.NewRequestWithContext(t.getContext(), http.MethodGet, currentUrl, nil)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -180,6 +250,7 @@ func (t *Downloader) follow(initialUrl, userAgent, outFileName string) (*ActualL
 			}
 
 			actualLocation := NewResolvedLocation(currentUrl, response.ContentLength, outFileName, response.Header.Get("Accept-Ranges") != "")
+			actualLocation.ContentType = response.Header.Get("Content-Type")
 			var length string
 			if response.ContentLength < 0 {
 				length = "unknown"
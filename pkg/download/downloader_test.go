@@ -0,0 +1,137 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/json-iterator/go"
+	. "github.com/onsi/gomega"
+)
+
+func createTestServer(content []byte, ranges *[]string) *httptest.Server {
+	var mutex sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		*ranges = append(*ranges, request.Header.Get("Range"))
+		mutex.Unlock()
+		http.ServeContent(writer, request, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestResumeDownload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	content := make([]byte, 100*1024)
+	rand.New(rand.NewSource(42)).Read(content)
+	hash := sha512.Sum512(content)
+
+	var ranges []string
+	server := createTestServer(content, &ranges)
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "download")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	outFile := filepath.Join(tmpDir, "file.bin")
+	url := server.URL + "/file.bin"
+
+	// simulate interrupted download
+	state, err := jsoniter.ConfigFastest.Marshal(resumeState{Url: url, ContentLength: int64(len(content))})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(outFile+".download", state, 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(outFile+".part0", content[:1000], 0644)).NotTo(HaveOccurred())
+
+	progressOutput := new(bytes.Buffer)
+	downloader := NewDownloader()
+	downloader.ProgressWriter = progressOutput
+	err = downloader.Download(url, outFile, base64.StdEncoding.EncodeToString(hash[:]))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(outFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bytes.Equal(data, content)).To(BeTrue())
+	g.Expect(ranges).To(ContainElement("bytes=1000-102399"))
+
+	// state and part files are removed
+	files, err := filepath.Glob(outFile + ".*")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(BeEmpty())
+
+	lines := strings.Split(strings.TrimSpace(progressOutput.String()), "\n")
+	var lastEvent progress.Event
+	g.Expect(jsoniter.ConfigFastest.Unmarshal([]byte(lines[len(lines)-1]), &lastEvent)).NotTo(HaveOccurred())
+	g.Expect(lastEvent.Op).To(Equal("download"))
+	g.Expect(lastEvent.Done).To(BeTrue())
+	g.Expect(lastEvent.Error).To(BeFalse())
+	g.Expect(lastEvent.Transferred).To(Equal(int64(len(content))))
+	g.Expect(lastEvent.Total).To(Equal(int64(len(content))))
+}
+
+func TestStalePartsAreNotResumed(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	content := []byte(strings.Repeat("app-builder", 1000))
+	var ranges []string
+	server := createTestServer(content, &ranges)
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "download")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// part without state (e.g. from another URL) must be not used
+	outFile := filepath.Join(tmpDir, "file.bin")
+	g.Expect(ioutil.WriteFile(outFile+".part0", []byte("garbage"), 0644)).NotTo(HaveOccurred())
+
+	err = NewDownloader().Download(server.URL+"/file.bin", outFile, "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(outFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal(string(content)))
+}
+
+func TestSha256Checksum(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	content := []byte(strings.Repeat("checksum", 1000))
+	var ranges []string
+	server := createTestServer(content, &ranges)
+	defer server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "download")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	hash := sha256.Sum256(content)
+	outFile := filepath.Join(tmpDir, "file.bin")
+	err = NewDownloader().DownloadWithChecksum(server.URL+"/file.bin", outFile, Checksum{Sha256: hex.EncodeToString(hash[:])})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outFile).To(BeARegularFile())
+
+	// file is deleted on mismatch
+	mismatchFile := filepath.Join(tmpDir, "mismatch.bin")
+	err = NewDownloader().DownloadWithChecksum(server.URL+"/file.bin", mismatchFile, Checksum{Sha256: strings.Repeat("0", 64)})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("sha256 checksum mismatch"))
+	_, err = os.Stat(mismatchFile)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+	files, err := filepath.Glob(mismatchFile + ".*")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(BeEmpty())
+}
@@ -0,0 +1,109 @@
+package download
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+// part files of interrupted download are reused only if URL and content length are the same
+type resumeState struct {
+	Url           string `json:"url"`
+	ContentLength int64  `json:"contentLength"`
+}
+
+func (actualLocation *ActualLocation) getResumeStateFile() string {
+	return actualLocation.OutFileName + ".download"
+}
+
+func (actualLocation *ActualLocation) prepareResume() error {
+	stateFile := actualLocation.getResumeStateFile()
+	actualLocation.isResumable = actualLocation.isAcceptRanges && actualLocation.ContentLength > 0
+
+	expectedState := resumeState{Url: actualLocation.Url, ContentLength: actualLocation.ContentLength}
+	var existingState resumeState
+	data, err := ioutil.ReadFile(stateFile)
+	if err == nil {
+		err = jsoniter.ConfigFastest.Unmarshal(data, &existingState)
+		if err != nil {
+			log.WithError(err).WithField("file", stateFile).Debug("cannot parse download state")
+		}
+	} else if !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+
+	if actualLocation.isResumable && existingState == expectedState {
+		log.WithField("file", actualLocation.OutFileName).Info("resuming interrupted download")
+		return nil
+	}
+
+	err = actualLocation.removePartFiles()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !actualLocation.isResumable {
+		return removeFileIfExists(stateFile)
+	}
+
+	data, err = jsoniter.ConfigFastest.Marshal(expectedState)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(stateFile, data, 0644))
+}
+
+func (actualLocation *ActualLocation) removePartFiles() error {
+	partFiles, err := filepath.Glob(actualLocation.OutFileName + ".part*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, partFile := range partFiles {
+		err = removeFileIfExists(partFile)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (actualLocation *ActualLocation) completeResume() error {
+	if !actualLocation.isResumable {
+		return nil
+	}
+
+	err := fs.RenameWithRetry(actualLocation.Parts[0].Name, actualLocation.OutFileName)
+	if err != nil {
+		return err
+	}
+	return removeFileIfExists(actualLocation.getResumeStateFile())
+}
+
+// invalid data must be not resumed
+func (actualLocation *ActualLocation) discardResume() {
+	if !actualLocation.isResumable {
+		return
+	}
+
+	err := actualLocation.removePartFiles()
+	if err == nil {
+		err = removeFileIfExists(actualLocation.getResumeStateFile())
+	}
+	if err != nil {
+		log.WithError(err).Warn("cannot remove part files")
+	}
+}
+
+func removeFileIfExists(file string) error {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -23,6 +23,9 @@ type ElectronDownloadOptions struct {
 
 	CustomDir      string `json:"customDir"`
 	CustomFilename string `json:"customFilename"`
+
+	// do not verify zip using SHASUMS256.txt
+	IsSkipChecksum bool `json:"skipChecksum"`
 }
 
 func ConfigureCommand(app *kingpin.Application) {
@@ -54,13 +57,9 @@ func downloadElectron(configs []ElectronDownloadOptions) ([]string, error) {
 	return result, util.MapAsync(len(configs), func(taskIndex int) (func() error, error) {
 		config := configs[taskIndex]
 		return func() error {
-			cacheDir := config.CacheDir
-			if cacheDir == "" {
-				var err error
-				cacheDir, err = download.GetCacheDirectory("electron", "ELECTRON_CACHE", false)
-				if err != nil {
-					return err
-				}
+			cacheDir, err := getCacheDir(&config)
+			if err != nil {
+				return err
 			}
 
 			electronDownloader := &ElectronDownloader{
@@ -129,55 +128,39 @@ type ElectronDownloader struct {
 	cacheDir string
 }
 
-func (t *ElectronDownloader) getCachedFile() string {
-	fileName := t.config.CustomFilename
-	if len(fileName) == 0 {
-		fileName = getFilename(t.config)
-	}
-	return filepath.Join(t.cacheDir, fileName)
-}
-
 func (t *ElectronDownloader) Download() (string, error) {
-	if t.config.Version == "" {
-		return "", errors.New("version not specified")
-	}
-	if t.config.Platform == "" {
-		return "", errors.New("platform not specified")
-	}
-	if t.config.Arch == "" {
-		return "", errors.New("arch not specified")
+	artifact, err := ResolveElectron(t.config, t.cacheDir)
+	if err != nil {
+		return "", err
 	}
 
-	cachedFile := t.getCachedFile()
+	if artifact.IsCached {
+		return artifact.CacheFile, nil
+	}
 
-	fileInfo, err := os.Stat(cachedFile)
-	if err != nil && !os.IsNotExist(err) {
+	err = fsutil.EnsureDir(filepath.Dir(artifact.CacheFile))
+	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
-	if fileInfo != nil {
-		if fileInfo.IsDir() {
-			return "", errors.New("File expected, but got dir")
+	var checksum download.Checksum
+	if !t.config.IsSkipChecksum {
+		checksum, err = getChecksum(artifact, t.cacheDir)
+		if err != nil {
+			return "", err
 		}
-		return cachedFile, nil
-	}
-
-	err = fsutil.EnsureDir(t.cacheDir)
-	if err != nil {
-		return "", errors.WithStack(err)
 	}
 
-	url := getBaseUrl(t.config) + getMiddleUrl(t.config) + "/" + getUrlSuffix(t.config)
-	err = t.doDownload(url, cachedFile)
+	err = t.doDownload(artifact.Url, artifact.CacheFile, checksum)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
 
-	return cachedFile, nil
+	return artifact.CacheFile, nil
 }
 
-func (t *ElectronDownloader) doDownload(url string, cachedFile string) error {
-	tempFile, err := util.TempFile(t.cacheDir, ".zip")
+func (t *ElectronDownloader) doDownload(url string, cachedFile string, checksum download.Checksum) error {
+	tempFile, err := util.TempFile(filepath.Dir(cachedFile), ".zip")
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -188,7 +171,7 @@ func (t *ElectronDownloader) doDownload(url string, cachedFile string) error {
 	}
 
 	downloader := download.NewDownloader()
-	err = downloader.Download(url, tempFile, "")
+	err = downloader.DownloadWithChecksum(url, tempFile, checksum)
 	if err != nil {
 		return errors.WithStack(err)
 	}
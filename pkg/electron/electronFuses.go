@@ -0,0 +1,327 @@
+package electron
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/macho"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// https://github.com/electron/electron/blob/main/docs/tutorial/fuses.md
+// fuse wire: sentinel, schema version, number of fuses, fuse states (one byte per fuse)
+const (
+	fuseSentinel    = "dL7pKGdnNz796PbbjQWNKmHXBZaB9tsX"
+	fuseWireVersion = 1
+
+	fuseDisabled = '0'
+	fuseEnabled  = '1'
+	fuseRemoved  = 'r'
+)
+
+// order is defined by wire schema version 1
+var fuseNames = []string{
+	"runAsNode",
+	"enableCookieEncryption",
+	"enableNodeOptionsEnvironmentVariable",
+	"enableNodeCliInspectArguments",
+	"enableEmbeddedAsarIntegrityValidation",
+	"onlyLoadAppFromAsar",
+	"loadBrowserProcessSpecificV8Snapshot",
+	"grantFileProtocolExtraPrivileges",
+}
+
+type FusesConfig struct {
+	// wire schema version
+	Version int
+	// fuse name to state, not specified fuses are not changed
+	Fuses map[string]bool
+	// error if some fuse of binary is not specified (e.g. new fuse added in a newer Electron version)
+	IsStrict bool
+}
+
+type FusesResult struct {
+	File string `json:"file"`
+	// several wires in the universal binary
+	Wires     []FuseWire `json:"wires"`
+	IsChanged bool       `json:"isChanged"`
+}
+
+type FuseWire struct {
+	Offset  int    `json:"offset"`
+	Version int    `json:"version"`
+	Fuses   []Fuse `json:"fuses"`
+}
+
+type Fuse struct {
+	// index if fuse is unknown
+	Name string `json:"name"`
+	// enabled, disabled, removed or raw value if unknown
+	State string `json:"state"`
+}
+
+func ConfigureFusesCommand(app *kingpin.Application) {
+	command := app.Command("fuses", "Read or flip Electron fuses of Electron binary (Electron Framework of app bundle on macOS), result is written as JSON.")
+	binary := command.Flag("binary", "The Electron executable, Electron Framework binary or app bundle.").Required().String()
+	jsonConfig := command.Flag("configuration", `Fuses to set, e.g. {"version": 1, "runAsNode": false, "onlyLoadAppFromAsar": true, "strictlyRequireAllFuses": false}, FuseV1Options values ("0", "1", ...) are accepted as keys too. Fuses are only read if not specified.`).Short('c').String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var config *FusesConfig
+		if len(*jsonConfig) != 0 {
+			var err error
+			config, err = ParseFusesConfig([]byte(*jsonConfig))
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err := FlipFuses(*binary, config)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// ParseFusesConfig parses config in the format of @electron/fuses (fuse names in camel case, null means not changed)
+func ParseFusesConfig(data []byte) (*FusesConfig, error) {
+	var raw map[string]interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse fuses config")
+	}
+
+	config := &FusesConfig{Fuses: make(map[string]bool)}
+	for key, value := range raw {
+		switch key {
+		case "version":
+			// "1" (FuseVersion.V1) or 1
+			version, err := strconv.Atoi(strings.TrimSpace(toString(value)))
+			if err != nil {
+				return nil, errors.Errorf("invalid fuses config: version must be a number, got %v", value)
+			}
+			config.Version = version
+
+		case "strictlyRequireAllFuses":
+			isStrict, ok := value.(bool)
+			if !ok {
+				return nil, errors.Errorf("invalid fuses config: %s must be a boolean", key)
+			}
+			config.IsStrict = isStrict
+
+		default:
+			index := fuseIndex(key)
+			if index == -1 {
+				return nil, errors.Errorf("invalid fuses config: unknown fuse %q (known: %s)", key, strings.Join(fuseNames, ", "))
+			}
+			if value == nil {
+				continue
+			}
+			state, ok := value.(bool)
+			if !ok {
+				return nil, errors.Errorf("invalid fuses config: %s must be a boolean or null", key)
+			}
+			// FuseV1Options enum value (e.g. "0" for RunAsNode) is used as key by @electron/fuses
+			config.Fuses[fuseName(index)] = state
+		}
+	}
+
+	if config.Version != fuseWireVersion {
+		return nil, errors.Errorf("unsupported fuses config version %d (only %d is supported)", config.Version, fuseWireVersion)
+	}
+	return config, nil
+}
+
+// FlipFuses sets fuses of all wires of binary (only reads if config is nil), file is written only if changed
+func FlipFuses(binary string, config *FusesConfig) (*FusesResult, error) {
+	file, err := resolveFuseBinary(binary)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &FusesResult{File: file, Wires: []FuseWire{}}
+	sentinel := []byte(fuseSentinel)
+	for offset := bytes.Index(data, sentinel); offset >= 0; {
+		wireOffset := offset + len(sentinel)
+		if wireOffset+2 > len(data) || wireOffset+2+int(data[wireOffset+1]) > len(data) {
+			return nil, errors.Errorf("fuse wire at %d is truncated in %s", wireOffset, file)
+		}
+
+		version := int(data[wireOffset])
+		if version != fuseWireVersion {
+			return nil, errors.Errorf("unsupported fuse wire version %d in %s (only %d is supported)", version, file, fuseWireVersion)
+		}
+
+		fuses := data[wireOffset+2 : wireOffset+2+int(data[wireOffset+1])]
+		if config != nil {
+			isChanged, err := setFuses(fuses, config)
+			if err != nil {
+				return nil, errors.WithMessage(err, file)
+			}
+			result.IsChanged = result.IsChanged || isChanged
+		}
+		result.Wires = append(result.Wires, FuseWire{Offset: wireOffset, Version: version, Fuses: describeFuses(fuses)})
+
+		next := bytes.Index(data[wireOffset:], sentinel)
+		if next < 0 {
+			break
+		}
+		offset = wireOffset + next
+	}
+
+	if len(result.Wires) == 0 {
+		return nil, errors.Errorf("fuse wire is not found in %s (Electron 12+ is required)", file)
+	}
+
+	if !result.IsChanged {
+		return result, nil
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = fs.WriteFileAtomic(file, data, info.Mode().Perm())
+	if err != nil {
+		return nil, err
+	}
+
+	isMachO, err := macho.IsMachOFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if isMachO {
+		// arm64 binaries are not launched without valid (at least ad hoc) signature
+		log.WithField("file", file).Warn("code signature is invalidated by fuse flipping, binary must be signed again")
+	}
+	return result, nil
+}
+
+// returns true if some fuse is changed
+func setFuses(fuses []byte, config *FusesConfig) (bool, error) {
+	if config.IsStrict {
+		var missing []string
+		for index := range fuses {
+			name := fuseName(index)
+			if _, ok := config.Fuses[name]; !ok && fuses[index] != fuseRemoved {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) != 0 {
+			return false, errors.Errorf("fuses are not specified, but strictlyRequireAllFuses is set: %s", strings.Join(missing, ", "))
+		}
+	}
+
+	names := make([]string, 0, len(config.Fuses))
+	for name := range config.Fuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	isChanged := false
+	for _, name := range names {
+		index := fuseIndex(name)
+		if index >= len(fuses) {
+			return false, errors.Errorf("fuse %s is not supported by this Electron version (wire has %d fuses)", name, len(fuses))
+		}
+		if fuses[index] == fuseRemoved {
+			return false, errors.Errorf("fuse %s is removed in this Electron version", name)
+		}
+
+		state := byte(fuseDisabled)
+		if config.Fuses[name] {
+			state = fuseEnabled
+		}
+		if fuses[index] != state {
+			fuses[index] = state
+			isChanged = true
+		}
+	}
+	return isChanged, nil
+}
+
+func describeFuses(fuses []byte) []Fuse {
+	result := make([]Fuse, 0, len(fuses))
+	for index, value := range fuses {
+		fuse := Fuse{Name: fuseName(index)}
+		switch value {
+		case fuseEnabled:
+			fuse.State = "enabled"
+		case fuseDisabled:
+			fuse.State = "disabled"
+		case fuseRemoved:
+			fuse.State = "removed"
+		default:
+			fuse.State = strconv.Itoa(int(value))
+		}
+		result = append(result, fuse)
+	}
+	return result
+}
+
+// Electron Framework binary for app bundle, symlinks are resolved to not replace symlink by file
+func resolveFuseBinary(binary string) (string, error) {
+	info, err := os.Stat(binary)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	file := binary
+	if info.IsDir() {
+		file = filepath.Join(binary, "Contents", "Frameworks", "Electron Framework.framework", "Electron Framework")
+	}
+
+	file, err = filepath.EvalSymlinks(file)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return file, nil
+}
+
+// name or index (FuseV1Options value, fuses not known by name are accepted only by index)
+func fuseIndex(name string) int {
+	for index, fuseName := range fuseNames {
+		if fuseName == name {
+			return index
+		}
+	}
+
+	index, err := strconv.Atoi(name)
+	if err != nil || index < 0 || strconv.Itoa(index) != name {
+		return -1
+	}
+	return index
+}
+
+func fuseName(index int) string {
+	if index < len(fuseNames) {
+		return fuseNames[index]
+	}
+	return strconv.Itoa(index)
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,91 @@
+package electron
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func createFuseBinary(fuses string) []byte {
+	data := []byte("binary prefix")
+	data = append(data, fuseSentinel...)
+	data = append(data, fuseWireVersion, byte(len(fuses)))
+	data = append(data, fuses...)
+	return append(data, "binary suffix"...)
+}
+
+func TestParseFusesConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	config, err := ParseFusesConfig([]byte(`{"version": "1", "runAsNode": false, "onlyLoadAppFromAsar": true, "enableCookieEncryption": null}`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config).To(Equal(&FusesConfig{Version: 1, Fuses: map[string]bool{"runAsNode": false, "onlyLoadAppFromAsar": true}}))
+
+	// keys of @electron/fuses config are FuseV1Options values
+	config, err = ParseFusesConfig([]byte(`{"version": 1, "0": false, "5": true, "9": true}`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Fuses).To(Equal(map[string]bool{"runAsNode": false, "onlyLoadAppFromAsar": true, "9": true}))
+
+	_, err = ParseFusesConfig([]byte(`{"version": 1, "-1": false}`))
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = ParseFusesConfig([]byte(`{"version": 2}`))
+	g.Expect(err).To(HaveOccurred())
+	_, err = ParseFusesConfig([]byte(`{"runAsNode": false}`))
+	g.Expect(err).To(HaveOccurred())
+	_, err = ParseFusesConfig([]byte(`{"version": 1, "runAsNodes": false}`))
+	g.Expect(err).To(MatchError(ContainSubstring(`unknown fuse "runAsNodes"`)))
+	_, err = ParseFusesConfig([]byte(`{"version": 1, "runAsNode": "false"}`))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestFlipFuses(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "fuses")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// universal binary has wire in every slice
+	file := filepath.Join(tmpDir, "electron")
+	wire := createFuseBinary("1010r")
+	g.Expect(ioutil.WriteFile(file, append(append([]byte{}, wire...), wire...), 0755)).To(Succeed())
+
+	result, err := FlipFuses(file, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.IsChanged).To(BeFalse())
+	g.Expect(result.Wires).To(HaveLen(2))
+	g.Expect(result.Wires[0].Fuses).To(Equal([]Fuse{
+		{Name: "runAsNode", State: "enabled"},
+		{Name: "enableCookieEncryption", State: "disabled"},
+		{Name: "enableNodeOptionsEnvironmentVariable", State: "enabled"},
+		{Name: "enableNodeCliInspectArguments", State: "disabled"},
+		{Name: "enableEmbeddedAsarIntegrityValidation", State: "removed"},
+	}))
+
+	result, err = FlipFuses(file, &FusesConfig{Version: 1, Fuses: map[string]bool{"runAsNode": false, "enableCookieEncryption": true}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.IsChanged).To(BeTrue())
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	expected := createFuseBinary("0110r")
+	g.Expect(data).To(Equal(append(append([]byte{}, expected...), expected...)))
+	info, err := os.Stat(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	// not supported by this version
+	_, err = FlipFuses(file, &FusesConfig{Version: 1, Fuses: map[string]bool{"onlyLoadAppFromAsar": true}})
+	g.Expect(err).To(MatchError(ContainSubstring("not supported")))
+	_, err = FlipFuses(file, &FusesConfig{Version: 1, Fuses: map[string]bool{"enableEmbeddedAsarIntegrityValidation": true}})
+	g.Expect(err).To(MatchError(ContainSubstring("removed")))
+	_, err = FlipFuses(file, &FusesConfig{Version: 1, Fuses: map[string]bool{"runAsNode": false}, IsStrict: true})
+	g.Expect(err).To(MatchError(ContainSubstring("enableCookieEncryption, enableNodeOptionsEnvironmentVariable, enableNodeCliInspectArguments")))
+
+	g.Expect(ioutil.WriteFile(file, []byte("not electron"), 0755)).To(Succeed())
+	_, err = FlipFuses(file, nil)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,218 @@
+package electron
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+const checksumFileName = "SHASUMS256.txt"
+
+// ElectronArtifact is the resolved Electron zip for (version, platform, arch)
+type ElectronArtifact struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Arch     string `json:"arch"`
+
+	Url         string `json:"url"`
+	ChecksumUrl string `json:"checksumUrl"`
+	FileName    string `json:"fileName"`
+	// versioned: <cache>/<version>/<fileName>
+	CacheFile string `json:"cacheFile"`
+	IsCached  bool   `json:"cached"`
+}
+
+var platformAliases = map[string]string{
+	"mac":     "darwin",
+	"macos":   "darwin",
+	"osx":     "darwin",
+	"win":     "win32",
+	"windows": "win32",
+}
+
+var archAliases = map[string]string{
+	"amd64":   "x64",
+	"x86_64":  "x64",
+	"386":     "ia32",
+	"x86":     "ia32",
+	"aarch64": "arm64",
+	"arm":     "armv7l",
+	"armhf":   "armv7l",
+	"armv7":   "armv7l",
+}
+
+func ConfigureResolveCommand(app *kingpin.Application) {
+	command := app.Command("resolve-electron", "Resolve Electron zip URL and cache location (result is written as JSON).")
+	jsonConfig := command.Flag("configuration", "").Short('c').Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		configs, err := parseConfig(jsonConfig)
+		if err != nil {
+			return err
+		}
+
+		result := make([]*ElectronArtifact, len(configs))
+		for index := range configs {
+			cacheDir, err := getCacheDir(&configs[index])
+			if err != nil {
+				return err
+			}
+
+			result[index], err = ResolveElectron(&configs[index], cacheDir)
+			if err != nil {
+				return err
+			}
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// normalize platform and arch names (node and go names are accepted)
+func (t *ElectronDownloadOptions) normalize() error {
+	t.Version = strings.TrimPrefix(t.Version, "v")
+	if t.Version == "" {
+		return errors.New("version not specified")
+	}
+	if t.Platform == "" {
+		return errors.New("platform not specified")
+	}
+	if t.Arch == "" {
+		return errors.New("arch not specified")
+	}
+
+	if platform, ok := platformAliases[t.Platform]; ok {
+		t.Platform = platform
+	}
+	if arch, ok := archAliases[t.Arch]; ok {
+		t.Arch = arch
+	}
+	return nil
+}
+
+func getCacheDir(config *ElectronDownloadOptions) (string, error) {
+	if config.CacheDir != "" {
+		return config.CacheDir, nil
+	}
+	return download.GetCacheDirectory("electron", "ELECTRON_CACHE", false)
+}
+
+// ResolveElectron normalizes config and returns URL and cache location of the zip
+func ResolveElectron(config *ElectronDownloadOptions, cacheDir string) (*ElectronArtifact, error) {
+	err := config.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	fileName := config.CustomFilename
+	if len(fileName) == 0 {
+		fileName = getFilename(config)
+	}
+
+	baseUrl := getBaseUrl(config) + getMiddleUrl(config) + "/"
+	result := &ElectronArtifact{
+		Version:     config.Version,
+		Platform:    config.Platform,
+		Arch:        config.Arch,
+		Url:         baseUrl + getUrlSuffix(config),
+		ChecksumUrl: baseUrl + checksumFileName,
+		FileName:    fileName,
+		CacheFile:   filepath.Join(cacheDir, config.Version, fileName),
+	}
+
+	for _, file := range []string{result.CacheFile, filepath.Join(cacheDir, fileName)} {
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+
+		if fileInfo.IsDir() {
+			return nil, errors.Errorf("file expected, but got dir: %s", file)
+		}
+		// cache created by previous versions is not versioned
+		result.CacheFile = file
+		result.IsCached = true
+		break
+	}
+	return result, nil
+}
+
+// downloaded file must be verified, if SHASUMS256.txt is not provided (custom mirrors and builds), skipChecksum must be set explicitly
+func getChecksum(artifact *ElectronArtifact, cacheDir string) (download.Checksum, error) {
+	checksumFile := filepath.Join(cacheDir, artifact.Version, checksumFileName)
+
+	_, err := os.Stat(checksumFile)
+	if os.IsNotExist(err) {
+		err = downloadChecksumFile(artifact.ChecksumUrl, checksumFile)
+	}
+	if err != nil {
+		return download.Checksum{}, errors.Wrapf(err, "cannot download checksums from %s (set skipChecksum to not verify %s)", artifact.ChecksumUrl, artifact.FileName)
+	}
+
+	checksums, err := readChecksumFile(checksumFile)
+	if err != nil {
+		return download.Checksum{}, errors.Wrapf(err, "cannot read checksums from %s", checksumFile)
+	}
+
+	checksum, ok := checksums[artifact.FileName]
+	if !ok {
+		return download.Checksum{}, errors.Errorf("checksum of %s not found in %s (set skipChecksum to not verify)", artifact.FileName, artifact.ChecksumUrl)
+	}
+	return download.Checksum{Sha256: checksum}, nil
+}
+
+func downloadChecksumFile(url string, checksumFile string) error {
+	dir := filepath.Dir(checksumFile)
+	err := fsutil.EnsureDir(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tempFile, err := util.TempFile(dir, ".txt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = download.NewDownloader().Download(url, tempFile, "")
+	if err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+
+	download.RenameToFinalFile(tempFile, checksumFile, log.Fields{"url": url})
+	return nil
+}
+
+// line format: <sha256 hex> *<file name> (binary mode) or <sha256 hex>  <file name>
+func readChecksumFile(file string) (map[string]string, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		result[strings.TrimPrefix(fields[1], "*")] = fields[0]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
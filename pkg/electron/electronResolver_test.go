@@ -0,0 +1,114 @@
+package electron
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func createElectronServer(zipContent []byte, checksums string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/1.2.3/electron-v1.2.3-linux-x64.zip", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write(zipContent)
+	})
+	mux.HandleFunc("/1.2.3/SHASUMS256.txt", func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(checksums))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestResolveElectronNormalizesPlatformAndArch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	config := &ElectronDownloadOptions{Version: "v4.0.0", Platform: "mac", Arch: "amd64", Mirror: "https://example.com/"}
+	artifact, err := ResolveElectron(config, "/cache")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(artifact.FileName).To(Equal("electron-v4.0.0-darwin-x64.zip"))
+	g.Expect(artifact.Url).To(Equal("https://example.com/4.0.0/electron-v4.0.0-darwin-x64.zip"))
+	g.Expect(artifact.ChecksumUrl).To(Equal("https://example.com/4.0.0/SHASUMS256.txt"))
+	g.Expect(artifact.CacheFile).To(Equal(filepath.Join("/cache", "4.0.0", "electron-v4.0.0-darwin-x64.zip")))
+	g.Expect(artifact.IsCached).To(BeFalse())
+
+	_, err = ResolveElectron(&ElectronDownloadOptions{Version: "4.0.0", Platform: "linux"}, "/cache")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDownloadElectronVerifiesChecksum(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	zipContent := []byte("not really a zip")
+	hash := sha256.Sum256(zipContent)
+	checksums := hex.EncodeToString(hash[:]) + " *electron-v1.2.3-linux-x64.zip\n" + hex.EncodeToString(make([]byte, 32)) + " *electron-v1.2.3-win32-x64.zip\n"
+	server := createElectronServer(zipContent, checksums)
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "electron")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(cacheDir)
+
+	config := ElectronDownloadOptions{Version: "1.2.3", Platform: "linux", Arch: "x64", Mirror: server.URL + "/", CacheDir: cacheDir}
+	result, err := downloadElectron([]ElectronDownloadOptions{config})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result[0]).To(Equal(filepath.Join(cacheDir, "1.2.3", "electron-v1.2.3-linux-x64.zip")))
+	g.Expect(ioutil.ReadFile(result[0])).To(Equal(zipContent))
+
+	artifact, err := ResolveElectron(&config, cacheDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(artifact.IsCached).To(BeTrue())
+}
+
+func TestDownloadElectronChecksumMismatch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	server := createElectronServer([]byte("corrupted"), hex.EncodeToString(make([]byte, 32))+" *electron-v1.2.3-linux-x64.zip\n")
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "electron")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(cacheDir)
+
+	_, err = downloadElectron([]ElectronDownloadOptions{{Version: "1.2.3", Platform: "linux", Arch: "x64", Mirror: server.URL + "/", CacheDir: cacheDir}})
+	g.Expect(err).To(MatchError(ContainSubstring("checksum mismatch")))
+	g.Expect(filepath.Join(cacheDir, "1.2.3", "electron-v1.2.3-linux-x64.zip")).NotTo(BeAnExistingFile())
+}
+
+func TestDownloadElectronChecksumNotFound(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	server := createElectronServer([]byte("not verified"), hex.EncodeToString(make([]byte, 32))+" *electron-v1.2.3-win32-x64.zip\n")
+	defer server.Close()
+
+	cacheDir, err := ioutil.TempDir("", "electron")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(cacheDir)
+
+	config := ElectronDownloadOptions{Version: "1.2.3", Platform: "linux", Arch: "x64", Mirror: server.URL + "/", CacheDir: cacheDir}
+	_, err = downloadElectron([]ElectronDownloadOptions{config})
+	g.Expect(err).To(MatchError(ContainSubstring("checksum of electron-v1.2.3-linux-x64.zip not found")))
+	g.Expect(filepath.Join(cacheDir, "1.2.3", "electron-v1.2.3-linux-x64.zip")).NotTo(BeAnExistingFile())
+
+	config.IsSkipChecksum = true
+	_, err = downloadElectron([]ElectronDownloadOptions{config})
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestReadChecksumFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	file := filepath.Join(t.TempDir(), checksumFileName)
+	g.Expect(ioutil.WriteFile(file, []byte("aaa *electron-v1.0.0-linux-x64.zip\nbbb  ffmpeg-v1.0.0-linux-x64.zip\n\ninvalid\n"), 0644)).NotTo(HaveOccurred())
+
+	checksums, err := readChecksumFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(checksums).To(Equal(map[string]string{
+		"electron-v1.0.0-linux-x64.zip": "aaa",
+		"ffmpeg-v1.0.0-linux-x64.zip":   "bbb",
+	}))
+}
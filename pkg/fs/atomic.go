@@ -0,0 +1,82 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+)
+
+const (
+	renameRetryCount   = 8
+	renameInitialDelay = 50 * time.Millisecond
+)
+
+// WriteFileAtomic writes data to temp file in the same dir and renames it to file, so, file is never left partially written (parent dir is created if needed)
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	return WriteFileAtomicWith(file, perm, func(writer *os.File) error {
+		_, err := writer.Write(data)
+		return errors.WithStack(err)
+	})
+}
+
+// WriteFileAtomicWith is the same as WriteFileAtomic, but content is written by the function (e.g. to stream or to patch already written data)
+func WriteFileAtomicWith(file string, perm os.FileMode, write func(writer *os.File) error) error {
+	dir := filepath.Dir(file)
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tempFile, err := ioutil.TempFile(dir, "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = write(tempFile)
+	if err == nil {
+		err = errors.WithStack(tempFile.Chmod(perm))
+	}
+	if err == nil {
+		err = errors.WithStack(tempFile.Sync())
+	}
+
+	closeErr := tempFile.Close()
+	if err == nil && closeErr != nil {
+		err = errors.WithStack(closeErr)
+	}
+	if err == nil {
+		err = RenameWithRetry(tempFile.Name(), file)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	return nil
+}
+
+// RenameWithRetry renames file and retries with exponential backoff if file is locked (on Windows antivirus and indexer open just written files)
+func RenameWithRetry(from string, to string) error {
+	delay := renameInitialDelay
+	for attempt := 1; ; attempt++ {
+		err := os.Rename(from, to)
+		if err == nil {
+			return nil
+		}
+		if attempt == renameRetryCount || !isLockError(err) {
+			return errors.WithStack(err)
+		}
+
+		log.WithFields(log.Fields{
+			"from":    from,
+			"to":      to,
+			"attempt": attempt,
+			"error":   err,
+		}).Debug("cannot rename, file is locked, retrying")
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,63 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "atomic")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	file := filepath.Join(tmpDir, "nested", "out.bin")
+	g.Expect(WriteFileAtomic(file, []byte("first"), 0755)).To(Succeed())
+	g.Expect(WriteFileAtomic(file, []byte("second"), 0644)).To(Succeed())
+
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("second"))
+	info, err := os.Stat(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+	// existing file is not modified and temp file is removed on error
+	err = WriteFileAtomicWith(file, 0644, func(writer *os.File) error {
+		_, err := writer.WriteString("partial")
+		g.Expect(err).NotTo(HaveOccurred())
+		return errors.New("failed")
+	})
+	g.Expect(err).To(HaveOccurred())
+	data, err = ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("second"))
+
+	files, err := ioutil.ReadDir(filepath.Dir(file))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(HaveLen(1))
+}
+
+func TestRenameWithRetry(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "atomic")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	from := filepath.Join(tmpDir, "from")
+	to := filepath.Join(tmpDir, "to")
+	g.Expect(ioutil.WriteFile(from, []byte("data"), 0644)).To(Succeed())
+	g.Expect(RenameWithRetry(from, to)).To(Succeed())
+	g.Expect(from).NotTo(BeAnExistingFile())
+	g.Expect(to).To(BeAnExistingFile())
+
+	// not a lock error, so, error is returned without retry
+	g.Expect(RenameWithRetry(from, to)).To(HaveOccurred())
+}
@@ -0,0 +1,27 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package fs
+
+// #include <stdlib.h>
+// #include <sys/clonefile.h>
+import "C"
+
+import (
+	"os"
+	"unsafe"
+)
+
+// APFS clonefile(2), destination file must not exist, mode and times are copied by the clonefile itself
+func cloneFile(from string, to string, mode os.FileMode) error {
+	cFrom := C.CString(from)
+	defer C.free(unsafe.Pointer(cFrom))
+	cTo := C.CString(to)
+	defer C.free(unsafe.Pointer(cTo))
+
+	result, err := C.clonefile(cFrom, cTo, C.CLONE_NOFOLLOW)
+	if result != 0 {
+		return err
+	}
+	return nil
+}
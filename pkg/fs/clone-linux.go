@@ -0,0 +1,43 @@
+//go:build linux
+// +build linux
+
+package fs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/develar/errors"
+)
+
+// FICLONE ioctl (btrfs, xfs, overlayfs over supported fs), see ioctl_ficlone(2)
+const ficlone = 0x40049409
+
+// destination file must not exist
+func cloneFile(from string, to string, mode os.FileMode) error {
+	sourceFile, err := os.Open(from)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer sourceFile.Close()
+
+	destinationFile, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, destinationFile.Fd(), ficlone, sourceFile.Fd())
+	if errno != 0 {
+		_ = destinationFile.Close()
+		_ = os.Remove(to)
+		return errno
+	}
+
+	// cannot use file mode on create because of umask
+	err = destinationFile.Chmod(mode.Perm())
+	if err != nil {
+		_ = destinationFile.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(destinationFile.Close())
+}
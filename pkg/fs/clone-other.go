@@ -0,0 +1,15 @@
+//go:build !linux && (!darwin || !cgo)
+// +build !linux
+// +build !darwin !cgo
+
+package fs
+
+import (
+	"os"
+
+	"github.com/develar/errors"
+)
+
+func cloneFile(from string, to string, mode os.FileMode) error {
+	return errors.New("copy-on-write clone is not supported on this platform")
+}
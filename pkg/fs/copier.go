@@ -1,20 +1,26 @@
 package fs
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"runtime"
 
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/trace"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
 )
 
 type FileCopier struct {
 	IsUseHardLinks bool
+	// copy-on-write clone (APFS clonefile on macOS, FICLONE on Linux), hard link (if enabled) or regular copy is used if not supported
+	IsUseReflink bool
+	// modification time of files and dirs (hard link shares it anyway)
+	IsPreserveTimes bool
 }
 
-// go doesn't provide native copy operation (CoW)
+// go doesn't provide native copy operation (CoW), see cloneFile
 func (t *FileCopier) copyDir(from string, to string) error {
 	fileNames, err := fsutil.ReadDirContent(from)
 	if err != nil {
@@ -41,6 +47,15 @@ func CopyUsingHardlink(from string, to string) error {
 	return fileCopier.CopyDirOrFile(from, to)
 }
 
+// CopyDir copies dir using copy-on-write clone if file system supports it, symlinks, permissions and modification times are preserved
+func CopyDir(from string, to string) error {
+	fileCopier := FileCopier{
+		IsUseReflink:    true,
+		IsPreserveTimes: true,
+	}
+	return fileCopier.CopyDirOrFile(from, to)
+}
+
 func CopyDirOrFile(from string, to string) error {
 	var fileCopier FileCopier
 	return fileCopier.CopyDirOrFile(from, to)
@@ -55,9 +70,14 @@ func (t *FileCopier) CopyDirOrFile(from string, to string) error {
 		"from":           from,
 		"to":             to,
 		"isUseHardLinks": t.IsUseHardLinks,
+		"isUseReflink":   t.IsUseReflink,
 	}).Debug("copy files")
 
-	err := t.copyDirOrFile(from, to, true)
+	_, span := trace.Start(context.Background(), "copy")
+	span.SetAttribute("from", from)
+	// deeply nested node_modules can exceed MAX_PATH on Windows
+	err := t.copyDirOrFile(LongPath(from), LongPath(to), true)
+	span.End(err)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -86,7 +106,11 @@ func (t *FileCopier) copyDirOrFile(from string, to string, isCreateParentDirs bo
 			return errors.WithStack(err)
 		}
 
-		return t.copyDir(from, to)
+		err = t.copyDir(from, to)
+		if err != nil {
+			return err
+		}
+		return t.preserveTimes(to, fromInfo)
 	}
 
 	if isCreateParentDirs {
@@ -115,6 +139,19 @@ func SetDirPermsIfNeed(dir string, mode os.FileMode) error {
 }
 
 func (t *FileCopier) CopyFile(from string, to string, isCreateParentDirs bool, fromInfo os.FileInfo) error {
+	if t.IsUseReflink {
+		err := cloneFile(from, to, fromInfo.Mode())
+		if err == nil {
+			return t.preserveTimes(to, fromInfo)
+		}
+
+		// existing file is overwritten by regular copy, it doesn't mean that clone is not supported
+		if !os.IsExist(errors.Cause(err)) {
+			t.IsUseReflink = false
+			log.WithError(err).WithField("from", from).WithField("to", to).Debug("cannot copy using clone")
+		}
+	}
+
 	if t.IsUseHardLinks {
 		err := os.Link(from, to)
 		if err == nil {
@@ -125,7 +162,18 @@ func (t *FileCopier) CopyFile(from string, to string, isCreateParentDirs bool, f
 		log.WithError(err).WithField("from", from).WithField("to", to).Debug("cannot copy using hard link")
 	}
 
-	return fsutil.CopyFile(from, to, fromInfo.Mode())
+	err := fsutil.CopyFile(from, to, fromInfo.Mode())
+	if err != nil {
+		return err
+	}
+	return t.preserveTimes(to, fromInfo)
+}
+
+func (t *FileCopier) preserveTimes(to string, fromInfo os.FileInfo) error {
+	if !t.IsPreserveTimes {
+		return nil
+	}
+	return errors.WithStack(os.Chtimes(to, fromInfo.ModTime(), fromInfo.ModTime()))
 }
 
 func (t *FileCopier) createSymlink(from string, to string) error {
@@ -135,7 +183,8 @@ func (t *FileCopier) createSymlink(from string, to string) error {
 	}
 
 	if filepath.IsAbs(link) {
-		link, err = filepath.Rel(filepath.Dir(from), link)
+		// from is in the extended-length form on Windows, so, link must be in the same form to compute relative path
+		link, err = filepath.Rel(filepath.Dir(from), LongPath(link))
 		if err != nil {
 			return errors.WithStack(err)
 		}
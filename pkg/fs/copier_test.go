@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCopyDir(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "copy-dir")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	from := filepath.Join(tmpDir, "from")
+	g.Expect(os.MkdirAll(filepath.Join(from, "sub"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(from, "sub", "file.txt"), []byte("hello"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(from, "tool"), []byte("#!/bin/sh"), 0755)).NotTo(HaveOccurred())
+	g.Expect(os.Symlink("sub/file.txt", filepath.Join(from, "link"))).NotTo(HaveOccurred())
+
+	modTime := time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC)
+	g.Expect(os.Chtimes(filepath.Join(from, "sub", "file.txt"), modTime, modTime)).NotTo(HaveOccurred())
+	g.Expect(os.Chtimes(filepath.Join(from, "sub"), modTime, modTime)).NotTo(HaveOccurred())
+
+	to := filepath.Join(tmpDir, "to")
+	g.Expect(CopyDir(from, to)).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(filepath.Join(to, "sub", "file.txt"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("hello"))
+
+	info, err := os.Stat(filepath.Join(to, "sub", "file.txt"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+	info, err = os.Stat(filepath.Join(to, "sub"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.ModTime().Equal(modTime)).To(BeTrue())
+
+	info, err = os.Stat(filepath.Join(to, "tool"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	link, err := os.Readlink(filepath.Join(to, "link"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(link).To(Equal("sub/file.txt"))
+}
@@ -0,0 +1,187 @@
+package fs
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// DirHash is tree hash of a directory, the same for the same content regardless of location, timestamps and order of directory listing
+type DirHash struct {
+	Dir    string `json:"dir"`
+	Digest string `json:"digest"`
+	// number and total size of regular files
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+}
+
+type dirHashEntry struct {
+	name string
+	mode os.FileMode
+	size int64
+	path string
+
+	children []*dirHashEntry
+	// content hash for file, target for symlink, hash of children records for dir
+	digest []byte
+}
+
+func ConfigureHashDirCommand(app *kingpin.Application) {
+	command := app.Command("hash-dir", "Compute tree hash of directories (paths, modes, symlink targets and file contents) to skip packaging steps if input is not changed.")
+	algorithm := command.Flag("algorithm", "The hash algorithm.").Short('a').Default("sha512").Enum("sha256", "sha512", "blake2b")
+	encoding := command.Flag("encoding", "The digest encoding.").Short('e').Default("base64").Enum("base64", "hex")
+	dirs := command.Arg("dirs", "The directories.").Required().Strings()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result := make([]DirHash, 0, len(*dirs))
+		for _, dir := range *dirs {
+			dirHash, err := HashDir(dir, HashOptions{Algorithm: *algorithm, Encoding: *encoding})
+			if err != nil {
+				return err
+			}
+			result = append(result, *dirHash)
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// HashDir computes Merkle tree hash of dir: file contents are hashed in parallel and every dir hash covers sorted records (type, permissions, name and hash) of its children.
+// Name, mode and timestamps of the dir itself are not included. Symlinks are not followed, target is hashed.
+func HashDir(dir string, options HashOptions) (*DirHash, error) {
+	newHash, err := getHashFactory(options.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	encode := base64.StdEncoding.EncodeToString
+	switch options.Encoding {
+	case "", "base64":
+	case "hex":
+		encode = hex.EncodeToString
+	default:
+		return nil, errors.Errorf("unknown digest encoding %q", options.Encoding)
+	}
+
+	root, files, err := collectDirHashEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DirHash{Dir: dir, Files: len(files)}
+	reporter := progress.Start("hash", dir, int64(len(files)))
+	err = progress.MapAsync(reporter, len(files), func(taskIndex int) (func() error, error) {
+		entry := files[taskIndex]
+		return func() error {
+			digest, _, err := hashFile(entry.path, newHash())
+			if err != nil {
+				return err
+			}
+			entry.digest = digest
+			return nil
+		}, nil
+	})
+	reporter.Finish(err)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range files {
+		result.Size += entry.size
+	}
+	result.Digest = encode(computeDirDigest(root, newHash))
+	return result, nil
+}
+
+func collectDirHashEntries(dir string) (*dirHashEntry, []*dirHashEntry, error) {
+	// walked paths are cleaned (joined), so, parent is not found by unclean root path (trailing slash, ./ prefix)
+	dir = filepath.Clean(dir)
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	if !info.IsDir() {
+		return nil, nil, errors.Errorf("%s is not a directory", dir)
+	}
+
+	var mutex sync.Mutex
+	var root *dirHashEntry
+	pathToDir := make(map[string]*dirHashEntry)
+	var files []*dirHashEntry
+	err = Walk(dir, 0, func(path string, info os.FileInfo) error {
+		entry := &dirHashEntry{name: info.Name(), mode: info.Mode(), path: path}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			// separators are normalized, so, the same tree has the same hash on Windows
+			entry.digest = []byte(filepath.ToSlash(target))
+		case info.Mode().IsRegular():
+			entry.size = info.Size()
+		case !info.IsDir():
+			return errors.Errorf("%s: unsupported file type %s", path, info.Mode().Type())
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if info.Mode().IsRegular() {
+			files = append(files, entry)
+		}
+		if info.IsDir() {
+			pathToDir[path] = entry
+		}
+
+		if root == nil {
+			root = entry
+		} else {
+			// walk func of the parent is always completed before children
+			parent := pathToDir[filepath.Dir(path)]
+			parent.children = append(parent.children, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, files, nil
+}
+
+func computeDirDigest(dir *dirHashEntry, newHash func() hash.Hash) []byte {
+	sort.Slice(dir.children, func(i, j int) bool {
+		return dir.children[i].name < dir.children[j].name
+	})
+
+	hasher := newHash()
+	for _, child := range dir.children {
+		var entryType byte
+		var digest []byte
+		switch {
+		case child.mode.IsDir():
+			entryType = 'd'
+			digest = computeDirDigest(child, newHash)
+		case child.mode&os.ModeSymlink != 0:
+			entryType = 'l'
+			digest = child.digest
+		default:
+			entryType = 'f'
+			digest = child.digest
+		}
+
+		// name cannot contain NUL, so, records are not ambiguous
+		_, _ = fmt.Fprintf(hasher, "%c %o %d %s\x00", entryType, child.mode.Perm(), len(digest), child.name)
+		_, _ = hasher.Write(digest)
+	}
+	return hasher.Sum(nil)
+}
@@ -0,0 +1,89 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestHashDir(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "hash-dir")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	createTree := func(dir string) {
+		g.Expect(os.MkdirAll(filepath.Join(dir, "nested", "empty"), 0755)).To(Succeed())
+		g.Expect(ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("abc"), 0644)).To(Succeed())
+		g.Expect(ioutil.WriteFile(filepath.Join(dir, "nested", "b.txt"), []byte("hello"), 0644)).To(Succeed())
+		if runtime.GOOS != "windows" {
+			g.Expect(os.Symlink("nested/b.txt", filepath.Join(dir, "link"))).To(Succeed())
+		}
+	}
+
+	dir1 := filepath.Join(tmpDir, "dir1")
+	dir2 := filepath.Join(tmpDir, "dir2")
+	createTree(dir1)
+	createTree(dir2)
+
+	hash1, err := HashDir(dir1, HashOptions{Algorithm: "sha256", Encoding: "hex"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hash1.Files).To(Equal(2))
+	g.Expect(hash1.Size).To(Equal(int64(8)))
+	g.Expect(hash1.Digest).To(HaveLen(64))
+
+	// location of the dir is not included
+	hash2, err := HashDir(dir2, HashOptions{Algorithm: "sha256", Encoding: "hex"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hash2.Digest).To(Equal(hash1.Digest))
+
+	// unclean path of the same dir
+	hash, err := HashDir(dir1+string(os.PathSeparator), HashOptions{Algorithm: "sha256", Encoding: "hex"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hash.Digest).To(Equal(hash1.Digest))
+
+	workingDir, err := os.Getwd()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.Chdir(tmpDir)).To(Succeed())
+	hash, err = HashDir("."+string(os.PathSeparator)+"dir1", HashOptions{Algorithm: "sha256", Encoding: "hex"})
+	g.Expect(os.Chdir(workingDir)).To(Succeed())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hash.Digest).To(Equal(hash1.Digest))
+
+	expectChanged := func() {
+		hash, err := HashDir(dir2, HashOptions{Algorithm: "sha256", Encoding: "hex"})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(hash.Digest).NotTo(Equal(hash1.Digest))
+		g.Expect(hash.Digest).NotTo(Equal(hash2.Digest))
+		hash2 = hash
+	}
+
+	// content
+	g.Expect(ioutil.WriteFile(filepath.Join(dir2, "nested", "b.txt"), []byte("hello!"), 0644)).To(Succeed())
+	expectChanged()
+
+	// empty dir
+	g.Expect(os.Mkdir(filepath.Join(dir2, "nested", "empty", "new"), 0755)).To(Succeed())
+	expectChanged()
+
+	// file moved to another dir
+	g.Expect(os.Rename(filepath.Join(dir2, "a.txt"), filepath.Join(dir2, "nested", "a.txt"))).To(Succeed())
+	expectChanged()
+
+	if runtime.GOOS != "windows" {
+		g.Expect(os.Chmod(filepath.Join(dir2, "nested", "a.txt"), 0755)).To(Succeed())
+		expectChanged()
+
+		g.Expect(os.Remove(filepath.Join(dir2, "link"))).To(Succeed())
+		g.Expect(os.Symlink("nested/a.txt", filepath.Join(dir2, "link"))).To(Succeed())
+		expectChanged()
+	}
+
+	_, err = HashDir(filepath.Join(dir1, "a.txt"), HashOptions{})
+	g.Expect(err).To(HaveOccurred())
+}
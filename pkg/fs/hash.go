@@ -0,0 +1,169 @@
+package fs
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/minio/blake2b-simd"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256":  sha256.New,
+	"sha512":  sha512.New,
+	"blake2b": blake2b.New512,
+}
+
+// FileHash is digest of a file, file is the path as specified or joined with the directory path in recursive mode
+type FileHash struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+type HashOptions struct {
+	// sha256, sha512 (default) or blake2b (512-bit)
+	Algorithm string
+	// base64 (default) or hex
+	Encoding string
+	// hash all files in the directory (symlinks are not followed), otherwise directory is an error
+	IsRecursive bool
+}
+
+func ConfigureHashCommand(app *kingpin.Application) {
+	command := app.Command("hash", "Compute digests of files (JSON array of file, size and digest).")
+	algorithm := command.Flag("algorithm", "The hash algorithm.").Short('a').Default("sha512").Enum("sha256", "sha512", "blake2b")
+	encoding := command.Flag("encoding", "The digest encoding.").Short('e').Default("base64").Enum("base64", "hex")
+	isRecursive := command.Flag("recursive", "Hash all files in directories recursively.").Short('r').Bool()
+	files := command.Arg("files", "The files or directories (with --recursive).").Required().Strings()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := HashFiles(*files, HashOptions{Algorithm: *algorithm, Encoding: *encoding, IsRecursive: *isRecursive})
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// HashFiles computes digests in parallel, result is sorted by file path
+func HashFiles(paths []string, options HashOptions) ([]FileHash, error) {
+	newHash, err := getHashFactory(options.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	encode := hex.EncodeToString
+	switch options.Encoding {
+	case "", "base64":
+		encode = base64.StdEncoding.EncodeToString
+	case "hex":
+	default:
+		return nil, errors.Errorf("unknown digest encoding %q", options.Encoding)
+	}
+
+	files, err := collectFilesToHash(paths, options.IsRecursive)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]FileHash, len(files))
+	reporter := progress.Start("hash", "", int64(len(files)))
+	err = progress.MapAsync(reporter, len(files), func(taskIndex int) (func() error, error) {
+		file := files[taskIndex]
+		return func() error {
+			digest, size, err := hashFile(file, newHash())
+			if err != nil {
+				return err
+			}
+			result[taskIndex] = FileHash{File: file, Size: size, Digest: encode(digest)}
+			return nil
+		}, nil
+	})
+	reporter.Finish(err)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func getHashFactory(algorithm string) (func() hash.Hash, error) {
+	if len(algorithm) == 0 {
+		algorithm = "sha512"
+	}
+	newHash, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return nil, errors.Errorf("unknown hash algorithm %q", algorithm)
+	}
+	return newHash, nil
+}
+
+// HashFile returns digest of file using the specified algorithm
+func HashFile(file string, algorithm string) ([]byte, error) {
+	newHash, err := getHashFactory(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	digest, _, err := hashFile(file, newHash())
+	return digest, err
+}
+
+func hashFile(file string, hasher hash.Hash) ([]byte, int64, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	size, err := io.Copy(hasher, reader)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	return hasher.Sum(nil), size, nil
+}
+
+func collectFilesToHash(paths []string, isRecursive bool) ([]string, error) {
+	var result []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if !info.IsDir() {
+			result = append(result, path)
+			continue
+		}
+
+		if !isRecursive {
+			return nil, errors.Errorf("%s is a directory, use --recursive to hash all files in it", path)
+		}
+
+		var mutex sync.Mutex
+		err = Walk(path, 0, func(file string, info os.FileInfo) error {
+			if info.Mode().IsRegular() {
+				mutex.Lock()
+				result = append(result, file)
+				mutex.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestHashFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "hash")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(os.MkdirAll(filepath.Join(tmpDir, "dir", "nested"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "dir", "b.txt"), []byte("abc"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "dir", "nested", "a.txt"), nil, 0644)).NotTo(HaveOccurred())
+
+	file := filepath.Join(tmpDir, "dir", "b.txt")
+	result, err := HashFiles([]string{file}, HashOptions{Algorithm: "sha256", Encoding: "hex"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal([]FileHash{{File: file, Size: 3, Digest: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"}}))
+
+	result, err = HashFiles([]string{file}, HashOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result[0].Digest).To(Equal("3a81oZNherrMQXNJriBBMRLm+k6JqX6iCp7u5ktV05ohkpkqJ0/BqDa6PCOj/uu9RU1EI2Q86A4qmslPpUyknw=="))
+
+	result, err = HashFiles([]string{file}, HashOptions{Algorithm: "blake2b", Encoding: "hex"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result[0].Digest).To(HavePrefix("ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d1"))
+
+	_, err = HashFiles([]string{filepath.Join(tmpDir, "dir")}, HashOptions{})
+	g.Expect(err).To(HaveOccurred())
+
+	result, err = HashFiles([]string{filepath.Join(tmpDir, "dir")}, HashOptions{IsRecursive: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(HaveLen(2))
+	g.Expect(result[0].File).To(Equal(file))
+	g.Expect(result[1].File).To(Equal(filepath.Join(tmpDir, "dir", "nested", "a.txt")))
+	g.Expect(result[1].Size).To(Equal(int64(0)))
+
+	_, err = HashFiles([]string{file}, HashOptions{Algorithm: "md5"})
+	g.Expect(err).To(HaveOccurred())
+}
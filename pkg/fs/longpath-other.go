@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+// LongPath returns path as is (path length is limited only on Windows)
+func LongPath(path string) string {
+	return path
+}
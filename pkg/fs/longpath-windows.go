@@ -0,0 +1,34 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	longPathPrefix = `\\?\`
+	devicePrefix   = `\\.\`
+)
+
+// LongPath converts path to extended-length form (\\?\C:\... or \\?\UNC\server\share\...), so, MAX_PATH (260 chars) limit is not applied.
+// Prefix is added regardless of length, because paths joined to the result (e.g. deeply nested node_modules) can exceed the limit.
+// Relative path is resolved against the working dir (extended-length path must be absolute).
+func LongPath(path string) string {
+	if len(path) == 0 || strings.HasPrefix(path, longPathPrefix) || strings.HasPrefix(path, devicePrefix) {
+		return path
+	}
+
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	// filepath.Abs cleans path and converts slashes, "." and ".." are not resolved by the system for prefixed path
+	if strings.HasPrefix(absolutePath, `\\`) {
+		return longPathPrefix + `UNC\` + absolutePath[2:]
+	}
+	return longPathPrefix + absolutePath
+}
@@ -0,0 +1,26 @@
+package fs
+
+import (
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLongPath(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	if runtime.GOOS != "windows" {
+		g.Expect(LongPath("/foo/bar")).To(Equal("/foo/bar"))
+		g.Expect(LongPath("foo")).To(Equal("foo"))
+		return
+	}
+
+	g.Expect(LongPath(`C:\foo\..\bar`)).To(Equal(`\\?\C:\bar`))
+	g.Expect(LongPath(`C:/foo/bar`)).To(Equal(`\\?\C:\foo\bar`))
+	g.Expect(LongPath(`\\server\share\foo`)).To(Equal(`\\?\UNC\server\share\foo`))
+	// already prefixed path is not modified
+	g.Expect(LongPath(`\\?\C:\foo`)).To(Equal(`\\?\C:\foo`))
+	g.Expect(LongPath(`\\.\pipe\foo`)).To(Equal(`\\.\pipe\foo`))
+	g.Expect(LongPath("")).To(Equal(""))
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package fs
+
+// files are not locked on rename on other platforms
+func isLockError(err error) bool {
+	return false
+}
@@ -0,0 +1,24 @@
+//go:build windows
+// +build windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+func isLockError(err error) bool {
+	if linkError, ok := err.(*os.LinkError); ok {
+		err = linkError.Err
+	}
+
+	errno, ok := err.(syscall.Errno)
+	return ok && (errno == errorAccessDenied || errno == errorSharingViolation || errno == errorLockViolation)
+}
@@ -0,0 +1,127 @@
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// WalkFunc is called for every file and dir, return filepath.SkipDir to skip children of dir.
+// Symlinks are not followed (info is result of Lstat).
+type WalkFunc func(path string, info os.FileInfo) error
+
+type walkTask struct {
+	path string
+	info os.FileInfo
+}
+
+type parallelWalker struct {
+	walkFn WalkFunc
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	queue []walkTask
+	// queued and in progress tasks
+	pendingCount int
+	err          error
+}
+
+// Walk calls walkFn for root and all its descendants using concurrency workers (runtime.NumCPU() if concurrency <= 0).
+// Order of siblings is not defined, but walkFn for dir is always completed before walkFn is called for any of its children.
+// The first error stops the walk and is returned.
+func Walk(root string, concurrency int, walkFn WalkFunc) error {
+	rootInfo, err := os.Lstat(root)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	walker := &parallelWalker{
+		walkFn:       walkFn,
+		queue:        []walkTask{{path: root, info: rootInfo}},
+		pendingCount: 1,
+	}
+	walker.cond = sync.NewCond(&walker.mutex)
+
+	var waitGroup sync.WaitGroup
+	waitGroup.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer waitGroup.Done()
+			walker.work()
+		}()
+	}
+	waitGroup.Wait()
+	return walker.err
+}
+
+func (t *parallelWalker) work() {
+	for {
+		t.mutex.Lock()
+		for len(t.queue) == 0 && t.pendingCount > 0 && t.err == nil {
+			t.cond.Wait()
+		}
+		if t.pendingCount == 0 || t.err != nil {
+			t.mutex.Unlock()
+			return
+		}
+
+		// LIFO - depth first, so, queue doesn't grow too much
+		task := t.queue[len(t.queue)-1]
+		t.queue = t.queue[:len(t.queue)-1]
+		t.mutex.Unlock()
+
+		children, err := t.visit(task)
+
+		t.mutex.Lock()
+		if err != nil {
+			if t.err == nil {
+				t.err = err
+			}
+		} else {
+			t.queue = append(t.queue, children...)
+			t.pendingCount += len(children)
+		}
+		t.pendingCount--
+		t.cond.Broadcast()
+		t.mutex.Unlock()
+	}
+}
+
+func (t *parallelWalker) visit(task walkTask) ([]walkTask, error) {
+	err := t.walkFn(task.path, task.info)
+	if err != nil {
+		if err == filepath.SkipDir {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !task.info.IsDir() {
+		return nil, nil
+	}
+
+	names, err := fsutil.ReadDirContent(task.path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	children := make([]walkTask, 0, len(names))
+	for _, name := range names {
+		childPath := filepath.Join(task.path, name)
+		childInfo, err := os.Lstat(childPath)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		children = append(children, walkTask{path: childPath, info: childInfo})
+	}
+	return children, nil
+}
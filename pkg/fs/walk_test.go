@@ -0,0 +1,78 @@
+package fs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestWalkVisitsParentBeforeChildren(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "walk")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	expectedCount := 1
+	for i := 0; i < 10; i++ {
+		dir := filepath.Join(tmpDir, fmt.Sprintf("dir%d", i), "nested", "deep")
+		g.Expect(os.MkdirAll(dir, 0755)).NotTo(HaveOccurred())
+		expectedCount += 3
+		for j := 0; j < 10; j++ {
+			g.Expect(ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file%d", j)), nil, 0644)).NotTo(HaveOccurred())
+			expectedCount++
+		}
+	}
+	g.Expect(os.MkdirAll(filepath.Join(tmpDir, "skipped", "child"), 0755)).NotTo(HaveOccurred())
+	expectedCount++
+
+	var mutex sync.Mutex
+	pathToIndex := make(map[string]int)
+	err = Walk(tmpDir, 4, func(path string, info os.FileInfo) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if path != tmpDir {
+			_, isParentVisited := pathToIndex[filepath.Dir(path)]
+			if !isParentVisited {
+				return errors.Errorf("parent of %s is not visited", path)
+			}
+		}
+		pathToIndex[path] = len(pathToIndex)
+
+		if info.Name() == "skipped" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pathToIndex).To(HaveLen(expectedCount))
+	g.Expect(pathToIndex).NotTo(HaveKey(filepath.Join(tmpDir, "skipped", "child")))
+}
+
+func TestWalkReturnsError(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "walk")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	for i := 0; i < 100; i++ {
+		g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%d", i)), nil, 0644)).NotTo(HaveOccurred())
+	}
+
+	expectedError := errors.New("test")
+	err = Walk(tmpDir, 4, func(path string, info os.FileInfo) error {
+		if info.Name() == "file42" {
+			return expectedError
+		}
+		return nil
+	})
+	g.Expect(err).To(Equal(expectedError))
+}
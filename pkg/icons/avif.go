@@ -0,0 +1,67 @@
+package icons
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// ISO BMFF ftyp major brands of AVIF image and image sequence
+var avifBrands = [][]byte{[]byte("avif"), []byte("avis")}
+
+func isAvif(header []byte) bool {
+	if len(header) < 12 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+
+	brand := header[8:12]
+	for _, avifBrand := range avifBrands {
+		if bytes.Equal(brand, avifBrand) {
+			return true
+		}
+	}
+	return false
+}
+
+// golang doesn't support AVIF, so, avifdec (libavif) is used to convert to PNG (as opj_decompress is used for JPEG 2000)
+func decodeAvif(file string) (image.Image, error) {
+	avifDec := util.GetEnvOrDefault("AVIFDEC_PATH", "avifdec")
+	_, err := exec.LookPath(avifDec)
+	if err != nil {
+		return nil, errors.WithStack(&ImageFormatError{file, "ERR_ICON_AVIF_NOT_SUPPORTED"})
+	}
+
+	tempDir, err := util.TempDir("", ".avif")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	pngFile := filepath.Join(tempDir, "image.png")
+	_, err = util.Execute(exec.Command(avifDec, file, pngFile), "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	reader, err := os.Open(pngFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return DecodeImageAndClose(reader, reader)
+}
+
+func decodeAvifConfig(file string) (*image.Config, error) {
+	result, err := decodeAvif(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bounds := result.Bounds()
+	return &image.Config{ColorModel: result.ColorModel(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
@@ -0,0 +1,31 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+// hex (#fff, #ffffff), rgb() or CSS color name, the same as in SVG; empty value means no flattening
+func parseBackground(value string) (*color.NRGBA, error) {
+	if len(value) == 0 {
+		return nil, nil
+	}
+
+	result, ok := parseColor(value)
+	if !ok {
+		return nil, errors.Errorf("invalid background color %q", value)
+	}
+	if result.A != 0xff {
+		return nil, errors.Errorf("background color %q must be opaque", value)
+	}
+	return &result, nil
+}
+
+// semi-transparent pixels are blended with the background, so, edges do not get black halo in formats without alpha
+func flattenOnBackground(img image.Image, background color.NRGBA) *image.NRGBA {
+	bounds := img.Bounds()
+	return imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), background), img, image.Pt(0, 0), 1)
+}
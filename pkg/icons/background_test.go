@@ -0,0 +1,66 @@
+package icons
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseBackground(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	background, err := parseBackground("")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(background).To(BeNil())
+
+	background, err = parseBackground("#fff")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*background).To(Equal(color.NRGBA{R: 255, G: 255, B: 255, A: 255}))
+
+	background, err = parseBackground("navy")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*background).To(Equal(color.NRGBA{B: 128, A: 255}))
+
+	_, err = parseBackground("#ffffff80")
+	g.Expect(err).To(HaveOccurred())
+	_, err = parseBackground("not a color")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestConvertIconWithBackground(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-background")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	source := createImageWithContent(256, image.Rect(64, 64, 192, 192))
+	// semi-transparent edge is blended with background, not with black
+	source.SetNRGBA(63, 128, color.NRGBA{R: 255, A: 128})
+	g.Expect(SaveImage(source, filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+
+	flattened := flattenOnBackground(source, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	g.Expect(flattened.NRGBAAt(0, 0)).To(Equal(color.NRGBA{R: 255, G: 255, B: 255, A: 255}))
+	g.Expect(flattened.NRGBAAt(63, 128)).To(Equal(color.NRGBA{R: 255, G: 127, B: 127, A: 255}))
+	g.Expect(flattened.NRGBAAt(128, 128)).To(Equal(color.NRGBA{R: 255, A: 255}))
+
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "ico",
+		OutputDir:       filepath.Join(tmpDir, "out"),
+		IcoOptions:      IcoOptions{IsBmpOnly: true},
+		Background:      "white",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	img, err := LoadImage(result.Icons[0].File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(color.NRGBAModel.Convert(img.At(0, 0))).To(Equal(color.NRGBA{R: 255, G: 255, B: 255, A: 255}))
+}
@@ -0,0 +1,107 @@
+package icons
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+const badgeManifestFileName = "badges.json"
+
+// logical sizes of Windows taskbar overlay and badge icons at 100% scale
+var badgeSizes = []int{16, 20, 24, 30, 36, 40}
+
+// display scale factors (percent)
+var badgeScales = []int{100, 125, 150, 200}
+
+// 40px at 200%
+const maxBadgePixelSize = 80
+
+// BadgeIconInfo is an entry of badges.json manifest written next to badge icons
+type BadgeIconInfo struct {
+	// relative to the output dir
+	File string `json:"file"`
+	// logical size at 100% scale
+	Size int `json:"size"`
+	// percent
+	Scale     int `json:"scale"`
+	PixelSize int `json:"pixelSize"`
+}
+
+type badgeManifest struct {
+	Icons []BadgeIconInfo `json:"icons"`
+}
+
+// <name>-<size>.scale-<scale>.png, ordered by size and then by scale
+func computeBadgeIcons(iconName string) []BadgeIconInfo {
+	if len(iconName) == 0 {
+		iconName = "badge"
+	}
+
+	var result []BadgeIconInfo
+	for _, size := range badgeSizes {
+		for _, scale := range badgeScales {
+			result = append(result, BadgeIconInfo{
+				File:  fmt.Sprintf("%s-%d.scale-%d.png", iconName, size, scale),
+				Size:  size,
+				Scale: scale,
+				// rounded, 30 at 125% is 38
+				PixelSize: (size*scale + 50) / 100,
+			})
+		}
+	}
+	return result
+}
+
+// distinct sizes in pixels, sorted
+func badgePixelSizes() []int {
+	isAdded := make(map[int]bool)
+	var result []int
+	for _, badge := range computeBadgeIcons("") {
+		if !isAdded[badge.PixelSize] {
+			isAdded[badge.PixelSize] = true
+			result = append(result, badge.PixelSize)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
+
+func convertToBadges(inputInfo *InputFileInfo, sourceFile string, outDir string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	err := configureInputInfoFromSingleFile(sourceFile, false, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	badges := computeBadgeIcons(configuration.IconName)
+	result := make([]IconInfo, len(badges))
+	err = util.MapAsync(len(badges), func(taskIndex int) (func() error, error) {
+		badge := badges[taskIndex]
+		result[taskIndex] = IconInfo{File: filepath.Join(outDir, badge.File), Size: badge.PixelSize}
+		return func() error {
+			img, err := inputInfo.resizeMaxImage(inputInfo.maxImage, badge.PixelSize)
+			if err != nil {
+				return err
+			}
+			return SaveImage(img, result[taskIndex].File, PNG)
+		}, nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data, err := json.MarshalIndent(badgeManifest{Icons: badges}, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = fs.WriteFileAtomic(filepath.Join(outDir, badgeManifestFileName), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
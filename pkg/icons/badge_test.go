@@ -0,0 +1,59 @@
+package icons
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestComputeBadgeIcons(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	badges := computeBadgeIcons("")
+	g.Expect(badges).To(HaveLen(len(badgeSizes) * len(badgeScales)))
+	g.Expect(badges[0]).To(Equal(BadgeIconInfo{File: "badge-16.scale-100.png", Size: 16, Scale: 100, PixelSize: 16}))
+	g.Expect(badges).To(ContainElement(BadgeIconInfo{File: "badge-30.scale-125.png", Size: 30, Scale: 125, PixelSize: 38}))
+	g.Expect(badges[len(badges)-1].PixelSize).To(Equal(maxBadgePixelSize))
+
+	g.Expect(computeBadgeIcons("overlay")[1].File).To(Equal("overlay-16.scale-125.png"))
+	g.Expect(badgePixelSizes()).To(Equal([]int{16, 20, 24, 25, 30, 32, 36, 38, 40, 45, 48, 50, 54, 60, 72, 80}))
+}
+
+func TestConvertToBadges(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-badge")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 128, 128)), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+
+	outDir := filepath.Join(tmpDir, "out")
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "badge",
+		OutputDir:       outDir,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Icons).To(HaveLen(len(badgeSizes) * len(badgeScales)))
+
+	data, err := ioutil.ReadFile(filepath.Join(outDir, badgeManifestFileName))
+	g.Expect(err).NotTo(HaveOccurred())
+	var manifest badgeManifest
+	g.Expect(json.Unmarshal(data, &manifest)).To(Succeed())
+	g.Expect(manifest.Icons).To(Equal(computeBadgeIcons("")))
+
+	icons := withoutIconMetadata(result.Icons)
+	for index, badge := range manifest.Icons {
+		g.Expect(icons[index]).To(Equal(IconInfo{File: filepath.Join(outDir, badge.File), Size: badge.PixelSize}))
+		g.Expect(readSourceSize(result.Icons[index].File)).To(Equal(badge.PixelSize))
+	}
+}
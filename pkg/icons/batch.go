@@ -0,0 +1,217 @@
+package icons
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// IconBatchJob is the same as icon command flags
+type IconBatchJob struct {
+	Sources         []string `json:"sources"`
+	FallbackSources []string `json:"fallbackSources,omitempty"`
+	Roots           []string `json:"roots,omitempty"`
+
+	Format string `json:"format"`
+	Out    string `json:"out,omitempty"`
+	Output string `json:"output,omitempty"`
+
+	MinSize       int           `json:"minSize,omitempty"`
+	IsUpscale     bool          `json:"upscale,omitempty"`
+	IsPadToSquare bool          `json:"padToSquare,omitempty"`
+	IsTrim        bool          `json:"trim,omitempty"`
+	Padding       float64       `json:"padding,omitempty"`
+	Background    string        `json:"background,omitempty"`
+	Mask          string        `json:"mask,omitempty"`
+	IsMaskShadow  bool          `json:"maskShadow,omitempty"`
+	IsLegacy      bool          `json:"legacy,omitempty"`
+	IsStrict      bool          `json:"strict,omitempty"`
+	Ico           IcoOptions    `json:"ico,omitempty"`
+	Resize        ResizeOptions `json:"resize,omitempty"`
+
+	Layout     string          `json:"layout,omitempty"`
+	Preset     string          `json:"preset,omitempty"`
+	SizeConfig string          `json:"sizeConfig,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Template   TemplateOptions `json:"template,omitempty"`
+}
+
+// IconBatchResult is reported for every job in the order of jobs, error is set if job failed because of the source image
+type IconBatchResult struct {
+	*IconConvertResult
+	Error *MisConfigurationError `json:"error,omitempty"`
+}
+
+// jobs are read from stdin as JSON array, results are written to stdout as JSON array (in the same order)
+func ConfigureBatchCommand(app *kingpin.Application) {
+	command := app.Command("icon-batch", "convert icons for several targets in one invocation (jobs are read from stdin as JSON array)")
+	command.Action(func(context *kingpin.ParseContext) error {
+		data, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var jobs []IconBatchJob
+		err = json.Unmarshal(data, &jobs)
+		if err != nil {
+			return errors.Wrap(err, "cannot parse icon batch jobs")
+		}
+
+		results, err := ConvertIconBatch(util.RootContext(), jobs)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(results)
+	})
+}
+
+// ConvertIconBatch converts jobs concurrently, the same source image is decoded only once
+func ConvertIconBatch(ctx context.Context, jobs []IconBatchJob) ([]IconBatchResult, error) {
+	requests := make([]*IconConvertRequest, len(jobs))
+	imageCache := &decodedImageCache{entries: make(map[string]*decodedImageEntry)}
+	for index, job := range jobs {
+		request, err := job.toRequest()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid icon batch job %d", index)
+		}
+		request.imageCache = imageCache
+		requests[index] = request
+	}
+
+	results := make([]IconBatchResult, len(jobs))
+	err := util.MapAsync(len(requests), func(taskIndex int) (func() error, error) {
+		return func() error {
+			result, err := ConvertIcon(ctx, requests[taskIndex])
+			if err != nil {
+				userError := toUserError(err)
+				if userError == nil {
+					return err
+				}
+				log.Debugf("%+v\n", err)
+				misConfigurationError := createMisConfigurationError(userError)
+				results[taskIndex].Error = &misConfigurationError
+				return nil
+			}
+			results[taskIndex].IconConvertResult = result
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (t *IconBatchJob) toRequest() (*IconConvertRequest, error) {
+	switch t.Format {
+	case "icns", "ico", "set", "template", "badge", "favicon":
+	default:
+		return nil, errors.Errorf("unknown output format %q", t.Format)
+	}
+	if len(t.Out) == 0 && len(t.Output) == 0 {
+		return nil, errors.New("output directory (out) or output file (output) must be specified")
+	}
+
+	err := t.Resize.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = t.Template.validate()
+	if err != nil {
+		return nil, err
+	}
+	err = validatePadding(t.Padding)
+	if err != nil {
+		return nil, err
+	}
+	_, err = parseBackground(t.Background)
+	if err != nil {
+		return nil, err
+	}
+	err = validateMask(t.Mask)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := t.Layout
+	if len(layout) == 0 {
+		layout = "flat"
+	}
+	err = validatePreset(t.Preset, t.Format, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	sources, fallbackSources, roots := t.Sources, t.FallbackSources, t.Roots
+	return &IconConvertRequest{
+		Sources:         &sources,
+		FallbackSources: &fallbackSources,
+		Roots:           &roots,
+		OutputFormat:    t.Format,
+		OutputDir:       t.Out,
+		OutputFile:      t.Output,
+		MinSize:         t.MinSize,
+		IsUpscale:       t.IsUpscale,
+		IsPadToSquare:   t.IsPadToSquare,
+		IsTrim:          t.IsTrim,
+		Padding:         t.Padding,
+		Background:      t.Background,
+		Mask:            t.Mask,
+		IsMaskShadow:    t.IsMaskShadow,
+		IsLegacy:        t.IsLegacy,
+		IsStrict:        t.IsStrict,
+		IcoOptions:      t.Ico,
+		ResizeOptions:   t.Resize,
+		Layout:          layout,
+		Preset:          t.Preset,
+		SizeConfig:      t.SizeConfig,
+		IconName:        t.Name,
+		TemplateOptions: t.Template,
+	}, nil
+}
+
+// decoded source images shared by batch jobs, images must be treated as read-only
+type decodedImageCache struct {
+	mutex   sync.Mutex
+	entries map[string]*decodedImageEntry
+}
+
+type decodedImageEntry struct {
+	once  sync.Once
+	image image.Image
+	err   error
+}
+
+// nil cache means no caching
+func (t *decodedImageCache) load(file string) (image.Image, error) {
+	if t == nil {
+		return LoadImage(file)
+	}
+
+	key, err := filepath.Abs(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	t.mutex.Lock()
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &decodedImageEntry{}
+		t.entries[key] = entry
+	}
+	t.mutex.Unlock()
+
+	entry.once.Do(func() {
+		entry.image, entry.err = LoadImage(file)
+	})
+	return entry.image, entry.err
+}
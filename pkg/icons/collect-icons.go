@@ -1,13 +1,17 @@
 package icons
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/alecthomas/kingpin"
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
 )
@@ -62,7 +66,7 @@ func CollectIcons(sourceDir string) ([]IconInfo, string, error) {
 			}
 		}
 
-		iconInfo := IconInfo{iconPath, size}
+		iconInfo := IconInfo{File: iconPath, Size: size}
 		sizeToFileName[size] = &iconInfo
 		result = append(result, iconInfo)
 	}
@@ -79,3 +83,105 @@ func CollectIcons(sourceDir string) ([]IconInfo, string, error) {
 	sortBySize(result)
 	return result, "", nil
 }
+
+type CollectIconsResult struct {
+	Icons    []IconInfo    `json:"icons"`
+	Warnings []IconWarning `json:"warnings"`
+}
+
+type IconWarning struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+func ConfigureCollectIconsCommand(app *kingpin.Application) {
+	command := app.Command("collect-icons", "collect and validate icons in the directory")
+	sourceDir := command.Flag("source", "icon directory").Short('s').Required().String()
+	minSize := command.Flag("min-size", "minimal icon size").Default("16").Int()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := CollectAndValidateIcons(*sourceDir, *minSize)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// unlike CollectIcons, size is determined by image itself, not by file name, and every file is validated (format, square, min size)
+func CollectAndValidateIcons(sourceDir string, minSize int) (*CollectIconsResult, error) {
+	files, err := fsutil.ReadDirContent(sourceDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Errorf("icon directory %s doesn't exist", sourceDir)
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	sort.Strings(files)
+
+	result := &CollectIconsResult{
+		Icons:    []IconInfo{},
+		Warnings: []IconWarning{},
+	}
+	addWarning := func(file string, message string) {
+		log.WithField("file", file).Warn(message)
+		result.Warnings = append(result.Warnings, IconWarning{File: file, Message: message})
+	}
+
+	sizeToIndex := make(map[int]int)
+	for _, name := range files {
+		file := filepath.Join(sourceDir, name)
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if fileInfo.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if isSvgFile(file) || strings.HasSuffix(name, ".icns") || isIcoFile(file) {
+			addWarning(file, "container and vector formats are not supported as sized icons, skipped")
+			continue
+		}
+
+		config, err := DecodeImageConfig(file)
+		if err != nil {
+			if _, ok := errors.Cause(err).(*ImageFormatError); ok {
+				addWarning(file, "unsupported image format, skipped")
+				continue
+			}
+			return nil, errors.WithStack(err)
+		}
+
+		if config.Width != config.Height {
+			addWarning(file, fmt.Sprintf("image is not square (%dx%d), skipped", config.Width, config.Height))
+			continue
+		}
+
+		if config.Width < minSize {
+			addWarning(file, fmt.Sprintf("image is smaller than %dx%d, skipped", minSize, minSize))
+			continue
+		}
+
+		existingIndex, exists := sizeToIndex[config.Width]
+		if exists {
+			existing := &result.Icons[existingIndex]
+			// 16x16.png vs 16x16-dev.png - select shorter name
+			if len(name) < len(filepath.Base(existing.File)) {
+				addWarning(existing.File, fmt.Sprintf("duplicated size %d, %s is used instead", config.Width, name))
+				existing.File = file
+			} else {
+				addWarning(file, fmt.Sprintf("duplicated size %d, %s is used instead", config.Width, filepath.Base(existing.File)))
+			}
+			continue
+		}
+
+		sizeToIndex[config.Width] = len(result.Icons)
+		result.Icons = append(result.Icons, IconInfo{File: file, Size: config.Width})
+	}
+
+	sortBySize(result.Icons)
+	return result, nil
+}
@@ -0,0 +1,402 @@
+package icons
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"io/ioutil"
+	"math"
+
+	"github.com/apex/log"
+	"github.com/disintegration/imaging"
+)
+
+// golang decoders ignore embedded color profiles, so, image in the wide gamut (Display P3, Adobe RGB) or with non-sRGB gamma looks washed out or too dark.
+// Only matrix/TRC RGB ICC profiles (what image editors embed into PNG and JPEG) and PNG gAMA are supported - pixels are converted to sRGB,
+// for other profiles (LUT based, CMYK) pixels are used as is. Output PNG files never contain a profile, so, sRGB is assumed by consumers.
+
+// sRGB primaries adapted to D50 (as in the sRGB ICC profile), columns are rXYZ, gXYZ and bXYZ
+var srgbToXyzD50 = [9]float64{
+	0.4360747, 0.3850649, 0.1430804,
+	0.2225045, 0.7168786, 0.0606169,
+	0.0139322, 0.0971045, 0.7141733,
+}
+
+// srgbEncodeTableSize entries to encode linear value to sRGB
+const srgbEncodeTableSize = 4096
+
+type colorProfile struct {
+	// linear value of every 8-bit channel value
+	trc [3][256]float64
+	// source linear RGB to linear sRGB
+	matrix [9]float64
+}
+
+// normalizeImage converts image to 8-bit non-premultiplied RGBA (imaging.Resize weights colors by alpha, so, Lanczos doesn't produce dark fringes)
+// and applies color profile (if any)
+func normalizeImage(img image.Image, profile *colorProfile) *image.NRGBA {
+	result, ok := img.(*image.NRGBA)
+	if !ok || result.Rect.Min != (image.Point{}) {
+		// CMYK, YCbCr, 16-bit and paletted images are converted to 8-bit sRGB (naive for CMYK without profile)
+		result = imaging.Clone(img)
+	}
+
+	if profile != nil {
+		profile.apply(result)
+	}
+	return result
+}
+
+func (t *colorProfile) apply(img *image.NRGBA) {
+	var encodeTable [srgbEncodeTableSize]uint8
+	for i := range encodeTable {
+		encodeTable[i] = uint8(math.Round(encodeSrgb(float64(i)/(srgbEncodeTableSize-1)) * 255))
+	}
+
+	m := t.matrix
+	pixels := img.Pix
+	for i := 0; i+3 < len(pixels); i += 4 {
+		r := t.trc[0][pixels[i]]
+		g := t.trc[1][pixels[i+1]]
+		b := t.trc[2][pixels[i+2]]
+		pixels[i] = encodeTable[toEncodeTableIndex(m[0]*r+m[1]*g+m[2]*b)]
+		pixels[i+1] = encodeTable[toEncodeTableIndex(m[3]*r+m[4]*g+m[5]*b)]
+		pixels[i+2] = encodeTable[toEncodeTableIndex(m[6]*r+m[7]*g+m[8]*b)]
+	}
+}
+
+func toEncodeTableIndex(value float64) int {
+	if value <= 0 {
+		return 0
+	}
+	if value >= 1 {
+		return srgbEncodeTableSize - 1
+	}
+	return int(value*(srgbEncodeTableSize-1) + 0.5)
+}
+
+func encodeSrgb(value float64) float64 {
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
+
+func decodeSrgb(value float64) float64 {
+	if value <= 0.04045 {
+		return value / 12.92
+	}
+	return math.Pow((value+0.055)/1.055, 2.4)
+}
+
+// returns nil if image is in sRGB (or profile is not supported)
+func readColorProfile(data []byte) *colorProfile {
+	switch {
+	case bytes.HasPrefix(data, pngHeader):
+		return readPngColorProfile(data)
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		iccData := readJpegIccProfile(data)
+		if iccData == nil {
+			return nil
+		}
+		return parseIccProfile(iccData)
+	default:
+		return nil
+	}
+}
+
+// chunks before IDAT: sRGB means image is in sRGB, iCCP has priority over gAMA
+func readPngColorProfile(data []byte) *colorProfile {
+	var gamma uint32
+	offset := len(pngHeader)
+	for offset+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		chunkStart := offset + 8
+		if length < 0 || chunkStart+length > len(data) || chunkType == "IDAT" {
+			break
+		}
+
+		chunk := data[chunkStart : chunkStart+length]
+		switch chunkType {
+		case "sRGB":
+			return nil
+
+		case "iCCP":
+			// profile name, null separator, compression method (0 - zlib), compressed profile
+			separator := bytes.IndexByte(chunk, 0)
+			if separator == -1 || separator+2 > len(chunk) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(chunk[separator+2:]))
+			if err != nil {
+				log.WithError(err).Debug("cannot read iCCP chunk")
+				return nil
+			}
+			iccData, err := ioutil.ReadAll(reader)
+			if err != nil {
+				log.WithError(err).Debug("cannot read iCCP chunk")
+				return nil
+			}
+			return parseIccProfile(iccData)
+
+		case "gAMA":
+			if length == 4 {
+				gamma = binary.BigEndian.Uint32(chunk)
+			}
+		}
+
+		// length, type, data and crc
+		offset = chunkStart + length + 4
+	}
+
+	// gAMA is gamma * 100000 (45455 for 1/2.2 that is considered as sRGB)
+	if gamma == 0 || (gamma > 44000 && gamma < 47000) {
+		return nil
+	}
+
+	profile := &colorProfile{matrix: identityMatrix()}
+	exponent := 100000 / float64(gamma)
+	for i := 0; i < 256; i++ {
+		value := math.Pow(float64(i)/255, exponent)
+		profile.trc[0][i], profile.trc[1][i], profile.trc[2][i] = value, value, value
+	}
+	return profile
+}
+
+// APP2 ICC_PROFILE segments before SOS, profile can be split into several segments
+func readJpegIccProfile(data []byte) []byte {
+	iccMarker := []byte("ICC_PROFILE\x00")
+	var segments [][]byte
+	offset := 2
+	for offset+4 <= len(data) && data[offset] == 0xff {
+		marker := data[offset+1]
+		// start of scan or end of image
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		segmentEnd := offset + 2 + length
+		if length < 2 || segmentEnd > len(data) {
+			break
+		}
+
+		segment := data[offset+4 : segmentEnd]
+		// segment sequence number (1-based) and count follow the marker
+		if marker == 0xe2 && bytes.HasPrefix(segment, iccMarker) && len(segment) > len(iccMarker)+2 {
+			index := int(segment[len(iccMarker)]) - 1
+			for len(segments) <= index {
+				segments = append(segments, nil)
+			}
+			if index >= 0 {
+				segments[index] = segment[len(iccMarker)+2:]
+			}
+		}
+		offset = segmentEnd
+	}
+
+	if len(segments) == 0 {
+		return nil
+	}
+	return bytes.Join(segments, nil)
+}
+
+func parseIccProfile(data []byte) *colorProfile {
+	if len(data) < 132 || string(data[16:20]) != "RGB " {
+		log.Debug("color profile is not RGB, ignored")
+		return nil
+	}
+
+	tags := make(map[string][]byte)
+	tagCount := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < tagCount && 132+12*(i+1) <= len(data); i++ {
+		entry := data[132+12*i:]
+		offset := int(binary.BigEndian.Uint32(entry[4:]))
+		size := int(binary.BigEndian.Uint32(entry[8:]))
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			continue
+		}
+		tags[string(entry[0:4])] = data[offset : offset+size]
+	}
+
+	profile := &colorProfile{}
+	var sourceMatrix [9]float64
+	for channel, name := range []string{"r", "g", "b"} {
+		xyz, isXyz := parseIccXyz(tags[name+"XYZ"])
+		isTrc := parseIccTrc(tags[name+"TRC"], &profile.trc[channel])
+		if !isXyz || !isTrc {
+			log.Debug("color profile is not matrix/TRC based, ignored")
+			return nil
+		}
+		sourceMatrix[channel] = xyz[0]
+		sourceMatrix[3+channel] = xyz[1]
+		sourceMatrix[6+channel] = xyz[2]
+	}
+
+	inverseSrgb, ok := invertMatrix(srgbToXyzD50)
+	if !ok {
+		return nil
+	}
+	profile.matrix = multiplyMatrix(inverseSrgb, sourceMatrix)
+
+	if profile.isSrgb() {
+		return nil
+	}
+	return profile
+}
+
+func (t *colorProfile) isSrgb() bool {
+	identity := identityMatrix()
+	for i, value := range t.matrix {
+		if math.Abs(value-identity[i]) > 0.002 {
+			return false
+		}
+	}
+	for channel := 0; channel < 3; channel++ {
+		for i := 0; i < 256; i++ {
+			if math.Abs(t.trc[channel][i]-decodeSrgb(float64(i)/255)) > 0.5/255 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseIccXyz(data []byte) ([3]float64, bool) {
+	var result [3]float64
+	if len(data) < 20 || string(data[0:4]) != "XYZ " {
+		return result, false
+	}
+	for i := range result {
+		result[i] = readS15Fixed16(data[8+4*i:])
+	}
+	return result, true
+}
+
+// curv (identity, gamma or table) and para (parametric functions 0-4)
+func parseIccTrc(data []byte, result *[256]float64) bool {
+	if len(data) < 12 {
+		return false
+	}
+
+	switch string(data[0:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(data[8:]))
+		if len(data) < 12+2*count {
+			return false
+		}
+		for i := range result {
+			x := float64(i) / 255
+			switch count {
+			case 0:
+				result[i] = x
+			case 1:
+				result[i] = math.Pow(x, float64(binary.BigEndian.Uint16(data[12:]))/256)
+			default:
+				position := x * float64(count-1)
+				index := int(position)
+				if index >= count-1 {
+					result[i] = float64(binary.BigEndian.Uint16(data[12+2*(count-1):])) / 65535
+					continue
+				}
+				fraction := position - float64(index)
+				low := float64(binary.BigEndian.Uint16(data[12+2*index:])) / 65535
+				high := float64(binary.BigEndian.Uint16(data[12+2*(index+1):])) / 65535
+				result[i] = low + (high-low)*fraction
+			}
+		}
+		return true
+
+	case "para":
+		functionType := int(binary.BigEndian.Uint16(data[8:]))
+		parameterCounts := []int{1, 3, 4, 5, 7}
+		if functionType >= len(parameterCounts) || len(data) < 12+4*parameterCounts[functionType] {
+			return false
+		}
+
+		// g, a, b, c, d, e, f
+		var p [7]float64
+		p[1] = 1
+		for i := 0; i < parameterCounts[functionType]; i++ {
+			p[i] = readS15Fixed16(data[12+4*i:])
+		}
+
+		for i := range result {
+			result[i] = evaluateParametricCurve(functionType, p, float64(i)/255)
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+func evaluateParametricCurve(functionType int, p [7]float64, x float64) float64 {
+	g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+	switch functionType {
+	case 0:
+		return math.Pow(x, g)
+	case 1:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g)
+		}
+		return 0
+	case 2:
+		if x >= -b/a {
+			return math.Pow(a*x+b, g) + c
+		}
+		return c
+	case 3:
+		if x >= d {
+			return math.Pow(a*x+b, g)
+		}
+		return c * x
+	default:
+		if x >= d {
+			return math.Pow(a*x+b, g) + e
+		}
+		return c*x + f
+	}
+}
+
+func readS15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+func identityMatrix() [9]float64 {
+	return [9]float64{1, 0, 0, 0, 1, 0, 0, 0, 1}
+}
+
+func multiplyMatrix(a [9]float64, b [9]float64) [9]float64 {
+	var result [9]float64
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			for i := 0; i < 3; i++ {
+				result[row*3+column] += a[row*3+i] * b[i*3+column]
+			}
+		}
+	}
+	return result
+}
+
+func invertMatrix(m [9]float64) ([9]float64, bool) {
+	determinant := m[0]*(m[4]*m[8]-m[5]*m[7]) - m[1]*(m[3]*m[8]-m[5]*m[6]) + m[2]*(m[3]*m[7]-m[4]*m[6])
+	if math.Abs(determinant) < 1e-12 {
+		return [9]float64{}, false
+	}
+
+	inverse := 1 / determinant
+	return [9]float64{
+		(m[4]*m[8] - m[5]*m[7]) * inverse,
+		(m[2]*m[7] - m[1]*m[8]) * inverse,
+		(m[1]*m[5] - m[2]*m[4]) * inverse,
+		(m[5]*m[6] - m[3]*m[8]) * inverse,
+		(m[0]*m[8] - m[2]*m[6]) * inverse,
+		(m[2]*m[3] - m[0]*m[5]) * inverse,
+		(m[3]*m[7] - m[4]*m[6]) * inverse,
+		(m[1]*m[6] - m[0]*m[7]) * inverse,
+		(m[0]*m[4] - m[1]*m[3]) * inverse,
+	}, true
+}
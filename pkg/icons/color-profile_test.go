@@ -0,0 +1,148 @@
+package icons
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestPngGammaIsConvertedToSrgb(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	gamma := make([]byte, 4)
+	// linear encoded pixels
+	binary.BigEndian.PutUint32(gamma, 100000)
+	result := loadPngWithChunk(g, "gAMA", gamma)
+	// linear 0.5 is 188 in sRGB
+	g.Expect(result.At(0, 0)).To(Equal(color.NRGBA{R: 188, G: 188, B: 188, A: 255}))
+}
+
+func TestPngIccProfileIsConvertedToSrgb(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// sRGB primaries with linear TRC
+	linearCurve := []byte{'c', 'u', 'r', 'v', 0, 0, 0, 0, 0, 0, 0, 1, 1, 0}
+	result := loadPngWithChunk(g, "iCCP", compressIccProfile(g, createIccProfile(linearCurve)))
+	g.Expect(result.At(0, 0)).To(Equal(color.NRGBA{R: 188, G: 188, B: 188, A: 255}))
+
+	// sRGB profile - pixels are not changed
+	srgbCurve := []byte{'p', 'a', 'r', 'a', 0, 0, 0, 0, 0, 3, 0, 0}
+	for _, value := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		srgbCurve = append(srgbCurve, toS15Fixed16(value)...)
+	}
+	result = loadPngWithChunk(g, "iCCP", compressIccProfile(g, createIccProfile(srgbCurve)))
+	g.Expect(result.At(0, 0)).To(Equal(color.NRGBA{R: 128, G: 128, B: 128, A: 255}))
+}
+
+func TestCmykIsNormalizedToNrgba(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	source := image.NewCMYK(image.Rect(5, 5, 7, 7))
+	source.Set(5, 5, color.CMYK{C: 255})
+	result := normalizeImage(source, nil)
+	g.Expect(result.Bounds()).To(Equal(image.Rect(0, 0, 2, 2)))
+	g.Expect(result.At(0, 0)).To(Equal(color.NRGBA{G: 255, B: 255, A: 255}))
+}
+
+func loadPngWithChunk(g *GomegaWithT, chunkType string, chunkData []byte) image.Image {
+	tmpDir, err := util.TempDir("", "color-profile")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	source := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	source.Set(0, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	var buffer bytes.Buffer
+	g.Expect(png.Encode(&buffer, source)).NotTo(HaveOccurred())
+
+	// insert chunk after IHDR (signature and 25 bytes of IHDR chunk)
+	data := buffer.Bytes()
+	chunk := make([]byte, 8, 12+len(chunkData))
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunkData)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, chunkData...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	chunk = append(chunk, crc...)
+
+	file := filepath.Join(tmpDir, "icon.png")
+	var fileData []byte
+	fileData = append(fileData, data[:33]...)
+	fileData = append(fileData, chunk...)
+	fileData = append(fileData, data[33:]...)
+	g.Expect(ioutil.WriteFile(file, fileData, 0644)).NotTo(HaveOccurred())
+
+	result, err := LoadImage(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	return result
+}
+
+// header, tag table (rXYZ, gXYZ, bXYZ and shared TRC for all channels)
+func createIccProfile(curve []byte) []byte {
+	header := make([]byte, 128)
+	copy(header[16:], "RGB ")
+	copy(header[36:], "acsp")
+
+	var tagData []byte
+	tagDataOffset := 128 + 4 + 12*6
+	var tagTable []byte
+	addTag := func(signature string, data []byte) {
+		entry := make([]byte, 12)
+		copy(entry, signature)
+		binary.BigEndian.PutUint32(entry[4:], uint32(tagDataOffset+len(tagData)))
+		binary.BigEndian.PutUint32(entry[8:], uint32(len(data)))
+		tagTable = append(tagTable, entry...)
+		tagData = append(tagData, data...)
+		for len(tagData)%4 != 0 {
+			tagData = append(tagData, 0)
+		}
+	}
+
+	for channel, name := range []string{"r", "g", "b"} {
+		xyz := []byte{'X', 'Y', 'Z', ' ', 0, 0, 0, 0}
+		for row := 0; row < 3; row++ {
+			xyz = append(xyz, toS15Fixed16(srgbToXyzD50[row*3+channel])...)
+		}
+		addTag(name+"XYZ", xyz)
+	}
+	for _, name := range []string{"r", "g", "b"} {
+		addTag(name+"TRC", curve)
+	}
+
+	tagCount := make([]byte, 4)
+	binary.BigEndian.PutUint32(tagCount, 6)
+
+	result := append(header, tagCount...)
+	result = append(result, tagTable...)
+	result = append(result, tagData...)
+	binary.BigEndian.PutUint32(result, uint32(len(result)))
+	return result
+}
+
+func compressIccProfile(g *GomegaWithT, profile []byte) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("test")
+	// null separator and compression method
+	buffer.Write([]byte{0, 0})
+	writer := zlib.NewWriter(&buffer)
+	_, err := writer.Write(profile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(writer.Close()).NotTo(HaveOccurred())
+	return buffer.Bytes()
+}
+
+func toS15Fixed16(value float64) []byte {
+	result := make([]byte, 4)
+	binary.BigEndian.PutUint32(result, uint32(int32(value*65536+0.5)))
+	return result
+}
@@ -1,13 +1,39 @@
 package icons
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type ImageSizeError struct {
-	File            string
+	File string
+	// actual size of the largest image, 0 if unknown
+	Width           int
+	Height          int
 	RequiredMinSize int
 	errorCode       string
 }
 
+type ImageNotSquareError struct {
+	File   string
+	Width  int
+	Height int
+}
+
+// IconQualityError is reported in strict mode for issues that are warnings otherwise
+type IconQualityError struct {
+	File      string
+	Message   string
+	errorCode string
+}
+
+// IcnsEntryFormatError lists OSTypes of ICNS entries that cannot be decoded
+type IcnsEntryFormatError struct {
+	File      string
+	Types     []string
+	errorCode string
+}
+
 type ImageFormatError struct {
 	File      string
 	errorCode string
@@ -21,14 +47,50 @@ func (e *ImageFormatError) ErrorCode() string {
 	return e.errorCode
 }
 
+func (e *IconQualityError) ErrorCode() string {
+	return e.errorCode
+}
+
+func (e *IconQualityError) Error() string {
+	return fmt.Sprintf("image %s: %s", e.File, e.Message)
+}
+
+func (e *IcnsEntryFormatError) ErrorCode() string {
+	return e.errorCode
+}
+
+func (e *IcnsEntryFormatError) Error() string {
+	if e.errorCode == "ERR_ICON_JPEG2000_NOT_SUPPORTED" {
+		return fmt.Sprintf("icns %s contains JPEG 2000 entries (%s), opj_decompress (OpenJPEG) is required to decode them", e.File, strings.Join(e.Types, ", "))
+	}
+	return fmt.Sprintf("icns %s doesn't contain entries in supported format (skipped: %s)", e.File, strings.Join(e.Types, ", "))
+}
+
+func (e *ImageNotSquareError) ErrorCode() string {
+	return "ERR_ICON_NOT_SQUARE"
+}
+
+func (e *ImageNotSquareError) Error() string {
+	return fmt.Sprintf("image %s must be square, but it is %dx%d (use pad to square option to pad it with transparent pixels)", e.File, e.Width, e.Height)
+}
+
 func (e *ImageSizeError) Error() string {
-	return fmt.Sprintf("image %s must be at least %dx%d", e.File, e.RequiredMinSize, e.RequiredMinSize)
+	if e.Width == 0 && e.Height == 0 {
+		return fmt.Sprintf("image %s must be at least %dx%d", e.File, e.RequiredMinSize, e.RequiredMinSize)
+	}
+	return fmt.Sprintf("image %s must be at least %dx%d, but it is %dx%d", e.File, e.RequiredMinSize, e.RequiredMinSize, e.Width, e.Height)
 }
 
 func (e *ImageFormatError) Error() string {
+	if e.errorCode == "ERR_ICON_AVIF_NOT_SUPPORTED" {
+		return fmt.Sprintf("image %s is in AVIF format, avifdec (libavif) is required to decode it", e.File)
+	}
+	if e.errorCode == "ERR_ICON_HEIC_NOT_SUPPORTED" {
+		return fmt.Sprintf("image %s is in HEIC format, heif-convert (libheif) is required to decode it", e.File)
+	}
 	return fmt.Sprintf("image %s shas unknown format", e.File)
 }
 
-func NewImageSizeError(file string, requiredMinSize int) *ImageSizeError {
-	return &ImageSizeError{file, requiredMinSize, "ERR_ICON_TOO_SMALL"}
+func NewImageSizeError(file string, width int, height int, requiredMinSize int) *ImageSizeError {
+	return &ImageSizeError{file, width, height, requiredMinSize, "ERR_ICON_TOO_SMALL"}
 }
@@ -0,0 +1,108 @@
+package icons
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+const faviconIcoFileName = "favicon.ico"
+const webManifestFileName = "site.webmanifest"
+
+// legacy browsers and Windows shortcuts use ICO, 48px is the largest size used for pinned sites
+var faviconIcoSizes = []int{16, 32, 48}
+
+// apple-touch-icon is used by iOS for home screen bookmarks, 192 and 512 are required for installable web app (PWA)
+var faviconPngs = []IconInfo{
+	{File: "apple-touch-icon.png", Size: 180},
+	{File: "android-chrome-192x192.png", Size: 192},
+	{File: "android-chrome-512x512.png", Size: 512},
+}
+
+const faviconMinSize = 512
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// only icons are specified, fragment is expected to be merged into site manifest
+func createWebManifestFragment() interface{} {
+	var icons []webManifestIcon
+	for _, png := range faviconPngs {
+		if png.Size < 192 {
+			continue
+		}
+		icons = append(icons, webManifestIcon{Src: png.File, Sizes: fmt.Sprintf("%dx%d", png.Size, png.Size), Type: "image/png"})
+	}
+	return struct {
+		Icons []webManifestIcon `json:"icons"`
+	}{icons}
+}
+
+func convertToFavicon(inputInfo *InputFileInfo, sourceFile string, outDir string) ([]IconInfo, error) {
+	err := configureInputInfoFromSingleFile(sourceFile, false, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := []IconInfo{{File: filepath.Join(outDir, faviconIcoFileName)}}
+	for _, png := range faviconPngs {
+		result = append(result, IconInfo{File: filepath.Join(outDir, png.File), Size: png.Size})
+	}
+
+	err = util.MapAsync(len(result), func(taskIndex int) (func() error, error) {
+		icon := result[taskIndex]
+		return func() error {
+			if taskIndex == 0 {
+				return writeFaviconIco(inputInfo, icon.File)
+			}
+			img, err := inputInfo.resizeMaxImage(inputInfo.maxImage, icon.Size)
+			if err != nil {
+				return err
+			}
+			return SaveImage(img, icon.File, PNG)
+		}, nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data, err := json.MarshalIndent(createWebManifestFragment(), "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = fs.WriteFileAtomic(filepath.Join(outDir, webManifestFileName), data, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func writeFaviconIco(inputInfo *InputFileInfo, outFile string) error {
+	images := make([]image.Image, len(faviconIcoSizes))
+	for index, size := range faviconIcoSizes {
+		var err error
+		images[index], err = inputInfo.resizeMaxImage(inputInfo.maxImage, size)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fs.WriteFileAtomicWith(outFile, 0644, func(file *os.File) error {
+		writer := bufio.NewWriter(file)
+		err := EncodeIco(writer, images, inputInfo.icoOptions)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(writer.Flush())
+	})
+}
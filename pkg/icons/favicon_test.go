@@ -0,0 +1,64 @@
+package icons
+
+import (
+	"context"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestConvertToFavicon(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-favicon")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 512, 512)), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+
+	outDir := filepath.Join(tmpDir, "out")
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "favicon",
+		OutputDir:       outDir,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(withoutIconMetadata(result.Icons)).To(Equal([]IconInfo{
+		{File: filepath.Join(outDir, "favicon.ico")},
+		{File: filepath.Join(outDir, "apple-touch-icon.png"), Size: 180},
+		{File: filepath.Join(outDir, "android-chrome-192x192.png"), Size: 192},
+		{File: filepath.Join(outDir, "android-chrome-512x512.png"), Size: 512},
+	}))
+
+	frames, err := ReadIcoFrames(result.Icons[0].File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(frames).To(HaveLen(3))
+	for index, frame := range frames {
+		g.Expect(frame.Size).To(Equal(faviconIcoSizes[index]))
+	}
+	for _, icon := range result.Icons[1:] {
+		g.Expect(readSourceSize(icon.File)).To(Equal(icon.Size))
+	}
+
+	manifest, err := ioutil.ReadFile(filepath.Join(outDir, "site.webmanifest"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(manifest).To(MatchJSON(`{"icons": [
+		{"src": "android-chrome-192x192.png", "sizes": "192x192", "type": "image/png"},
+		{"src": "android-chrome-512x512.png", "sizes": "512x512", "type": "image/png"}
+	]}`))
+
+	// output file cannot be used, several files are produced
+	_, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "favicon",
+		OutputFile:      filepath.Join(outDir, "favicon.ico"),
+	})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -1,18 +1,28 @@
 package icons
 
 import (
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 )
 
 // returns file if exists, null if file not exists, or error if unknown error
 func resolveSourceFileOrNull(sourceFile string, roots []string) (string, os.FileInfo, error) {
+	if isGlobPattern(sourceFile) {
+		return resolveGlobOrNull(sourceFile, roots)
+	}
+
 	if filepath.IsAbs(sourceFile) {
 		cleanPath := filepath.Clean(sourceFile)
-		fileInfo, err := os.Stat(cleanPath)
+		fileInfo, err := os.Stat(fs.LongPath(cleanPath))
 		if err == nil {
 			return cleanPath, fileInfo, nil
 		}
@@ -21,7 +31,8 @@ func resolveSourceFileOrNull(sourceFile string, roots []string) (string, os.File
 
 	for _, root := range roots {
 		resolvedPath := filepath.Join(root, sourceFile)
-		fileInfo, err := os.Stat(resolvedPath)
+		// resolved path is returned as is, prefix is required only to stat (project can be located deeply in node_modules)
+		fileInfo, err := os.Stat(fs.LongPath(resolvedPath))
 		switch {
 		case err == nil:
 			return resolvedPath, fileInfo, nil
@@ -53,3 +64,139 @@ func resolveSourceFile(sourceFiles []string, roots []string) (string, os.FileInf
 
 	return "", nil, nil
 }
+
+func isGlobPattern(sourceFile string) bool {
+	return strings.ContainsAny(sourceFile, "*?[{") || strings.Contains(sourceFile, "@(")
+}
+
+// alternatives are tried in the specified order, the largest image is selected from several matches of the same alternative
+func resolveGlobOrNull(pattern string, roots []string) (string, os.FileInfo, error) {
+	if filepath.IsAbs(pattern) {
+		roots = []string{""}
+	}
+
+	patterns, err := expandAlternatives(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, root := range roots {
+		for _, p := range patterns {
+			// extended-length prefix cannot be used for pattern (? is a meta character)
+			matches, err := filepath.Glob(filepath.Join(root, p))
+			if err != nil {
+				return "", nil, errors.Wrapf(err, "invalid pattern %s", pattern)
+			}
+
+			sort.Strings(matches)
+			var candidates []string
+			var candidateInfos []os.FileInfo
+			for _, match := range matches {
+				fileInfo, err := os.Stat(fs.LongPath(match))
+				if err == nil {
+					candidates = append(candidates, match)
+					candidateInfos = append(candidateInfos, fileInfo)
+					continue
+				}
+				log.WithFields(log.Fields{
+					"path":  match,
+					"error": err,
+				}).Debug("matched path cannot be used")
+			}
+
+			switch len(candidates) {
+			case 0:
+				continue
+			case 1:
+				return candidates[0], candidateInfos[0], nil
+			}
+
+			index, err := selectLargestImage(pattern, candidates, candidateInfos)
+			if err != nil {
+				return "", nil, err
+			}
+			return candidates[index], candidateInfos[index], nil
+		}
+
+		log.WithFields(log.Fields{
+			"pattern": pattern,
+			"root":    root,
+		}).Debug("pattern doesn't match")
+	}
+	return "", nil, nil
+}
+
+// SVG is rendered at any size, so, it is the largest. Several matches of the largest size is an error - result must not depend on file names.
+func selectLargestImage(pattern string, files []string, fileInfos []os.FileInfo) (int, error) {
+	var largest []int
+	largestSize := -1
+	for index, file := range files {
+		size := 0
+		switch {
+		case fileInfos[index].IsDir():
+		case isSvgFile(file):
+			size = math.MaxInt32
+		default:
+			icon := IconInfo{File: file}
+			err := readIconMetadata(&icon)
+			if err != nil {
+				return -1, err
+			}
+			size = icon.Width
+		}
+
+		if size > largestSize {
+			largestSize = size
+			largest = largest[:0]
+		}
+		if size == largestSize {
+			largest = append(largest, index)
+		}
+	}
+
+	if len(largest) == 1 {
+		return largest[0], nil
+	}
+
+	ambiguousFiles := make([]string, len(largest))
+	for index, fileIndex := range largest {
+		ambiguousFiles[index] = files[fileIndex]
+	}
+	return -1, util.NewMessageError(fmt.Sprintf("icon source pattern %s matches several files of the same size, specify more specific pattern: %s", pattern, strings.Join(ambiguousFiles, ", ")), "ERR_ICON_AMBIGUOUS_SOURCE")
+}
+
+// expands @(a|b) (extglob) and {a,b} (brace expansion) groups, nested groups are not supported
+func expandAlternatives(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "{")
+	if extglobStart := strings.Index(pattern, "@("); extglobStart != -1 && (start == -1 || extglobStart < start) {
+		start = extglobStart
+	}
+	if start == -1 {
+		return []string{pattern}, nil
+	}
+
+	prefixLength := 1
+	closing := "}"
+	separator := ","
+	if pattern[start] == '@' {
+		prefixLength = 2
+		closing = ")"
+		separator = "|"
+	}
+
+	end := strings.Index(pattern[start:], closing)
+	if end == -1 {
+		return nil, errors.Errorf("invalid pattern %s: %s is not closed", pattern, pattern[start:start+prefixLength])
+	}
+	end += start
+
+	var result []string
+	for _, alternative := range strings.Split(pattern[start+prefixLength:end], separator) {
+		expanded, err := expandAlternatives(pattern[:start] + alternative + pattern[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package icons
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestExpandAlternatives(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(expandAlternatives("icon.png")).To(Equal([]string{"icon.png"}))
+	g.Expect(expandAlternatives("assets/icon@(.png|.icns)")).To(Equal([]string{"assets/icon.png", "assets/icon.icns"}))
+	g.Expect(expandAlternatives("{build,assets}/icon.{png,ico}")).To(Equal([]string{"build/icon.png", "build/icon.ico", "assets/icon.png", "assets/icon.ico"}))
+
+	_, err := expandAlternatives("icon@(.png")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestResolveSourceFileGlob(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "resolve")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	firstRoot := filepath.Join(tmpDir, "first")
+	secondRoot := filepath.Join(tmpDir, "second")
+	for _, file := range []string{
+		filepath.Join(firstRoot, "assets", "icon.icns"),
+		filepath.Join(secondRoot, "build", "icons", "b.png"),
+		filepath.Join(secondRoot, "build", "icons", "a.png"),
+		filepath.Join(secondRoot, "assets", "icon.png"),
+	} {
+		g.Expect(os.MkdirAll(filepath.Dir(file), 0755)).To(Succeed())
+		g.Expect(ioutil.WriteFile(file, nil, 0644)).To(Succeed())
+	}
+	roots := []string{firstRoot, secondRoot}
+
+	// several matches of the same (unknown) size
+	_, _, err = resolveSourceFile([]string{"build/icons/*.png"}, roots)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("matches several files"))
+
+	// the largest image is selected, not the first one
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 32, 32)), filepath.Join(secondRoot, "build", "icons", "a.png"), PNG)).To(Succeed())
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 64, 64)), filepath.Join(secondRoot, "build", "icons", "b.png"), PNG)).To(Succeed())
+	file, _, err := resolveSourceFile([]string{"build/icons/*.png"}, roots)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file).To(Equal(filepath.Join(secondRoot, "build", "icons", "b.png")))
+
+	// root order takes precedence over alternative order
+	file, _, err = resolveSourceFile([]string{"assets/icon@(.png|.icns)"}, roots)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file).To(Equal(filepath.Join(firstRoot, "assets", "icon.icns")))
+
+	file, _, err = resolveSourceFile([]string{filepath.Join(secondRoot, "assets", "*.{icns,png}")}, roots)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file).To(Equal(filepath.Join(secondRoot, "assets", "icon.png")))
+
+	file, fileInfo, err := resolveSourceFile([]string{"missing/*.png"}, roots)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file).To(BeEmpty())
+	g.Expect(fileInfo).To(BeNil())
+}
@@ -0,0 +1,79 @@
+package icons
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+)
+
+func isGif(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("GIF87a")) || bytes.HasPrefix(header, []byte("GIF89a"))
+}
+
+// animated GIF frames can be smaller than the logical screen, so, the largest frame is used (the first one if several have the same size)
+func decodeGif(reader io.Reader, file string) (image.Image, error) {
+	animation, frameIndex, err := readGif(reader, file)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := animation.Image[frameIndex]
+	bounds := frame.Bounds()
+	fields := log.Fields{
+		"file":   file,
+		"frame":  frameIndex,
+		"frames": len(animation.Image),
+		"width":  bounds.Dx(),
+		"height": bounds.Dy(),
+	}
+	if len(animation.Image) > 1 {
+		log.WithFields(fields).Info("GIF has several frames, the largest one is used")
+	} else {
+		log.WithFields(fields).Debug("GIF is used as icon source")
+	}
+
+	// transparent palette color is converted to fully transparent pixel, result starts at 0,0 regardless of frame position
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), frame, bounds.Min, draw.Src)
+	return result, nil
+}
+
+func readGif(reader io.Reader, file string) (*gif.GIF, int, error) {
+	animation, err := gif.DecodeAll(reader)
+	if err != nil {
+		return nil, -1, errors.WithStack(err)
+	}
+
+	frameIndex := selectGifFrame(animation)
+	if frameIndex == -1 {
+		return nil, -1, errors.WithStack(&ImageFormatError{file, "ERR_ICON_UNKNOWN_FORMAT"})
+	}
+	return animation, frameIndex, nil
+}
+
+func selectGifFrame(animation *gif.GIF) int {
+	result, maxArea := -1, 0
+	for index, frame := range animation.Image {
+		area := frame.Bounds().Dx() * frame.Bounds().Dy()
+		if area > maxArea {
+			result, maxArea = index, area
+		}
+	}
+	return result
+}
+
+// logical screen size (image.DecodeConfig) can differ from the size of used frame
+func decodeGifConfig(reader io.Reader, file string) (*image.Config, error) {
+	animation, frameIndex, err := readGif(reader, file)
+	if err != nil {
+		return nil, err
+	}
+	bounds := animation.Image[frameIndex].Bounds()
+	return &image.Config{ColorModel: color.NRGBAModel, Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
@@ -0,0 +1,48 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestGifLargestFrame(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "gif")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	palette := color.Palette{color.RGBA{}, color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}
+	// small first frame at offset, large second frame with transparent pixels
+	small := image.NewPaletted(image.Rect(10, 10, 26, 26), palette)
+	large := image.NewPaletted(image.Rect(0, 0, 300, 300), palette)
+	for y := 0; y < 300; y++ {
+		for x := 150; x < 300; x++ {
+			large.SetColorIndex(x, y, 2)
+		}
+	}
+
+	file := filepath.Join(tmpDir, "icon.gif")
+	outFile, err := os.Create(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	err = gif.EncodeAll(outFile, &gif.GIF{Image: []*image.Paletted{small, large}, Delay: []int{0, 0}, Config: image.Config{ColorModel: palette, Width: 300, Height: 300}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(outFile.Close()).NotTo(HaveOccurred())
+
+	result, err := LoadImage(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Bounds()).To(Equal(image.Rect(0, 0, 300, 300)))
+	g.Expect(color.NRGBAModel.Convert(result.At(10, 10))).To(Equal(color.NRGBA{}))
+	g.Expect(color.NRGBAModel.Convert(result.At(200, 10))).To(Equal(color.NRGBA{B: 255, A: 255}))
+
+	config, err := DecodeImageConfig(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Width).To(Equal(300))
+}
@@ -0,0 +1,83 @@
+package icons
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// ISO BMFF ftyp major brands of HEIC image and image sequence
+var heicBrands = [][]byte{[]byte("heic"), []byte("heix"), []byte("heim"), []byte("heis"), []byte("hevc"), []byte("hevx")}
+
+func isHeic(header []byte) bool {
+	if len(header) < 12 || !bytes.Equal(header[4:8], []byte("ftyp")) {
+		return false
+	}
+
+	brand := header[8:12]
+	for _, heicBrand := range heicBrands {
+		if bytes.Equal(brand, heicBrand) {
+			return true
+		}
+	}
+	return false
+}
+
+// golang doesn't support HEIC, so, sips is used on macOS and heif-convert (libheif) otherwise to convert to PNG
+func decodeHeic(file string) (image.Image, error) {
+	tempDir, err := util.TempDir("", ".heic")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	pngFile := filepath.Join(tempDir, "image.png")
+	command, err := createHeicConvertCommand(file, pngFile)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = util.Execute(command, "")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	reader, err := os.Open(pngFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return DecodeImageAndClose(reader, reader)
+}
+
+func createHeicConvertCommand(file string, pngFile string) (*exec.Cmd, error) {
+	heifConvert, isSet := os.LookupEnv("HEIF_CONVERT_PATH")
+	if !isSet && runtime.GOOS == "darwin" {
+		return exec.Command("sips", "-s", "format", "png", file, "--out", pngFile), nil
+	}
+
+	if !isSet {
+		heifConvert = "heif-convert"
+	}
+	_, err := exec.LookPath(heifConvert)
+	if err != nil {
+		return nil, errors.WithStack(&ImageFormatError{file, "ERR_ICON_HEIC_NOT_SUPPORTED"})
+	}
+	return exec.Command(heifConvert, file, pngFile), nil
+}
+
+func decodeHeicConfig(file string) (*image.Config, error) {
+	result, err := decodeHeic(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	bounds := result.Bounds()
+	return &image.Config{ColorModel: result.ColorModel(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
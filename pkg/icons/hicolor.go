@@ -0,0 +1,67 @@
+package icons
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// https://specifications.freedesktop.org/icon-theme-spec/icon-theme-spec-latest.html
+// icons are copied (hard links are used if possible) to hicolor/<size>x<size>/apps/<name>.png, so, result can be dropped into usr/share/icons as is
+func writeHicolorLayout(icons []IconInfo, name string, outDir string) ([]IconInfo, error) {
+	if len(name) == 0 {
+		return nil, errors.New("icon name is required for hicolor layout")
+	}
+
+	themeDir := filepath.Join(outDir, "hicolor")
+	result := make([]IconInfo, len(icons))
+	err := util.MapAsync(len(icons), func(taskIndex int) (func() error, error) {
+		icon := icons[taskIndex]
+		iconDir := filepath.Join(themeDir, hicolorSizeDir(icon.Size))
+		iconFile := filepath.Join(iconDir, name+filepath.Ext(icon.File))
+		result[taskIndex] = IconInfo{File: iconFile, Size: icon.Size}
+		return func() error {
+			return fs.CopyUsingHardlink(icon.File, iconFile)
+		}, nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = writeHicolorIndexTheme(result, themeDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+func hicolorSizeDir(size int) string {
+	return fmt.Sprintf("%dx%d/apps", size, size)
+}
+
+func writeHicolorIndexTheme(icons []IconInfo, themeDir string) error {
+	var directories []string
+	for _, icon := range icons {
+		directories = append(directories, hicolorSizeDir(icon.Size))
+	}
+
+	var content strings.Builder
+	content.WriteString("[Icon Theme]\n")
+	content.WriteString("Name=Hicolor\n")
+	content.WriteString("Comment=Fallback icon theme\n")
+	content.WriteString("Hidden=true\n")
+	content.WriteString("Directories=" + strings.Join(directories, ",") + "\n")
+	for _, icon := range icons {
+		content.WriteString(fmt.Sprintf("\n[%s]\n", hicolorSizeDir(icon.Size)))
+		content.WriteString(fmt.Sprintf("Size=%d\n", icon.Size))
+		content.WriteString("Context=Applications\n")
+		content.WriteString("Type=Threshold\n")
+	}
+
+	return errors.WithStack(fsutil.WriteFile(strings.NewReader(content.String()), filepath.Join(themeDir, "index.theme"), 0644, nil))
+}
@@ -0,0 +1,217 @@
+package icons
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image/png"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type IcnsInfo struct {
+	Size    int             `json:"size"`
+	HasToc  bool            `json:"hasToc"`
+	Entries []IcnsEntryInfo `json:"entries"`
+	// point sizes that have 1x entry, but don't have @2x (retina) entry
+	MissingRetina []int `json:"missingRetina"`
+}
+
+type IcnsEntryInfo struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	// png, jpeg2000, argb, rle, mask, 1bit, toc or unknown
+	Format string `json:"format"`
+
+	// 0 if not applicable (e.g. TOC) or not known
+	Width     int `json:"width,omitempty"`
+	Height    int `json:"height,omitempty"`
+	PointSize int `json:"pointSize,omitempty"`
+	Scale     int `json:"scale,omitempty"`
+}
+
+type icnsTypeInfo struct {
+	pointSize int
+	scale     int
+	// format of legacy types, modern types contain PNG or JPEG 2000
+	format string
+}
+
+var (
+	jpeg2000Header = []byte{0x00, 0x00, 0x00, 0x0c, 0x6a, 0x50, 0x20, 0x20}
+	// ic04 and ic05 can contain ARGB data (RLE compressed) instead of PNG
+	argbHeader = []byte("ARGB")
+
+	icnsTypeInfos = map[string]icnsTypeInfo{
+		"ICN#": {32, 1, "1bit"},
+		"icm#": {16, 1, "1bit"},
+		"ics#": {16, 1, "1bit"},
+		"is32": {16, 1, "rle"},
+		"il32": {32, 1, "rle"},
+		"ih32": {48, 1, "rle"},
+		"it32": {128, 1, "rle"},
+		"s8mk": {16, 1, "mask"},
+		"l8mk": {32, 1, "mask"},
+		"h8mk": {48, 1, "mask"},
+		"t8mk": {128, 1, "mask"},
+		"ic04": {16, 1, ""},
+		"ic05": {32, 1, ""},
+		"icp4": {16, 1, ""},
+		"icp5": {32, 1, ""},
+		"icp6": {64, 1, ""},
+		"ic07": {128, 1, ""},
+		"ic08": {256, 1, ""},
+		"ic09": {512, 1, ""},
+		"ic10": {512, 2, ""},
+		"ic11": {16, 2, ""},
+		"ic12": {32, 2, ""},
+		"ic13": {128, 2, ""},
+		"ic14": {256, 2, ""},
+		"icsb": {18, 1, ""},
+		"icsB": {18, 2, ""},
+		"sb24": {24, 1, ""},
+		"SB24": {24, 2, ""},
+	}
+)
+
+func ConfigureIcnsInfoCommand(app *kingpin.Application) {
+	command := app.Command("icns-info", "List entries of ICNS file")
+	file := command.Arg("file", "ICNS file").Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		info, err := ReadIcnsInfo(*file)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(info)
+	})
+}
+
+func ReadIcnsInfo(file string) (*IcnsInfo, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(reader)
+
+	bufferedReader := bufio.NewReader(reader)
+	isIcns, err := IsIcns(bufferedReader)
+	if err != nil {
+		return nil, err
+	}
+	if !isIcns {
+		return nil, errors.Errorf("%s is not an ICNS file", file)
+	}
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(bufferedReader, header)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	info := &IcnsInfo{
+		Size:          int(binary.BigEndian.Uint32(header[4:])),
+		Entries:       []IcnsEntryInfo{},
+		MissingRetina: []int{},
+	}
+
+	offset := 8
+	for {
+		_, err = io.ReadFull(bufferedReader, header)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.WithMessage(err, "cannot read ICNS entry header")
+		}
+
+		osType := string(header[:4])
+		length := int(binary.BigEndian.Uint32(header[4:])) - 8
+		if length < 0 {
+			return nil, errors.Errorf("invalid length of ICNS entry %s at %d", osType, offset)
+		}
+
+		data := make([]byte, length)
+		_, err = io.ReadFull(bufferedReader, data)
+		if err != nil {
+			return nil, errors.WithMessage(err, "cannot read ICNS entry "+osType)
+		}
+
+		info.Entries = append(info.Entries, describeIcnsEntry(osType, offset+8, data))
+		if osType == icnsTocType {
+			info.HasToc = true
+		}
+		offset += 8 + length
+	}
+
+	info.MissingRetina = findMissingRetina(info.Entries)
+	return info, nil
+}
+
+func describeIcnsEntry(osType string, offset int, data []byte) IcnsEntryInfo {
+	entry := IcnsEntryInfo{
+		Type:   osType,
+		Offset: offset,
+		Length: len(data),
+		Format: "unknown",
+	}
+
+	if osType == icnsTocType {
+		entry.Format = "toc"
+		return entry
+	}
+
+	typeInfo, isKnown := icnsTypeInfos[osType]
+	if isKnown {
+		entry.PointSize = typeInfo.pointSize
+		entry.Scale = typeInfo.scale
+		entry.Width = typeInfo.pointSize * typeInfo.scale
+		entry.Height = entry.Width
+		if len(typeInfo.format) != 0 {
+			entry.Format = typeInfo.format
+			return entry
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(data, pngHeader):
+		entry.Format = "png"
+		// report actual dimensions - mismatch is a common reason of blurry icons
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err == nil {
+			entry.Width = config.Width
+			entry.Height = config.Height
+		}
+	case bytes.HasPrefix(data, jpeg2000Header):
+		entry.Format = "jpeg2000"
+	case bytes.HasPrefix(data, argbHeader):
+		entry.Format = "argb"
+	}
+	return entry
+}
+
+func findMissingRetina(entries []IcnsEntryInfo) []int {
+	pointSizeToScales := make(map[int]int)
+	for _, entry := range entries {
+		// masks and 1-bit icons don't have retina variants
+		if entry.Scale == 0 || entry.Format == "mask" || entry.Format == "1bit" {
+			continue
+		}
+		pointSizeToScales[entry.PointSize] |= entry.Scale
+	}
+
+	result := []int{}
+	for pointSize, scales := range pointSizeToScales {
+		// 1x present, 2x missing, there is no retina OSType for 48 and 64
+		if scales&2 == 0 && pointSize != 48 && pointSize != 64 {
+			result = append(result, pointSize)
+		}
+	}
+	sort.Ints(result)
+	return result
+}
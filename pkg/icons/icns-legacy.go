@@ -0,0 +1,134 @@
+package icons
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/develar/errors"
+)
+
+// legacy (pre 10.7) OSTypes: 24-bit RGB (each channel is RLE compressed separately) and 8-bit alpha mask as separate entry
+var icnsLegacyEntries = []struct {
+	size     int
+	osType   string
+	maskType string
+}{
+	{16, "is32", "s8mk"},
+	{32, "il32", "l8mk"},
+	{48, "ih32", "h8mk"},
+	{128, "it32", "t8mk"},
+}
+
+// legacy entries are small (128 max), so, encoded in memory
+type icnsLegacyBlob struct {
+	entry icnsEntry
+	data  []byte
+}
+
+// returns pairs of image and mask entries, sizes larger than max icon size are not produced (do not upscale)
+func createIcnsLegacyBlobs(inputInfo *InputFileInfo) ([]icnsLegacyBlob, error) {
+	var result []icnsLegacyBlob
+	for _, legacyEntry := range icnsLegacyEntries {
+		if legacyEntry.size > inputInfo.MaxIconSize {
+			continue
+		}
+
+		img, err := getImageOfSize(inputInfo, legacyEntry.size)
+		if err != nil {
+			return nil, err
+		}
+
+		rgbData, maskData := encodeIcnsLegacy(img, legacyEntry.osType == "it32")
+		result = append(result,
+			icnsLegacyBlob{icnsEntry{legacyEntry.osType, legacyEntry.size, 1}, rgbData},
+			icnsLegacyBlob{icnsEntry{legacyEntry.maskType, legacyEntry.size, 1}, maskData},
+		)
+	}
+	return result, nil
+}
+
+func getImageOfSize(inputInfo *InputFileInfo, size int) (image.Image, error) {
+	existingImage := inputInfo.sizeToImage[size]
+	if existingImage != nil {
+		return existingImage, nil
+	}
+
+	existingFile, exists := inputInfo.SizeToPath[size]
+	if exists {
+		img, err := LoadImage(existingFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if img.Bounds().Dx() == size && img.Bounds().Dy() == size {
+			return img, nil
+		}
+	}
+
+	maxImage, err := inputInfo.GetMaxImage()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return inputInfo.resizeMaxImage(maxImage, size)
+}
+
+// color channels are not premultiplied, it32 data starts with 4 zero bytes
+func encodeIcnsLegacy(img image.Image, isIt32 bool) ([]byte, []byte) {
+	bounds := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	pixelCount := bounds.Dx() * bounds.Dy()
+	channels := [3][]byte{make([]byte, pixelCount), make([]byte, pixelCount), make([]byte, pixelCount)}
+	mask := make([]byte, pixelCount)
+	for i := 0; i < pixelCount; i++ {
+		channels[0][i] = nrgba.Pix[i*4]
+		channels[1][i] = nrgba.Pix[i*4+1]
+		channels[2][i] = nrgba.Pix[i*4+2]
+		mask[i] = nrgba.Pix[i*4+3]
+	}
+
+	var rgbData []byte
+	if isIt32 {
+		rgbData = append(rgbData, 0, 0, 0, 0)
+	}
+	for _, channel := range channels {
+		rgbData = appendIcnsRle(rgbData, channel)
+	}
+	return rgbData, mask
+}
+
+// control byte < 0x80: next (control + 1) bytes are copied as is (1-128),
+// control byte >= 0x80: next byte is repeated (control - 0x80 + 3) times (3-130)
+func appendIcnsRle(out []byte, data []byte) []byte {
+	literalStart := 0
+	flushLiteral := func(end int) {
+		for literalStart < end {
+			count := end - literalStart
+			if count > 128 {
+				count = 128
+			}
+			out = append(out, byte(count-1))
+			out = append(out, data[literalStart:literalStart+count]...)
+			literalStart += count
+		}
+	}
+
+	i := 0
+	for i < len(data) {
+		runLength := 1
+		for i+runLength < len(data) && data[i+runLength] == data[i] && runLength < 130 {
+			runLength++
+		}
+
+		if runLength >= 3 {
+			flushLiteral(i)
+			out = append(out, byte(runLength-3+0x80), data[i])
+			i += runLength
+			literalStart = i
+		} else {
+			i += runLength
+		}
+	}
+	flushLiteral(len(data))
+	return out
+}
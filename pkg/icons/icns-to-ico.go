@@ -0,0 +1,110 @@
+package icons
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+var pngHeader = []byte{0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a}
+
+// ICNS embeds PNG (or JPEG 2000) images, PNG images are decoded and used instead of downscaling of the largest one,
+// frames are encoded by ICO writer (according to ICO options, e.g. BMP), without any intermediate files
+func ConvertIcnsToIco(inputInfo *InputFileInfo, inFile string, outFile string) ([]IconInfo, error) {
+	sizeToImage, err := readIcnsPngImages(inFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(sizeToImage) == 0 {
+		return nil, &ImageFormatError{inFile, "ERR_ICON_UNKNOWN_FORMAT"}
+	}
+
+	inputInfo.MaxIconPath = inFile
+	inputInfo.sizeToImage = sizeToImage
+
+	for size, sizeImage := range sizeToImage {
+		if size > inputInfo.MaxIconSize {
+			inputInfo.MaxIconSize = size
+			inputInfo.maxImage = sizeImage
+		}
+	}
+
+	if inputInfo.MaxIconSize < inputInfo.recommendedMinSize {
+		if !inputInfo.isUpscale {
+			return nil, errors.WithStack(NewImageSizeError(inFile, inputInfo.MaxIconSize, inputInfo.MaxIconSize, inputInfo.recommendedMinSize))
+		}
+
+		log.WithField("file", inFile).Warn("ICNS doesn't contain image of recommended size, upscaled")
+		inputInfo.MaxIconSize = inputInfo.recommendedMinSize
+		inputInfo.maxImage = inputInfo.resizeOptions.resize(inputInfo.maxImage, inputInfo.MaxIconSize)
+	}
+
+	if inputInfo.MaxIconSize > 256 {
+		inputInfo.maxImage = inputInfo.resizeOptions.resize(inputInfo.maxImage, 256)
+		inputInfo.MaxIconSize = 256
+	}
+
+	inputInfo.applySizeOverrides()
+	err = ConvertToIco(inputInfo, outFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []IconInfo{{File: outFile}}, nil
+}
+
+// returns decoded PNG sub images by pixel size, JPEG 2000 and legacy sub images are skipped
+func readIcnsPngImages(file string) (map[int]image.Image, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	typeToImage, err := ReadIcns(bufio.NewReader(reader))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sizeToImage := make(map[int]image.Image)
+	for osType, subImage := range typeToImage {
+		size, ok := typeToSize[osType]
+		if !ok || sizeToImage[size] != nil || subImage.Length < len(pngHeader) {
+			continue
+		}
+
+		data := make([]byte, subImage.Length)
+		_, err = reader.ReadAt(data, int64(subImage.Offset))
+		if err != nil && err != io.EOF {
+			return nil, errors.WithStack(err)
+		}
+
+		if !bytes.HasPrefix(data, pngHeader) {
+			log.WithFields(log.Fields{
+				"type": osType,
+				"file": file,
+			}).Debug("skip non-PNG ICNS sub image")
+			continue
+		}
+
+		subImageData, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if subImageData.Bounds().Dx() != size || subImageData.Bounds().Dy() != size {
+			continue
+		}
+
+		sizeToImage[size] = subImageData
+	}
+	return sizeToImage, nil
+}
@@ -12,7 +12,6 @@ import (
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
-	"github.com/disintegration/imaging"
 )
 
 type Icns2PngMapping struct {
@@ -90,7 +89,7 @@ func ConvertIcnsToPngUsingIconUtil(inFile string, outDir string, sizeList *[]int
 	for _, item := range icnsTypeToSize {
 		fileName := fmt.Sprintf("icon_%dx%d.png", item.Size, item.Size)
 		if contains(iconFileNames, fileName) {
-			result = append(result, IconInfo{filepath.Join(outDir, fileName), item.Size})
+			result = append(result, IconInfo{File: filepath.Join(outDir, fileName), Size: item.Size})
 		} else {
 			*sizeList = append(*sizeList, item.Size)
 		}
@@ -127,10 +126,13 @@ func multiResizeImage(inFile string, outFileNameFormat string, result *[]IconInf
 		return errors.WithStack(err)
 	}
 
-	return multiResizeImage2(&originalImage, outFileNameFormat, result, sizeList)
+	var resizeOptions *ResizeOptions
+	return multiResizeImage2(&originalImage, outFileNameFormat, result, sizeList, func(img image.Image, size int) (image.Image, error) {
+		return resizeOptions.resize(img, size), nil
+	})
 }
 
-func multiResizeImage2(originalImage *image.Image, outFileNameFormat string, result *[]IconInfo, sizeList []int) error {
+func multiResizeImage2(originalImage *image.Image, outFileNameFormat string, result *[]IconInfo, sizeList []int, resize func(img image.Image, size int) (image.Image, error)) error {
 	imageCount := len(sizeList)
 	if imageCount == 0 {
 		return nil
@@ -151,7 +153,10 @@ func multiResizeImage2(originalImage *image.Image, outFileNameFormat string, res
 		})
 
 		return func() error {
-			newImage := imaging.Resize(*originalImage, size, size, imaging.Lanczos)
+			newImage, err := resize(*originalImage, size)
+			if err != nil {
+				return err
+			}
 			return SaveImage(newImage, outFilePath, PNG)
 		}, nil
 	})
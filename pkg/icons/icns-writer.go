@@ -0,0 +1,144 @@
+package icons
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// entries are streamed to the file as they are produced (image data is never buffered),
+// lengths (total, entry and table of contents) are unknown in advance and patched in place
+type icnsWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	length int
+
+	// entries are written in the order of table of contents
+	tocEntryCount int
+	writtenCount  int
+}
+
+// table of contents of entryCount entries is reserved
+func newIcnsWriter(file *os.File, entryCount int) (*icnsWriter, error) {
+	result := &icnsWriter{file: file, writer: bufio.NewWriter(file), tocEntryCount: entryCount}
+	// each ICNS file is prefixed with a 4 byte header and 4 bytes marking the length of the file, MSB first (patched on finish)
+	err := result.write(icnsHeader)
+	if err == nil {
+		err = result.write(make([]byte, 4))
+	}
+	if err == nil {
+		err = result.writeEntryHeader(icnsTocType, entryCount*8)
+	}
+	if err == nil {
+		err = result.write(make([]byte, entryCount*8))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (t *icnsWriter) Write(data []byte) (int, error) {
+	n, err := t.writer.Write(data)
+	t.length += n
+	return n, errors.WithStack(err)
+}
+
+func (t *icnsWriter) write(data []byte) error {
+	_, err := t.Write(data)
+	return err
+}
+
+// each icon type is prefixed with a 4-byte OSType marker and a 4-byte size header (which includes the ostype/size header)
+func (t *icnsWriter) writeEntryHeader(osType string, dataLength int) error {
+	return t.write(createIcnsEntryHeader(osType, dataLength))
+}
+
+func createIcnsEntryHeader(osType string, dataLength int) []byte {
+	header := make([]byte, 8)
+	copy(header, osType)
+	binary.BigEndian.PutUint32(header[4:], uint32(dataLength+8))
+	return header
+}
+
+// writeEntry returns offset of entry data in the file, so, data can be reused by another entry of the same pixel size
+func (t *icnsWriter) writeEntry(osType string, writeData func(writer io.Writer) error) (int64, int, error) {
+	if t.writtenCount == t.tocEntryCount {
+		return 0, 0, errors.Errorf("ICNS entry %s is not listed in table of contents", osType)
+	}
+
+	headerOffset := t.length
+	err := t.writeEntryHeader(osType, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = writeData(t)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = t.writer.Flush()
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	dataLength := t.length - headerOffset - 8
+	header := createIcnsEntryHeader(osType, dataLength)
+	_, err = t.file.WriteAt(header, int64(headerOffset))
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	// table of contents is located after file header (8) and toc entry header (8)
+	_, err = t.file.WriteAt(header, int64(16+t.writtenCount*8))
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	t.writtenCount++
+	return int64(headerOffset + 8), dataLength, nil
+}
+
+// data of already written entry is copied, the file must be opened for read
+func (t *icnsWriter) copyEntry(osType string, dataOffset int64, dataLength int) error {
+	_, _, err := t.writeEntry(osType, func(writer io.Writer) error {
+		_, err := io.Copy(writer, io.NewSectionReader(t.file, dataOffset, int64(dataLength)))
+		return errors.WithStack(err)
+	})
+	return err
+}
+
+// existing file is streamed as is
+func (t *icnsWriter) writeFileEntry(osType string, file string) (int64, int, error) {
+	return t.writeEntry(osType, func(writer io.Writer) error {
+		reader, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer util.Close(reader)
+		_, err = io.Copy(writer, reader)
+		return errors.WithStack(err)
+	})
+}
+
+// file is not closed
+func (t *icnsWriter) finish() error {
+	if t.writtenCount != t.tocEntryCount {
+		return errors.Errorf("ICNS table of contents lists %d entries, but %d written", t.tocEntryCount, t.writtenCount)
+	}
+
+	err := t.writer.Flush()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	lengthBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthBytes, uint32(t.length))
+	_, err = t.file.WriteAt(lengthBytes, 4)
+	return errors.WithStack(err)
+}
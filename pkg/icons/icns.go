@@ -2,15 +2,14 @@ package icons
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/binary"
 	"image/png"
 	"io"
-	"io/ioutil"
+	"os"
 
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
 	"github.com/develar/errors"
-	"github.com/develar/go-fs-util"
-	"github.com/disintegration/imaging"
 )
 
 //noinspection GoSnakeCaseUsage
@@ -22,111 +21,156 @@ const (
 	ICNS_1024       = "ic10"
 )
 
+// table of contents, lists OSType and length of every entry, so, entries can be located without reading the whole file
+const icnsTocType = "TOC "
+
 var (
 	icnsHeader = []byte{0x69, 0x63, 0x6e, 0x73}
 
+	// pixel sizes, each produced once and shared by all entries with the same pixel size
 	icnsExpectedSizes = []int{16, 32, 64, 128, 256, 512, 1024}
 
-	// all icon sizes mapped to their respective possible OSTypes, this includes old OSTypes such as ic08 recognized on 10.5
+	// ordered by pixel size, this includes old OSTypes such as ic08 recognized on 10.5
 	// https://github.com/electron-userland/electron-builder/issues/2533
-	// AppIcon Generator also doesn't produce 16x16 from 1024x1025 PNG source (only 16x16@2x "retina" icon)
-	sizeToType = map[int][]string{
-		16:   {"icp4"},
-		32:   {"ic11"}, // icp5 is not generated by AppIcon Generator
-		64:   {"ic12"}, // icp6 is not generated by AppIcon Generator
-		128:  {"ic07"},
-		256:  {ICNS_256, ICNS_256_RETINA},
-		512:  {ICNS_512, ICNS_512_RETINA},
-		1024: {ICNS_1024},
+	// icp5 (32) and icp6 (64) are not generated by AppIcon Generator
+	icnsEntries = []icnsEntry{
+		{"icp4", 16, 1},
+		{"ic11", 16, 2},
+		{"ic12", 32, 2},
+		{"ic07", 128, 1},
+		{ICNS_256, 256, 1},
+		{ICNS_256_RETINA, 128, 2},
+		{ICNS_512, 512, 1},
+		{ICNS_512_RETINA, 256, 2},
+		{ICNS_1024, 512, 2},
 	}
 )
 
-func ConvertToIcns(inputInfo InputFileInfo, outFilePath string) error {
-	// create a new buffer to hold the series of icons generated via resizing
-	icns := new(bytes.Buffer)
+type icnsEntry struct {
+	OSType    string
+	PointSize int
+	Scale     int
+}
+
+// retina (@2x) entry is encoded from the image of double point size
+func (t icnsEntry) PixelSize() int {
+	return t.PointSize * t.Scale
+}
 
-	for _, size := range icnsExpectedSizes {
-		if size > inputInfo.MaxIconSize {
-			// do not upscale
-			continue
+func ConvertToIcns(inputInfo *InputFileInfo, outFilePath string) error {
+	reporter := progress.Start("icon", outFilePath, int64(countIcnsProducedSizes(inputInfo)))
+	err := convertToIcns(inputInfo, outFilePath, reporter)
+	reporter.Finish(err)
+	return err
+}
+
+func convertToIcns(inputInfo *InputFileInfo, outFilePath string, reporter *progress.Reporter) error {
+	var entries []icnsEntry
+	for _, entry := range icnsEntries {
+		if isIcnsSizeProduced(inputInfo, entry.PixelSize()) {
+			entries = append(entries, entry)
 		}
+	}
 
-		var imageData []byte
+	var legacyBlobs []icnsLegacyBlob
+	if inputInfo.isLegacy {
 		var err error
-		existingFile, exists := inputInfo.SizeToPath[size]
-		if exists {
-			imageData, err = ioutil.ReadFile(existingFile)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-		} else {
-			if size == 16 {
-				// https://github.com/electron-userland/electron-builder/issues/2533
-				// AppIcon Generator also doesn't produce 16x16 from 1024x1025 PNG source (only 16x16@2x "retina" icon)
-				continue
-			}
+		legacyBlobs, err = createIcnsLegacyBlobs(inputInfo)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
-			maxImage, err := inputInfo.GetMaxImage()
-			if err != nil {
-				return errors.WithStack(err)
-			}
+	// written atomically, so, partially written ICNS is never left if process is killed or rename fails
+	return fs.WriteFileAtomicWith(outFilePath, 0644, func(file *os.File) error {
+		writer, err := newIcnsWriter(file, len(entries)+len(legacyBlobs))
+		if err != nil {
+			return err
+		}
 
-			imageBuffer := new(bytes.Buffer)
-			err = png.Encode(imageBuffer, imaging.Resize(maxImage, size, size, imaging.Lanczos))
+		// each pixel size is produced once, data of the entry with the same pixel size is copied from the file
+		type writtenData struct {
+			offset int64
+			length int
+		}
+		sizeToData := make(map[int]writtenData)
+		for _, entry := range entries {
+			size := entry.PixelSize()
+			data, isWritten := sizeToData[size]
+			if isWritten {
+				err = writer.copyEntry(entry.OSType, data.offset, data.length)
+			} else {
+				data.offset, data.length, err = writeIcnsImageEntry(writer, entry.OSType, inputInfo, size)
+				sizeToData[size] = data
+				reporter.Add(1)
+			}
 			if err != nil {
-				return errors.WithStack(err)
+				return err
 			}
-
-			imageData = imageBuffer.Bytes()
 		}
 
-		// each icon type is prefixed with a 4-byte OSType marker and a 4-byte size header (which includes the ostype/size header).
-		// add the size of the total icon to lengthBytes in big-endian format.
-		lengthBytes := make([]byte, 4)
-		binary.BigEndian.PutUint32(lengthBytes, uint32(len(imageData)+8))
-
-		// iterate through every OSType and append the icon to icns
-		for _, ostype := range sizeToType[size] {
-			_, err = icns.Write([]byte(ostype))
-			if err != nil {
-				return errors.WithStack(err)
-			}
-			_, err = icns.Write(lengthBytes)
-			if err != nil {
+		for _, legacyBlob := range legacyBlobs {
+			_, _, err = writer.writeEntry(legacyBlob.entry.OSType, func(dataWriter io.Writer) error {
+				_, err := dataWriter.Write(legacyBlob.data)
 				return errors.WithStack(err)
-			}
-			_, err = icns.Write(imageData)
+			})
 			if err != nil {
-				return errors.WithStack(err)
+				return err
 			}
 		}
-	}
+		return writer.finish()
+	})
+}
 
-	// each ICNS file is prefixed with a 4 byte header and 4 bytes marking the length of the file, MSB first
-	lengthBytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(lengthBytes, uint32(icns.Len()+8))
+func isIcnsSizeProduced(inputInfo *InputFileInfo, size int) bool {
+	if size > inputInfo.MaxIconSize {
+		// do not upscale
+		return false
+	}
+	_, exists := inputInfo.SizeToPath[size]
+	// https://github.com/electron-userland/electron-builder/issues/2533
+	// AppIcon Generator also doesn't produce 16x16 from 1024x1025 PNG source (only 16x16@2x "retina" icon)
+	return exists || size != 16
+}
 
-	outFile, err := fsutil.CreateFile(outFilePath)
-	if err != nil {
-		return errors.WithStack(err)
+// PNG is encoded directly to the file, so, only one image is kept in memory
+func writeIcnsImageEntry(writer *icnsWriter, osType string, inputInfo *InputFileInfo, size int) (int64, int, error) {
+	existingFile, exists := inputInfo.SizeToPath[size]
+	if exists {
+		return writer.writeFileEntry(osType, existingFile)
 	}
 
-	_, err = outFile.Write(icnsHeader)
+	maxImage, err := inputInfo.GetMaxImage()
 	if err != nil {
-		return errors.WithStack(fsutil.CloseAndCheckError(err, outFile))
+		return 0, 0, errors.WithStack(err)
 	}
-	_, err = outFile.Write(lengthBytes)
+
+	img, err := inputInfo.resizeMaxImage(maxImage, size)
 	if err != nil {
-		return errors.WithStack(fsutil.CloseAndCheckError(err, outFile))
+		return 0, 0, err
 	}
+	return writer.writeEntry(osType, func(dataWriter io.Writer) error {
+		return errors.WithStack(png.Encode(dataWriter, img))
+	})
+}
 
-	_, err = io.Copy(outFile, icns)
-	err = fsutil.CloseAndCheckError(err, outFile)
-	if err != nil {
-		return errors.WithStack(err)
+func countIcnsProducedSizes(inputInfo *InputFileInfo) int {
+	result := 0
+	for _, size := range icnsExpectedSizes {
+		if isIcnsSizeProduced(inputInfo, size) {
+			result++
+		}
 	}
+	return result
+}
 
-	return nil
+func indexOfSize(sizes []int, size int) int {
+	for index, value := range sizes {
+		if value == size {
+			return index
+		}
+	}
+	return -1
 }
 
 func IsIcns(reader *bufio.Reader) (bool, error) {
@@ -168,7 +212,7 @@ func ReadIcns(reader *bufio.Reader) (map[string]SubImage, error) {
 		imageDataLength := int(icon.Length) - 8
 
 		osType := string(icon.Type[:])
-		if osType != "info" && osType != "TOC" && osType != "icnV" && osType != "name" {
+		if osType != "info" && osType != icnsTocType && osType != "icnV" && osType != "name" {
 			typeToImage[osType] = SubImage{
 				Offset: offset,
 				Length: imageDataLength,
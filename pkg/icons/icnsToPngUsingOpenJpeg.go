@@ -2,6 +2,7 @@ package icons
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"image"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/apex/log"
@@ -61,6 +63,12 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 		}
 	}
 
+	// entries that are neither in registered image format (PNG) nor JPEG 2000 are reported instead of silently dropped
+	var skippedTypes []string
+	var jpeg2000Types []string
+	// legacy types, modern types for the same sizes are expected
+	var ignoredTypes []string
+
 	outFileNamePrefix := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(icnsPath), filepath.Ext(icnsPath))) + "_"
 	for imageType, subImage := range subImageInfoList {
 		if isIgnoredType(imageType) {
@@ -68,6 +76,7 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 				"type": imageType,
 				"file": icnsPath,
 			}).Debug("skip unsupported icns sub image format")
+			ignoredTypes = append(ignoredTypes, imageType)
 			continue
 		}
 
@@ -80,19 +89,27 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 
 		var outFileName string
 
+		// peek doesn't advance reader, so, header is still available for DecodeConfig
+		header, _ := bufferedReader.Peek(len(jpeg2000Header))
+		isJpeg2000 := bytes.HasPrefix(header, jpeg2000Header)
+
 		config, formatName, err := image.DecodeConfig(bufferedReader)
-		if err != nil {
-			outFileName = outFileNamePrefix + imageType + ".jp2"
+		if err == nil {
+			outFileName = outFileNamePrefix + fmt.Sprintf("%d.%s", config.Width, formatName)
 			result = append(result, IconInfo{
 				File: outFileName,
-				Size: typeToSize[imageType],
+				Size: config.Width,
 			})
-		} else {
-			outFileName = outFileNamePrefix + fmt.Sprintf("%d.%s", config.Width, formatName)
+		} else if isJpeg2000 {
+			jpeg2000Types = append(jpeg2000Types, imageType)
+			outFileName = outFileNamePrefix + imageType + ".jp2"
 			result = append(result, IconInfo{
 				File: outFileName,
-				Size: config.Width,
+				Size: typeToSize[imageType],
 			})
+		} else {
+			skippedTypes = append(skippedTypes, imageType)
+			continue
 		}
 
 		_, err = reader.Seek(imageOffset, 0)
@@ -112,6 +129,31 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 		}
 	}
 
+	sort.Strings(skippedTypes)
+	sort.Strings(jpeg2000Types)
+	if len(result) == 0 {
+		allTypes := append(ignoredTypes, skippedTypes...)
+		sort.Strings(allTypes)
+		return nil, errors.WithStack(&IcnsEntryFormatError{File: icnsPath, Types: allTypes, errorCode: "ERR_ICON_ICNS_NO_SUPPORTED_ENTRIES"})
+	}
+	if len(skippedTypes) != 0 {
+		log.WithFields(log.Fields{
+			"file":  icnsPath,
+			"types": strings.Join(skippedTypes, ", "),
+		}).Warn("icns entries in unsupported format are skipped")
+	}
+	if len(jpeg2000Types) == 0 {
+		return result, nil
+	}
+
+	opjDecompressPath, opjLibPath, err := getOpjDecompress()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(opjDecompressPath) == 0 {
+		return nil, errors.WithStack(&IcnsEntryFormatError{File: icnsPath, Types: jpeg2000Types, errorCode: "ERR_ICON_JPEG2000_NOT_SUPPORTED"})
+	}
+
 	err = util.MapAsync(len(result), func(taskIndex int) (func() error, error) {
 		imageInfo := &result[taskIndex]
 		jpeg2File := imageInfo.File
@@ -119,17 +161,6 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 			return nil, nil
 		}
 
-		opjDecompressPath := "opj_decompress"
-		opjLibPath := ""
-		if !util.IsEnvTrue("USE_SYSTEM_OPG") && runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
-			opjDecompressPath, err = linuxTools.GetLinuxTool("opj_decompress")
-			if err != nil {
-				return nil, errors.WithStack(err)
-			}
-
-			opjLibPath = filepath.Join(filepath.Dir(opjDecompressPath), "lib")
-		}
-
 		pngFile := fmt.Sprintf("%s%d.png", outFileNamePrefix, imageInfo.Size)
 		imageInfo.File = pngFile
 
@@ -143,7 +174,7 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 				command.Env = env
 			}
 
-			_, err = util.Execute(command, "")
+			_, err := util.Execute(command, "")
 			if err != nil {
 				return errors.WithStack(err)
 			}
@@ -163,6 +194,23 @@ func ConvertIcnsToPngUsingOpenJpeg(icnsPath string, outDir string) ([]IconInfo,
 	return result, nil
 }
 
+// empty path is returned if opj_decompress is not available
+func getOpjDecompress() (string, string, error) {
+	if !util.IsEnvTrue("USE_SYSTEM_OPG") && runtime.GOOS == "linux" && runtime.GOARCH == "amd64" {
+		opjDecompressPath, err := linuxTools.GetLinuxTool("opj_decompress")
+		if err != nil {
+			return "", "", errors.WithStack(err)
+		}
+		return opjDecompressPath, filepath.Join(filepath.Dir(opjDecompressPath), "lib"), nil
+	}
+
+	opjDecompressPath, err := exec.LookPath("opj_decompress")
+	if err != nil {
+		return "", "", nil
+	}
+	return opjDecompressPath, "", nil
+}
+
 func isIgnoredType(imageType string) bool {
 	return imageType == "ic04" || imageType == "ic05" ||
 		strings.HasPrefix(imageType, "icm") || strings.HasPrefix(imageType, "ics") || strings.HasPrefix(imageType, "is") || strings.HasPrefix(imageType, "s") || strings.HasPrefix(imageType, "ich") ||
@@ -0,0 +1,127 @@
+package icons
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/biessek/golang-ico"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+func isIcoFile(file string) bool {
+	return strings.HasSuffix(strings.ToLower(file), ".ico")
+}
+
+// each ICO frame is saved as PNG and added to SizeToPath, so, hand-tuned small sizes are preserved instead of downscaling the largest frame
+func configureInputInfoFromIcoFrames(file string, outDir string, inputInfo *InputFileInfo) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	frames, err := ico.DecodeAll(reader)
+	util.Close(reader)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, frame := range frames {
+		size := frame.Bounds().Dx()
+		if size != frame.Bounds().Dy() {
+			log.WithFields(log.Fields{
+				"file":   file,
+				"width":  size,
+				"height": frame.Bounds().Dy(),
+			}).Debug("skip non-square ICO frame")
+			continue
+		}
+
+		// the first frame of the same size is used
+		if _, exists := inputInfo.SizeToPath[size]; exists {
+			continue
+		}
+
+		frameFile := filepath.Join(outDir, fmt.Sprintf("icon_%dx%d.png", size, size))
+		err = SaveImage(frame, frameFile, PNG)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		inputInfo.SizeToPath[size] = frameFile
+		if size > inputInfo.MaxIconSize {
+			inputInfo.MaxIconSize = size
+			inputInfo.MaxIconPath = frameFile
+			inputInfo.maxImage = frame
+		}
+	}
+
+	if inputInfo.maxImage == nil {
+		return errors.WithStack(&ImageFormatError{file, "ERR_ICON_UNKNOWN_FORMAT"})
+	}
+
+	if inputInfo.MaxIconSize < inputInfo.recommendedMinSize {
+		if !inputInfo.isUpscale {
+			return errors.WithStack(NewImageSizeError(file, inputInfo.MaxIconSize, inputInfo.MaxIconSize, inputInfo.recommendedMinSize))
+		}
+
+		log.WithField("file", file).Warn("ICO doesn't contain image of recommended size, upscaled")
+		inputInfo.MaxIconSize = inputInfo.recommendedMinSize
+		inputInfo.MaxIconPath = ""
+		inputInfo.maxImage = inputInfo.resizeOptions.resize(inputInfo.maxImage, inputInfo.MaxIconSize)
+	}
+	return nil
+}
+
+func convertIcoToSet(inputInfo *InputFileInfo, file string, outDir string) ([]IconInfo, error) {
+	err := configureInputInfoFromIcoFrames(file, outDir, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var result []IconInfo
+	for size, frameFile := range inputInfo.SizeToPath {
+		result = append(result, IconInfo{File: frameFile, Size: size})
+	}
+
+	// only missing sizes are produced from the largest frame
+	candidateSizes := []int{24, 96, inputInfo.MaxIconSize}
+	for _, item := range icnsTypeToSize {
+		candidateSizes = append(candidateSizes, item.Size)
+	}
+
+	var sizeList []int
+	for _, size := range candidateSizes {
+		_, exists := inputInfo.SizeToPath[size]
+		if !exists && size <= inputInfo.MaxIconSize && indexOfSize(sizeList, size) == -1 {
+			sizeList = append(sizeList, size)
+		}
+	}
+
+	err = multiResizeImage2(&inputInfo.maxImage, filepath.Join(outDir, "icon_%dx%d.png"), &result, sizeList, inputInfo.resizeMaxImage)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sortBySize(result)
+	return result, nil
+}
+
+func convertIcoToIcns(inputInfo *InputFileInfo, file string, outFile string) ([]IconInfo, error) {
+	// extracted frames are not part of result
+	tempDir, err := util.TempDir("", ".ico")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	err = configureInputInfoFromIcoFrames(file, tempDir, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return convertSingleFile(inputInfo, outFile, "icns")
+}
@@ -1,9 +1,42 @@
 package icons
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/errors"
 )
 
+// sizes embedded into generated ICO, 256 is stored as PNG by default, all others as BMP (as Windows XP doesn't support PNG frames)
+var icoSizes = []int{16, 24, 32, 48, 64, 128, 256}
+
+// zero value is the default: 256px frame is stored as PNG, other frames as 32-bit BMP
+type IcoOptions struct {
+	// store 256px frame as uncompressed BMP too (larger, but PNG frames are not supported by Windows XP)
+	IsBmpOnly bool `json:"bmpOnly,omitempty"`
+	// store 16px and 32px frames as 8-bit palette BMP (lossy: colors are quantized and alpha is reduced to 1-bit mask)
+	IsQuantize bool `json:"quantize,omitempty"`
+}
+
+// size report of ICO frame
+type IcoFrameInfo struct {
+	Size int `json:"size"`
+	// png or bmp
+	Format       string `json:"format"`
+	BitsPerPixel int    `json:"bitsPerPixel"`
+	Length       int    `json:"length"`
+}
+
 type Sizes struct {
 	Width  int
 	Height int
@@ -33,3 +66,295 @@ func GetIcoSizes(data []byte) []Sizes {
 	}
 	return sizes
 }
+
+// https://en.wikipedia.org/wiki/ICO_(file_format)
+func EncodeIco(writer io.Writer, images []image.Image, options IcoOptions) error {
+	if len(images) == 0 {
+		return errors.New("at least one image is required to encode ICO")
+	}
+
+	frames := make([][]byte, len(images))
+	bitsPerPixel := make([]int, len(images))
+	colorCounts := make([]int, len(images))
+	for index, frameImage := range images {
+		var err error
+		size := frameImage.Bounds().Dx()
+		bitsPerPixel[index] = 32
+		switch {
+		case size >= 256 && !options.IsBmpOnly:
+			frames[index], err = encodeIcoPngFrame(frameImage)
+		case (size == 16 || size == 32) && options.IsQuantize:
+			frames[index], colorCounts[index] = encodeIcoPaletteFrame(frameImage)
+			bitsPerPixel[index] = 8
+		default:
+			frames[index], err = encodeIcoBmpFrame(frameImage)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	const headerSize = 6
+	const entrySize = 16
+	header := make([]byte, headerSize+entrySize*len(images))
+	// reserved (0), type (1 - icon), count
+	binary.LittleEndian.PutUint16(header[2:], 1)
+	binary.LittleEndian.PutUint16(header[4:], uint16(len(images)))
+
+	offset := len(header)
+	for index, frameImage := range images {
+		entry := header[headerSize+entrySize*index:]
+		bounds := frameImage.Bounds()
+		// 0 means 256
+		entry[0] = uint8(bounds.Dx())
+		entry[1] = uint8(bounds.Dy())
+		// color count (0 if 256 or more) and reserved
+		if colorCounts[index] < 256 {
+			entry[2] = uint8(colorCounts[index])
+		}
+		entry[3] = 0
+		// color planes
+		binary.LittleEndian.PutUint16(entry[4:], 1)
+		binary.LittleEndian.PutUint16(entry[6:], uint16(bitsPerPixel[index]))
+		binary.LittleEndian.PutUint32(entry[8:], uint32(len(frames[index])))
+		binary.LittleEndian.PutUint32(entry[12:], uint32(offset))
+		offset += len(frames[index])
+	}
+
+	_, err := writer.Write(header)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, frame := range frames {
+		_, err = writer.Write(frame)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func encodeIcoPngFrame(frameImage image.Image) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	err := png.Encode(buffer, frameImage)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// 32-bit BGRA DIB without file header, height is doubled because of AND mask
+func encodeIcoBmpFrame(frameImage image.Image) ([]byte, error) {
+	bounds := frameImage.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	const infoHeaderSize = 40
+	pixelDataSize := width * height * 4
+	// each row of 1-bit mask is padded to 32 bits
+	maskRowSize := (width + 31) / 32 * 4
+	maskSize := maskRowSize * height
+
+	result := make([]byte, infoHeaderSize+pixelDataSize+maskSize)
+	binary.LittleEndian.PutUint32(result[0:], infoHeaderSize)
+	binary.LittleEndian.PutUint32(result[4:], uint32(width))
+	binary.LittleEndian.PutUint32(result[8:], uint32(height*2))
+	// planes
+	binary.LittleEndian.PutUint16(result[12:], 1)
+	// bits per pixel
+	binary.LittleEndian.PutUint16(result[14:], 32)
+	// compression (BI_RGB) is 0
+	binary.LittleEndian.PutUint32(result[20:], uint32(pixelDataSize+maskSize))
+
+	pixels := result[infoHeaderSize:]
+	mask := pixels[pixelDataSize:]
+	for y := 0; y < height; y++ {
+		// bottom-up
+		row := height - 1 - y
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(frameImage.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			offset := (row*width + x) * 4
+			pixels[offset] = c.B
+			pixels[offset+1] = c.G
+			pixels[offset+2] = c.R
+			pixels[offset+3] = c.A
+			if c.A == 0 {
+				mask[row*maskRowSize+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return result, nil
+}
+
+// 8-bit palette DIB, transparency is stored only in AND mask (alpha < 128 is transparent), returns frame and palette size
+func encodeIcoPaletteFrame(frameImage image.Image) ([]byte, int) {
+	bounds := frameImage.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), frameImage, bounds.Min, draw.Src)
+	palette := quantize(nrgba, 256)
+
+	const infoHeaderSize = 40
+	// rows are padded to 32 bits
+	pixelRowSize := (width + 3) / 4 * 4
+	maskRowSize := (width + 31) / 32 * 4
+	paletteSize := len(palette) * 4
+
+	result := make([]byte, infoHeaderSize+paletteSize+pixelRowSize*height+maskRowSize*height)
+	binary.LittleEndian.PutUint32(result[0:], infoHeaderSize)
+	binary.LittleEndian.PutUint32(result[4:], uint32(width))
+	binary.LittleEndian.PutUint32(result[8:], uint32(height*2))
+	binary.LittleEndian.PutUint16(result[12:], 1)
+	binary.LittleEndian.PutUint16(result[14:], 8)
+	binary.LittleEndian.PutUint32(result[20:], uint32((pixelRowSize+maskRowSize)*height))
+	// colors used
+	binary.LittleEndian.PutUint32(result[32:], uint32(len(palette)))
+
+	for index, paletteColor := range palette {
+		c := paletteColor.(color.NRGBA)
+		entry := result[infoHeaderSize+index*4:]
+		entry[0] = c.B
+		entry[1] = c.G
+		entry[2] = c.R
+	}
+
+	pixels := result[infoHeaderSize+paletteSize:]
+	mask := pixels[pixelRowSize*height:]
+	colorToIndex := make(map[color.NRGBA]byte)
+	for y := 0; y < height; y++ {
+		// bottom-up
+		row := height - 1 - y
+		for x := 0; x < width; x++ {
+			c := nrgba.NRGBAAt(x, y)
+			if c.A < 128 {
+				mask[row*maskRowSize+x/8] |= 0x80 >> uint(x%8)
+				continue
+			}
+
+			c.A = 255
+			index, exists := colorToIndex[c]
+			if !exists {
+				index = byte(palette.Index(c))
+				colorToIndex[c] = index
+			}
+			pixels[row*pixelRowSize+x] = index
+		}
+	}
+	return result, len(palette)
+}
+
+// ReadIcoFrames returns size report of ICO frames
+func ReadIcoFrames(file string) ([]IcoFrameInfo, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(data) < 6 || !IsIco(data) {
+		return nil, errors.WithStack(&ImageFormatError{file, "ERR_ICON_UNKNOWN_FORMAT"})
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	result := make([]IcoFrameInfo, 0, count)
+	for i := 0; i < count; i++ {
+		if len(data) < 6+(i+1)*16 {
+			return nil, errors.Errorf("ICO directory of %s is truncated", file)
+		}
+
+		entry := data[6+i*16:]
+		size := int(entry[0])
+		if size == 0 {
+			size = 256
+		}
+		frame := IcoFrameInfo{
+			Size:         size,
+			Format:       "bmp",
+			BitsPerPixel: int(binary.LittleEndian.Uint16(entry[6:])),
+			Length:       int(binary.LittleEndian.Uint32(entry[8:])),
+		}
+		offset := int(binary.LittleEndian.Uint32(entry[12:]))
+		if offset < len(data) && bytes.HasPrefix(data[offset:], pngHeader) {
+			frame.Format = "png"
+		}
+		result = append(result, frame)
+	}
+	return result, nil
+}
+
+func ConvertToIco(inputInfo *InputFileInfo, outFilePath string) error {
+	reporter := progress.Start("icon", outFilePath, int64(len(icoSizes)))
+	err := convertToIco(inputInfo, outFilePath, reporter)
+	reporter.Finish(err)
+	return err
+}
+
+func convertToIco(inputInfo *InputFileInfo, outFilePath string, reporter *progress.Reporter) error {
+	// images are produced in parallel, but written in the order of icoSizes
+	sizeImages := make([]image.Image, len(icoSizes))
+	err := progress.MapAsync(reporter, len(icoSizes), func(taskIndex int) (func() error, error) {
+		size := icoSizes[taskIndex]
+		if size > inputInfo.MaxIconSize {
+			// do not upscale
+			return nil, nil
+		}
+
+		existingImage, exists := inputInfo.sizeToImage[size]
+		if exists {
+			sizeImages[taskIndex] = existingImage
+			return nil, nil
+		}
+
+		existingFile, exists := inputInfo.SizeToPath[size]
+		return func() error {
+			if exists {
+				existingImage, err := LoadImage(existingFile)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+
+				if existingImage.Bounds().Dx() == size && existingImage.Bounds().Dy() == size {
+					sizeImages[taskIndex] = existingImage
+					return nil
+				}
+			}
+
+			maxImage, err := inputInfo.GetMaxImage()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if maxImage.Bounds().Dx() == size {
+				sizeImages[taskIndex] = maxImage
+			} else {
+				sizeImages[taskIndex], err = inputInfo.resizeMaxImage(maxImage, size)
+			}
+			return err
+		}, nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var images []image.Image
+	for _, sizeImage := range sizeImages {
+		if sizeImage != nil {
+			images = append(images, sizeImage)
+		}
+	}
+
+	if len(images) == 0 {
+		return errors.Errorf("icon is too small to produce ICO (size: %d)", inputInfo.MaxIconSize)
+	}
+
+	return fs.WriteFileAtomicWith(outFilePath, 0644, func(outFile *os.File) error {
+		writer := bufio.NewWriter(outFile)
+		err := EncodeIco(writer, images, inputInfo.icoOptions)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(writer.Flush())
+	})
+}
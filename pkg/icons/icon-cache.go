@@ -0,0 +1,97 @@
+package icons
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// must be incremented if conversion produces another output for the same input
+const iconCacheVersion = "3"
+
+type iconCache struct {
+	file string
+}
+
+// cache is used only for single file sources, key is SHA-512 of source file bytes, output format and options
+func newIconCache(sourceFile string, configuration *IconConvertRequest) (*iconCache, error) {
+	if util.IsEnvTrue("ELECTRON_BUILDER_DISABLE_ICON_CACHE") {
+		return nil, nil
+	}
+
+	cacheDir, err := download.GetCacheDirectoryForArtifactCustom("icons")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	reader, err := os.Open(sourceFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	hash := sha512.New()
+	_, err = io.Copy(hash, reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	_, _ = fmt.Fprintf(hash, "%s-%d-%t-%t-%t-%v-%s-%s-%t-%t-%t-%t-%s-%s", configuration.OutputFormat, configuration.getRecommendedMinSize(), configuration.IsUpscale, configuration.IsPadToSquare, configuration.IsTrim, configuration.Padding, configuration.Background, configuration.Mask, configuration.IsMaskShadow, configuration.IsLegacy, configuration.IcoOptions.IsBmpOnly, configuration.IcoOptions.IsQuantize, configuration.ResizeOptions.cacheKey(), iconCacheVersion)
+	key := hex.EncodeToString(hash.Sum(nil))
+	return &iconCache{file: filepath.Join(cacheDir, key+outputFormatToSingleFileExtension(configuration.OutputFormat))}, nil
+}
+
+// copies cached icon to the out file, returns false if not cached
+func (t *iconCache) restore(outFile string) (bool, error) {
+	fileInfo, err := os.Stat(t.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+
+	err = fsutil.CopyFile(t.file, outFile, fileInfo.Mode())
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	log.WithFields(log.Fields{
+		"file":   outFile,
+		"cached": t.file,
+	}).Debug("icon restored from cache")
+	return true, nil
+}
+
+// cache is best effort, so, error is only logged
+func (t *iconCache) save(outFile string) {
+	// copy to temp file and rename to ensure that concurrent process will not read partially written file
+	tempFile, err := util.TempFile(filepath.Dir(t.file), ".tmp")
+	if err == nil {
+		err = fsutil.CopyFile(outFile, tempFile, 0644)
+		if err == nil {
+			err = fs.RenameWithRetry(tempFile, t.file)
+		}
+		if err != nil {
+			_ = os.Remove(tempFile)
+		}
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  t.file,
+			"error": err,
+		}).Warn("cannot save icon to cache")
+	}
+}
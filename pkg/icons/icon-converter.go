@@ -1,7 +1,11 @@
 package icons
 
 import (
+	"context"
+	"fmt"
 	"image"
+	"image/color"
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -15,45 +19,136 @@ import (
 )
 
 func ConfigureCommand(app *kingpin.Application) error {
-	command := app.Command("icon", "create ICNS or ICO or icon set from PNG files")
+	command := app.Command("icon", "create ICNS or ICO or icon set or macOS template (menu bar) icon or Windows badge (overlay) icons or favicon bundle from PNG files")
 
 	configuration := &IconConvertRequest{
-		Sources:         command.Flag("input", "input source file or directory").Short('i').Strings(),
-		FallbackSources: command.Flag("fallback-input", "fallback source file or directory").Strings(),
+		Sources:         command.Flag("input", "input source file, directory, glob pattern or https URL").Short('i').Strings(),
+		FallbackSources: command.Flag("fallback-input", "fallback source file, directory, glob pattern or https URL").Strings(),
 		Roots:           command.Flag("root", "base directory to resolve relative path").Strings(),
 	}
 
-	iconOutFormat := command.Flag("format", "output format").Short('f').Required().Enum("icns", "ico", "set")
-	outDir := command.Flag("out", "output directory").Required().String()
+	iconOutFormat := command.Flag("format", "output format").Short('f').Required().Enum("icns", "ico", "set", "template", "badge", "favicon")
+	outDir := command.Flag("out", "output directory (files are written atomically: moved from staging dir on completion)").String()
+	outFile := command.Flag("output", "output file for icns and ico formats (output directory is not required in this case)").Short('o').String()
+	minSize := command.Flag("min-size", "minimal size of source image (default: 512 for icns, 256 otherwise)").Int()
+	isUpscale := command.Flag("upscale", "upscale source image smaller than minimal size instead of failing").Bool()
+	isPadToSquare := command.Flag("pad-to-square", "pad non-square source image to square with transparent pixels instead of failing").Bool()
+	isTrim := command.Flag("trim", "crop transparent borders of source image before resizing (trimmed image is centered on square canvas)").Bool()
+	padding := command.Flag("padding", "add transparent safe margin on each side before resizing, in percent of icon size (e.g. 10)").Float64()
+	mask := command.Flag("mask", "compose source onto the shape of platform icon before generating: bigsur (macOS 11+ rounded square tile with margins)").Enum("bigsur")
+	isMaskShadow := command.Flag("mask-shadow", "add drop shadow under the mask tile").Bool()
+	background := command.Flag("background", "flatten transparency onto the color (e.g. #ffffff or white) for targets requiring opaque images (BMP frames of ICO, JPEG 2000 entries of ICNS)").String()
+	isLegacy := command.Flag("legacy", "also write legacy RLE entries with masks to ICNS (for old macOS versions and Finder contexts that ignore PNG entries)").Bool()
+	isIcoPng := command.Flag("ico-png", "store 256px frame of ICO as PNG (use --no-ico-png to store all frames as BMP)").Default("true").Bool()
+	isIcoQuantize := command.Flag("ico-quantize", "store 16px and 32px frames of ICO as 8-bit palette BMP (smaller, but lossy)").Bool()
+	layout := command.Flag("layout", "layout of icon set").Default("flat").Enum("flat", "hicolor")
+	sizeConfig := command.Flag("size-config", "JSON file with explicit source files per size ({\"sizes\": {\"16\": \"icon-16.png\"}}), icon.config.json in the source dir is used if not specified; override is used as is (trim, padding, background and mask are not applied) and output is not cached").String()
+	preset := command.Flag("preset", "write icon set for mobile platform: android (mipmap-*dpi/ic_launcher.png) or ios (AppIcon.appiconset with Contents.json)").Enum("android", "ios")
+	iconName := command.Flag("name", "icon file name (without extension) for hicolor layout, android preset, template format (<name>Template.png) and badge format (<name>-16.scale-100.png, badges.json manifest is also written)").String()
+	templateMode := command.Flag("template-mode", "how alpha of template icon is derived: luminance (dark is opaque), threshold or alpha (silhouette)").Default("luminance").Enum("luminance", "threshold", "alpha")
+	templateThreshold := command.Flag("template-threshold", "luminance (0-255) below which pixel is opaque in threshold template mode").Default("128").Int()
+	templateSize := command.Flag("template-size", "point size of template icon (@2x image is twice as large)").Default("16").Int()
+	resizeOptions := configureResizeFlags(command)
+	isWatch := command.Flag("watch", "watch source files and regenerate output on change (JSON event per regeneration is written to stdout)").Bool()
+	watchInterval := command.Flag("watch-interval", "interval of source files polling").Default("500ms").Duration()
+	isStrict := command.Flag("strict", "fail on icon quality issues (source smaller than recommended or not square, missing retina sizes in icon set, palette without alpha) instead of warning, upscale and pad to square are not applied").Bool()
+	isDryRun := command.Flag("dry-run", "resolve source and write plan (source, sizes, output files) as JSON without writing anything").Bool()
 
 	command.Action(func(context *kingpin.ParseContext) error {
 		configuration.OutputFormat = *iconOutFormat
 		configuration.OutputDir = *outDir
-
-		result, err := ConvertIcon(configuration)
+		configuration.OutputFile = *outFile
+		if len(*outDir) == 0 && len(*outFile) == 0 {
+			return errors.New("output directory (--out) or output file (--output) must be specified")
+		}
+		configuration.MinSize = *minSize
+		configuration.IsUpscale = *isUpscale
+		configuration.IsPadToSquare = *isPadToSquare
+		configuration.IsTrim = *isTrim
+		configuration.Padding = *padding
+		configuration.Background = *background
+		configuration.Mask = *mask
+		configuration.IsMaskShadow = *isMaskShadow
+		configuration.IsLegacy = *isLegacy
+		configuration.IsStrict = *isStrict
+		configuration.IcoOptions = IcoOptions{IsBmpOnly: !*isIcoPng, IsQuantize: *isIcoQuantize}
+		configuration.Layout = *layout
+		configuration.IconName = *iconName
+		configuration.Preset = *preset
+		configuration.SizeConfig = *sizeConfig
+		configuration.TemplateOptions = TemplateOptions{Mode: *templateMode, Threshold: *templateThreshold, Size: *templateSize}
+
+		var err error
+		configuration.ResizeOptions, err = resizeOptions()
+		if err != nil {
+			return err
+		}
+		err = configuration.TemplateOptions.validate()
+		if err != nil {
+			return err
+		}
+		err = validatePreset(configuration.Preset, configuration.OutputFormat, configuration.Layout)
 		if err != nil {
-			switch t := errors.Cause(err).(type) {
-			case *ImageSizeError:
-				log.Debugf("%+v\n", err)
-				return writeUserError(t)
+			return err
+		}
+		err = validatePadding(configuration.Padding)
+		if err != nil {
+			return err
+		}
+		_, err = parseBackground(configuration.Background)
+		if err != nil {
+			return err
+		}
 
-			case *ImageFormatError:
-				log.Debugf("%+v\n", err)
-				return writeUserError(t)
+		if *isDryRun {
+			plan, err := PlanIcon(configuration)
+			if err != nil {
+				return err
+			}
+			return util.WriteJsonToStdOut(plan)
+		}
 
-			default:
+		if *isWatch {
+			watchContext, cancel := util.CreateContext()
+			defer cancel()
+			return WatchIcon(watchContext, configuration, *watchInterval, os.Stdout)
+		}
+
+		result, err := ConvertIcon(util.RootContext(), configuration)
+		if err != nil {
+			userError := toUserError(err)
+			if userError == nil {
 				return err
 			}
+			log.Debugf("%+v\n", err)
+			return writeUserError(userError)
 		}
 
-		return util.WriteJsonToStdOut(result)
+		// consumers expect JSON array of produced files
+		return util.WriteJsonToStdOut(result.Icons)
 	})
 
 	return nil
 }
 
-func ConvertIcon(configuration *IconConvertRequest) (*IconConvertResult, error) {
-	result, err := doConvertIcon(createCommonIconSources(*configuration.Sources, configuration.OutputFormat), *configuration.Roots, configuration.OutputFormat, configuration.OutputDir)
+func convertIcon(ctx context.Context, configuration *IconConvertRequest) (*IconConvertResult, error) {
+	if configuration.IsStrict {
+		// quality issues are errors, so, source is never upscaled or padded (and upscaled output is not restored from cache)
+		strictConfiguration := *configuration
+		strictConfiguration.IsUpscale = false
+		strictConfiguration.IsPadToSquare = false
+		configuration = &strictConfiguration
+	}
+
+	sources, err := downloadRemoteSources(ctx, *configuration.Sources)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, errors.WithStack(ctx.Err())
+	}
+
+	result, err := doConvertIcon(ctx, createCommonIconSources(sources, configuration.OutputFormat), configuration)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +158,15 @@ func ConvertIcon(configuration *IconConvertRequest) (*IconConvertResult, error)
 	// try using fallback sources
 	if result == nil {
 		log.Debug("no icons found, using provided fallback sources")
-		result, err = doConvertIcon(*configuration.FallbackSources, *configuration.Roots, configuration.OutputFormat, configuration.OutputDir)
+		fallbackSources, err := downloadRemoteSources(ctx, *configuration.FallbackSources)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			return nil, errors.WithStack(ctx.Err())
+		}
+
+		result, err = doConvertIcon(ctx, fallbackSources, configuration)
 		if err != nil {
 			return nil, err
 		}
@@ -71,11 +174,21 @@ func ConvertIcon(configuration *IconConvertRequest) (*IconConvertResult, error)
 		isFallback = true
 	}
 
+	if result == nil {
+		// consumers expect JSON array, not null
+		result = []IconInfo{}
+	} else if configuration.OutputFormat == "set" && configuration.Layout == "hicolor" {
+		result, err = writeHicolorLayout(result, configuration.IconName, configuration.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &IconConvertResult{Icons: result, IsFallback: isFallback}, nil
 }
 
 func isFileHasImageFormatExtension(name string, outputFormat string) bool {
-	return strings.HasSuffix(name, "."+outputFormat) || strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".ico") || strings.HasSuffix(name, ".svg") || strings.HasSuffix(name, ".icns")
+	return strings.HasSuffix(name, "."+outputFormat) || strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".ico") || strings.HasSuffix(name, ".svg") || strings.HasSuffix(name, ".icns") || strings.HasSuffix(name, ".webp") || strings.HasSuffix(name, ".avif") || strings.HasSuffix(name, ".gif") || strings.HasSuffix(name, ".bmp") || strings.HasSuffix(name, ".tiff") || strings.HasSuffix(name, ".tif") || strings.HasSuffix(name, ".heic")
 }
 
 func createCommonIconSources(sources []string, outputFormat string) []string {
@@ -95,7 +208,7 @@ func createCommonIconSources(sources []string, outputFormat string) []string {
 }
 
 func appendImageVariants(nameWithoutExt string, nameForSetWithoutExt string, outputFormat string, list []string) []string {
-	if outputFormat != "set" {
+	if outputFormat != "set" && !isProducedFromLargestIcon(outputFormat) {
 		list = append(list, nameWithoutExt+"."+outputFormat)
 	}
 
@@ -114,8 +227,52 @@ func appendImageVariants(nameWithoutExt string, nameForSetWithoutExt string, out
 	return list
 }
 
+// returns nil if error is not caused by the source image (size, format, not square or quality issue in strict mode)
+func toUserError(err error) util.MessageError {
+	switch t := errors.Cause(err).(type) {
+	case *ImageSizeError:
+		return t
+	case *ImageFormatError:
+		return t
+	case *ImageNotSquareError:
+		return t
+	case *IconQualityError:
+		return t
+	case *IcnsEntryFormatError:
+		return t
+	default:
+		return nil
+	}
+}
+
 func writeUserError(error util.MessageError) error {
-	return util.WriteJsonToStdOut(MisConfigurationError{Message: error.Error(), Code: error.ErrorCode()})
+	return util.WriteJsonToStdOut(createMisConfigurationError(error))
+}
+
+func createMisConfigurationError(error util.MessageError) MisConfigurationError {
+	result := MisConfigurationError{Message: error.Error(), Code: error.ErrorCode()}
+	switch t := error.(type) {
+	case *ImageSizeError:
+		result.File = t.File
+		if t.Width != 0 || t.Height != 0 {
+			result.Actual = &ImageSize{Width: t.Width, Height: t.Height}
+		}
+		result.Required = &ImageSize{Width: t.RequiredMinSize, Height: t.RequiredMinSize}
+
+	case *ImageNotSquareError:
+		result.File = t.File
+		result.Actual = &ImageSize{Width: t.Width, Height: t.Height}
+
+	case *ImageFormatError:
+		result.File = t.File
+
+	case *IconQualityError:
+		result.File = t.File
+
+	case *IcnsEntryFormatError:
+		result.File = t.File
+	}
+	return result
 }
 
 func validateImageSize(file string, recommendedMinSize int) error {
@@ -124,11 +281,15 @@ func validateImageSize(file string, recommendedMinSize int) error {
 		return errors.WithStack(err)
 	}
 
+	var maxSize Sizes
 	if IsIco(firstFileBytes) {
 		for _, size := range GetIcoSizes(firstFileBytes) {
 			if size.Width >= recommendedMinSize && size.Height >= recommendedMinSize {
 				return nil
 			}
+			if size.Width*size.Height > maxSize.Width*maxSize.Height {
+				maxSize = size
+			}
 		}
 	} else {
 		config, err := DecodeImageConfig(file)
@@ -139,9 +300,10 @@ func validateImageSize(file string, recommendedMinSize int) error {
 		if config.Width >= recommendedMinSize && config.Height >= recommendedMinSize {
 			return nil
 		}
+		maxSize = Sizes{Width: config.Width, Height: config.Height}
 	}
 
-	return NewImageSizeError(file, recommendedMinSize)
+	return NewImageSizeError(file, maxSize.Width, maxSize.Height, recommendedMinSize)
 }
 
 func outputFormatToSingleFileExtension(outputFormat string) string {
@@ -151,10 +313,8 @@ func outputFormatToSingleFileExtension(outputFormat string) string {
 	return "." + outputFormat
 }
 
-func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, outDir string) ([]IconInfo, error) {
-	// allowed to specify path to icns without extension, so, if file not resolved, try to add ".icns" extension
-	outExt := outputFormatToSingleFileExtension(outputFormat)
-	resolvedPath, fileInfo, err := resolveSourceFile(sourceFiles, roots)
+func doConvertIcon(ctx context.Context, sourceFiles []string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	resolvedPath, fileInfo, err := resolveSourceFile(sourceFiles, configuration.getRoots())
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -165,16 +325,88 @@ func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, ou
 
 	log.WithFields(log.Fields{
 		"path":         resolvedPath,
-		"outputFormat": outputFormat,
+		"outputFormat": configuration.OutputFormat,
 	}).Debug("path resolved")
 
+	sizeOverrides, err := loadSizeOverrides(configuration.SizeConfig, resolvedPath, fileInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := convertResolvedSource(ctx, resolvedPath, fileInfo, sizeOverrides, configuration)
+	if err != nil {
+		return nil, err
+	}
+	// for icns and ico overrides are used instead of produced sizes
+	if configuration.OutputFormat == "set" && len(configuration.Preset) == 0 && len(sizeOverrides) != 0 {
+		return applySizeOverridesToSet(result, sizeOverrides, configuration.OutputDir)
+	}
+	return result, nil
+}
+
+func convertResolvedSource(ctx context.Context, resolvedPath string, fileInfo os.FileInfo, sizeOverrides map[int]string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	outputFormat := configuration.OutputFormat
+	outDir := configuration.OutputDir
+	// allowed to specify path to icns without extension, so, if file not resolved, try to add ".icns" extension
+	outExt := outputFormatToSingleFileExtension(outputFormat)
+
+	var err error
 	var inputInfo InputFileInfo
 	inputInfo.SizeToPath = make(map[int]string)
+	inputInfo.sizeOverrides = sizeOverrides
+
+	inputInfo.recommendedMinSize = configuration.getRecommendedMinSize()
+	inputInfo.isUpscale = configuration.IsUpscale
+	inputInfo.isPadToSquare = configuration.IsPadToSquare
+	inputInfo.isTrim = configuration.IsTrim
+	inputInfo.padding = configuration.Padding
+	inputInfo.mask = configuration.Mask
+	inputInfo.isMaskShadow = configuration.IsMaskShadow
+	inputInfo.background, err = parseBackground(configuration.Background)
+	if err != nil {
+		return nil, err
+	}
+	inputInfo.isLegacy = configuration.IsLegacy
+	inputInfo.icoOptions = configuration.IcoOptions
+	inputInfo.resizeOptions = &configuration.ResizeOptions
+	inputInfo.imageCache = configuration.imageCache
+	inputInfo.ctx = ctx
+
+	// checked before cache is used, so, issue is reported even if output is restored from cache
+	if !fileInfo.IsDir() {
+		err = checkPaletteAlpha(resolvedPath, configuration.IsStrict)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if outputFormat == "icns" {
-		inputInfo.recommendedMinSize = 512
-	} else {
-		inputInfo.recommendedMinSize = 256
+	if isProducedFromLargestIcon(outputFormat) || len(configuration.Preset) != 0 {
+		sourceFile, _, err := resolveLargestIcon(resolvedPath, fileInfo)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(configuration.Preset) != 0:
+			return convertToPreset(&inputInfo, sourceFile, outDir, configuration)
+		case outputFormat == "badge":
+			return convertToBadges(&inputInfo, sourceFile, outDir, configuration)
+		case outputFormat == "favicon":
+			return convertToFavicon(&inputInfo, sourceFile, outDir)
+		default:
+			return convertToTemplate(&inputInfo, sourceFile, outDir, configuration)
+		}
+	}
+
+	if configuration.isTransformed() {
+		// all sizes are produced from the transformed largest icon
+		sourceFile, _, err := resolveLargestIcon(resolvedPath, fileInfo)
+		if err != nil {
+			return nil, err
+		}
+		if outputFormat == "set" {
+			return convertSingleImageToSet(&inputInfo, sourceFile, outDir)
+		}
+		return convertSingleFileUsingCache(&inputInfo, sourceFile, filepath.Join(outDir, "icon"+outExt), configuration)
 	}
 
 	isOutputFormatIco := outputFormat == "ico"
@@ -182,7 +414,11 @@ func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, ou
 		if outputFormat != "icns" {
 			err = validateImageSize(resolvedPath, inputInfo.recommendedMinSize)
 			if err != nil {
-				return nil, errors.WithStack(err)
+				if _, ok := errors.Cause(err).(*ImageSizeError); !ok || !inputInfo.isUpscale {
+					return nil, errors.WithStack(err)
+				}
+				// file is used as is, so, cannot be upscaled
+				log.WithField("file", resolvedPath).Warnf("%s, used as is", err.Error())
 			}
 		}
 
@@ -197,6 +433,11 @@ func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, ou
 		}
 
 		if len(icons) == 0 {
+			err = checkPaletteAlpha(iconFileName, configuration.IsStrict)
+			if err != nil {
+				return nil, err
+			}
+
 			err = configureInputInfoFromSingleFile(iconFileName, isOutputFormatIco, &inputInfo)
 			if err != nil {
 				return nil, errors.WithStack(err)
@@ -210,6 +451,19 @@ func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, ou
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
+
+			for _, icon := range icons {
+				err = checkPaletteAlpha(icon.File, configuration.IsStrict)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if outputFormat == "icns" {
+				err = checkRetinaSizes(resolvedPath, icons, configuration.IsStrict)
+				if err != nil {
+					return nil, err
+				}
+			}
 		}
 
 		if outputFormat == "set" {
@@ -231,23 +485,84 @@ func doConvertIcon(sourceFiles []string, roots []string, outputFormat string, ou
 					return nil, errors.WithStack(err)
 				}
 				return result, nil
-			} else if strings.HasSuffix(resolvedPath, ".svg") {
-				return []IconInfo{
-					{
-						File: resolvedPath,
-						Size: 1024,
-					},
-				}, nil
+			} else if isSvgFile(resolvedPath) {
+				return convertSingleImageToSet(&inputInfo, resolvedPath, outDir)
+			} else if isIcoFile(resolvedPath) {
+				return convertIcoToSet(&inputInfo, resolvedPath, outDir)
 			}
 		}
 
-		err = configureInputInfoFromSingleFile(resolvedPath, isOutputFormatIco, &inputInfo)
+		return convertSingleFileUsingCache(&inputInfo, resolvedPath, filepath.Join(outDir, "icon"+outExt), configuration)
+	}
+
+	return convertSingleFile(&inputInfo, filepath.Join(outDir, "icon"+outExt), outputFormat)
+}
+
+// several files of fixed sizes are produced, source file is never used as is
+func isProducedFromLargestIcon(outputFormat string) bool {
+	return outputFormat == "template" || outputFormat == "badge" || outputFormat == "favicon"
+}
+
+// the largest icon of dir is used for formats produced from a single image, size is 0 if not known without decoding
+func resolveLargestIcon(resolvedPath string, fileInfo os.FileInfo) (string, int, error) {
+	if !fileInfo.IsDir() {
+		return resolvedPath, 0, nil
+	}
+
+	icons, iconFileName, err := CollectIcons(resolvedPath)
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+	if len(icons) == 0 {
+		return iconFileName, 0, nil
+	}
+	maxIcon := icons[len(icons)-1]
+	return maxIcon.File, maxIcon.Size, nil
+}
+
+func convertSingleFileUsingCache(inputInfo *InputFileInfo, sourceFile string, outFile string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	outputFormat := configuration.OutputFormat
+	var cache *iconCache
+	var err error
+	// overrides are not part of the cache key
+	if len(inputInfo.sizeOverrides) == 0 {
+		cache, err = newIconCache(sourceFile, configuration)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 	}
 
-	return convertSingleFile(&inputInfo, filepath.Join(outDir, "icon"+outExt), outputFormat)
+	if cache != nil {
+		isRestored, err := cache.restore(outFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if isRestored {
+			return []IconInfo{{File: outFile}}, nil
+		}
+	}
+
+	var result []IconInfo
+	// embedded images are used as is, so, cannot be used if source is transformed
+	isTransformed := configuration.isTransformed()
+	if outputFormat == "ico" && strings.HasSuffix(sourceFile, ".icns") && !isTransformed {
+		result, err = ConvertIcnsToIco(inputInfo, sourceFile, outFile)
+	} else if outputFormat == "icns" && isIcoFile(sourceFile) && !isTransformed {
+		result, err = convertIcoToIcns(inputInfo, sourceFile, outFile)
+	} else {
+		err = configureInputInfoFromSingleFile(sourceFile, outputFormat == "ico", inputInfo)
+		if err == nil {
+			result, err = convertSingleFile(inputInfo, outFile, outputFormat)
+		}
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if cache != nil {
+		cache.save(outFile)
+	}
+	return result, nil
 }
 
 // https://github.com/electron-userland/electron-builder/issues/2654#issuecomment-369972916
@@ -283,7 +598,7 @@ func resizePngForLinux(inputInfo *InputFileInfo, iconFileName string, outDir str
 		}
 	}
 
-	err := multiResizeImage2(&inputInfo.maxImage, filepath.Join(outDir, "icon_%dx%d.png"), &result, sizeList)
+	err := multiResizeImage2(&inputInfo.maxImage, filepath.Join(outDir, "icon_%dx%d.png"), &result, sizeList, inputInfo.resizeMaxImage)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -293,21 +608,17 @@ func resizePngForLinux(inputInfo *InputFileInfo, iconFileName string, outDir str
 }
 
 func convertSingleFile(inputInfo *InputFileInfo, outFile string, outputFormat string) ([]IconInfo, error) {
+	inputInfo.applySizeOverrides()
 	switch outputFormat {
 	case "icns":
-		err := ConvertToIcns(*inputInfo, outFile)
+		err := ConvertToIcns(inputInfo, outFile)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 		return []IconInfo{{File: outFile}}, err
 
 	case "ico":
-		maxImage, err := inputInfo.GetMaxImage()
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
-
-		err = SaveImage(maxImage, outFile, ICO)
+		err := ConvertToIco(inputInfo, outFile)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -319,38 +630,138 @@ func convertSingleFile(inputInfo *InputFileInfo, outFile string, outputFormat st
 }
 
 func configureInputInfoFromSingleFile(file string, isOutputFormatIco bool, inputInfo *InputFileInfo) error {
-	if strings.HasSuffix(file, ".svg") {
-		inputInfo.MaxIconSize = 1024
-		inputInfo.SizeToPath[inputInfo.MaxIconSize] = file
-		return nil
-	}
-
-	maxImage, err := loadImage(file, inputInfo.recommendedMinSize)
+	maxImage, err := loadImage(file, inputInfo)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	isResized := false
 	if isOutputFormatIco && maxImage.Bounds().Max.X > 256 {
-		image256 := imaging.Resize(maxImage, 256, 256, imaging.Lanczos)
+		image256, err := inputInfo.resizeMaxImage(maxImage, 256)
+		if err != nil {
+			return err
+		}
 		maxImage = image256
+		isResized = true
 	}
 
 	inputInfo.MaxIconSize = maxImage.Bounds().Max.X
 	inputInfo.maxImage = maxImage
-	inputInfo.SizeToPath[inputInfo.MaxIconSize] = file
+	// SVG is rendered and resized or transformed image doesn't match file data, so, file cannot be used as is
+	if !isResized && !isSvgFile(file) && !inputInfo.isTransformed() {
+		inputInfo.SizeToPath[inputInfo.MaxIconSize] = file
+	}
 
 	return nil
 }
 
-func loadImage(sourceFile string, recommendedMinSize int) (image.Image, error) {
-	result, err := LoadImage(sourceFile)
+// rendered (SVG) or transformed image is saved as the max size icon, all other sizes are produced from it
+func convertSingleImageToSet(inputInfo *InputFileInfo, file string, outDir string) ([]IconInfo, error) {
+	err := configureInputInfoFromSingleFile(file, false, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	maxIconFile := filepath.Join(outDir, fmt.Sprintf("icon_%dx%d.png", inputInfo.MaxIconSize, inputInfo.MaxIconSize))
+	err = SaveImage(inputInfo.maxImage, maxIconFile, PNG)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return resizePngForLinux(inputInfo, maxIconFile, outDir)
+}
+
+func loadImage(sourceFile string, inputInfo *InputFileInfo) (image.Image, error) {
+	result, err := inputInfo.imageCache.load(sourceFile)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if result.Bounds().Max.X < recommendedMinSize || result.Bounds().Max.Y < recommendedMinSize {
-		return nil, errors.WithStack(NewImageSizeError(sourceFile, recommendedMinSize))
+	if isSvgFile(sourceFile) {
+		inputInfo.svgDocument, err = readSvg(sourceFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return transformImage(result, sourceFile, inputInfo, 0)
+}
+
+// resizeMaxImage returns image of the size produced from the max image.
+// SVG is rendered at the size (and transformed the same way as the max image), so, small sizes are not blurred by downscaling.
+// Context is checked before every size, so, conversion is stopped on cancel without producing remaining sizes.
+func (t *InputFileInfo) resizeMaxImage(maxImage image.Image, size int) (image.Image, error) {
+	if t.ctx != nil && t.ctx.Err() != nil {
+		return nil, errors.WithStack(t.ctx.Err())
+	}
+
+	if t.svgDocument != nil && maxImage.Bounds().Dx() != size {
+		result, err := t.svgDocument.render(size)
+		if err == nil {
+			result, err = transformImage(result, "", t, size)
+		}
+		if err == nil {
+			return result, nil
+		}
+		log.WithError(err).WithField("size", size).Debug("cannot render SVG at the size, max image is resized")
+	}
+	return t.resizeOptions.resize(maxImage, size), nil
+}
+
+// trim, padding, background and mask are applied to the loaded image.
+// If size is 0, the image is the max image (upscaled if smaller than recommended), otherwise the result is resized to the size (if trim changed it).
+func transformImage(result image.Image, sourceFile string, inputInfo *InputFileInfo, size int) (image.Image, error) {
+	if inputInfo.isTrim {
+		result = trimTransparentBorders(result)
+	}
+
+	// imaging.Resize to square distorts non-square image
+	width := result.Bounds().Dx()
+	height := result.Bounds().Dy()
+	if width != height {
+		if !inputInfo.isPadToSquare {
+			return nil, errors.WithStack(&ImageNotSquareError{File: sourceFile, Width: width, Height: height})
+		}
+
+		size := width
+		if height > size {
+			size = height
+		}
+		log.WithFields(log.Fields{
+			"file":   sourceFile,
+			"width":  width,
+			"height": height,
+		}).Debug("image is not square, padded")
+		result = imaging.PasteCenter(imaging.New(size, size, color.Transparent), result)
 	}
 
+	// padded before size check, so, upscale (if needed) is applied to the whole icon
+	result = addPadding(result, inputInfo.padding)
+
+	recommendedMinSize := inputInfo.recommendedMinSize
+	if size > 0 {
+		if result.Bounds().Dx() != size {
+			result = inputInfo.resizeOptions.resize(result, size)
+		}
+	} else if result.Bounds().Dx() < recommendedMinSize || result.Bounds().Dy() < recommendedMinSize {
+		if !inputInfo.isUpscale {
+			return nil, errors.WithStack(NewImageSizeError(sourceFile, result.Bounds().Dx(), result.Bounds().Dy(), recommendedMinSize))
+		}
+
+		log.WithFields(log.Fields{
+			"file":     sourceFile,
+			"width":    result.Bounds().Dx(),
+			"height":   result.Bounds().Dy(),
+			"upscaled": recommendedMinSize,
+		}).Warn("image is smaller than recommended, upscaled (quality will be poor, please provide larger image)")
+		result = inputInfo.resizeOptions.resize(result, recommendedMinSize)
+	}
+
+	if inputInfo.background != nil {
+		result = flattenOnBackground(result, *inputInfo.background)
+	}
+	// after background, so, background fills the tile and not the whole canvas
+	if inputInfo.mask == "bigsur" {
+		result = applyBigSurMask(result, inputInfo.isMaskShadow, inputInfo.resizeOptions)
+	}
 	return result, nil
 }
@@ -1,20 +1,76 @@
 package icons
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/develar/app-builder/pkg/fs"
 	"github.com/develar/app-builder/pkg/util"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/biessek/golang-ico"
 	"github.com/develar/app-builder/pkg/log-cli"
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
 )
 
+func TestConvertIconResultIsJsonArray(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-result")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{"missing"},
+		FallbackSources: &[]string{},
+		Roots:           &[]string{tmpDir},
+		OutputFormat:    "icns",
+		OutputDir:       tmpDir,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(result.IsFallback).To(BeTrue())
+
+	// icon command writes icons of the result
+	data, err := json.Marshal(result.Icons)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`[]`))
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 256, 256)), filepath.Join(tmpDir, "source.png"), PNG)).To(Succeed())
+	result, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "source.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "ico",
+		OutputDir:       filepath.Join(tmpDir, "out"),
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err = json.Marshal(result.Icons)
+	g.Expect(err).NotTo(HaveOccurred())
+	var icons []map[string]interface{}
+	g.Expect(json.Unmarshal(data, &icons)).To(Succeed())
+	g.Expect(icons).To(HaveLen(1))
+	g.Expect(icons[0]).To(HaveKeyWithValue("file", filepath.Join(tmpDir, "out", "icon.ico")))
+	g.Expect(icons[0]).To(HaveKey("size"))
+	g.Expect(icons[0]).To(HaveKey("icoFrames"))
+}
+
 func TestIcons(t *testing.T) {
 	log_cli.InitLogger()
 	RegisterFailHandler(Fail)
@@ -53,6 +109,10 @@ var _ = Describe("Blockmap", func() {
 		var err error
 		tmpDir, err = ioutil.TempDir("", "")
 		Expect(err).NotTo(HaveOccurred())
+
+		// do not use and pollute user cache
+		err = os.Setenv("ELECTRON_BUILDER_CACHE", filepath.Join(tmpDir, "cache"))
+		Expect(err).NotTo(HaveOccurred())
 	})
 
 	AfterEach(func() {
@@ -61,12 +121,12 @@ var _ = Describe("Blockmap", func() {
 	})
 
 	It("CheckIcoImageSize", func() {
-		_, err := doConvertIcon([]string{filepath.Join(getTestDataPath(), "icon.ico")}, nil, "ico", tmpDir)
+		_, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.ico")}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir})
 		Expect(err).NotTo(HaveOccurred())
 	})
 
 	It("IcnsToIco", func() {
-		files, err := doConvertIcon([]string{filepath.Join(getTestDataPath(), "icon.icns")}, nil, "ico", tmpDir)
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.icns")}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(len(files)).To(Equal(1))
 		file := files[0].File
@@ -76,10 +136,316 @@ var _ = Describe("Blockmap", func() {
 		data, err := ioutil.ReadFile(file)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(GetIcoSizes(data)).To(Equal([]Sizes{
+			{Width: 16, Height: 16},
+			{Width: 24, Height: 24},
+			{Width: 32, Height: 32},
+			{Width: 48, Height: 48},
+			{Width: 64, Height: 64},
+			{Width: 128, Height: 128},
 			{Width: 256, Height: 256},
 		}))
 	})
 
+	It("IcnsToIcoUsesEmbeddedPng", func() {
+		sizeToImage, err := readIcnsPngImages(filepath.Join(getTestDataPath(), "icon.icns"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sizeToImage).To(HaveKey(256))
+
+		files, err := ConvertIcnsToIco(&InputFileInfo{SizeToPath: make(map[int]string), recommendedMinSize: 256}, filepath.Join(getTestDataPath(), "icon.icns"), filepath.Join(tmpDir, "icon.ico"))
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := os.Open(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+		images, err := ico.DecodeAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		// 256 frame is stored without any resampling
+		largest := images[len(images)-1]
+		Expect(largest.Bounds().Max.X).To(Equal(256))
+		expected := sizeToImage[256]
+		for _, point := range []image.Point{{0, 0}, {128, 128}, {200, 60}} {
+			Expect(color.NRGBAModel.Convert(largest.At(point.X, point.Y))).To(Equal(color.NRGBAModel.Convert(expected.At(point.X, point.Y))))
+		}
+	})
+
+	It("IconCache", func() {
+		sourceFile := filepath.Join(getTestDataPath(), "512x512.png")
+		files, err := doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "icns", OutputDir: filepath.Join(tmpDir, "first")})
+		Expect(err).NotTo(HaveOccurred())
+
+		cache, err := newIconCache(sourceFile, &IconConvertRequest{OutputFormat: "icns"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.HasPrefix(cache.file, filepath.Join(tmpDir, "cache"))).To(BeTrue())
+		Expect(cache.file).To(BeARegularFile())
+
+		// cached file is copied as is, without conversion
+		err = ioutil.WriteFile(cache.file, []byte("cached"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		cachedFiles, err := doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "icns", OutputDir: filepath.Join(tmpDir, "second")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cachedFiles[0].File).NotTo(Equal(files[0].File))
+		data, err := ioutil.ReadFile(cachedFiles[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("cached"))
+	})
+
+	It("LoadWebpWithAlpha", func() {
+		file := filepath.Join(getTestDataPath(), "icon-alpha.webp")
+		config, err := DecodeImageConfig(file)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := LoadImage(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Bounds().Dx()).To(Equal(config.Width))
+
+		// corner is transparent
+		_, _, _, alpha := result.At(0, 0).RGBA()
+		Expect(alpha).To(Equal(uint32(0)))
+	})
+
+	It("AvifWithoutDecoder", func() {
+		file := filepath.Join(tmpDir, "icon.avif")
+		err := ioutil.WriteFile(file, []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.Setenv("AVIFDEC_PATH", filepath.Join(tmpDir, "missing-avifdec"))
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Unsetenv("AVIFDEC_PATH")
+
+		_, err = LoadImage(file)
+		formatError, ok := errors.Cause(err).(*ImageFormatError)
+		Expect(ok).To(BeTrue())
+		Expect(formatError.ErrorCode()).To(Equal("ERR_ICON_AVIF_NOT_SUPPORTED"))
+	})
+
+	It("HeicWithoutDecoder", func() {
+		file := filepath.Join(tmpDir, "icon.heic")
+		err := ioutil.WriteFile(file, []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = os.Setenv("HEIF_CONVERT_PATH", filepath.Join(tmpDir, "missing-heif-convert"))
+		Expect(err).NotTo(HaveOccurred())
+		defer os.Unsetenv("HEIF_CONVERT_PATH")
+
+		_, err = LoadImage(file)
+		formatError, ok := errors.Cause(err).(*ImageFormatError)
+		Expect(ok).To(BeTrue())
+		Expect(formatError.ErrorCode()).To(Equal("ERR_ICON_HEIC_NOT_SUPPORTED"))
+	})
+
+	It("BmpAndTiffSources", func() {
+		sourceImage, err := LoadImage(filepath.Join(getTestDataPath(), "512x512.png"))
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, name := range []string{"icon.bmp", "icon.tiff"} {
+			file := filepath.Join(tmpDir, name)
+			writer, err := os.Create(file)
+			Expect(err).NotTo(HaveOccurred())
+			if strings.HasSuffix(name, ".bmp") {
+				err = bmp.Encode(writer, sourceImage)
+			} else {
+				err = tiff.Encode(writer, sourceImage, nil)
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(writer.Close()).NotTo(HaveOccurred())
+
+			result, err := ConvertIcon(context.Background(), &IconConvertRequest{Sources: &[]string{file}, FallbackSources: &[]string{}, OutputFormat: "icns", OutputDir: filepath.Join(tmpDir, name+"-out")})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Icons).To(HaveLen(1))
+			Expect(result.Icons[0].File).To(HaveSuffix(".icns"))
+		}
+	})
+
+	It("SmallImageUpscale", func() {
+		sourceFile := filepath.Join(getTestDataPath(), "512x512.png")
+		_, err := doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "icns", OutputDir: tmpDir, MinSize: 1024})
+		sizeError, ok := errors.Cause(err).(*ImageSizeError)
+		Expect(ok).To(BeTrue())
+		Expect(sizeError.Error()).To(HaveSuffix("must be at least 1024x1024, but it is 512x512"))
+		data, err := json.Marshal(createMisConfigurationError(sizeError))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal(fmt.Sprintf(`{"error":%q,"errorCode":"ERR_ICON_TOO_SMALL","file":%q,"actual":{"width":512,"height":512},"required":{"width":1024,"height":1024}}`, sizeError.Error(), sourceFile)))
+
+		files, err := doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "icns", OutputDir: tmpDir, MinSize: 1024, IsUpscale: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := os.Open(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+		typeToImage, err := ReadIcns(bufio.NewReader(reader))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typeToImage).To(HaveKey(ICNS_1024))
+	})
+
+	It("MaxImageIsLoadedOnce", func() {
+		inputInfo := &InputFileInfo{
+			MaxIconPath: filepath.Join(getTestDataPath(), "512x512.png"),
+			MaxIconSize: 512,
+			SizeToPath:  make(map[int]string),
+		}
+
+		err := ConvertToIcns(inputInfo, filepath.Join(tmpDir, "icon.icns"))
+		Expect(err).NotTo(HaveOccurred())
+		// length in the header is patched after streaming of entries
+		data, err := ioutil.ReadFile(filepath.Join(tmpDir, "icon.icns"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(int(binary.BigEndian.Uint32(data[4:]))).To(Equal(len(data)))
+
+		// TOC is the first entry and lists all other entries
+		Expect(string(data[8:12])).To(Equal(icnsTocType))
+		tocLength := int(binary.BigEndian.Uint32(data[12:]))
+		offset := 8 + tocLength
+		for tocOffset := 16; tocOffset < 8+tocLength; tocOffset += 8 {
+			Expect(data[offset : offset+8]).To(Equal(data[tocOffset : tocOffset+8]))
+			offset += int(binary.BigEndian.Uint32(data[tocOffset+4:]))
+		}
+		Expect(offset).To(Equal(len(data)))
+
+		typeToImage, err := ReadIcns(bufio.NewReader(bytes.NewReader(data)))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typeToImage).NotTo(HaveKey(icnsTocType))
+
+		// entries of the same pixel size share data
+		image256 := typeToImage[ICNS_256]
+		image256Retina := typeToImage[ICNS_256_RETINA]
+		Expect(data[image256Retina.Offset : image256Retina.Offset+image256Retina.Length]).To(Equal(data[image256.Offset : image256.Offset+image256.Length]))
+
+		// image decoded during ICNS generation is kept and shared
+		Expect(inputInfo.maxImage).NotTo(BeNil())
+		maxImage, err := inputInfo.GetMaxImage()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(maxImage).To(BeIdenticalTo(inputInfo.maxImage))
+	})
+
+	It("CollectAndValidateIcons", func() {
+		iconDir := filepath.Join(tmpDir, "icons")
+		err := fs.CopyDirOrFile(filepath.Join(getTestDataPath(), "512x512.png"), filepath.Join(iconDir, "512x512.png"))
+		Expect(err).NotTo(HaveOccurred())
+		err = fs.CopyDirOrFile(filepath.Join(getTestDataPath(), "512x512.png"), filepath.Join(iconDir, "512x512-dev.png"))
+		Expect(err).NotTo(HaveOccurred())
+		err = SaveImage(image.NewNRGBA(image.Rect(0, 0, 32, 16)), filepath.Join(iconDir, "wide.png"), PNG)
+		Expect(err).NotTo(HaveOccurred())
+		err = SaveImage(image.NewNRGBA(image.Rect(0, 0, 8, 8)), filepath.Join(iconDir, "8x8.png"), PNG)
+		Expect(err).NotTo(HaveOccurred())
+		err = SaveImage(image.NewNRGBA(image.Rect(0, 0, 32, 32)), filepath.Join(iconDir, "small.png"), PNG)
+		Expect(err).NotTo(HaveOccurred())
+		err = ioutil.WriteFile(filepath.Join(iconDir, "readme.txt"), []byte("not an image"), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := CollectAndValidateIcons(iconDir, 16)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Icons).To(Equal([]IconInfo{
+			{File: filepath.Join(iconDir, "small.png"), Size: 32},
+			{File: filepath.Join(iconDir, "512x512.png"), Size: 512},
+		}))
+
+		var skipped []string
+		for _, warning := range result.Warnings {
+			skipped = append(skipped, filepath.Base(warning.File))
+		}
+		Expect(skipped).To(ConsistOf("512x512-dev.png", "8x8.png", "readme.txt", "wide.png"))
+	})
+
+	It("NonSquareImage", func() {
+		sourceFile := filepath.Join(tmpDir, "wide.png")
+		err := SaveImage(imaging.New(600, 300, color.White), sourceFile, PNG)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir})
+		_, ok := errors.Cause(err).(*ImageNotSquareError)
+		Expect(ok).To(BeTrue())
+
+		files, err := doConvertIcon(context.Background(), []string{sourceFile}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir, IsPadToSquare: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := os.Open(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+		images, err := ico.DecodeAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		padded := images[len(images)-1]
+		Expect(padded.Bounds().Dx()).To(Equal(256))
+
+		// transparent padding on top and bottom, image is centered
+		_, _, _, alpha := padded.At(128, 10).RGBA()
+		Expect(alpha).To(Equal(uint32(0)))
+		_, _, _, alpha = padded.At(128, 128).RGBA()
+		Expect(alpha).To(Equal(uint32(0xffff)))
+	})
+
+	It("IcnsInfo", func() {
+		info, err := ReadIcnsInfo(filepath.Join(getTestDataPath(), "icon-jpeg2.icns"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.HasToc).To(BeFalse())
+		Expect(info.Entries).To(HaveLen(10))
+		Expect(info.Entries[0]).To(Equal(IcnsEntryInfo{Type: "is32", Offset: 16, Length: 392, Format: "rle", Width: 16, Height: 16, PointSize: 16, Scale: 1}))
+		Expect(info.Entries[9].Format).To(Equal("jpeg2000"))
+		Expect(info.MissingRetina).To(Equal([]int{16, 32, 128, 256, 512}))
+
+		icnsFile := filepath.Join(tmpDir, "icon.icns")
+		err = ConvertToIcns(&InputFileInfo{
+			MaxIconPath: filepath.Join(getTestDataPath(), "512x512.png"),
+			MaxIconSize: 512,
+			SizeToPath:  make(map[int]string),
+		}, icnsFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err = ReadIcnsInfo(icnsFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.HasToc).To(BeTrue())
+		Expect(info.Entries[0].Format).To(Equal("toc"))
+		for _, entry := range info.Entries[1:] {
+			Expect(entry.Format).To(Equal("png"))
+			Expect(entry.Width).To(Equal(entry.PointSize * entry.Scale))
+		}
+		// 512x512 source, so, 512@2x (1024) cannot be produced
+		Expect(info.MissingRetina).To(Equal([]int{512}))
+	})
+
+	It("IcnsLegacy", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "512x512.png")}, &IconConvertRequest{OutputFormat: "icns", OutputDir: tmpDir, IsLegacy: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := ReadIcnsInfo(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		typeToEntry := make(map[string]IcnsEntryInfo)
+		for _, entry := range info.Entries {
+			typeToEntry[entry.Type] = entry
+		}
+		for _, osType := range []string{"is32", "il32", "ih32", "it32"} {
+			Expect(typeToEntry).To(HaveKey(osType))
+			Expect(typeToEntry[osType].Format).To(Equal("rle"))
+		}
+		Expect(typeToEntry["t8mk"].Length).To(Equal(128 * 128))
+
+		data, err := ioutil.ReadFile(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		it32 := typeToEntry["it32"]
+		Expect(data[it32.Offset : it32.Offset+4]).To(Equal([]byte{0, 0, 0, 0}))
+		rgb, err := decodeIcnsRle(data[it32.Offset+4:it32.Offset+it32.Length], 3*128*128)
+		Expect(err).NotTo(HaveOccurred())
+
+		source, err := LoadImage(filepath.Join(getTestDataPath(), "512x512.png"))
+		Expect(err).NotTo(HaveOccurred())
+		expected := imaging.Resize(source, 128, 128, imaging.Lanczos)
+		t8mk := typeToEntry["t8mk"]
+		for _, point := range []image.Point{{64, 64}, {40, 90}} {
+			pixel := expected.NRGBAAt(point.X, point.Y)
+			index := point.Y*128 + point.X
+			Expect([]uint8{rgb[index], rgb[128*128+index], rgb[2*128*128+index], data[t8mk.Offset+index]}).To(Equal([]uint8{pixel.R, pixel.G, pixel.B, pixel.A}))
+		}
+	})
+
+	It("IcnsRle", func() {
+		for _, input := range [][]byte{{}, {1}, {1, 1}, {1, 1, 1}, bytes.Repeat([]byte{7}, 300), []byte(strings.Repeat("abcdefgh", 40)), append(bytes.Repeat([]byte{1}, 131), 2, 3, 3, 3, 3)} {
+			decoded, err := decodeIcnsRle(appendIcnsRle(nil, input), len(input))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(input))
+		}
+	})
+
 	It("IcnsToPng", func() {
 		result, err := ConvertIcnsToPngUsingOpenJpeg(filepath.Join(getTestDataPath(), "icon.icns"), tmpDir)
 		Expect(err).NotTo(HaveOccurred())
@@ -93,8 +459,203 @@ var _ = Describe("Blockmap", func() {
 		//Expect(len(result)).To(Equal(2))
 	})
 
+	It("IcnsJpeg2000WithoutOpenJpeg", func() {
+		// system opj_decompress is not found in the empty PATH
+		path := os.Getenv("PATH")
+		Expect(os.Setenv("USE_SYSTEM_OPG", "true")).NotTo(HaveOccurred())
+		Expect(os.Setenv("PATH", tmpDir)).NotTo(HaveOccurred())
+		defer func() {
+			Expect(os.Unsetenv("USE_SYSTEM_OPG")).NotTo(HaveOccurred())
+			Expect(os.Setenv("PATH", path)).NotTo(HaveOccurred())
+		}()
+
+		_, err := ConvertIcnsToPngUsingOpenJpeg(filepath.Join(getTestDataPath(), "icon-jpeg2.icns"), tmpDir)
+		formatError, ok := errors.Cause(err).(*IcnsEntryFormatError)
+		Expect(ok).To(BeTrue())
+		Expect(formatError.ErrorCode()).To(Equal("ERR_ICON_JPEG2000_NOT_SUPPORTED"))
+		Expect(formatError.Types).To(Equal([]string{"ic08", "ic09"}))
+		Expect(formatError.Error()).To(ContainSubstring("(ic08, ic09)"))
+	})
+
+	It("IcnsWithoutSupportedEntries", func() {
+		// only legacy RLE entry and entry in unknown format
+		var data []byte
+		for _, entry := range []struct {
+			osType string
+			data   []byte
+		}{{"is32", make([]byte, 4)}, {"ic07", []byte("unknown data")}} {
+			data = append(data, entry.osType...)
+			data = binary.BigEndian.AppendUint32(data, uint32(len(entry.data)+8))
+			data = append(data, entry.data...)
+		}
+		header := binary.BigEndian.AppendUint32([]byte("icns"), uint32(len(data)+8))
+		icnsFile := filepath.Join(tmpDir, "unknown.icns")
+		Expect(ioutil.WriteFile(icnsFile, append(header, data...), 0644)).NotTo(HaveOccurred())
+
+		_, err := ConvertIcnsToPngUsingOpenJpeg(icnsFile, tmpDir)
+		formatError, ok := errors.Cause(err).(*IcnsEntryFormatError)
+		Expect(ok).To(BeTrue())
+		Expect(formatError.ErrorCode()).To(Equal("ERR_ICON_ICNS_NO_SUPPORTED_ENTRIES"))
+		Expect(formatError.Types).To(Equal([]string{"ic07", "is32"}))
+	})
+
+	It("SvgToIcns", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.svg")}, &IconConvertRequest{OutputFormat: "icns", OutputDir: tmpDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(files)).To(Equal(1))
+
+		reader, err := os.Open(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+
+		typeToImage, err := ReadIcns(bufio.NewReader(reader))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(typeToImage).To(HaveKey(ICNS_1024))
+
+		// retina entries are encoded from the double size image
+		for _, entry := range icnsEntries {
+			subImage, ok := typeToImage[entry.OSType]
+			if !ok {
+				Expect(entry.PixelSize()).To(Equal(16))
+				continue
+			}
+
+			_, err = reader.Seek(int64(subImage.Offset), 0)
+			Expect(err).NotTo(HaveOccurred())
+			config, err := png.DecodeConfig(bufio.NewReader(reader))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Width).To(Equal(entry.PixelSize()))
+		}
+	})
+
+	It("SvgToSet", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.svg")}, &IconConvertRequest{OutputFormat: "set", OutputDir: tmpDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files[len(files)-1].Size).To(Equal(1024))
+
+		for _, file := range files {
+			Expect(strings.HasSuffix(file.File, ".png")).To(BeTrue())
+			config, err := DecodeImageConfig(file.File)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(config.Width).To(Equal(file.Size))
+		}
+	})
+
+	It("SetHicolorLayout", func() {
+		result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+			Sources:      &[]string{filepath.Join(getTestDataPath(), "icon.svg")},
+			OutputFormat: "set",
+			OutputDir:    tmpDir,
+			Layout:       "hicolor",
+			IconName:     "foo",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, icon := range result.Icons {
+			Expect(icon.File).To(Equal(filepath.Join(tmpDir, "hicolor", fmt.Sprintf("%dx%d", icon.Size, icon.Size), "apps", "foo.png")))
+			Expect(icon.File).To(BeARegularFile())
+		}
+
+		indexTheme, err := ioutil.ReadFile(filepath.Join(tmpDir, "hicolor", "index.theme"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(indexTheme)).To(ContainSubstring("Directories=16x16/apps,"))
+		Expect(string(indexTheme)).To(ContainSubstring("[1024x1024/apps]\nSize=1024\n"))
+	})
+
+	It("IcoToSetKeepsFrames", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.ico")}, &IconConvertRequest{OutputFormat: "set", OutputDir: tmpDir})
+		Expect(err).NotTo(HaveOccurred())
+
+		var sizes []int
+		for _, file := range files {
+			sizes = append(sizes, file.Size)
+		}
+		// 192 frame is preserved, 512 is not produced (no upscale)
+		Expect(sizes).To(Equal([]int{16, 24, 32, 48, 64, 96, 128, 192, 256}))
+
+		// frame is extracted as is, not downscaled from the largest one
+		reader, err := os.Open(filepath.Join(getTestDataPath(), "icon.ico"))
+		Expect(err).NotTo(HaveOccurred())
+		frames, err := ico.DecodeAll(reader)
+		util.Close(reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		extracted, err := LoadImage(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(extracted.Bounds().Dx()).To(Equal(16))
+		for _, point := range []image.Point{{0, 0}, {8, 8}, {4, 11}} {
+			Expect(color.NRGBAModel.Convert(extracted.At(point.X, point.Y))).To(Equal(color.NRGBAModel.Convert(frames[0].At(point.X, point.Y))))
+		}
+	})
+
+	It("IcoToIcns", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.ico")}, &IconConvertRequest{OutputFormat: "icns", OutputDir: tmpDir, MinSize: 256})
+		Expect(err).NotTo(HaveOccurred())
+
+		reader, err := os.Open(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+		typeToImage, err := ReadIcns(bufio.NewReader(reader))
+		Expect(err).NotTo(HaveOccurred())
+		// 16 is not produced by downscaling, but frame exists
+		Expect(typeToImage).To(HaveKey("icp4"))
+		Expect(typeToImage).To(HaveKey(ICNS_256))
+	})
+
+	It("RenderSvg", func() {
+		result, err := RenderSvg(filepath.Join(getTestDataPath(), "icon.svg"), 64)
+		Expect(err).NotTo(HaveOccurred())
+
+		// transparent margin
+		_, _, _, alpha := result.At(1, 1).RGBA()
+		Expect(alpha).To(Equal(uint32(0)))
+
+		// gradient background
+		r, _, b, alpha := result.At(32, 8).RGBA()
+		Expect(alpha).To(Equal(uint32(0xffff)))
+		Expect(b > r).To(BeTrue())
+
+		// white stroke of horizontal line
+		r, g, b, _ := result.At(32, 32).RGBA()
+		Expect([]uint32{r, g, b}).To(Equal([]uint32{0xffff, 0xffff, 0xffff}))
+	})
+
+	It("SvgToSetRendersEverySize", func() {
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "icon.svg")}, &IconConvertRequest{OutputFormat: "set", OutputDir: tmpDir})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files[0].Size).To(Equal(16))
+
+		// small size is rendered, not downscaled from 1024
+		rendered, err := RenderSvg(filepath.Join(getTestDataPath(), "icon.svg"), 16)
+		Expect(err).NotTo(HaveOccurred())
+		produced, err := LoadImage(files[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		for _, point := range []image.Point{{1, 1}, {8, 2}, {8, 8}, {4, 11}} {
+			Expect(color.NRGBAModel.Convert(produced.At(point.X, point.Y))).To(Equal(color.NRGBAModel.Convert(rendered.At(point.X, point.Y))))
+		}
+	})
+
+	It("SvgUseCycle", func() {
+		file := filepath.Join(tmpDir, "cycle.svg")
+		err := ioutil.WriteFile(file, []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16"><g id="a"><rect width="8" height="8"/><use href="#a" x="1"/></g></svg>`), 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = RenderSvg(file, 16)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("references itself"))
+	})
+
+	It("CancelStopsResize", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := doConvertIcon(ctx, []string{filepath.Join(getTestDataPath(), "512x512.png")}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir})
+		Expect(errors.Cause(err)).To(Equal(context.Canceled))
+		Expect(filepath.Join(tmpDir, "icon.ico")).NotTo(BeAnExistingFile())
+	})
+
 	It("LargePngTo256Ico", func() {
-		files, err := doConvertIcon([]string{filepath.Join(getTestDataPath(), "512x512.png")}, nil, "ico", tmpDir)
+		files, err := doConvertIcon(context.Background(), []string{filepath.Join(getTestDataPath(), "512x512.png")}, &IconConvertRequest{OutputFormat: "ico", OutputDir: tmpDir})
 		Expect(err).NotTo(HaveOccurred())
 		Expect(len(files)).To(Equal(1))
 		file := files[0].File
@@ -106,10 +667,170 @@ var _ = Describe("Blockmap", func() {
 		images, err := ico.DecodeAll(reader)
 		Expect(err).NotTo(HaveOccurred())
 
-		Expect(len(images)).To(Equal(1))
+		Expect(len(images)).To(Equal(len(icoSizes)))
+		for index, size := range icoSizes {
+			Expect(images[index].Bounds().Max.X).To(Equal(size))
+		}
 
-		imageSize := images[0].Bounds().Max
+		// BMP frame keeps colors, transparency and row order
+		sourceImage, err := LoadImage(filepath.Join(getTestDataPath(), "512x512.png"))
+		Expect(err).NotTo(HaveOccurred())
+		// ICO source image is downscaled to 256 first
+		expectedImage := imaging.Resize(imaging.Resize(sourceImage, 256, 256, imaging.Lanczos), 16, 16, imaging.Lanczos)
+		for _, point := range []image.Point{{0, 0}, {8, 3}, {8, 8}, {15, 15}} {
+			Expect(color.NRGBAModel.Convert(images[0].At(point.X, point.Y))).To(Equal(expectedImage.At(point.X, point.Y)))
+		}
+
+		imageSize := images[len(images)-1].Bounds().Max
 		Expect(imageSize.X).To(Equal(256))
 		Expect(imageSize.Y).To(Equal(256))
 	})
+
+	It("Cancelled", func() {
+		outDir := filepath.Join(tmpDir, "cancelled")
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := ConvertIcon(ctx, &IconConvertRequest{Sources: &[]string{filepath.Join(getTestDataPath(), "512x512.png")}, FallbackSources: &[]string{}, OutputFormat: "icns", OutputDir: outDir})
+		Expect(errors.Cause(err)).To(Equal(context.Canceled))
+		// staging dir is removed
+		files, err := ioutil.ReadDir(outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(BeEmpty())
+	})
+
+	It("OutputFile", func() {
+		outDir := filepath.Join(tmpDir, "output-file")
+		outFile := filepath.Join(outDir, "build", "app.icns")
+		sourceFile := filepath.Join(getTestDataPath(), "512x512.png")
+		result, err := ConvertIcon(context.Background(), &IconConvertRequest{Sources: &[]string{sourceFile}, FallbackSources: &[]string{}, OutputFormat: "icns", OutputFile: outFile})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(withoutIconMetadata(result.Icons)).To(Equal([]IconInfo{{File: outFile}}))
+		Expect(outFile).To(BeAnExistingFile())
+
+		// staging dir is removed, nothing is left on failure
+		_, err = ConvertIcon(context.Background(), &IconConvertRequest{Sources: &[]string{sourceFile}, FallbackSources: &[]string{}, OutputFormat: "icns", OutputDir: outDir, MinSize: 1024})
+		Expect(err).To(HaveOccurred())
+		files, err := ioutil.ReadDir(outDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+		Expect(files[0].Name()).To(Equal("build"))
+
+		// existing icon is copied as is
+		icoFile := filepath.Join(outDir, "app.ico")
+		result, err = ConvertIcon(context.Background(), &IconConvertRequest{Sources: &[]string{filepath.Join(getTestDataPath(), "icon.ico")}, FallbackSources: &[]string{}, OutputFormat: "ico", OutputFile: icoFile})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Icons[0].File).To(Equal(icoFile))
+		Expect(icoFile).To(BeAnExistingFile())
+	})
+
+	It("IcoOptionsAndReport", func() {
+		sourceFile := filepath.Join(getTestDataPath(), "512x512.png")
+		result, err := ConvertIcon(context.Background(), &IconConvertRequest{Sources: &[]string{sourceFile}, FallbackSources: &[]string{}, OutputFormat: "ico", OutputDir: filepath.Join(tmpDir, "default")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Icons[0].IcoFrames).To(HaveLen(len(icoSizes)))
+		Expect(result.Icons[0].IcoFrames[len(icoSizes)-1]).To(Equal(IcoFrameInfo{Size: 256, Format: "png", BitsPerPixel: 32, Length: result.Icons[0].IcoFrames[len(icoSizes)-1].Length}))
+		defaultSize := result.Icons[0].Bytes
+
+		result, err = ConvertIcon(context.Background(), &IconConvertRequest{
+			Sources:         &[]string{sourceFile},
+			FallbackSources: &[]string{},
+			OutputFormat:    "ico",
+			OutputDir:       filepath.Join(tmpDir, "quantized"),
+			IcoOptions:      IcoOptions{IsQuantize: true},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Icons[0].Bytes).To(BeNumerically("<", defaultSize))
+		for _, frame := range result.Icons[0].IcoFrames {
+			if frame.Size == 16 || frame.Size == 32 {
+				Expect(frame.BitsPerPixel).To(Equal(8))
+				Expect(frame.Format).To(Equal("bmp"))
+			} else {
+				Expect(frame.BitsPerPixel).To(Equal(32))
+			}
+		}
+
+		reader, err := os.Open(result.Icons[0].File)
+		Expect(err).NotTo(HaveOccurred())
+		defer util.Close(reader)
+		images, err := ico.DecodeAll(reader)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images[0].Bounds().Max.X).To(Equal(16))
+
+		// palette frame keeps transparency (1-bit) and approximate colors
+		sourceImage, err := LoadImage(sourceFile)
+		Expect(err).NotTo(HaveOccurred())
+		expectedImage := imaging.Resize(imaging.Resize(sourceImage, 256, 256, imaging.Lanczos), 16, 16, imaging.Lanczos)
+		for _, point := range []image.Point{{0, 0}, {8, 8}, {15, 15}} {
+			expected := color.NRGBAModel.Convert(expectedImage.At(point.X, point.Y)).(color.NRGBA)
+			actual := color.NRGBAModel.Convert(images[0].At(point.X, point.Y)).(color.NRGBA)
+			Expect(actual.A == 255).To(Equal(expected.A >= 128))
+			if actual.A == 255 {
+				Expect(actual.R).To(BeNumerically("~", expected.R, 16))
+				Expect(actual.G).To(BeNumerically("~", expected.G, 16))
+				Expect(actual.B).To(BeNumerically("~", expected.B, 16))
+			}
+		}
+
+		result, err = ConvertIcon(context.Background(), &IconConvertRequest{
+			Sources:         &[]string{sourceFile},
+			FallbackSources: &[]string{},
+			OutputFormat:    "ico",
+			OutputDir:       filepath.Join(tmpDir, "bmp"),
+			IcoOptions:      IcoOptions{IsBmpOnly: true},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Icons[0].IcoFrames[len(icoSizes)-1].Format).To(Equal("bmp"))
+		Expect(result.Icons[0].Bytes).To(BeNumerically(">", defaultSize))
+	})
+
+	It("Batch", func() {
+		sourceFile := filepath.Join(getTestDataPath(), "512x512.png")
+		outDir := filepath.Join(tmpDir, "batch")
+		results, err := ConvertIconBatch(context.Background(), []IconBatchJob{
+			{Sources: []string{sourceFile}, Format: "icns", Out: filepath.Join(outDir, "mac")},
+			{Sources: []string{sourceFile}, Format: "ico", Output: filepath.Join(outDir, "win", "app.ico")},
+			{Sources: []string{sourceFile}, Format: "set", Out: filepath.Join(outDir, "linux")},
+			{Sources: []string{sourceFile}, Format: "icns", Out: filepath.Join(outDir, "too-small"), MinSize: 1024},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(results).To(HaveLen(4))
+		Expect(withoutIconMetadata(results[0].Icons)).To(Equal([]IconInfo{{File: filepath.Join(outDir, "mac", "icon.icns")}}))
+		Expect(withoutIconMetadata(results[1].Icons)).To(Equal([]IconInfo{{File: filepath.Join(outDir, "win", "app.ico")}}))
+		Expect(results[1].Icons[0].IcoFrames).To(HaveLen(len(icoSizes)))
+		// png source is used as is for icon set
+		Expect(withoutIconMetadata(results[2].Icons)).To(Equal([]IconInfo{{File: sourceFile}}))
+		Expect(results[3].IconConvertResult).To(BeNil())
+		Expect(results[3].Error.Code).To(Equal("ERR_ICON_TOO_SMALL"))
+
+		_, err = ConvertIconBatch(context.Background(), []IconBatchJob{{Sources: []string{sourceFile}, Format: "png", Out: outDir}})
+		Expect(err).To(HaveOccurred())
+	})
 })
+
+func decodeIcnsRle(data []byte, pixelCount int) ([]byte, error) {
+	result := make([]byte, 0, pixelCount)
+	for i := 0; i < len(data) && len(result) < pixelCount; {
+		control := int(data[i])
+		i++
+		if control < 0x80 {
+			count := control + 1
+			if i+count > len(data) {
+				return nil, errors.New("invalid RLE data")
+			}
+			result = append(result, data[i:i+count]...)
+			i += count
+		} else {
+			if i >= len(data) {
+				return nil, errors.New("invalid RLE data")
+			}
+			for j := 0; j < control-0x80+3; j++ {
+				result = append(result, data[i])
+			}
+			i++
+		}
+	}
+	if len(result) != pixelCount {
+		return nil, errors.Errorf("invalid RLE data: expected %d bytes, got %d", pixelCount, len(result))
+	}
+	return result, nil
+}
@@ -1,8 +1,11 @@
 package icons
 
 import (
+	"context"
 	"image"
+	"image/color"
 	"sort"
+	"sync"
 
 	"github.com/develar/errors"
 )
@@ -10,6 +13,16 @@ import (
 type IconInfo struct {
 	File string `json:"file"`
 	Size int    `json:"size"`
+
+	// set for files of the conversion result, for ICNS and ICO dimensions of the largest entry are reported
+	Bytes  int64  `json:"bytes,omitempty"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Format string `json:"format,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+
+	// for ICO only, size report of frames
+	IcoFrames []IcoFrameInfo `json:"icoFrames,omitempty"`
 }
 
 func sortBySize(list []IconInfo) {
@@ -23,6 +36,77 @@ type IconConvertRequest struct {
 
 	OutputFormat string
 	OutputDir    string
+	// for icns and ico output formats only, explicit output file instead of icon.<format> in the output dir
+	OutputFile string
+
+	// if 0, default is used (512 for icns, 256 otherwise)
+	MinSize int
+	// if source image is smaller than min size, upscale it (using resize filter) with a warning instead of failing
+	IsUpscale bool
+	// non-square source image is padded to square with transparent pixels (centered) instead of failing
+	IsPadToSquare bool
+	// crop transparent borders of source image (applied before resize)
+	IsTrim bool
+	// transparent margin on each side in percent of icon size (applied before resize)
+	Padding float64
+	// opaque color to flatten transparency onto (hex, rgb() or CSS color name), empty to keep alpha
+	Background string
+	// "bigsur" to compose source onto macOS 11+ rounded square tile (applied after background)
+	Mask         string
+	IsMaskShadow bool
+	// quality issues (missing retina sizes in icon set, palette without alpha) are errors instead of warnings, upscale and pad to square are not applied
+	IsStrict bool
+	// for icns output format only, also write legacy 24-bit RLE entries with 8-bit masks (is32/s8mk, il32/l8mk, ih32/h8mk, it32/t8mk)
+	IsLegacy bool
+	// for ico output format only
+	IcoOptions IcoOptions
+	// resize filter and sharpening of produced sizes
+	ResizeOptions ResizeOptions
+	// for template output format only
+	TemplateOptions TemplateOptions
+
+	// for "set" output format only, "hicolor" to write icons into the freedesktop hicolor icon theme layout
+	Layout string
+	// for "set" output format only, "android" (mipmap-*dpi dirs) or "ios" (AppIcon.appiconset with Contents.json)
+	Preset string
+	// JSON file with explicit source files per size, if empty, icon.config.json in the source dir (or next to the source file) is used if exists
+	SizeConfig string
+	// icon file name (without extension) for hicolor layout, android preset, template and badge output formats
+	IconName string
+
+	// set for batch jobs to decode the same source image only once
+	imageCache *decodedImageCache
+}
+
+func (t *IconConvertRequest) getRoots() []string {
+	if t.Roots == nil {
+		return nil
+	}
+	return *t.Roots
+}
+
+// source image is modified, so, neither source file nor provided sizes can be used as is
+func (t *IconConvertRequest) isTransformed() bool {
+	return t.IsTrim || t.Padding > 0 || len(t.Background) != 0 || len(t.Mask) != 0
+}
+
+func (t *IconConvertRequest) getRecommendedMinSize() int {
+	if t.MinSize > 0 {
+		return t.MinSize
+	} else if len(t.Preset) != 0 {
+		return getPresetMinSize(t.Preset)
+	} else if t.OutputFormat == "icns" {
+		return 512
+	} else if t.OutputFormat == "template" {
+		// only @2x image is required
+		return t.TemplateOptions.getSize() * 2
+	} else if t.OutputFormat == "badge" {
+		return maxBadgePixelSize
+	} else if t.OutputFormat == "favicon" {
+		return faviconMinSize
+	} else {
+		return 256
+	}
 }
 
 type IconConvertResult struct {
@@ -33,6 +117,15 @@ type IconConvertResult struct {
 type MisConfigurationError struct {
 	Message string `json:"error"`
 	Code    string `json:"errorCode"`
+
+	File     string     `json:"file,omitempty"`
+	Actual   *ImageSize `json:"actual,omitempty"`
+	Required *ImageSize `json:"required,omitempty"`
+}
+
+type ImageSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
 }
 
 type InputFileInfo struct {
@@ -40,18 +133,50 @@ type InputFileInfo struct {
 	MaxIconPath string
 	SizeToPath  map[int]string
 
-	maxImage image.Image
+	// decoded once and shared by all generated sizes and formats, must not be copied (pass InputFileInfo by pointer)
+	maxImage      image.Image
+	maxImageOnce  sync.Once
+	maxImageError error
+	// already decoded images (e.g. extracted from ICNS), take precedence over SizeToPath
+	sizeToImage map[int]image.Image
+	// explicit source files per size (icon.config.json), take precedence over SizeToPath and sizeToImage
+	sizeOverrides map[int]string
+	// SVG source is rendered at every produced size instead of downscaling of the max image
+	svgDocument *svgDocument
 
 	recommendedMinSize int
+	isUpscale          bool
+	isPadToSquare      bool
+	isTrim             bool
+	padding            float64
+	mask               string
+	isMaskShadow       bool
+	isLegacy           bool
+	icoOptions         IcoOptions
+	// nil means alpha is kept
+	background *color.NRGBA
+	// nil means Lanczos without sharpening
+	resizeOptions *ResizeOptions
+	imageCache    *decodedImageCache
+	// nil if conversion cannot be cancelled
+	ctx context.Context
+}
+
+// source image is modified on load (trim, padding, background or mask), so, files cannot be used as is
+func (t *InputFileInfo) isTransformed() bool {
+	return t.isTrim || t.padding > 0 || t.background != nil || len(t.mask) != 0
 }
 
+// safe for concurrent use, max image is loaded lazily only once (if not yet set explicitly)
 func (t *InputFileInfo) GetMaxImage() (image.Image, error) {
-	if t.maxImage == nil {
-		var err error
-		t.maxImage, err = loadImage(t.MaxIconPath, t.recommendedMinSize)
-		if err != nil {
-			return nil, errors.WithStack(err)
+	t.maxImageOnce.Do(func() {
+		if t.maxImage == nil {
+			t.maxImage, t.maxImageError = loadImage(t.MaxIconPath, t)
 		}
+	})
+
+	if t.maxImageError != nil {
+		return nil, errors.WithStack(t.maxImageError)
 	}
 	return t.maxImage, nil
 }
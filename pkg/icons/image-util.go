@@ -2,15 +2,21 @@ package icons
 
 import (
 	"bufio"
+	"bytes"
 	"image"
 	"image/png"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/biessek/golang-ico"
+	"github.com/develar/app-builder/pkg/fs"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 const (
@@ -22,6 +28,10 @@ const (
 var icnsTypesForIco = []string{ICNS_256, ICNS_256_RETINA, ICNS_512, ICNS_512_RETINA, ICNS_1024}
 
 func LoadImage(file string) (image.Image, error) {
+	if isSvgFile(file) {
+		return RenderSvg(file, svgRenderSize)
+	}
+
 	reader, err := os.Open(file)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -55,7 +65,21 @@ func LoadImage(file string) (image.Image, error) {
 			}
 		}
 
-		return nil, NewImageSizeError(file, 256)
+		// ICNS doesn't contain any image suitable for ICO, actual size is unknown
+		return nil, NewImageSizeError(file, 0, 0, 256)
+	}
+
+	header, err := bufferedReader.Peek(12)
+	if err == nil && isAvif(header) {
+		return decodeAvif(file)
+	}
+	if err == nil && isHeic(header) {
+		return decodeHeic(file)
+	}
+	if err == nil && isGif(header) {
+		result, err := decodeGif(bufferedReader, file)
+		util.Close(reader)
+		return result, err
 	}
 
 	return DecodeImageAndClose(bufferedReader, reader)
@@ -67,7 +91,22 @@ func DecodeImageConfig(file string) (*image.Config, error) {
 		return nil, errors.WithStack(err)
 	}
 
-	result, _, err := image.DecodeConfig(reader)
+	bufferedReader := bufio.NewReader(reader)
+	header, _ := bufferedReader.Peek(12)
+	if isAvif(header) {
+		util.Close(reader)
+		return decodeAvifConfig(file)
+	}
+	if isHeic(header) {
+		util.Close(reader)
+		return decodeHeicConfig(file)
+	}
+	if isGif(header) {
+		defer util.Close(reader)
+		return decodeGifConfig(bufferedReader, file)
+	}
+
+	result, _, err := image.DecodeConfig(bufferedReader)
 	if err != nil {
 		util.Close(reader)
 
@@ -85,21 +124,32 @@ func DecodeImageConfig(file string) (*image.Config, error) {
 	return &result, nil
 }
 
+// DecodeImageAndClose returns 8-bit non-premultiplied sRGB image (embedded color profile is applied)
 func DecodeImageAndClose(reader io.Reader, closer io.Closer) (image.Image, error) {
-	result, _, err := image.Decode(reader)
-	return result, errors.WithStack(fsutil.CloseAndCheckError(err, closer))
-}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.WithStack(fsutil.CloseAndCheckError(err, closer))
+	}
 
-func SaveImage(image image.Image, outFileName string, format int) error {
-	outFile, err := fsutil.CreateFile(outFileName)
+	result, _, err := image.Decode(bytes.NewReader(data))
+	err = fsutil.CloseAndCheckError(err, closer)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
+	return normalizeImage(result, readColorProfile(data)), nil
+}
 
-	return SaveImage2(image, outFile, format)
+func SaveImage(image image.Image, outFileName string, format int) error {
+	return fs.WriteFileAtomicWith(outFileName, 0644, func(outFile *os.File) error {
+		return encodeImage(image, outFile, format)
+	})
 }
 
 func SaveImage2(image image.Image, outFile io.WriteCloser, format int) error {
+	return fsutil.CloseAndCheckError(encodeImage(image, outFile, format), outFile)
+}
+
+func encodeImage(image image.Image, outFile io.Writer, format int) error {
 	writer := bufio.NewWriter(outFile)
 
 	var err error
@@ -110,7 +160,7 @@ func SaveImage2(image image.Image, outFile io.WriteCloser, format int) error {
 	}
 
 	if err != nil {
-		return fsutil.CloseAndCheckError(err, outFile)
+		return errors.WithStack(err)
 	}
-	return fsutil.CloseAndCheckError(writer.Flush(), outFile)
+	return errors.WithStack(writer.Flush())
 }
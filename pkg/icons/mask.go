@@ -0,0 +1,94 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+// https://developer.apple.com/design/resources/ (macOS app icon template): 824x824 tile on 1024x1024 canvas
+const bigSurTileRatio = 824.0 / 1024.0
+
+// corner radius relative to the tile size (185.4 for 824)
+const bigSurCornerRatio = 185.4 / 824.0
+
+// continuous corner (squircle) is approximated by superellipse
+const bigSurCornerExponent = 5.0
+
+// drop shadow of the template: 10px blur, 10px y offset, 30% black (relative to 1024 canvas)
+const bigSurShadowBlur = 10.0 / 1024
+const bigSurShadowOffset = 10.0 / 1024
+const bigSurShadowOpacity = 0.3
+
+// samples per axis for anti-aliasing of tile edge
+const maskSamples = 4
+
+func validateMask(mask string) error {
+	switch mask {
+	case "", "bigsur":
+		return nil
+	default:
+		return errors.Errorf("unknown icon mask %q", mask)
+	}
+}
+
+// source is scaled to the tile and clipped by its shape, canvas size is the same as source size (no upscale)
+func applyBigSurMask(img image.Image, isShadow bool, resizeOptions *ResizeOptions) *image.NRGBA {
+	canvasSize := img.Bounds().Dx()
+	tileSize := int(math.Round(float64(canvasSize) * bigSurTileRatio))
+	tile := resizeOptions.resize(img, tileSize)
+
+	tileMask := createSquircleMask(tileSize, float64(tileSize)*bigSurCornerRatio)
+	for index := 3; index < len(tile.Pix); index += 4 {
+		tile.Pix[index] = uint8(uint32(tile.Pix[index]) * uint32(tileMask.Pix[index/4]) / 255)
+	}
+
+	result := imaging.New(canvasSize, canvasSize, color.Transparent)
+	tileOffset := (canvasSize - tileSize) / 2
+	if isShadow {
+		shadow := imaging.New(canvasSize, canvasSize, color.Transparent)
+		for y := 0; y < tileSize; y++ {
+			for x := 0; x < tileSize; x++ {
+				alpha := float64(tileMask.AlphaAt(x, y).A) * bigSurShadowOpacity
+				shadow.SetNRGBA(x+tileOffset, y+tileOffset, color.NRGBA{A: uint8(math.Round(alpha))})
+			}
+		}
+		shadow = imaging.Blur(shadow, float64(canvasSize)*bigSurShadowBlur)
+		result = imaging.Overlay(result, shadow, image.Pt(0, int(math.Round(float64(canvasSize)*bigSurShadowOffset))), 1)
+	}
+	return imaging.Overlay(result, tile, image.Pt(tileOffset, tileOffset), 1)
+}
+
+// coverage of rounded square with superellipse corners, sampled for anti-aliasing
+func createSquircleMask(size int, radius float64) *image.Alpha {
+	result := image.NewAlpha(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			inside := 0
+			for sampleY := 0; sampleY < maskSamples; sampleY++ {
+				for sampleX := 0; sampleX < maskSamples; sampleX++ {
+					pointX := float64(x) + (float64(sampleX)+0.5)/maskSamples
+					pointY := float64(y) + (float64(sampleY)+0.5)/maskSamples
+					if isInsideSquircle(pointX, pointY, float64(size), radius) {
+						inside++
+					}
+				}
+			}
+			result.Pix[y*result.Stride+x] = uint8(inside * 255 / (maskSamples * maskSamples))
+		}
+	}
+	return result
+}
+
+func isInsideSquircle(x float64, y float64, size float64, radius float64) bool {
+	// distance into the corner region, corner is symmetric
+	dx := math.Max(0, radius-math.Min(x, size-x))
+	dy := math.Max(0, radius-math.Min(y, size-y))
+	if dx == 0 || dy == 0 {
+		return x >= 0 && x <= size && y >= 0 && y <= size
+	}
+	return math.Pow(dx/radius, bigSurCornerExponent)+math.Pow(dy/radius, bigSurCornerExponent) <= 1
+}
@@ -0,0 +1,46 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	. "github.com/onsi/gomega"
+)
+
+func TestCreateSquircleMask(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	mask := createSquircleMask(100, 22.5)
+	g.Expect(mask.AlphaAt(50, 50).A).To(Equal(uint8(255)))
+	// straight edge is not rounded
+	g.Expect(mask.AlphaAt(0, 50).A).To(Equal(uint8(255)))
+	g.Expect(mask.AlphaAt(0, 0).A).To(BeZero())
+	g.Expect(mask.AlphaAt(99, 99).A).To(BeZero())
+	// anti-aliased corner
+	g.Expect(mask.AlphaAt(0, 10).A).To(And(BeNumerically(">", 0), BeNumerically("<", 255)))
+
+	g.Expect(validateMask("bigsur")).To(Succeed())
+	g.Expect(validateMask("circle")).To(HaveOccurred())
+}
+
+func TestApplyBigSurMask(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	source := imaging.New(256, 256, color.NRGBA{R: 255, A: 255})
+	result := applyBigSurMask(source, false, nil)
+	g.Expect(result.Bounds()).To(Equal(image.Rect(0, 0, 256, 256)))
+	// 206px tile with 25px margin
+	g.Expect(result.NRGBAAt(128, 128)).To(Equal(color.NRGBA{R: 255, A: 255}))
+	g.Expect(result.NRGBAAt(25, 128)).To(Equal(color.NRGBA{R: 255, A: 255}))
+	g.Expect(result.NRGBAAt(24, 128).A).To(BeZero())
+	g.Expect(result.NRGBAAt(26, 26).A).To(BeZero())
+	g.Expect(result.NRGBAAt(128, 233).A).To(BeZero())
+
+	shadowed := applyBigSurMask(source, true, nil)
+	g.Expect(shadowed.NRGBAAt(128, 128)).To(Equal(color.NRGBA{R: 255, A: 255}))
+	shadow := shadowed.NRGBAAt(128, 233)
+	g.Expect(shadow.A).To(BeNumerically(">", 0))
+	g.Expect(shadow.R).To(BeZero())
+}
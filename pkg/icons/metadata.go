@@ -0,0 +1,77 @@
+package icons
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// reported for every file of the result, so, build manifests and caching layers don't have to stat and hash files again
+func addIconMetadata(icons []IconInfo) error {
+	return util.MapAsync(len(icons), func(taskIndex int) (func() error, error) {
+		icon := &icons[taskIndex]
+		return func() error {
+			return readIconMetadata(icon)
+		}, nil
+	})
+}
+
+func readIconMetadata(icon *IconInfo) error {
+	data, err := ioutil.ReadFile(icon.File)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	hash := sha256.Sum256(data)
+	icon.Sha256 = hex.EncodeToString(hash[:])
+	icon.Bytes = int64(len(data))
+
+	switch {
+	case bytes.HasPrefix(data, []byte("icns")):
+		icon.Format = "icns"
+		info, err := ReadIcnsInfo(icon.File)
+		if err != nil {
+			return err
+		}
+		// dimensions of the largest entry
+		for _, entry := range info.Entries {
+			if entry.Width > icon.Width {
+				icon.Width = entry.Width
+				icon.Height = entry.Height
+			}
+		}
+
+	case len(data) >= 6 && isIcoFile(icon.File) && IsIco(data):
+		icon.Format = "ico"
+		// size report of frames (existing ICO can be used as is, so, report is always read from the result file)
+		icon.IcoFrames, err = ReadIcoFrames(icon.File)
+		if err != nil {
+			return err
+		}
+		for _, size := range GetIcoSizes(data) {
+			if size.Width > icon.Width {
+				icon.Width = size.Width
+				icon.Height = size.Height
+			}
+		}
+
+	default:
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err == nil {
+			icon.Format = format
+			icon.Width = config.Width
+			icon.Height = config.Height
+		} else {
+			// not an image (e.g. Contents.json or site.webmanifest), format is derived from extension
+			icon.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(icon.File)), ".")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package icons
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/disintegration/imaging"
+	. "github.com/onsi/gomega"
+)
+
+// only file and size are compared, metadata depends on encoder
+func withoutIconMetadata(icons []IconInfo) []IconInfo {
+	result := make([]IconInfo, len(icons))
+	for index, icon := range icons {
+		result[index] = IconInfo{File: icon.File, Size: icon.Size}
+	}
+	return result
+}
+
+func TestConvertIconMetadata(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-metadata")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(imaging.New(512, 512, color.NRGBA{R: 255, A: 255}), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+
+	// for ICNS and ICO dimensions of the largest entry
+	for format, size := range map[string]int{"icns": 512, "ico": 256} {
+		result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+			Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+			FallbackSources: &[]string{},
+			OutputFormat:    format,
+			OutputDir:       filepath.Join(tmpDir, format),
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(result.Icons).To(HaveLen(1))
+
+		icon := result.Icons[0]
+		data, err := ioutil.ReadFile(icon.File)
+		g.Expect(err).NotTo(HaveOccurred())
+		hash := sha256.Sum256(data)
+		g.Expect(icon.Sha256).To(Equal(hex.EncodeToString(hash[:])))
+		g.Expect(icon.Bytes).To(Equal(int64(len(data))))
+		g.Expect(icon.Format).To(Equal(format))
+		g.Expect(icon.Width).To(Equal(size))
+		g.Expect(icon.Height).To(Equal(size))
+	}
+
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "favicon",
+		OutputDir:       filepath.Join(tmpDir, "favicon"),
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	touchIcon := result.Icons[1]
+	g.Expect(touchIcon.Format).To(Equal("png"))
+	g.Expect(touchIcon.Width).To(Equal(180))
+	g.Expect(touchIcon.Height).To(Equal(180))
+}
@@ -0,0 +1,209 @@
+package icons
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+// sizes of MUI2 bitmaps, NSIS doesn't scale bitmaps, so, other sizes are cropped or stretched
+const (
+	nsisHeaderWidth   = 150
+	nsisHeaderHeight  = 57
+	nsisSidebarWidth  = 164
+	nsisSidebarHeight = 314
+
+	nsisHeaderIconSize  = 48
+	nsisSidebarIconSize = 128
+	nsisSidebarIconTop  = 48
+)
+
+type NsisAssetsOptions struct {
+	// master icon, used for uninstaller icon and for bitmaps if artwork is not specified
+	Icon string
+	// artwork is scaled to cover bitmap size and cropped (centered)
+	HeaderArtwork  string
+	SidebarArtwork string
+	// bitmaps don't support transparency
+	Background color.NRGBA
+	OutputDir  string
+}
+
+type NsisAssets struct {
+	InstallerHeader  string `json:"installerHeader"`
+	InstallerSidebar string `json:"installerSidebar"`
+	UninstallerIcon  string `json:"uninstallerIcon"`
+}
+
+func ConfigureNsisAssetsCommand(app *kingpin.Application) {
+	command := app.Command("nsis-assets", "Render installerHeader.bmp, installerSidebar.bmp (24-bit bottom-up BMP as NSIS expects) and uninstallerIcon.ico")
+	options := NsisAssetsOptions{}
+	command.Flag("icon", "master icon").Required().StringVar(&options.Icon)
+	command.Flag("header", "header artwork (icon is placed on background if not specified)").StringVar(&options.HeaderArtwork)
+	command.Flag("sidebar", "sidebar artwork (icon is placed on background if not specified)").StringVar(&options.SidebarArtwork)
+	background := command.Flag("background", "background color (hex, rgb() or CSS color name)").Default("#ffffff").String()
+	command.Flag("output", "output directory").Short('o').Required().StringVar(&options.OutputDir)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		backgroundColor, err := parseBackground(*background)
+		if err != nil {
+			return err
+		}
+		options.Background = *backgroundColor
+
+		result, err := CreateNsisAssets(options)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+func CreateNsisAssets(options NsisAssetsOptions) (*NsisAssets, error) {
+	icon, err := LoadImage(options.Icon)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := renderNsisBitmap(icon, options.HeaderArtwork, nsisHeaderWidth, nsisHeaderHeight, options.Background, func(canvas *image.NRGBA, icon image.Image) *image.NRGBA {
+		// MUI2 header image is right aligned by default
+		margin := (nsisHeaderHeight - nsisHeaderIconSize) / 2
+		return imaging.Overlay(canvas, fitIcon(icon, nsisHeaderIconSize), image.Pt(nsisHeaderWidth-nsisHeaderIconSize-margin, margin), 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sidebar, err := renderNsisBitmap(icon, options.SidebarArtwork, nsisSidebarWidth, nsisSidebarHeight, options.Background, func(canvas *image.NRGBA, icon image.Image) *image.NRGBA {
+		// text of welcome page is on the right, icon is centered horizontally in the upper part
+		return imaging.Overlay(canvas, fitIcon(icon, nsisSidebarIconSize), image.Pt((nsisSidebarWidth-nsisSidebarIconSize)/2, nsisSidebarIconTop), 1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &NsisAssets{
+		InstallerHeader:  filepath.Join(options.OutputDir, "installerHeader.bmp"),
+		InstallerSidebar: filepath.Join(options.OutputDir, "installerSidebar.bmp"),
+		UninstallerIcon:  filepath.Join(options.OutputDir, "uninstallerIcon.ico"),
+	}
+
+	err = saveBmp(header, result.InstallerHeader)
+	if err != nil {
+		return nil, err
+	}
+	err = saveBmp(sidebar, result.InstallerSidebar)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]image.Image, len(icoSizes))
+	for index, size := range icoSizes {
+		images[index] = fitIcon(icon, size)
+	}
+	err = fs.WriteFileAtomicWith(result.UninstallerIcon, 0644, func(file *os.File) error {
+		writer := bufio.NewWriter(file)
+		err := EncodeIco(writer, images, IcoOptions{})
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(writer.Flush())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func renderNsisBitmap(icon image.Image, artworkFile string, width int, height int, background color.NRGBA, placeIcon func(canvas *image.NRGBA, icon image.Image) *image.NRGBA) (*image.NRGBA, error) {
+	if len(artworkFile) == 0 {
+		return placeIcon(imaging.New(width, height, background), icon), nil
+	}
+
+	artwork, err := LoadImage(artworkFile)
+	if err != nil {
+		return nil, err
+	}
+	return flattenOnBackground(imaging.Fill(artwork, width, height, imaging.Center, imaging.Lanczos), background), nil
+}
+
+// aspect ratio of not square icon is preserved, icon is centered
+func fitIcon(icon image.Image, size int) *image.NRGBA {
+	bounds := icon.Bounds()
+	if bounds.Dx() == bounds.Dy() {
+		return imaging.Resize(icon, size, size, imaging.Lanczos)
+	}
+
+	fitted := imaging.Fit(icon, size, size, imaging.Lanczos)
+	return imaging.PasteCenter(imaging.New(size, size, color.NRGBA{}), fitted)
+}
+
+func saveBmp(img image.Image, file string) error {
+	return fs.WriteFileAtomicWith(file, 0644, func(outFile *os.File) error {
+		writer := bufio.NewWriter(outFile)
+		err := encodeBmp3(writer, img)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(writer.Flush())
+	})
+}
+
+// 24-bit BMP with BITMAPINFOHEADER (v3), rows are bottom-up:
+// NSIS (LoadImage in MUI2) doesn't handle top-down rows (negative height), V4/V5 headers and alpha channel
+func encodeBmp3(writer io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	const fileHeaderSize = 14
+	const infoHeaderSize = 40
+	// each row is padded to 4 bytes
+	rowSize := (width*3 + 3) / 4 * 4
+	pixelDataSize := rowSize * height
+
+	result := make([]byte, fileHeaderSize+infoHeaderSize+pixelDataSize)
+	result[0] = 'B'
+	result[1] = 'M'
+	binary.LittleEndian.PutUint32(result[2:], uint32(len(result)))
+	binary.LittleEndian.PutUint32(result[10:], fileHeaderSize+infoHeaderSize)
+
+	info := result[fileHeaderSize:]
+	binary.LittleEndian.PutUint32(info[0:], infoHeaderSize)
+	binary.LittleEndian.PutUint32(info[4:], uint32(width))
+	// positive height means bottom-up
+	binary.LittleEndian.PutUint32(info[8:], uint32(height))
+	// planes
+	binary.LittleEndian.PutUint16(info[12:], 1)
+	// bits per pixel
+	binary.LittleEndian.PutUint16(info[14:], 24)
+	// compression (BI_RGB) is 0
+	binary.LittleEndian.PutUint32(info[20:], uint32(pixelDataSize))
+	// 72 DPI
+	binary.LittleEndian.PutUint32(info[24:], 2835)
+	binary.LittleEndian.PutUint32(info[28:], 2835)
+
+	pixels := result[fileHeaderSize+infoHeaderSize:]
+	for y := 0; y < height; y++ {
+		row := pixels[(height-1-y)*rowSize:]
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			row[x*3] = c.B
+			row[x*3+1] = c.G
+			row[x*3+2] = c.R
+		}
+	}
+
+	_, err := writer.Write(result)
+	return errors.WithStack(err)
+}
@@ -0,0 +1,90 @@
+package icons
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+	"golang.org/x/image/bmp"
+)
+
+func TestEncodeBmp3(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 255, A: 255})
+	img.SetNRGBA(4, 2, color.NRGBA{B: 255, A: 255})
+
+	var buffer bytes.Buffer
+	g.Expect(encodeBmp3(&buffer, img)).To(Succeed())
+	data := buffer.Bytes()
+	// 5 pixels * 3 bytes padded to 16 bytes per row
+	g.Expect(data).To(HaveLen(14 + 40 + 16*3))
+	g.Expect(binary.LittleEndian.Uint32(data[14:])).To(Equal(uint32(40)))
+	g.Expect(int32(binary.LittleEndian.Uint32(data[22:]))).To(Equal(int32(3)))
+	g.Expect(binary.LittleEndian.Uint16(data[28:])).To(Equal(uint16(24)))
+	// the first row in file is the bottom one
+	g.Expect(data[54+12 : 54+15]).To(Equal([]byte{255, 0, 0}))
+	g.Expect(data[54+32 : 54+35]).To(Equal([]byte{0, 0, 255}))
+
+	decoded, err := bmp.Decode(bytes.NewReader(data))
+	g.Expect(err).NotTo(HaveOccurred())
+	r, _, _, _ := decoded.At(0, 0).RGBA()
+	g.Expect(r).To(Equal(uint32(0xffff)))
+}
+
+func TestCreateNsisAssets(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "nsis-assets")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	iconFile := filepath.Join(tmpDir, "icon.png")
+	g.Expect(SaveImage(createImageWithContent(256, image.Rect(64, 64, 192, 192)), iconFile, PNG)).To(Succeed())
+
+	artwork := image.NewNRGBA(image.Rect(0, 0, 400, 100))
+	for x := 0; x < 400; x++ {
+		for y := 0; y < 100; y++ {
+			artwork.SetNRGBA(x, y, color.NRGBA{G: 255, A: 128})
+		}
+	}
+	artworkFile := filepath.Join(tmpDir, "header.png")
+	g.Expect(SaveImage(artwork, artworkFile, PNG)).To(Succeed())
+
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	result, err := CreateNsisAssets(NsisAssetsOptions{Icon: iconFile, HeaderArtwork: artworkFile, Background: white, OutputDir: filepath.Join(tmpDir, "out")})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	header := readBmp(g, result.InstallerHeader)
+	g.Expect(header.Bounds().Size()).To(Equal(image.Pt(nsisHeaderWidth, nsisHeaderHeight)))
+	// semi-transparent artwork is blended with background
+	g.Expect(color.NRGBAModel.Convert(header.At(0, 0))).To(Equal(color.NRGBA{R: 127, G: 255, B: 127, A: 255}))
+
+	sidebar := readBmp(g, result.InstallerSidebar)
+	g.Expect(sidebar.Bounds().Size()).To(Equal(image.Pt(nsisSidebarWidth, nsisSidebarHeight)))
+	g.Expect(color.NRGBAModel.Convert(sidebar.At(0, 0))).To(Equal(white))
+	g.Expect(color.NRGBAModel.Convert(sidebar.At(nsisSidebarWidth/2, nsisSidebarIconTop+nsisSidebarIconSize/2))).To(Equal(color.NRGBA{R: 255, A: 255}))
+
+	data, err := ioutil.ReadFile(result.UninstallerIcon)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(GetIcoSizes(data)).To(HaveLen(len(icoSizes)))
+}
+
+func readBmp(g *GomegaWithT, file string) image.Image {
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(int32(binary.LittleEndian.Uint32(data[22:]))).To(BeNumerically(">", 0))
+	g.Expect(binary.LittleEndian.Uint16(data[28:])).To(Equal(uint16(24)))
+
+	result, err := bmp.Decode(bytes.NewReader(data))
+	g.Expect(err).NotTo(HaveOccurred())
+	return result
+}
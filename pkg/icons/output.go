@@ -0,0 +1,160 @@
+package icons
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// ConvertIcon writes output into the staging dir created inside of the output dir (so, rename is atomic)
+// and moves produced files to the final location only on success - output dir never contains partially written files (including cancel).
+func ConvertIcon(ctx context.Context, configuration *IconConvertRequest) (*IconConvertResult, error) {
+	ctx, span := trace.Start(ctx, "icon")
+	span.SetAttribute("format", configuration.OutputFormat)
+	result, err := convertIconToOutput(ctx, configuration)
+	if result != nil {
+		span.SetAttribute("icons", len(result.Icons))
+	}
+	span.End(err)
+	return result, err
+}
+
+func convertIconToOutput(ctx context.Context, configuration *IconConvertRequest) (*IconConvertResult, error) {
+	outputFile := configuration.OutputFile
+	if len(outputFile) != 0 {
+		if configuration.OutputFormat == "set" || isProducedFromLargestIcon(configuration.OutputFormat) {
+			return nil, errors.Errorf("output file cannot be specified for %s output format, use output dir", configuration.OutputFormat)
+		}
+		if len(configuration.OutputDir) == 0 {
+			configuration.OutputDir = filepath.Dir(outputFile)
+		}
+	}
+
+	outDir := configuration.OutputDir
+	if len(outDir) == 0 {
+		result, err := convertIcon(ctx, configuration)
+		if err != nil {
+			return nil, err
+		}
+		err = addIconMetadata(result.Icons)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	err := fsutil.EnsureDir(outDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	stagingDir, err := util.TempDir(outDir, ".icon-staging")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer func() {
+		removeErr := os.RemoveAll(stagingDir)
+		if removeErr != nil {
+			log.WithError(removeErr).WithField("dir", stagingDir).Warn("cannot remove staging dir")
+		}
+	}()
+
+	stagingConfiguration := *configuration
+	stagingConfiguration.OutputDir = stagingDir
+	result, err := convertIcon(ctx, &stagingConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = commitOutput(result, stagingDir, outDir, outputFile)
+	if err != nil {
+		return nil, err
+	}
+	err = addIconMetadata(result.Icons)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// moves all files from the staging dir to the output dir (keeping relative paths) and updates paths in the result,
+// single produced file is moved to the output file if specified (source file used as is is copied)
+func commitOutput(result *IconConvertResult, stagingDir string, outDir string, outputFile string) error {
+	stagedToFinal := make(map[string]string)
+	if len(outputFile) != 0 && len(result.Icons) == 1 {
+		icon := &result.Icons[0]
+		if isInDir(icon.File, stagingDir) {
+			stagedToFinal[icon.File] = outputFile
+		} else {
+			err := copyAtomically(icon.File, outputFile, stagingDir)
+			if err != nil {
+				return err
+			}
+			icon.File = outputFile
+			return nil
+		}
+	}
+
+	err := filepath.Walk(stagingDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == stagingDir {
+			return err
+		}
+
+		target, isSpecified := stagedToFinal[path]
+		if !isSpecified {
+			relativePath, err := filepath.Rel(stagingDir, path)
+			if err != nil {
+				return err
+			}
+			target = filepath.Join(outDir, relativePath)
+			stagedToFinal[path] = target
+		}
+
+		if info.IsDir() {
+			return fsutil.EnsureDir(target)
+		}
+		return moveFile(path, target)
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for index, icon := range result.Icons {
+		target, isMoved := stagedToFinal[icon.File]
+		if isMoved {
+			result.Icons[index].File = target
+		}
+	}
+	return nil
+}
+
+func moveFile(from string, to string) error {
+	err := fsutil.EnsureDir(filepath.Dir(to))
+	if err != nil {
+		return err
+	}
+	return fs.RenameWithRetry(from, to)
+}
+
+// real copy, not hardlink - output file must not share data with the source file
+func copyAtomically(from string, to string, stagingDir string) error {
+	tempFile := filepath.Join(stagingDir, filepath.Base(to))
+	var fileCopier fs.FileCopier
+	err := fileCopier.CopyDirOrFile(from, tempFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(moveFile(tempFile, to))
+}
+
+func isInDir(file string, dir string) bool {
+	return strings.HasPrefix(file, dir+string(filepath.Separator))
+}
@@ -0,0 +1,263 @@
+package icons
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+)
+
+// IconPlan is written instead of conversion in dry-run mode (nothing is written and remote sources are not downloaded)
+type IconPlan struct {
+	// resolved source file or dir, empty if source is not found
+	Source     string `json:"source"`
+	IsFallback bool   `json:"isFallback"`
+	// asIs (source is used without conversion), iconSet (icons of source dir are used), convert or download (remote source, sizes are not known)
+	Action string `json:"action,omitempty"`
+	Format string `json:"format"`
+	Layout string `json:"layout,omitempty"`
+
+	// 0 if cannot be determined without decoding (e.g. SVG or ICNS)
+	SourceSize int      `json:"sourceSize,omitempty"`
+	Sizes      []int    `json:"sizes,omitempty"`
+	Outputs    []string `json:"outputs"`
+	// explicit source files per size from size config, used instead of produced sizes
+	Overrides []IconInfo `json:"overrides,omitempty"`
+	// number of images to be produced by resize (estimated work)
+	ResizeCount int `json:"resizeCount"`
+}
+
+// PlanIcon resolves source the same way as ConvertIcon and computes sizes and output files
+func PlanIcon(configuration *IconConvertRequest) (*IconPlan, error) {
+	plan := &IconPlan{Format: configuration.OutputFormat, Layout: configuration.Layout, Outputs: []string{}}
+	isResolved, err := planSource(createCommonIconSources(*configuration.Sources, configuration.OutputFormat), configuration, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isResolved && configuration.FallbackSources != nil {
+		plan.IsFallback = true
+		isResolved, err = planSource(*configuration.FallbackSources, configuration, plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !isResolved {
+		plan.IsFallback = false
+	}
+	return plan, nil
+}
+
+func planSource(sourceFiles []string, configuration *IconConvertRequest, plan *IconPlan) (bool, error) {
+	for _, sourceFile := range sourceFiles {
+		if isRemoteSource(sourceFile) {
+			plan.Source = sourceFile
+			plan.Action = "download"
+			return true, nil
+		}
+
+		resolvedPath, fileInfo, err := resolveSourceFileOrNull(sourceFile, configuration.getRoots())
+		if err != nil {
+			return false, err
+		}
+		if fileInfo != nil {
+			plan.Source = resolvedPath
+			sizeOverrides, err := loadSizeOverrides(configuration.SizeConfig, resolvedPath, fileInfo)
+			if err != nil {
+				return true, err
+			}
+			if len(sizeOverrides) != 0 {
+				plan.Overrides = sizeOverridesToIcons(sizeOverrides)
+			}
+			return true, planConversion(resolvedPath, fileInfo, configuration, plan)
+		}
+	}
+	return false, nil
+}
+
+func planConversion(resolvedPath string, fileInfo os.FileInfo, configuration *IconConvertRequest, plan *IconPlan) error {
+	outputFormat := configuration.OutputFormat
+	outExt := outputFormatToSingleFileExtension(outputFormat)
+	outDir := configuration.OutputDir
+	if len(outDir) == 0 {
+		outDir = filepath.Dir(configuration.OutputFile)
+	}
+
+	if isProducedFromLargestIcon(outputFormat) || len(configuration.Preset) != 0 {
+		return planSingleImageFormat(resolvedPath, fileInfo, outDir, configuration, plan)
+	}
+
+	if configuration.isTransformed() {
+		// all sizes are produced from the transformed largest icon
+		sourceFile, sourceSize, err := resolveLargestIcon(resolvedPath, fileInfo)
+		if err != nil {
+			return err
+		}
+		plan.SourceSize = sourceSize
+		return planConversionOfSingleImage(sourceFile, outDir, configuration, plan, make(map[int]bool))
+	}
+
+	if strings.HasSuffix(resolvedPath, outExt) {
+		plan.Action = "asIs"
+		plan.Outputs = append(plan.Outputs, planSingleOutput(configuration, resolvedPath))
+		return nil
+	}
+
+	sourceFile := resolvedPath
+	existingSizes := make(map[int]bool)
+	if fileInfo.IsDir() {
+		icons, iconFileName, err := CollectIcons(resolvedPath)
+		if err != nil {
+			return err
+		}
+
+		if len(icons) == 0 {
+			sourceFile = iconFileName
+		} else {
+			for _, icon := range icons {
+				existingSizes[icon.Size] = true
+			}
+			plan.SourceSize = icons[len(icons)-1].Size
+
+			if outputFormat == "set" {
+				plan.Action = "iconSet"
+				for _, icon := range icons {
+					plan.Sizes = append(plan.Sizes, icon.Size)
+					plan.Outputs = append(plan.Outputs, icon.File)
+				}
+				return nil
+			}
+		}
+	}
+	return planConversionOfSingleImage(sourceFile, outDir, configuration, plan, existingSizes)
+}
+
+// existing sizes are provided by icon dir and not produced
+func planConversionOfSingleImage(sourceFile string, outDir string, configuration *IconConvertRequest, plan *IconPlan, existingSizes map[int]bool) error {
+	outputFormat := configuration.OutputFormat
+	plan.Action = "convert"
+	if plan.SourceSize == 0 {
+		plan.SourceSize = readSourceSize(sourceFile)
+	}
+	if plan.SourceSize != 0 {
+		existingSizes[plan.SourceSize] = true
+	}
+
+	switch outputFormat {
+	case "icns":
+		plan.Sizes = icnsExpectedSizes
+	case "ico":
+		plan.Sizes = icoSizes
+	default:
+		plan.Sizes = computeSetSizes(plan.SourceSize)
+	}
+
+	for _, size := range plan.Sizes {
+		if !existingSizes[size] {
+			plan.ResizeCount++
+		}
+		if outputFormat != "set" {
+			continue
+		}
+		// source file of the max size is used as is
+		if size == plan.SourceSize && strings.HasSuffix(sourceFile, ".png") && !configuration.isTransformed() {
+			plan.Outputs = append(plan.Outputs, sourceFile)
+		} else {
+			plan.Outputs = append(plan.Outputs, filepath.Join(outDir, fmt.Sprintf("icon_%dx%d.png", size, size)))
+		}
+	}
+	if outputFormat != "set" {
+		plan.Outputs = append(plan.Outputs, planSingleOutput(configuration, filepath.Join(outDir, "icon"+outputFormatToSingleFileExtension(outputFormat))))
+	}
+	return nil
+}
+
+// template, badge and favicon formats and mobile presets are produced from the largest icon
+func planSingleImageFormat(resolvedPath string, fileInfo os.FileInfo, outDir string, configuration *IconConvertRequest, plan *IconPlan) error {
+	sourceFile, sourceSize, err := resolveLargestIcon(resolvedPath, fileInfo)
+	if err != nil {
+		return err
+	}
+	plan.SourceSize = sourceSize
+	if plan.SourceSize == 0 {
+		plan.SourceSize = readSourceSize(sourceFile)
+	}
+
+	plan.Action = "convert"
+	if len(configuration.Preset) != 0 {
+		for _, icon := range computePresetIcons(configuration.Preset, configuration.IconName) {
+			plan.Sizes = append(plan.Sizes, icon.Size)
+			plan.Outputs = append(plan.Outputs, filepath.Join(outDir, icon.File))
+		}
+		if configuration.Preset == "ios" {
+			plan.Outputs = append(plan.Outputs, filepath.Join(outDir, iosAppIconSetDir, "Contents.json"))
+		}
+	} else if configuration.OutputFormat == "favicon" {
+		plan.Sizes = append(plan.Sizes, faviconIcoSizes...)
+		plan.Outputs = append(plan.Outputs, filepath.Join(outDir, faviconIcoFileName))
+		for _, png := range faviconPngs {
+			plan.Sizes = append(plan.Sizes, png.Size)
+			plan.Outputs = append(plan.Outputs, filepath.Join(outDir, png.File))
+		}
+		plan.Outputs = append(plan.Outputs, filepath.Join(outDir, webManifestFileName))
+	} else if configuration.OutputFormat == "badge" {
+		for _, badge := range computeBadgeIcons(configuration.IconName) {
+			plan.Outputs = append(plan.Outputs, filepath.Join(outDir, badge.File))
+		}
+		plan.Outputs = append(plan.Outputs, filepath.Join(outDir, badgeManifestFileName))
+		plan.Sizes = badgePixelSizes()
+	} else {
+		size := configuration.TemplateOptions.getSize()
+		plan.Sizes = []int{size, size * 2}
+		fileName, retinaFileName := getTemplateFileNames(configuration.IconName)
+		plan.Outputs = append(plan.Outputs, filepath.Join(outDir, fileName), filepath.Join(outDir, retinaFileName))
+	}
+
+	for _, size := range plan.Sizes {
+		if size != plan.SourceSize {
+			plan.ResizeCount++
+		}
+	}
+	return nil
+}
+
+func planSingleOutput(configuration *IconConvertRequest, file string) string {
+	if len(configuration.OutputFile) != 0 {
+		return configuration.OutputFile
+	}
+	return file
+}
+
+// the same sizes as produced for Linux from a single file, larger than source are not produced
+func computeSetSizes(sourceSize int) []int {
+	sizes := []int{24, 96}
+	for _, item := range icnsTypeToSize {
+		if sourceSize == 0 || item.Size < sourceSize {
+			sizes = append(sizes, item.Size)
+		}
+	}
+	if sourceSize != 0 {
+		sizes = append(sizes, sourceSize)
+	}
+	sort.Ints(sizes)
+	return sizes
+}
+
+// only image header is read
+func readSourceSize(file string) int {
+	reader, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer util.Close(reader)
+
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return 0
+	}
+	return config.Width
+}
@@ -0,0 +1,85 @@
+package icons
+
+import (
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestPlanIcon(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-plan")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 256, 256)), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+	outDir := filepath.Join(tmpDir, "out")
+	request := &IconConvertRequest{
+		Sources:         &[]string{"missing"},
+		FallbackSources: &[]string{},
+		Roots:           &[]string{tmpDir},
+		OutputFormat:    "icns",
+		OutputDir:       outDir,
+	}
+
+	plan, err := PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Source).To(Equal(filepath.Join(tmpDir, "icon.png")))
+	g.Expect(plan.Action).To(Equal("convert"))
+	g.Expect(plan.SourceSize).To(Equal(256))
+	g.Expect(plan.Sizes).To(Equal([]int{16, 32, 64, 128, 256, 512, 1024}))
+	g.Expect(plan.ResizeCount).To(Equal(6))
+	g.Expect(plan.Outputs).To(Equal([]string{filepath.Join(outDir, "icon.icns")}))
+
+	// png is used as is for icon set
+	request.OutputFormat = "set"
+	plan, err = PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Action).To(Equal("asIs"))
+
+	// icon dir without sized icons
+	iconFile := filepath.Join(tmpDir, "icons", "icon.png")
+	g.Expect(os.Mkdir(filepath.Dir(iconFile), 0755)).To(Succeed())
+	g.Expect(os.Rename(filepath.Join(tmpDir, "icon.png"), iconFile)).To(Succeed())
+	plan, err = PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Action).To(Equal("convert"))
+	g.Expect(plan.Sizes).To(Equal([]int{16, 24, 32, 48, 64, 96, 128, 256}))
+	g.Expect(plan.ResizeCount).To(Equal(7))
+	g.Expect(plan.Outputs).To(HaveLen(8))
+	g.Expect(plan.Outputs[0]).To(Equal(filepath.Join(outDir, "icon_16x16.png")))
+	g.Expect(plan.Outputs[7]).To(Equal(iconFile))
+
+	// the largest icon of dir is used for template
+	request.OutputFormat = "template"
+	plan, err = PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Action).To(Equal("convert"))
+	g.Expect(plan.Sizes).To(Equal([]int{16, 32}))
+	g.Expect(plan.ResizeCount).To(Equal(2))
+	g.Expect(plan.Outputs).To(Equal([]string{filepath.Join(outDir, "iconTemplate.png"), filepath.Join(outDir, "iconTemplate@2x.png")}))
+
+	request.OutputFormat = "badge"
+	plan, err = PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Sizes).To(Equal(badgePixelSizes()))
+	g.Expect(plan.Outputs).To(HaveLen(len(badgeSizes)*len(badgeScales) + 1))
+	g.Expect(plan.Outputs[len(plan.Outputs)-1]).To(Equal(filepath.Join(outDir, "badges.json")))
+	request.OutputFormat = "set"
+
+	// nothing is written
+	g.Expect(outDir).NotTo(BeADirectory())
+
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "icon.icns"), []byte("icns"), 0644)).To(Succeed())
+	request.OutputFormat = "icns"
+	plan, err = PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Action).To(Equal("asIs"))
+	g.Expect(plan.Outputs).To(Equal([]string{filepath.Join(tmpDir, "icon.icns")}))
+}
@@ -0,0 +1,186 @@
+package icons
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+const iosAppIconSetDir = "AppIcon.appiconset"
+
+// https://developer.android.com/training/multiscreen/screendensities#mipmap
+var androidMipmapSizes = []struct {
+	density string
+	size    int
+}{
+	{"mdpi", 48},
+	{"hdpi", 72},
+	{"xhdpi", 96},
+	{"xxhdpi", 144},
+	{"xxxhdpi", 192},
+}
+
+type iosAppIconEntry struct {
+	Idiom string `json:"idiom"`
+	// in points, 83.5 for iPad Pro
+	Size     string `json:"size"`
+	Scale    string `json:"scale"`
+	Filename string `json:"filename"`
+}
+
+// the same entries as written by Xcode for the AppIcon asset of iOS app
+var iosAppIconSizes = []struct {
+	idiom  string
+	size   float64
+	scales []int
+}{
+	{"iphone", 20, []int{2, 3}},
+	{"iphone", 29, []int{2, 3}},
+	{"iphone", 40, []int{2, 3}},
+	{"iphone", 60, []int{2, 3}},
+	{"ipad", 20, []int{1, 2}},
+	{"ipad", 29, []int{1, 2}},
+	{"ipad", 40, []int{1, 2}},
+	{"ipad", 76, []int{1, 2}},
+	{"ipad", 83.5, []int{2}},
+	{"ios-marketing", 1024, []int{1}},
+}
+
+func validatePreset(preset string, outputFormat string, layout string) error {
+	switch preset {
+	case "":
+		return nil
+	case "android", "ios":
+	default:
+		return errors.Errorf("unknown icon set preset %q", preset)
+	}
+
+	if outputFormat != "set" {
+		return errors.Errorf("preset %s can be used only for set output format", preset)
+	}
+	if layout == "hicolor" {
+		return errors.Errorf("preset %s cannot be used with hicolor layout", preset)
+	}
+	return nil
+}
+
+func getPresetMinSize(preset string) int {
+	if preset == "ios" {
+		// marketing icon
+		return 1024
+	}
+	return 192
+}
+
+// files are relative to the output dir, every file is listed once (sizes shared by iPhone and iPad use the same file)
+func computePresetIcons(preset string, iconName string) []IconInfo {
+	var result []IconInfo
+	if preset == "android" {
+		if len(iconName) == 0 {
+			iconName = "ic_launcher"
+		}
+		for _, item := range androidMipmapSizes {
+			result = append(result, IconInfo{File: filepath.Join("mipmap-"+item.density, iconName+".png"), Size: item.size})
+		}
+		return result
+	}
+
+	isAdded := make(map[string]bool)
+	for _, item := range iosAppIconSizes {
+		for _, scale := range item.scales {
+			fileName := iosIconFileName(item.size, scale)
+			if !isAdded[fileName] {
+				isAdded[fileName] = true
+				result = append(result, IconInfo{File: filepath.Join(iosAppIconSetDir, fileName), Size: int(item.size * float64(scale))})
+			}
+		}
+	}
+	return result
+}
+
+func formatPointSize(size float64) string {
+	return strconv.FormatFloat(size, 'f', -1, 64)
+}
+
+func iosIconFileName(size float64, scale int) string {
+	return fmt.Sprintf("Icon-%s@%dx.png", formatPointSize(size), scale)
+}
+
+func computeIosAppIconEntries() []iosAppIconEntry {
+	var result []iosAppIconEntry
+	for _, item := range iosAppIconSizes {
+		size := formatPointSize(item.size)
+		for _, scale := range item.scales {
+			result = append(result, iosAppIconEntry{
+				Idiom:    item.idiom,
+				Size:     size + "x" + size,
+				Scale:    fmt.Sprintf("%dx", scale),
+				Filename: iosIconFileName(item.size, scale),
+			})
+		}
+	}
+	return result
+}
+
+func convertToPreset(inputInfo *InputFileInfo, sourceFile string, outDir string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	err := configureInputInfoFromSingleFile(sourceFile, false, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := computePresetIcons(configuration.Preset, configuration.IconName)
+	for index := range result {
+		result[index].File = filepath.Join(outDir, result[index].File)
+	}
+
+	err = util.MapAsync(len(result), func(taskIndex int) (func() error, error) {
+		icon := result[taskIndex]
+		return func() error {
+			err := fsutil.EnsureDir(filepath.Dir(icon.File))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			img, err := inputInfo.resizeMaxImage(inputInfo.maxImage, icon.Size)
+			if err != nil {
+				return err
+			}
+			return SaveImage(img, icon.File, PNG)
+		}, nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if configuration.Preset == "ios" {
+		err = writeIosContentsJson(filepath.Join(outDir, iosAppIconSetDir))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// https://developer.apple.com/library/archive/documentation/Xcode/Reference/xcode_ref-Asset_Catalog_Format/Contents.html
+func writeIosContentsJson(appIconSetDir string) error {
+	contents := struct {
+		Images []iosAppIconEntry `json:"images"`
+		Info   struct {
+			Version int    `json:"version"`
+			Author  string `json:"author"`
+		} `json:"info"`
+	}{Images: computeIosAppIconEntries()}
+	contents.Info.Version = 1
+	contents.Info.Author = "xcode"
+
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return fs.WriteFileAtomic(filepath.Join(appIconSetDir, "Contents.json"), data, 0644)
+}
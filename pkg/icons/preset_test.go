@@ -0,0 +1,72 @@
+package icons
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestValidatePreset(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(validatePreset("", "icns", "flat")).To(Succeed())
+	g.Expect(validatePreset("ios", "set", "flat")).To(Succeed())
+	g.Expect(validatePreset("windows", "set", "flat")).To(HaveOccurred())
+	g.Expect(validatePreset("android", "icns", "flat")).To(HaveOccurred())
+	g.Expect(validatePreset("android", "set", "hicolor")).To(HaveOccurred())
+}
+
+func TestConvertToPreset(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-preset")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 1024, 1024)), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+	request := &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "set",
+		OutputDir:       filepath.Join(tmpDir, "android"),
+		Preset:          "android",
+	}
+	result, err := ConvertIcon(context.Background(), request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Icons).To(HaveLen(5))
+	g.Expect(withoutIconMetadata(result.Icons)[0]).To(Equal(IconInfo{File: filepath.Join(tmpDir, "android", "mipmap-mdpi", "ic_launcher.png"), Size: 48}))
+	g.Expect(withoutIconMetadata(result.Icons)[4]).To(Equal(IconInfo{File: filepath.Join(tmpDir, "android", "mipmap-xxxhdpi", "ic_launcher.png"), Size: 192}))
+	g.Expect(readSourceSize(result.Icons[4].File)).To(Equal(192))
+
+	request.Preset = "ios"
+	request.OutputDir = filepath.Join(tmpDir, "ios")
+	result, err = ConvertIcon(context.Background(), request)
+	g.Expect(err).NotTo(HaveOccurred())
+	appIconSetDir := filepath.Join(tmpDir, "ios", "AppIcon.appiconset")
+	// 20@2x, 29@2x and 40@2x of iPhone and iPad are the same files
+	g.Expect(result.Icons).To(HaveLen(15))
+	g.Expect(withoutIconMetadata(result.Icons)).To(ContainElement(IconInfo{File: filepath.Join(appIconSetDir, "Icon-83.5@2x.png"), Size: 167}))
+	g.Expect(withoutIconMetadata(result.Icons)).To(ContainElement(IconInfo{File: filepath.Join(appIconSetDir, "Icon-1024@1x.png"), Size: 1024}))
+	for _, icon := range result.Icons {
+		g.Expect(readSourceSize(icon.File)).To(Equal(icon.Size))
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(appIconSetDir, "Contents.json"))
+	g.Expect(err).NotTo(HaveOccurred())
+	var contents struct {
+		Images []iosAppIconEntry `json:"images"`
+	}
+	g.Expect(json.Unmarshal(data, &contents)).To(Succeed())
+	g.Expect(contents.Images).To(HaveLen(18))
+	g.Expect(contents.Images[0]).To(Equal(iosAppIconEntry{Idiom: "iphone", Size: "20x20", Scale: "2x", Filename: "Icon-20@2x.png"}))
+	for _, image := range contents.Images {
+		g.Expect(filepath.Join(appIconSetDir, image.Filename)).To(BeARegularFile())
+	}
+}
@@ -0,0 +1,93 @@
+package icons
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// point sizes that have retina (@2x) variant in ICNS
+var retinaPointSizes = []int{16, 32, 128, 256, 512}
+
+// issue is an error in strict mode and a warning otherwise
+func reportQualityIssue(isStrict bool, issue *IconQualityError) error {
+	if isStrict {
+		return errors.WithStack(issue)
+	}
+
+	log.WithFields(log.Fields{
+		"file":  issue.File,
+		"code":  issue.errorCode,
+		"error": issue.Message,
+	}).Warn("icon quality issue (use --strict to fail)")
+	return nil
+}
+
+// palette without transparent color cannot have transparent background and anti-aliased edges
+func checkPaletteAlpha(file string, isStrict bool) error {
+	isPaletteWithoutAlpha, err := hasPaletteWithoutAlpha(file)
+	if err != nil || !isPaletteWithoutAlpha {
+		return err
+	}
+	return reportQualityIssue(isStrict, &IconQualityError{File: file, Message: "uses palette without alpha, please provide true color image with alpha channel", errorCode: "ERR_ICON_NO_ALPHA"})
+}
+
+// icon set for ICNS must contain @2x variant for every provided point size, otherwise it is upscaled and blurry on retina displays
+func checkRetinaSizes(dir string, icons []IconInfo, isStrict bool) error {
+	sizes := make(map[int]bool)
+	for _, icon := range icons {
+		sizes[icon.Size] = true
+	}
+
+	var missing []string
+	for _, pointSize := range retinaPointSizes {
+		if sizes[pointSize] && !sizes[pointSize*2] {
+			missing = append(missing, strconv.Itoa(pointSize*2))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return reportQualityIssue(isStrict, &IconQualityError{File: dir, Message: "missing retina sizes " + strings.Join(missing, ", "), errorCode: "ERR_ICON_MISSING_RETINA"})
+}
+
+// only PNG and GIF can be paletted, header of other formats is not decoded
+func hasPaletteWithoutAlpha(file string) (bool, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	defer util.Close(reader)
+
+	bufferedReader := bufio.NewReader(reader)
+	header, err := bufferedReader.Peek(8)
+	if err != nil || !(bytes.Equal(header, pngHeader) || isGif(header)) {
+		return false, nil
+	}
+
+	// config doesn't include transparency (tRNS chunk of PNG, graphic control extension of GIF), so, image is decoded
+	decoded, _, err := image.Decode(bufferedReader)
+	if err != nil {
+		return false, nil
+	}
+
+	paletted, ok := decoded.(*image.Paletted)
+	if !ok {
+		return false, nil
+	}
+	for _, entry := range paletted.Palette {
+		_, _, _, alpha := entry.RGBA()
+		if alpha != 0xffff {
+			return false, nil
+		}
+	}
+	return true, nil
+}
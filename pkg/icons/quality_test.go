@@ -0,0 +1,79 @@
+package icons
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func writeTestPalettedPng(g *GomegaWithT, file string, palette color.Palette, size int) {
+	writer, err := os.Create(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(png.Encode(writer, image.NewPaletted(image.Rect(0, 0, size, size), palette))).To(Succeed())
+	g.Expect(writer.Close()).To(Succeed())
+}
+
+func TestCheckPaletteAlpha(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "quality")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	opaqueFile := filepath.Join(tmpDir, "opaque.png")
+	writeTestPalettedPng(g, opaqueFile, color.Palette{color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}}, 16)
+	transparentFile := filepath.Join(tmpDir, "transparent.png")
+	writeTestPalettedPng(g, transparentFile, color.Palette{color.RGBA{}, color.RGBA{B: 255, A: 255}}, 16)
+	trueColorFile := filepath.Join(tmpDir, "true-color.png")
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 16, 16)), trueColorFile, PNG)).To(Succeed())
+
+	err = checkPaletteAlpha(opaqueFile, true)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(toUserError(err).ErrorCode()).To(Equal("ERR_ICON_NO_ALPHA"))
+	// warning only
+	g.Expect(checkPaletteAlpha(opaqueFile, false)).To(Succeed())
+
+	g.Expect(checkPaletteAlpha(transparentFile, true)).To(Succeed())
+	g.Expect(checkPaletteAlpha(trueColorFile, true)).To(Succeed())
+}
+
+func TestCheckRetinaSizes(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(checkRetinaSizes("icons", []IconInfo{{Size: 16}, {Size: 32}, {Size: 64}, {Size: 1024}}, true)).To(Succeed())
+
+	err := checkRetinaSizes("icons", []IconInfo{{Size: 16}, {Size: 256}, {Size: 512}}, true)
+	g.Expect(err).To(HaveOccurred())
+	qualityError := errors.Cause(err).(*IconQualityError)
+	g.Expect(qualityError.ErrorCode()).To(Equal("ERR_ICON_MISSING_RETINA"))
+	g.Expect(qualityError.Message).To(Equal("missing retina sizes 32, 1024"))
+}
+
+func TestStrictDisablesUpscale(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "quality")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 64, 64)), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+	_, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{"icon.png"},
+		FallbackSources: &[]string{},
+		Roots:           &[]string{tmpDir},
+		OutputFormat:    "ico",
+		OutputDir:       filepath.Join(tmpDir, "out"),
+		IsUpscale:       true,
+		IsStrict:        true,
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(toUserError(err).ErrorCode()).To(Equal("ERR_ICON_TOO_SMALL"))
+}
@@ -0,0 +1,137 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+type colorCount struct {
+	color color.NRGBA
+	count int
+}
+
+// median cut, only pixels with alpha >= 128 are taken into account (palette colors are opaque)
+// if image has not more than maxColors unique colors, palette contains exactly these colors
+func quantize(img *image.NRGBA, maxColors int) color.Palette {
+	counts := make(map[color.NRGBA]int)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if c.A >= 128 {
+				c.A = 255
+				counts[c]++
+			}
+		}
+	}
+
+	colors := make([]colorCount, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, colorCount{c, count})
+	}
+	// deterministic result
+	sort.Slice(colors, func(i, j int) bool {
+		return colorKey(colors[i].color) < colorKey(colors[j].color)
+	})
+
+	if len(colors) == 0 {
+		return color.Palette{color.NRGBA{A: 255}}
+	}
+
+	if len(colors) <= maxColors {
+		result := make(color.Palette, len(colors))
+		for index, item := range colors {
+			result[index] = item.color
+		}
+		return result
+	}
+
+	boxes := [][]colorCount{colors}
+	for len(boxes) < maxColors {
+		// split box with the largest channel range
+		boxIndex, channel, maxRange := -1, 0, 0
+		for index, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			boxChannel, boxRange := widestChannel(box)
+			if boxRange > maxRange {
+				boxIndex, channel, maxRange = index, boxChannel, boxRange
+			}
+		}
+		if boxIndex == -1 {
+			break
+		}
+
+		box := boxes[boxIndex]
+		sort.SliceStable(box, func(i, j int) bool {
+			return channelValue(box[i].color, channel) < channelValue(box[j].color, channel)
+		})
+
+		// median by pixel count
+		total := 0
+		for _, item := range box {
+			total += item.count
+		}
+		median, accumulated := 1, 0
+		for index, item := range box[:len(box)-1] {
+			accumulated += item.count
+			if accumulated*2 >= total {
+				median = index + 1
+				break
+			}
+		}
+
+		boxes[boxIndex] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+
+	result := make(color.Palette, len(boxes))
+	for index, box := range boxes {
+		var r, g, b, total int
+		for _, item := range box {
+			r += int(item.color.R) * item.count
+			g += int(item.color.G) * item.count
+			b += int(item.color.B) * item.count
+			total += item.count
+		}
+		result[index] = color.NRGBA{R: uint8(r / total), G: uint8(g / total), B: uint8(b / total), A: 255}
+	}
+	return result
+}
+
+func colorKey(c color.NRGBA) uint32 {
+	return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+func channelValue(c color.NRGBA, channel int) uint8 {
+	switch channel {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+func widestChannel(box []colorCount) (int, int) {
+	resultChannel, resultRange := 0, -1
+	for channel := 0; channel < 3; channel++ {
+		min, max := uint8(255), uint8(0)
+		for _, item := range box {
+			value := channelValue(item.color, channel)
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max = value
+			}
+		}
+		if int(max)-int(min) > resultRange {
+			resultChannel, resultRange = channel, int(max)-int(min)
+		}
+	}
+	return resultChannel, resultRange
+}
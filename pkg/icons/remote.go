@@ -0,0 +1,145 @@
+package icons
+
+import (
+	"context"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// icon source is not expected to be large, limit protects against misconfigured URL (e.g. pointing to installer)
+const maxRemoteIconSize = 32 * 1024 * 1024
+
+// extension is used by the conversion pipeline to detect format, so, it is derived from content type if URL path doesn't have known one
+var iconContentTypeToExtension = map[string]string{
+	"image/png":                ".png",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"image/icns":               ".icns",
+	"image/x-icns":             ".icns",
+	"image/svg+xml":            ".svg",
+	"image/webp":               ".webp",
+	"image/avif":               ".avif",
+	"image/gif":                ".gif",
+	"image/bmp":                ".bmp",
+	"image/tiff":               ".tiff",
+	"image/heic":               ".heic",
+}
+
+func isRemoteSource(source string) bool {
+	return strings.HasPrefix(source, "https://")
+}
+
+// replaces URLs with downloaded files (temp dir is removed on exit), local sources are kept as is
+func downloadRemoteSources(ctx context.Context, sources []string) ([]string, error) {
+	var downloader *download.Downloader
+	result := make([]string, 0, len(sources))
+	for _, source := range sources {
+		if !isRemoteSource(source) {
+			result = append(result, source)
+			continue
+		}
+
+		if downloader == nil {
+			downloader = download.NewDownloader()
+			downloader.Context = ctx
+		}
+		file, err := downloadIconSource(downloader, source)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+func downloadIconSource(downloader *download.Downloader, sourceUrl string) (string, error) {
+	parsedUrl, err := url.Parse(sourceUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid icon URL %s", sourceUrl)
+	}
+
+	tempDir, err := util.TempDir("", ".icon-source")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// name is not known until content type is checked, location is resolved with temporary one
+	location, err := downloader.Resolve(sourceUrl, filepath.Join(tempDir, "icon"))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	fileName, err := computeIconFileName(parsedUrl, location.ContentType)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot use %s as icon source", sourceUrl)
+	}
+	if location.ContentLength > maxRemoteIconSize {
+		return "", errors.Errorf("cannot use %s as icon source: size %d exceeds limit %d", sourceUrl, location.ContentLength, maxRemoteIconSize)
+	}
+
+	location.OutFileName = filepath.Join(tempDir, fileName)
+	err = downloader.DownloadResolved(location, "", sourceUrl)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	// content length can be not specified by server
+	fileInfo, err := os.Stat(location.OutFileName)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if fileInfo.Size() > maxRemoteIconSize {
+		return "", errors.Errorf("cannot use %s as icon source: size %d exceeds limit %d", sourceUrl, fileInfo.Size(), maxRemoteIconSize)
+	}
+
+	log.WithFields(log.Fields{
+		"url":  sourceUrl,
+		"file": location.OutFileName,
+	}).Debug("icon source downloaded")
+	return location.OutFileName, nil
+}
+
+// application/octet-stream is allowed (default of object storages) if URL path has known extension
+func computeIconFileName(sourceUrl *url.URL, contentType string) (string, error) {
+	name := path.Base(sourceUrl.Path)
+	// decoded path can contain anything, name must be not able to escape the temp dir
+	if name == "/" || name == "." || name == ".." || strings.ContainsAny(name, `\:`) {
+		name = "icon"
+	}
+
+	mediaType := "application/octet-stream"
+	if len(contentType) != 0 {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid content type %s", contentType)
+		}
+	}
+
+	extension, isKnownType := iconContentTypeToExtension[mediaType]
+	if !isKnownType && mediaType != "application/octet-stream" {
+		return "", errors.Errorf("unsupported content type %s", mediaType)
+	}
+
+	// extension is checked case-sensitively by the conversion pipeline
+	nameExtension := strings.ToLower(path.Ext(name))
+	for _, knownExtension := range iconContentTypeToExtension {
+		if nameExtension == knownExtension {
+			return strings.TrimSuffix(name, path.Ext(name)) + nameExtension, nil
+		}
+	}
+
+	if !isKnownType {
+		return "", errors.Errorf("cannot detect image format: content type is %s and URL path has no known extension", mediaType)
+	}
+	return name + extension, nil
+}
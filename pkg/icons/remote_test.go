@@ -0,0 +1,67 @@
+package icons
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/download"
+	. "github.com/onsi/gomega"
+)
+
+func TestComputeIconFileName(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fileName := func(rawUrl string, contentType string) (string, error) {
+		parsedUrl, err := url.Parse(rawUrl)
+		g.Expect(err).NotTo(HaveOccurred())
+		return computeIconFileName(parsedUrl, contentType)
+	}
+
+	g.Expect(fileName("https://cdn.example.com/brand/logo.PNG", "image/png")).To(Equal("logo.png"))
+	g.Expect(fileName("https://cdn.example.com/brand/logo", "image/png; charset=binary")).To(Equal("logo.png"))
+	g.Expect(fileName("https://cdn.example.com/brand/logo.icns", "application/octet-stream")).To(Equal("logo.icns"))
+	g.Expect(fileName("https://cdn.example.com/", "image/svg+xml")).To(Equal("icon.svg"))
+	g.Expect(fileName("https://cdn.example.com/..", "image/png")).To(Equal("icon.png"))
+
+	_, err := fileName("https://cdn.example.com/logo.png", "text/html")
+	g.Expect(err).To(HaveOccurred())
+	_, err = fileName("https://cdn.example.com/logo", "application/octet-stream")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDownloadIconSource(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var content bytes.Buffer
+	g.Expect(png.Encode(&content, image.NewNRGBA(image.Rect(0, 0, 16, 16)))).To(Succeed())
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/brand/logo":
+			writer.Header().Set("Content-Type", "image/png")
+			_, _ = writer.Write(content.Bytes())
+		default:
+			writer.Header().Set("Content-Type", "text/html")
+			_, _ = writer.Write([]byte("<html></html>"))
+		}
+	}))
+	defer server.Close()
+
+	downloader := download.NewDownloaderWithTransport(server.Client().Transport.(*http.Transport))
+
+	file, err := downloadIconSource(downloader, server.URL+"/brand/logo")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file).To(HaveSuffix("logo.png"))
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data).To(Equal(content.Bytes()))
+
+	_, err = downloadIconSource(downloader, server.URL+"/login")
+	g.Expect(err).To(MatchError(ContainSubstring("unsupported content type text/html")))
+}
@@ -0,0 +1,169 @@
+package icons
+
+import (
+	"encoding/json"
+	"image"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+// unsharp mask is applied only to small sizes (downscaled a lot, so, look muddy)
+const maxSharpenSize = 48
+
+var resizeFilters = map[string]imaging.ResampleFilter{
+	"lanczos":    imaging.Lanczos,
+	"mitchell":   imaging.MitchellNetravali,
+	"catmullrom": imaging.CatmullRom,
+	"box":        imaging.Box,
+}
+
+// ResizeFilterRule selects filter for target sizes in the range (inclusive, 0 means no limit)
+type ResizeFilterRule struct {
+	MinSize int    `json:"minSize,omitempty"`
+	MaxSize int    `json:"maxSize,omitempty"`
+	Filter  string `json:"filter"`
+}
+
+type ResizeOptions struct {
+	// lanczos (default), mitchell, catmullrom or box
+	Filter string `json:"filter,omitempty"`
+	// the first matched rule wins, Filter is used if no rule matches
+	Rules []ResizeFilterRule `json:"rules,omitempty"`
+	// sigma of unsharp mask applied to sizes <= 48px, 0 to disable
+	Sharpen float64 `json:"sharpen,omitempty"`
+}
+
+// --resize-config is a JSON file (ResizeOptions), flags take precedence (rules from flags are checked first)
+func configureResizeFlags(command *kingpin.CmdClause) func() (ResizeOptions, error) {
+	configFile := command.Flag("resize-config", "JSON file with resize options ({\"filter\": \"lanczos\", \"rules\": [{\"maxSize\": 32, \"filter\": \"box\"}], \"sharpen\": 0.5})").String()
+	filter := command.Flag("resize-filter", "resize filter (lanczos, mitchell, catmullrom or box), lanczos by default").Enum("lanczos", "mitchell", "catmullrom", "box")
+	rules := command.Flag("resize-rule", "resize filter for size range, e.g. 16-32=box or -48=catmullrom (can be specified several times)").Strings()
+	sharpen := command.Flag("sharpen", "sigma of unsharp mask applied to sizes <= 48px (e.g. 0.5)").Float64()
+
+	return func() (ResizeOptions, error) {
+		var result ResizeOptions
+		if len(*configFile) != 0 {
+			data, err := ioutil.ReadFile(*configFile)
+			if err != nil {
+				return result, errors.WithStack(err)
+			}
+			err = json.Unmarshal(data, &result)
+			if err != nil {
+				return result, errors.Wrapf(err, "cannot parse resize config %s", *configFile)
+			}
+		}
+
+		if len(*filter) != 0 {
+			result.Filter = *filter
+		}
+		if *sharpen != 0 {
+			result.Sharpen = *sharpen
+		}
+
+		var flagRules []ResizeFilterRule
+		for _, rawRule := range *rules {
+			rule, err := parseResizeFilterRule(rawRule)
+			if err != nil {
+				return result, err
+			}
+			flagRules = append(flagRules, rule)
+		}
+		result.Rules = append(flagRules, result.Rules...)
+		return result, result.validate()
+	}
+}
+
+// MIN-MAX=filter (MIN or MAX can be omitted), SIZE=filter for exact size
+func parseResizeFilterRule(value string) (ResizeFilterRule, error) {
+	var result ResizeFilterRule
+	separator := strings.IndexByte(value, '=')
+	if separator == -1 {
+		return result, errors.Errorf("invalid resize rule %q, expected MIN-MAX=filter", value)
+	}
+
+	result.Filter = value[separator+1:]
+	sizeRange := value[:separator]
+	minSize, maxSize := sizeRange, sizeRange
+	dash := strings.IndexByte(sizeRange, '-')
+	if dash != -1 {
+		minSize, maxSize = sizeRange[:dash], sizeRange[dash+1:]
+	}
+
+	var err error
+	if len(minSize) != 0 {
+		result.MinSize, err = strconv.Atoi(minSize)
+		if err != nil {
+			return result, errors.Errorf("invalid resize rule %q, min size is not a number", value)
+		}
+	}
+	if len(maxSize) != 0 {
+		result.MaxSize, err = strconv.Atoi(maxSize)
+		if err != nil {
+			return result, errors.Errorf("invalid resize rule %q, max size is not a number", value)
+		}
+	}
+	return result, nil
+}
+
+func (t *ResizeOptions) validate() error {
+	if len(t.Filter) != 0 {
+		if _, ok := resizeFilters[t.Filter]; !ok {
+			return errors.Errorf("unknown resize filter %q", t.Filter)
+		}
+	}
+	for _, rule := range t.Rules {
+		if _, ok := resizeFilters[rule.Filter]; !ok {
+			return errors.Errorf("unknown resize filter %q", rule.Filter)
+		}
+		if rule.MinSize < 0 || rule.MaxSize < 0 || (rule.MaxSize != 0 && rule.MinSize > rule.MaxSize) {
+			return errors.Errorf("invalid size range %d-%d of resize rule", rule.MinSize, rule.MaxSize)
+		}
+	}
+	if t.Sharpen < 0 {
+		return errors.Errorf("sharpen sigma must be positive, got %v", t.Sharpen)
+	}
+	return nil
+}
+
+// nil options means Lanczos without sharpening
+func (t *ResizeOptions) filterForSize(size int) imaging.ResampleFilter {
+	if t == nil {
+		return imaging.Lanczos
+	}
+
+	name := t.Filter
+	for _, rule := range t.Rules {
+		if size >= rule.MinSize && (rule.MaxSize == 0 || size <= rule.MaxSize) {
+			name = rule.Filter
+			break
+		}
+	}
+
+	filter, ok := resizeFilters[name]
+	if !ok {
+		return imaging.Lanczos
+	}
+	return filter
+}
+
+func (t *ResizeOptions) resize(img image.Image, size int) *image.NRGBA {
+	result := imaging.Resize(img, size, size, t.filterForSize(size))
+	if t != nil && t.Sharpen > 0 && size <= maxSharpenSize {
+		result = imaging.Sharpen(result, t.Sharpen)
+	}
+	return result
+}
+
+// part of icon cache key
+func (t *ResizeOptions) cacheKey() string {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,70 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseResizeFilterRule(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	rule, err := parseResizeFilterRule("16-32=box")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).To(Equal(ResizeFilterRule{MinSize: 16, MaxSize: 32, Filter: "box"}))
+
+	rule, err = parseResizeFilterRule("-48=catmullrom")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).To(Equal(ResizeFilterRule{MaxSize: 48, Filter: "catmullrom"}))
+
+	rule, err = parseResizeFilterRule("64=mitchell")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rule).To(Equal(ResizeFilterRule{MinSize: 64, MaxSize: 64, Filter: "mitchell"}))
+
+	_, err = parseResizeFilterRule("a-32=box")
+	g.Expect(err).To(HaveOccurred())
+	_, err = parseResizeFilterRule("32")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestResizeFilterForSize(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var nilOptions *ResizeOptions
+	g.Expect(nilOptions.filterForSize(16).Support).To(Equal(imaging.Lanczos.Support))
+
+	options := &ResizeOptions{
+		Filter: "mitchell",
+		Rules:  []ResizeFilterRule{{MaxSize: 32, Filter: "box"}, {MaxSize: 48, Filter: "catmullrom"}},
+	}
+	g.Expect(options.validate()).NotTo(HaveOccurred())
+	g.Expect(options.filterForSize(16).Support).To(Equal(imaging.Box.Support))
+	g.Expect(options.filterForSize(48).Support).To(Equal(imaging.CatmullRom.Support))
+	g.Expect(options.filterForSize(256).Support).To(Equal(imaging.MitchellNetravali.Support))
+
+	g.Expect((&ResizeOptions{Filter: "nearest"}).validate()).To(HaveOccurred())
+	g.Expect((&ResizeOptions{Rules: []ResizeFilterRule{{MinSize: 64, MaxSize: 32, Filter: "box"}}}).validate()).To(HaveOccurred())
+}
+
+func TestResizeSharpenSmallSizesOnly(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// vertical edge
+	source := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			if x < 128 {
+				source.Set(x, y, color.NRGBA{A: 255})
+			} else {
+				source.Set(x, y, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+			}
+		}
+	}
+
+	options := &ResizeOptions{Sharpen: 1}
+	g.Expect(options.resize(source, 32).Pix).NotTo(Equal(imaging.Resize(source, 32, 32, imaging.Lanczos).Pix))
+	g.Expect(options.resize(source, 64).Pix).To(Equal(imaging.Resize(source, 64, 64, imaging.Lanczos).Pix))
+}
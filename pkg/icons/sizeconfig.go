@@ -0,0 +1,174 @@
+package icons
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// looked up in the source dir (or next to the source file) if config is not specified explicitly
+const sizeConfigFileName = "icon.config.json"
+
+// {"sizes": {"16": "hand-pixeled-16.png", "512": "generated-512.png"}}, relative paths are resolved against the config dir
+type sizeConfig struct {
+	Sizes map[string]string `json:"sizes"`
+}
+
+// returns nil if config is not specified and not found, every override is validated to be PNG of the exact size
+func loadSizeOverrides(configFile string, resolvedPath string, fileInfo os.FileInfo) (map[int]string, error) {
+	if len(configFile) == 0 {
+		dir := resolvedPath
+		if !fileInfo.IsDir() {
+			dir = filepath.Dir(resolvedPath)
+		}
+		configFile = filepath.Join(dir, sizeConfigFileName)
+		_, err := os.Stat(configFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var config sizeConfig
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse icon size config %s", configFile)
+	}
+
+	configDir := filepath.Dir(configFile)
+	result := make(map[int]string, len(config.Sizes))
+	for sizeString, file := range config.Sizes {
+		size, err := strconv.Atoi(sizeString)
+		if err != nil || size <= 0 {
+			return nil, errors.Errorf("invalid size %q in icon size config %s, positive integer is expected", sizeString, configFile)
+		}
+
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(configDir, file)
+		}
+		err = validateSizeOverride(file, size)
+		if err != nil {
+			return nil, err
+		}
+		result[size] = file
+	}
+
+	log.WithFields(log.Fields{
+		"config": configFile,
+		"sizes":  len(result),
+	}).Debug("icon size overrides loaded")
+	return result, nil
+}
+
+// override is used as is (embedded into ICNS / ICO or referenced by icon set), so, must be PNG of the declared size
+func validateSizeOverride(file string, size int) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	config, format, err := image.DecodeConfig(reader)
+	if err != nil {
+		return errors.Wrapf(err, "cannot decode icon size override %s", file)
+	}
+	if format != "png" {
+		return errors.Errorf("icon size override %s must be PNG, got %s", file, format)
+	}
+	if config.Width != size || config.Height != size {
+		return errors.Errorf("icon size override %s must be %dx%d, got %dx%d", file, size, size, config.Width, config.Height)
+	}
+	return nil
+}
+
+// overrides take precedence over provided files and images extracted from source (e.g. ICNS), sizes larger than the max icon are not used
+func (t *InputFileInfo) applySizeOverrides() {
+	for size, file := range t.sizeOverrides {
+		t.SizeToPath[size] = file
+		delete(t.sizeToImage, size)
+	}
+}
+
+// override is copied into the output dir instead of produced file of the same size (missing sizes are added), so, set (and hicolor layout) consists of files of the output dir.
+// Overrides are used as is: trim, padding, background and mask are not applied, and set is not cached if overrides are specified.
+func applySizeOverridesToSet(icons []IconInfo, sizeOverrides map[int]string, outDir string) ([]IconInfo, error) {
+	result := make([]IconInfo, 0, len(icons)+len(sizeOverrides))
+	isApplied := make(map[int]bool, len(sizeOverrides))
+	for _, icon := range icons {
+		file, exists := sizeOverrides[icon.Size]
+		if !exists {
+			result = append(result, icon)
+			continue
+		}
+
+		overrideIcon, err := copySizeOverride(file, icon.Size, icon.File, outDir)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, overrideIcon)
+		isApplied[icon.Size] = true
+	}
+
+	for size, file := range sizeOverrides {
+		if !isApplied[size] {
+			overrideIcon, err := copySizeOverride(file, size, "", outDir)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, overrideIcon)
+		}
+	}
+
+	sortBySize(result)
+	return result, nil
+}
+
+// produced file is replaced, source file used as is (outside of the output dir) is not modified - override is written as icon_NxN.png
+func copySizeOverride(file string, size int, producedFile string, outDir string) (IconInfo, error) {
+	if len(outDir) == 0 {
+		return IconInfo{File: file, Size: size}, nil
+	}
+
+	target := producedFile
+	if len(target) == 0 || !isInDir(target, outDir) {
+		target = filepath.Join(outDir, fmt.Sprintf("icon_%dx%d.png", size, size))
+	}
+
+	// produced file can be a hard link, so, removed instead of overwriting
+	err := os.Remove(target)
+	if err != nil && !os.IsNotExist(err) {
+		return IconInfo{}, errors.WithStack(err)
+	}
+	err = fsutil.CopyFile(file, target, 0644)
+	if err != nil {
+		return IconInfo{}, err
+	}
+	return IconInfo{File: target, Size: size}, nil
+}
+
+// sorted by size, for reporting
+func sizeOverridesToIcons(sizeOverrides map[int]string) []IconInfo {
+	result := make([]IconInfo, 0, len(sizeOverrides))
+	for size, file := range sizeOverrides {
+		result = append(result, IconInfo{File: file, Size: size})
+	}
+	sortBySize(result)
+	return result
+}
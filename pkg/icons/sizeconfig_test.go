@@ -0,0 +1,150 @@
+package icons
+
+import (
+	"context"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/disintegration/imaging"
+	. "github.com/onsi/gomega"
+)
+
+func TestLoadSizeOverrides(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-size-config")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(SaveImage(imaging.New(512, 512, color.NRGBA{R: 255, A: 255}), filepath.Join(tmpDir, "icon.png"), PNG)).To(Succeed())
+	g.Expect(os.Mkdir(filepath.Join(tmpDir, "small"), 0755)).To(Succeed())
+	g.Expect(SaveImage(imaging.New(16, 16, color.NRGBA{B: 255, A: 255}), filepath.Join(tmpDir, "small", "icon-16.png"), PNG)).To(Succeed())
+
+	fileInfo, err := os.Stat(filepath.Join(tmpDir, "icon.png"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// not found
+	sizeOverrides, err := loadSizeOverrides("", filepath.Join(tmpDir, "icon.png"), fileInfo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sizeOverrides).To(BeNil())
+
+	configFile := filepath.Join(tmpDir, sizeConfigFileName)
+	g.Expect(ioutil.WriteFile(configFile, []byte(`{"sizes": {"16": "small/icon-16.png"}}`), 0644)).To(Succeed())
+	sizeOverrides, err = loadSizeOverrides("", filepath.Join(tmpDir, "icon.png"), fileInfo)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sizeOverrides).To(Equal(map[int]string{16: filepath.Join(tmpDir, "small", "icon-16.png")}))
+
+	g.Expect(ioutil.WriteFile(configFile, []byte(`{"sizes": {"32": "small/icon-16.png"}}`), 0644)).To(Succeed())
+	_, err = loadSizeOverrides(configFile, filepath.Join(tmpDir, "icon.png"), fileInfo)
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(ioutil.WriteFile(configFile, []byte(`{"sizes": {"small": "small/icon-16.png"}}`), 0644)).To(Succeed())
+	_, err = loadSizeOverrides(configFile, filepath.Join(tmpDir, "icon.png"), fileInfo)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestConvertIconWithSizeOverrides(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-size-config")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceDir := filepath.Join(tmpDir, "source")
+	g.Expect(os.Mkdir(sourceDir, 0755)).To(Succeed())
+	g.Expect(SaveImage(imaging.New(512, 512, color.NRGBA{R: 255, A: 255}), filepath.Join(sourceDir, "icon.png"), PNG)).To(Succeed())
+	overrideFile := filepath.Join(tmpDir, "icon-16.png")
+	g.Expect(SaveImage(imaging.New(16, 16, color.NRGBA{B: 255, A: 255}), overrideFile, PNG)).To(Succeed())
+	configFile := filepath.Join(tmpDir, "sizes.json")
+	g.Expect(ioutil.WriteFile(configFile, []byte(`{"sizes": {"16": "icon-16.png"}}`), 0644)).To(Succeed())
+
+	// 16px is not produced for ICNS from the largest image, but hand-pixeled one is used
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(sourceDir, "icon.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "icns",
+		OutputDir:       filepath.Join(tmpDir, "out"),
+		SizeConfig:      configFile,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	sizeToImage, err := readIcnsPngImages(result.Icons[0].File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sizeToImage).To(HaveKey(16))
+	g.Expect(color.NRGBAModel.Convert(sizeToImage[16].At(8, 8))).To(Equal(color.NRGBA{B: 255, A: 255}))
+
+	// sizes are produced from icon.png of the source dir
+	result, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{sourceDir},
+		FallbackSources: &[]string{},
+		OutputFormat:    "set",
+		OutputDir:       filepath.Join(tmpDir, "set"),
+		SizeConfig:      configFile,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	// override is copied into the output dir instead of produced file
+	g.Expect(withoutIconMetadata(result.Icons)).To(ContainElement(IconInfo{File: filepath.Join(tmpDir, "set", "icon_16x16.png"), Size: 16}))
+	g.Expect(result.Icons[len(result.Icons)-1].Size).To(Equal(512))
+	g.Expect(result.Icons[0].Size).To(Equal(16))
+	expectOverride := func(file string) {
+		img, err := LoadImage(file)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(color.NRGBAModel.Convert(img.At(8, 8))).To(Equal(color.NRGBA{B: 255, A: 255}))
+	}
+	expectOverride(result.Icons[0].File)
+
+	result, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{sourceDir},
+		FallbackSources: &[]string{},
+		OutputFormat:    "set",
+		OutputDir:       filepath.Join(tmpDir, "hicolor"),
+		SizeConfig:      configFile,
+		Layout:          "hicolor",
+		IconName:        "foo",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	for _, icon := range result.Icons {
+		g.Expect(icon.File).To(Equal(filepath.Join(tmpDir, "hicolor", "hicolor", hicolorSizeDir(icon.Size), "foo.png")))
+		g.Expect(icon.File).To(BeARegularFile())
+	}
+	g.Expect(result.Icons[0].Size).To(Equal(16))
+	expectOverride(result.Icons[0].File)
+	// override file is not modified or moved
+	expectOverride(overrideFile)
+}
+
+func TestApplySizeOverridesToSet(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-size-config")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	outDir := filepath.Join(tmpDir, "out")
+	g.Expect(os.Mkdir(outDir, 0755)).To(Succeed())
+	for _, name := range []string{"icon_32x32.png", "icon_256x256.png"} {
+		g.Expect(ioutil.WriteFile(filepath.Join(outDir, name), []byte("produced"), 0644)).To(Succeed())
+	}
+	for _, name := range []string{"16.png", "32.png"} {
+		g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, name), []byte("override "+name), 0644)).To(Succeed())
+	}
+
+	icons := []IconInfo{{File: filepath.Join(outDir, "icon_32x32.png"), Size: 32}, {File: filepath.Join(outDir, "icon_256x256.png"), Size: 256}}
+	result, err := applySizeOverridesToSet(icons, map[int]string{32: filepath.Join(tmpDir, "32.png"), 16: filepath.Join(tmpDir, "16.png")}, outDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal([]IconInfo{
+		{File: filepath.Join(outDir, "icon_16x16.png"), Size: 16},
+		{File: filepath.Join(outDir, "icon_32x32.png"), Size: 32},
+		{File: filepath.Join(outDir, "icon_256x256.png"), Size: 256},
+	}))
+
+	for file, expected := range map[string]string{"icon_16x16.png": "override 16.png", "icon_32x32.png": "override 32.png", "icon_256x256.png": "produced"} {
+		data, err := ioutil.ReadFile(filepath.Join(outDir, file))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(data)).To(Equal(expected))
+	}
+}
@@ -0,0 +1,1403 @@
+package icons
+
+import (
+	"encoding/xml"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/vector"
+)
+
+// size of image produced from SVG if concrete size is not requested (max icns size)
+const svgRenderSize = 1024
+
+// http://spencermortensen.com/articles/bezier-circle/
+const bezierCircleKappa = 0.5522847498
+
+func isSvgFile(file string) bool {
+	return strings.HasSuffix(file, ".svg") || strings.HasSuffix(file, ".SVG")
+}
+
+// Pure Go SVG renderer that supports subset of SVG 1.1 used by icons: shapes, paths, groups, transforms, solid colors and gradients.
+// Text, filters, masks and clip paths are not supported.
+func RenderSvg(file string, size int) (image.Image, error) {
+	document, err := readSvg(file)
+	if err != nil {
+		return nil, err
+	}
+	return document.render(size)
+}
+
+// document can be rendered several times (at every icon size), concurrently
+func readSvg(file string) (*svgDocument, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	document, err := parseSvg(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse SVG %s", file)
+	}
+	return document, nil
+}
+
+type svgElement struct {
+	name       string
+	attributes map[string]string
+	children   []*svgElement
+}
+
+func (t *svgElement) get(name string) string {
+	return t.attributes[name]
+}
+
+type svgDocument struct {
+	root *svgElement
+	// gradients and other referenced by id elements
+	idToElement map[string]*svgElement
+
+	viewBox [4]float64
+}
+
+func parseSvg(reader io.Reader) (*svgDocument, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.Strict = false
+
+	document := &svgDocument{
+		idToElement: make(map[string]*svgElement),
+	}
+
+	var stack []*svgElement
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			element := &svgElement{
+				name:       token.Name.Local,
+				attributes: make(map[string]string, len(token.Attr)),
+			}
+
+			for _, attribute := range token.Attr {
+				element.attributes[attribute.Name.Local] = strings.TrimSpace(attribute.Value)
+			}
+
+			// style property has priority over presentation attribute
+			for _, declaration := range strings.Split(element.attributes["style"], ";") {
+				colonIndex := strings.IndexRune(declaration, ':')
+				if colonIndex > 0 {
+					element.attributes[strings.TrimSpace(declaration[:colonIndex])] = strings.TrimSpace(declaration[colonIndex+1:])
+				}
+			}
+
+			id := element.attributes["id"]
+			if len(id) != 0 {
+				document.idToElement[id] = element
+			}
+
+			if len(stack) == 0 {
+				if element.name != "svg" {
+					return nil, errors.Errorf("root element must be svg, but %s found", element.name)
+				}
+				document.root = element
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, element)
+			}
+			stack = append(stack, element)
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if document.root == nil {
+		return nil, errors.New("svg element not found")
+	}
+
+	err := document.computeViewBox()
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+func (t *svgDocument) computeViewBox() error {
+	viewBox := t.root.get("viewBox")
+	if len(viewBox) != 0 {
+		values, err := parseNumberList(viewBox)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(values) != 4 || values[2] <= 0 || values[3] <= 0 {
+			return errors.Errorf("invalid viewBox %s", viewBox)
+		}
+		copy(t.viewBox[:], values)
+		return nil
+	}
+
+	width := parseLength(t.root.get("width"), 0)
+	height := parseLength(t.root.get("height"), 0)
+	if width <= 0 || height <= 0 {
+		return errors.New("neither viewBox nor width and height are specified")
+	}
+	t.viewBox = [4]float64{0, 0, width, height}
+	return nil
+}
+
+// image is always square, content is centered (preserveAspectRatio="xMidYMid meet")
+func (t *svgDocument) render(size int) (image.Image, error) {
+	viewBoxWidth := t.viewBox[2]
+	viewBoxHeight := t.viewBox[3]
+	scale := math.Min(float64(size)/viewBoxWidth, float64(size)/viewBoxHeight)
+	baseTransform := matrix{
+		scale, 0,
+		0, scale,
+		(float64(size)-viewBoxWidth*scale)/2 - t.viewBox[0]*scale,
+		(float64(size)-viewBoxHeight*scale)/2 - t.viewBox[1]*scale,
+	}
+
+	renderer := &svgRenderer{
+		document:   t,
+		result:     image.NewRGBA(image.Rect(0, 0, size, size)),
+		rasterizer: vector.NewRasterizer(size, size),
+	}
+
+	style := svgStyle{
+		fill:        svgPaint{color: color.NRGBA{A: 0xff}},
+		stroke:      svgPaint{isNone: true},
+		strokeWidth: 1,
+		lineCap:     "butt",
+
+		opacity:       1,
+		fillOpacity:   1,
+		strokeOpacity: 1,
+	}
+
+	err := renderer.renderChildren(t.root, baseTransform, style)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.result, nil
+}
+
+type svgPaint struct {
+	isNone   bool
+	color    color.NRGBA
+	gradient *svgElement
+}
+
+type svgStyle struct {
+	fill        svgPaint
+	stroke      svgPaint
+	strokeWidth float64
+	lineCap     string
+
+	opacity       float64
+	fillOpacity   float64
+	strokeOpacity float64
+}
+
+type svgRenderer struct {
+	document   *svgDocument
+	result     *image.RGBA
+	rasterizer *vector.Rasterizer
+
+	// elements referenced by use elements being rendered, to reject use that references itself or ancestor
+	expandingUses map[*svgElement]bool
+}
+
+func (t *svgRenderer) renderChildren(element *svgElement, transform matrix, style svgStyle) error {
+	for _, child := range element.children {
+		err := t.renderElement(child, transform, style)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *svgRenderer) renderElement(element *svgElement, parentTransform matrix, parentStyle svgStyle) error {
+	if element.get("display") == "none" || element.get("visibility") == "hidden" {
+		return nil
+	}
+
+	transform := parentTransform
+	transformAttribute := element.get("transform")
+	if len(transformAttribute) != 0 {
+		localTransform, err := parseTransform(transformAttribute)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		transform = parentTransform.multiply(localTransform)
+	}
+
+	style := t.computeStyle(element, parentStyle)
+
+	switch element.name {
+	case "svg", "g", "a":
+		return t.renderChildren(element, transform, style)
+
+	case "path", "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		path, err := elementToPath(element)
+		if err != nil {
+			return errors.Wrapf(err, "cannot convert %s element to path", element.name)
+		}
+		if len(path) == 0 {
+			return nil
+		}
+
+		if element.name != "line" {
+			t.fill(path, transform, style)
+		}
+		t.stroke(path, transform, style)
+		return nil
+
+	case "use":
+		href := element.get("href")
+		referenced := t.document.idToElement[strings.TrimPrefix(href, "#")]
+		if referenced == nil {
+			log.WithField("href", href).Debug("SVG use element references unknown element")
+			return nil
+		}
+		if t.expandingUses[referenced] {
+			return errors.Errorf("SVG use element references itself or its ancestor: %s", href)
+		}
+
+		x := parseLength(element.get("x"), 0)
+		y := parseLength(element.get("y"), 0)
+		transform = transform.multiply(matrix{1, 0, 0, 1, x, y})
+
+		if t.expandingUses == nil {
+			t.expandingUses = make(map[*svgElement]bool)
+		}
+		t.expandingUses[referenced] = true
+		defer delete(t.expandingUses, referenced)
+		if referenced.name == "symbol" {
+			return t.renderChildren(referenced, transform, t.computeStyle(referenced, style))
+		}
+		return t.renderElement(referenced, transform, style)
+
+	case "defs", "symbol", "linearGradient", "radialGradient", "stop", "title", "desc", "metadata", "style", "clipPath", "mask", "pattern", "filter":
+		return nil
+
+	default:
+		log.WithField("element", element.name).Debug("unsupported SVG element is ignored")
+		return nil
+	}
+}
+
+func (t *svgRenderer) computeStyle(element *svgElement, parentStyle svgStyle) svgStyle {
+	style := parentStyle
+	// opacity is not inherited, but child element is rendered into the same image, so, parent opacity is applied to each child
+	style.opacity *= parseOpacity(element.get("opacity"), 1)
+	style.fillOpacity = parseOpacity(element.get("fill-opacity"), parentStyle.fillOpacity)
+	style.strokeOpacity = parseOpacity(element.get("stroke-opacity"), parentStyle.strokeOpacity)
+
+	if value := element.get("fill"); len(value) != 0 {
+		style.fill = t.parsePaint(value, element, parentStyle.fill)
+	}
+	if value := element.get("stroke"); len(value) != 0 {
+		style.stroke = t.parsePaint(value, element, parentStyle.stroke)
+	}
+	if value := element.get("stroke-width"); len(value) != 0 {
+		style.strokeWidth = parseLength(value, parentStyle.strokeWidth)
+	}
+	if value := element.get("stroke-linecap"); len(value) != 0 {
+		style.lineCap = value
+	}
+	if value := element.get("fill-rule"); value == "evenodd" {
+		log.Debug("SVG evenodd fill rule is not supported, nonzero is used")
+	}
+	return style
+}
+
+func (t *svgRenderer) parsePaint(value string, element *svgElement, inherited svgPaint) svgPaint {
+	switch {
+	case value == "none" || value == "transparent":
+		return svgPaint{isNone: true}
+	case value == "inherit":
+		return inherited
+	case value == "currentColor":
+		currentColor := element.get("color")
+		if len(currentColor) == 0 {
+			return svgPaint{color: color.NRGBA{A: 0xff}}
+		}
+		return t.parsePaint(currentColor, element, inherited)
+	case strings.HasPrefix(value, "url("):
+		id := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(value, "url("), ")"))
+		id = strings.TrimPrefix(strings.Trim(id, `"'`), "#")
+		gradient := t.document.idToElement[id]
+		if gradient == nil || (gradient.name != "linearGradient" && gradient.name != "radialGradient") {
+			log.WithField("paint", value).Debug("unsupported SVG paint server, black is used")
+			return svgPaint{color: color.NRGBA{A: 0xff}}
+		}
+		return svgPaint{gradient: gradient}
+	}
+
+	result, ok := parseColor(value)
+	if !ok {
+		log.WithField("color", value).Debug("cannot parse SVG color, black is used")
+		return svgPaint{color: color.NRGBA{A: 0xff}}
+	}
+	return svgPaint{color: result}
+}
+
+func (t *svgRenderer) fill(path []pathSegment, transform matrix, style svgStyle) {
+	if style.fill.isNone {
+		return
+	}
+
+	t.rasterizer.Reset(t.result.Bounds().Dx(), t.result.Bounds().Dy())
+	for _, segment := range path {
+		p := segment.points
+		switch segment.command {
+		case 'M':
+			// rasterizer doesn't close previous subpath implicitly
+			t.rasterizer.ClosePath()
+			x, y := transform.apply(p[0], p[1])
+			t.rasterizer.MoveTo(float32(x), float32(y))
+		case 'L':
+			x, y := transform.apply(p[0], p[1])
+			t.rasterizer.LineTo(float32(x), float32(y))
+		case 'C':
+			x1, y1 := transform.apply(p[0], p[1])
+			x2, y2 := transform.apply(p[2], p[3])
+			x, y := transform.apply(p[4], p[5])
+			t.rasterizer.CubeTo(float32(x1), float32(y1), float32(x2), float32(y2), float32(x), float32(y))
+		case 'Z':
+			t.rasterizer.ClosePath()
+		}
+	}
+	t.rasterizer.ClosePath()
+
+	t.draw(style.fill, style.opacity*style.fillOpacity, path, transform)
+}
+
+func (t *svgRenderer) stroke(path []pathSegment, transform matrix, style svgStyle) {
+	if style.stroke.isNone || style.strokeWidth <= 0 {
+		return
+	}
+
+	halfWidth := style.strokeWidth * transform.scale() / 2
+	t.rasterizer.Reset(t.result.Bounds().Dx(), t.result.Bounds().Dy())
+	for _, polyline := range flattenPath(path, transform) {
+		strokePolyline(t.rasterizer, polyline.points, polyline.isClosed, halfWidth, style.lineCap)
+	}
+
+	t.draw(style.stroke, style.opacity*style.strokeOpacity, path, transform)
+}
+
+func (t *svgRenderer) draw(paint svgPaint, opacity float64, path []pathSegment, transform matrix) {
+	var source image.Image
+	if paint.gradient == nil {
+		c := paint.color
+		c.A = uint8(math.Round(float64(c.A) * clampUnit(opacity)))
+		source = image.NewUniform(c)
+	} else {
+		source = t.createGradientImage(paint.gradient, opacity, path, transform)
+		if source == nil {
+			return
+		}
+	}
+	t.rasterizer.Draw(t.result, t.result.Bounds(), source, image.Point{})
+}
+
+type pathSegment struct {
+	// M, L, C or Z (all other commands are converted), points are absolute
+	command byte
+	points  []float64
+}
+
+func elementToPath(element *svgElement) ([]pathSegment, error) {
+	length := func(name string) float64 {
+		return parseLength(element.get(name), 0)
+	}
+
+	switch element.name {
+	case "path":
+		return parsePathData(element.get("d"))
+
+	case "rect":
+		x, y, width, height := length("x"), length("y"), length("width"), length("height")
+		if width <= 0 || height <= 0 {
+			return nil, nil
+		}
+		rx, ry := length("rx"), length("ry")
+		if rx == 0 {
+			rx = ry
+		} else if ry == 0 {
+			ry = rx
+		}
+		return roundedRectPath(x, y, width, height, math.Min(rx, width/2), math.Min(ry, height/2)), nil
+
+	case "circle":
+		r := length("r")
+		if r <= 0 {
+			return nil, nil
+		}
+		return ellipsePath(length("cx"), length("cy"), r, r), nil
+
+	case "ellipse":
+		rx, ry := length("rx"), length("ry")
+		if rx <= 0 || ry <= 0 {
+			return nil, nil
+		}
+		return ellipsePath(length("cx"), length("cy"), rx, ry), nil
+
+	case "line":
+		return []pathSegment{
+			{'M', []float64{length("x1"), length("y1")}},
+			{'L', []float64{length("x2"), length("y2")}},
+		}, nil
+
+	case "polyline", "polygon":
+		values, err := parseNumberList(element.get("points"))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		var result []pathSegment
+		for i := 0; i+1 < len(values); i += 2 {
+			command := byte('L')
+			if i == 0 {
+				command = 'M'
+			}
+			result = append(result, pathSegment{command, []float64{values[i], values[i+1]}})
+		}
+		if element.name == "polygon" && len(result) != 0 {
+			result = append(result, pathSegment{command: 'Z'})
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+func ellipsePath(cx float64, cy float64, rx float64, ry float64) []pathSegment {
+	kx := rx * bezierCircleKappa
+	ky := ry * bezierCircleKappa
+	return []pathSegment{
+		{'M', []float64{cx + rx, cy}},
+		{'C', []float64{cx + rx, cy + ky, cx + kx, cy + ry, cx, cy + ry}},
+		{'C', []float64{cx - kx, cy + ry, cx - rx, cy + ky, cx - rx, cy}},
+		{'C', []float64{cx - rx, cy - ky, cx - kx, cy - ry, cx, cy - ry}},
+		{'C', []float64{cx + kx, cy - ry, cx + rx, cy - ky, cx + rx, cy}},
+		{command: 'Z'},
+	}
+}
+
+func roundedRectPath(x float64, y float64, width float64, height float64, rx float64, ry float64) []pathSegment {
+	right := x + width
+	bottom := y + height
+	if rx <= 0 || ry <= 0 {
+		return []pathSegment{
+			{'M', []float64{x, y}},
+			{'L', []float64{right, y}},
+			{'L', []float64{right, bottom}},
+			{'L', []float64{x, bottom}},
+			{command: 'Z'},
+		}
+	}
+
+	kx := rx * (1 - bezierCircleKappa)
+	ky := ry * (1 - bezierCircleKappa)
+	return []pathSegment{
+		{'M', []float64{x + rx, y}},
+		{'L', []float64{right - rx, y}},
+		{'C', []float64{right - kx, y, right, y + ky, right, y + ry}},
+		{'L', []float64{right, bottom - ry}},
+		{'C', []float64{right, bottom - ky, right - kx, bottom, right - rx, bottom}},
+		{'L', []float64{x + rx, bottom}},
+		{'C', []float64{x + kx, bottom, x, bottom - ky, x, bottom - ry}},
+		{'L', []float64{x, y + ry}},
+		{'C', []float64{x, y + ky, x + kx, y, x + rx, y}},
+		{command: 'Z'},
+	}
+}
+
+// path data
+
+type pathDataScanner struct {
+	data  string
+	index int
+}
+
+func (t *pathDataScanner) skipSeparators() {
+	for t.index < len(t.data) {
+		c := t.data[t.index]
+		if c != ' ' && c != ',' && c != '\t' && c != '\n' && c != '\r' {
+			return
+		}
+		t.index++
+	}
+}
+
+func (t *pathDataScanner) hasNumber() bool {
+	t.skipSeparators()
+	if t.index >= len(t.data) {
+		return false
+	}
+	c := t.data[t.index]
+	return c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9')
+}
+
+func (t *pathDataScanner) readNumber() (float64, error) {
+	t.skipSeparators()
+	start := t.index
+	if t.index < len(t.data) && (t.data[t.index] == '-' || t.data[t.index] == '+') {
+		t.index++
+	}
+
+	hasDot := false
+	for t.index < len(t.data) {
+		c := t.data[t.index]
+		if c >= '0' && c <= '9' {
+			t.index++
+		} else if c == '.' && !hasDot {
+			hasDot = true
+			t.index++
+		} else if (c == 'e' || c == 'E') && t.index > start {
+			t.index++
+			if t.index < len(t.data) && (t.data[t.index] == '-' || t.data[t.index] == '+') {
+				t.index++
+			}
+		} else {
+			break
+		}
+	}
+
+	result, err := strconv.ParseFloat(t.data[start:t.index], 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid number at %d in path data", start)
+	}
+	return result, nil
+}
+
+// arc flags can be specified without separators ("a1 1 0 00 1 1")
+func (t *pathDataScanner) readFlag() (bool, error) {
+	t.skipSeparators()
+	if t.index < len(t.data) {
+		c := t.data[t.index]
+		if c == '0' || c == '1' {
+			t.index++
+			return c == '1', nil
+		}
+	}
+	return false, errors.Errorf("invalid flag at %d in path data", t.index)
+}
+
+func (t *pathDataScanner) readNumbers(count int) ([]float64, error) {
+	result := make([]float64, count)
+	for i := range result {
+		var err error
+		result[i], err = t.readNumber()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func parsePathData(data string) ([]pathSegment, error) {
+	scanner := &pathDataScanner{data: data}
+
+	var result []pathSegment
+	var x, y, startX, startY float64
+	// reflected control point for S and T
+	var lastControlX, lastControlY float64
+	var lastCommand byte
+
+	for {
+		scanner.skipSeparators()
+		if scanner.index >= len(data) {
+			break
+		}
+
+		command := data[scanner.index]
+		if scanner.hasNumber() {
+			// implicit command repetition
+			if lastCommand == 0 {
+				return nil, errors.New("path data must start with moveto command")
+			}
+			command = lastCommand
+			if command == 'M' {
+				command = 'L'
+			} else if command == 'm' {
+				command = 'l'
+			}
+		} else {
+			scanner.index++
+		}
+
+		isRelative := command >= 'a' && command <= 'z'
+		var dx, dy float64
+		if isRelative {
+			dx, dy = x, y
+		}
+
+		upperCommand := command
+		if isRelative {
+			upperCommand -= 'a' - 'A'
+		}
+
+		switch upperCommand {
+		case 'M', 'L':
+			p, err := scanner.readNumbers(2)
+			if err != nil {
+				return nil, err
+			}
+			x, y = p[0]+dx, p[1]+dy
+			result = append(result, pathSegment{upperCommand, []float64{x, y}})
+			if upperCommand == 'M' {
+				startX, startY = x, y
+			}
+
+		case 'H':
+			p, err := scanner.readNumbers(1)
+			if err != nil {
+				return nil, err
+			}
+			x = p[0] + dx
+			result = append(result, pathSegment{'L', []float64{x, y}})
+
+		case 'V':
+			p, err := scanner.readNumbers(1)
+			if err != nil {
+				return nil, err
+			}
+			y = p[0] + dy
+			result = append(result, pathSegment{'L', []float64{x, y}})
+
+		case 'C', 'S':
+			var x1, y1 float64
+			var rest []float64
+			var err error
+			if upperCommand == 'C' {
+				var p []float64
+				p, err = scanner.readNumbers(6)
+				if err != nil {
+					return nil, err
+				}
+				x1, y1 = p[0]+dx, p[1]+dy
+				rest = p[2:]
+			} else {
+				rest, err = scanner.readNumbers(4)
+				if err != nil {
+					return nil, err
+				}
+				x1, y1 = x, y
+				if lastCommand == 'C' || lastCommand == 'c' || lastCommand == 'S' || lastCommand == 's' {
+					x1, y1 = 2*x-lastControlX, 2*y-lastControlY
+				}
+			}
+			x2, y2 := rest[0]+dx, rest[1]+dy
+			x, y = rest[2]+dx, rest[3]+dy
+			result = append(result, pathSegment{'C', []float64{x1, y1, x2, y2, x, y}})
+			lastControlX, lastControlY = x2, y2
+
+		case 'Q', 'T':
+			var qx, qy float64
+			if upperCommand == 'Q' {
+				p, err := scanner.readNumbers(4)
+				if err != nil {
+					return nil, err
+				}
+				qx, qy = p[0]+dx, p[1]+dy
+				x, y = appendQuad(&result, x, y, qx, qy, p[2]+dx, p[3]+dy)
+			} else {
+				p, err := scanner.readNumbers(2)
+				if err != nil {
+					return nil, err
+				}
+				qx, qy = x, y
+				if lastCommand == 'Q' || lastCommand == 'q' || lastCommand == 'T' || lastCommand == 't' {
+					qx, qy = 2*x-lastControlX, 2*y-lastControlY
+				}
+				x, y = appendQuad(&result, x, y, qx, qy, p[0]+dx, p[1]+dy)
+			}
+			lastControlX, lastControlY = qx, qy
+
+		case 'A':
+			p, err := scanner.readNumbers(3)
+			if err != nil {
+				return nil, err
+			}
+			isLargeArc, err := scanner.readFlag()
+			if err != nil {
+				return nil, err
+			}
+			isSweep, err := scanner.readFlag()
+			if err != nil {
+				return nil, err
+			}
+			end, err := scanner.readNumbers(2)
+			if err != nil {
+				return nil, err
+			}
+			endX, endY := end[0]+dx, end[1]+dy
+			result = appendArc(result, x, y, p[0], p[1], p[2], isLargeArc, isSweep, endX, endY)
+			x, y = endX, endY
+
+		case 'Z':
+			result = append(result, pathSegment{command: 'Z'})
+			x, y = startX, startY
+
+		default:
+			return nil, errors.Errorf("unknown path command %c", command)
+		}
+
+		lastCommand = command
+	}
+	return result, nil
+}
+
+func appendQuad(result *[]pathSegment, x0 float64, y0 float64, qx float64, qy float64, x float64, y float64) (float64, float64) {
+	// degree elevation
+	*result = append(*result, pathSegment{'C', []float64{
+		x0 + 2.0/3.0*(qx-x0), y0 + 2.0/3.0*(qy-y0),
+		x + 2.0/3.0*(qx-x), y + 2.0/3.0*(qy-y),
+		x, y,
+	}})
+	return x, y
+}
+
+// https://www.w3.org/TR/SVG11/implnote.html#ArcImplementationNotes
+func appendArc(result []pathSegment, x1 float64, y1 float64, rx float64, ry float64, angle float64, isLargeArc bool, isSweep bool, x2 float64, y2 float64) []pathSegment {
+	if x1 == x2 && y1 == y2 {
+		return result
+	}
+
+	rx = math.Abs(rx)
+	ry = math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		return append(result, pathSegment{'L', []float64{x2, y2}})
+	}
+
+	phi := angle * math.Pi / 180
+	sinPhi, cosPhi := math.Sincos(phi)
+
+	x1p := cosPhi*(x1-x2)/2 + sinPhi*(y1-y2)/2
+	y1p := -sinPhi*(x1-x2)/2 + cosPhi*(y1-y2)/2
+
+	lambda := (x1p*x1p)/(rx*rx) + (y1p*y1p)/(ry*ry)
+	if lambda > 1 {
+		lambdaSqrt := math.Sqrt(lambda)
+		rx *= lambdaSqrt
+		ry *= lambdaSqrt
+	}
+
+	numerator := rx*rx*ry*ry - rx*rx*y1p*y1p - ry*ry*x1p*x1p
+	denominator := rx*rx*y1p*y1p + ry*ry*x1p*x1p
+	coefficient := 0.0
+	if numerator > 0 && denominator > 0 {
+		coefficient = math.Sqrt(numerator / denominator)
+	}
+	if isLargeArc == isSweep {
+		coefficient = -coefficient
+	}
+
+	cxp := coefficient * rx * y1p / ry
+	cyp := -coefficient * ry * x1p / rx
+	cx := cosPhi*cxp - sinPhi*cyp + (x1+x2)/2
+	cy := sinPhi*cxp + cosPhi*cyp + (y1+y2)/2
+
+	vectorAngle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+
+	theta1 := vectorAngle(1, 0, (x1p-cxp)/rx, (y1p-cyp)/ry)
+	deltaTheta := vectorAngle((x1p-cxp)/rx, (y1p-cyp)/ry, (-x1p-cxp)/rx, (-y1p-cyp)/ry)
+	if !isSweep && deltaTheta > 0 {
+		deltaTheta -= 2 * math.Pi
+	} else if isSweep && deltaTheta < 0 {
+		deltaTheta += 2 * math.Pi
+	}
+
+	// each segment is not more than 90 degrees
+	segmentCount := int(math.Ceil(math.Abs(deltaTheta) / (math.Pi / 2)))
+	segmentAngle := deltaTheta / float64(segmentCount)
+	k := 4.0 / 3.0 * math.Tan(segmentAngle/4)
+
+	point := func(theta float64) (float64, float64, float64, float64) {
+		sinTheta, cosTheta := math.Sincos(theta)
+		x := cx + rx*cosTheta*cosPhi - ry*sinTheta*sinPhi
+		y := cy + rx*cosTheta*sinPhi + ry*sinTheta*cosPhi
+		// derivative
+		dx := -rx*sinTheta*cosPhi - ry*cosTheta*sinPhi
+		dy := -rx*sinTheta*sinPhi + ry*cosTheta*cosPhi
+		return x, y, dx, dy
+	}
+
+	theta := theta1
+	startX, startY, startDx, startDy := point(theta)
+	for i := 0; i < segmentCount; i++ {
+		theta += segmentAngle
+		endX, endY, endDx, endDy := point(theta)
+		if i == segmentCount-1 {
+			// avoid accumulated error
+			endX, endY = x2, y2
+		}
+		result = append(result, pathSegment{'C', []float64{
+			startX + k*startDx, startY + k*startDy,
+			endX - k*endDx, endY - k*endDy,
+			endX, endY,
+		}})
+		startX, startY, startDx, startDy = endX, endY, endDx, endDy
+	}
+	return result
+}
+
+// stroke
+
+type polyline struct {
+	points   []float64
+	isClosed bool
+}
+
+// flattened in device space
+func flattenPath(path []pathSegment, transform matrix) []polyline {
+	var result []polyline
+	var current *polyline
+	var x, y float64
+	for _, segment := range path {
+		p := segment.points
+		switch segment.command {
+		case 'M':
+			x, y = transform.apply(p[0], p[1])
+			result = append(result, polyline{points: []float64{x, y}})
+			current = &result[len(result)-1]
+
+		case 'L':
+			if current == nil {
+				continue
+			}
+			x, y = transform.apply(p[0], p[1])
+			current.points = append(current.points, x, y)
+
+		case 'C':
+			if current == nil {
+				continue
+			}
+			x1, y1 := transform.apply(p[0], p[1])
+			x2, y2 := transform.apply(p[2], p[3])
+			x3, y3 := transform.apply(p[4], p[5])
+			length := math.Hypot(x1-x, y1-y) + math.Hypot(x2-x1, y2-y1) + math.Hypot(x3-x2, y3-y2)
+			steps := int(math.Ceil(length / 2))
+			if steps < 4 {
+				steps = 4
+			}
+			for i := 1; i <= steps; i++ {
+				t := float64(i) / float64(steps)
+				mt := 1 - t
+				a := mt * mt * mt
+				b := 3 * mt * mt * t
+				c := 3 * mt * t * t
+				d := t * t * t
+				current.points = append(current.points, a*x+b*x1+c*x2+d*x3, a*y+b*y1+c*y2+d*y3)
+			}
+			x, y = x3, y3
+
+		case 'Z':
+			if current == nil {
+				continue
+			}
+			current.isClosed = true
+			x, y = current.points[0], current.points[1]
+			// new subpath can follow without moveto
+			result = append(result, polyline{points: []float64{x, y}})
+			current = &result[len(result)-1]
+		}
+	}
+	return result
+}
+
+// Stroke is rendered as union of segment quads and round joins. All shapes have the same orientation, so, rasterizer accumulates coverage (and doesn't cancel it).
+func strokePolyline(rasterizer *vector.Rasterizer, points []float64, isClosed bool, halfWidth float64, lineCap string) {
+	pointCount := len(points) / 2
+	if pointCount < 2 {
+		return
+	}
+
+	for i := 0; i < pointCount-1; i++ {
+		x0, y0 := points[i*2], points[i*2+1]
+		x1, y1 := points[i*2+2], points[i*2+3]
+		length := math.Hypot(x1-x0, y1-y0)
+		if length == 0 {
+			continue
+		}
+
+		// normal
+		nx := -(y1 - y0) / length * halfWidth
+		ny := (x1 - x0) / length * halfWidth
+
+		if !isClosed && lineCap == "square" {
+			tx := (x1 - x0) / length * halfWidth
+			ty := (y1 - y0) / length * halfWidth
+			if i == 0 {
+				x0 -= tx
+				y0 -= ty
+			}
+			if i == pointCount-2 {
+				x1 += tx
+				y1 += ty
+			}
+		}
+
+		addQuad(rasterizer, x0+nx, y0+ny, x1+nx, y1+ny, x1-nx, y1-ny, x0-nx, y0-ny)
+	}
+
+	for i := 0; i < pointCount; i++ {
+		isEnd := i == 0 || i == pointCount-1
+		if !isEnd || isClosed || lineCap == "round" {
+			addCircle(rasterizer, points[i*2], points[i*2+1], halfWidth)
+		}
+	}
+}
+
+func addQuad(rasterizer *vector.Rasterizer, x0, y0, x1, y1, x2, y2, x3, y3 float64) {
+	// shoelace formula to detect orientation
+	area := (x1-x0)*(y2-y0) - (x2-x0)*(y1-y0)
+	if area < 0 {
+		x1, y1, x3, y3 = x3, y3, x1, y1
+	}
+
+	rasterizer.MoveTo(float32(x0), float32(y0))
+	rasterizer.LineTo(float32(x1), float32(y1))
+	rasterizer.LineTo(float32(x2), float32(y2))
+	rasterizer.LineTo(float32(x3), float32(y3))
+	rasterizer.ClosePath()
+}
+
+func addCircle(rasterizer *vector.Rasterizer, cx float64, cy float64, r float64) {
+	path := ellipsePath(cx, cy, r, r)
+	for _, segment := range path {
+		p := segment.points
+		switch segment.command {
+		case 'M':
+			rasterizer.MoveTo(float32(p[0]), float32(p[1]))
+		case 'C':
+			rasterizer.CubeTo(float32(p[0]), float32(p[1]), float32(p[2]), float32(p[3]), float32(p[4]), float32(p[5]))
+		case 'Z':
+			rasterizer.ClosePath()
+		}
+	}
+}
+
+// gradients
+
+type gradientStop struct {
+	offset float64
+	color  color.NRGBA
+}
+
+type gradientImage struct {
+	isRadial bool
+	// from device space to gradient space
+	inverse matrix
+	// x1, y1, x2, y2 for linear and cx, cy, r, fx, fy for radial
+	geometry [5]float64
+	stops    []gradientStop
+	spread   string
+	opacity  float64
+}
+
+func (t *gradientImage) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+func (t *gradientImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (t *gradientImage) At(px int, py int) color.Color {
+	x, y := t.inverse.apply(float64(px)+0.5, float64(py)+0.5)
+	g := t.geometry
+
+	var offset float64
+	if t.isRadial {
+		// focal point is not supported, center is used
+		offset = math.Hypot(x-g[0], y-g[1]) / g[2]
+	} else {
+		dx := g[2] - g[0]
+		dy := g[3] - g[1]
+		offset = ((x-g[0])*dx + (y-g[1])*dy) / (dx*dx + dy*dy)
+	}
+
+	switch t.spread {
+	case "repeat":
+		offset -= math.Floor(offset)
+	case "reflect":
+		offset = math.Mod(math.Abs(offset), 2)
+		if offset > 1 {
+			offset = 2 - offset
+		}
+	}
+
+	c := interpolateStops(t.stops, offset)
+	c.A = uint8(math.Round(float64(c.A) * t.opacity))
+	return c
+}
+
+func interpolateStops(stops []gradientStop, offset float64) color.NRGBA {
+	if offset <= stops[0].offset {
+		return stops[0].color
+	}
+	last := stops[len(stops)-1]
+	if offset >= last.offset {
+		return last.color
+	}
+
+	for i := 1; i < len(stops); i++ {
+		to := stops[i]
+		if offset > to.offset {
+			continue
+		}
+
+		from := stops[i-1]
+		if to.offset == from.offset {
+			return to.color
+		}
+
+		ratio := (offset - from.offset) / (to.offset - from.offset)
+		mix := func(a uint8, b uint8) uint8 {
+			return uint8(math.Round(float64(a) + (float64(b)-float64(a))*ratio))
+		}
+		return color.NRGBA{
+			R: mix(from.color.R, to.color.R),
+			G: mix(from.color.G, to.color.G),
+			B: mix(from.color.B, to.color.B),
+			A: mix(from.color.A, to.color.A),
+		}
+	}
+	return last.color
+}
+
+func (t *svgRenderer) createGradientImage(gradient *svgElement, opacity float64, path []pathSegment, transform matrix) image.Image {
+	// attributes and stops can be inherited using href
+	attribute := func(name string) string {
+		for element, guard := gradient, 0; element != nil && guard < 16; guard++ {
+			value := element.get(name)
+			if len(value) != 0 {
+				return value
+			}
+			element = t.document.idToElement[strings.TrimPrefix(element.get("href"), "#")]
+		}
+		return ""
+	}
+
+	var stops []gradientStop
+	for element, guard := gradient, 0; element != nil && guard < 16 && len(stops) == 0; guard++ {
+		for _, child := range element.children {
+			if child.name != "stop" {
+				continue
+			}
+
+			stopColor, ok := parseColor(child.get("stop-color"))
+			if !ok {
+				stopColor = color.NRGBA{A: 0xff}
+			}
+			stopColor.A = uint8(math.Round(float64(stopColor.A) * parseOpacity(child.get("stop-opacity"), 1)))
+
+			offset := clampUnit(parseLength(child.get("offset"), 0))
+			// offset must be not less than previous
+			if len(stops) != 0 && offset < stops[len(stops)-1].offset {
+				offset = stops[len(stops)-1].offset
+			}
+			stops = append(stops, gradientStop{offset, stopColor})
+		}
+		element = t.document.idToElement[strings.TrimPrefix(element.get("href"), "#")]
+	}
+
+	if len(stops) == 0 {
+		return nil
+	}
+	if len(stops) == 1 {
+		c := stops[0].color
+		c.A = uint8(math.Round(float64(c.A) * clampUnit(opacity)))
+		return image.NewUniform(c)
+	}
+
+	result := &gradientImage{
+		isRadial: gradient.name == "radialGradient",
+		stops:    stops,
+		spread:   attribute("spreadMethod"),
+		opacity:  clampUnit(opacity),
+	}
+
+	gradientTransform := matrix{1, 0, 0, 1, 0, 0}
+	if value := attribute("gradientTransform"); len(value) != 0 {
+		var err error
+		gradientTransform, err = parseTransform(value)
+		if err != nil {
+			log.WithError(err).Debug("cannot parse gradientTransform")
+		}
+	}
+
+	isUserSpace := attribute("gradientUnits") == "userSpaceOnUse"
+	reference := 1.0
+	if isUserSpace {
+		reference = math.Max(t.document.viewBox[2], t.document.viewBox[3])
+	}
+	length := func(name string, defaultValue float64) float64 {
+		return parseLengthRelative(attribute(name), defaultValue, reference)
+	}
+
+	if result.isRadial {
+		cx := length("cx", 0.5*reference)
+		cy := length("cy", 0.5*reference)
+		result.geometry = [5]float64{cx, cy, length("r", 0.5*reference)}
+		if result.geometry[2] <= 0 {
+			return image.NewUniform(stops[len(stops)-1].color)
+		}
+	} else {
+		result.geometry = [5]float64{length("x1", 0), length("y1", 0), length("x2", reference), length("y2", 0)}
+		if result.geometry[0] == result.geometry[2] && result.geometry[1] == result.geometry[3] {
+			return image.NewUniform(stops[len(stops)-1].color)
+		}
+	}
+
+	gradientToUser := gradientTransform
+	if !isUserSpace {
+		minX, minY, maxX, maxY := pathBounds(path)
+		if maxX <= minX || maxY <= minY {
+			return nil
+		}
+		gradientToUser = matrix{maxX - minX, 0, 0, maxY - minY, minX, minY}.multiply(gradientTransform)
+	}
+
+	inverse, ok := transform.multiply(gradientToUser).invert()
+	if !ok {
+		return nil
+	}
+	result.inverse = inverse
+	return result
+}
+
+func pathBounds(path []pathSegment) (float64, float64, float64, float64) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, segment := range path {
+		for i := 0; i+1 < len(segment.points); i += 2 {
+			minX = math.Min(minX, segment.points[i])
+			maxX = math.Max(maxX, segment.points[i])
+			minY = math.Min(minY, segment.points[i+1])
+			maxY = math.Max(maxY, segment.points[i+1])
+		}
+	}
+	return minX, minY, maxX, maxY
+}
+
+// transform
+
+// a b c d e f as in SVG matrix(a, b, c, d, e, f)
+type matrix [6]float64
+
+func (m matrix) multiply(o matrix) matrix {
+	return matrix{
+		m[0]*o[0] + m[2]*o[1],
+		m[1]*o[0] + m[3]*o[1],
+		m[0]*o[2] + m[2]*o[3],
+		m[1]*o[2] + m[3]*o[3],
+		m[0]*o[4] + m[2]*o[5] + m[4],
+		m[1]*o[4] + m[3]*o[5] + m[5],
+	}
+}
+
+func (m matrix) apply(x float64, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+func (m matrix) invert() (matrix, bool) {
+	determinant := m[0]*m[3] - m[1]*m[2]
+	if determinant == 0 {
+		return matrix{}, false
+	}
+	return matrix{
+		m[3] / determinant,
+		-m[1] / determinant,
+		-m[2] / determinant,
+		m[0] / determinant,
+		(m[2]*m[5] - m[3]*m[4]) / determinant,
+		(m[1]*m[4] - m[0]*m[5]) / determinant,
+	}, true
+}
+
+func parseTransform(value string) (matrix, error) {
+	result := matrix{1, 0, 0, 1, 0, 0}
+	rest := strings.TrimSpace(value)
+	for len(rest) != 0 {
+		openIndex := strings.IndexRune(rest, '(')
+		closeIndex := strings.IndexRune(rest, ')')
+		if openIndex <= 0 || closeIndex < openIndex {
+			return result, errors.Errorf("invalid transform %s", value)
+		}
+
+		name := strings.TrimSpace(rest[:openIndex])
+		args, err := parseNumberList(rest[openIndex+1 : closeIndex])
+		if err != nil {
+			return result, err
+		}
+		rest = strings.TrimLeft(rest[closeIndex+1:], " ,\t\n\r")
+
+		arg := func(index int, defaultValue float64) float64 {
+			if index < len(args) {
+				return args[index]
+			}
+			return defaultValue
+		}
+
+		var m matrix
+		switch name {
+		case "matrix":
+			if len(args) != 6 {
+				return result, errors.Errorf("invalid transform %s", value)
+			}
+			copy(m[:], args)
+		case "translate":
+			m = matrix{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			m = matrix{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			sin, cos := math.Sincos(arg(0, 0) * math.Pi / 180)
+			cx, cy := arg(1, 0), arg(2, 0)
+			m = matrix{1, 0, 0, 1, cx, cy}.multiply(matrix{cos, sin, -sin, cos, 0, 0}).multiply(matrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			m = matrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			m = matrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return result, errors.Errorf("unknown transform %s", name)
+		}
+		result = result.multiply(m)
+	}
+	return result, nil
+}
+
+// values
+
+func parseNumberList(value string) ([]float64, error) {
+	scanner := &pathDataScanner{data: value}
+	var result []float64
+	for scanner.hasNumber() {
+		number, err := scanner.readNumber()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, number)
+	}
+	return result, nil
+}
+
+// units are ignored except percent (relative to 1)
+func parseLength(value string, defaultValue float64) float64 {
+	return parseLengthRelative(value, defaultValue, 1)
+}
+
+func parseLengthRelative(value string, defaultValue float64, reference float64) float64 {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return defaultValue
+	}
+
+	isPercent := strings.HasSuffix(value, "%")
+	value = strings.TrimRight(value, "%abcdefghijklmnopqrstuvwxyz")
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return defaultValue
+	}
+	if isPercent {
+		return result / 100 * reference
+	}
+	return result
+}
+
+func parseOpacity(value string, defaultValue float64) float64 {
+	return clampUnit(parseLength(value, defaultValue))
+}
+
+func clampUnit(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+func parseColor(value string) (color.NRGBA, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasPrefix(value, "#") {
+		hex := value[1:]
+		if len(hex) == 3 || len(hex) == 4 {
+			expanded := make([]byte, 0, len(hex)*2)
+			for i := 0; i < len(hex); i++ {
+				expanded = append(expanded, hex[i], hex[i])
+			}
+			hex = string(expanded)
+		}
+		if len(hex) != 6 && len(hex) != 8 {
+			return color.NRGBA{}, false
+		}
+
+		number, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil {
+			return color.NRGBA{}, false
+		}
+		if len(hex) == 6 {
+			return color.NRGBA{R: uint8(number >> 16), G: uint8(number >> 8), B: uint8(number), A: 0xff}, true
+		}
+		return color.NRGBA{R: uint8(number >> 24), G: uint8(number >> 16), B: uint8(number >> 8), A: uint8(number)}, true
+	}
+
+	if strings.HasPrefix(value, "rgb") {
+		openIndex := strings.IndexRune(value, '(')
+		closeIndex := strings.IndexRune(value, ')')
+		if openIndex < 0 || closeIndex < openIndex {
+			return color.NRGBA{}, false
+		}
+
+		components := strings.FieldsFunc(value[openIndex+1:closeIndex], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '/'
+		})
+		if len(components) < 3 {
+			return color.NRGBA{}, false
+		}
+
+		channel := func(component string) uint8 {
+			if strings.HasSuffix(component, "%") {
+				return uint8(math.Round(clampUnit(parseLength(component, 0)) * 255))
+			}
+			return uint8(math.Round(math.Max(0, math.Min(255, parseLength(component, 0)))))
+		}
+
+		result := color.NRGBA{R: channel(components[0]), G: channel(components[1]), B: channel(components[2]), A: 0xff}
+		if len(components) > 3 {
+			result.A = uint8(math.Round(parseOpacity(components[3], 1) * 255))
+		}
+		return result, true
+	}
+
+	named, ok := colornames.Map[value]
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{R: named.R, G: named.G, B: named.B, A: named.A}, true
+}
@@ -0,0 +1,117 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+
+	"github.com/develar/errors"
+)
+
+// https://developer.apple.com/design/human-interface-guidelines/the-menu-bar (16pt glyph, 22pt menu bar height)
+const defaultTemplatePointSize = 16
+const defaultTemplateThreshold = 128
+
+// zero value is the default: 16pt, luminance mapping
+type TemplateOptions struct {
+	// luminance (dark pixels are opaque, light pixels are transparent), threshold (the same, but without partial transparency)
+	// or alpha (silhouette of source, colors are ignored)
+	Mode string `json:"mode,omitempty"`
+	// luminance (0-255) below which pixel is opaque, for threshold mode only, 128 by default
+	Threshold int `json:"threshold,omitempty"`
+	// point size, @2x image is twice as large, 16 by default
+	Size int `json:"size,omitempty"`
+}
+
+func (t *TemplateOptions) validate() error {
+	switch t.Mode {
+	case "", "luminance", "threshold", "alpha":
+	default:
+		return errors.Errorf("unknown template mode %q", t.Mode)
+	}
+	if t.Threshold < 0 || t.Threshold > 255 {
+		return errors.Errorf("template threshold must be in range 0-255, got %d", t.Threshold)
+	}
+	if t.Size < 0 {
+		return errors.Errorf("template size must be positive, got %d", t.Size)
+	}
+	return nil
+}
+
+func (t *TemplateOptions) getSize() int {
+	if t.Size > 0 {
+		return t.Size
+	}
+	return defaultTemplatePointSize
+}
+
+func (t *TemplateOptions) getThreshold() uint8 {
+	if t.Threshold > 0 {
+		return uint8(t.Threshold)
+	}
+	return defaultTemplateThreshold
+}
+
+// macOS requires "Template" suffix to treat image as template (tinted according to menu bar appearance)
+func getTemplateFileNames(iconName string) (string, string) {
+	if len(iconName) == 0 {
+		iconName = "icon"
+	}
+	return iconName + "Template.png", iconName + "Template@2x.png"
+}
+
+// black image with alpha derived from the source, mapping is applied before resize to keep edges anti-aliased in the threshold mode
+func convertToTemplate(inputInfo *InputFileInfo, sourceFile string, outDir string, configuration *IconConvertRequest) ([]IconInfo, error) {
+	err := configureInputInfoFromSingleFile(sourceFile, false, inputInfo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	options := &configuration.TemplateOptions
+	templateImage := toTemplateImage(inputInfo.maxImage, options)
+
+	size := options.getSize()
+	fileName, retinaFileName := getTemplateFileNames(configuration.IconName)
+	result := []IconInfo{
+		{File: filepath.Join(outDir, fileName), Size: size},
+		{File: filepath.Join(outDir, retinaFileName), Size: size * 2},
+	}
+	for _, icon := range result {
+		var outImage image.Image = templateImage
+		if icon.Size != inputInfo.MaxIconSize {
+			outImage = inputInfo.resizeOptions.resize(templateImage, icon.Size)
+		}
+		err = SaveImage(outImage, icon.File, PNG)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return result, nil
+}
+
+func toTemplateImage(source image.Image, options *TemplateOptions) *image.NRGBA {
+	bounds := source.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	threshold := options.getThreshold()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(source.At(x, y)).(color.NRGBA)
+			alpha := pixel.A
+			if alpha != 0 {
+				// ITU-R BT.601 luma
+				luminance := uint8((299*uint32(pixel.R) + 587*uint32(pixel.G) + 114*uint32(pixel.B)) / 1000)
+				switch options.Mode {
+				case "threshold":
+					if luminance >= threshold {
+						alpha = 0
+					}
+				case "alpha":
+				default:
+					alpha = uint8(uint32(alpha) * uint32(255-luminance) / 255)
+				}
+			}
+			result.SetNRGBA(x-bounds.Min.X, y-bounds.Min.Y, color.NRGBA{A: alpha})
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package icons
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestToTemplateImage(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	source := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	source.SetNRGBA(0, 0, color.NRGBA{A: 255})
+	source.SetNRGBA(1, 0, color.NRGBA{R: 255, G: 255, B: 255, A: 255})
+	source.SetNRGBA(2, 0, color.NRGBA{R: 100, G: 100, B: 100, A: 128})
+	source.SetNRGBA(3, 0, color.NRGBA{R: 255, A: 0})
+
+	alphaOf := func(img *image.NRGBA) []uint8 {
+		var result []uint8
+		for x := 0; x < 4; x++ {
+			pixel := img.NRGBAAt(x, 0)
+			g.Expect(pixel.R | pixel.G | pixel.B).To(BeZero())
+			result = append(result, pixel.A)
+		}
+		return result
+	}
+
+	g.Expect(alphaOf(toTemplateImage(source, &TemplateOptions{}))).To(Equal([]uint8{255, 0, 77, 0}))
+	g.Expect(alphaOf(toTemplateImage(source, &TemplateOptions{Mode: "threshold"}))).To(Equal([]uint8{255, 0, 128, 0}))
+	g.Expect(alphaOf(toTemplateImage(source, &TemplateOptions{Mode: "threshold", Threshold: 50}))).To(Equal([]uint8{255, 0, 0, 0}))
+	g.Expect(alphaOf(toTemplateImage(source, &TemplateOptions{Mode: "alpha"}))).To(Equal([]uint8{255, 255, 128, 0}))
+
+	g.Expect((&TemplateOptions{Mode: "invert"}).validate()).To(HaveOccurred())
+	g.Expect((&TemplateOptions{Threshold: 256}).validate()).To(HaveOccurred())
+}
+
+func TestConvertToTemplate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-template")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	source := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 16; y < 48; y++ {
+		for x := 16; x < 48; x++ {
+			source.SetNRGBA(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	g.Expect(SaveImage(source, filepath.Join(tmpDir, "tray.png"), PNG)).To(Succeed())
+
+	outDir := filepath.Join(tmpDir, "out")
+	result, err := ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "tray.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "template",
+		OutputDir:       outDir,
+		IconName:        "tray",
+		TemplateOptions: TemplateOptions{Mode: "alpha"},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(withoutIconMetadata(result.Icons)).To(Equal([]IconInfo{
+		{File: filepath.Join(outDir, "trayTemplate.png"), Size: 16},
+		{File: filepath.Join(outDir, "trayTemplate@2x.png"), Size: 32},
+	}))
+
+	for _, icon := range result.Icons {
+		img, err := LoadImage(icon.File)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(img.Bounds().Dx()).To(Equal(icon.Size))
+
+		center := color.NRGBAModel.Convert(img.At(icon.Size/2, icon.Size/2)).(color.NRGBA)
+		g.Expect(center).To(Equal(color.NRGBA{A: 255}))
+		corner := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+		g.Expect(corner.A).To(BeZero())
+	}
+
+	// source smaller than @2x size
+	_, err = ConvertIcon(context.Background(), &IconConvertRequest{
+		Sources:         &[]string{filepath.Join(tmpDir, "tray.png")},
+		FallbackSources: &[]string{},
+		OutputFormat:    "template",
+		OutputDir:       outDir,
+		TemplateOptions: TemplateOptions{Size: 64},
+	})
+	g.Expect(toUserError(err)).To(BeAssignableToTypeOf(&ImageSizeError{}))
+}
@@ -0,0 +1,59 @@
+package icons
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+func validatePadding(padding float64) error {
+	if padding < 0 || padding >= 50 {
+		return errors.Errorf("padding must be in range 0-50 (percent of icon size on each side), got %v", padding)
+	}
+	return nil
+}
+
+// crops fully transparent borders, result is centered on square canvas (content must not be distorted by resize),
+// fully transparent image is returned as is
+func trimTransparentBorders(img image.Image) image.Image {
+	bounds := img.Bounds()
+	contentBounds := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, alpha := img.At(x, y).RGBA()
+			if alpha != 0 {
+				contentBounds = contentBounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if contentBounds.Empty() || contentBounds == bounds {
+		return img
+	}
+
+	trimmed := imaging.Crop(img, contentBounds)
+	if contentBounds.Dx() == contentBounds.Dy() {
+		return trimmed
+	}
+
+	size := contentBounds.Dx()
+	if contentBounds.Dy() > size {
+		size = contentBounds.Dy()
+	}
+	return imaging.PasteCenter(imaging.New(size, size, color.Transparent), trimmed)
+}
+
+// transparent margin on each side, in percent of the resulting icon size (content is not resized, canvas is enlarged)
+func addPadding(img image.Image, padding float64) image.Image {
+	if padding <= 0 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	scale := 1 - 2*padding/100
+	width := int(math.Ceil(float64(bounds.Dx()) / scale))
+	height := int(math.Ceil(float64(bounds.Dy()) / scale))
+	return imaging.PasteCenter(imaging.New(width, height, color.Transparent), img)
+}
@@ -0,0 +1,91 @@
+package icons
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func createImageWithContent(size int, content image.Rectangle) *image.NRGBA {
+	result := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := content.Min.Y; y < content.Max.Y; y++ {
+		for x := content.Min.X; x < content.Max.X; x++ {
+			result.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	return result
+}
+
+func TestTrimTransparentBorders(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	trimmed := trimTransparentBorders(createImageWithContent(100, image.Rect(10, 20, 50, 40)))
+	// 40x20 content is centered on 40x40 canvas
+	g.Expect(trimmed.Bounds()).To(Equal(image.Rect(0, 0, 40, 40)))
+	_, _, _, alpha := trimmed.At(0, 5).RGBA()
+	g.Expect(alpha).To(BeZero())
+	_, _, _, alpha = trimmed.At(0, 10).RGBA()
+	g.Expect(alpha).To(Equal(uint32(0xffff)))
+
+	empty := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	g.Expect(trimTransparentBorders(empty)).To(BeIdenticalTo(empty))
+}
+
+func TestAddPadding(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	padded := addPadding(createImageWithContent(100, image.Rect(0, 0, 100, 100)), 10)
+	g.Expect(padded.Bounds()).To(Equal(image.Rect(0, 0, 125, 125)))
+	_, _, _, alpha := padded.At(11, 11).RGBA()
+	g.Expect(alpha).To(BeZero())
+	_, _, _, alpha = padded.At(12, 12).RGBA()
+	g.Expect(alpha).To(Equal(uint32(0xffff)))
+
+	g.Expect(validatePadding(10)).To(Succeed())
+	g.Expect(validatePadding(50)).To(HaveOccurred())
+	g.Expect(validatePadding(-1)).To(HaveOccurred())
+}
+
+func TestConvertIconWithTrimAndPadding(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "icon-trim")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceFile := filepath.Join(tmpDir, "icon.png")
+	g.Expect(SaveImage(createImageWithContent(512, image.Rect(128, 192, 384, 320)), sourceFile, PNG)).To(Succeed())
+
+	outDir := filepath.Join(tmpDir, "out")
+	request := &IconConvertRequest{
+		Sources:         &[]string{sourceFile},
+		FallbackSources: &[]string{},
+		OutputFormat:    "set",
+		OutputDir:       outDir,
+		IsTrim:          true,
+		Padding:         10,
+	}
+	result, err := ConvertIcon(context.Background(), request)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// 256x128 content is trimmed, squared to 256 and padded to 320, source file is not used as is
+	maxIcon := result.Icons[len(result.Icons)-1]
+	g.Expect(IconInfo{File: maxIcon.File, Size: maxIcon.Size}).To(Equal(IconInfo{File: filepath.Join(outDir, "icon_320x320.png"), Size: 320}))
+	img, err := LoadImage(maxIcon.File)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, _, _, alpha := img.At(160, 160).RGBA()
+	g.Expect(alpha).To(Equal(uint32(0xffff)))
+	_, _, _, alpha = img.At(160, 31).RGBA()
+	g.Expect(alpha).To(BeZero())
+
+	plan, err := PlanIcon(request)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Action).To(Equal("convert"))
+	g.Expect(plan.Outputs).NotTo(ContainElement(sourceFile))
+}
@@ -0,0 +1,203 @@
+package icons
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+// WatchEvent is a line of the watch output (line-delimited JSON), written on start and on every regeneration
+type WatchEvent struct {
+	// "converted" or "error"
+	Event  string             `json:"event"`
+	Result *IconConvertResult `json:"result,omitempty"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+
+	// empty for the initial conversion
+	ChangedFiles []string `json:"changedFiles,omitempty"`
+}
+
+type watchedFileState struct {
+	modTime int64
+	size    int64
+	mode    os.FileMode
+}
+
+// WatchIcon converts icon and then polls resolved source files (and candidates that do not exist yet), regenerating output on change until context is done.
+// Conversion errors are reported as events and do not stop watching. Remote (URL) sources are not watched.
+func WatchIcon(ctx context.Context, configuration *IconConvertRequest, interval time.Duration, writer io.Writer) error {
+	snapshot := collectWatchedFiles(configuration)
+	err := writeWatchEvent(writer, convertForWatch(ctx, configuration, nil))
+	if err != nil {
+		return err
+	}
+
+	// change is processed only when files are not changed during interval (editor can write file in several steps)
+	previous := snapshot
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		current := collectWatchedFiles(configuration)
+		isStable := len(diffWatchedFiles(previous, current)) == 0
+		previous = current
+		if !isStable {
+			continue
+		}
+
+		changedFiles := diffWatchedFiles(snapshot, current)
+		if len(changedFiles) == 0 {
+			continue
+		}
+
+		snapshot = current
+		log.WithField("files", changedFiles).Debug("icon sources changed, regenerating")
+		err = writeWatchEvent(writer, convertForWatch(ctx, configuration, changedFiles))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func convertForWatch(ctx context.Context, configuration *IconConvertRequest, changedFiles []string) *WatchEvent {
+	// ConvertIcon can modify request (output dir is set from output file)
+	request := *configuration
+	result, err := ConvertIcon(ctx, &request)
+	if err == nil {
+		return &WatchEvent{Event: "converted", Result: result, ChangedFiles: changedFiles}
+	}
+
+	event := &WatchEvent{Event: "error", Error: err.Error(), ChangedFiles: changedFiles}
+	userError := toUserError(err)
+	if userError == nil {
+		log.Debugf("%+v\n", err)
+	} else {
+		event.Error = userError.Error()
+		event.ErrorCode = userError.ErrorCode()
+	}
+	return event
+}
+
+func writeWatchEvent(writer io.Writer, event *WatchEvent) error {
+	data, err := jsoniter.ConfigFastest.Marshal(event)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = writer.Write(append(data, '\n'))
+	return errors.WithStack(err)
+}
+
+// all paths that resolveSourceFile can check are collected, so, adding file with higher priority is detected as well
+func collectWatchedFiles(configuration *IconConvertRequest) map[string]watchedFileState {
+	candidates := createCommonIconSources(*configuration.Sources, configuration.OutputFormat)
+	if configuration.FallbackSources != nil {
+		candidates = append(candidates, *configuration.FallbackSources...)
+	}
+
+	roots := configuration.getRoots()
+	result := make(map[string]watchedFileState)
+	for _, candidate := range candidates {
+		if isRemoteSource(candidate) {
+			continue
+		}
+
+		for _, file := range expandWatchCandidate(candidate, roots) {
+			// output can be written into the one of roots, it must not trigger regeneration
+			if (len(configuration.OutputDir) != 0 && isInDir(file, configuration.OutputDir)) || file == configuration.OutputFile {
+				continue
+			}
+			addWatchedFile(file, result)
+			// size config next to the source file (for dir it is watched as a child)
+			if state, exists := result[file]; exists && !state.mode.IsDir() {
+				addWatchedFile(filepath.Join(filepath.Dir(file), sizeConfigFileName), result)
+			}
+		}
+	}
+	if len(configuration.SizeConfig) != 0 {
+		addWatchedFile(configuration.SizeConfig, result)
+	}
+	return result
+}
+
+func expandWatchCandidate(candidate string, roots []string) []string {
+	if filepath.IsAbs(candidate) {
+		roots = []string{""}
+	}
+
+	var result []string
+	if !isGlobPattern(candidate) {
+		for _, root := range roots {
+			result = append(result, filepath.Join(root, candidate))
+		}
+		return result
+	}
+
+	patterns, err := expandAlternatives(candidate)
+	if err != nil {
+		return nil
+	}
+	for _, root := range roots {
+		for _, pattern := range patterns {
+			matches, err := filepath.Glob(filepath.Join(root, pattern))
+			if err == nil {
+				result = append(result, matches...)
+			}
+		}
+	}
+	return result
+}
+
+// for directory (icon set) direct children are watched as well
+func addWatchedFile(file string, result map[string]watchedFileState) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+
+	result[file] = watchedFileState{modTime: info.ModTime().UnixNano(), size: info.Size(), mode: info.Mode()}
+	if !info.IsDir() {
+		return
+	}
+
+	children, err := ioutil.ReadDir(file)
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if !child.IsDir() {
+			result[filepath.Join(file, child.Name())] = watchedFileState{modTime: child.ModTime().UnixNano(), size: child.Size(), mode: child.Mode()}
+		}
+	}
+}
+
+// returns sorted list of added, removed and modified files
+func diffWatchedFiles(old map[string]watchedFileState, current map[string]watchedFileState) []string {
+	var result []string
+	for file, state := range current {
+		oldState, isExisting := old[file]
+		if !isExisting || oldState != state {
+			result = append(result, file)
+		}
+	}
+	for file := range old {
+		if _, isExisting := current[file]; !isExisting {
+			result = append(result, file)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,74 @@
+package icons
+
+import (
+	"bufio"
+	"context"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/json-iterator/go"
+	. "github.com/onsi/gomega"
+)
+
+func TestWatchIcon(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "watch")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceFile := filepath.Join(tmpDir, "icon.png")
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 256, 256)), sourceFile, PNG)).To(Succeed())
+
+	reader, writer := io.Pipe()
+	watchContext, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		configuration := &IconConvertRequest{
+			Sources:         &[]string{"icon.png"},
+			FallbackSources: &[]string{},
+			Roots:           &[]string{tmpDir},
+			OutputFormat:    "set",
+			OutputDir:       filepath.Join(tmpDir, "out"),
+		}
+		done <- WatchIcon(watchContext, configuration, 10*time.Millisecond, writer)
+		_ = writer.Close()
+	}()
+
+	scanner := bufio.NewScanner(reader)
+	readEvent := func() WatchEvent {
+		g.Expect(scanner.Scan()).To(BeTrue())
+		var event WatchEvent
+		g.Expect(jsoniter.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+		return event
+	}
+
+	event := readEvent()
+	g.Expect(event.Event).To(Equal("converted"))
+	g.Expect(event.ChangedFiles).To(BeEmpty())
+	g.Expect(event.Result.Icons).To(HaveLen(1))
+
+	// too small image is reported as error event, watching continues
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 16, 16)), sourceFile, PNG)).To(Succeed())
+	event = readEvent()
+	g.Expect(event.Event).To(Equal("error"))
+	g.Expect(event.ErrorCode).To(Equal("ERR_ICON_TOO_SMALL"))
+	g.Expect(event.ChangedFiles).To(Equal([]string{sourceFile}))
+
+	g.Expect(SaveImage(image.NewNRGBA(image.Rect(0, 0, 512, 512)), sourceFile, PNG)).To(Succeed())
+	event = readEvent()
+	g.Expect(event.Event).To(Equal("converted"))
+
+	cancel()
+	// unblock writer if event is being written
+	go func() {
+		for scanner.Scan() {
+		}
+	}()
+	g.Expect(<-done).To(Succeed())
+}
@@ -0,0 +1,146 @@
+package linuxDesktop
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+type DesktopIntegrationConfiguration struct {
+	ExecutableName string       `json:"executableName"`
+	Entry          DesktopEntry `json:"entry"`
+	MimeTypes      []MimeType   `json:"mimeTypes"`
+
+	// files relative to stage dir (e.g. executable), run path is set to RunPath (default: $ORIGIN)
+	RunPathFiles []string `json:"runPathFiles"`
+	RunPath      string   `json:"runPath"`
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	configureSetRunPathCommand(app)
+	configureDesktopIntegrationCommand(app)
+	configureValidateCommand(app)
+}
+
+func configureSetRunPathCommand(app *kingpin.Application) {
+	command := app.Command("set-rpath", "Set run path (DT_RUNPATH) of ELF file.")
+	input := command.Flag("input", "The ELF file.").Short('i').Required().String()
+	runPath := command.Flag("rpath", "").Default("$ORIGIN").String()
+	command.Action(func(context *kingpin.ParseContext) error {
+		return SetRunPath(*input, *runPath)
+	})
+}
+
+func configureDesktopIntegrationCommand(app *kingpin.Application) {
+	command := app.Command("desktop-integration", "Write .desktop file and MIME info to stage dir, set run path of binaries and validate result.")
+	stageDir := command.Flag("stage", "The stage dir.").Short('s').Required().String()
+	configurationValue := command.Flag("configuration", "JSON or base64 encoded JSON.").Short('c').Required().String()
+	command.Action(func(context *kingpin.ParseContext) error {
+		var data []byte
+		if strings.HasPrefix(*configurationValue, "{") {
+			data = []byte(*configurationValue)
+		} else {
+			var err error
+			data, err = base64.StdEncoding.DecodeString(*configurationValue)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		var configuration DesktopIntegrationConfiguration
+		err := jsoniter.Unmarshal(data, &configuration)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		problems, err := WriteDesktopIntegration(*stageDir, &configuration)
+		if err != nil {
+			return err
+		}
+		return reportProblems(filepath.Join(*stageDir, configuration.ExecutableName+".desktop"), problems)
+	})
+}
+
+func configureValidateCommand(app *kingpin.Application) {
+	command := app.Command("validate-desktop-file", "Validate .desktop file.")
+	file := command.Flag("file", "The .desktop file.").Short('f').Required().String()
+	appDir := command.Flag("app", "The app dir to check that Exec program exists.").String()
+	iconDir := command.Flag("icon-dir", "The hicolor icon theme dir to check that Icon exists.").String()
+	command.Action(func(context *kingpin.ParseContext) error {
+		problems, err := ValidateDesktopFile(*file, *appDir, *iconDir)
+		if err != nil {
+			return err
+		}
+		return reportProblems(*file, problems)
+	})
+}
+
+func reportProblems(file string, problems []string) error {
+	for _, problem := range problems {
+		log.WithField("file", file).Warn(problem)
+	}
+	if len(problems) != 0 {
+		return errors.Errorf("%s is invalid (%d problems)", file, len(problems))
+	}
+	return nil
+}
+
+// WriteDesktopIntegration writes <executableName>.desktop to the stage dir and MIME info to usr/share/mime, sets run path of binaries.
+// Stage dir is expected to contain generated hicolor icon set (usr/share/icons/hicolor), list of problems is returned.
+func WriteDesktopIntegration(stageDir string, configuration *DesktopIntegrationConfiguration) ([]string, error) {
+	executableName := configuration.ExecutableName
+	if len(executableName) == 0 {
+		return nil, errors.New("executableName is not specified")
+	}
+
+	runPath := configuration.RunPath
+	if len(runPath) == 0 {
+		runPath = "$ORIGIN"
+	}
+	for _, file := range configuration.RunPathFiles {
+		err := SetRunPath(filepath.Join(stageDir, file), runPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entry := configuration.Entry
+	if len(entry.Name) == 0 {
+		entry.Name = executableName
+	}
+	if len(entry.MimeTypes) == 0 {
+		for _, mimeType := range configuration.MimeTypes {
+			entry.MimeTypes = append(entry.MimeTypes, mimeType.Type)
+		}
+	}
+	if len(entry.Exec) == 0 {
+		entry.Exec = QuoteExecArgument(executableName)
+		if len(entry.MimeTypes) != 0 {
+			entry.Exec += " %U"
+		}
+	}
+	if len(entry.Icon) == 0 {
+		entry.Icon = executableName
+	}
+
+	desktopFile := filepath.Join(stageDir, executableName+".desktop")
+	err := ioutil.WriteFile(desktopFile, entry.Render(), 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(configuration.MimeTypes) != 0 {
+		err = WriteMimeInfo(filepath.Join(stageDir, "usr", "share", "mime", executableName+".xml"), configuration.MimeTypes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ValidateDesktopFile(desktopFile, stageDir, filepath.Join(stageDir, "usr", "share", "icons", "hicolor"))
+}
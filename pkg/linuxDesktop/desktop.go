@@ -0,0 +1,239 @@
+package linuxDesktop
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/
+type DesktopEntry struct {
+	Name        string `json:"name"`
+	GenericName string `json:"genericName"`
+	Comment     string `json:"comment"`
+	// default: executable name (with %U if there are MIME types)
+	Exec string `json:"exec"`
+	// icon name in the hicolor theme, default: executable name
+	Icon           string   `json:"icon"`
+	Terminal       bool     `json:"terminal"`
+	StartupWMClass string   `json:"startupWMClass"`
+	Categories     []string `json:"categories"`
+	Keywords       []string `json:"keywords"`
+	MimeTypes      []string `json:"mimeTypes"`
+
+	// additional keys (e.g. X-AppImage-Version), written sorted by key
+	Extra map[string]string `json:"extra"`
+}
+
+const desktopEntryGroup = "Desktop Entry"
+
+// Render returns content of .desktop file
+func (t *DesktopEntry) Render() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("[" + desktopEntryGroup + "]\n")
+	writeValue := func(key string, value string) {
+		if len(value) != 0 {
+			buffer.WriteString(key + "=" + escapeValue(value) + "\n")
+		}
+	}
+	writeList := func(key string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+
+		buffer.WriteString(key + "=")
+		for _, value := range values {
+			buffer.WriteString(strings.Replace(escapeValue(value), ";", "\\;", -1) + ";")
+		}
+		buffer.WriteString("\n")
+	}
+
+	writeValue("Name", t.Name)
+	writeValue("GenericName", t.GenericName)
+	writeValue("Comment", t.Comment)
+	writeValue("Exec", t.Exec)
+	if t.Terminal {
+		writeValue("Terminal", "true")
+	} else {
+		writeValue("Terminal", "false")
+	}
+	writeValue("Type", "Application")
+	writeValue("Icon", t.Icon)
+	writeValue("StartupWMClass", t.StartupWMClass)
+	writeList("Categories", t.Categories)
+	writeList("Keywords", t.Keywords)
+	writeList("MimeType", t.MimeTypes)
+
+	keys := make([]string, 0, len(t.Extra))
+	for key := range t.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeValue(key, t.Extra[key])
+	}
+	return buffer.Bytes()
+}
+
+func escapeValue(value string) string {
+	var builder strings.Builder
+	for index, c := range value {
+		switch {
+		case c == '\\':
+			builder.WriteString("\\\\")
+		case c == '\n':
+			builder.WriteString("\\n")
+		case c == '\t':
+			builder.WriteString("\\t")
+		case c == '\r':
+			builder.WriteString("\\r")
+		case c == ' ' && index == 0:
+			builder.WriteString("\\s")
+		default:
+			builder.WriteRune(c)
+		}
+	}
+	return builder.String()
+}
+
+// QuoteExecArgument quotes argument of Exec key if it contains reserved characters
+func QuoteExecArgument(value string) string {
+	if !strings.ContainsAny(value, " \t\n\"'\\><~|&;$*?#()`") {
+		return value
+	}
+
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, c := range value {
+		if c == '"' || c == '`' || c == '$' || c == '\\' {
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(c)
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+// ParseDesktopFile returns keys of the [Desktop Entry] group (values are unescaped, localized keys are kept as is, e.g. Name[de])
+func ParseDesktopFile(data []byte) (map[string]string, error) {
+	result := make(map[string]string)
+	group := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, errors.Errorf("line %d: invalid group header %q", lineNumber, line)
+			}
+			group = line[1 : len(line)-1]
+			if len(result) == 0 && group != desktopEntryGroup {
+				return nil, errors.Errorf("line %d: the first group must be [%s], but [%s] found", lineNumber, desktopEntryGroup, group)
+			}
+			continue
+		}
+
+		if len(group) == 0 {
+			return nil, errors.Errorf("line %d: key outside of group", lineNumber)
+		}
+		if group != desktopEntryGroup {
+			// actions and other groups
+			continue
+		}
+
+		index := strings.IndexByte(line, '=')
+		if index <= 0 {
+			return nil, errors.Errorf("line %d: invalid key-value pair %q", lineNumber, line)
+		}
+
+		key := strings.TrimSpace(line[:index])
+		if _, ok := result[key]; ok {
+			return nil, errors.Errorf("line %d: duplicated key %s", lineNumber, key)
+		}
+		result[key] = unescapeValue(strings.TrimSpace(line[index+1:]))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if group == "" {
+		return nil, errors.Errorf("[%s] group is missing", desktopEntryGroup)
+	}
+	return result, nil
+}
+
+func unescapeValue(value string) string {
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+
+	var builder strings.Builder
+	for index := 0; index < len(value); index++ {
+		c := value[index]
+		if c != '\\' || index+1 == len(value) {
+			builder.WriteByte(c)
+			continue
+		}
+
+		index++
+		switch value[index] {
+		case 's':
+			builder.WriteByte(' ')
+		case 'n':
+			builder.WriteByte('\n')
+		case 't':
+			builder.WriteByte('\t')
+		case 'r':
+			builder.WriteByte('\r')
+		case '\\':
+			builder.WriteByte('\\')
+		default:
+			// \; in lists is kept to split list correctly
+			builder.WriteByte('\\')
+			builder.WriteByte(value[index])
+		}
+	}
+	return builder.String()
+}
+
+// splitExec splits unescaped Exec value into arguments (quoted arguments are unquoted)
+func splitExec(value string) ([]string, error) {
+	var result []string
+	var current strings.Builder
+	isQuoted := false
+	hasArgument := false
+	for index := 0; index < len(value); index++ {
+		c := value[index]
+		switch {
+		case isQuoted && c == '\\' && index+1 < len(value):
+			index++
+			current.WriteByte(value[index])
+		case c == '"':
+			isQuoted = !isQuoted
+			hasArgument = true
+		case !isQuoted && (c == ' ' || c == '\t'):
+			if hasArgument {
+				result = append(result, current.String())
+				current.Reset()
+				hasArgument = false
+			}
+		default:
+			current.WriteByte(c)
+			hasArgument = true
+		}
+	}
+
+	if isQuoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if hasArgument {
+		result = append(result, current.String())
+	}
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package linuxDesktop
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testBaseAddress = 0x400000
+
+// minimal ELF64 file with PT_LOAD and PT_DYNAMIC segments (without section headers, as stripped binary)
+func createTestElf(runPath string) []byte {
+	const stringTableOffset = 0x100
+	const dynamicOffset = 0x200
+
+	stringTable := []byte("\x00libc.so.6\x00")
+	runPathOffset := uint64(len(stringTable))
+	if len(runPath) != 0 {
+		stringTable = append(stringTable, runPath...)
+		stringTable = append(stringTable, 0)
+	}
+
+	entries := []dynamicEntry{
+		{tag: elf.DT_NEEDED, value: 1},
+		{tag: elf.DT_STRTAB, value: testBaseAddress + stringTableOffset},
+		{tag: elf.DT_STRSZ, value: uint64(len(stringTable))},
+	}
+	if len(runPath) != 0 {
+		entries = append(entries, dynamicEntry{tag: elf.DT_RUNPATH, value: runPathOffset})
+	}
+	entries = append(entries, dynamicEntry{tag: elf.DT_NULL})
+
+	data := make([]byte, dynamicOffset+len(entries)*16)
+	copy(data, []byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)})
+	order := binary.LittleEndian
+	order.PutUint16(data[16:], uint16(elf.ET_EXEC))
+	order.PutUint16(data[18:], uint16(elf.EM_X86_64))
+	order.PutUint32(data[20:], uint32(elf.EV_CURRENT))
+	// program header offset, header size, program header entry size and count
+	order.PutUint64(data[32:], 64)
+	order.PutUint16(data[52:], 64)
+	order.PutUint16(data[54:], 56)
+	order.PutUint16(data[56:], 2)
+
+	writeProgramHeader := func(offset int, progType elf.ProgType, fileOffset uint64, size uint64) {
+		order.PutUint32(data[offset:], uint32(progType))
+		order.PutUint32(data[offset+4:], uint32(elf.PF_R))
+		order.PutUint64(data[offset+8:], fileOffset)
+		order.PutUint64(data[offset+16:], testBaseAddress+fileOffset)
+		order.PutUint64(data[offset+24:], testBaseAddress+fileOffset)
+		order.PutUint64(data[offset+32:], size)
+		order.PutUint64(data[offset+40:], size)
+		order.PutUint64(data[offset+48:], 8)
+	}
+	writeProgramHeader(64, elf.PT_LOAD, 0, uint64(len(data)))
+	writeProgramHeader(64+56, elf.PT_DYNAMIC, dynamicOffset, uint64(len(entries)*16))
+
+	copy(data[stringTableOffset:], stringTable)
+	for index, entry := range entries {
+		order.PutUint64(data[dynamicOffset+index*16:], uint64(entry.tag))
+		order.PutUint64(data[dynamicOffset+index*16+8:], entry.value)
+	}
+	return data
+}
+
+func writeTestElf(t *testing.T, dir string, runPath string) string {
+	file := filepath.Join(dir, "app")
+	err := ioutil.WriteFile(file, createTestElf(runPath), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSetRunPath(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "linux-desktop-test")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := writeTestElf(t, dir, "/opt/build/node_modules/some/lib")
+	runPath, err := GetRunPath(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(runPath).To(Equal("/opt/build/node_modules/some/lib"))
+
+	g.Expect(SetRunPath(file, "$ORIGIN")).To(Succeed())
+	runPath, err = GetRunPath(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(runPath).To(Equal("$ORIGIN"))
+
+	// other strings are not affected
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring("\x00libc.so.6\x00$ORIGIN\x00"))
+
+	if _, err := exec.LookPath("patchelf"); err == nil {
+		t.Skip("patchelf is installed")
+	}
+
+	// run path cannot be extended in place
+	g.Expect(SetRunPath(file, "$ORIGIN:$ORIGIN/lib")).To(HaveOccurred())
+	g.Expect(SetRunPath(writeTestElf(t, dir, ""), "$ORIGIN")).To(HaveOccurred())
+}
+
+func TestRenderDesktopEntry(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	entry := &DesktopEntry{
+		Name:       " Test App",
+		Comment:    "first line\nsecond \\ line",
+		Exec:       QuoteExecArgument("test app") + " %U",
+		Icon:       "test-app",
+		Categories: []string{"Development", "A;B"},
+		MimeTypes:  []string{"application/x-test"},
+		Extra:      map[string]string{"X-B": "2", "X-A": "1"},
+	}
+	data := entry.Render()
+	g.Expect(string(data)).To(Equal(`[Desktop Entry]
+Name=\sTest App
+Comment=first line\nsecond \\ line
+Exec="test app" %U
+Terminal=false
+Type=Application
+Icon=test-app
+Categories=Development;A\;B;
+MimeType=application/x-test;
+X-A=1
+X-B=2
+`))
+
+	parsed, err := ParseDesktopFile(data)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(parsed["Name"]).To(Equal(" Test App"))
+	g.Expect(parsed["Comment"]).To(Equal(entry.Comment))
+
+	args, err := splitExec(parsed["Exec"])
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(args).To(Equal([]string{"test app", "%U"}))
+
+	_, err = ParseDesktopFile([]byte("[Other]\nName=a\n[Desktop Entry]\n"))
+	g.Expect(err).To(HaveOccurred())
+	_, err = ParseDesktopFile([]byte("[Desktop Entry]\nName=a\nName=b\n"))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRenderMimeInfo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	data, err := RenderMimeInfo([]MimeType{{Type: "application/x-test", Comment: "Tom & Jerry <document>", Globs: []string{"*.test"}}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`<?xml version="1.0" encoding="UTF-8"?>
+<mime-info xmlns="http://www.freedesktop.org/standards/shared-mime-info">
+  <mime-type type="application/x-test">
+    <comment>Tom &amp; Jerry &lt;document&gt;</comment>
+    <glob pattern="*.test"></glob>
+    <generic-icon name="x-office-document"></generic-icon>
+  </mime-type>
+</mime-info>
+`))
+
+	_, err = RenderMimeInfo([]MimeType{{Comment: "no type"}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDesktopIntegration(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	stageDir, err := ioutil.TempDir("", "linux-desktop-test")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(stageDir)
+
+	writeTestElf(t, stageDir, "/opt/build/lib")
+	iconDir := filepath.Join(stageDir, "usr", "share", "icons", "hicolor", "256x256", "apps")
+	g.Expect(os.MkdirAll(iconDir, 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(iconDir, "app.png"), []byte("png"), 0644)).To(Succeed())
+
+	configuration := &DesktopIntegrationConfiguration{
+		ExecutableName: "app",
+		Entry:          DesktopEntry{Name: "App", Categories: []string{"Utility"}},
+		MimeTypes:      []MimeType{{Type: "application/x-app", Globs: []string{"*.app"}}},
+		RunPathFiles:   []string{"app"},
+	}
+	problems, err := WriteDesktopIntegration(stageDir, configuration)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(problems).To(BeEmpty())
+
+	runPath, err := GetRunPath(filepath.Join(stageDir, "app"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(runPath).To(Equal("$ORIGIN"))
+
+	entry, err := ioutil.ReadFile(filepath.Join(stageDir, "app.desktop"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(entry)).To(ContainSubstring("Exec=app %U\n"))
+	g.Expect(string(entry)).To(ContainSubstring("Icon=app\n"))
+	g.Expect(string(entry)).To(ContainSubstring("MimeType=application/x-app;\n"))
+	g.Expect(filepath.Join(stageDir, "usr", "share", "mime", "app.xml")).To(BeAnExistingFile())
+
+	configuration.Entry = DesktopEntry{Exec: "missing %x", Icon: "other.png", MimeTypes: []string{"application/x-app"}}
+	configuration.RunPathFiles = nil
+	problems, err = WriteDesktopIntegration(stageDir, configuration)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(strings.Join(problems, "\n")).To(And(
+		ContainSubstring("field code %x is invalid"),
+		ContainSubstring("MimeType is set, but Exec doesn't accept files"),
+		ContainSubstring("Exec program missing is not found"),
+		ContainSubstring("Icon must be specified without extension"),
+	))
+
+	configuration.Entry = DesktopEntry{Icon: "other"}
+	problems, err = WriteDesktopIntegration(stageDir, configuration)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(problems).To(HaveLen(1))
+	g.Expect(problems[0]).To(ContainSubstring("Icon other is not found"))
+}
+
+func TestValidateDesktopEntry(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	problems := ValidateDesktopEntry(map[string]string{"Exec": "app %f", "Icon": "app", "Foo": "bar", "Name[de]": "App", "X-Custom": "1", "Terminal": "yes"}, "", "")
+	g.Expect(problems).To(ConsistOf(
+		"unknown key Foo (custom keys must be prefixed with X-)",
+		"required key Type is missing",
+		"required key Name is missing",
+		`Terminal must be true or false, but "yes" is set`,
+	))
+}
@@ -0,0 +1,93 @@
+package linuxDesktop
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/develar/errors"
+)
+
+// https://specifications.freedesktop.org/shared-mime-info-spec/latest/
+type MimeType struct {
+	Type    string   `json:"type"`
+	Comment string   `json:"comment"`
+	Globs   []string `json:"globs"`
+	// generic icon name, default: x-office-document
+	Icon string `json:"icon"`
+}
+
+type mimeInfoXml struct {
+	XMLName   xml.Name          `xml:"mime-info"`
+	Namespace string            `xml:"xmlns,attr"`
+	MimeTypes []mimeTypeElement `xml:"mime-type"`
+}
+
+type mimeTypeElement struct {
+	Type        string        `xml:"type,attr"`
+	Comment     string        `xml:"comment,omitempty"`
+	Globs       []globElement `xml:"glob"`
+	GenericIcon *iconElement  `xml:"generic-icon"`
+}
+
+type globElement struct {
+	Pattern string `xml:"pattern,attr"`
+}
+
+type iconElement struct {
+	Name string `xml:"name,attr"`
+}
+
+// RenderMimeInfo returns content of shared MIME info package (values are escaped, unlike a hand-built XML)
+func RenderMimeInfo(mimeTypes []MimeType) ([]byte, error) {
+	info := mimeInfoXml{Namespace: "http://www.freedesktop.org/standards/shared-mime-info"}
+	for _, mimeType := range mimeTypes {
+		if len(mimeType.Type) == 0 {
+			return nil, errors.New("MIME type is not specified")
+		}
+
+		element := mimeTypeElement{Type: mimeType.Type, Comment: mimeType.Comment}
+		for _, glob := range mimeType.Globs {
+			element.Globs = append(element.Globs, globElement{Pattern: glob})
+		}
+
+		icon := mimeType.Icon
+		if len(icon) == 0 {
+			icon = "x-office-document"
+		}
+		element.GenericIcon = &iconElement{Name: icon}
+		info.MimeTypes = append(info.MimeTypes, element)
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buffer)
+	encoder.Indent("", "  ")
+	err := encoder.Encode(info)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	buffer.WriteString("\n")
+	return buffer.Bytes(), nil
+}
+
+// WriteMimeInfo writes shared MIME info package to file (parent dirs are created)
+func WriteMimeInfo(file string, mimeTypes []MimeType) error {
+	data, err := RenderMimeInfo(mimeTypes)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package linuxDesktop
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type dynamicInfo struct {
+	file      *os.File
+	byteOrder binary.ByteOrder
+	is64      bool
+
+	entries []dynamicEntry
+
+	stringTableOffset int64
+	stringTableSize   uint64
+}
+
+type dynamicEntry struct {
+	tag   elf.DynTag
+	value uint64
+}
+
+func (t *dynamicInfo) entrySize() int64 {
+	if t.is64 {
+		return 16
+	}
+	return 8
+}
+
+func (t *dynamicInfo) find(tag elf.DynTag) int {
+	for index, entry := range t.entries {
+		if entry.tag == tag {
+			return index
+		}
+	}
+	return -1
+}
+
+// section headers can be stripped, so, program headers are used
+func readDynamicInfo(file *os.File) (*dynamicInfo, error) {
+	elfFile, err := elf.NewFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &dynamicInfo{file: file, byteOrder: elfFile.ByteOrder, is64: elfFile.Class == elf.ELFCLASS64}
+
+	var dynamicSegment *elf.Prog
+	for _, prog := range elfFile.Progs {
+		if prog.Type == elf.PT_DYNAMIC {
+			dynamicSegment = prog
+			break
+		}
+	}
+	if dynamicSegment == nil {
+		return nil, errors.New("file is not dynamically linked (PT_DYNAMIC is missing)")
+	}
+
+	data := make([]byte, dynamicSegment.Filesz)
+	_, err = file.ReadAt(data, int64(dynamicSegment.Off))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entrySize := int(result.entrySize())
+	for offset := 0; offset+entrySize <= len(data); offset += entrySize {
+		var entry dynamicEntry
+		if result.is64 {
+			entry = dynamicEntry{tag: elf.DynTag(result.byteOrder.Uint64(data[offset:])), value: result.byteOrder.Uint64(data[offset+8:])}
+		} else {
+			entry = dynamicEntry{tag: elf.DynTag(result.byteOrder.Uint32(data[offset:])), value: uint64(result.byteOrder.Uint32(data[offset+4:]))}
+		}
+		result.entries = append(result.entries, entry)
+		if entry.tag == elf.DT_NULL {
+			break
+		}
+	}
+
+	stringTableIndex := result.find(elf.DT_STRTAB)
+	stringTableSizeIndex := result.find(elf.DT_STRSZ)
+	if stringTableIndex < 0 || stringTableSizeIndex < 0 {
+		return nil, errors.New("dynamic string table is missing")
+	}
+
+	address := result.entries[stringTableIndex].value
+	for _, prog := range elfFile.Progs {
+		if prog.Type == elf.PT_LOAD && address >= prog.Vaddr && address < prog.Vaddr+prog.Filesz {
+			result.stringTableOffset = int64(address - prog.Vaddr + prog.Off)
+			result.stringTableSize = result.entries[stringTableSizeIndex].value
+			return result, nil
+		}
+	}
+	return nil, errors.Errorf("dynamic string table address %#x is not in any loadable segment", address)
+}
+
+// returns index of DT_RUNPATH entry (or DT_RPATH if DT_RUNPATH is not set)
+func (t *dynamicInfo) runPathIndex() int {
+	index := t.find(elf.DT_RUNPATH)
+	if index < 0 {
+		index = t.find(elf.DT_RPATH)
+	}
+	return index
+}
+
+func (t *dynamicInfo) readString(offset uint64) (string, error) {
+	if offset >= t.stringTableSize {
+		return "", errors.Errorf("string offset %d is out of dynamic string table", offset)
+	}
+
+	data := make([]byte, t.stringTableSize-offset)
+	_, err := t.file.ReadAt(data, t.stringTableOffset+int64(offset))
+	if err != nil && err != io.EOF {
+		return "", errors.WithStack(err)
+	}
+
+	end := bytes.IndexByte(data, 0)
+	if end < 0 {
+		return "", errors.New("string in dynamic string table is not terminated")
+	}
+	return string(data[:end]), nil
+}
+
+// GetRunPath returns DT_RUNPATH (or DT_RPATH) of ELF file, empty if not set
+func GetRunPath(file string) (string, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	info, err := readDynamicInfo(reader)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read %s", file)
+	}
+
+	index := info.runPathIndex()
+	if index < 0 {
+		return "", nil
+	}
+	return info.readString(info.entries[index].value)
+}
+
+// SetRunPath sets DT_RUNPATH (e.g. $ORIGIN to load bundled libraries from the dir of executable).
+// Existing run path is replaced in place if new value is not longer, otherwise patchelf is used (string table cannot be extended without relayout of file).
+func SetRunPath(file string, runPath string) error {
+	isPatched, err := setRunPathInPlace(file, runPath)
+	if err != nil || isPatched {
+		return err
+	}
+
+	patchelf, err := exec.LookPath("patchelf")
+	if err != nil {
+		return errors.Errorf("cannot set run path of %s in place (run path is not set or shorter than %q), install patchelf", file, runPath)
+	}
+
+	log.WithFields(log.Fields{"file": file, "runPath": runPath}).Debug("set run path using patchelf")
+	output, err := exec.Command(patchelf, "--set-rpath", runPath, file).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "patchelf failed: %s", bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+func setRunPathInPlace(file string, runPath string) (bool, error) {
+	writer, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	defer util.Close(writer)
+
+	info, err := readDynamicInfo(writer)
+	if err != nil {
+		return false, errors.Wrapf(err, "cannot read %s", file)
+	}
+
+	index := info.runPathIndex()
+	if index < 0 {
+		return false, nil
+	}
+
+	entry := info.entries[index]
+	current, err := info.readString(entry.value)
+	if err != nil {
+		return false, err
+	}
+	if current == runPath {
+		return true, nil
+	}
+	if len(runPath) > len(current) || info.isStringShared(index) {
+		return false, nil
+	}
+
+	// rest of the old value is zero filled
+	data := make([]byte, len(current))
+	copy(data, runPath)
+	_, err = writer.WriteAt(data, info.stringTableOffset+int64(entry.value))
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	log.WithFields(log.Fields{"file": file, "runPath": runPath, "old": current}).Debug("run path is set in place")
+	return true, nil
+}
+
+// linker can merge strings with the same suffix, shared string must be not modified
+func (t *dynamicInfo) isStringShared(index int) bool {
+	value := t.entries[index].value
+	for otherIndex, entry := range t.entries {
+		if otherIndex == index {
+			continue
+		}
+
+		switch entry.tag {
+		case elf.DT_NEEDED, elf.DT_SONAME, elf.DT_RPATH, elf.DT_RUNPATH:
+			if entry.value == value {
+				return true
+			}
+			other, err := t.readString(entry.value)
+			if err == nil && entry.value < value && entry.value+uint64(len(other)) > value {
+				return true
+			}
+		}
+	}
+	return false
+}
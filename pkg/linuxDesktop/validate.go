@@ -0,0 +1,188 @@
+package linuxDesktop
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+var knownKeys = map[string]bool{
+	"Type": true, "Version": true, "Name": true, "GenericName": true, "NoDisplay": true, "Comment": true, "Icon": true,
+	"Hidden": true, "OnlyShowIn": true, "NotShowIn": true, "DBusActivatable": true, "TryExec": true, "Exec": true,
+	"Path": true, "Terminal": true, "Actions": true, "MimeType": true, "Categories": true, "Implements": true,
+	"Keywords": true, "StartupNotify": true, "StartupWMClass": true, "URL": true, "PrefersNonDefaultGPU": true,
+	"SingleMainWindow": true,
+}
+
+var iconExtensions = []string{".png", ".svg", ".xpm"}
+
+// ValidateDesktopFile checks .desktop file and returns list of problems.
+// If appDir is specified, Exec program must exist in it (root or usr/bin), if iconDir (hicolor theme dir) is specified, Icon must exist in it.
+func ValidateDesktopFile(file string, appDir string, iconDir string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entry, err := ParseDesktopFile(data)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+	return ValidateDesktopEntry(entry, appDir, iconDir), nil
+}
+
+// ValidateDesktopEntry checks keys returned by ParseDesktopFile
+func ValidateDesktopEntry(entry map[string]string, appDir string, iconDir string) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for key := range entry {
+		baseKey := key
+		if index := strings.IndexByte(key, '['); index > 0 && strings.HasSuffix(key, "]") {
+			baseKey = key[:index]
+		}
+		if !knownKeys[baseKey] && !strings.HasPrefix(baseKey, "X-") {
+			report("unknown key %s (custom keys must be prefixed with X-)", key)
+		}
+	}
+
+	entryType := entry["Type"]
+	switch entryType {
+	case "":
+		report("required key Type is missing")
+	case "Application":
+	default:
+		report("Type must be Application, but %s is set", entryType)
+	}
+
+	if len(entry["Name"]) == 0 {
+		report("required key Name is missing")
+	}
+
+	exec := entry["Exec"]
+	if len(exec) == 0 {
+		if entryType == "Application" && entry["DBusActivatable"] != "true" {
+			report("required key Exec is missing")
+		}
+	} else {
+		problems = append(problems, validateExec(exec, entry["MimeType"], appDir)...)
+	}
+
+	icon := entry["Icon"]
+	if len(icon) == 0 {
+		report("Icon is not set")
+	} else {
+		problems = append(problems, validateIcon(icon, iconDir)...)
+	}
+
+	for _, key := range []string{"Terminal", "NoDisplay", "Hidden", "StartupNotify"} {
+		value, ok := entry[key]
+		if ok && value != "true" && value != "false" {
+			report("%s must be true or false, but %q is set", key, value)
+		}
+	}
+	return problems
+}
+
+func validateExec(exec string, mimeType string, appDir string) []string {
+	var problems []string
+	args, err := splitExec(exec)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid Exec %q: %s", exec, err)}
+	}
+	if len(args) == 0 {
+		return []string{"Exec is empty"}
+	}
+
+	hasFileArgument := false
+	for _, arg := range args {
+		for index := 0; index < len(arg); index++ {
+			if arg[index] != '%' {
+				continue
+			}
+			if index+1 == len(arg) {
+				problems = append(problems, fmt.Sprintf("Exec argument %q ends with %%", arg))
+				break
+			}
+
+			index++
+			code := arg[index]
+			switch code {
+			case 'f', 'F', 'u', 'U':
+				hasFileArgument = true
+			case 'i', 'c', 'k', '%':
+			case 'd', 'D', 'n', 'N', 'v', 'm':
+				problems = append(problems, fmt.Sprintf("Exec field code %%%c is deprecated", code))
+			default:
+				problems = append(problems, fmt.Sprintf("Exec field code %%%c is invalid", code))
+			}
+		}
+	}
+
+	if len(mimeType) != 0 && !hasFileArgument {
+		problems = append(problems, "MimeType is set, but Exec doesn't accept files or URLs (%f, %F, %u or %U)")
+	}
+
+	program := args[0]
+	if len(appDir) == 0 || filepath.IsAbs(program) {
+		return problems
+	}
+
+	var candidates []string
+	if strings.ContainsRune(program, '/') {
+		candidates = []string{filepath.Join(appDir, program)}
+	} else {
+		candidates = []string{filepath.Join(appDir, program), filepath.Join(appDir, "usr", "bin", program)}
+	}
+
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.Mode().Perm()&0111 == 0 {
+			problems = append(problems, fmt.Sprintf("Exec program %s is not executable", candidate))
+		}
+		return problems
+	}
+	return append(problems, fmt.Sprintf("Exec program %s is not found in %s", program, appDir))
+}
+
+func validateIcon(icon string, iconDir string) []string {
+	if strings.ContainsRune(icon, '/') {
+		return []string{fmt.Sprintf("Icon must be a name of icon in theme, but path %s is set", icon)}
+	}
+	for _, extension := range iconExtensions {
+		if strings.HasSuffix(strings.ToLower(icon), extension) {
+			return []string{fmt.Sprintf("Icon must be specified without extension, but %s is set", icon)}
+		}
+	}
+
+	if len(iconDir) == 0 {
+		return nil
+	}
+
+	sizeDirs, err := ioutil.ReadDir(iconDir)
+	if err != nil {
+		return []string{fmt.Sprintf("cannot read icon dir: %s", err)}
+	}
+
+	for _, sizeDir := range sizeDirs {
+		if !sizeDir.IsDir() {
+			continue
+		}
+		for _, extension := range iconExtensions {
+			_, err := os.Stat(filepath.Join(iconDir, sizeDir.Name(), "apps", icon+extension))
+			if err == nil {
+				return nil
+			}
+		}
+	}
+	return []string{fmt.Sprintf("Icon %s is not found in %s", icon, iconDir)}
+}
@@ -11,7 +11,14 @@ import (
 )
 
 func InitLogger() {
-	log.SetHandler(Default)
+	redactSensitiveEnv()
+
+	log.SetHandler(NewRedactingHandler(Default))
+	// flag is applied only after parsing, env is checked early to report parse errors in the requested format too
+	if os.Getenv("APP_BUILDER_LOG_FORMAT") == "json" {
+		log.SetHandler(NewRedactingHandler(NewJsonHandler(os.Stderr)))
+	}
+
 	debugEnv, isDebugDefined := os.LookupEnv("DEBUG")
 	if isDebugDefined && debugEnv != "false" {
 		log.SetLevel(log.DebugLevel)
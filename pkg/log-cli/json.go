@@ -0,0 +1,95 @@
+package log_cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+)
+
+// JsonHandler outputs every log record as a JSON line, so, caller (electron-builder) can forward it to own logger.
+type JsonHandler struct {
+	mu     sync.Mutex
+	Writer io.Writer
+}
+
+type jsonRecord struct {
+	Level     string                 `json:"level"`
+	Message   string                 `json:"message"`
+	Timestamp time.Time              `json:"timestamp"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+func NewJsonHandler(w io.Writer) *JsonHandler {
+	return &JsonHandler{Writer: w}
+}
+
+// HandleLog implements log.Handler.
+func (h *JsonHandler) HandleLog(e *log.Entry) error {
+	record := jsonRecord{
+		Level:     e.Level.String(),
+		Message:   e.Message,
+		Timestamp: e.Timestamp,
+	}
+
+	if len(e.Fields) != 0 {
+		record.Fields = make(map[string]interface{}, len(e.Fields))
+		for name, value := range e.Fields {
+			record.Fields[name] = toJsonFieldValue(value)
+		}
+	}
+
+	// encoding/json - map keys are sorted, output is stable
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err = h.Writer.Write(append(data, '\n'))
+	return err
+}
+
+// errors and other values without JSON representation are written as text
+func toJsonFieldValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+
+	_, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return value
+}
+
+// SetLogFormat sets handler for the format (text or json), secrets are redacted in both.
+func SetLogFormat(format string) error {
+	switch format {
+	case "", "text":
+		log.SetHandler(NewRedactingHandler(Default))
+	case "json":
+		log.SetHandler(NewRedactingHandler(NewJsonHandler(os.Stderr)))
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+	return nil
+}
+
+func ConfigureLogFormatFlag(app *kingpin.Application) {
+	format := app.Flag("log-format", "The log format.").Default("text").Envar("APP_BUILDER_LOG_FORMAT").Enum("text", "json")
+	app.PreAction(func(context *kingpin.ParseContext) error {
+		return SetLogFormat(*format)
+	})
+}
@@ -0,0 +1,32 @@
+package log_cli
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestJsonHandler(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var buffer bytes.Buffer
+	logger := &log.Logger{Handler: NewJsonHandler(&buffer), Level: log.DebugLevel}
+
+	log.Now = func() time.Time {
+		return time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	defer func() {
+		log.Now = time.Now
+	}()
+
+	logger.WithFields(log.Fields{"file": "foo.dmg", "size": 42, "cause": errors.New("bar")}).Warn("cannot sign")
+	logger.Info("done")
+
+	g.Expect(buffer.String()).To(Equal(`{"level":"warn","message":"cannot sign","timestamp":"2019-01-02T03:04:05Z","fields":{"cause":"bar","file":"foo.dmg","size":42}}
+{"level":"info","message":"done","timestamp":"2019-01-02T03:04:05Z"}
+`))
+}
@@ -0,0 +1,149 @@
+package log_cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/apex/log"
+)
+
+const redactedValue = "[redacted]"
+
+// shorter values are not registered, otherwise unrelated text is masked
+const minSecretLength = 4
+
+// substrings of lower-cased field names, values of such fields are always masked
+var sensitiveFieldNames = []string{"token", "password", "passphrase", "secret", "authorization", "credential", "apikey", "api-key", "privatekey"}
+
+// values are registered on logger initialization, command may not use them explicitly, but child process output or request can contain them
+var sensitiveEnvNames = []string{
+	"GH_TOKEN", "GITHUB_TOKEN", "BT_TOKEN", "KEYGEN_TOKEN",
+	"CSC_KEY_PASSWORD", "WIN_CSC_KEY_PASSWORD", "APPLE_APP_SPECIFIC_PASSWORD", "GPG_PASSPHRASE",
+	"AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+}
+
+var secrets struct {
+	mu       sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// Redact registers secret, every occurrence of it in messages and field values of log records is masked
+func Redact(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+
+	for _, value := range secrets.values {
+		if value == secret {
+			return
+		}
+	}
+
+	secrets.values = append(secrets.values, secret)
+	// longest first - secret can contain another one
+	sort.Slice(secrets.values, func(i, j int) bool {
+		return len(secrets.values[i]) > len(secrets.values[j])
+	})
+
+	pairs := make([]string, 0, len(secrets.values)*2)
+	for _, value := range secrets.values {
+		pairs = append(pairs, value, redactedValue)
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+func redactSensitiveEnv() {
+	for _, name := range sensitiveEnvNames {
+		Redact(os.Getenv(name))
+	}
+}
+
+// RedactString masks registered secrets in the string
+func RedactString(s string) string {
+	secrets.mu.RLock()
+	replacer := secrets.replacer
+	secrets.mu.RUnlock()
+
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// IsSensitiveName reports whether value of field (or header, option) with the name must be masked
+func IsSensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitiveName := range sensitiveFieldNames {
+		if strings.Contains(name, sensitiveName) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactingHandler masks values of sensitive fields and registered secrets before passing record to the handler (text or JSON)
+type RedactingHandler struct {
+	Handler log.Handler
+}
+
+func NewRedactingHandler(handler log.Handler) *RedactingHandler {
+	return &RedactingHandler{Handler: handler}
+}
+
+// HandleLog implements log.Handler.
+func (h *RedactingHandler) HandleLog(e *log.Entry) error {
+	return h.Handler.HandleLog(redactEntry(e))
+}
+
+// entry is copied, fields of the original one are shared with the logger
+func redactEntry(e *log.Entry) *log.Entry {
+	result := *e
+	result.Message = RedactString(e.Message)
+	if len(e.Fields) != 0 {
+		result.Fields = make(log.Fields, len(e.Fields))
+		for name, value := range e.Fields {
+			result.Fields[name] = redactFieldValue(name, value)
+		}
+	}
+	return &result
+}
+
+// values are converted to string only if contain secret, so, type is preserved for JSON output
+func redactFieldValue(name string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return v
+	}
+
+	if IsSensitiveName(name) {
+		if s, ok := value.(string); ok && len(s) == 0 {
+			return s
+		}
+		return redactedValue
+	}
+
+	var s string
+	switch v := value.(type) {
+	case string:
+		return RedactString(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+
+	redacted := RedactString(s)
+	if redacted == s {
+		return value
+	}
+	return redacted
+}
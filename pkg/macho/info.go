@@ -0,0 +1,246 @@
+package macho
+
+import (
+	"debug/macho"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+const (
+	loadCmdCodeSignature     = 0x1d
+	loadCmdVersionMinMacosx  = 0x24
+	loadCmdBuildVersion      = 0x32
+	electronFrameworkName    = "Electron Framework"
+	electronFrameworkDirName = electronFrameworkName + ".framework"
+)
+
+var buildPlatformNames = map[uint32]string{1: "macos", 2: "ios", 3: "tvos", 4: "watchos", 6: "maccatalyst"}
+
+type Info struct {
+	File  string     `json:"file"`
+	Archs []ArchInfo `json:"archs"`
+	// all architectures have code signature
+	IsSigned bool `json:"isSigned"`
+	// CFBundleVersion of linked Electron Framework, empty if not linked or framework is not found in the bundle
+	ElectronVersion string `json:"electronVersion,omitempty"`
+}
+
+type ArchInfo struct {
+	Arch string `json:"arch"`
+	// execute, dylib, bundle or object
+	Type     string `json:"type"`
+	Platform string `json:"platform,omitempty"`
+	MinOs    string `json:"minOs,omitempty"`
+	Sdk      string `json:"sdk,omitempty"`
+
+	HasCodeSignature bool `json:"hasCodeSignature"`
+	// install name of linked Electron Framework
+	ElectronFramework string `json:"electronFramework,omitempty"`
+}
+
+func ConfigureInfoCommand(app *kingpin.Application) {
+	command := app.Command("macho-info", "Report architectures, minimum OS version, code signature presence and linked Electron Framework version of Mach-O file or app bundle (main executable) as JSON.")
+	path := command.Arg("path", "The Mach-O file or app bundle.").Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		info, err := ReadInfo(*path)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(info)
+	})
+}
+
+// ReadInfo inspects Mach-O file (thin or fat) or main executable of app bundle
+func ReadInfo(path string) (*Info, error) {
+	file, err := resolveExecutable(path)
+	if err != nil {
+		return nil, err
+	}
+
+	archs, err := readArchInfos(file)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{File: file, Archs: archs, IsSigned: true}
+	isLinkedToElectron := filepath.Base(file) == electronFrameworkName
+	for _, arch := range archs {
+		if !arch.HasCodeSignature {
+			info.IsSigned = false
+		}
+		if len(arch.ElectronFramework) != 0 {
+			isLinkedToElectron = true
+		}
+	}
+
+	if isLinkedToElectron {
+		info.ElectronVersion, err = findElectronVersion(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// CFBundleExecutable of Contents/Info.plist for dir
+func resolveExecutable(path string) (string, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if !stat.IsDir() {
+		return path, nil
+	}
+
+	dict, _, err := plist.ReadFile(filepath.Join(path, "Contents", "Info.plist"))
+	if err != nil {
+		return "", err
+	}
+	executable, ok := dict["CFBundleExecutable"].(string)
+	if !ok || len(executable) == 0 {
+		return "", errors.Errorf("CFBundleExecutable is not specified in Info.plist of %s", path)
+	}
+	return filepath.Join(path, "Contents", "MacOS", executable), nil
+}
+
+func readArchInfos(file string) ([]ArchInfo, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	fatFile, err := macho.NewFatFile(reader)
+	if err == nil {
+		result := make([]ArchInfo, 0, len(fatFile.Arches))
+		for _, arch := range fatFile.Arches {
+			result = append(result, readArchInfo(arch.File))
+		}
+		return result, nil
+	}
+	if err != macho.ErrNotFat {
+		return nil, errors.WithMessage(err, "cannot read fat Mach-O "+file)
+	}
+
+	thinFile, err := macho.NewFile(reader)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read Mach-O "+file)
+	}
+	return []ArchInfo{readArchInfo(thinFile)}, nil
+}
+
+func readArchInfo(file *macho.File) ArchInfo {
+	result := ArchInfo{
+		Arch: ArchName(file.Cpu, file.SubCpu),
+		Type: fileTypeName(file.Type),
+	}
+
+	for _, load := range file.Loads {
+		if dylib, ok := load.(*macho.Dylib); ok {
+			if strings.Contains(dylib.Name, electronFrameworkDirName+"/") {
+				result.ElectronFramework = dylib.Name
+			}
+			continue
+		}
+
+		data := load.Raw()
+		if len(data) < 8 {
+			continue
+		}
+
+		switch file.ByteOrder.Uint32(data) {
+		case loadCmdCodeSignature:
+			result.HasCodeSignature = true
+		case loadCmdVersionMinMacosx:
+			// version, sdk
+			if len(data) >= 16 {
+				result.Platform = "macos"
+				result.MinOs = formatVersion(file.ByteOrder.Uint32(data[8:]))
+				result.Sdk = formatVersion(file.ByteOrder.Uint32(data[12:]))
+			}
+		case loadCmdBuildVersion:
+			// platform, minos, sdk, ntools
+			if len(data) >= 20 {
+				platform := file.ByteOrder.Uint32(data[8:])
+				result.Platform = buildPlatformNames[platform]
+				if len(result.Platform) == 0 {
+					result.Platform = fmt.Sprintf("%d", platform)
+				}
+				result.MinOs = formatVersion(file.ByteOrder.Uint32(data[12:]))
+				result.Sdk = formatVersion(file.ByteOrder.Uint32(data[16:]))
+			}
+		}
+	}
+	return result
+}
+
+// framework is searched in Contents/Frameworks of the enclosing bundles (helper apps are inside Contents/Frameworks of the main app)
+func findElectronVersion(file string) (string, error) {
+	var candidates []string
+	if filepath.Base(file) == electronFrameworkName {
+		candidates = append(candidates, filepath.Join(filepath.Dir(file), "Resources", "Info.plist"))
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for {
+		if filepath.Base(dir) == "Contents" {
+			candidates = append(candidates, filepath.Join(dir, "Frameworks", electronFrameworkDirName, "Resources", "Info.plist"))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	for _, candidate := range candidates {
+		_, err := os.Stat(candidate)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		dict, _, err := plist.ReadFile(candidate)
+		if err != nil {
+			return "", err
+		}
+		version, _ := dict["CFBundleVersion"].(string)
+		return version, nil
+	}
+	return "", nil
+}
+
+// xxxx.yy.zz nibbles, patch is omitted if 0
+func formatVersion(version uint32) string {
+	result := fmt.Sprintf("%d.%d", version>>16, (version>>8)&0xff)
+	if patch := version & 0xff; patch != 0 {
+		result += fmt.Sprintf(".%d", patch)
+	}
+	return result
+}
+
+func fileTypeName(fileType macho.Type) string {
+	switch fileType {
+	case macho.TypeExec:
+		return "execute"
+	case macho.TypeDylib:
+		return "dylib"
+	case macho.TypeBundle:
+		return "bundle"
+	case macho.TypeObj:
+		return "object"
+	default:
+		return fmt.Sprintf("%d", fileType)
+	}
+}
@@ -0,0 +1,68 @@
+package macho
+
+import (
+	"debug/macho"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestReadInfo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "macho-info")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	contentsDir := filepath.Join(tmpDir, "Test.app", "Contents")
+	frameworkDir := filepath.Join(contentsDir, "Frameworks", "Electron Framework.framework", "Resources")
+	g.Expect(os.MkdirAll(frameworkDir, 0755)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(contentsDir, "MacOS"), 0755)).To(Succeed())
+	g.Expect(plist.WriteFile(filepath.Join(contentsDir, "Info.plist"), map[string]interface{}{"CFBundleExecutable": "Test"}, plist.XmlFormat)).To(Succeed())
+	g.Expect(plist.WriteFile(filepath.Join(frameworkDir, "Info.plist"), map[string]interface{}{"CFBundleVersion": "22.3.1"}, plist.XmlFormat)).To(Succeed())
+
+	electronFramework := loadDylibCommand("@rpath/Electron Framework.framework/Electron Framework")
+	x64File := filepath.Join(tmpDir, "x64")
+	g.Expect(ioutil.WriteFile(x64File, thinMachO(macho.CpuAmd64,
+		// macOS 10.13, SDK 13.1
+		loadCommand(loadCmdVersionMinMacosx, 0x000a0d00, 0x000d0100),
+		electronFramework,
+		loadCommand(loadCmdCodeSignature, 0, 0),
+	), 0755)).To(Succeed())
+	arm64File := filepath.Join(tmpDir, "arm64")
+	g.Expect(ioutil.WriteFile(arm64File, thinMachO(macho.CpuArm64,
+		// platform macos, minos 11.0, sdk 13.1, no tools
+		loadCommand(loadCmdBuildVersion, 1, 0x000b0000, 0x000d0100, 0),
+		electronFramework,
+	), 0755)).To(Succeed())
+
+	executable := filepath.Join(contentsDir, "MacOS", "Test")
+	g.Expect(Lipo([]string{x64File, arm64File}, executable)).To(Succeed())
+
+	info, err := ReadInfo(filepath.Join(tmpDir, "Test.app"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info).To(Equal(&Info{
+		File:            executable,
+		IsSigned:        false,
+		ElectronVersion: "22.3.1",
+		Archs: []ArchInfo{
+			{Arch: "x86_64", Type: "execute", Platform: "macos", MinOs: "10.13", Sdk: "13.1", HasCodeSignature: true, ElectronFramework: "@rpath/Electron Framework.framework/Electron Framework"},
+			{Arch: "arm64", Type: "execute", Platform: "macos", MinOs: "11.0", Sdk: "13.1", ElectronFramework: "@rpath/Electron Framework.framework/Electron Framework"},
+		},
+	}))
+
+	// thin file outside of bundle
+	info, err = ReadInfo(x64File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.IsSigned).To(BeTrue())
+	g.Expect(info.ElectronVersion).To(BeEmpty())
+	g.Expect(info.Archs).To(HaveLen(1))
+
+	_, err = ReadInfo(filepath.Join(contentsDir, "Info.plist"))
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,115 @@
+package macho
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type inputSlice struct {
+	Slice
+	file string
+}
+
+// Lipo creates fat file from slices of inputs (thin or fat files) in the order of inputs, the same architecture must not be repeated.
+// Permissions of the first input are used.
+func Lipo(inputs []string, output string) error {
+	if len(inputs) == 0 {
+		return errors.New("no input files")
+	}
+
+	var slices []inputSlice
+	var archs []string
+	for _, input := range inputs {
+		inputSlices, err := ReadSlices(input)
+		if err != nil {
+			return err
+		}
+
+		for _, slice := range inputSlices {
+			for _, existing := range slices {
+				if existing.Cpu == slice.Cpu && existing.SubCpu&0xffffff == slice.SubCpu&0xffffff {
+					return errors.Errorf("%s and %s have the same architecture %s", existing.file, input, slice.Arch())
+				}
+			}
+			slices = append(slices, inputSlice{Slice: slice, file: input})
+			archs = append(archs, slice.Arch())
+		}
+	}
+
+	info, err := os.Stat(inputs[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// header (magic, count) and fat_arch (cputype, cpusubtype, offset, size, align) for every slice, all fields are big endian uint32
+	header := make([]byte, 8+20*len(slices))
+	binary.BigEndian.PutUint32(header[0:], magicFat)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(slices)))
+	offsets := make([]int64, len(slices))
+	offset := int64(len(header))
+	for index, slice := range slices {
+		alignment := int64(1) << slice.Align
+		offset = (offset + alignment - 1) &^ (alignment - 1)
+		offsets[index] = offset
+		if offset+slice.Size > 0xffffffff {
+			return errors.Errorf("fat file %s is too large (fat_arch_64 is not supported)", output)
+		}
+
+		entry := header[8+20*index:]
+		binary.BigEndian.PutUint32(entry[0:], uint32(slice.Cpu))
+		binary.BigEndian.PutUint32(entry[4:], slice.SubCpu)
+		binary.BigEndian.PutUint32(entry[8:], uint32(offset))
+		binary.BigEndian.PutUint32(entry[12:], uint32(slice.Size))
+		binary.BigEndian.PutUint32(entry[16:], slice.Align)
+		offset += slice.Size
+	}
+
+	err = fs.WriteFileAtomicWith(output, info.Mode().Perm(), func(writer *os.File) error {
+		_, err := writer.Write(header)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for index, slice := range slices {
+			// gap is filled with zeros
+			_, err = writer.Seek(offsets[index], io.SeekStart)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			err = copySlice(slice, writer)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"file":  output,
+		"archs": strings.Join(archs, ", "),
+	}).Debug("fat Mach-O created")
+	return nil
+}
+
+func copySlice(slice inputSlice, writer io.Writer) error {
+	reader, err := os.Open(slice.file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	_, err = io.Copy(writer, io.NewSectionReader(reader, slice.Offset, slice.Size))
+	return errors.WithStack(err)
+}
@@ -0,0 +1,141 @@
+package macho
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+const (
+	magicFat = 0xcafebabe
+	// Java class file has the same magic, but its version (where number of architectures is for fat file) is much greater
+	maxFatArchCount = 20
+
+	alignX86 = 12
+	alignArm = 14
+)
+
+// Slice is a thin Mach-O image (the whole thin file or architecture of fat file)
+type Slice struct {
+	Cpu    macho.Cpu
+	SubCpu uint32
+	Offset int64
+	Size   int64
+	// power of two
+	Align uint32
+}
+
+// Arch returns architecture name as used by lipo (x86_64, arm64, arm64e, i386)
+func (t *Slice) Arch() string {
+	return ArchName(t.Cpu, t.SubCpu)
+}
+
+func ArchName(cpu macho.Cpu, subCpu uint32) string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm64:
+		// capability bits are in the high byte
+		if subCpu&0xffffff == 2 {
+			return "arm64e"
+		}
+		return "arm64"
+	case macho.Cpu386:
+		return "i386"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuPpc:
+		return "ppc"
+	case macho.CpuPpc64:
+		return "ppc64"
+	default:
+		return cpu.String()
+	}
+}
+
+// IsMachO checks magic of thin (32 or 64-bit, any byte order) or fat Mach-O file, header must be at least 8 bytes
+func IsMachO(header []byte) bool {
+	if len(header) < 8 {
+		return false
+	}
+
+	switch binary.LittleEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	switch binary.BigEndian.Uint32(header) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	case magicFat:
+		archCount := binary.BigEndian.Uint32(header[4:])
+		return archCount > 0 && archCount < maxFatArchCount
+	}
+	return false
+}
+
+func IsMachOFile(file string) (bool, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	header := make([]byte, 8)
+	_, err = io.ReadFull(reader, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return IsMachO(header), nil
+}
+
+// ReadSlices returns the only slice of thin file or architectures of fat file
+func ReadSlices(file string) ([]Slice, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	fatFile, err := macho.NewFatFile(reader)
+	if err == nil {
+		result := make([]Slice, 0, len(fatFile.Arches))
+		for _, arch := range fatFile.Arches {
+			result = append(result, Slice{
+				Cpu:    arch.Cpu,
+				SubCpu: arch.SubCpu,
+				Offset: int64(arch.Offset),
+				Size:   int64(arch.Size),
+				Align:  arch.Align,
+			})
+		}
+		return result, nil
+	}
+	if err != macho.ErrNotFat {
+		return nil, errors.WithMessage(err, "cannot read fat Mach-O "+file)
+	}
+
+	thinFile, err := macho.NewFile(reader)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot read Mach-O "+file)
+	}
+
+	info, err := reader.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	align := uint32(alignX86)
+	if thinFile.Cpu == macho.CpuArm64 || thinFile.Cpu == macho.CpuArm {
+		align = alignArm
+	}
+	return []Slice{{Cpu: thinFile.Cpu, SubCpu: thinFile.SubCpu, Size: info.Size(), Align: align}}, nil
+}
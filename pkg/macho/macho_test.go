@@ -0,0 +1,93 @@
+package macho
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+// minimal thin 64-bit executable (header and load commands only)
+func thinMachO(cpu macho.Cpu, loads ...[]byte) []byte {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint32(data[0:], macho.Magic64)
+	binary.LittleEndian.PutUint32(data[4:], uint32(cpu))
+	binary.LittleEndian.PutUint32(data[12:], uint32(macho.TypeExec))
+	binary.LittleEndian.PutUint32(data[16:], uint32(len(loads)))
+	for _, load := range loads {
+		data = append(data, load...)
+	}
+	binary.LittleEndian.PutUint32(data[20:], uint32(len(data)-32))
+	return data
+}
+
+func loadCommand(cmd uint32, fields ...uint32) []byte {
+	data := make([]byte, 8+4*len(fields))
+	binary.LittleEndian.PutUint32(data[0:], cmd)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)))
+	for index, field := range fields {
+		binary.LittleEndian.PutUint32(data[8+4*index:], field)
+	}
+	return data
+}
+
+func loadDylibCommand(name string) []byte {
+	// name offset, timestamp, current and compatibility version
+	data := loadCommand(uint32(macho.LoadCmdDylib), 24, 0, 0, 0)
+	data = append(data, name...)
+	data = append(data, make([]byte, 8-len(name)%8)...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)))
+	return data
+}
+
+func TestIsMachO(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(IsMachO(thinMachO(macho.CpuAmd64))).To(BeTrue())
+	g.Expect(IsMachO([]byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 2})).To(BeTrue())
+	// Java class file version 52
+	g.Expect(IsMachO([]byte{0xca, 0xfe, 0xba, 0xbe, 0, 0, 0, 52})).To(BeFalse())
+	g.Expect(IsMachO([]byte("#!/bin/sh\n"))).To(BeFalse())
+	g.Expect(IsMachO([]byte{0xcf, 0xfa})).To(BeFalse())
+}
+
+func TestLipo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "lipo")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	x64File := filepath.Join(tmpDir, "x64")
+	arm64File := filepath.Join(tmpDir, "arm64")
+	g.Expect(ioutil.WriteFile(x64File, thinMachO(macho.CpuAmd64), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(arm64File, thinMachO(macho.CpuArm64), 0644)).To(Succeed())
+
+	fatFile := filepath.Join(tmpDir, "fat")
+	g.Expect(Lipo([]string{x64File, arm64File}, fatFile)).To(Succeed())
+
+	slices, err := ReadSlices(fatFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(slices).To(HaveLen(2))
+	g.Expect(slices[0].Arch()).To(Equal("x86_64"))
+	g.Expect(slices[0].Offset).To(Equal(int64(1 << alignX86)))
+	g.Expect(slices[0].Size).To(Equal(int64(32)))
+	g.Expect(slices[1].Arch()).To(Equal("arm64"))
+	g.Expect(slices[1].Offset).To(Equal(int64(1 << alignArm)))
+
+	data, err := ioutil.ReadFile(fatFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data[slices[1].Offset : slices[1].Offset+slices[1].Size]).To(Equal(thinMachO(macho.CpuArm64)))
+
+	info, err := os.Stat(fatFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0755)))
+
+	// fat file is accepted as input, but architecture must not be repeated
+	g.Expect(Lipo([]string{fatFile, x64File}, filepath.Join(tmpDir, "fat2"))).NotTo(Succeed())
+}
@@ -0,0 +1,347 @@
+package node_modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+// NODE_MODULE_VERSION of Electron major versions (https://github.com/electron/node-abi/blob/master/abi_registry.json)
+var electronMajorToAbi = map[int]int{
+	3: 64, 4: 69, 5: 70, 6: 73, 7: 75, 8: 76, 9: 80, 10: 82, 11: 85, 12: 87, 13: 89, 14: 97, 15: 98, 16: 99, 17: 101, 18: 103,
+	19: 106, 20: 107, 21: 109, 22: 110, 23: 113, 24: 114, 25: 116, 26: 116, 27: 118, 28: 119, 29: 121, 30: 123, 31: 125, 32: 128,
+	33: 130, 34: 132, 35: 133, 36: 135,
+}
+
+type NativeModulesOptions struct {
+	// app dir, production dependencies are checked
+	Dir             string
+	ElectronVersion string
+	// NODE_MODULE_VERSION, determined by Electron version if not specified
+	Abi int
+	// node names (darwin, linux, win32 and x64, ia32, arm64, armv7l), go names are accepted, current if not specified
+	Platform string
+	Arch     string
+}
+
+type NativeModulesPlan struct {
+	ElectronVersion string `json:"electronVersion"`
+	Abi             int    `json:"abi"`
+	Platform        string `json:"platform"`
+	Arch            string `json:"arch"`
+
+	Modules []NativeModule `json:"modules"`
+	// names of modules to rebuild (sorted)
+	Rebuild []string `json:"rebuild"`
+}
+
+type NativeModule struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Dir     string `json:"dir"`
+
+	HasBindingGyp bool `json:"hasBindingGyp"`
+	// ABI stable (node-addon-api or N-API versions declared for node-pre-gyp)
+	IsNapi bool `json:"isNapi"`
+	// prebuildify binary for the target (N-API or Electron ABI)
+	Prebuild string `json:"prebuild,omitempty"`
+
+	NeedsRebuild bool `json:"needsRebuild"`
+	// prebuild, napi-built or no-prebuild
+	Reason string `json:"reason"`
+}
+
+type nativePackageJson struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Dependencies map[string]string `json:"dependencies"`
+	GypFile      bool              `json:"gypfile"`
+	Binary       *struct {
+		NapiVersions []int `json:"napi_versions"`
+	} `json:"binary"`
+}
+
+func ConfigureNativeModulesCommand(app *kingpin.Application) {
+	command := app.Command("native-modules", "Detect native modules of production dependencies and determine which ones need to be rebuilt for the target Electron (JSON plan).")
+	options := NativeModulesOptions{}
+	command.Flag("dir", "The app dir.").Required().StringVar(&options.Dir)
+	command.Flag("electron-version", "The target Electron version.").Required().StringVar(&options.ElectronVersion)
+	command.Flag("abi", "The target NODE_MODULE_VERSION, determined by Electron version if not specified.").IntVar(&options.Abi)
+	command.Flag("platform", "The target platform, current by default.").StringVar(&options.Platform)
+	command.Flag("arch", "The target arch, current by default.").StringVar(&options.Arch)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		plan, err := PlanNativeModules(options)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(plan)
+	})
+}
+
+// GetElectronAbi returns NODE_MODULE_VERSION of the Electron version
+func GetElectronAbi(electronVersion string) (int, error) {
+	majorString := strings.SplitN(strings.TrimPrefix(electronVersion, "v"), ".", 2)[0]
+	major, err := strconv.Atoi(majorString)
+	if err != nil {
+		return 0, errors.Errorf("invalid Electron version %q", electronVersion)
+	}
+
+	abi, ok := electronMajorToAbi[major]
+	if !ok {
+		return 0, errors.Errorf("ABI of Electron %s is unknown, specify it explicitly", electronVersion)
+	}
+	return abi, nil
+}
+
+// PlanNativeModules checks production dependencies only, modules are sorted by dir
+func PlanNativeModules(options NativeModulesOptions) (*NativeModulesPlan, error) {
+	abi := options.Abi
+	if abi == 0 {
+		var err error
+		abi, err = GetElectronAbi(options.ElectronVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &NativeModulesPlan{
+		ElectronVersion: strings.TrimPrefix(options.ElectronVersion, "v"),
+		Abi:             abi,
+		Platform:        toNodePlatform(options.Platform),
+		Arch:            toNodeArch(options.Arch),
+		Modules:         []NativeModule{},
+		Rebuild:         []string{},
+	}
+
+	dirs, err := collectProductionDependencyDirs(options.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	isHost := plan.Platform == toNodePlatform("") && plan.Arch == toNodeArch("")
+	isRebuild := make(map[string]bool)
+	for _, dir := range dirs {
+		module, err := detectNativeModule(dir, plan, isHost)
+		if err != nil {
+			return nil, err
+		}
+		if module == nil {
+			continue
+		}
+
+		plan.Modules = append(plan.Modules, *module)
+		// several versions of the same module are rebuilt at once
+		if module.NeedsRebuild && !isRebuild[module.Name] {
+			isRebuild[module.Name] = true
+			plan.Rebuild = append(plan.Rebuild, module.Name)
+		}
+	}
+	sort.Strings(plan.Rebuild)
+	return plan, nil
+}
+
+// real dirs (the same package can be referenced from several node_modules dirs), sorted
+func collectProductionDependencyDirs(dir string) ([]string, error) {
+	collector := &Collector{
+		unresolvedDependencies:       make(map[string]bool),
+		NodeModuleDirToDependencyMap: make(map[string]*map[string]*Dependency),
+	}
+	dependency, err := readPackageJson(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dependency.dir = dir
+	err = collector.readDependencyTree(dependency)
+	if err != nil {
+		return nil, err
+	}
+
+	dirSet := make(map[string]bool)
+	for _, nameToDependency := range collector.NodeModuleDirToDependencyMap {
+		for _, dependency := range *nameToDependency {
+			dirSet[dependency.realDir] = true
+		}
+	}
+
+	result := make([]string, 0, len(dirSet))
+	for dependencyDir := range dirSet {
+		result = append(result, dependencyDir)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// nil if package is not native (no binding.gyp, gypfile, prebuilds or node-pre-gyp binary)
+func detectNativeModule(dir string, plan *NativeModulesPlan, isHost bool) (*NativeModule, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var packageJson nativePackageJson
+	err = jsoniter.Unmarshal(data, &packageJson)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", filepath.Join(dir, "package.json"))
+	}
+
+	hasBindingGyp, err := isExistingFile(filepath.Join(dir, "binding.gyp"))
+	if err != nil {
+		return nil, err
+	}
+	hasPrebuilds, err := isExistingFile(filepath.Join(dir, "prebuilds"))
+	if err != nil {
+		return nil, err
+	}
+	if !hasBindingGyp && !hasPrebuilds && !packageJson.GypFile && packageJson.Binary == nil {
+		return nil, nil
+	}
+
+	_, hasNodeAddonApi := packageJson.Dependencies["node-addon-api"]
+	module := &NativeModule{
+		Name:          packageJson.Name,
+		Version:       packageJson.Version,
+		Dir:           dir,
+		HasBindingGyp: hasBindingGyp || packageJson.GypFile,
+		IsNapi:        hasNodeAddonApi || (packageJson.Binary != nil && len(packageJson.Binary.NapiVersions) != 0),
+	}
+
+	if hasPrebuilds {
+		module.Prebuild, err = findPrebuild(dir, plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(module.Prebuild) != 0:
+		module.Reason = "prebuild"
+	case module.IsNapi && isHost && hasBuiltBinary(dir):
+		// ABI stable binary built on install for the current platform is usable by Electron
+		module.Reason = "napi-built"
+	default:
+		module.NeedsRebuild = true
+		module.Reason = "no-prebuild"
+	}
+	return module, nil
+}
+
+// prebuildify layout: prebuilds/<platform>-<arch>/<name>.<tags>.node, where tags are napi or runtime (node, electron) and abi<version>, libc and arm version
+func findPrebuild(dir string, plan *NativeModulesPlan) (string, error) {
+	prebuildArch := plan.Arch
+	if prebuildArch == "armv7l" {
+		prebuildArch = "arm"
+	}
+
+	prebuildDir := filepath.Join(dir, "prebuilds", plan.Platform+"-"+prebuildArch)
+	names, err := readDirNames(prebuildDir)
+	if err != nil {
+		return "", err
+	}
+
+	electronAbiTag := "abi" + strconv.Itoa(plan.Abi)
+	var napiPrebuild string
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".node") {
+			continue
+		}
+
+		tags := strings.Split(strings.TrimSuffix(name, ".node"), ".")[1:]
+		isElectron := false
+		isAbi := false
+		isNapi := false
+		isMusl := false
+		for _, tag := range tags {
+			switch tag {
+			case "electron":
+				isElectron = true
+			case electronAbiTag:
+				isAbi = true
+			case "napi":
+				isNapi = true
+			case "musl":
+				isMusl = true
+			}
+		}
+
+		// Electron is linked against glibc
+		if isMusl {
+			continue
+		}
+		if isElectron && isAbi {
+			return filepath.Join(prebuildDir, name), nil
+		}
+		if isNapi && len(napiPrebuild) == 0 {
+			napiPrebuild = filepath.Join(prebuildDir, name)
+		}
+	}
+	return napiPrebuild, nil
+}
+
+// binary is built into build/Release by node-gyp or into module_path by node-pre-gyp
+func hasBuiltBinary(dir string) bool {
+	var isFound int32
+	err := fs.Walk(dir, 0, func(path string, info os.FileInfo) error {
+		if info.IsDir() && path != dir && (info.Name() == "node_modules" || info.Name() == "prebuilds") {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), ".node") {
+			atomic.StoreInt32(&isFound, 1)
+		}
+		return nil
+	})
+	return err == nil && atomic.LoadInt32(&isFound) == 1
+}
+
+func isExistingFile(file string) (bool, error) {
+	_, err := os.Stat(file)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, errors.WithStack(err)
+}
+
+func toNodePlatform(platform string) string {
+	switch platform {
+	case "":
+		return toNodePlatform(runtime.GOOS)
+	case "windows", "win":
+		return "win32"
+	case "mac", "macos":
+		return "darwin"
+	default:
+		return platform
+	}
+}
+
+func toNodeArch(arch string) string {
+	switch arch {
+	case "":
+		return toNodeArch(runtime.GOARCH)
+	case "amd64", "x86_64":
+		return "x64"
+	case "386", "x86":
+		return "ia32"
+	case "aarch64":
+		return "arm64"
+	case "arm", "armhf", "armv7":
+		return "armv7l"
+	default:
+		return arch
+	}
+}
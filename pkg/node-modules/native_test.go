@@ -0,0 +1,83 @@
+package node_modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPlanNativeModules(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "native-modules")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	writePackageJson(g, tmpDir, `{"name": "app", "dependencies": {"pure": "1.0.0", "gyp": "1.0.0", "prebuilt": "1.0.0", "napi": "1.0.0"}, "devDependencies": {"dev-native": "1.0.0"}}`)
+	nodeModules := filepath.Join(tmpDir, "node_modules")
+	writePackageJson(g, filepath.Join(nodeModules, "pure"), `{"name": "pure", "version": "1.0.0"}`)
+
+	gypDir := filepath.Join(nodeModules, "gyp")
+	writePackageJson(g, gypDir, `{"name": "gyp", "version": "1.0.0"}`)
+	g.Expect(ioutil.WriteFile(filepath.Join(gypDir, "binding.gyp"), []byte("{}"), 0644)).To(Succeed())
+
+	prebuiltDir := filepath.Join(nodeModules, "prebuilt")
+	writePackageJson(g, prebuiltDir, `{"name": "prebuilt", "version": "1.0.0", "gypfile": true}`)
+	g.Expect(os.MkdirAll(filepath.Join(prebuiltDir, "prebuilds", "linux-x64"), 0755)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(prebuiltDir, "prebuilds", "darwin-arm64"), 0755)).To(Succeed())
+	for _, name := range []string{"prebuilt.musl.electron.abi110.node", "prebuilt.glibc.electron.abi110.node", "prebuilt.node.abi110.node"} {
+		g.Expect(ioutil.WriteFile(filepath.Join(prebuiltDir, "prebuilds", "linux-x64", name), nil, 0644)).To(Succeed())
+	}
+	g.Expect(ioutil.WriteFile(filepath.Join(prebuiltDir, "prebuilds", "darwin-arm64", "prebuilt.napi.node"), nil, 0644)).To(Succeed())
+
+	napiDir := filepath.Join(nodeModules, "napi")
+	writePackageJson(g, napiDir, `{"name": "napi", "version": "1.0.0", "binary": {"napi_versions": [6]}}`)
+	g.Expect(os.MkdirAll(filepath.Join(napiDir, "lib", "binding"), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(napiDir, "lib", "binding", "napi.node"), nil, 0644)).To(Succeed())
+
+	writePackageJson(g, filepath.Join(nodeModules, "dev-native"), `{"name": "dev-native", "version": "1.0.0", "gypfile": true}`)
+
+	plan, err := PlanNativeModules(NativeModulesOptions{Dir: tmpDir, ElectronVersion: "v22.3.1", Platform: "linux", Arch: "amd64"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Abi).To(Equal(110))
+	g.Expect(plan.Platform).To(Equal("linux"))
+	g.Expect(plan.Arch).To(Equal("x64"))
+
+	isHost := plan.Platform == toNodePlatform("") && plan.Arch == toNodeArch("")
+	expectedNapi := NativeModule{Name: "napi", Version: "1.0.0", Dir: napiDir, IsNapi: true, Reason: "napi-built"}
+	expectedRebuild := []string{"gyp"}
+	if !isHost {
+		expectedNapi.NeedsRebuild = true
+		expectedNapi.Reason = "no-prebuild"
+		expectedRebuild = []string{"gyp", "napi"}
+	}
+	g.Expect(plan.Modules).To(Equal([]NativeModule{
+		{Name: "gyp", Version: "1.0.0", Dir: gypDir, HasBindingGyp: true, NeedsRebuild: true, Reason: "no-prebuild"},
+		expectedNapi,
+		{Name: "prebuilt", Version: "1.0.0", Dir: prebuiltDir, HasBindingGyp: true, Prebuild: filepath.Join(prebuiltDir, "prebuilds", "linux-x64", "prebuilt.glibc.electron.abi110.node"), Reason: "prebuild"},
+	}))
+	g.Expect(plan.Rebuild).To(Equal(expectedRebuild))
+
+	// node ABI prebuild is not used for Electron, N-API one is
+	plan, err = PlanNativeModules(NativeModulesOptions{Dir: tmpDir, ElectronVersion: "23.0.0", Platform: "linux", Arch: "x64"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Rebuild).To(ContainElement("prebuilt"))
+
+	plan, err = PlanNativeModules(NativeModulesOptions{Dir: tmpDir, ElectronVersion: "23.0.0", Platform: "mac", Arch: "arm64"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Platform).To(Equal("darwin"))
+	g.Expect(plan.Rebuild).NotTo(ContainElement("prebuilt"))
+
+	_, err = PlanNativeModules(NativeModulesOptions{Dir: tmpDir, ElectronVersion: "1.0.0"})
+	g.Expect(err).To(HaveOccurred())
+
+	plan, err = PlanNativeModules(NativeModulesOptions{Dir: tmpDir, ElectronVersion: "1.0.0", Abi: 110, Platform: "linux", Arch: "x64"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Rebuild).NotTo(ContainElement("prebuilt"))
+}
@@ -0,0 +1,549 @@
+package node_modules
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// DefaultJunkPatterns are not required at runtime. Pattern with leading slash is matched against the path relative to the package dir,
+// pattern without slash is matched against the name of file or dir at any depth.
+var DefaultJunkPatterns = []string{
+	// tests, examples and docs in the package root (nested dirs with such names can be used at runtime)
+	"/test", "/tests", "/__tests__", "/powered-test", "/example", "/examples", "/doc", "/docs", "/coverage", "/.github",
+	"/README", "/readme", "/CHANGELOG", "/HISTORY",
+	"*.md", "*.markdown", "*.map", "*.d.ts", "*.tsbuildinfo",
+	".DS_Store", ".git", ".gitignore", ".gitattributes", ".npmignore", ".editorconfig", ".eslintrc*", ".prettierrc*", ".nyc_output",
+	".travis.yml", "appveyor.yml", "circle.yml", "npm-debug.log", "yarn.lock", ".yarn-integrity", ".yarn-metadata.json",
+	"__pycache__", "*.pyc", "*.o", "*.obj", "*.iml",
+}
+
+type PruneOptions struct {
+	// app dir with node_modules to prune
+	Dir string
+	// output of node-dep-tree (grouped or flat), packages not listed are removed
+	Tree []byte
+	// dir node-dep-tree was computed for (e.g. project dir, if stage copy is pruned), Dir if not specified
+	TreeDir string
+
+	JunkPatterns []string
+	// identical copies of the same package version (e.g. nested node_modules) are replaced by hard links
+	IsDedupe bool
+	// compute result without removing or linking anything
+	IsDryRun bool
+}
+
+type PruneResult struct {
+	// removed packages not listed in the dependency tree (devDependencies), relative to dir
+	DevPackages []string `json:"devPackages"`
+	JunkFiles   int      `json:"junkFiles"`
+	// package dirs which files are replaced by hard links to identical copy
+	DedupedPackages []string `json:"dedupedPackages"`
+
+	DevBytes       int64 `json:"devBytes"`
+	JunkBytes      int64 `json:"junkBytes"`
+	DedupedBytes   int64 `json:"dedupedBytes"`
+	ReclaimedBytes int64 `json:"reclaimedBytes"`
+}
+
+// grouped (dir and dependency names) and flat (name, version and real dir) formats of node-dep-tree output
+type treeEntry struct {
+	Dir  string   `json:"dir"`
+	Deps []string `json:"deps"`
+	Name string   `json:"name"`
+}
+
+type packageDir struct {
+	path      string
+	isSymlink bool
+}
+
+func ConfigurePruneCommand(app *kingpin.Application) {
+	command := app.Command("prune", "Remove packages not listed in the dependency tree (devDependencies), strip files not required at runtime and hard link identical packages.")
+	dir := command.Flag("dir", "The app dir with node_modules.").Required().String()
+	treeFile := command.Flag("tree", "The node-dep-tree output file, computed for the app dir if not specified.").String()
+	treeDir := command.Flag("tree-dir", "The dir node-dep-tree output is computed for, app dir by default.").String()
+	junkPatterns := command.Flag("junk", "The pattern of files to strip (leading slash - relative to package dir, otherwise file name).").Strings()
+	isDefaultJunk := command.Flag("default-junk", "Strip tests, docs, source maps and other files not required at runtime.").Default("true").Bool()
+	isDedupe := command.Flag("dedupe", "Hard link identical copies of the same package version.").Default("true").Bool()
+	isDryRun := command.Flag("dry-run", "Report reclaimed bytes without changing anything.").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		options := PruneOptions{
+			Dir:      *dir,
+			TreeDir:  *treeDir,
+			IsDedupe: *isDedupe,
+			IsDryRun: *isDryRun,
+		}
+
+		if *isDefaultJunk {
+			options.JunkPatterns = append(options.JunkPatterns, DefaultJunkPatterns...)
+		}
+		options.JunkPatterns = append(options.JunkPatterns, *junkPatterns...)
+
+		if len(*treeFile) != 0 {
+			data, err := ioutil.ReadFile(*treeFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			options.Tree = data
+		}
+
+		result, err := Prune(options)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// Prune removes devDependencies, then strips junk of the remaining packages and dedupes them.
+// Symlinked packages (pnpm, workspaces) are never changed - only the link is removed if package is not required.
+func Prune(options PruneOptions) (*PruneResult, error) {
+	dir, err := filepath.Abs(options.Dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	requiredPackages, err := readRequiredPackages(dir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []packageDir
+	err = collectPackageDirs(filepath.Join(dir, "node_modules"), &packages)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{DevPackages: []string{}, DedupedPackages: []string{}}
+	var keptPackages []packageDir
+	for _, pkg := range packages {
+		relativePath, err := filepath.Rel(dir, pkg.path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if requiredPackages[relativePath] {
+			keptPackages = append(keptPackages, pkg)
+			continue
+		}
+
+		// nested packages of removed package are removed too
+		if isInRemovedPackage(relativePath, result.DevPackages) {
+			continue
+		}
+
+		result.DevPackages = append(result.DevPackages, relativePath)
+		if !pkg.isSymlink {
+			size, err := dirSize(pkg.path)
+			if err != nil {
+				return nil, err
+			}
+			result.DevBytes += size
+		}
+
+		if !options.IsDryRun {
+			err = os.RemoveAll(pkg.path)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+
+	err = stripJunk(keptPackages, options, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.IsDedupe {
+		err = dedupePackages(dir, keptPackages, options, result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.ReclaimedBytes = result.DevBytes + result.JunkBytes + result.DedupedBytes
+	log.WithFields(log.Fields{
+		"devPackages":     len(result.DevPackages),
+		"junkFiles":       result.JunkFiles,
+		"dedupedPackages": len(result.DedupedPackages),
+		"reclaimedBytes":  result.ReclaimedBytes,
+	}).Debug("node_modules pruned")
+	return result, nil
+}
+
+// required package paths relative to the tree dir (so, tree computed for project dir can be applied to stage dir)
+func readRequiredPackages(dir string, options PruneOptions) (map[string]bool, error) {
+	treeDir := dir
+	if len(options.TreeDir) != 0 {
+		var err error
+		treeDir, err = filepath.Abs(options.TreeDir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var entries []treeEntry
+	if len(options.Tree) == 0 {
+		collector := &Collector{
+			unresolvedDependencies:       make(map[string]bool),
+			NodeModuleDirToDependencyMap: make(map[string]*map[string]*Dependency),
+		}
+		dependency, err := readPackageJson(treeDir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		dependency.dir = treeDir
+		err = collector.readDependencyTree(dependency)
+		if err != nil {
+			return nil, err
+		}
+
+		for nodeModulesDir, nameToDependency := range collector.NodeModuleDirToDependencyMap {
+			entry := treeEntry{Dir: nodeModulesDir}
+			for name := range *nameToDependency {
+				entry.Deps = append(entry.Deps, name)
+			}
+			entries = append(entries, entry)
+		}
+	} else {
+		err := json.Unmarshal(options.Tree, &entries)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse dependency tree")
+		}
+	}
+
+	result := make(map[string]bool)
+	add := func(packageDir string) error {
+		if !filepath.IsAbs(packageDir) {
+			packageDir = filepath.Join(treeDir, packageDir)
+		}
+		relativePath, err := filepath.Rel(treeDir, packageDir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		result[relativePath] = true
+		return nil
+	}
+
+	for _, entry := range entries {
+		var err error
+		if len(entry.Name) != 0 && len(entry.Deps) == 0 {
+			err = add(entry.Dir)
+		} else {
+			for _, name := range entry.Deps {
+				err = add(filepath.Join(entry.Dir, name))
+				if err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// packages of node_modules dir (scoped too) and nested node_modules of packages, parent before nested, dirs starting with dot (.bin, .pnpm) are not checked
+func collectPackageDirs(nodeModulesDir string, result *[]packageDir) error {
+	names, err := readDirNames(nodeModulesDir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if strings.HasPrefix(name, "@") {
+			scopeDir := filepath.Join(nodeModulesDir, name)
+			scopedNames, err := readDirNames(scopeDir)
+			if err != nil {
+				return err
+			}
+			for _, scopedName := range scopedNames {
+				err = addPackageDir(filepath.Join(scopeDir, scopedName), result)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err = addPackageDir(filepath.Join(nodeModulesDir, name), result)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addPackageDir(dir string, result *[]packageDir) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		*result = append(*result, packageDir{path: dir, isSymlink: true})
+		return nil
+	}
+	if !info.IsDir() {
+		return nil
+	}
+
+	*result = append(*result, packageDir{path: dir})
+	return collectPackageDirs(filepath.Join(dir, "node_modules"), result)
+}
+
+// sorted, empty if dir doesn't exist
+func readDirNames(dir string) ([]string, error) {
+	file, err := os.Open(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(file)
+
+	names, err := file.Readdirnames(-1)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func isInRemovedPackage(relativePath string, removedPackages []string) bool {
+	for _, removed := range removedPackages {
+		if strings.HasPrefix(relativePath, removed+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isJunk(relativePath string, name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		var isMatched bool
+		if strings.HasPrefix(pattern, "/") {
+			isMatched, _ = filepath.Match(pattern[1:], filepath.ToSlash(relativePath))
+		} else {
+			isMatched, _ = filepath.Match(pattern, name)
+		}
+		if isMatched {
+			return true
+		}
+	}
+	return false
+}
+
+func stripJunk(packages []packageDir, options PruneOptions, result *PruneResult) error {
+	if len(options.JunkPatterns) == 0 {
+		return nil
+	}
+
+	var mutex sync.Mutex
+	var junkFiles []string
+	var junkBytes int64
+	for _, pkg := range packages {
+		if pkg.isSymlink {
+			continue
+		}
+
+		err := fs.Walk(pkg.path, 0, func(path string, info os.FileInfo) error {
+			if path == pkg.path {
+				return nil
+			}
+			// nested packages are checked separately
+			if info.IsDir() && info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+
+			relativePath, err := filepath.Rel(pkg.path, path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if relativePath == "package.json" || !isJunk(relativePath, info.Name(), options.JunkPatterns) {
+				return nil
+			}
+
+			size := info.Size()
+			if info.IsDir() {
+				size, err = dirSize(path)
+				if err != nil {
+					return err
+				}
+			} else if !info.Mode().IsRegular() {
+				size = 0
+			}
+			atomic.AddInt64(&junkBytes, size)
+
+			mutex.Lock()
+			junkFiles = append(junkFiles, path)
+			mutex.Unlock()
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	result.JunkFiles = len(junkFiles)
+	result.JunkBytes = junkBytes
+	if options.IsDryRun {
+		return nil
+	}
+
+	for _, file := range junkFiles {
+		err := os.RemoveAll(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// packages of the same name and version are deduped only if tree hash is the same (package can be patched)
+func dedupePackages(dir string, packages []packageDir, options PruneOptions, result *PruneResult) error {
+	idToPackages := make(map[string][]string)
+	var ids []string
+	for _, pkg := range packages {
+		if pkg.isSymlink {
+			continue
+		}
+
+		dependency, err := readPackageJson(pkg.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+
+		id := dependency.Name + "@" + dependency.Version
+		if idToPackages[id] == nil {
+			ids = append(ids, id)
+		}
+		idToPackages[id] = append(idToPackages[id], pkg.path)
+	}
+
+	for _, id := range ids {
+		paths := idToPackages[id]
+		if len(paths) < 2 {
+			continue
+		}
+
+		digests := make([]string, len(paths))
+		for index, path := range paths {
+			dirHash, err := fs.HashDir(path, fs.HashOptions{Algorithm: "sha256"})
+			if err != nil {
+				return err
+			}
+			digests[index] = dirHash.Digest
+		}
+
+		// the first (the least nested) copy is kept
+		for index := 1; index < len(paths); index++ {
+			if digests[index] != digests[0] {
+				log.WithFields(log.Fields{"package": id, "dir": paths[index]}).Debug("package differs from the first copy, not deduped")
+				continue
+			}
+
+			linkedBytes, err := linkIdenticalFiles(paths[0], paths[index], options)
+			if err != nil {
+				return err
+			}
+			if linkedBytes == 0 {
+				continue
+			}
+
+			relativePath, err := filepath.Rel(dir, paths[index])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			result.DedupedPackages = append(result.DedupedPackages, relativePath)
+			result.DedupedBytes += linkedBytes
+		}
+	}
+	return nil
+}
+
+// files of duplicate are replaced by hard links to files of the same relative path in original, already linked files are not counted
+// (junk is skipped - in dry-run mode it is not removed, but must not be counted twice)
+func linkIdenticalFiles(original string, duplicate string, options PruneOptions) (int64, error) {
+	var linkedBytes int64
+	err := fs.Walk(duplicate, 0, func(path string, info os.FileInfo) error {
+		if path == duplicate {
+			return nil
+		}
+		if info.IsDir() && info.Name() == "node_modules" {
+			return filepath.SkipDir
+		}
+
+		relativePath, err := filepath.Rel(duplicate, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if isJunk(relativePath, info.Name(), options.JunkPatterns) {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		originalFile := filepath.Join(original, relativePath)
+		originalInfo, err := os.Stat(originalFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if os.SameFile(originalInfo, info) {
+			return nil
+		}
+
+		if !options.IsDryRun {
+			// link is created under temp name and renamed, so, file is never missing
+			tempFile := path + ".prune-link"
+			err = os.Link(originalFile, tempFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			err = fs.RenameWithRetry(tempFile, path)
+			if err != nil {
+				_ = os.Remove(tempFile)
+				return err
+			}
+		}
+		atomic.AddInt64(&linkedBytes, info.Size())
+		return nil
+	})
+	return linkedBytes, err
+}
+
+func dirSize(dir string) (int64, error) {
+	var result int64
+	err := fs.Walk(dir, 0, func(path string, info os.FileInfo) error {
+		if info.Mode().IsRegular() {
+			atomic.AddInt64(&result, info.Size())
+		}
+		return nil
+	})
+	return result, err
+}
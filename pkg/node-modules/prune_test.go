@@ -0,0 +1,105 @@
+package node_modules
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func writePackage(g *GomegaWithT, dir string, content string) {
+	writePackageJson(g, dir, content)
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "index.js"), []byte("module.exports = 42"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "index.js.map"), []byte("{}"), 0644)).NotTo(HaveOccurred())
+	g.Expect(os.MkdirAll(filepath.Join(dir, "test"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "test", "test.js"), []byte("test"), 0644)).NotTo(HaveOccurred())
+	g.Expect(os.MkdirAll(filepath.Join(dir, "lib", "test"), 0755)).NotTo(HaveOccurred())
+}
+
+func createPruneFixture(g *GomegaWithT, tmpDir string) {
+	writePackageJson(g, tmpDir, `{"name": "app", "dependencies": {"a": "1.0.0", "b": "1.0.0"}, "devDependencies": {"dev": "1.0.0"}}`)
+	nodeModules := filepath.Join(tmpDir, "node_modules")
+	writePackage(g, filepath.Join(nodeModules, "a"), `{"name": "a", "version": "1.0.0", "dependencies": {"shared": "2.0.0"}}`)
+	writePackage(g, filepath.Join(nodeModules, "b"), `{"name": "b", "version": "1.0.0", "dependencies": {"@scope/shared": "2.0.0"}}`)
+	writePackage(g, filepath.Join(nodeModules, "a", "node_modules", "shared"), `{"name": "shared", "version": "2.0.0"}`)
+	writePackage(g, filepath.Join(nodeModules, "b", "node_modules", "@scope", "shared"), `{"name": "shared", "version": "2.0.0"}`)
+	writePackage(g, filepath.Join(nodeModules, "dev"), `{"name": "dev", "version": "1.0.0", "dependencies": {"nested": "1.0.0"}}`)
+	writePackage(g, filepath.Join(nodeModules, "dev", "node_modules", "nested"), `{"name": "nested", "version": "1.0.0"}`)
+}
+
+func TestPrune(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "prune")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	createPruneFixture(g, tmpDir)
+	nodeModules := filepath.Join(tmpDir, "node_modules")
+
+	result, err := Prune(PruneOptions{Dir: tmpDir, JunkPatterns: DefaultJunkPatterns, IsDedupe: true, IsDryRun: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(filepath.Join(nodeModules, "dev")).To(BeADirectory())
+	g.Expect(filepath.Join(nodeModules, "a", "index.js.map")).To(BeAnExistingFile())
+
+	g.Expect(result.DevPackages).To(Equal([]string{filepath.Join("node_modules", "dev")}))
+	g.Expect(result.DevBytes).To(Equal(int64(160)))
+	// index.js.map and test dir of 4 kept packages
+	g.Expect(result.JunkFiles).To(Equal(8))
+	g.Expect(result.JunkBytes).To(Equal(int64(4 * (2 + 4))))
+	// package.json and index.js
+	g.Expect(result.DedupedPackages).To(Equal([]string{filepath.Join("node_modules", "b", "node_modules", "@scope", "shared")}))
+	g.Expect(result.DedupedBytes).To(Equal(int64(38 + 19)))
+	g.Expect(result.ReclaimedBytes).To(Equal(int64(160 + 24 + 57)))
+
+	dryRunResult := result
+	result, err = Prune(PruneOptions{Dir: tmpDir, JunkPatterns: DefaultJunkPatterns, IsDedupe: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal(dryRunResult))
+
+	g.Expect(filepath.Join(nodeModules, "dev")).NotTo(BeAnExistingFile())
+	g.Expect(filepath.Join(nodeModules, "a", "index.js.map")).NotTo(BeAnExistingFile())
+	g.Expect(filepath.Join(nodeModules, "a", "test")).NotTo(BeAnExistingFile())
+	// not in the package root
+	g.Expect(filepath.Join(nodeModules, "a", "lib", "test")).To(BeADirectory())
+	g.Expect(filepath.Join(nodeModules, "a", "index.js")).To(BeAnExistingFile())
+
+	original, err := os.Stat(filepath.Join(nodeModules, "a", "node_modules", "shared", "index.js"))
+	g.Expect(err).NotTo(HaveOccurred())
+	duplicate, err := os.Stat(filepath.Join(nodeModules, "b", "node_modules", "@scope", "shared", "index.js"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.SameFile(original, duplicate)).To(BeTrue())
+
+	// nothing to do
+	result, err = Prune(PruneOptions{Dir: tmpDir, JunkPatterns: DefaultJunkPatterns, IsDedupe: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.ReclaimedBytes).To(Equal(int64(0)))
+}
+
+func TestPruneUsingTree(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "prune")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// tree is computed for the project dir, stage copy is pruned
+	projectDir := filepath.Join(tmpDir, "project")
+	stageDir := filepath.Join(tmpDir, "stage")
+	createPruneFixture(g, projectDir)
+	createPruneFixture(g, stageDir)
+
+	tree := `[{"dir": "` + filepath.ToSlash(filepath.Join(projectDir, "node_modules")) + `", "deps": ["a"]}, {"name": "shared", "version": "2.0.0", "dir": "node_modules/a/node_modules/shared"}]`
+	result, err := Prune(PruneOptions{Dir: stageDir, Tree: []byte(tree), TreeDir: projectDir})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.DevPackages).To(Equal([]string{filepath.Join("node_modules", "b"), filepath.Join("node_modules", "dev")}))
+	g.Expect(result.JunkFiles).To(Equal(0))
+	g.Expect(filepath.Join(stageDir, "node_modules", "a", "node_modules", "shared")).To(BeADirectory())
+	g.Expect(filepath.Join(stageDir, "node_modules", "b")).NotTo(BeAnExistingFile())
+	g.Expect(filepath.Join(projectDir, "node_modules", "b")).To(BeADirectory())
+
+	_, err = Prune(PruneOptions{Dir: stageDir, Tree: []byte("{")})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -14,11 +14,13 @@ import (
 	"github.com/json-iterator/go"
 )
 
+// installed packages are walked (node_modules layout of npm, yarn and pnpm is supported), lock files (package-lock.json, pnpm-lock.yaml, yarn.lock) are not read
 func ConfigureCommand(app *kingpin.Application) {
 	command := app.Command("node-dep-tree", "")
 
 	dir := command.Flag("dir", "").Required().String()
 	excludedDependencies := command.Flag("exclude-dep", "").Strings()
+	isFlat := command.Flag("flatten", "output flat list of dependencies (name, version and real dir) instead of dependency names grouped by node_modules dir").Bool()
 
 	command.Action(func(context *kingpin.ParseContext) error {
 		var excluded map[string]bool
@@ -48,7 +50,11 @@ func ConfigureCommand(app *kingpin.Application) {
 		}
 
 		jsonWriter := jsoniter.NewStream(jsoniter.ConfigDefault, os.Stdout, 32*1024)
-		writeResult(jsonWriter, collector)
+		if *isFlat {
+			writeFlatResult(jsonWriter, collector)
+		} else {
+			writeResult(jsonWriter, collector)
+		}
 		err = jsonWriter.Flush()
 		if err != nil {
 			return errors.WithStack(err)
@@ -93,6 +99,41 @@ func writeResult(jsonWriter *jsoniter.Stream, collector *Collector) {
 	jsonWriter.WriteArrayEnd()
 }
 
+// the same package can be referenced from several node_modules dirs (pnpm, workspaces), it is listed only once
+func writeFlatResult(jsonWriter *jsoniter.Stream, collector *Collector) {
+	dirToDependency := make(map[string]*Dependency)
+	for _, nameToDependency := range collector.NodeModuleDirToDependencyMap {
+		for _, dependency := range *nameToDependency {
+			dirToDependency[dependency.realDir] = dependency
+		}
+	}
+
+	dirs := make([]string, 0, len(dirToDependency))
+	for dir := range dirToDependency {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return pathSorter(strings.Split(dirs[i], string(filepath.Separator)), strings.Split(dirs[j], string(filepath.Separator)))
+	})
+
+	jsonWriter.WriteArrayStart()
+	for index, dir := range dirs {
+		if index != 0 {
+			jsonWriter.WriteMore()
+		}
+
+		dependency := dirToDependency[dir]
+		jsonWriter.WriteObjectStart()
+		util.WriteStringProperty("name", dependency.Name, jsonWriter)
+		jsonWriter.WriteMore()
+		util.WriteStringProperty("version", dependency.Version, jsonWriter)
+		jsonWriter.WriteMore()
+		util.WriteStringProperty("dir", dir, jsonWriter)
+		jsonWriter.WriteObjectEnd()
+	}
+	jsonWriter.WriteArrayEnd()
+}
+
 func pathSorter(a []string, b []string) bool {
 	aL := len(a)
 	l := aL
@@ -157,6 +198,16 @@ type Dependency struct {
 	OptionalDependencies map[string]string `json:"optionalDependencies"`
 
 	dir string
+	// differs from dir if package is a symlink (pnpm, workspaces), empty for the root package
+	realDir string
+}
+
+// dependencies of the linked package must be resolved relative to its real location (e.g. node_modules/.pnpm/foo@1.0.0/node_modules for pnpm)
+func (t *Dependency) resolvedDir() string {
+	if len(t.realDir) == 0 {
+		return t.dir
+	}
+	return t.realDir
 }
 
 type Collector struct {
@@ -174,7 +225,7 @@ func (t *Collector) readDependencyTree(dependency *Dependency) error {
 		return nil
 	}
 
-	nodeModuleDir, err := findNearestNodeModuleDir(dependency.dir)
+	nodeModuleDir, err := findNearestNodeModuleDir(dependency.resolvedDir())
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -328,8 +379,15 @@ func (t *Collector) resolveDependency(parentNodeModuleDir string, name string) (
 		dependencyNameToDependency = &m
 	}
 
+	// pnpm and workspaces use symlinks
+	realDependencyDir, err := filepath.EvalSymlinks(dependencyDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	(*dependencyNameToDependency)[name] = dependency
 	dependency.dir = dependencyDir
+	dependency.realDir = realDependencyDir
 	return dependency, nil
 }
 
@@ -0,0 +1,99 @@
+package node_modules
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/json-iterator/go"
+	. "github.com/onsi/gomega"
+)
+
+func writePackageJson(g *GomegaWithT, dir string, content string) {
+	g.Expect(os.MkdirAll(dir, 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "package.json"), []byte(content), 0644)).NotTo(HaveOccurred())
+}
+
+func collect(g *GomegaWithT, dir string) *Collector {
+	collector := &Collector{
+		unresolvedDependencies:       make(map[string]bool),
+		NodeModuleDirToDependencyMap: make(map[string]*map[string]*Dependency),
+	}
+	dependency, err := readPackageJson(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	dependency.dir = dir
+	g.Expect(collector.readDependencyTree(dependency)).NotTo(HaveOccurred())
+	return collector
+}
+
+// pnpm layout: direct dependencies are symlinks to node_modules/.pnpm/<name>@<version>/node_modules/<name>,
+// dependencies of package are siblings of the package in the .pnpm dir
+func TestPnpmLayout(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "node-dep-tree")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	writePackageJson(g, tmpDir, `{"name": "app", "dependencies": {"a": "1.0.0"}, "devDependencies": {"c": "1.0.0"}}`)
+
+	pnpmDir := filepath.Join(tmpDir, "node_modules", ".pnpm")
+	aDir := filepath.Join(pnpmDir, "a@1.0.0", "node_modules", "a")
+	bDir := filepath.Join(pnpmDir, "b@2.0.0", "node_modules", "b")
+	writePackageJson(g, aDir, `{"name": "a", "version": "1.0.0", "dependencies": {"b": "2.0.0"}}`)
+	writePackageJson(g, bDir, `{"name": "b", "version": "2.0.0"}`)
+	writePackageJson(g, filepath.Join(pnpmDir, "c@1.0.0", "node_modules", "c"), `{"name": "c", "version": "1.0.0"}`)
+	g.Expect(os.Symlink(filepath.Join(".pnpm", "a@1.0.0", "node_modules", "a"), filepath.Join(tmpDir, "node_modules", "a"))).NotTo(HaveOccurred())
+	g.Expect(os.Symlink(filepath.Join("..", "..", "b@2.0.0", "node_modules", "b"), filepath.Join(pnpmDir, "a@1.0.0", "node_modules", "b"))).NotTo(HaveOccurred())
+
+	collector := collect(g, tmpDir)
+	g.Expect(collector.unresolvedDependencies).To(BeEmpty())
+
+	buffer := new(bytes.Buffer)
+	jsonWriter := jsoniter.NewStream(jsoniter.ConfigDefault, buffer, 1024)
+	writeFlatResult(jsonWriter, collector)
+	g.Expect(jsonWriter.Flush()).NotTo(HaveOccurred())
+
+	var result []map[string]string
+	g.Expect(jsoniter.Unmarshal(buffer.Bytes(), &result)).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal([]map[string]string{
+		{"name": "a", "version": "1.0.0", "dir": aDir},
+		{"name": "b", "version": "2.0.0", "dir": bDir},
+	}))
+}
+
+// workspaces: dependencies are hoisted to the root node_modules, workspace package is a symlink
+func TestWorkspaceLayout(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "node-dep-tree")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	tmpDir, err = filepath.EvalSymlinks(tmpDir)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	writePackageJson(g, tmpDir, `{"name": "root", "private": true, "workspaces": ["packages/*"]}`)
+	appDir := filepath.Join(tmpDir, "packages", "app")
+	libDir := filepath.Join(tmpDir, "packages", "lib")
+	writePackageJson(g, appDir, `{"name": "app", "dependencies": {"lib": "1.0.0"}}`)
+	writePackageJson(g, libDir, `{"name": "lib", "version": "1.0.0", "dependencies": {"hoisted": "1.0.0"}}`)
+	writePackageJson(g, filepath.Join(tmpDir, "node_modules", "hoisted"), `{"name": "hoisted", "version": "1.0.0"}`)
+	g.Expect(os.Symlink(filepath.Join("..", "packages", "lib"), filepath.Join(tmpDir, "node_modules", "lib"))).NotTo(HaveOccurred())
+
+	collector := collect(g, appDir)
+	g.Expect(collector.unresolvedDependencies).To(BeEmpty())
+
+	rootDeps := collector.NodeModuleDirToDependencyMap[filepath.Join(tmpDir, "node_modules")]
+	g.Expect(rootDeps).NotTo(BeNil())
+	g.Expect(*rootDeps).To(HaveKey("lib"))
+	g.Expect(*rootDeps).To(HaveKey("hoisted"))
+	// dir is the path in node_modules (as before symlinks were resolved), dependencies are resolved relative to the real dir
+	g.Expect((*rootDeps)["lib"].dir).To(Equal(filepath.Join(tmpDir, "node_modules", "lib")))
+	g.Expect((*rootDeps)["lib"].realDir).To(Equal(libDir))
+}
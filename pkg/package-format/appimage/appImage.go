@@ -11,9 +11,13 @@ import (
 	"syscall"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
 	"github.com/develar/app-builder/pkg/blockmap"
 	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/linuxDesktop"
 	"github.com/develar/app-builder/pkg/linuxTools"
+	"github.com/develar/app-builder/pkg/preflight"
+	"github.com/develar/app-builder/pkg/squashfs"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/develar/go-fs-util"
@@ -28,9 +32,14 @@ type AppImageOptions struct {
 
 	template      *string
 	license       *string
+	runtime       *string
 	configuration *AppImageConfiguration
 
 	compression *string
+
+	updateInformation *string
+	isSign            *bool
+	signKey           *string
 }
 
 func ConfigureCommand(app *kingpin.Application) {
@@ -45,17 +54,30 @@ func ConfigureCommand(app *kingpin.Application) {
 
 		template: command.Flag("template", "The template file.").String(),
 		license:  command.Flag("license", "The license file.").String(),
+		runtime:  command.Flag("runtime", "The AppImage runtime file (e.g. runtime with zstd support), bundled runtime is used by default.").String(),
+
+		compression: command.Flag("compression", "The compression (zstd requires --runtime with zstd support and mksquashfs 4.4+).").Enum("xz", "gzip", "zstd"),
 
-		compression: command.Flag("compression", "The compression.").Enum("xz", "gzip"),
+		updateInformation: command.Flag("update-information", "The update information to embed (e.g. gh-releases-zsync|user|repo|latest|*.AppImage.zsync).").String(),
+		isSign:            command.Flag("sign", "Whether to sign AppImage using gpg.").Bool(),
+		signKey:           command.Flag("sign-key", "The gpg key id to sign, default key is used if not specified.").String(),
 	}
 
-	configuration := command.Flag("configuration", "").Required().String()
+	configuration := command.Flag("configuration", "The configuration (JSON or base64 encoded JSON).").String()
+	configurationFile := command.Flag("configuration-file", "The configuration file (JSON, JSON5, YAML or TOML), used instead of --configuration.").String()
 
 	isRemoveStage := util.ConfigureIsRemoveStageParam(command)
 
 	command.Action(func(context *kingpin.ParseContext) error {
 		var err error
-		if strings.HasPrefix(*configuration, "{") {
+		if len(*configurationFile) != 0 {
+			err = util.LoadConfig(*configurationFile, &options.configuration)
+			if err != nil {
+				return err
+			}
+		} else if len(*configuration) == 0 {
+			return errors.New("--configuration or --configuration-file must be specified")
+		} else if strings.HasPrefix(*configuration, "{") {
 			err = jsoniter.UnmarshalFromString(*configuration, &options.configuration)
 			if err != nil {
 				return err
@@ -74,7 +96,7 @@ func ConfigureCommand(app *kingpin.Application) {
 
 		err = AppImage(options)
 		if err != nil {
-			return errors.WithStack(err)
+			return preflight.WriteUserError(errors.WithStack(err))
 		}
 
 		if *isRemoveStage {
@@ -91,7 +113,23 @@ func ConfigureCommand(app *kingpin.Application) {
 func AppImage(options *AppImageOptions) error {
 	stageDir := *options.stageDir
 
-	err := writeAppLauncherAndRelatedFiles(options)
+	err := checkCompression(*options.compression, *options.runtime)
+	if err != nil {
+		return err
+	}
+
+	tempDir, err := util.DefaultTempDirManager.Root()
+	if err != nil {
+		return err
+	}
+
+	// app dir is hard linked into the stage dir and packed into squashfs image
+	err = preflight.CheckPackaging([]string{*options.appDir}, stageDir, tempDir, *options.output)
+	if err != nil {
+		return err
+	}
+
+	err = writeAppLauncherAndRelatedFiles(options)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -121,7 +159,21 @@ func AppImage(options *AppImageOptions) error {
 		return errors.WithStack(err)
 	}
 
-	runtimeData, err := ioutil.ReadFile(filepath.Join(appImageToolDir, "runtime-"+arch))
+	// broken Exec or Icon is not fatal for AppImage itself, but desktop integration (appimaged, AppImageLauncher) will not work
+	desktopFile := filepath.Join(stageDir, options.configuration.ExecutableName+".desktop")
+	problems, err := linuxDesktop.ValidateDesktopFile(desktopFile, stageDir, filepath.Join(stageDir, iconDirRelativePath))
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		log.WithField("file", desktopFile).Warn(problem)
+	}
+
+	runtimeFile := *options.runtime
+	if len(runtimeFile) == 0 {
+		runtimeFile = filepath.Join(appImageToolDir, "runtime-"+arch)
+	}
+	runtimeData, err := ioutil.ReadFile(runtimeFile)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -136,6 +188,21 @@ func AppImage(options *AppImageOptions) error {
 		return errors.WithStack(err)
 	}
 
+	if len(*options.updateInformation) != 0 {
+		err = writeUpdateInformation(outputFile, runtimeData, *options.updateInformation)
+		if err != nil {
+			return err
+		}
+	}
+
+	// signature covers update information, so, sign after
+	if *options.isSign {
+		err = signAppImage(outputFile, runtimeData, *options.signKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = os.Chmod(outputFile, 0755)
 	if err != nil {
 		return errors.WithStack(err)
@@ -165,6 +232,25 @@ func writeRuntimeData(filePath string, runtimeData []byte) error {
 }
 
 func createSquashFs(options *AppImageOptions, offset int) error {
+	if util.IsEnvTrue("USE_BUILTIN_SQUASHFS") {
+		timestamp, err := squashfs.DefaultTimestamp()
+		if err != nil {
+			return err
+		}
+
+		squashfsOptions := &squashfs.Options{
+			Sources:     []string{*options.stageDir},
+			Output:      *options.output,
+			Offset:      int64(offset),
+			Compression: *options.compression,
+			Timestamp:   timestamp,
+		}
+		if *options.compression == "xz" || *options.compression == "zstd" {
+			squashfsOptions.BlockSize = 1024 * 1024
+		}
+		return squashfs.Create(util.RootContext(), squashfsOptions)
+	}
+
 	mksquashfsPath, err := linuxTools.GetMksquashfs()
 	if err != nil {
 		return errors.WithStack(err)
@@ -180,6 +266,13 @@ func createSquashFs(options *AppImageOptions, offset int) error {
 		if *options.compression == "xz" {
 			//noinspection SpellCheckingInspection
 			args = append(args, "-Xdict-size", "100%", "-b", "1048576")
+		} else if *options.compression == "zstd" {
+			err = checkMksquashfsCompressor(mksquashfsPath, "zstd")
+			if err != nil {
+				return err
+			}
+			// level 19 - decompression speed is the same, size is comparable to xz
+			args = append(args, "-Xcompression-level", "19", "-b", "1048576")
 		}
 	}
 
@@ -190,3 +283,51 @@ func createSquashFs(options *AppImageOptions, offset int) error {
 
 	return nil
 }
+
+// bundled runtime (squashfuse) supports only gzip and xz, image compressed using zstd cannot be mounted by it
+func checkCompression(compression string, runtimeFile string) error {
+	if compression == "zstd" && len(runtimeFile) == 0 {
+		return util.NewMessageError("zstd compression requires runtime with zstd support, please specify it using --runtime", "ERR_APPIMAGE_ZSTD_RUNTIME")
+	}
+	return nil
+}
+
+// zstd requires mksquashfs 4.4+ built with zstd support, otherwise option is rejected or ignored depending on version
+func checkMksquashfsCompressor(mksquashfsPath string, compression string) error {
+	// usage (printed for unknown option) lists compressors, exit code is not zero
+	output, _ := exec.Command(mksquashfsPath, "-help").CombinedOutput()
+	for _, name := range parseMksquashfsCompressors(output) {
+		if name == compression {
+			return nil
+		}
+	}
+	return util.NewMessageError(mksquashfsPath+" doesn't support "+compression+" compression, please use mksquashfs 4.4+ (MKSQUASHFS_PATH env)", "ERR_APPIMAGE_MKSQUASHFS_COMPRESSOR")
+}
+
+// compressors are listed after "Compressors available" line, one per line indented by single tab, options - by more than one
+func parseMksquashfsCompressors(output []byte) []string {
+	var result []string
+	isCompressorList := false
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "Compressors available") {
+			isCompressorList = true
+			continue
+		}
+		if !isCompressorList || len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(line, "\t") {
+			// next section
+			break
+		}
+		if strings.HasPrefix(line, "\t\t") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 0 && !strings.HasPrefix(fields[0], "-") {
+			result = append(result, fields[0])
+		}
+	}
+	return result
+}
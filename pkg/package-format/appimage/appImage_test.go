@@ -0,0 +1,46 @@
+package appimage
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kingpin"
+	. "github.com/onsi/gomega"
+)
+
+func TestZstdCompressionRequiresRuntime(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	app := kingpin.New("app-builder", "")
+	ConfigureCommand(app)
+
+	_, err := app.Parse([]string{"appimage", "--app", "app", "--stage", "stage", "--output", "out.AppImage", "--compression", "zstd", "--configuration", "{}"})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("--runtime"))
+
+	_, err = app.Parse([]string{"appimage", "--app", "app", "--stage", "stage", "--output", "out.AppImage", "--compression", "lz4", "--configuration", "{}"})
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(checkCompression("zstd", "runtime-x64")).NotTo(HaveOccurred())
+	g.Expect(checkCompression("xz", "")).NotTo(HaveOccurred())
+}
+
+func TestParseMksquashfsCompressors(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	output := "SYNTAX:mksquashfs source1 source2 ...  dest [options]\n\n" +
+		"Filesystem build options:\n" +
+		"-comp <comp>\t\tselect <comp> compression\n\n" +
+		"Compressors available and compressor specific options:\n" +
+		"\tgzip (default)\n" +
+		"\t  -Xcompression-level <compression-level>\n" +
+		"\t\t<compression-level> should be 1 .. 9 (default 9)\n" +
+		"\txz\n" +
+		"\t  -Xbcj filter1,filter2,...,filterN\n" +
+		"\tzstd\n" +
+		"\t  -Xcompression-level <compression-level>\n\n" +
+		"Environment:\n" +
+		"\tSOURCE_DATE_EPOCH\n"
+	g.Expect(parseMksquashfsCompressors([]byte(output))).To(Equal([]string{"gzip", "xz", "zstd"}))
+
+	g.Expect(parseMksquashfsCompressors([]byte("Compressors available:\n\tgzip (default)\n\txz\n"))).To(Equal([]string{"gzip", "xz"}))
+}
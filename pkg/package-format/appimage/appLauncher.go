@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/linuxDesktop"
 	"github.com/develar/app-builder/pkg/package-format"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
@@ -64,7 +65,7 @@ func copyIcons(options *AppImageOptions) ([]IconTemplateInfo, error) {
 		var iconSizeDir string
 		if iconExtWithDot == ".svg" {
 			// https://bugs.freedesktop.org/show_bug.cgi?id=91759
-			iconSizeDir = "scalable"
+			iconSizeDir = "scalable/apps"
 		} else {
 			iconSizeDir = fmt.Sprintf("%dx%d/apps", icon.Size, icon.Size)
 		}
@@ -123,43 +124,26 @@ func (f *fakeFileInfo) Mode() os.FileMode {
 }
 
 func copyMimeTypes(options *AppImageOptions) (string, error) {
-	var mimeTypes strings.Builder
+	var mimeTypes []linuxDesktop.MimeType
 	for _, fileAssociation := range options.configuration.FileAssociations {
 		if fileAssociation.MimeType != "" {
-			mimeTypes.WriteString("<mime-type type=\"")
-			mimeTypes.WriteString(fileAssociation.MimeType)
-			mimeTypes.WriteString("\">\n")
-
-			mimeTypes.WriteString("  <comment>")
-			mimeTypes.WriteString(options.configuration.ProductName)
-			mimeTypes.WriteString(" document</comment>\n")
-
-			mimeTypes.WriteString("  <glob pattern=\"*.")
-			mimeTypes.WriteString(fileAssociation.Ext)
-			mimeTypes.WriteString("\"/>\n")
-
-			mimeTypes.WriteString("  <generic-icon name=\"x-office-document\"/>\n")
-
-			mimeTypes.WriteString("</mime-type>\n")
+			mimeTypes = append(mimeTypes, linuxDesktop.MimeType{
+				Type:    fileAssociation.MimeType,
+				Comment: options.configuration.ProductName + " document",
+				Globs:   []string{"*." + fileAssociation.Ext},
+			})
 		}
 	}
 
 	// if no mime-types specified, return
-	if mimeTypes.Len() == 0 {
+	if len(mimeTypes) == 0 {
 		return "", nil
 	}
 
-	mimeTypeDir := filepath.Join(*options.stageDir, mimeTypeDirRelativePath)
 	fileName := options.configuration.ExecutableName + ".xml"
-	mimeTypeFile := filepath.Join(mimeTypeDir, fileName)
-	err := fsutil.EnsureDir(mimeTypeDir)
-	if err != nil {
-		return "", errors.WithStack(err)
-	}
-
-	err = ioutil.WriteFile(mimeTypeFile, []byte("<?xml version=\"1.0\"?>\n<mime-info xmlns=\"http://www.freedesktop.org/standards/shared-mime-info\">\n"+mimeTypes.String()+"\n</mime-info>"), 0666)
+	err := linuxDesktop.WriteMimeInfo(filepath.Join(*options.stageDir, mimeTypeDirRelativePath, fileName), mimeTypes)
 	if err != nil {
-		return "", errors.WithStack(err)
+		return "", err
 	}
 
 	return mimeTypeDirRelativePath + "/" + fileName, nil
@@ -167,7 +151,12 @@ func copyMimeTypes(options *AppImageOptions) (string, error) {
 
 func writeDesktopFile(options *AppImageOptions) (string, error) {
 	fileName := options.configuration.ExecutableName + ".desktop"
-	err := ioutil.WriteFile(filepath.Join(*options.stageDir, fileName), []byte(options.configuration.DesktopEntry+"X-AppImage-BuildId="+ksuid.New().String()+"\n"), 0666)
+	desktopEntry := options.configuration.DesktopEntry + "X-AppImage-BuildId=" + ksuid.New().String() + "\n"
+	// desktop integration tools (appimaged, AppImageLauncher) show version and use update information
+	if len(options.configuration.Version) != 0 {
+		desktopEntry += "X-AppImage-Version=" + options.configuration.Version + "\n"
+	}
+	err := ioutil.WriteFile(filepath.Join(*options.stageDir, fileName), []byte(desktopEntry), 0666)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -4,6 +4,7 @@ type AppImageConfiguration struct {
 	ProductName       string `json:"productName"`
 	ExecutableName    string `json:"executableName"`
 	SystemIntegration string `json:"systemIntegration"`
+	Version           string `json:"version"`
 
 	DesktopEntry string `json:"desktopEntry"`
 
@@ -0,0 +1,160 @@
+package appimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/codesign/gpg"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// sections reserved by type 2 runtime (https://github.com/AppImage/AppImageSpec/blob/master/draft.md#type-2-image-format)
+const (
+	updateInfoSection = ".upd_info"
+	signatureSection  = ".sha256_sig"
+	signKeySection    = ".sig_key"
+)
+
+type runtimeSection struct {
+	name   string
+	offset int64
+	size   int64
+}
+
+func findRuntimeSection(runtimeData []byte, name string) (runtimeSection, error) {
+	file, err := elf.NewFile(bytes.NewReader(runtimeData))
+	if err != nil {
+		return runtimeSection{}, errors.WithStack(err)
+	}
+
+	section := file.Section(name)
+	if section == nil {
+		return runtimeSection{}, errors.Errorf("runtime doesn't have %s section", name)
+	}
+	// runtime is written at the start of AppImage, so, section offset in the runtime is the offset in the AppImage
+	return runtimeSection{name: name, offset: int64(section.Offset), size: int64(section.Size)}, nil
+}
+
+// writes data into the section, data must fit into the section (remaining part of section is zeroed)
+func writeToSection(file *os.File, section runtimeSection, data []byte, name string) error {
+	if int64(len(data)) > section.size {
+		return errors.Errorf("%s is too long (%d bytes), %s section size is %d bytes", name, len(data), section.name, section.size)
+	}
+
+	padded := make([]byte, section.size)
+	copy(padded, data)
+	_, err := file.WriteAt(padded, section.offset)
+	return errors.WithStack(err)
+}
+
+func writeUpdateInformation(outputFile string, runtimeData []byte, updateInformation string) error {
+	section, err := findRuntimeSection(runtimeData, updateInfoSection)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(outputFile, os.O_RDWR, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = writeToSection(file, section, []byte(updateInformation), "update information")
+	return fsutil.CloseAndCheckError(err, file)
+}
+
+// as appimagetool does: sha256 of the whole file where signature and key sections are zeroed, hex digest is signed by gpg (detached armored signature)
+// and written into the signature section, armored public key is written into the key section
+func signAppImage(outputFile string, runtimeData []byte, keyId string) error {
+	signatureRange, err := findRuntimeSection(runtimeData, signatureSection)
+	if err != nil {
+		return err
+	}
+	keyRange, err := findRuntimeSection(runtimeData, signKeySection)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(outputFile, os.O_RDWR, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = doSignAppImage(file, signatureRange, keyRange, keyId)
+	return fsutil.CloseAndCheckError(err, file)
+}
+
+func doSignAppImage(file *os.File, signatureRange runtimeSection, keyRange runtimeSection, keyId string) error {
+	// sections may be not empty if output is reused
+	err := writeToSection(file, signatureRange, nil, "signature")
+	if err != nil {
+		return err
+	}
+	err = writeToSection(file, keyRange, nil, "key")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	digestFile, err := util.TempFile("", ".digest")
+	if err != nil {
+		return err
+	}
+	defer removeTempFile(digestFile)
+
+	err = ioutil.WriteFile(digestFile, []byte(hex.EncodeToString(hash.Sum(nil))), 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	signArgs := []string{"--batch", "--yes", "--detach-sign", "--armor", "--output", "-"}
+	exportArgs := []string{"--batch", "--export", "--armor"}
+	if len(keyId) != 0 {
+		signArgs = append(signArgs, "--local-user", keyId)
+		exportArgs = append(exportArgs, keyId)
+	}
+
+	signature, err := util.Execute(exec.Command(gpg.GetGpgPath(), append(signArgs, digestFile)...), "")
+	if err != nil {
+		return err
+	}
+
+	key, err := util.Execute(exec.Command(gpg.GetGpgPath(), exportArgs...), "")
+	if err != nil {
+		return err
+	}
+	if len(key) == 0 {
+		return errors.New("gpg didn't export public key")
+	}
+
+	err = writeToSection(file, signatureRange, signature, "signature")
+	if err != nil {
+		return err
+	}
+	return writeToSection(file, keyRange, key, "public key")
+}
+
+func removeTempFile(file string) {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("file", file).Warn("cannot remove temporary file")
+	}
+}
@@ -0,0 +1,317 @@
+package deb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/archive"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+)
+
+type Configuration struct {
+	linuxPackage.Layout
+
+	Version string `json:"version"`
+	// node arch names (x64, ia32, arm64, armv7l) are converted to Debian names
+	Arch        string `json:"arch"`
+	Maintainer  string `json:"maintainer"`
+	Description string `json:"description"`
+	Homepage    string `json:"homepage"`
+	Section     string `json:"section"`
+	Priority    string `json:"priority"`
+
+	Depends    []string `json:"depends"`
+	Recommends []string `json:"recommends"`
+	Suggests   []string `json:"suggests"`
+	Conflicts  []string `json:"conflicts"`
+	Provides   []string `json:"provides"`
+	Replaces   []string `json:"replaces"`
+
+	// maintainer script files
+	PreInstall  string `json:"preInstall"`
+	PostInstall string `json:"postInstall"`
+	PreRemove   string `json:"preRemove"`
+	PostRemove  string `json:"postRemove"`
+
+	// xz (default), zstd (dpkg 1.21.18+), gzip or none
+	Compression string `json:"compression"`
+}
+
+var archNames = map[string]string{
+	"x64":    "amd64",
+	"ia32":   "i386",
+	"arm64":  "arm64",
+	"armv7l": "armhf",
+}
+
+var packageNameRegExp = regexp.MustCompile("^[a-z0-9][a-z0-9+.-]+$")
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("deb", "Build Debian package.")
+	jsonConfig := command.Flag("configuration", "").Short('c').Required().String()
+	output := command.Flag("output", "The output file.").Short('o').Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration Configuration
+		err := jsoniter.UnmarshalFromString(*jsonConfig, &configuration)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return Build(&configuration, *output)
+	})
+}
+
+func Build(configuration *Configuration, output string) error {
+	err := configuration.normalize()
+	if err != nil {
+		return err
+	}
+
+	entries, err := configuration.Collect()
+	if err != nil {
+		return err
+	}
+
+	modTime := linuxPackage.GetModificationTime()
+	compressionExtension := archive.CompressionExtension(configuration.Compression)
+
+	tempDir, err := util.TempDir("", ".deb")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer removeDir(tempDir)
+
+	dataFile := filepath.Join(tempDir, "data.tar"+compressionExtension)
+	err = linuxPackage.WriteCompressedFile(dataFile, configuration.Compression, func(writer io.Writer) error {
+		return linuxPackage.WriteTar(entries, writer, ".", modTime)
+	})
+	if err != nil {
+		return err
+	}
+
+	controlFiles, err := createControlFiles(configuration, entries)
+	if err != nil {
+		return err
+	}
+
+	controlFile := filepath.Join(tempDir, "control.tar"+compressionExtension)
+	err = linuxPackage.WriteCompressedFile(controlFile, configuration.Compression, func(writer io.Writer) error {
+		return linuxPackage.WriteTarFiles(controlFiles, writer, modTime)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = fsutil.EnsureDir(filepath.Dir(output))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = writeAr(output, modTime, []arFile{
+		{name: "debian-binary", data: []byte("2.0\n")},
+		{name: "control.tar" + compressionExtension, file: controlFile},
+		{name: "data.tar" + compressionExtension, file: dataFile},
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"file": output, "files": len(entries)}).Info("deb created")
+	return nil
+}
+
+func (t *Configuration) normalize() error {
+	if !packageNameRegExp.MatchString(t.Name) {
+		return errors.Errorf("invalid package name %q (lowercase letters, digits and +.- are allowed)", t.Name)
+	}
+	if len(t.Version) == 0 || len(t.Maintainer) == 0 {
+		return errors.New("version and maintainer must be specified")
+	}
+
+	if arch, ok := archNames[t.Arch]; ok {
+		t.Arch = arch
+	} else if len(t.Arch) == 0 {
+		return errors.New("arch must be specified")
+	}
+
+	if len(t.Compression) == 0 {
+		t.Compression = "xz"
+	}
+	if len(t.Priority) == 0 {
+		t.Priority = "optional"
+	}
+	if len(t.Description) == 0 {
+		t.Description = t.Name
+	}
+	return nil
+}
+
+func createControlFiles(configuration *Configuration, entries []linuxPackage.FileEntry) ([]linuxPackage.TarFileEntry, error) {
+	md5sums, err := computeMd5sums(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []linuxPackage.TarFileEntry{
+		{Name: "./control", Data: createControl(configuration, linuxPackage.InstalledSize(entries)), Mode: 0644},
+		{Name: "./md5sums", Data: md5sums, Mode: 0644},
+	}
+
+	scripts := []struct {
+		name string
+		file string
+	}{
+		{"preinst", configuration.PreInstall},
+		{"postinst", configuration.PostInstall},
+		{"prerm", configuration.PreRemove},
+		{"postrm", configuration.PostRemove},
+	}
+	for _, script := range scripts {
+		if len(script.file) == 0 {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(script.file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		result = append(result, linuxPackage.TarFileEntry{Name: "./" + script.name, Data: data, Mode: 0755})
+	}
+	return result, nil
+}
+
+func createControl(configuration *Configuration, installedSize int64) []byte {
+	var buffer bytes.Buffer
+	writeField := func(name string, value string) {
+		if len(value) != 0 {
+			fmt.Fprintf(&buffer, "%s: %s\n", name, value)
+		}
+	}
+
+	writeField("Package", configuration.Name)
+	writeField("Version", configuration.Version)
+	writeField("Architecture", configuration.Arch)
+	writeField("Maintainer", configuration.Maintainer)
+	writeField("Installed-Size", fmt.Sprint(installedSize))
+	writeField("Depends", strings.Join(configuration.Depends, ", "))
+	writeField("Recommends", strings.Join(configuration.Recommends, ", "))
+	writeField("Suggests", strings.Join(configuration.Suggests, ", "))
+	writeField("Conflicts", strings.Join(configuration.Conflicts, ", "))
+	writeField("Provides", strings.Join(configuration.Provides, ", "))
+	writeField("Replaces", strings.Join(configuration.Replaces, ", "))
+	writeField("Section", configuration.Section)
+	writeField("Priority", configuration.Priority)
+	writeField("Homepage", configuration.Homepage)
+	writeField("Description", formatDescription(configuration.Description))
+	return buffer.Bytes()
+}
+
+// the first line is synopsis, the rest is extended description (lines are indented, empty line is " .")
+func formatDescription(description string) string {
+	lines := strings.Split(strings.TrimSpace(description), "\n")
+	for index := 1; index < len(lines); index++ {
+		line := strings.TrimRight(lines[index], " \t\r")
+		if len(line) == 0 {
+			line = "."
+		}
+		lines[index] = " " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// path is relative to root without leading ./ (as dpkg expects)
+func computeMd5sums(entries []linuxPackage.FileEntry) ([]byte, error) {
+	var buffer bytes.Buffer
+	for _, entry := range entries {
+		if len(entry.Source) == 0 {
+			continue
+		}
+
+		hash := md5.New()
+		err := linuxPackage.CopyFile(entry.Source, hash)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buffer, "%s  %s\n", hex.EncodeToString(hash.Sum(nil)), strings.TrimPrefix(entry.Path, "/"))
+	}
+	return buffer.Bytes(), nil
+}
+
+func removeDir(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Warn("cannot remove temporary dir")
+	}
+}
+
+type arFile struct {
+	name string
+	// either data or file
+	data []byte
+	file string
+}
+
+// https://en.wikipedia.org/wiki/Ar_(Unix) (common format, names are not longer than 16 chars)
+func writeAr(output string, modTime time.Time, files []arFile) error {
+	return fs.WriteFileAtomicWith(output, 0644, func(outFile *os.File) error {
+		_, err := outFile.WriteString("!<arch>\n")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, file := range files {
+			err = writeArEntry(outFile, file, modTime)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func writeArEntry(writer io.Writer, file arFile, modTime time.Time) error {
+	size := int64(len(file.data))
+	if len(file.file) != 0 {
+		info, err := os.Stat(file.file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		size = info.Size()
+	}
+
+	_, err := fmt.Fprintf(writer, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", file.name, modTime.Unix(), 0, 0, "100644", size)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(file.file) != 0 {
+		err = linuxPackage.CopyFile(file.file, writer)
+	} else {
+		_, err = writer.Write(file.data)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// data section is 2-byte aligned
+	if size%2 != 0 {
+		_, err = writer.Write([]byte{'\n'})
+	}
+	return errors.WithStack(err)
+}
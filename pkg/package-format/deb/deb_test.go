@@ -0,0 +1,97 @@
+package deb
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	. "github.com/onsi/gomega"
+)
+
+func createTestConfiguration(g *GomegaWithT, tmpDir string, compression string) *Configuration {
+	appDir := filepath.Join(tmpDir, "linux-unpacked")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "foo"), []byte("#!/bin/sh\n"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app.asar"), []byte("asar"), 0644)).NotTo(HaveOccurred())
+	g.Expect(os.Symlink("foo", filepath.Join(appDir, "foo-link"))).NotTo(HaveOccurred())
+
+	desktopFile := filepath.Join(tmpDir, "foo.desktop")
+	g.Expect(ioutil.WriteFile(desktopFile, []byte("[Desktop Entry]\nName=Foo\n"), 0644)).NotTo(HaveOccurred())
+	postInstall := filepath.Join(tmpDir, "after-install.sh")
+	g.Expect(ioutil.WriteFile(postInstall, []byte("#!/bin/sh\necho installed\n"), 0644)).NotTo(HaveOccurred())
+
+	testData, err := filepath.Abs(filepath.Join("..", "..", "..", "testData"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	return &Configuration{
+		Layout: linuxPackage.Layout{
+			AppDir:      appDir,
+			Name:        "foo",
+			Executable:  "foo",
+			DesktopFile: desktopFile,
+			Icons:       []icons.IconInfo{{File: filepath.Join(testData, "512x512.png"), Size: 512}},
+		},
+		Version:     "1.0.0",
+		Arch:        "x64",
+		Maintainer:  "Foo <foo@example.com>",
+		Description: "Foo app\nThe best app.\n\nReally.",
+		Depends:     []string{"libgtk-3-0", "libnss3"},
+		PostInstall: postInstall,
+		Compression: compression,
+	}
+}
+
+func TestBuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	for _, compression := range []string{"gzip", "xz", "none"} {
+		if compression == "xz" {
+			if _, err := exec.LookPath("xz"); err != nil {
+				continue
+			}
+		}
+
+		tmpDir, err := ioutil.TempDir("", "deb")
+		g.Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(tmpDir)
+
+		output := filepath.Join(tmpDir, "foo.deb")
+		g.Expect(Build(createTestConfiguration(g, tmpDir, compression), output)).NotTo(HaveOccurred())
+
+		data, err := ioutil.ReadFile(output)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(data[:8])).To(Equal("!<arch>\n"))
+		g.Expect(string(data[8:24])).To(Equal("debian-binary   "))
+
+		if _, err := exec.LookPath("dpkg-deb"); err != nil {
+			continue
+		}
+
+		info, err := exec.Command("dpkg-deb", "--info", output).CombinedOutput()
+		g.Expect(err).NotTo(HaveOccurred(), string(info))
+		g.Expect(string(info)).To(ContainSubstring("Package: foo\n"))
+		g.Expect(string(info)).To(ContainSubstring("Architecture: amd64\n"))
+		g.Expect(string(info)).To(ContainSubstring("Depends: libgtk-3-0, libnss3\n"))
+		g.Expect(string(info)).To(ContainSubstring(" Description: Foo app\n  The best app.\n  .\n  Really.\n"))
+		g.Expect(string(info)).To(ContainSubstring("postinst"))
+
+		contents, err := exec.Command("dpkg-deb", "--contents", output).CombinedOutput()
+		g.Expect(err).NotTo(HaveOccurred(), string(contents))
+		g.Expect(string(contents)).To(ContainSubstring("-rwxr-xr-x root/root        10 "))
+		g.Expect(string(contents)).To(ContainSubstring("./opt/foo/foo-link -> foo"))
+		g.Expect(string(contents)).To(ContainSubstring("./usr/bin/foo -> /opt/foo/foo"))
+		g.Expect(string(contents)).To(ContainSubstring("./usr/share/applications/foo.desktop"))
+		g.Expect(string(contents)).To(ContainSubstring("./usr/share/icons/hicolor/512x512/apps/foo.png"))
+
+		extractDir := filepath.Join(tmpDir, "control")
+		output2, err := exec.Command("dpkg-deb", "--control", output, extractDir).CombinedOutput()
+		g.Expect(err).NotTo(HaveOccurred(), string(output2))
+		md5sums, err := ioutil.ReadFile(filepath.Join(extractDir, "md5sums"))
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(md5sums)).To(ContainSubstring("  opt/foo/resources/app.asar\n"))
+	}
+}
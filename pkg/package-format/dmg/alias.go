@@ -0,0 +1,90 @@
+package dmg
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+)
+
+// Alias Manager record (version 2) that Finder uses to reference background image (backgroundImageAlias of icvp).
+// Only fields required to resolve alias on the mounted volume are filled.
+
+const (
+	aliasHeaderSize = 150
+
+	aliasParentDirName = 0
+	aliasParentDirId   = 1
+	aliasUnicodeName   = 14
+	aliasUnicodeVolume = 15
+	aliasPosixPath     = 18
+	aliasVolumeMount   = 19
+	aliasEnd           = 0xFFFF
+
+	// ejectable disk
+	aliasDiskTypeEjectable = 5
+)
+
+func createAlias(volume *hfsVolume, file *hfsNode) []byte {
+	result := make([]byte, aliasHeaderSize)
+	// version
+	binary.BigEndian.PutUint16(result[6:], 2)
+	// kind: file
+	binary.BigEndian.PutUint16(result[8:], 0)
+	putPascalString(result[10:38], volume.name)
+	binary.BigEndian.PutUint32(result[38:], toHfsTime(volume.date))
+	copy(result[42:44], "H+")
+	binary.BigEndian.PutUint16(result[44:], aliasDiskTypeEjectable)
+	binary.BigEndian.PutUint32(result[46:], file.parent.cnid)
+	putPascalString(result[50:114], file.name)
+	binary.BigEndian.PutUint32(result[114:], file.cnid)
+	binary.BigEndian.PutUint32(result[118:], toHfsTime(file.modTime))
+	// file type and creator are not set, nlvlFrom and nlvlTo are -1
+	binary.BigEndian.PutUint16(result[130:], 0xFFFF)
+	binary.BigEndian.PutUint16(result[132:], 0xFFFF)
+
+	parentId := make([]byte, 4)
+	binary.BigEndian.PutUint32(parentId, file.parent.cnid)
+
+	result = appendAliasTag(result, aliasParentDirName, []byte(file.parent.name))
+	result = appendAliasTag(result, aliasParentDirId, parentId)
+	result = appendAliasTag(result, aliasUnicodeName, encodeAliasUnicode(file.name))
+	result = appendAliasTag(result, aliasUnicodeVolume, encodeAliasUnicode(volume.name))
+	result = appendAliasTag(result, aliasPosixPath, []byte(file.path()))
+	result = appendAliasTag(result, aliasVolumeMount, []byte("/Volumes/"+volume.name))
+	result = appendAliasTag(result, aliasEnd, nil)
+
+	// total length
+	binary.BigEndian.PutUint16(result[4:], uint16(len(result)))
+	return result
+}
+
+func putPascalString(data []byte, value string) {
+	if len(value) > len(data)-1 {
+		value = value[:len(data)-1]
+	}
+	data[0] = byte(len(value))
+	copy(data[1:], value)
+}
+
+// tag, length and data padded to even length
+func appendAliasTag(result []byte, tag uint16, data []byte) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint16(header[0:], tag)
+	binary.BigEndian.PutUint16(header[2:], uint16(len(data)))
+	result = append(result, header...)
+	result = append(result, data...)
+	if len(data)&1 != 0 {
+		result = append(result, 0)
+	}
+	return result
+}
+
+// char count and UTF-16 big endian chars
+func encodeAliasUnicode(value string) []byte {
+	chars := utf16.Encode([]rune(value))
+	result := make([]byte, 2+2*len(chars))
+	binary.BigEndian.PutUint16(result, uint16(len(chars)))
+	for index, c := range chars {
+		binary.BigEndian.PutUint16(result[2+2*index:], c)
+	}
+	return result
+}
@@ -0,0 +1,258 @@
+package dmg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/disintegration/imaging"
+)
+
+type BackgroundOptions struct {
+	// 1x image, created from retina image if not specified
+	Background string
+	// 2x image, <name>@2x.<ext> is used if exists, created from 1x image if not specified (blurry)
+	RetinaBackground string
+	Output           string
+}
+
+type BackgroundResult struct {
+	File string `json:"file"`
+	// size of 1x image (points)
+	Width  int           `json:"width"`
+	Height int           `json:"height"`
+	Issues []LayoutIssue `json:"issues,omitempty"`
+}
+
+func ConfigureBackgroundCommand(app *kingpin.Application) {
+	command := app.Command("dmg-background", "Create multi-resolution (1x and 2x) TIFF background and validate window and icon positions of dmg config against it")
+	options := BackgroundOptions{}
+	command.Flag("background", "1x background image").StringVar(&options.Background)
+	command.Flag("retina", "2x background image (<name>@2x.<ext> is used if not specified and exists)").StringVar(&options.RetinaBackground)
+	command.Flag("output", "output TIFF file").Short('o').Required().StringVar(&options.Output)
+	configFile := command.Flag("config", "DMG configuration file (JSON, JSON5, YAML or TOML) to validate layout").Short('c').String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := CreateBackground(options)
+		if err != nil {
+			return err
+		}
+
+		errorCount := 0
+		if len(*configFile) != 0 {
+			config, err := ReadConfig(*configFile)
+			if err != nil {
+				return err
+			}
+
+			result.Issues = ValidateLayout(config, &image.Point{X: result.Width, Y: result.Height})
+			for _, issue := range result.Issues {
+				if issue.Level == layoutError {
+					errorCount++
+				}
+			}
+		}
+
+		err = util.WriteJsonToStdOut(result)
+		if err != nil {
+			return err
+		}
+		if errorCount != 0 {
+			return errors.Errorf("dmg layout has %d error(s)", errorCount)
+		}
+		return nil
+	})
+}
+
+// CreateBackground writes TIFF with 1x and 2x images (the same as tiffutil -cathidpicheck), so, Finder uses 2x image on retina displays
+func CreateBackground(options BackgroundOptions) (*BackgroundResult, error) {
+	if len(options.RetinaBackground) == 0 && len(options.Background) != 0 {
+		retinaFile := strings.TrimSuffix(options.Background, filepath.Ext(options.Background)) + "@2x" + filepath.Ext(options.Background)
+		if _, err := os.Stat(retinaFile); err == nil {
+			options.RetinaBackground = retinaFile
+		}
+	}
+
+	var image1x, image2x image.Image
+	var err error
+	if len(options.Background) != 0 {
+		image1x, err = icons.LoadImage(options.Background)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(options.RetinaBackground) != 0 {
+		image2x, err = icons.LoadImage(options.RetinaBackground)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case image1x == nil && image2x == nil:
+		return nil, errors.New("background or retina background must be specified")
+
+	case image1x == nil:
+		size := image2x.Bounds().Size()
+		if size.X%2 != 0 || size.Y%2 != 0 {
+			return nil, errors.Errorf("size of retina background %dx%d must be even", size.X, size.Y)
+		}
+		image1x = imaging.Resize(image2x, size.X/2, size.Y/2, imaging.Lanczos)
+
+	case image2x == nil:
+		log.WithField("file", options.Background).Warn("retina (@2x) background is not provided, upscaled 1x image is used")
+		size := image1x.Bounds().Size()
+		image2x = imaging.Resize(image1x, size.X*2, size.Y*2, imaging.Lanczos)
+	}
+
+	size := image1x.Bounds().Size()
+	if image2x.Bounds().Size() != size.Mul(2) {
+		retinaSize := image2x.Bounds().Size()
+		return nil, errors.Errorf("retina background must be exactly 2 times bigger than background: %dx%d expected, got %dx%d", size.X*2, size.Y*2, retinaSize.X, retinaSize.Y)
+	}
+
+	err = fs.WriteFileAtomicWith(options.Output, 0644, func(file *os.File) error {
+		writer := bufio.NewWriter(file)
+		err := encodeMultiResolutionTiff(writer, []image.Image{image1x, image2x}, []uint32{72, 144})
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(writer.Flush())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BackgroundResult{File: options.Output, Width: size.X, Height: size.Y}, nil
+}
+
+// TIFF tags
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffResolutionUnit  = 296
+	tiffExtraSamples    = 338
+
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+type tiffEntry struct {
+	tag       uint16
+	valueType uint16
+	count     uint32
+	value     uint32
+}
+
+// every image is a page (IFD) with deflate compressed RGBA strip (not premultiplied alpha), resolution (DPI) tells which page is 1x and 2x
+func encodeMultiResolutionTiff(writer io.Writer, images []image.Image, resolutions []uint32) error {
+	var result bytes.Buffer
+	// little endian, magic, offset of the first IFD is patched later
+	result.Write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0})
+	previousNextIfdOffset := 4
+
+	for index, img := range images {
+		bounds := img.Bounds()
+		nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+		stripOffset := result.Len()
+		compressor := zlib.NewWriter(&result)
+		_, err := compressor.Write(nrgba.Pix)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		err = compressor.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		stripLength := result.Len() - stripOffset
+
+		// IFD must be at word boundary
+		if result.Len()%2 != 0 {
+			result.WriteByte(0)
+		}
+
+		entries := []tiffEntry{
+			{tiffImageWidth, tiffLong, 1, uint32(bounds.Dx())},
+			{tiffImageLength, tiffLong, 1, uint32(bounds.Dy())},
+			// offset of values is set below
+			{tiffBitsPerSample, tiffShort, 4, 0},
+			// adobe deflate
+			{tiffCompression, tiffShort, 1, 8},
+			// RGB
+			{tiffPhotometric, tiffShort, 1, 2},
+			{tiffStripOffsets, tiffLong, 1, uint32(stripOffset)},
+			{tiffSamplesPerPixel, tiffShort, 1, 4},
+			{tiffRowsPerStrip, tiffLong, 1, uint32(bounds.Dy())},
+			{tiffStripByteCounts, tiffLong, 1, uint32(stripLength)},
+			{tiffXResolution, tiffRational, 1, 0},
+			{tiffYResolution, tiffRational, 1, 0},
+			// inch
+			{tiffResolutionUnit, tiffShort, 1, 2},
+			// unassociated alpha
+			{tiffExtraSamples, tiffShort, 1, 2},
+		}
+
+		ifdOffset := result.Len()
+		binary.LittleEndian.PutUint32(result.Bytes()[previousNextIfdOffset:], uint32(ifdOffset))
+
+		ifdSize := 2 + len(entries)*12 + 4
+		valuesOffset := uint32(ifdOffset + ifdSize)
+		entries[2].value = valuesOffset
+		entries[9].value = valuesOffset + 8
+		entries[10].value = valuesOffset + 16
+
+		data := make([]byte, ifdSize+8+8+8)
+		binary.LittleEndian.PutUint16(data, uint16(len(entries)))
+		for entryIndex, entry := range entries {
+			offset := 2 + entryIndex*12
+			binary.LittleEndian.PutUint16(data[offset:], entry.tag)
+			binary.LittleEndian.PutUint16(data[offset+2:], entry.valueType)
+			binary.LittleEndian.PutUint32(data[offset+4:], entry.count)
+			// SHORT value is left-justified
+			if entry.valueType == tiffShort && entry.count == 1 {
+				binary.LittleEndian.PutUint16(data[offset+8:], uint16(entry.value))
+			} else {
+				binary.LittleEndian.PutUint32(data[offset+8:], entry.value)
+			}
+		}
+		// offset of the next IFD (0 - last) is patched when the next page is written
+		previousNextIfdOffset = ifdOffset + ifdSize - 4
+
+		values := data[ifdSize:]
+		for i := 0; i < 4; i++ {
+			binary.LittleEndian.PutUint16(values[i*2:], 8)
+		}
+		for i := 0; i < 2; i++ {
+			binary.LittleEndian.PutUint32(values[8+i*8:], resolutions[index])
+			binary.LittleEndian.PutUint32(values[8+i*8+4:], 1)
+		}
+		result.Write(data)
+	}
+
+	_, err := writer.Write(result.Bytes())
+	return errors.WithStack(err)
+}
@@ -0,0 +1,122 @@
+package dmg
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/icons"
+	. "github.com/onsi/gomega"
+	"golang.org/x/image/tiff"
+)
+
+func createTestBackground(width int, height int) *image.NRGBA {
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			result.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	return result
+}
+
+// width, height and X resolution of every page
+func readTestTiffPages(data []byte) [][3]uint32 {
+	var result [][3]uint32
+	for offset := binary.LittleEndian.Uint32(data[4:]); offset != 0; {
+		count := int(binary.LittleEndian.Uint16(data[offset:]))
+		var page [3]uint32
+		for index := 0; index < count; index++ {
+			entry := data[int(offset)+2+index*12:]
+			value := binary.LittleEndian.Uint32(entry[8:])
+			switch binary.LittleEndian.Uint16(entry) {
+			case tiffImageWidth:
+				page[0] = value
+			case tiffImageLength:
+				page[1] = value
+			case tiffXResolution:
+				page[2] = binary.LittleEndian.Uint32(data[value:])
+			}
+		}
+		result = append(result, page)
+		offset = binary.LittleEndian.Uint32(data[int(offset)+2+count*12:])
+	}
+	return result
+}
+
+func TestCreateBackground(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "dmg-background")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	background := filepath.Join(tmpDir, "background.png")
+	g.Expect(icons.SaveImage(createTestBackground(60, 40), background, icons.PNG)).To(Succeed())
+
+	// retina image is not found - upscaled
+	output := filepath.Join(tmpDir, "background.tiff")
+	result, err := CreateBackground(BackgroundOptions{Background: background, Output: output})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Width).To(Equal(60))
+	g.Expect(result.Height).To(Equal(40))
+
+	// @2x is picked up automatically
+	g.Expect(icons.SaveImage(createTestBackground(120, 80), filepath.Join(tmpDir, "background@2x.png"), icons.PNG)).To(Succeed())
+	_, err = CreateBackground(BackgroundOptions{Background: background, Output: output})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(output)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(readTestTiffPages(data)).To(Equal([][3]uint32{{60, 40, 72}, {120, 80, 144}}))
+
+	file, err := os.Open(output)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer file.Close()
+	decoded, err := tiff.Decode(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(color.NRGBAModel.Convert(decoded.At(10, 20))).To(Equal(color.NRGBA{R: 10, G: 20, B: 200, A: 255}))
+
+	g.Expect(readImageSize(output)).To(Equal(&image.Point{X: 60, Y: 40}))
+
+	// size of retina image must be exactly doubled
+	wrongRetina := filepath.Join(tmpDir, "wrong@2x.png")
+	g.Expect(icons.SaveImage(createTestBackground(100, 80), wrongRetina, icons.PNG)).To(Succeed())
+	_, err = CreateBackground(BackgroundOptions{Background: background, RetinaBackground: wrongRetina, Output: output})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("exactly 2 times bigger"))
+}
+
+func TestValidateLayout(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	config := &Config{
+		Title:  "Test",
+		Window: &WindowConfig{Width: 540, Height: 380},
+		Contents: []ContentConfig{
+			{X: 130, Y: 220, Name: "Test.app"},
+			{X: 520, Y: 220, Type: "link", Path: "/Applications"},
+		},
+	}
+	g.Expect(config.normalize()).To(Succeed())
+
+	issues := ValidateLayout(config, &image.Point{X: 540, Y: 380})
+	g.Expect(issues).To(HaveLen(1))
+	g.Expect(issues[0].Entry).To(Equal("Applications"))
+	g.Expect(issues[0].Level).To(Equal(layoutWarning))
+
+	config.Contents = config.Contents[:1]
+	g.Expect(ValidateLayout(config, nil)).To(BeEmpty())
+
+	issues = ValidateLayout(config, &image.Point{X: 500, Y: 400})
+	g.Expect(issues).To(HaveLen(1))
+	g.Expect(issues[0].Level).To(Equal(layoutError))
+
+	issues = ValidateLayout(config, &image.Point{X: 600, Y: 400})
+	g.Expect(issues).To(HaveLen(1))
+	g.Expect(issues[0].Level).To(Equal(layoutWarning))
+}
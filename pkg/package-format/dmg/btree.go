@@ -0,0 +1,225 @@
+package dmg
+
+import (
+	"encoding/binary"
+
+	"github.com/develar/errors"
+)
+
+// https://developer.apple.com/library/archive/technotes/tn1150/_index.html#BTrees
+
+const (
+	bTreeNodeDescriptorSize = 14
+	bTreeHeaderRecordSize   = 106
+	bTreeUserDataRecordSize = 128
+
+	bTreeLeafNode   = 0xff
+	bTreeIndexNode  = 0
+	bTreeHeaderNode = 1
+
+	bTreeBigKeysMask           = 2
+	bTreeVariableIndexKeysMask = 4
+)
+
+type bTreeRecord struct {
+	// key including key length
+	key  []byte
+	data []byte
+}
+
+type bTreeNode struct {
+	kind    byte
+	height  byte
+	records [][]byte
+
+	number uint32
+	fLink  uint32
+	bLink  uint32
+}
+
+type bTree struct {
+	nodeSize       int
+	maxKeyLength   uint16
+	keyCompareType byte
+	attributes     uint32
+
+	// header node is not included
+	nodes       []*bTreeNode
+	depth       uint16
+	root        uint32
+	leafRecords uint32
+	firstLeaf   uint32
+	lastLeaf    uint32
+}
+
+// records must be sorted, all nodes are written (including header node) sequentially, the tree is built bottom-up
+func buildBTree(records []bTreeRecord, nodeSize int, maxKeyLength uint16, keyCompareType byte, attributes uint32) (*bTree, error) {
+	tree := &bTree{
+		nodeSize:       nodeSize,
+		maxKeyLength:   maxKeyLength,
+		keyCompareType: keyCompareType,
+		attributes:     attributes,
+		leafRecords:    uint32(len(records)),
+	}
+
+	if len(records) == 0 {
+		return tree, nil
+	}
+
+	nextNodeNumber := uint32(1)
+	levelRecords := make([][]byte, len(records))
+	for index, record := range records {
+		levelRecords[index] = append(append([]byte{}, record.key...), record.data...)
+	}
+	recordKeys := make([][]byte, len(records))
+	for index, record := range records {
+		recordKeys[index] = record.key
+	}
+
+	kind := byte(bTreeLeafNode)
+	height := byte(1)
+	for {
+		levelNodes, firstKeys, err := tree.packNodes(levelRecords, recordKeys, kind, height, &nextNodeNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		if kind == bTreeLeafNode {
+			tree.firstLeaf = levelNodes[0].number
+			tree.lastLeaf = levelNodes[len(levelNodes)-1].number
+		}
+
+		tree.depth = uint16(height)
+		if len(levelNodes) == 1 {
+			tree.root = levelNodes[0].number
+			break
+		}
+
+		// index record: key of the first record of child node and child node number
+		levelRecords = make([][]byte, len(levelNodes))
+		for index, node := range levelNodes {
+			record := make([]byte, len(firstKeys[index])+4)
+			copy(record, firstKeys[index])
+			binary.BigEndian.PutUint32(record[len(firstKeys[index]):], node.number)
+			levelRecords[index] = record
+		}
+		recordKeys = firstKeys
+
+		kind = bTreeIndexNode
+		height++
+	}
+	return tree, nil
+}
+
+func (t *bTree) packNodes(records [][]byte, keys [][]byte, kind byte, height byte, nextNodeNumber *uint32) ([]*bTreeNode, [][]byte, error) {
+	var nodes []*bTreeNode
+	var firstKeys [][]byte
+	var current *bTreeNode
+	// free space offset is also stored at the end of node
+	freeSpace := 0
+	for index, record := range records {
+		// record must be aligned on 2-byte boundary
+		size := len(record) + len(record)&1 + 2
+		if current == nil || size > freeSpace {
+			if size > t.nodeSize-bTreeNodeDescriptorSize-2 {
+				return nil, nil, errors.Errorf("B-tree record is too big (%d bytes)", len(record))
+			}
+
+			current = &bTreeNode{kind: kind, height: height, number: *nextNodeNumber}
+			*nextNodeNumber++
+			if len(nodes) > 0 {
+				previous := nodes[len(nodes)-1]
+				previous.fLink = current.number
+				current.bLink = previous.number
+			}
+			nodes = append(nodes, current)
+			firstKeys = append(firstKeys, keys[index])
+			freeSpace = t.nodeSize - bTreeNodeDescriptorSize - 2
+		}
+
+		current.records = append(current.records, record)
+		freeSpace -= size
+	}
+
+	t.nodes = append(t.nodes, nodes...)
+	return nodes, firstKeys, nil
+}
+
+func (t *bTree) nodeCount() int {
+	return len(t.nodes) + 1
+}
+
+// totalNodes can be greater than used node count (free nodes)
+func (t *bTree) write(totalNodes int) ([]byte, error) {
+	if totalNodes < t.nodeCount() {
+		return nil, errors.Errorf("B-tree requires %d nodes, but only %d are available", t.nodeCount(), totalNodes)
+	}
+	if totalNodes > t.maxNodeCount() {
+		return nil, errors.Errorf("B-tree with %d nodes is not supported (map nodes are not implemented)", totalNodes)
+	}
+
+	result := make([]byte, totalNodes*t.nodeSize)
+	t.writeHeaderNode(result[:t.nodeSize], totalNodes)
+	for _, node := range t.nodes {
+		offset := int(node.number) * t.nodeSize
+		writeBTreeNode(result[offset:offset+t.nodeSize], node)
+	}
+	return result, nil
+}
+
+func (t *bTree) mapRecordSize() int {
+	// 3 records and free space offset
+	return t.nodeSize - bTreeNodeDescriptorSize - bTreeHeaderRecordSize - bTreeUserDataRecordSize - 4*2
+}
+
+func (t *bTree) maxNodeCount() int {
+	return t.mapRecordSize() * 8
+}
+
+func (t *bTree) writeHeaderNode(data []byte, totalNodes int) {
+	mapRecordSize := t.mapRecordSize()
+
+	node := &bTreeNode{kind: bTreeHeaderNode}
+
+	header := make([]byte, bTreeHeaderRecordSize)
+	binary.BigEndian.PutUint16(header[0:], t.depth)
+	binary.BigEndian.PutUint32(header[2:], t.root)
+	binary.BigEndian.PutUint32(header[6:], t.leafRecords)
+	binary.BigEndian.PutUint32(header[10:], t.firstLeaf)
+	binary.BigEndian.PutUint32(header[14:], t.lastLeaf)
+	binary.BigEndian.PutUint16(header[18:], uint16(t.nodeSize))
+	binary.BigEndian.PutUint16(header[20:], t.maxKeyLength)
+	binary.BigEndian.PutUint32(header[22:], uint32(totalNodes))
+	binary.BigEndian.PutUint32(header[26:], uint32(totalNodes-t.nodeCount()))
+	// reserved (2 bytes), clump size
+	binary.BigEndian.PutUint32(header[32:], uint32(t.nodeSize))
+	// btree type (0 - HFS B-tree)
+	header[37] = t.keyCompareType
+	binary.BigEndian.PutUint32(header[38:], t.attributes)
+
+	// map record - bitmap of used nodes
+	mapRecord := make([]byte, mapRecordSize)
+	for i := 0; i < t.nodeCount(); i++ {
+		mapRecord[i/8] |= 0x80 >> uint(i%8)
+	}
+
+	node.records = [][]byte{header, make([]byte, bTreeUserDataRecordSize), mapRecord}
+	writeBTreeNode(data, node)
+}
+
+func writeBTreeNode(data []byte, node *bTreeNode) {
+	binary.BigEndian.PutUint32(data[0:], node.fLink)
+	binary.BigEndian.PutUint32(data[4:], node.bLink)
+	data[8] = node.kind
+	data[9] = node.height
+	binary.BigEndian.PutUint16(data[10:], uint16(len(node.records)))
+
+	// offsets of records are stored in reverse order at the end of node
+	offset := bTreeNodeDescriptorSize
+	for index, record := range node.records {
+		binary.BigEndian.PutUint16(data[len(data)-2*(index+1):], uint16(offset))
+		copy(data[offset:], record)
+		offset += len(record) + len(record)&1
+	}
+	binary.BigEndian.PutUint16(data[len(data)-2*(len(node.records)+1):], uint16(offset))
+}
@@ -0,0 +1,146 @@
+package dmg
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// names of options are the same as in electron-builder DmgOptions
+type Config struct {
+	Title string `json:"title"`
+	// UDZO (zlib, default) or UDRO (not compressed)
+	Format string `json:"format"`
+
+	// staged folder, all its entries are added to the root of volume
+	SourceDir string `json:"sourceDir"`
+
+	Icon            string `json:"icon"`
+	Background      string `json:"background"`
+	BackgroundColor string `json:"backgroundColor"`
+
+	IconSize     int           `json:"iconSize"`
+	IconTextSize int           `json:"iconTextSize"`
+	Window       *WindowConfig `json:"window"`
+
+	Contents []ContentConfig `json:"contents"`
+
+	Output string `json:"output"`
+}
+
+type WindowConfig struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type ContentConfig struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	// file (default), dir or link
+	Type string `json:"type"`
+	// name of entry in the volume, base name of path by default
+	Name string `json:"name"`
+	// link target for link, file or dir to add otherwise (if not specified, entry of source dir is positioned)
+	Path string `json:"path"`
+}
+
+func (t *ContentConfig) GetName() string {
+	if len(t.Name) != 0 {
+		return t.Name
+	}
+	return filepath.Base(t.Path)
+}
+
+// relative paths are resolved against dir of config file
+func ReadConfig(file string) (*Config, error) {
+	config := &Config{}
+	err := util.LoadConfig(file, config)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDir, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	resolve := func(path *string) {
+		if len(*path) != 0 && !filepath.IsAbs(*path) {
+			*path = filepath.Join(baseDir, *path)
+		}
+	}
+	resolve(&config.SourceDir)
+	resolve(&config.Icon)
+	resolve(&config.Background)
+	resolve(&config.Output)
+	for index := range config.Contents {
+		content := &config.Contents[index]
+		if content.Type != "link" {
+			resolve(&content.Path)
+		}
+	}
+
+	err = config.normalize()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (t *Config) normalize() error {
+	if len(t.Title) == 0 {
+		return errors.New("title is not specified")
+	}
+
+	if len(t.Format) == 0 {
+		t.Format = "UDZO"
+	}
+	t.Format = strings.ToUpper(t.Format)
+	if t.Format == "ULFO" {
+		// there is no LZFSE encoder in Go
+		return errors.New("format ULFO (LZFSE) is not supported without hdiutil, use UDZO")
+	}
+	if t.Format != "UDZO" && t.Format != "UDRO" {
+		return errors.Errorf("format %s is not supported, only UDZO and UDRO are supported without hdiutil", t.Format)
+	}
+
+	if t.IconSize <= 0 {
+		t.IconSize = 80
+	}
+	if t.IconTextSize <= 0 {
+		t.IconTextSize = 12
+	}
+	if t.Window == nil {
+		t.Window = &WindowConfig{}
+	}
+	if t.Window.Width <= 0 {
+		t.Window.Width = 540
+	}
+	if t.Window.Height <= 0 {
+		t.Window.Height = 380
+	}
+	if t.Window.X == 0 && t.Window.Y == 0 {
+		t.Window.X = 400
+		t.Window.Y = 100
+	}
+
+	for _, content := range t.Contents {
+		switch content.Type {
+		case "", "file", "dir":
+			if len(content.Path) == 0 && len(content.Name) == 0 {
+				return errors.New("name or path must be specified for dmg content entry")
+			}
+		case "link":
+			if len(content.Path) == 0 {
+				return errors.New("path must be specified for dmg link")
+			}
+		default:
+			return errors.Errorf("unknown type of dmg content entry: %s", content.Type)
+		}
+	}
+	return nil
+}
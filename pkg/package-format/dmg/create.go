@@ -0,0 +1,342 @@
+package dmg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// output overrides output of config
+func CreateDmgFromConfigFile(configFile string, output string) error {
+	config, err := ReadConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	if len(output) != 0 {
+		config.Output = output
+	}
+	return CreateDmg(config)
+}
+
+// CreateDmg builds DMG without hdiutil: HFS+ (HFSX) volume image is written directly and then converted to UDIF.
+// Volume contains entries of source dir, entries specified in contents (e.g. /Applications link), volume icon, background and .DS_Store with window layout.
+func CreateDmg(config *Config) error {
+	if len(config.Output) == 0 {
+		return errors.New("output is not specified")
+	}
+
+	// layout issues don't prevent creation of dmg
+	for _, issue := range config.validateLayout() {
+		var logger log.Interface = log.Log
+		if len(issue.Entry) != 0 {
+			logger = log.WithField("entry", issue.Entry)
+		}
+		logger.Warn(issue.Message)
+	}
+
+	volume, err := createVolume(config)
+	if err != nil {
+		return err
+	}
+
+	// temporary image is created near output to avoid copying between disks
+	err = fsutil.EnsureDir(filepath.Dir(config.Output))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	imageFile, err := util.TempFile(filepath.Dir(config.Output), ".img")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		removeErr := os.Remove(imageFile)
+		if removeErr != nil && !os.IsNotExist(removeErr) {
+			log.WithError(removeErr).WithField("file", imageFile).Warn("cannot remove temporary disk image")
+		}
+	}()
+
+	err = volume.write(imageFile)
+	if err != nil {
+		return err
+	}
+
+	err = writeUdif(imageFile, config.Output, config.Format)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"file":   config.Output,
+		"format": config.Format,
+		"files":  volume.fileCount,
+	}).Debug("dmg created")
+	return nil
+}
+
+// DmgPlan is written instead of DMG in dry-run mode
+type DmgPlan struct {
+	Output string `json:"output"`
+	Title  string `json:"title"`
+	Format string `json:"format"`
+
+	// entries of the volume root (including volume icon, background dir and .DS_Store)
+	Entries []string `json:"entries"`
+	Files   uint32   `json:"files"`
+	Dirs    uint32   `json:"dirs"`
+	// size of files data and of uncompressed volume image (estimated work)
+	ContentSize int64 `json:"contentSize"`
+	ImageSize   int64 `json:"imageSize"`
+
+	Issues []LayoutIssue `json:"issues,omitempty"`
+}
+
+// PlanDmgFromConfigFile reads config the same way as CreateDmgFromConfigFile, output overrides output of config
+func PlanDmgFromConfigFile(configFile string, output string) (*DmgPlan, error) {
+	config, err := ReadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(output) != 0 {
+		config.Output = output
+	}
+	return PlanDmg(config)
+}
+
+func writeDmgPlan(configFile string, output string) error {
+	plan, err := PlanDmgFromConfigFile(configFile, output)
+	if err != nil {
+		return err
+	}
+	return util.WriteJsonToStdOut(plan)
+}
+
+// PlanDmg lays out volume in memory (file data is not read)
+func PlanDmg(config *Config) (*DmgPlan, error) {
+	if len(config.Output) == 0 {
+		return nil, errors.New("output is not specified")
+	}
+
+	volume, err := createVolume(config)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := volume.createCatalog()
+	if err != nil {
+		return nil, err
+	}
+	layout := volume.computeLayout(catalog)
+
+	plan := &DmgPlan{
+		Output:    config.Output,
+		Title:     config.Title,
+		Format:    config.Format,
+		Entries:   make([]string, 0, len(volume.root.children)),
+		Files:     volume.fileCount,
+		Dirs:      volume.folderCount,
+		ImageSize: int64(layout.totalBlocks) * hfsBlockSize,
+		Issues:    config.validateLayout(),
+	}
+	for _, child := range volume.root.children {
+		plan.Entries = append(plan.Entries, child.name)
+	}
+	volume.forEachNode(volume.root, func(node *hfsNode) {
+		if !node.isDir {
+			plan.ContentSize += node.size
+		}
+	})
+	return plan, nil
+}
+
+func createVolume(config *Config) (*hfsVolume, error) {
+	var root *hfsNode
+	var err error
+	if len(config.SourceDir) == 0 {
+		root = newHfsDir("", config.getNewestInputTime())
+	} else {
+		root, err = createHfsNodeFromFile(config.SourceDir, "")
+		if err != nil {
+			return nil, err
+		}
+		if !root.isDir {
+			return nil, errors.Errorf("%s is not a directory", config.SourceDir)
+		}
+	}
+
+	for _, content := range config.Contents {
+		name := content.GetName()
+		switch {
+		case content.Type == "link":
+			err = root.addChild(&hfsNode{name: name, linkTarget: content.Path, mode: 0755})
+
+		case len(content.Path) != 0:
+			var node *hfsNode
+			node, err = createHfsNodeFromFile(content.Path, name)
+			if err == nil {
+				err = root.addChild(node)
+			}
+
+		case root.findChild(name) == nil:
+			err = errors.Errorf("%s is not found in the source dir", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Icon) != 0 {
+		icon, err := createHfsNodeFromFile(config.Icon, ".VolumeIcon.icns")
+		if err != nil {
+			return nil, err
+		}
+		icon.fileType = "icns"
+		icon.finderFlags |= isInvisibleFinderFlag
+		root.finderFlags |= hasCustomIconFinderFlag
+		err = root.addChild(icon)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var background *hfsNode
+	if len(config.Background) != 0 {
+		background, err = createHfsNodeFromFile(config.Background, filepath.Base(config.Background))
+		if err != nil {
+			return nil, err
+		}
+
+		backgroundDir := newHfsDir(".background", background.modTime)
+		backgroundDir.finderFlags |= isInvisibleFinderFlag
+		err = backgroundDir.addChild(background)
+		if err == nil {
+			err = root.addChild(backgroundDir)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// .DS_Store of the staged folder (if any) is replaced
+	root.removeChild(".DS_Store")
+	dsStore := &hfsNode{name: ".DS_Store", mode: 0644, finderFlags: isInvisibleFinderFlag}
+	err = root.addChild(dsStore)
+	if err != nil {
+		return nil, err
+	}
+
+	volume := &hfsVolume{name: config.Title, root: root}
+	err = volume.assignIds()
+	if err != nil {
+		return nil, err
+	}
+
+	// background alias references catalog node id, so, .DS_Store is created after ids are assigned
+	dsStore.data, err = createDsStore(config, volume, background)
+	if err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
+func (t *Config) getNewestInputTime() (result time.Time) {
+	for _, file := range []string{t.Icon, t.Background} {
+		if len(file) == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(result) {
+			result = info.ModTime()
+		}
+	}
+	return
+}
+
+func createDsStore(config *Config, volume *hfsVolume, background *hfsNode) ([]byte, error) {
+	window := config.Window
+	windowSettings := map[string]interface{}{
+		"ContainerShowSidebar": false,
+		"ShowPathbar":          false,
+		"ShowSidebar":          false,
+		"ShowStatusBar":        false,
+		"ShowTabView":          false,
+		"ShowToolbar":          false,
+		"SidebarWidth":         0,
+		"WindowBounds":         fmt.Sprintf("{{%d, %d}, {%d, %d}}", window.X, window.Y, window.Width, window.Height),
+	}
+
+	viewSettings := map[string]interface{}{
+		"arrangeBy":            "none",
+		"backgroundColorRed":   1.0,
+		"backgroundColorGreen": 1.0,
+		"backgroundColorBlue":  1.0,
+		"backgroundType":       0,
+		"gridOffsetX":          0.0,
+		"gridOffsetY":          0.0,
+		"gridSpacing":          100.0,
+		"iconSize":             float64(config.IconSize),
+		"labelOnBottom":        true,
+		"showIconPreview":      true,
+		"showItemInfo":         false,
+		"textSize":             float64(config.IconTextSize),
+		"viewOptionsVersion":   1,
+	}
+	if background != nil {
+		viewSettings["backgroundType"] = 2
+		viewSettings["backgroundImageAlias"] = createAlias(volume, background)
+	} else if len(config.BackgroundColor) != 0 {
+		red, green, blue, err := parseColor(config.BackgroundColor)
+		if err != nil {
+			return nil, err
+		}
+		viewSettings["backgroundType"] = 1
+		viewSettings["backgroundColorRed"] = red
+		viewSettings["backgroundColorGreen"] = green
+		viewSettings["backgroundColorBlue"] = blue
+	}
+
+	encodedWindowSettings, err := plist.EncodeBinary(windowSettings)
+	if err != nil {
+		return nil, err
+	}
+	encodedViewSettings, err := plist.EncodeBinary(viewSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []dsStoreRecord{
+		dsStoreBlob(".", "bwsp", encodedWindowSettings),
+		dsStoreBlob(".", "icvp", encodedViewSettings),
+		dsStoreLong(".", "vSrn", 1),
+		// icon view
+		{".", "vstl", "type", []byte("icnv")},
+	}
+	for _, content := range config.Contents {
+		records = append(records, dsStoreBlob(content.GetName(), "Iloc", iconLocation(content.X, content.Y)))
+	}
+	return encodeDsStore(records)
+}
+
+// #RRGGBB or #RGB
+func parseColor(color string) (float64, float64, float64, error) {
+	hex := strings.TrimPrefix(color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return 0, 0, 0, errors.Errorf("invalid color: %s", color)
+	}
+	return float64(value>>16) / 255, float64((value>>8)&0xff) / 255, float64(value&0xff) / 255, nil
+}
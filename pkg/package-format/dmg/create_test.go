@@ -0,0 +1,319 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	. "github.com/onsi/gomega"
+)
+
+type testCatalogEntry struct {
+	parentId    uint32
+	name        string
+	cnid        uint32
+	isDir       bool
+	fileType    string
+	finderFlags uint16
+	mode        uint16
+	valence     uint32
+	data        []byte
+}
+
+// decompresses UDIF chunks and returns raw disk image
+func readTestUdif(g *GomegaWithT, file string) []byte {
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	koly := data[len(data)-kolySize:]
+	g.Expect(string(koly[0:4])).To(Equal("koly"))
+	dataForkLength := binary.BigEndian.Uint64(koly[32:])
+	g.Expect(binary.BigEndian.Uint32(koly[88:])).To(Equal(crc32.ChecksumIEEE(data[:dataForkLength])))
+
+	xmlOffset := binary.BigEndian.Uint64(koly[216:])
+	xmlLength := binary.BigEndian.Uint64(koly[224:])
+	plist := string(data[xmlOffset : xmlOffset+xmlLength])
+	encodedBlkx := regexp.MustCompile(`(?s)<data>(.*)</data>`).FindStringSubmatch(plist)[1]
+	blkx, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encodedBlkx), ""))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(blkx[0:4])).To(Equal("mish"))
+
+	sectorCount := binary.BigEndian.Uint64(blkx[16:])
+	g.Expect(binary.BigEndian.Uint64(koly[492:])).To(Equal(sectorCount))
+
+	image := make([]byte, sectorCount*sectorSize)
+	chunkCount := int(binary.BigEndian.Uint32(blkx[200:]))
+	for i := 0; i < chunkCount; i++ {
+		chunk := blkx[blkxHeaderSize+i*blkxChunkSize:]
+		entryType := binary.BigEndian.Uint32(chunk[0:])
+		out := image[binary.BigEndian.Uint64(chunk[8:])*sectorSize:][:binary.BigEndian.Uint64(chunk[16:])*sectorSize]
+		offset := binary.BigEndian.Uint64(chunk[24:])
+		compressed := data[offset : offset+binary.BigEndian.Uint64(chunk[32:])]
+		switch entryType {
+		case chunkZlib:
+			reader, err := zlib.NewReader(bytes.NewReader(compressed))
+			g.Expect(err).NotTo(HaveOccurred())
+			decompressed, err := ioutil.ReadAll(reader)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(copy(out, decompressed)).To(Equal(len(out)))
+		case chunkRaw:
+			g.Expect(copy(out, compressed)).To(Equal(len(out)))
+		case chunkZeroFill, chunkTerminator:
+		default:
+			g.Expect(entryType).To(BeZero(), fmt.Sprintf("unexpected chunk type %x", entryType))
+		}
+	}
+
+	g.Expect(binary.BigEndian.Uint32(blkx[72:])).To(Equal(crc32.ChecksumIEEE(image)))
+	return image
+}
+
+func readTestCatalog(g *GomegaWithT, image []byte) map[uint32]*testCatalogEntry {
+	header := image[volumeHeaderOffset:]
+	g.Expect(string(header[0:2])).To(Equal("HX"))
+	g.Expect(image[len(image)-1024 : len(image)-512]).To(Equal(header[:512]))
+
+	blockSize := binary.BigEndian.Uint32(header[40:])
+	g.Expect(uint64(binary.BigEndian.Uint32(header[44:])) * uint64(blockSize)).To(Equal(uint64(len(image))))
+
+	catalogFork := header[272:]
+	catalogStart := binary.BigEndian.Uint32(catalogFork[16:])
+	catalog := image[catalogStart*blockSize:][:binary.BigEndian.Uint64(catalogFork[0:])]
+
+	headerRecord := catalog[bTreeNodeDescriptorSize:]
+	nodeSize := int(binary.BigEndian.Uint16(headerRecord[18:]))
+	g.Expect(headerRecord[37]).To(Equal(byte(binaryCompareKeyType)))
+
+	readData := func(fork []byte) []byte {
+		start := binary.BigEndian.Uint32(fork[16:])
+		return image[start*blockSize:][:binary.BigEndian.Uint64(fork[0:])]
+	}
+
+	entries := make(map[uint32]*testCatalogEntry)
+	leafRecords := 0
+	for nodeNumber := binary.BigEndian.Uint32(headerRecord[10:]); nodeNumber != 0; {
+		node := catalog[int(nodeNumber)*nodeSize:][:nodeSize]
+		g.Expect(node[8]).To(Equal(byte(bTreeLeafNode)))
+
+		recordCount := int(binary.BigEndian.Uint16(node[10:]))
+		leafRecords += recordCount
+		for i := 0; i < recordCount; i++ {
+			record := node[binary.BigEndian.Uint16(node[nodeSize-2*(i+1):]):]
+			keyLength := int(binary.BigEndian.Uint16(record)) + 2
+			data := record[keyLength:]
+
+			entry := &testCatalogEntry{parentId: binary.BigEndian.Uint32(record[2:]), name: decodeTestName(record[6:])}
+			switch binary.BigEndian.Uint16(data) {
+			case folderRecordType:
+				entry.isDir = true
+				entry.valence = binary.BigEndian.Uint32(data[4:])
+			case fileRecordType:
+				entry.fileType = string(data[48:52])
+				entry.data = readData(data[88:])
+			default:
+				continue
+			}
+			entry.cnid = binary.BigEndian.Uint32(data[8:])
+			entry.mode = binary.BigEndian.Uint16(data[42:])
+			entry.finderFlags = binary.BigEndian.Uint16(data[56:])
+			entries[entry.cnid] = entry
+		}
+		nodeNumber = binary.BigEndian.Uint32(node[0:])
+	}
+	g.Expect(uint32(leafRecords)).To(Equal(binary.BigEndian.Uint32(headerRecord[6:])))
+	return entries
+}
+
+func decodeTestName(data []byte) string {
+	chars := make([]uint16, binary.BigEndian.Uint16(data))
+	for index := range chars {
+		chars[index] = binary.BigEndian.Uint16(data[2+2*index:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+func findTestEntry(entries map[uint32]*testCatalogEntry, path string) *testCatalogEntry {
+	parentId := uint32(rootFolderId)
+	var result *testCatalogEntry
+	for _, name := range strings.Split(path, "/") {
+		result = nil
+		for _, entry := range entries {
+			if entry.parentId == parentId && entry.name == name {
+				result = entry
+				break
+			}
+		}
+		if result == nil {
+			return nil
+		}
+		parentId = result.cnid
+	}
+	return result
+}
+
+func createTestConfig(g *GomegaWithT, tmpDir string) *Config {
+	sourceDir := filepath.Join(tmpDir, "stage")
+	contentsDir := filepath.Join(sourceDir, "Test.app", "Contents")
+	g.Expect(os.MkdirAll(filepath.Join(contentsDir, "MacOS"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(contentsDir, "Info.plist"), []byte("<plist/>"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(contentsDir, "MacOS", "Test"), bytes.Repeat([]byte("test"), 3*1024*1024), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "icon.icns"), []byte("icns"), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "background.png"), []byte("png"), 0644)).NotTo(HaveOccurred())
+
+	config := &Config{
+		Title:      "Test 1.0.0",
+		SourceDir:  sourceDir,
+		Icon:       filepath.Join(tmpDir, "icon.icns"),
+		Background: filepath.Join(tmpDir, "background.png"),
+		Contents: []ContentConfig{
+			{X: 130, Y: 220, Name: "Test.app"},
+			{X: 410, Y: 220, Type: "link", Path: "/Applications"},
+		},
+		Output: filepath.Join(tmpDir, "out", "test.dmg"),
+	}
+	g.Expect(config.normalize()).NotTo(HaveOccurred())
+	return config
+}
+
+func TestCreateDmg(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "dmg")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	config := createTestConfig(g, tmpDir)
+	var images [][]byte
+	for _, format := range []string{"UDZO", "UDRO"} {
+		config.Format = format
+		g.Expect(CreateDmg(config)).NotTo(HaveOccurred())
+		images = append(images, readTestUdif(g, config.Output))
+	}
+	// the same input - the same image
+	g.Expect(images[1]).To(Equal(images[0]))
+
+	// LZFSE compression is not implemented
+	config.Format = "ULFO"
+	err = CreateDmg(config)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("ULFO"))
+	config.Format = "UDZO"
+
+	entries := readTestCatalog(g, images[0])
+	root := entries[rootFolderId]
+	g.Expect(root.name).To(Equal("Test 1.0.0"))
+	g.Expect(root.finderFlags & hasCustomIconFinderFlag).NotTo(BeZero())
+	g.Expect(root.valence).To(Equal(uint32(5)))
+
+	executable := findTestEntry(entries, "Test.app/Contents/MacOS/Test")
+	g.Expect(executable).NotTo(BeNil())
+	g.Expect(executable.mode).To(Equal(uint16(0100755)))
+	g.Expect(executable.data).To(Equal(bytes.Repeat([]byte("test"), 3*1024*1024)))
+	g.Expect(findTestEntry(entries, "Test.app/Contents/Info.plist").data).To(Equal([]byte("<plist/>")))
+
+	link := findTestEntry(entries, "Applications")
+	g.Expect(link.fileType).To(Equal("slnk"))
+	g.Expect(link.mode & 0170000).To(Equal(uint16(0120000)))
+	g.Expect(string(link.data)).To(Equal("/Applications"))
+
+	icon := findTestEntry(entries, ".VolumeIcon.icns")
+	g.Expect(icon.finderFlags & isInvisibleFinderFlag).NotTo(BeZero())
+	g.Expect(string(icon.data)).To(Equal("icns"))
+	g.Expect(string(findTestEntry(entries, ".background/background.png").data)).To(Equal("png"))
+
+	dsStore := findTestEntry(entries, ".DS_Store").data
+	g.Expect(dsStore[:8]).To(Equal([]byte("\x00\x00\x00\x01Bud1")))
+	g.Expect(bytes.Contains(dsStore, []byte("Iloc"))).To(BeTrue())
+	g.Expect(bytes.Contains(dsStore, []byte("bplist00"))).To(BeTrue())
+}
+
+func TestPlanDmg(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "dmg")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	config := createTestConfig(g, tmpDir)
+	plan, err := PlanDmg(config)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Output).To(Equal(config.Output))
+	g.Expect(plan.Entries).To(ConsistOf(".DS_Store", ".VolumeIcon.icns", ".background", "Applications", "Test.app"))
+	g.Expect(plan.ContentSize).To(BeNumerically(">", 3*4*1024*1024))
+	g.Expect(plan.ImageSize).To(BeNumerically(">", plan.ContentSize))
+
+	// nothing is written
+	g.Expect(filepath.Dir(config.Output)).NotTo(BeADirectory())
+}
+
+func TestCreateDmgManyFiles(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "dmg")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	// several leaf nodes and index node
+	sourceDir := filepath.Join(tmpDir, "stage")
+	g.Expect(os.MkdirAll(filepath.Join(sourceDir, "files"), 0755)).NotTo(HaveOccurred())
+	for i := 0; i < 300; i++ {
+		name := fmt.Sprintf("file-%03d-%s.txt", i, strings.Repeat("x", 40))
+		g.Expect(ioutil.WriteFile(filepath.Join(sourceDir, "files", name), []byte(name), 0644)).NotTo(HaveOccurred())
+	}
+
+	config := &Config{Title: "Test", SourceDir: sourceDir, Output: filepath.Join(tmpDir, "test.dmg")}
+	g.Expect(config.normalize()).NotTo(HaveOccurred())
+	g.Expect(CreateDmg(config)).NotTo(HaveOccurred())
+
+	image := readTestUdif(g, config.Output)
+	entries := readTestCatalog(g, image)
+	files := findTestEntry(entries, "files")
+	g.Expect(files.valence).To(Equal(uint32(300)))
+	name := fmt.Sprintf("file-%03d-%s.txt", 299, strings.Repeat("x", 40))
+	g.Expect(string(findTestEntry(entries, "files/"+name).data)).To(Equal(name))
+
+	// lookup from the root node using index records
+	catalog := image[int(binary.BigEndian.Uint32(image[volumeHeaderOffset+272+16:]))*hfsBlockSize:]
+	g.Expect(binary.BigEndian.Uint16(catalog[bTreeNodeDescriptorSize:])).To(Equal(uint16(2)))
+	hfsName, err := toHfsName(name)
+	g.Expect(err).NotTo(HaveOccurred())
+	key := catalogKey(files.cnid, hfsName)
+	nodeNumber := binary.BigEndian.Uint32(catalog[bTreeNodeDescriptorSize+2:])
+	for {
+		node := catalog[int(nodeNumber)*catalogNodeSize:][:catalogNodeSize]
+		var found []byte
+		for i := 0; i < int(binary.BigEndian.Uint16(node[10:])); i++ {
+			record := node[binary.BigEndian.Uint16(node[catalogNodeSize-2*(i+1):]):]
+			recordKey := record[:binary.BigEndian.Uint16(record)+2]
+			if compareTestKeys(recordKey, key) > 0 {
+				break
+			}
+			found = record
+		}
+		g.Expect(found).NotTo(BeNil())
+		if node[8] == bTreeLeafNode {
+			g.Expect(compareTestKeys(found, key)).To(BeZero())
+			break
+		}
+		nodeNumber = binary.BigEndian.Uint32(found[binary.BigEndian.Uint16(found)+2:])
+	}
+}
+
+func compareTestKeys(a []byte, b []byte) int {
+	aParent := binary.BigEndian.Uint32(a[2:])
+	bParent := binary.BigEndian.Uint32(b[2:])
+	if aParent != bParent {
+		return int(int64(aParent) - int64(bParent))
+	}
+	return bytes.Compare(a[8:binary.BigEndian.Uint16(a)+2], b[8:binary.BigEndian.Uint16(b)+2])
+}
@@ -5,4 +5,16 @@ package dmg
 import "github.com/alecthomas/kingpin"
 
 func ConfigureCommand(app *kingpin.Application) {
-}
\ No newline at end of file
+	command := app.Command("dmg", "Build dmg.")
+
+	configFile := command.Flag("config", "DMG configuration file (JSON, JSON5, YAML or TOML), if specified, dmg is created without hdiutil").Short('c').Required().String()
+	output := command.Flag("output", "output file, overrides output of config").Short('o').String()
+	isDryRun := command.Flag("dry-run", "write plan (volume entries and sizes) as JSON without writing anything").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		if *isDryRun {
+			return writeDmgPlan(*configFile, *output)
+		}
+		return CreateDmgFromConfigFile(*configFile, *output)
+	})
+}
@@ -20,11 +20,28 @@ import (
 func ConfigureCommand(app *kingpin.Application) {
 	command := app.Command("dmg", "Build dmg.")
 
-	volumePath := command.Flag("volume", "").Required().String()
+	volumePath := command.Flag("volume", "").String()
 	icon := command.Flag("icon", "").String()
 	background := command.Flag("background", "").String()
 
+	configFile := command.Flag("config", "DMG configuration file (JSON, JSON5, YAML or TOML), if specified, dmg is created without hdiutil").Short('c').String()
+	output := command.Flag("output", "output file, overrides output of config").Short('o').String()
+	isDryRun := command.Flag("dry-run", "write plan (volume entries and sizes) as JSON without writing anything, config is required").Bool()
+
 	command.Action(func(context *kingpin.ParseContext) error {
+		if *isDryRun {
+			if *configFile == "" {
+				return errors.New("--config must be specified for --dry-run")
+			}
+			return writeDmgPlan(*configFile, *output)
+		}
+		if *configFile != "" {
+			return CreateDmgFromConfigFile(*configFile, *output)
+		}
+		if *volumePath == "" {
+			return errors.New("--volume or --config must be specified")
+		}
+
 		err := BuildDmg(*volumePath, *icon, *background)
 		if err != nil {
 			return errors.WithStack(err)
@@ -0,0 +1,140 @@
+package dmg
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/develar/errors"
+)
+
+// .DS_Store writer - buddy allocator file with the only B-tree ("DSDB") that fits into one leaf node.
+// https://metacpan.org/pod/distribution/Mac-Finder-DSStore/DSStoreFormat.pod
+// Layout is fixed: header, DSDB block (offset 32), root block with allocator info (offset 2048), leaf node (offset 4096).
+
+const (
+	dsStorePageSize = 4096
+
+	dsStoreDsdbOffset = 32
+	dsStoreRootOffset = 2048
+	dsStoreRootSize   = 2048
+	dsStoreLeafOffset = 4096
+)
+
+type dsStoreRecord struct {
+	name     string
+	code     string
+	dataType string
+	data     []byte
+}
+
+func dsStoreBlob(name string, code string, data []byte) dsStoreRecord {
+	blob := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(blob, uint32(len(data)))
+	copy(blob[4:], data)
+	return dsStoreRecord{name, code, "blob", blob}
+}
+
+func dsStoreLong(name string, code string, value uint32) dsStoreRecord {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, value)
+	return dsStoreRecord{name, code, "long", data}
+}
+
+func (t *dsStoreRecord) encode() []byte {
+	name := utf16.Encode([]rune(t.name))
+	result := make([]byte, 4+2*len(name))
+	binary.BigEndian.PutUint32(result, uint32(len(name)))
+	for index, c := range name {
+		binary.BigEndian.PutUint16(result[4+2*index:], c)
+	}
+	result = append(result, t.code...)
+	result = append(result, t.dataType...)
+	return append(result, t.data...)
+}
+
+// icon location: x, y and 0xFFFFFF00 0x00000000 as Finder writes
+func iconLocation(x int, y int) []byte {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint32(data[0:], uint32(x))
+	binary.BigEndian.PutUint32(data[4:], uint32(y))
+	binary.BigEndian.PutUint32(data[8:], 0xFFFFFF00)
+	return data
+}
+
+func encodeDsStore(records []dsStoreRecord) ([]byte, error) {
+	// Finder expects records sorted by file name (case-insensitive) and then by code
+	sort.SliceStable(records, func(i, j int) bool {
+		a := strings.ToLower(records[i].name)
+		b := strings.ToLower(records[j].name)
+		if a != b {
+			return a < b
+		}
+		return records[i].code < records[j].code
+	})
+
+	// leaf node: P = 0 (no children), record count, records
+	leaf := make([]byte, 8, dsStorePageSize)
+	binary.BigEndian.PutUint32(leaf[4:], uint32(len(records)))
+	for _, record := range records {
+		leaf = append(leaf, record.encode()...)
+	}
+	if len(leaf) > dsStorePageSize {
+		return nil, errors.New("too many entries for .DS_Store")
+	}
+
+	// offsets in the file are relative to the position 4 (after alignment header)
+	result := make([]byte, 4+dsStoreLeafOffset+dsStorePageSize)
+	data := result[4:]
+	copy(data[dsStoreLeafOffset:], leaf)
+
+	// header: magic, root block offset, size and offset again
+	binary.BigEndian.PutUint32(result[0:], 1)
+	copy(data[0:4], "Bud1")
+	binary.BigEndian.PutUint32(data[4:], dsStoreRootOffset)
+	binary.BigEndian.PutUint32(data[8:], dsStoreRootSize)
+	binary.BigEndian.PutUint32(data[12:], dsStoreRootOffset)
+
+	// DSDB: root node (block 2), levels, record count, node count, page size
+	dsdb := data[dsStoreDsdbOffset:]
+	binary.BigEndian.PutUint32(dsdb[0:], 2)
+	binary.BigEndian.PutUint32(dsdb[4:], 0)
+	binary.BigEndian.PutUint32(dsdb[8:], uint32(len(records)))
+	binary.BigEndian.PutUint32(dsdb[12:], 1)
+	binary.BigEndian.PutUint32(dsdb[16:], dsStorePageSize)
+
+	writeDsStoreAllocatorInfo(data[dsStoreRootOffset : dsStoreRootOffset+dsStoreRootSize])
+	return result, nil
+}
+
+// block address is offset | log2(size)
+func writeDsStoreAllocatorInfo(data []byte) {
+	blocks := []uint32{dsStoreRootOffset | 11, dsStoreDsdbOffset | 5, dsStoreLeafOffset | 12}
+	binary.BigEndian.PutUint32(data[0:], uint32(len(blocks)))
+	for index, block := range blocks {
+		binary.BigEndian.PutUint32(data[8+4*index:], block)
+	}
+
+	// block address table is padded to 256 entries, then directory: count, name length, name, block number
+	offset := 8 + 256*4
+	binary.BigEndian.PutUint32(data[offset:], 1)
+	data[offset+4] = 4
+	copy(data[offset+5:], "DSDB")
+	binary.BigEndian.PutUint32(data[offset+9:], 1)
+	offset += 13
+
+	// free lists for block sizes 2^0..2^31 - buddies of used blocks
+	for i := uint(0); i < 32; i++ {
+		var free []uint32
+		if (i >= 6 && i <= 10) || (i >= 13 && i <= 30) {
+			free = append(free, 1<<i)
+		}
+		binary.BigEndian.PutUint32(data[offset:], uint32(len(free)))
+		offset += 4
+		for _, freeOffset := range free {
+			binary.BigEndian.PutUint32(data[offset:], freeOffset)
+			offset += 4
+		}
+	}
+}
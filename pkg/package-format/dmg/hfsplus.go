@@ -0,0 +1,602 @@
+package dmg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"golang.org/x/text/unicode/norm"
+)
+
+// HFS+ volume writer - https://developer.apple.com/library/archive/technotes/tn1150/_index.html
+// HFSX variant (case-sensitive, binary compare of names) is used because case-insensitive order requires Apple's case folding table.
+// The volume is written once and never modified: file data is contiguous, extents overflow file is empty, there is no journal.
+
+const (
+	hfsBlockSize       = 4096
+	catalogNodeSize    = 8192
+	extentsNodeSize    = 4096
+	volumeHeaderOffset = 1024
+
+	rootParentId    = 1
+	rootFolderId    = 2
+	firstUserNodeId = 16
+
+	folderRecordType       = 1
+	fileRecordType         = 2
+	folderThreadRecordType = 3
+	fileThreadRecordType   = 4
+
+	folderRecordSize = 88
+	fileRecordSize   = 248
+
+	// kHFSThreadExistsMask
+	fileThreadExistsFlag = 0x0002
+
+	// kHFSVolumeUnmountedBit
+	volumeUnmountedAttribute = 1 << 8
+	// kHFSBinaryCompare
+	binaryCompareKeyType = 0xBC
+
+	hasCustomIconFinderFlag = 0x0400
+	isInvisibleFinderFlag   = 0x4000
+
+	// seconds between 1904-01-01 and 1970-01-01
+	hfsEpochDelta = 2082844800
+
+	// owner and group "unknown", the same as hdiutil uses for volumes with ignored ownership
+	unknownOwnerId = 99
+)
+
+type hfsNode struct {
+	name     string
+	hfsName  []uint16
+	parent   *hfsNode
+	children []*hfsNode
+
+	isDir bool
+	// symlink target if not empty
+	linkTarget string
+	// file to copy data from
+	sourceFile string
+	// in-memory data (e.g. generated .DS_Store)
+	data []byte
+
+	mode        os.FileMode
+	modTime     time.Time
+	finderFlags uint16
+	fileType    string
+	creator     string
+
+	cnid       uint32
+	size       int64
+	startBlock uint32
+	blockCount uint32
+}
+
+func newHfsDir(name string, modTime time.Time) *hfsNode {
+	return &hfsNode{name: name, isDir: true, mode: 0755, modTime: modTime}
+}
+
+// ":" is a path separator in HFS, so, POSIX name "a:b" is stored as "a/b", names are stored in decomposed form
+func toHfsName(name string) ([]uint16, error) {
+	result := utf16.Encode([]rune(norm.NFD.String(strings.Replace(name, ":", "/", -1))))
+	if len(result) > 255 {
+		return nil, errors.Errorf("file name %s is too long for HFS+", name)
+	}
+	return result, nil
+}
+
+func compareHfsNames(a []uint16, b []uint16) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
+
+func (t *hfsNode) addChild(child *hfsNode) error {
+	for _, existing := range t.children {
+		if existing.name == child.name {
+			return errors.Errorf("duplicated entry %s", filepath.Join(t.path(), child.name))
+		}
+	}
+
+	child.parent = t
+	t.children = append(t.children, child)
+	return nil
+}
+
+func (t *hfsNode) findChild(name string) *hfsNode {
+	for _, child := range t.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func (t *hfsNode) removeChild(name string) {
+	for index, child := range t.children {
+		if child.name == name {
+			t.children = append(t.children[:index], t.children[index+1:]...)
+			return
+		}
+	}
+}
+
+func (t *hfsNode) path() string {
+	if t.parent == nil {
+		return "/"
+	}
+	return filepath.Join(t.parent.path(), t.name)
+}
+
+// symlinks are preserved, special files are not supported
+func createHfsNodeFromFile(file string, name string) (*hfsNode, error) {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	node := &hfsNode{name: name, mode: info.Mode().Perm(), modTime: info.ModTime()}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		node.linkTarget, err = os.Readlink(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		node.mode = 0755
+
+	case info.IsDir():
+		node.isDir = true
+		names, err := fsutil.ReadDirContent(file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		for _, childName := range names {
+			child, err := createHfsNodeFromFile(filepath.Join(file, childName), childName)
+			if err != nil {
+				return nil, err
+			}
+			err = node.addChild(child)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case info.Mode().IsRegular():
+		node.sourceFile = file
+		node.size = info.Size()
+
+	default:
+		return nil, errors.Errorf("%s is not a regular file, directory or symlink", file)
+	}
+	return node, nil
+}
+
+type hfsVolume struct {
+	name string
+	root *hfsNode
+	// used as volume create/modify date, the newest modification time of files to get reproducible result
+	date time.Time
+
+	fileCount   uint32
+	folderCount uint32
+	nextCnid    uint32
+}
+
+// children are sorted and catalog node ids are assigned in the order of catalog keys
+func (t *hfsVolume) assignIds() error {
+	t.nextCnid = firstUserNodeId
+	t.root.cnid = rootFolderId
+	t.date = t.root.modTime
+	return t.assignChildIds(t.root)
+}
+
+func (t *hfsVolume) assignChildIds(node *hfsNode) error {
+	for _, child := range node.children {
+		hfsName, err := toHfsName(child.name)
+		if err != nil {
+			return err
+		}
+		child.hfsName = hfsName
+	}
+
+	sort.Slice(node.children, func(i, j int) bool {
+		return compareHfsNames(node.children[i].hfsName, node.children[j].hfsName) < 0
+	})
+
+	for index, child := range node.children {
+		if index > 0 && compareHfsNames(node.children[index-1].hfsName, child.hfsName) == 0 {
+			return errors.Errorf("duplicated entry %s (names are equal after unicode normalization)", filepath.Join(node.path(), child.name))
+		}
+
+		child.cnid = t.nextCnid
+		t.nextCnid++
+		if child.isDir {
+			t.folderCount++
+		} else {
+			t.fileCount++
+		}
+		if child.modTime.After(t.date) {
+			t.date = child.modTime
+		}
+	}
+
+	for _, child := range node.children {
+		if child.isDir {
+			err := t.assignChildIds(child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *hfsVolume) forEachNode(node *hfsNode, consumer func(node *hfsNode)) {
+	consumer(node)
+	for _, child := range node.children {
+		t.forEachNode(child, consumer)
+	}
+}
+
+func catalogKey(parentId uint32, name []uint16) []byte {
+	key := make([]byte, 8+2*len(name))
+	// key length doesn't include itself
+	binary.BigEndian.PutUint16(key[0:], uint16(len(key)-2))
+	binary.BigEndian.PutUint32(key[2:], parentId)
+	putHfsName(key[6:], name)
+	return key
+}
+
+// HFSUniStr255
+func putHfsName(data []byte, name []uint16) {
+	binary.BigEndian.PutUint16(data, uint16(len(name)))
+	for index, c := range name {
+		binary.BigEndian.PutUint16(data[2+2*index:], c)
+	}
+}
+
+func toHfsTime(value time.Time) uint32 {
+	if value.IsZero() {
+		return 0
+	}
+	return uint32(value.Unix() + hfsEpochDelta)
+}
+
+func (t *hfsVolume) createCatalog() (*bTree, error) {
+	rootName, err := toHfsName(t.name)
+	if err != nil {
+		return nil, err
+	}
+	t.root.hfsName = rootName
+
+	var records []bTreeRecord
+	t.forEachNode(t.root, func(node *hfsNode) {
+		parentId := uint32(rootParentId)
+		if node.parent != nil {
+			parentId = node.parent.cnid
+		}
+
+		thread := make([]byte, 10+2*len(node.hfsName))
+		if node.isDir {
+			binary.BigEndian.PutUint16(thread[0:], folderThreadRecordType)
+		} else {
+			binary.BigEndian.PutUint16(thread[0:], fileThreadRecordType)
+		}
+		binary.BigEndian.PutUint32(thread[4:], parentId)
+		putHfsName(thread[8:], node.hfsName)
+
+		records = append(records,
+			bTreeRecord{key: catalogKey(node.cnid, nil), data: thread},
+			bTreeRecord{key: catalogKey(parentId, node.hfsName), data: t.createCatalogRecord(node)},
+		)
+	})
+
+	sort.Slice(records, func(i, j int) bool {
+		a := records[i].key
+		b := records[j].key
+		aParent := binary.BigEndian.Uint32(a[2:])
+		bParent := binary.BigEndian.Uint32(b[2:])
+		if aParent != bParent {
+			return aParent < bParent
+		}
+		return bytes.Compare(a[8:], b[8:]) < 0
+	})
+
+	return buildBTree(records, catalogNodeSize, 516, binaryCompareKeyType, bTreeBigKeysMask|bTreeVariableIndexKeysMask)
+}
+
+func (t *hfsVolume) createCatalogRecord(node *hfsNode) []byte {
+	// generated entries (e.g. links) don't have own modification time
+	modTime := toHfsTime(node.modTime)
+	if modTime == 0 {
+		modTime = toHfsTime(t.date)
+	}
+	if node.isDir {
+		record := make([]byte, folderRecordSize)
+		binary.BigEndian.PutUint16(record[0:], folderRecordType)
+		binary.BigEndian.PutUint32(record[4:], uint32(len(node.children)))
+		binary.BigEndian.PutUint32(record[8:], node.cnid)
+		putDates(record[12:], modTime)
+		putPermissions(record[32:], 0040000|uint16(node.mode.Perm()))
+		binary.BigEndian.PutUint16(record[56:], node.finderFlags)
+		return record
+	}
+
+	record := make([]byte, fileRecordSize)
+	binary.BigEndian.PutUint16(record[0:], fileRecordType)
+	binary.BigEndian.PutUint16(record[2:], fileThreadExistsFlag)
+	binary.BigEndian.PutUint32(record[8:], node.cnid)
+	putDates(record[12:], modTime)
+	if len(node.linkTarget) != 0 {
+		putPermissions(record[32:], 0120000|uint16(node.mode.Perm()))
+		copy(record[48:52], "slnk")
+		copy(record[52:56], "rhap")
+	} else {
+		putPermissions(record[32:], 0100000|uint16(node.mode.Perm()))
+		copy(record[48:52], node.fileType)
+		copy(record[52:56], node.creator)
+	}
+	binary.BigEndian.PutUint16(record[56:], node.finderFlags)
+	putForkData(record[88:], uint64(node.size), node.startBlock, node.blockCount)
+	return record
+}
+
+// create, content modification, attribute modification, access and backup dates
+func putDates(data []byte, date uint32) {
+	for i := 0; i < 4; i++ {
+		binary.BigEndian.PutUint32(data[i*4:], date)
+	}
+}
+
+// HFSPlusBSDInfo
+func putPermissions(data []byte, mode uint16) {
+	binary.BigEndian.PutUint32(data[0:], unknownOwnerId)
+	binary.BigEndian.PutUint32(data[4:], unknownOwnerId)
+	binary.BigEndian.PutUint16(data[10:], mode)
+}
+
+// HFSPlusForkData with the only extent
+func putForkData(data []byte, logicalSize uint64, startBlock uint32, blockCount uint32) {
+	binary.BigEndian.PutUint64(data[0:], logicalSize)
+	binary.BigEndian.PutUint32(data[12:], blockCount)
+	if blockCount != 0 {
+		binary.BigEndian.PutUint32(data[16:], startBlock)
+		binary.BigEndian.PutUint32(data[20:], blockCount)
+	}
+}
+
+func blocksFor(size int64) uint32 {
+	return uint32((size + hfsBlockSize - 1) / hfsBlockSize)
+}
+
+type hfsLayout struct {
+	totalBlocks uint32
+
+	allocationStart  uint32
+	allocationBlocks uint32
+	extentsStart     uint32
+	catalogStart     uint32
+	catalogBlocks    uint32
+
+	files []*hfsNode
+}
+
+// block 0 contains boot blocks and volume header, the last block contains alternate volume header,
+// special files follow the volume header and file data follows special files
+func (t *hfsVolume) computeLayout(catalog *bTree) *hfsLayout {
+	layout := &hfsLayout{
+		catalogBlocks: blocksFor(int64(catalog.nodeCount() * catalogNodeSize)),
+	}
+
+	dataBlocks := uint32(0)
+	t.forEachNode(t.root, func(node *hfsNode) {
+		if len(node.linkTarget) != 0 {
+			node.size = int64(len(node.linkTarget))
+		} else if node.data != nil {
+			node.size = int64(len(node.data))
+		}
+		if !node.isDir && node.size > 0 {
+			node.blockCount = blocksFor(node.size)
+			dataBlocks += node.blockCount
+			layout.files = append(layout.files, node)
+		}
+	})
+
+	// size of allocation file depends on total block count
+	extentsBlocks := uint32(extentsNodeSize / hfsBlockSize)
+	for {
+		totalBlocks := 1 + layout.allocationBlocks + extentsBlocks + layout.catalogBlocks + dataBlocks + 1
+		allocationBlocks := blocksFor(int64((totalBlocks + 7) / 8))
+		if allocationBlocks == layout.allocationBlocks {
+			layout.totalBlocks = totalBlocks
+			break
+		}
+		layout.allocationBlocks = allocationBlocks
+	}
+
+	layout.allocationStart = 1
+	layout.extentsStart = layout.allocationStart + layout.allocationBlocks
+	layout.catalogStart = layout.extentsStart + extentsBlocks
+	nextBlock := layout.catalogStart + layout.catalogBlocks
+	for _, node := range layout.files {
+		node.startBlock = nextBlock
+		nextBlock += node.blockCount
+	}
+	return layout
+}
+
+// assignIds must be called before
+func (t *hfsVolume) write(outFile string) error {
+	// record sizes don't depend on extents, so, catalog is created to compute layout and then created again with actual extents
+	catalog, err := t.createCatalog()
+	if err != nil {
+		return err
+	}
+	layout := t.computeLayout(catalog)
+	catalog, err = t.createCatalog()
+	if err != nil {
+		return err
+	}
+
+	catalogData, err := catalog.write(int(layout.catalogBlocks) * hfsBlockSize / catalogNodeSize)
+	if err != nil {
+		return err
+	}
+
+	extents, err := buildBTree(nil, extentsNodeSize, 10, 0, bTreeBigKeysMask)
+	if err != nil {
+		return err
+	}
+	extentsData, err := extents.write(1)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = t.writeImage(file, layout, catalogData, extentsData)
+	return fsutil.CloseAndCheckError(err, file)
+}
+
+func (t *hfsVolume) writeImage(file *os.File, layout *hfsLayout, catalogData []byte, extentsData []byte) error {
+	imageSize := int64(layout.totalBlocks) * hfsBlockSize
+	err := file.Truncate(imageSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	header := t.createVolumeHeader(layout, len(catalogData), len(extentsData))
+	_, err = file.WriteAt(header, volumeHeaderOffset)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = file.WriteAt(header, imageSize-1024)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// all blocks are used
+	bitmap := make([]byte, layout.allocationBlocks*hfsBlockSize)
+	for i := uint32(0); i < layout.totalBlocks; i++ {
+		bitmap[i/8] |= 0x80 >> (i % 8)
+	}
+
+	for _, item := range []struct {
+		data  []byte
+		block uint32
+	}{{bitmap, layout.allocationStart}, {extentsData, layout.extentsStart}, {catalogData, layout.catalogStart}} {
+		_, err = file.WriteAt(item.data, int64(item.block)*hfsBlockSize)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, node := range layout.files {
+		err = writeNodeData(file, node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeNodeData(file *os.File, node *hfsNode) error {
+	offset := int64(node.startBlock) * hfsBlockSize
+	if len(node.linkTarget) != 0 {
+		_, err := file.WriteAt([]byte(node.linkTarget), offset)
+		return errors.WithStack(err)
+	}
+	if node.data != nil {
+		_, err := file.WriteAt(node.data, offset)
+		return errors.WithStack(err)
+	}
+
+	source, err := os.Open(node.sourceFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer util.Close(source)
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	written, err := io.CopyN(file, source, node.size)
+	if err != nil {
+		return errors.WithMessage(err, "cannot copy "+node.sourceFile)
+	}
+	if written != node.size {
+		return errors.Errorf("%s was modified during dmg creation", node.sourceFile)
+	}
+	return nil
+}
+
+func (t *hfsVolume) createVolumeHeader(layout *hfsLayout, catalogSize int, extentsSize int) []byte {
+	header := make([]byte, 512)
+	// HX
+	binary.BigEndian.PutUint16(header[0:], 0x4858)
+	binary.BigEndian.PutUint16(header[2:], 5)
+	binary.BigEndian.PutUint32(header[4:], volumeUnmountedAttribute)
+	copy(header[8:12], "10.0")
+
+	date := toHfsTime(t.date)
+	for i := 0; i < 4; i++ {
+		binary.BigEndian.PutUint32(header[16+i*4:], date)
+	}
+	binary.BigEndian.PutUint32(header[32:], t.fileCount)
+	binary.BigEndian.PutUint32(header[36:], t.folderCount)
+	binary.BigEndian.PutUint32(header[40:], hfsBlockSize)
+	binary.BigEndian.PutUint32(header[44:], layout.totalBlocks)
+	binary.BigEndian.PutUint32(header[48:], 0)
+	binary.BigEndian.PutUint32(header[52:], layout.totalBlocks-1)
+	binary.BigEndian.PutUint32(header[56:], 65536)
+	binary.BigEndian.PutUint32(header[60:], 65536)
+	binary.BigEndian.PutUint32(header[64:], t.nextCnid)
+	binary.BigEndian.PutUint32(header[68:], 1)
+	// MacRoman
+	binary.BigEndian.PutUint64(header[72:], 1)
+
+	// finder info: blessed folder and folder to open on mount (as "bless --openfolder" does), volume UUID
+	binary.BigEndian.PutUint32(header[80:], rootFolderId)
+	binary.BigEndian.PutUint32(header[88:], rootFolderId)
+	copy(header[104:112], t.uuid())
+
+	putForkData(header[112:], uint64(layout.allocationBlocks)*hfsBlockSize, layout.allocationStart, layout.allocationBlocks)
+	putForkData(header[192:], uint64(extentsSize), layout.extentsStart, blocksFor(int64(extentsSize)))
+	putForkData(header[272:], uint64(catalogSize), layout.catalogStart, layout.catalogBlocks)
+	// clump size
+	binary.BigEndian.PutUint32(header[192+8:], extentsNodeSize)
+	binary.BigEndian.PutUint32(header[272+8:], catalogNodeSize)
+	return header
+}
+
+// deterministic, depends on volume name, date and file count
+func (t *hfsVolume) uuid() []byte {
+	data := make([]byte, 12)
+	binary.BigEndian.PutUint32(data[0:], toHfsTime(t.date))
+	binary.BigEndian.PutUint32(data[4:], t.fileCount)
+	binary.BigEndian.PutUint32(data[8:], t.folderCount)
+	return hashToUuid(append(data, t.name...))[:8]
+}
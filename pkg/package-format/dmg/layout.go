@@ -0,0 +1,84 @@
+package dmg
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	_ "golang.org/x/image/tiff"
+)
+
+const (
+	layoutError   = "error"
+	layoutWarning = "warning"
+)
+
+type LayoutIssue struct {
+	// error or warning
+	Level string `json:"level"`
+	// name of content entry if issue is about icon position
+	Entry   string `json:"entry,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidateLayout checks that window matches background (size of 1x image, nil if there is no background) and icons are inside of window.
+// Finder doesn't scale background: the bigger window shows empty area, the smaller one crops background.
+func ValidateLayout(config *Config, backgroundSize *image.Point) []LayoutIssue {
+	var result []LayoutIssue
+	window := config.Window
+	if backgroundSize != nil && (window.Width != backgroundSize.X || window.Height != backgroundSize.Y) {
+		level := layoutWarning
+		if window.Width > backgroundSize.X || window.Height > backgroundSize.Y {
+			level = layoutError
+		}
+		result = append(result, LayoutIssue{
+			Level:   level,
+			Message: fmt.Sprintf("window size %dx%d doesn't match background size %dx%d", window.Width, window.Height, backgroundSize.X, backgroundSize.Y),
+		})
+	}
+
+	// position is the center of icon, label is below icon
+	halfIconSize := config.IconSize / 2
+	labelHeight := config.IconTextSize + 4
+	for _, content := range config.Contents {
+		if content.X-halfIconSize < 0 || content.Y-halfIconSize < 0 || content.X+halfIconSize > window.Width || content.Y+halfIconSize+labelHeight > window.Height {
+			result = append(result, LayoutIssue{
+				Level:   layoutWarning,
+				Entry:   content.GetName(),
+				Message: fmt.Sprintf("icon at (%d, %d) is not fully inside of window %dx%d (icon size %d)", content.X, content.Y, window.Width, window.Height, config.IconSize),
+			})
+		}
+	}
+	return result
+}
+
+// background size is not checked if background cannot be decoded (e.g. format is not supported)
+func (t *Config) validateLayout() []LayoutIssue {
+	var backgroundSize *image.Point
+	if len(t.Background) != 0 {
+		var err error
+		backgroundSize, err = readImageSize(t.Background)
+		if err != nil {
+			log.WithError(err).Debug("size of background is unknown, window size is not validated")
+		}
+	}
+	return ValidateLayout(t, backgroundSize)
+}
+
+// size of the first image (1x for multi-resolution TIFF)
+func readImageSize(file string) (*image.Point, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer util.Close(reader)
+
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read size of %s", file)
+	}
+	return &image.Point{X: config.Width, Y: config.Height}, nil
+}
@@ -0,0 +1,276 @@
+package dmg
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// UDIF (Universal Disk Image Format) writer: data fork with compressed chunks, XML property list with chunk table (blkx) and koly trailer.
+// Disk image contains the only partition without partition map (the same as hdiutil -layout NONE).
+
+const (
+	sectorSize = 512
+	// 1 MB
+	chunkSectorCount = 2048
+
+	chunkZeroFill   = 0x00000000
+	chunkRaw        = 0x00000001
+	chunkZlib       = 0x80000005
+	chunkTerminator = 0xFFFFFFFF
+
+	udifChecksumCrc32 = 2
+
+	blkxHeaderSize = 204
+	blkxChunkSize  = 40
+	kolySize       = 512
+
+	partitionName = "whole disk (Apple_HFS : 0)"
+)
+
+type blkxChunk struct {
+	entryType        uint32
+	sectorNumber     uint64
+	sectorCount      uint64
+	compressedOffset uint64
+	compressedLength uint64
+}
+
+// raw image is read chunk by chunk, so, memory usage doesn't depend on image size
+func writeUdif(imageFile string, outFile string, format string) error {
+	image, err := os.Open(imageFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer util.Close(image)
+
+	info, err := image.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if info.Size()%sectorSize != 0 {
+		return errors.Errorf("size of disk image must be a multiple of %d", sectorSize)
+	}
+
+	out, err := fsutil.CreateFile(outFile)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = writeUdifData(image, uint64(info.Size()/sectorSize), out, format)
+	return fsutil.CloseAndCheckError(err, out)
+}
+
+func writeUdifData(image io.Reader, sectorCount uint64, out io.Writer, format string) error {
+	dataChecksum := crc32.NewIEEE()
+	rawChecksum := crc32.NewIEEE()
+	dataWriter := io.MultiWriter(out, dataChecksum)
+
+	var chunks []blkxChunk
+	buffer := make([]byte, chunkSectorCount*sectorSize)
+	var compressed bytes.Buffer
+	dataOffset := uint64(0)
+	for sector := uint64(0); sector < sectorCount; sector += chunkSectorCount {
+		count := sectorCount - sector
+		if count > chunkSectorCount {
+			count = chunkSectorCount
+		}
+
+		data := buffer[:count*sectorSize]
+		_, err := io.ReadFull(image, data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, _ = rawChecksum.Write(data)
+
+		chunk := blkxChunk{sectorNumber: sector, sectorCount: count, compressedOffset: dataOffset}
+		if isZero(data) {
+			chunk.entryType = chunkZeroFill
+			chunks = append(chunks, chunk)
+			continue
+		}
+
+		compressed.Reset()
+		chunk.entryType, err = compressChunk(data, format, &compressed)
+		if err != nil {
+			return err
+		}
+
+		_, err = dataWriter.Write(compressed.Bytes())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		chunk.compressedLength = uint64(compressed.Len())
+		dataOffset += chunk.compressedLength
+		chunks = append(chunks, chunk)
+	}
+	chunks = append(chunks, blkxChunk{entryType: chunkTerminator, sectorNumber: sectorCount, compressedOffset: dataOffset})
+
+	blkx := encodeBlkx(chunks, sectorCount, rawChecksum.Sum32())
+	plist := createUdifPlist(blkx)
+	_, err := out.Write(plist)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	koly := createKoly(dataOffset, uint64(len(plist)), sectorCount, dataChecksum.Sum32(), rawChecksum.Sum32())
+	_, err = out.Write(koly)
+	return errors.WithStack(err)
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func compressChunk(data []byte, format string, out *bytes.Buffer) (uint32, error) {
+	switch format {
+	case "UDZO":
+		writer, err := zlib.NewWriterLevel(out, zlib.BestCompression)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		_, err = writer.Write(data)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return chunkZlib, errors.WithStack(writer.Close())
+
+	case "UDRO":
+		out.Write(data)
+		return chunkRaw, nil
+
+	default:
+		// ULFO is not supported - there is no LZFSE encoder in Go
+		return 0, errors.Errorf("format %s is not supported, only UDZO and UDRO are supported without hdiutil", format)
+	}
+}
+
+// UDIFChecksum: type, size in bits, 32 uint32 values
+func putUdifChecksum(data []byte, crc uint32) {
+	binary.BigEndian.PutUint32(data[0:], udifChecksumCrc32)
+	binary.BigEndian.PutUint32(data[4:], 32)
+	binary.BigEndian.PutUint32(data[8:], crc)
+}
+
+// BLKXTable ("mish")
+func encodeBlkx(chunks []blkxChunk, sectorCount uint64, rawChecksum uint32) []byte {
+	result := make([]byte, blkxHeaderSize+blkxChunkSize*len(chunks))
+	copy(result[0:4], "mish")
+	binary.BigEndian.PutUint32(result[4:], 1)
+	binary.BigEndian.PutUint64(result[16:], sectorCount)
+	binary.BigEndian.PutUint32(result[32:], chunkSectorCount+8)
+	putUdifChecksum(result[64:], rawChecksum)
+	binary.BigEndian.PutUint32(result[200:], uint32(len(chunks)))
+
+	for index, chunk := range chunks {
+		data := result[blkxHeaderSize+blkxChunkSize*index:]
+		binary.BigEndian.PutUint32(data[0:], chunk.entryType)
+		binary.BigEndian.PutUint64(data[8:], chunk.sectorNumber)
+		binary.BigEndian.PutUint64(data[16:], chunk.sectorCount)
+		binary.BigEndian.PutUint64(data[24:], chunk.compressedOffset)
+		binary.BigEndian.PutUint64(data[32:], chunk.compressedLength)
+	}
+	return result
+}
+
+func createUdifPlist(blkx []byte) []byte {
+	encodedBlkx := base64.StdEncoding.EncodeToString(blkx)
+
+	var builder strings.Builder
+	builder.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>resource-fork</key>
+	<dict>
+		<key>blkx</key>
+		<array>
+			<dict>
+				<key>Attributes</key>
+				<string>0x0050</string>
+				<key>CFName</key>
+				<string>` + partitionName + `</string>
+				<key>Data</key>
+				<data>
+`)
+	for len(encodedBlkx) > 0 {
+		lineLength := 52
+		if lineLength > len(encodedBlkx) {
+			lineLength = len(encodedBlkx)
+		}
+		builder.WriteString("\t\t\t\t")
+		builder.WriteString(encodedBlkx[:lineLength])
+		builder.WriteString("\n")
+		encodedBlkx = encodedBlkx[lineLength:]
+	}
+	builder.WriteString(`				</data>
+				<key>ID</key>
+				<string>-1</string>
+				<key>Name</key>
+				<string>` + partitionName + `</string>
+			</dict>
+		</array>
+	</dict>
+</dict>
+</plist>
+`)
+	return []byte(builder.String())
+}
+
+func createKoly(dataForkLength uint64, xmlLength uint64, sectorCount uint64, dataChecksum uint32, rawChecksum uint32) []byte {
+	result := make([]byte, kolySize)
+	copy(result[0:4], "koly")
+	binary.BigEndian.PutUint32(result[4:], 4)
+	binary.BigEndian.PutUint32(result[8:], kolySize)
+	// kUDIFFlagsFlattened
+	binary.BigEndian.PutUint32(result[12:], 1)
+	binary.BigEndian.PutUint64(result[32:], dataForkLength)
+	// segment number and count
+	binary.BigEndian.PutUint32(result[56:], 1)
+	binary.BigEndian.PutUint32(result[60:], 1)
+
+	checksumBytes := make([]byte, 12)
+	binary.BigEndian.PutUint32(checksumBytes[0:], dataChecksum)
+	binary.BigEndian.PutUint32(checksumBytes[4:], rawChecksum)
+	binary.BigEndian.PutUint32(checksumBytes[8:], uint32(sectorCount))
+	copy(result[64:80], hashToUuid(checksumBytes))
+
+	putUdifChecksum(result[80:], dataChecksum)
+	// XML follows data fork
+	binary.BigEndian.PutUint64(result[216:], dataForkLength)
+	binary.BigEndian.PutUint64(result[224:], xmlLength)
+
+	// master checksum - checksum of blkx checksums
+	blkxChecksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(blkxChecksum, rawChecksum)
+	putUdifChecksum(result[352:], crc32.ChecksumIEEE(blkxChecksum))
+
+	// image variant: device image
+	binary.BigEndian.PutUint32(result[488:], 1)
+	binary.BigEndian.PutUint64(result[492:], sectorCount)
+	return result
+}
+
+// name-based (version 5) UUID is not required, but UUID variant and version bits are set to get a well-formed value
+func hashToUuid(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	result := hash[:16]
+	result[6] = (result[6] & 0x0f) | 0x50
+	result[8] = (result[8] & 0x3f) | 0x80
+	return result
+}
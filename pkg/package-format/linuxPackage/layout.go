@@ -0,0 +1,187 @@
+package linuxPackage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/errors"
+)
+
+// Layout of files installed by deb, rpm and pacman packages
+type Layout struct {
+	// unpacked app dir (linux-unpacked)
+	AppDir string `json:"appDir"`
+	// default: /opt/<name>
+	InstallDir string `json:"installDir"`
+	// package name, used as name of executable link, desktop file and icons
+	Name string `json:"name"`
+	// relative to app dir, /usr/bin/<name> symlink is created if specified
+	Executable string `json:"executable"`
+	// installed to /usr/share/applications/<name>.desktop
+	DesktopFile string `json:"desktopFile"`
+	// installed to /usr/share/icons/hicolor/<size>x<size>/apps/<name>.png (SVG without size to scalable/apps)
+	Icons []icons.IconInfo `json:"icons"`
+}
+
+// FileEntry is a file, dir or symlink of package, path is absolute (e.g. /opt/foo/foo)
+type FileEntry struct {
+	Path string
+	// empty for dirs and symlinks
+	Source     string
+	LinkTarget string
+	Mode       os.FileMode
+	Size       int64
+}
+
+func (t *FileEntry) IsDir() bool {
+	return t.Mode.IsDir()
+}
+
+func (t *FileEntry) IsSymlink() bool {
+	return t.Mode&os.ModeSymlink != 0
+}
+
+func (t *Layout) GetInstallDir() string {
+	if len(t.InstallDir) != 0 {
+		return t.InstallDir
+	}
+	return "/opt/" + t.Name
+}
+
+// Collect returns all entries (including parent dirs) sorted by path, parent dir is always before its children
+func (t *Layout) Collect() ([]FileEntry, error) {
+	if len(t.AppDir) == 0 || len(t.Name) == 0 {
+		return nil, errors.New("app dir and name must be specified")
+	}
+
+	installDir := t.GetInstallDir()
+	result, err := collectDir(filepath.Clean(t.AppDir), installDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t.Executable) != 0 {
+		result = append(result, FileEntry{Path: "/usr/bin/" + t.Name, LinkTarget: path.Join(installDir, filepath.ToSlash(t.Executable)), Mode: os.ModeSymlink | 0777})
+	}
+
+	if len(t.DesktopFile) != 0 {
+		entry, err := createFileEntry(t.DesktopFile, "/usr/share/applications/"+t.Name+".desktop")
+		if err != nil {
+			return nil, err
+		}
+		entry.Mode = 0644
+		result = append(result, *entry)
+	}
+
+	for _, icon := range t.Icons {
+		sizeDir := "scalable"
+		if icon.Size > 0 {
+			sizeDir = fmt.Sprintf("%dx%d", icon.Size, icon.Size)
+		} else if filepath.Ext(icon.File) != ".svg" {
+			return nil, errors.Errorf("size of icon %s is not specified", icon.File)
+		}
+
+		entry, err := createFileEntry(icon.File, "/usr/share/icons/hicolor/"+sizeDir+"/apps/"+t.Name+filepath.Ext(icon.File))
+		if err != nil {
+			return nil, err
+		}
+		entry.Mode = 0644
+		result = append(result, *entry)
+	}
+
+	return addParentDirs(result), nil
+}
+
+func createFileEntry(file string, packagePath string) (*FileEntry, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &FileEntry{Path: packagePath, Source: file, Mode: info.Mode(), Size: info.Size()}, nil
+}
+
+// symlinks are preserved
+func collectDir(dir string, packageDir string) ([]FileEntry, error) {
+	var result []FileEntry
+	var mutex sync.Mutex
+	err := fs.Walk(dir, 0, func(file string, info os.FileInfo) error {
+		relativePath, err := filepath.Rel(dir, file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		entry := FileEntry{Path: path.Join(packageDir, filepath.ToSlash(relativePath)), Mode: info.Mode()}
+		switch {
+		case info.IsDir():
+			entry.Mode = os.ModeDir | 0755
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.LinkTarget, err = os.Readlink(file)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		case info.Mode().IsRegular():
+			entry.Source = file
+			entry.Size = info.Size()
+		default:
+			return nil
+		}
+
+		mutex.Lock()
+		result = append(result, entry)
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func addParentDirs(entries []FileEntry) []FileEntry {
+	existing := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		existing[entry.Path] = true
+	}
+
+	for _, entry := range entries {
+		for dir := path.Dir(entry.Path); dir != "/" && !existing[dir]; dir = path.Dir(dir) {
+			existing[dir] = true
+			entries = append(entries, FileEntry{Path: dir, Mode: os.ModeDir | 0755})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// InstalledSize returns total size of files in KiB
+func InstalledSize(entries []FileEntry) int64 {
+	var result int64
+	for _, entry := range entries {
+		result += entry.Size
+	}
+	return (result + 1023) / 1024
+}
+
+// GetModificationTime returns SOURCE_DATE_EPOCH (reproducible builds) or current time
+func GetModificationTime() time.Time {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if len(value) != 0 {
+		seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err == nil {
+			return time.Unix(seconds, 0)
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,137 @@
+package linuxPackage
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/develar/app-builder/pkg/archive"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+// WriteTar writes entries owned by root, path is prefixed (e.g. "." for deb data.tar - ./opt/foo)
+func WriteTar(entries []FileEntry, writer io.Writer, prefix string, modTime time.Time) error {
+	tarWriter := tar.NewWriter(writer)
+	err := AddTarEntries(tarWriter, entries, prefix, modTime)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(tarWriter.Close())
+}
+
+// AddTarEntries is WriteTar for already created tar writer (to mix in-memory and package files in one archive)
+func AddTarEntries(tarWriter *tar.Writer, entries []FileEntry, prefix string, modTime time.Time) error {
+	for index := range entries {
+		entry := &entries[index]
+		header := &tar.Header{
+			Name:    strings.TrimPrefix(prefix+entry.Path, "/"),
+			Mode:    int64(entry.Mode.Perm()),
+			ModTime: modTime,
+			Uname:   "root",
+			Gname:   "root",
+			Format:  tar.FormatGNU,
+		}
+
+		switch {
+		case entry.IsDir():
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		case entry.IsSymlink():
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.LinkTarget
+		default:
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.Size
+		}
+
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			err = CopyFile(entry.Source, tarWriter)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CopyFile writes content of file to writer
+func CopyFile(file string, writer io.Writer) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	_, err = io.Copy(writer, reader)
+	return errors.WithStack(err)
+}
+
+// WriteCompressedFile creates file and passes compressing writer to write (see archive.NewCompressWriter)
+func WriteCompressedFile(file string, compression string, write func(writer io.Writer) error) error {
+	outFile, err := os.Create(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	compressWriter, err := archive.NewCompressWriter(outFile, compression)
+	if err != nil {
+		return fsutil.CloseAndCheckError(err, outFile)
+	}
+
+	err = write(compressWriter)
+	closeErr := compressWriter.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return fsutil.CloseAndCheckError(err, outFile)
+}
+
+// TarFileEntry is an in-memory file for control archives (e.g. control, md5sums, maintainer scripts)
+type TarFileEntry struct {
+	Name string
+	Data []byte
+	Mode int64
+}
+
+func WriteTarFiles(files []TarFileEntry, writer io.Writer, modTime time.Time) error {
+	tarWriter := tar.NewWriter(writer)
+	err := AddTarFiles(tarWriter, files, modTime)
+	if err != nil {
+		return err
+	}
+	return errors.WithStack(tarWriter.Close())
+}
+
+func AddTarFiles(tarWriter *tar.Writer, files []TarFileEntry, modTime time.Time) error {
+	for _, file := range files {
+		err := tarWriter.WriteHeader(&tar.Header{
+			Name:     file.Name,
+			Mode:     file.Mode,
+			Size:     int64(len(file.Data)),
+			ModTime:  modTime,
+			Typeflag: tar.TypeReg,
+			Uname:    "root",
+			Gname:    "root",
+			Format:   tar.FormatGNU,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		_, err = tarWriter.Write(file.Data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package msix
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/disintegration/imaging"
+)
+
+type assetDescriptor struct {
+	name   string
+	width  int
+	height int
+	// Square44x44Logo is also used in taskbar and start menu list, where target size variants are picked
+	isTargetSize bool
+}
+
+var assetDescriptors = []assetDescriptor{
+	{name: "StoreLogo", width: 50, height: 50},
+	{name: "Square44x44Logo", width: 44, height: 44, isTargetSize: true},
+	{name: "SmallTile", width: 71, height: 71},
+	{name: "Square150x150Logo", width: 150, height: 150},
+	{name: "Wide310x150Logo", width: 310, height: 150},
+	{name: "LargeTile", width: 310, height: 310},
+	{name: "SplashScreen", width: 620, height: 300},
+}
+
+var assetScales = []int{100, 125, 150, 200, 400}
+
+var assetTargetSizes = []int{16, 24, 32, 48, 256}
+
+type AssetInfo struct {
+	File   string `json:"file"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type assetTask struct {
+	file   string
+	width  int
+	height int
+}
+
+// icon is centered on transparent canvas for non-square assets (tile background color is set in the manifest)
+func generateAssets(iconFile string, assetDir string) ([]AssetInfo, error) {
+	source, err := icons.LoadImage(iconFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fsutil.EnsureDir(assetDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	tasks := createAssetTasks(assetDir)
+	result := make([]AssetInfo, len(tasks))
+	err = util.MapAsync(len(tasks), func(taskIndex int) (func() error, error) {
+		task := tasks[taskIndex]
+		return func() error {
+			err := icons.SaveImage(renderAsset(source, task.width, task.height), task.file, icons.PNG)
+			if err != nil {
+				return err
+			}
+			result[taskIndex] = AssetInfo{File: task.file, Width: task.width, Height: task.height}
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func createAssetTasks(assetDir string) []assetTask {
+	var result []assetTask
+	for _, descriptor := range assetDescriptors {
+		// manifest references unqualified name, qualified variants are picked only if resources.pri is generated (makepri is not used),
+		// so, the unqualified file (scale 100) must exist
+		result = append(result, assetTask{
+			file:   filepath.Join(assetDir, descriptor.name+".png"),
+			width:  descriptor.width,
+			height: descriptor.height,
+		})
+
+		for _, scale := range assetScales {
+			result = append(result, assetTask{
+				file:   filepath.Join(assetDir, fmt.Sprintf("%s.scale-%d.png", descriptor.name, scale)),
+				width:  descriptor.width * scale / 100,
+				height: descriptor.height * scale / 100,
+			})
+		}
+
+		if descriptor.isTargetSize {
+			for _, size := range assetTargetSizes {
+				// unplated variant is shown without the accent color plate in taskbar
+				for _, suffix := range []string{"", "_altform-unplated"} {
+					result = append(result, assetTask{
+						file:   filepath.Join(assetDir, fmt.Sprintf("%s.targetsize-%d%s.png", descriptor.name, size, suffix)),
+						width:  size,
+						height: size,
+					})
+				}
+			}
+		}
+	}
+	return result
+}
+
+func renderAsset(source image.Image, width int, height int) image.Image {
+	iconSize := width
+	if height < iconSize {
+		iconSize = height
+	}
+
+	icon := imaging.Resize(source, iconSize, iconSize, imaging.Lanczos)
+	if width == height {
+		return icon
+	}
+
+	canvas := imaging.New(width, height, color.Transparent)
+	return imaging.PasteCenter(canvas, icon)
+}
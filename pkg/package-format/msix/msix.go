@@ -0,0 +1,332 @@
+package msix
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+type Configuration struct {
+	// package identity, Publisher must match the subject of signing certificate (e.g. CN=Foo)
+	IdentityName         string `json:"identityName"`
+	Publisher            string `json:"publisher"`
+	PublisherDisplayName string `json:"publisherDisplayName"`
+	DisplayName          string `json:"displayName"`
+	Description          string `json:"description"`
+	// semver is converted to 4-part version, pre-release suffix is dropped
+	Version string `json:"version"`
+	// x64 (default), ia32 or arm64
+	Arch string `json:"arch"`
+
+	// default: identity name without dots and dashes
+	ApplicationId string `json:"applicationId"`
+	// relative to app dir
+	Executable      string `json:"executable"`
+	BackgroundColor string `json:"backgroundColor"`
+
+	Languages        []string `json:"languages"`
+	MinVersion       string   `json:"minVersion"`
+	MaxVersionTested string   `json:"maxVersionTested"`
+	// runFullTrust is always added
+	Capabilities []string `json:"capabilities"`
+
+	// the same as for icon command
+	IconSources         []string `json:"icon"`
+	IconFallbackSources []string `json:"iconFallback"`
+	IconRoots           []string `json:"iconRoots"`
+}
+
+type Result struct {
+	Manifest string      `json:"manifest"`
+	Assets   []AssetInfo `json:"assets"`
+	// empty if output is not specified or makeappx is not available
+	Package string `json:"package,omitempty"`
+}
+
+var applicationIdRegExp = regexp.MustCompile("[^a-zA-Z0-9]")
+
+var archNames = map[string]string{
+	"x64":   "x64",
+	"ia32":  "x86",
+	"arm64": "arm64",
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("msix", "Generate AppxManifest.xml and tile assets in the app dir and pack MSIX using makeappx (if available).")
+	jsonConfig := command.Flag("configuration", "").Short('c').Required().String()
+	appDir := command.Flag("app-dir", "The unpacked app dir.").Required().String()
+	output := command.Flag("output", "The MSIX file to create.").Short('o').String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration Configuration
+		err := jsoniter.UnmarshalFromString(*jsonConfig, &configuration)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		result, err := Build(&configuration, *appDir, *output)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// Build writes AppxManifest.xml and assets (assets dir) to the app dir
+func Build(configuration *Configuration, appDir string, output string) (*Result, error) {
+	err := configuration.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	iconDir, err := util.TempDir("", ".msix-icon")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer removeDir(iconDir)
+
+	iconFile, err := resolveIcon(configuration, iconDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Manifest: filepath.Join(appDir, "AppxManifest.xml")}
+	result.Assets, err = generateAssets(iconFile, filepath.Join(appDir, "assets"))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := createManifest(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ioutil.WriteFile(result.Manifest, manifest, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(output) == 0 {
+		return result, nil
+	}
+
+	makeAppx, err := findMakeAppx()
+	if err != nil {
+		return nil, err
+	}
+	if len(makeAppx) == 0 {
+		log.WithField("output", output).Warn("makeappx is not available, MSIX package is not created")
+		return result, nil
+	}
+
+	_, err = util.Execute(exec.Command(makeAppx, "pack", "/o", "/d", appDir, "/p", output), "")
+	if err != nil {
+		return nil, err
+	}
+	result.Package = output
+	return result, nil
+}
+
+func (t *Configuration) normalize() error {
+	if len(t.IdentityName) == 0 || len(t.Publisher) == 0 || len(t.Executable) == 0 {
+		return errors.New("identity name, publisher and executable must be specified")
+	}
+
+	version, err := toAppxVersion(t.Version)
+	if err != nil {
+		return err
+	}
+	t.Version = version
+
+	if len(t.Arch) == 0 {
+		t.Arch = "x64"
+	}
+	arch, ok := archNames[t.Arch]
+	if !ok {
+		return errors.Errorf("unsupported arch %q", t.Arch)
+	}
+	t.Arch = arch
+
+	if len(t.ApplicationId) == 0 {
+		t.ApplicationId = applicationIdRegExp.ReplaceAllString(t.IdentityName, "")
+	}
+	if len(t.DisplayName) == 0 {
+		t.DisplayName = t.IdentityName
+	}
+	if len(t.PublisherDisplayName) == 0 {
+		t.PublisherDisplayName = strings.TrimPrefix(t.Publisher, "CN=")
+	}
+	if len(t.Description) == 0 {
+		t.Description = t.DisplayName
+	}
+	if len(t.BackgroundColor) == 0 {
+		t.BackgroundColor = "transparent"
+	}
+	if len(t.Languages) == 0 {
+		t.Languages = []string{"en-US"}
+	}
+	if len(t.MinVersion) == 0 {
+		t.MinVersion = "10.0.17763.0"
+	}
+	if len(t.MaxVersionTested) == 0 {
+		t.MaxVersionTested = "10.0.22621.0"
+	}
+	t.Executable = strings.Replace(t.Executable, "/", "\\", -1)
+	return nil
+}
+
+// 1.2.3-beta.1 -> 1.2.3.0, every part must be in range 0-65535
+func toAppxVersion(version string) (string, error) {
+	if index := strings.IndexAny(version, "-+"); index >= 0 {
+		version = version[:index]
+	}
+
+	parts := strings.Split(version, ".")
+	if len(version) == 0 || len(parts) > 4 {
+		return "", errors.Errorf("invalid version %q", version)
+	}
+
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 || value > 65535 {
+			return "", errors.Errorf("invalid version %q", version)
+		}
+	}
+	for len(parts) < 4 {
+		parts = append(parts, "0")
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// the largest icon of the set is used as source of all assets
+func resolveIcon(configuration *Configuration, tempDir string) (string, error) {
+	result, err := icons.ConvertIcon(util.RootContext(), &icons.IconConvertRequest{
+		Sources:         &configuration.IconSources,
+		FallbackSources: &configuration.IconFallbackSources,
+		Roots:           &configuration.IconRoots,
+		OutputFormat:    "set",
+		OutputDir:       tempDir,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(result.Icons) == 0 {
+		return "", errors.New("icon not found, it is required to generate MSIX assets")
+	}
+
+	maxIcon := result.Icons[0]
+	for _, icon := range result.Icons {
+		if icon.Size > maxIcon.Size {
+			maxIcon = icon
+		}
+	}
+	return maxIcon.File, nil
+}
+
+func removeDir(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Warn("cannot remove temporary dir")
+	}
+}
+
+// MAKEAPPX_PATH env, makeappx from winCodeSign on Windows or installed makeappx, empty if not available
+func findMakeAppx() (string, error) {
+	result := os.Getenv("MAKEAPPX_PATH")
+	if len(result) != 0 {
+		return result, nil
+	}
+
+	if util.GetCurrentOs() == util.WINDOWS {
+		vendor, err := download.DownloadWinCodeSign()
+		if err != nil {
+			return "", err
+		}
+
+		arch := "ia32"
+		if runtime.GOARCH == "amd64" {
+			arch = "x64"
+		}
+		return filepath.Join(vendor, "windows-10", arch, "makeappx.exe"), nil
+	}
+
+	result, err := exec.LookPath("makeappx")
+	if err != nil {
+		return "", nil
+	}
+	return result, nil
+}
+
+func createManifest(configuration *Configuration) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := manifestTemplate.Execute(&buffer, configuration)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func escapeXml(value string) (string, error) {
+	var buffer bytes.Buffer
+	err := xml.EscapeText(&buffer, []byte(value))
+	return buffer.String(), err
+}
+
+var manifestTemplate = template.Must(template.New("AppxManifest.xml").Funcs(template.FuncMap{"xml": escapeXml}).Parse(`<?xml version="1.0" encoding="utf-8"?>
+<Package
+  xmlns="http://schemas.microsoft.com/appx/manifest/foundation/windows10"
+  xmlns:uap="http://schemas.microsoft.com/appx/manifest/uap/windows10"
+  xmlns:rescap="http://schemas.microsoft.com/appx/manifest/foundation/windows10/restrictedcapabilities"
+  IgnorableNamespaces="uap rescap">
+  <Identity Name="{{xml .IdentityName}}" Publisher="{{xml .Publisher}}" Version="{{.Version}}" ProcessorArchitecture="{{.Arch}}"/>
+  <Properties>
+    <DisplayName>{{xml .DisplayName}}</DisplayName>
+    <PublisherDisplayName>{{xml .PublisherDisplayName}}</PublisherDisplayName>
+    <Description>{{xml .Description}}</Description>
+    <Logo>assets\StoreLogo.png</Logo>
+  </Properties>
+  <Resources>
+{{- range .Languages}}
+    <Resource Language="{{xml .}}"/>
+{{- end}}
+  </Resources>
+  <Dependencies>
+    <TargetDeviceFamily Name="Windows.Desktop" MinVersion="{{.MinVersion}}" MaxVersionTested="{{.MaxVersionTested}}"/>
+  </Dependencies>
+  <Capabilities>
+    <rescap:Capability Name="runFullTrust"/>
+{{- range .Capabilities}}{{if ne . "runFullTrust"}}
+    <Capability Name="{{xml .}}"/>
+{{- end}}{{end}}
+  </Capabilities>
+  <Applications>
+    <Application Id="{{.ApplicationId}}" Executable="{{xml .Executable}}" EntryPoint="Windows.FullTrustApplication">
+      <uap:VisualElements
+        DisplayName="{{xml .DisplayName}}"
+        Description="{{xml .Description}}"
+        BackgroundColor="{{xml .BackgroundColor}}"
+        Square150x150Logo="assets\Square150x150Logo.png"
+        Square44x44Logo="assets\Square44x44Logo.png">
+        <uap:DefaultTile Wide310x150Logo="assets\Wide310x150Logo.png" Square310x310Logo="assets\LargeTile.png" Square71x71Logo="assets\SmallTile.png"/>
+        <uap:SplashScreen Image="assets\SplashScreen.png"/>
+      </uap:VisualElements>
+    </Application>
+  </Applications>
+</Package>
+`))
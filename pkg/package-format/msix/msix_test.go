@@ -0,0 +1,82 @@
+package msix
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/icons"
+	. "github.com/onsi/gomega"
+)
+
+func TestToAppxVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(toAppxVersion("1.2.3")).To(Equal("1.2.3.0"))
+	g.Expect(toAppxVersion("1.2.3-beta.1")).To(Equal("1.2.3.0"))
+	g.Expect(toAppxVersion("1.2.3.4")).To(Equal("1.2.3.4"))
+
+	_, err := toAppxVersion("1.70000.0")
+	g.Expect(err).To(HaveOccurred())
+	_, err = toAppxVersion("")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestBuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	appDir, err := ioutil.TempDir("", "msix")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(appDir)
+
+	testData, err := filepath.Abs(filepath.Join("..", "..", "..", "testData"))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	result, err := Build(&Configuration{
+		IdentityName: "com.example.My-App",
+		Publisher:    "CN=Foo & Bar",
+		Version:      "1.0.0",
+		Executable:   "app/My App.exe",
+		Capabilities: []string{"internetClient"},
+		IconSources:  []string{filepath.Join(testData, "512x512.png")},
+	}, appDir, "")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Package).To(BeEmpty())
+	g.Expect(result.Assets).To(HaveLen(len(assetDescriptors)*(len(assetScales)+1) + len(assetTargetSizes)*2))
+
+	config, err := icons.DecodeImageConfig(filepath.Join(appDir, "assets", "Wide310x150Logo.scale-200.png"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Width).To(Equal(620))
+	g.Expect(config.Height).To(Equal(300))
+
+	data, err := ioutil.ReadFile(result.Manifest)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var manifest struct {
+		Identity struct {
+			Name      string `xml:"Name,attr"`
+			Publisher string `xml:"Publisher,attr"`
+			Version   string `xml:"Version,attr"`
+		}
+		Applications struct {
+			Application struct {
+				Id         string `xml:"Id,attr"`
+				Executable string `xml:"Executable,attr"`
+			}
+		}
+	}
+	g.Expect(xml.Unmarshal(data, &manifest)).NotTo(HaveOccurred())
+	g.Expect(manifest.Identity.Publisher).To(Equal("CN=Foo & Bar"))
+	g.Expect(manifest.Identity.Version).To(Equal("1.0.0.0"))
+	g.Expect(manifest.Applications.Application.Id).To(Equal("comexampleMyApp"))
+	g.Expect(manifest.Applications.Application.Executable).To(Equal("app\\My App.exe"))
+	g.Expect(string(data)).To(ContainSubstring(`<Capability Name="internetClient"/>`))
+
+	// every asset referenced by the manifest exists (resources.pri is not generated, so, unqualified file is used)
+	for _, match := range regexp.MustCompile(`assets\\([^"<]+)`).FindAllStringSubmatch(string(data), -1) {
+		g.Expect(filepath.Join(appDir, "assets", match[1])).To(BeARegularFile())
+	}
+}
@@ -0,0 +1,219 @@
+package nsis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+const (
+	uninstallIncludeName = "uninstall-files.nsh"
+	installIncludeName   = "install-data.nsh"
+	manifestName         = "files.json"
+)
+
+type ManifestFile struct {
+	// relative to app dir, Windows path separator
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+type DataOptions struct {
+	AppDir    string
+	OutputDir string
+	// default install mode (HKLM and all users shell context if true)
+	IsPerMachine bool
+	// sha256 (default), sha512 or blake2b, hex encoded
+	Algorithm string
+}
+
+type DataResult struct {
+	FileCount int `json:"fileCount"`
+	DirCount  int `json:"dirCount"`
+	// KB, as expected by EstimatedSize registry value
+	EstimatedSize int64 `json:"estimatedSize"`
+
+	InstallInclude   string `json:"installInclude"`
+	UninstallInclude string `json:"uninstallInclude"`
+	Manifest         string `json:"manifest"`
+}
+
+func ConfigureDataCommand(app *kingpin.Application) {
+	command := app.Command("nsis-data", "Generate NSIS includes (uninstaller file list, estimated size and install mode defines) and file manifest for the app dir.")
+	appDir := command.Flag("app-dir", "The unpacked app dir (win-unpacked).").Required().String()
+	outputDir := command.Flag("output", "The dir to write includes and manifest to.").Short('o').Required().String()
+	isPerMachine := command.Flag("per-machine", "Install for all users by default.").Bool()
+	algorithm := command.Flag("algorithm", "The hash algorithm of manifest.").Default("sha256").Enum("sha256", "sha512", "blake2b")
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := GenerateData(DataOptions{
+			AppDir:       *appDir,
+			OutputDir:    *outputDir,
+			IsPerMachine: *isPerMachine,
+			Algorithm:    *algorithm,
+		})
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+func GenerateData(options DataOptions) (*DataResult, error) {
+	appDir := filepath.Clean(options.AppDir)
+	files, dirs, err := collectAppFiles(appDir)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := options.Algorithm
+	if len(algorithm) == 0 {
+		algorithm = "sha256"
+	}
+
+	hashes, err := fs.HashFiles(files, fs.HashOptions{Algorithm: algorithm, Encoding: "hex"})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make([]ManifestFile, len(hashes))
+	var totalSize int64
+	for index, hash := range hashes {
+		relativePath, err := filepath.Rel(appDir, hash.File)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		manifest[index] = ManifestFile{File: toWindowsPath(relativePath), Size: hash.Size, Digest: hash.Digest}
+		totalSize += hash.Size
+	}
+
+	relativeDirs := make([]string, len(dirs))
+	for index, dir := range dirs {
+		relativePath, err := filepath.Rel(appDir, dir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		relativeDirs[index] = toWindowsPath(relativePath)
+	}
+
+	err = fsutil.EnsureDir(options.OutputDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &DataResult{
+		FileCount:        len(manifest),
+		DirCount:         len(relativeDirs),
+		EstimatedSize:    (totalSize + 1023) / 1024,
+		InstallInclude:   filepath.Join(options.OutputDir, installIncludeName),
+		UninstallInclude: filepath.Join(options.OutputDir, uninstallIncludeName),
+		Manifest:         filepath.Join(options.OutputDir, manifestName),
+	}
+
+	err = ioutil.WriteFile(result.UninstallInclude, createUninstallInclude(manifest, relativeDirs), 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(result.InstallInclude, createInstallInclude(result, options.IsPerMachine), 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = ioutil.WriteFile(result.Manifest, data, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+// symlinks are not expected in Windows app dir and skipped
+func collectAppFiles(appDir string) ([]string, []string, error) {
+	var files []string
+	var dirs []string
+	var mutex sync.Mutex
+	err := fs.Walk(appDir, 0, func(path string, info os.FileInfo) error {
+		if path == appDir {
+			if !info.IsDir() {
+				return errors.Errorf("%s is not a directory", appDir)
+			}
+			return nil
+		}
+
+		mutex.Lock()
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		} else if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.Strings(files)
+	sort.Strings(dirs)
+	return files, dirs, nil
+}
+
+// files first, then dirs from the deepest one (RMDir without /r removes only empty dir, so, files added by user are kept)
+func createUninstallInclude(manifest []ManifestFile, dirs []string) []byte {
+	var buffer bytes.Buffer
+	for _, file := range manifest {
+		fmt.Fprintf(&buffer, "Delete \"$INSTDIR\\%s\"\n", escapeString(file.File))
+	}
+
+	sortedDirs := make([]string, len(dirs))
+	copy(sortedDirs, dirs)
+	sort.SliceStable(sortedDirs, func(i, j int) bool {
+		return strings.Count(sortedDirs[i], "\\") > strings.Count(sortedDirs[j], "\\")
+	})
+	for _, dir := range sortedDirs {
+		fmt.Fprintf(&buffer, "RMDir \"$INSTDIR\\%s\"\n", escapeString(dir))
+	}
+	return buffer.Bytes()
+}
+
+func createInstallInclude(result *DataResult, isPerMachine bool) []byte {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "!define ESTIMATED_SIZE %d\n", result.EstimatedSize)
+	fmt.Fprintf(&buffer, "!define INSTALL_FILE_COUNT %d\n", result.FileCount)
+	if isPerMachine {
+		buffer.WriteString("!define INSTALL_MODE_PER_ALL_USERS\n")
+		buffer.WriteString("!define INSTALL_REGISTRY_ROOT HKLM\n")
+		buffer.WriteString("!define INSTALL_SHELL_CONTEXT all\n")
+	} else {
+		buffer.WriteString("!define INSTALL_REGISTRY_ROOT HKCU\n")
+		buffer.WriteString("!define INSTALL_SHELL_CONTEXT current\n")
+	}
+	return buffer.Bytes()
+}
+
+func toWindowsPath(path string) string {
+	return strings.Replace(filepath.ToSlash(path), "/", "\\", -1)
+}
+
+// $ starts variable and " ends string in NSIS
+func escapeString(s string) string {
+	s = strings.Replace(s, "$", "$$", -1)
+	return strings.Replace(s, "\"", "$\\\"", -1)
+}
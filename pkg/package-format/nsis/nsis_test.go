@@ -0,0 +1,47 @@
+package nsis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGenerateData(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "nsis")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appDir := filepath.Join(tmpDir, "win-unpacked")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources", "app.asar.unpacked"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "app.exe"), make([]byte, 2000), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app$1.asar"), []byte("hello"), 0644)).NotTo(HaveOccurred())
+
+	outDir := filepath.Join(tmpDir, "out")
+	result, err := GenerateData(DataOptions{AppDir: appDir, OutputDir: outDir, IsPerMachine: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.FileCount).To(Equal(2))
+	g.Expect(result.DirCount).To(Equal(2))
+	g.Expect(result.EstimatedSize).To(Equal(int64(2)))
+
+	data, err := ioutil.ReadFile(result.UninstallInclude)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`Delete "$INSTDIR\app.exe"
+Delete "$INSTDIR\resources\app$$1.asar"
+RMDir "$INSTDIR\resources\app.asar.unpacked"
+RMDir "$INSTDIR\resources"
+`))
+
+	data, err = ioutil.ReadFile(result.InstallInclude)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring("!define ESTIMATED_SIZE 2\n"))
+	g.Expect(string(data)).To(ContainSubstring("!define INSTALL_MODE_PER_ALL_USERS\n"))
+
+	data, err = ioutil.ReadFile(result.Manifest)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring(`"digest": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`))
+}
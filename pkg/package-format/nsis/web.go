@@ -0,0 +1,214 @@
+package nsis
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/archive"
+	"github.com/develar/app-builder/pkg/blockmap"
+	"github.com/develar/app-builder/pkg/preflight"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+const (
+	webPackageIncludeName = "web-package.nsh"
+	// name of package in updater cache dir
+	currentAppPackageFileName = "package.7z"
+)
+
+type WebPackageOptions struct {
+	// arch (x64, ia32, arm64) to unpacked app dir
+	AppDirs   map[string]string
+	OutputDir string
+	// package file is <name>-<version>-<arch>.nsis.7z
+	Name    string
+	Version string
+
+	CompressionLevel int
+	// URL of the dir where packages are hosted, package file name is appended by installer. Must be set for web installer.
+	PackageUrl string
+	// dir name (relative to %LOCALAPPDATA%) to store downloaded package, so, next update downloads only changed blocks
+	UpdaterCacheDirName string
+}
+
+type WebPackage struct {
+	Arch string `json:"arch"`
+	File string `json:"file"`
+	// size of package with appended blockmap
+	Size         int64  `json:"size"`
+	Sha512       string `json:"sha512"`
+	BlockMapSize int    `json:"blockMapSize"`
+	// KB
+	UnpackedSize int64 `json:"unpackedSize"`
+}
+
+type WebPackageResult struct {
+	Packages []WebPackage `json:"packages"`
+	Include  string       `json:"include"`
+}
+
+func ConfigureWebPackageCommand(app *kingpin.Application) {
+	command := app.Command("nsis-web-package", "Create app packages (not solid 7z with appended blockmap for differential download) for NSIS web installer and generate its include.")
+	options := WebPackageOptions{}
+	command.Flag("app-dir", "The unpacked app dir of arch (e.g. x64=dist/win-unpacked), can be specified several times.").Required().StringMapVar(&options.AppDirs)
+	command.Flag("output", "The dir to write packages and include to.").Short('o').Required().StringVar(&options.OutputDir)
+	command.Flag("name", "The sanitized app name.").Required().StringVar(&options.Name)
+	command.Flag("app-version", "The app version.").Required().StringVar(&options.Version)
+	command.Flag("compression-level", "The compression level, 0 (store) - 9 (ultra).").Default("9").IntVar(&options.CompressionLevel)
+	command.Flag("package-url", "The URL of dir where packages are hosted.").StringVar(&options.PackageUrl)
+	command.Flag("updater-cache-dir", "The updater cache dir name to store downloaded package to.").StringVar(&options.UpdaterCacheDirName)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		result, err := CreateWebPackages(options)
+		if err != nil {
+			return preflight.WriteUserError(err)
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+}
+
+// CreateWebPackages packs app dir of every arch, packages are sorted by arch
+func CreateWebPackages(options WebPackageOptions) (*WebPackageResult, error) {
+	if len(options.AppDirs) == 0 {
+		return nil, errors.New("no app dirs to pack")
+	}
+
+	archs := make([]string, 0, len(options.AppDirs))
+	for arch := range options.AppDirs {
+		if len(getArchDefinePrefix(arch)) == 0 {
+			return nil, errors.Errorf("unsupported arch %q (x64, ia32 and arm64 are supported)", arch)
+		}
+		archs = append(archs, arch)
+	}
+	sort.Strings(archs)
+
+	err := fsutil.EnsureDir(options.OutputDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := &WebPackageResult{Include: filepath.Join(options.OutputDir, webPackageIncludeName)}
+	for _, arch := range archs {
+		webPackage, err := createWebPackage(options, arch, options.AppDirs[arch])
+		if err != nil {
+			return nil, err
+		}
+		result.Packages = append(result.Packages, *webPackage)
+	}
+
+	include, err := createWebPackageInclude(result.Packages, options)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(result.Include, include, 0644)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+func createWebPackage(options WebPackageOptions, arch string, appDir string) (*WebPackage, error) {
+	file := filepath.Join(options.OutputDir, fmt.Sprintf("%s-%s-%s.nsis.7z", options.Name, options.Version, arch))
+	err := preflight.CheckPackaging([]string{appDir}, "", "", file)
+	if err != nil {
+		return nil, err
+	}
+
+	// 7za updates existing archive
+	err = os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+
+	err = archive.Archive7z(util.RootContext(), appDir, file, options.CompressionLevel, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// blockmap is appended to the package - the package downloaded by installer is kept for differential download of the next version
+	inputInfo, err := blockmap.BuildBlockMap(file, blockmap.DefaultChunkerConfiguration, blockmap.GZIP, "")
+	if err != nil {
+		return nil, err
+	}
+
+	appFiles, _, err := collectAppFiles(filepath.Clean(appDir))
+	if err != nil {
+		return nil, err
+	}
+	var unpackedSize int64
+	for _, appFile := range appFiles {
+		info, err := os.Stat(appFile)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		unpackedSize += info.Size()
+	}
+
+	return &WebPackage{
+		Arch:         arch,
+		File:         file,
+		Size:         int64(inputInfo.Size),
+		Sha512:       inputInfo.Sha512,
+		BlockMapSize: *inputInfo.BlockMapSize,
+		UnpackedSize: (unpackedSize + 1023) / 1024,
+	}, nil
+}
+
+// defines expected by NSIS web installer template (hash is hex upper case sha512 of the whole package file)
+func createWebPackageInclude(packages []WebPackage, options WebPackageOptions) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("!define COMPRESSION_METHOD 7z\n")
+	if len(options.PackageUrl) != 0 {
+		buffer.WriteString("!define APP_PACKAGE_URL_IS_INCOMPLETE\n")
+		fmt.Fprintf(&buffer, "!define APP_PACKAGE_URL \"%s\"\n", escapeString(strings.TrimSuffix(options.PackageUrl, "/")))
+	}
+
+	for _, webPackage := range packages {
+		prefix := getArchDefinePrefix(webPackage.Arch)
+		name := filepath.Base(webPackage.File)
+		fmt.Fprintf(&buffer, "!define %s_NAME \"%s\"\n", prefix, escapeString(name))
+		hash, err := sha512ToHex(webPackage.Sha512)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid sha512 of %s", webPackage.File)
+		}
+		fmt.Fprintf(&buffer, "!define %s_HASH \"%s\"\n", prefix, hash)
+		fmt.Fprintf(&buffer, "!define %s_UNPACKED_SIZE %d\n", prefix, webPackage.UnpackedSize)
+	}
+
+	if len(options.UpdaterCacheDirName) != 0 {
+		// the same name as used by updater to find package of the current version
+		fmt.Fprintf(&buffer, "!define APP_PACKAGE_STORE_FILE \"%s\\%s\"\n", escapeString(options.UpdaterCacheDirName), currentAppPackageFileName)
+	}
+	return buffer.Bytes(), nil
+}
+
+func getArchDefinePrefix(arch string) string {
+	switch arch {
+	case "x64":
+		return "APP_64"
+	case "ia32":
+		return "APP_32"
+	case "arm64":
+		return "APP_ARM64"
+	default:
+		return ""
+	}
+}
+
+func sha512ToHex(sha512 string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sha512)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strings.ToUpper(hex.EncodeToString(data)), nil
+}
@@ -0,0 +1,88 @@
+package nsis
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestWebPackageInclude(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	packages := []WebPackage{
+		{Arch: "arm64", File: filepath.Join("out", "app-1.0.0-arm64.nsis.7z"), Sha512: "AAEC", UnpackedSize: 3},
+		{Arch: "x64", File: filepath.Join("out", "app-1.0.0-x64.nsis.7z"), Sha512: "/w==", UnpackedSize: 42},
+	}
+	data, err := createWebPackageInclude(packages, WebPackageOptions{PackageUrl: "https://example.com/download/", UpdaterCacheDirName: "app-updater"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal(`!define COMPRESSION_METHOD 7z
+!define APP_PACKAGE_URL_IS_INCOMPLETE
+!define APP_PACKAGE_URL "https://example.com/download"
+!define APP_ARM64_NAME "app-1.0.0-arm64.nsis.7z"
+!define APP_ARM64_HASH "000102"
+!define APP_ARM64_UNPACKED_SIZE 3
+!define APP_64_NAME "app-1.0.0-x64.nsis.7z"
+!define APP_64_HASH "FF"
+!define APP_64_UNPACKED_SIZE 42
+!define APP_PACKAGE_STORE_FILE "app-updater\package.7z"
+`))
+
+	data, err = createWebPackageInclude(packages[1:], WebPackageOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).NotTo(ContainSubstring("APP_PACKAGE_URL"))
+	g.Expect(string(data)).NotTo(ContainSubstring("APP_PACKAGE_STORE_FILE"))
+
+	_, err = createWebPackageInclude([]WebPackage{{Arch: "x64", File: "app.nsis.7z", Sha512: "not base64"}}, WebPackageOptions{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestWebPackageUnsupportedArch(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, err := CreateWebPackages(WebPackageOptions{AppDirs: map[string]string{"mips": "dir"}})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("unsupported arch"))
+}
+
+func TestCreateWebPackages(t *testing.T) {
+	if _, err := exec.LookPath(util.Get7zPath()); err != nil {
+		t.Skip("7za is not installed")
+	}
+
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "nsis-web")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appDir := filepath.Join(tmpDir, "win-unpacked")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "app.exe"), make([]byte, 4000), 0644)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app.asar"), []byte(strings.Repeat("hello", 100)), 0644)).NotTo(HaveOccurred())
+
+	outDir := filepath.Join(tmpDir, "out")
+	result, err := CreateWebPackages(WebPackageOptions{AppDirs: map[string]string{"x64": appDir}, OutputDir: outDir, Name: "app", Version: "1.0.0", CompressionLevel: 5})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Packages).To(HaveLen(1))
+
+	webPackage := result.Packages[0]
+	g.Expect(webPackage.File).To(Equal(filepath.Join(outDir, "app-1.0.0-x64.nsis.7z")))
+	g.Expect(webPackage.UnpackedSize).To(Equal(int64(5)))
+	g.Expect(webPackage.BlockMapSize).To(BeNumerically(">", 0))
+
+	info, err := os.Stat(webPackage.File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Size()).To(Equal(webPackage.Size))
+
+	data, err := ioutil.ReadFile(result.Include)
+	g.Expect(err).NotTo(HaveOccurred())
+	hash, err := sha512ToHex(webPackage.Sha512)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(ContainSubstring("!define APP_64_HASH \"" + hash + "\"\n"))
+}
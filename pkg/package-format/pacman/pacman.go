@@ -0,0 +1,310 @@
+package pacman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+)
+
+type Configuration struct {
+	linuxPackage.Layout
+
+	// hyphen is not allowed in pkgver and replaced with underscore
+	Version string `json:"version"`
+	// pkgrel, default: 1
+	Release string `json:"release"`
+	// node arch names (x64, ia32, arm64, armv7l) are converted to Arch Linux names
+	Arch        string   `json:"arch"`
+	Description string   `json:"description"`
+	Url         string   `json:"url"`
+	Packager    string   `json:"packager"`
+	License     []string `json:"license"`
+
+	// pacman syntax (e.g. "gtk3", "nss>=3.0")
+	Depends []string `json:"depends"`
+	// "name: description"
+	OptDepends []string `json:"optDepends"`
+	Conflicts  []string `json:"conflicts"`
+	Provides   []string `json:"provides"`
+	Replaces   []string `json:"replaces"`
+
+	// script files, body is wrapped into pre_install/post_install/pre_remove/post_remove functions of .INSTALL
+	PreInstall  string `json:"preInstall"`
+	PostInstall string `json:"postInstall"`
+	PreRemove   string `json:"preRemove"`
+	PostRemove  string `json:"postRemove"`
+
+	// zstd (default), xz or gzip
+	Compression string `json:"compression"`
+}
+
+var archNames = map[string]string{
+	"x64":    "x86_64",
+	"ia32":   "i686",
+	"arm64":  "aarch64",
+	"armv7l": "armv7h",
+}
+
+var packageNameRegExp = regexp.MustCompile("^[a-z0-9@_+][a-z0-9@._+-]*$")
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("pacman", "Build Arch Linux (pacman) package.")
+	jsonConfig := command.Flag("configuration", "").Short('c').Required().String()
+	output := command.Flag("output", "The output file (e.g. foo-1.0.0-1-x86_64.pkg.tar.zst).").Short('o').Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration Configuration
+		err := jsoniter.UnmarshalFromString(*jsonConfig, &configuration)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return Build(&configuration, *output)
+	})
+}
+
+func Build(configuration *Configuration, output string) error {
+	err := configuration.normalize()
+	if err != nil {
+		return err
+	}
+
+	entries, err := configuration.Collect()
+	if err != nil {
+		return err
+	}
+
+	modTime := linuxPackage.GetModificationTime()
+
+	var metadataFiles []linuxPackage.TarFileEntry
+	installScript, err := createInstallScript(configuration)
+	if err != nil {
+		return err
+	}
+	if installScript != nil {
+		metadataFiles = append(metadataFiles, linuxPackage.TarFileEntry{Name: ".INSTALL", Data: installScript, Mode: 0644})
+	}
+
+	pkgInfo := linuxPackage.TarFileEntry{Name: ".PKGINFO", Data: createPkgInfo(configuration, entries, modTime), Mode: 0644}
+	mtree, err := createMtree(append(metadataFiles, pkgInfo), entries, modTime)
+	if err != nil {
+		return err
+	}
+	// sorted as makepkg does (LC_COLLATE=C)
+	metadataFiles = append(metadataFiles, linuxPackage.TarFileEntry{Name: ".MTREE", Data: mtree, Mode: 0644}, pkgInfo)
+
+	err = fsutil.EnsureDir(filepath.Dir(output))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = linuxPackage.WriteCompressedFile(output, configuration.Compression, func(writer io.Writer) error {
+		tarWriter := tar.NewWriter(writer)
+		err := linuxPackage.AddTarFiles(tarWriter, metadataFiles, modTime)
+		if err != nil {
+			return err
+		}
+
+		err = linuxPackage.AddTarEntries(tarWriter, entries, "", modTime)
+		if err != nil {
+			return err
+		}
+		return errors.WithStack(tarWriter.Close())
+	})
+	if err != nil {
+		removeFile(output)
+		return err
+	}
+
+	log.WithFields(log.Fields{"file": output, "files": len(entries)}).Info("pacman package created")
+	return nil
+}
+
+func (t *Configuration) normalize() error {
+	if !packageNameRegExp.MatchString(t.Name) {
+		return errors.Errorf("invalid package name %q (lowercase letters, digits and @._+- are allowed)", t.Name)
+	}
+	if len(t.Version) == 0 {
+		return errors.New("version must be specified")
+	}
+
+	t.Version = strings.Replace(t.Version, "-", "_", -1)
+	if len(t.Release) == 0 {
+		t.Release = "1"
+	}
+
+	if arch, ok := archNames[t.Arch]; ok {
+		t.Arch = arch
+	} else if len(t.Arch) == 0 {
+		return errors.New("arch must be specified")
+	}
+
+	if len(t.Compression) == 0 {
+		t.Compression = "zstd"
+	} else if t.Compression != "zstd" && t.Compression != "xz" && t.Compression != "gzip" {
+		return errors.Errorf("unsupported compression: %s", t.Compression)
+	}
+
+	if len(t.Description) == 0 {
+		t.Description = t.Name
+	}
+	if len(t.License) == 0 {
+		t.License = []string{"custom"}
+	}
+	return nil
+}
+
+func createPkgInfo(configuration *Configuration, entries []linuxPackage.FileEntry, modTime time.Time) []byte {
+	var size int64
+	for _, entry := range entries {
+		size += entry.Size
+	}
+
+	var buffer bytes.Buffer
+	writeField := func(name string, values ...string) {
+		for _, value := range values {
+			if len(value) != 0 {
+				fmt.Fprintf(&buffer, "%s = %s\n", name, value)
+			}
+		}
+	}
+
+	buffer.WriteString("# Generated by app-builder\n")
+	writeField("pkgname", configuration.Name)
+	writeField("pkgbase", configuration.Name)
+	writeField("pkgver", configuration.Version+"-"+configuration.Release)
+	// multiline description is not supported
+	writeField("pkgdesc", strings.Join(strings.Fields(configuration.Description), " "))
+	writeField("url", configuration.Url)
+	writeField("builddate", fmt.Sprint(modTime.Unix()))
+	writeField("packager", configuration.Packager)
+	writeField("size", fmt.Sprint(size))
+	writeField("arch", configuration.Arch)
+	writeField("license", configuration.License...)
+	writeField("replaces", configuration.Replaces...)
+	writeField("conflict", configuration.Conflicts...)
+	writeField("provides", configuration.Provides...)
+	writeField("depend", configuration.Depends...)
+	writeField("optdepend", configuration.OptDepends...)
+	return buffer.Bytes()
+}
+
+func createInstallScript(configuration *Configuration) ([]byte, error) {
+	scripts := []struct {
+		function string
+		file     string
+	}{
+		{"pre_install", configuration.PreInstall},
+		{"post_install", configuration.PostInstall},
+		{"pre_remove", configuration.PreRemove},
+		{"post_remove", configuration.PostRemove},
+	}
+
+	var buffer bytes.Buffer
+	for _, script := range scripts {
+		if len(script.file) == 0 {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(script.file)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		fmt.Fprintf(&buffer, "%s() {\n%s\n}\n\n", script.function, strings.TrimSpace(string(data)))
+	}
+
+	if buffer.Len() == 0 {
+		return nil, nil
+	}
+	return buffer.Bytes(), nil
+}
+
+// gzip compressed mtree (as bsdtar --format=mtree creates for makepkg), used by pacman to validate installed files
+func createMtree(metadataFiles []linuxPackage.TarFileEntry, entries []linuxPackage.FileEntry, modTime time.Time) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString("#mtree\n/set type=file uid=0 gid=0 mode=644\n")
+	timeField := fmt.Sprintf("time=%d.0", modTime.Unix())
+
+	for _, file := range metadataFiles {
+		md5Digest := md5.Sum(file.Data)
+		sha256Digest := sha256.Sum256(file.Data)
+		fmt.Fprintf(&buffer, "./%s %s size=%d md5digest=%s sha256digest=%s\n", file.Name, timeField, len(file.Data), hex.EncodeToString(md5Digest[:]), hex.EncodeToString(sha256Digest[:]))
+	}
+
+	for index := range entries {
+		entry := &entries[index]
+		name := "." + escapeMtreePath(entry.Path)
+		mode := entry.Mode.Perm()
+		switch {
+		case entry.IsDir():
+			fmt.Fprintf(&buffer, "%s %s mode=%o type=dir\n", name, timeField, mode)
+		case entry.IsSymlink():
+			fmt.Fprintf(&buffer, "%s %s mode=%o type=link link=%s\n", name, timeField, mode, escapeMtreePath(entry.LinkTarget))
+		default:
+			md5Hash := md5.New()
+			sha256Hash := sha256.New()
+			err := linuxPackage.CopyFile(entry.Source, io.MultiWriter(md5Hash, sha256Hash))
+			if err != nil {
+				return nil, err
+			}
+
+			buffer.WriteString(name + " " + timeField)
+			if mode != 0644 {
+				fmt.Fprintf(&buffer, " mode=%o", mode)
+			}
+			fmt.Fprintf(&buffer, " size=%d md5digest=%s sha256digest=%s\n", entry.Size, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)))
+		}
+	}
+
+	var result bytes.Buffer
+	gzipWriter, err := gzip.NewWriterLevel(&result, gzip.BestCompression)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	_, err = gzipWriter.Write(buffer.Bytes())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	err = gzipWriter.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result.Bytes(), nil
+}
+
+// space, non-printable and special (\, #, =) chars are written as \ooo
+func escapeMtreePath(value string) string {
+	var builder strings.Builder
+	for _, c := range []byte(value) {
+		if c <= ' ' || c >= 0x7f || c == '\\' || c == '#' || c == '=' {
+			fmt.Fprintf(&builder, "\\%03o", c)
+		} else {
+			builder.WriteByte(c)
+		}
+	}
+	return builder.String()
+}
+
+func removeFile(file string) {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("file", file).Warn("cannot remove file")
+	}
+}
@@ -0,0 +1,92 @@
+package pacman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	. "github.com/onsi/gomega"
+)
+
+func TestBuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "pacman")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appDir := filepath.Join(tmpDir, "linux-unpacked")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "foo"), []byte("#!/bin/sh\n"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app data.asar"), []byte("asar"), 0644)).NotTo(HaveOccurred())
+	postInstall := filepath.Join(tmpDir, "after-install.sh")
+	g.Expect(ioutil.WriteFile(postInstall, []byte("#!/bin/sh\necho installed\n"), 0644)).NotTo(HaveOccurred())
+
+	output := filepath.Join(tmpDir, "foo.pkg.tar.gz")
+	configuration := &Configuration{
+		Layout:      linuxPackage.Layout{AppDir: appDir, Name: "foo", Executable: "foo"},
+		Version:     "1.0.0-beta.1",
+		Arch:        "x64",
+		Depends:     []string{"gtk3", "nss>=3.0"},
+		PostInstall: postInstall,
+		Compression: "gzip",
+	}
+	g.Expect(Build(configuration, output)).NotTo(HaveOccurred())
+
+	files := readTar(g, output)
+	g.Expect(files).To(HaveKey(".MTREE"))
+	g.Expect(files).To(HaveKey("opt/foo/foo"))
+	g.Expect(files).To(HaveKey("usr/bin/foo"))
+	g.Expect(files[".INSTALL"]).To(Equal("post_install() {\n#!/bin/sh\necho installed\n}\n\n"))
+
+	pkgInfo := files[".PKGINFO"]
+	g.Expect(pkgInfo).To(ContainSubstring("pkgname = foo\n"))
+	g.Expect(pkgInfo).To(ContainSubstring("pkgver = 1.0.0_beta.1-1\n"))
+	g.Expect(pkgInfo).To(ContainSubstring("arch = x86_64\n"))
+	g.Expect(pkgInfo).To(ContainSubstring("size = 14\n"))
+	g.Expect(pkgInfo).To(ContainSubstring("depend = gtk3\ndepend = nss>=3.0\n"))
+
+	mtreeReader, err := gzip.NewReader(bytes.NewReader([]byte(files[".MTREE"])))
+	g.Expect(err).NotTo(HaveOccurred())
+	mtree, err := ioutil.ReadAll(mtreeReader)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(mtree)).To(HavePrefix("#mtree\n/set type=file uid=0 gid=0 mode=644\n./.INSTALL "))
+	g.Expect(string(mtree)).To(ContainSubstring("./opt/foo/resources/app\\040data.asar "))
+	g.Expect(string(mtree)).To(ContainSubstring("./usr/bin/foo time="))
+	g.Expect(string(mtree)).To(ContainSubstring(" mode=777 type=link link=/opt/foo/foo\n"))
+	g.Expect(string(mtree)).NotTo(ContainSubstring("./.MTREE"))
+}
+
+func readTar(g *GomegaWithT, file string) map[string]string {
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	result := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		g.Expect(err).NotTo(HaveOccurred())
+		content, err := ioutil.ReadAll(tarReader)
+		g.Expect(err).NotTo(HaveOccurred())
+		result[header.Name] = string(content)
+	}
+	return result
+}
+
+func TestEscapeMtreePath(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(escapeMtreePath("/opt/foo bar/a=b#c")).To(Equal("/opt/foo\\040bar/a\\075b\\043c"))
+	g.Expect(escapeMtreePath("/opt/é")).To(Equal("/opt/\\303\\251"))
+}
@@ -95,9 +95,9 @@ func pack(options ProtonNativeOptions) error {
 		skeletonExecutable += ".exe"
 	}
 
-	err = os.Rename(filepath.Join(stageDir, skeletonExecutable), filepath.Join(stageDir, options.executableName))
+	err = fs.RenameWithRetry(filepath.Join(stageDir, skeletonExecutable), filepath.Join(stageDir, options.executableName))
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,82 @@
+package rpm
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	"github.com/develar/errors"
+)
+
+const (
+	modeTypeMask = 0170000
+	modeRegular  = 0100000
+	modeDir      = 0040000
+	modeSymlink  = 0120000
+)
+
+// SVR4 "newc" cpio format with "./" prefixed names (rpmlib(PayloadFilesHavePrefix))
+type cpioWriter struct {
+	writer io.Writer
+	// number of written bytes (uncompressed payload size)
+	size int64
+}
+
+func (t *cpioWriter) Write(data []byte) (int, error) {
+	n, err := t.writer.Write(data)
+	t.size += int64(n)
+	return n, err
+}
+
+func (t *cpioWriter) writeEntry(entry *linuxPackage.FileEntry, inode int, mode uint32, mtime int64) error {
+	var size int64
+	switch {
+	case entry.IsSymlink():
+		size = int64(len(entry.LinkTarget))
+	case !entry.IsDir():
+		size = entry.Size
+	}
+
+	err := t.writeHeader("."+entry.Path, inode, mode, mtime, size)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case entry.IsSymlink():
+		_, err = io.WriteString(t, entry.LinkTarget)
+	case !entry.IsDir():
+		err = linuxPackage.CopyFile(entry.Source, t)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return t.pad()
+}
+
+func (t *cpioWriter) writeHeader(name string, inode int, mode uint32, mtime int64, size int64) error {
+	nlink := 1
+	if mode&modeTypeMask == modeDir {
+		nlink = 2
+	}
+
+	_, err := fmt.Fprintf(t, "070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%s\x00",
+		inode, mode, 0, 0, nlink, mtime, size, 0, 0, 0, 0, len(name)+1, 0, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return t.pad()
+}
+
+// header with name and data are 4-byte aligned
+func (t *cpioWriter) pad() error {
+	if t.size%4 == 0 {
+		return nil
+	}
+	_, err := t.Write(make([]byte, 4-t.size%4))
+	return errors.WithStack(err)
+}
+
+func (t *cpioWriter) close() error {
+	return t.writeHeader("TRAILER!!!", 0, 0, 0, 0)
+}
@@ -0,0 +1,129 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// http://ftp.rpm.org/max-rpm/s1-rpm-file-format-rpm-file-format.html
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeString      = 6
+	typeBinary      = 7
+	typeStringArray = 8
+	typeI18nString  = 9
+)
+
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+
+type headerEntry struct {
+	dataType int32
+	count    int32
+	data     []byte
+}
+
+func (t *headerEntry) alignment() int {
+	switch t.dataType {
+	case typeInt16:
+		return 2
+	case typeInt32:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// header is a sorted index of tags and data store, the first entry is the region tag (immutable region covers whole header)
+type header struct {
+	regionTag int32
+	entries   map[int32]*headerEntry
+}
+
+func newHeader(regionTag int32) *header {
+	return &header{regionTag: regionTag, entries: make(map[int32]*headerEntry)}
+}
+
+func (t *header) addString(tag int32, value string) {
+	t.entries[tag] = &headerEntry{dataType: typeString, count: 1, data: append([]byte(value), 0)}
+}
+
+// only C locale is written (HEADERI18NTABLE)
+func (t *header) addI18nString(tag int32, value string) {
+	t.entries[tag] = &headerEntry{dataType: typeI18nString, count: 1, data: append([]byte(value), 0)}
+}
+
+func (t *header) addStringArray(tag int32, values []string) {
+	var buffer bytes.Buffer
+	for _, value := range values {
+		buffer.WriteString(value)
+		buffer.WriteByte(0)
+	}
+	t.entries[tag] = &headerEntry{dataType: typeStringArray, count: int32(len(values)), data: buffer.Bytes()}
+}
+
+func (t *header) addInt32(tag int32, values ...int32) {
+	data := make([]byte, 4*len(values))
+	for index, value := range values {
+		binary.BigEndian.PutUint32(data[index*4:], uint32(value))
+	}
+	t.entries[tag] = &headerEntry{dataType: typeInt32, count: int32(len(values)), data: data}
+}
+
+func (t *header) addInt16(tag int32, values ...uint16) {
+	data := make([]byte, 2*len(values))
+	for index, value := range values {
+		binary.BigEndian.PutUint16(data[index*2:], value)
+	}
+	t.entries[tag] = &headerEntry{dataType: typeInt16, count: int32(len(values)), data: data}
+}
+
+func (t *header) addBinary(tag int32, data []byte) {
+	t.entries[tag] = &headerEntry{dataType: typeBinary, count: int32(len(data)), data: data}
+}
+
+func (t *header) bytes() []byte {
+	tags := make([]int32, 0, len(t.entries))
+	for tag := range t.entries {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var store bytes.Buffer
+	offsets := make([]int, len(tags))
+	for index, tag := range tags {
+		entry := t.entries[tag]
+		alignment := entry.alignment()
+		for store.Len()%alignment != 0 {
+			store.WriteByte(0)
+		}
+		offsets[index] = store.Len()
+		store.Write(entry.data)
+	}
+
+	// region trailer: index entry with negative offset (size of index including the region entry)
+	regionOffset := store.Len()
+	indexCount := len(tags) + 1
+	store.Write(createIndexEntry(t.regionTag, typeBinary, int32(-16*indexCount), 16))
+
+	var result bytes.Buffer
+	result.Write(headerMagic)
+	_ = binary.Write(&result, binary.BigEndian, []int32{int32(indexCount), int32(store.Len())})
+	result.Write(createIndexEntry(t.regionTag, typeBinary, int32(regionOffset), 16))
+	for index, tag := range tags {
+		entry := t.entries[tag]
+		result.Write(createIndexEntry(tag, entry.dataType, int32(offsets[index]), entry.count))
+	}
+	result.Write(store.Bytes())
+	return result.Bytes()
+}
+
+func createIndexEntry(tag int32, dataType int32, offset int32, count int32) []byte {
+	result := make([]byte, 16)
+	binary.BigEndian.PutUint32(result, uint32(tag))
+	binary.BigEndian.PutUint32(result[4:], uint32(dataType))
+	binary.BigEndian.PutUint32(result[8:], uint32(offset))
+	binary.BigEndian.PutUint32(result[12:], uint32(count))
+	return result
+}
@@ -0,0 +1,593 @@
+package rpm
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/codesign/gpg"
+	"github.com/develar/app-builder/pkg/credentials"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+)
+
+const (
+	tagHeaderSignatures = 62
+	tagHeaderImmutable  = 63
+	tagHeaderI18nTable  = 100
+
+	tagName              = 1000
+	tagVersion           = 1001
+	tagRelease           = 1002
+	tagSummary           = 1004
+	tagDescription       = 1005
+	tagBuildTime         = 1006
+	tagBuildHost         = 1007
+	tagSize              = 1009
+	tagVendor            = 1011
+	tagLicense           = 1014
+	tagPackager          = 1015
+	tagGroup             = 1016
+	tagUrl               = 1020
+	tagOs                = 1021
+	tagArch              = 1022
+	tagPreIn             = 1023
+	tagPostIn            = 1024
+	tagPreUn             = 1025
+	tagPostUn            = 1026
+	tagFileSizes         = 1028
+	tagFileModes         = 1030
+	tagFileRdevs         = 1033
+	tagFileMtimes        = 1034
+	tagFileDigests       = 1035
+	tagFileLinkTos       = 1036
+	tagFileFlags         = 1037
+	tagFileUserName      = 1039
+	tagFileGroupName     = 1040
+	tagFileVerifyFlags   = 1045
+	tagProvideName       = 1047
+	tagRequireFlags      = 1048
+	tagRequireName       = 1049
+	tagRequireVersion    = 1050
+	tagConflictFlags     = 1053
+	tagConflictName      = 1054
+	tagConflictVersion   = 1055
+	tagPreInProg         = 1085
+	tagPostInProg        = 1086
+	tagPreUnProg         = 1087
+	tagPostUnProg        = 1088
+	tagFileDevices       = 1095
+	tagFileInodes        = 1096
+	tagFileLangs         = 1097
+	tagProvideFlags      = 1112
+	tagProvideVersion    = 1113
+	tagDirIndexes        = 1116
+	tagBaseNames         = 1117
+	tagDirNames          = 1118
+	tagPayloadFormat     = 1124
+	tagPayloadCompressor = 1125
+	tagPayloadFlags      = 1126
+	tagFileDigestAlgo    = 5011
+
+	sigTagRsa           = 268
+	sigTagSha1          = 269
+	sigTagSha256        = 273
+	sigTagSize          = 1000
+	sigTagMd5           = 1004
+	sigTagPayloadSize   = 1007
+	digestAlgoSha256    = 8
+	senseLess           = 0x02
+	senseGreater        = 0x04
+	senseEqual          = 0x08
+	senseRpmlib         = 1 << 24
+	leadSize            = 96
+	signatureTypeHeader = 5
+)
+
+type Configuration struct {
+	linuxPackage.Layout
+
+	// semver pre-release separator is replaced with ~ (pre-release is sorted before release)
+	Version string `json:"version"`
+	// default: 1
+	Release string `json:"release"`
+	// node arch names (x64, ia32, arm64, armv7l) are converted to RPM names
+	Arch        string `json:"arch"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	License     string `json:"license"`
+	Vendor      string `json:"vendor"`
+	Packager    string `json:"packager"`
+	Url         string `json:"url"`
+	Group       string `json:"group"`
+
+	// name or name with version constraint (e.g. "gtk3 >= 3.0")
+	Requires  []string `json:"requires"`
+	Provides  []string `json:"provides"`
+	Conflicts []string `json:"conflicts"`
+
+	// script files
+	PreInstall  string `json:"preInstall"`
+	PostInstall string `json:"postInstall"`
+	PreRemove   string `json:"preRemove"`
+	PostRemove  string `json:"postRemove"`
+
+	// xz (default), zstd (rpm 4.14+) or gzip
+	Compression string `json:"compression"`
+}
+
+var archNames = map[string]string{
+	"x64":    "x86_64",
+	"ia32":   "i386",
+	"arm64":  "aarch64",
+	"armv7l": "armv7l",
+}
+
+type dependency struct {
+	name    string
+	flags   int32
+	version string
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("rpm", "Build RPM package.")
+	jsonConfig := command.Flag("configuration", "").Short('c').Required().String()
+	output := command.Flag("output", "The output file.").Short('o').Required().String()
+	isSign := command.Flag("sign", "Sign header using GPG.").Bool()
+	keyFile := command.Flag("key-file", "The private key file.").String()
+	key := command.Flag("key", "The private key (armored or base64).").Envar("GPG_PRIVATE_KEY").String()
+	keyId := command.Flag("key-id", "The key id (default key is used if not specified).").Envar("GPG_KEY_ID").String()
+	passphrase := command.Flag("passphrase", "The passphrase of private key (default: GPG_PASSPHRASE from the credential store or env).").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration Configuration
+		err := jsoniter.UnmarshalFromString(*jsonConfig, &configuration)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var signOptions *gpg.SignOptions
+		if *isSign {
+			credentials.Fill(passphrase, "GPG_PASSPHRASE")
+			signOptions = &gpg.SignOptions{KeyId: *keyId, Passphrase: *passphrase}
+			if len(*keyFile) != 0 {
+				signOptions.Key, err = ioutil.ReadFile(*keyFile)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			} else if len(*key) != 0 {
+				signOptions.Key = []byte(*key)
+			}
+		}
+		return Build(&configuration, *output, signOptions)
+	})
+}
+
+// Build writes RPM package, header is signed if signOptions is not nil
+func Build(configuration *Configuration, output string, signOptions *gpg.SignOptions) error {
+	err := configuration.normalize()
+	if err != nil {
+		return err
+	}
+
+	entries, err := configuration.Collect()
+	if err != nil {
+		return err
+	}
+	entries = filterOwnedEntries(entries, configuration.GetInstallDir())
+
+	tempDir, err := util.TempDir("", ".rpm")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer removeDir(tempDir)
+
+	mtime := linuxPackage.GetModificationTime().Unix()
+	payloadFile := filepath.Join(tempDir, "payload")
+	var payloadSize int64
+	err = linuxPackage.WriteCompressedFile(payloadFile, configuration.Compression, func(writer io.Writer) error {
+		cpio := &cpioWriter{writer: writer}
+		for index := range entries {
+			err := cpio.writeEntry(&entries[index], index+1, getFileMode(&entries[index]), mtime)
+			if err != nil {
+				return err
+			}
+		}
+		err := cpio.close()
+		payloadSize = cpio.size
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	mainHeader, err := createMainHeader(configuration, entries, mtime)
+	if err != nil {
+		return err
+	}
+
+	headerData := mainHeader.bytes()
+	signatureHeader, err := createSignatureHeader(headerData, payloadFile, payloadSize, signOptions)
+	if err != nil {
+		return err
+	}
+
+	err = fsutil.EnsureDir(filepath.Dir(output))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = writePackage(output, configuration, signatureHeader.bytes(), headerData, payloadFile)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"file": output, "files": len(entries), "signed": signOptions != nil}).Info("rpm created")
+	return nil
+}
+
+func (t *Configuration) normalize() error {
+	if len(t.Name) == 0 || len(t.Version) == 0 {
+		return errors.New("name and version must be specified")
+	}
+
+	t.Version = strings.Replace(t.Version, "-", "~", -1)
+	if len(t.Release) == 0 {
+		t.Release = "1"
+	}
+
+	if arch, ok := archNames[t.Arch]; ok {
+		t.Arch = arch
+	} else if len(t.Arch) == 0 {
+		return errors.New("arch must be specified")
+	}
+
+	if len(t.Compression) == 0 {
+		t.Compression = "xz"
+	} else if t.Compression != "xz" && t.Compression != "zstd" && t.Compression != "gzip" {
+		return errors.Errorf("unsupported payload compression: %s", t.Compression)
+	}
+
+	if len(t.Summary) == 0 {
+		t.Summary = t.Name
+	}
+	if len(t.Description) == 0 {
+		t.Description = t.Summary
+	}
+	if len(t.License) == 0 {
+		t.License = "unknown"
+	}
+	if len(t.Group) == 0 {
+		t.Group = "Unspecified"
+	}
+	return nil
+}
+
+// system dirs (e.g. /usr/bin) are owned by filesystem package, only dirs of the app are owned by package
+func filterOwnedEntries(entries []linuxPackage.FileEntry, installDir string) []linuxPackage.FileEntry {
+	result := entries[:0]
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Path == installDir || strings.HasPrefix(entry.Path, installDir+"/") {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func getFileMode(entry *linuxPackage.FileEntry) uint32 {
+	mode := uint32(entry.Mode.Perm())
+	switch {
+	case entry.IsDir():
+		return mode | modeDir
+	case entry.IsSymlink():
+		return mode | modeSymlink
+	default:
+		return mode | modeRegular
+	}
+}
+
+func createMainHeader(configuration *Configuration, entries []linuxPackage.FileEntry, mtime int64) (*header, error) {
+	result := newHeader(tagHeaderImmutable)
+	result.addStringArray(tagHeaderI18nTable, []string{"C"})
+	result.addString(tagName, configuration.Name)
+	result.addString(tagVersion, configuration.Version)
+	result.addString(tagRelease, configuration.Release)
+	result.addI18nString(tagSummary, configuration.Summary)
+	result.addI18nString(tagDescription, configuration.Description)
+	result.addInt32(tagBuildTime, int32(mtime))
+	result.addString(tagBuildHost, "localhost")
+	result.addString(tagLicense, configuration.License)
+	result.addI18nString(tagGroup, configuration.Group)
+	result.addString(tagOs, "linux")
+	result.addString(tagArch, configuration.Arch)
+	result.addString(tagPayloadFormat, "cpio")
+	result.addString(tagPayloadCompressor, configuration.Compression)
+	if configuration.Compression == "zstd" {
+		result.addString(tagPayloadFlags, "19")
+	} else {
+		result.addString(tagPayloadFlags, "9")
+	}
+	if len(configuration.Vendor) != 0 {
+		result.addString(tagVendor, configuration.Vendor)
+	}
+	if len(configuration.Packager) != 0 {
+		result.addString(tagPackager, configuration.Packager)
+	}
+	if len(configuration.Url) != 0 {
+		result.addString(tagUrl, configuration.Url)
+	}
+
+	err := addScripts(result, configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addFiles(result, entries, mtime)
+	if err != nil {
+		return nil, err
+	}
+
+	provides := append([]dependency{{name: configuration.Name, flags: senseEqual, version: configuration.Version + "-" + configuration.Release}}, parseDependencies(configuration.Provides)...)
+	addDependencies(result, tagProvideName, tagProvideFlags, tagProvideVersion, provides)
+
+	requires := parseDependencies(configuration.Requires)
+	for _, feature := range getRpmlibFeatures(configuration.Compression) {
+		requires = append(requires, dependency{name: "rpmlib(" + feature[0] + ")", flags: senseRpmlib | senseLess | senseEqual, version: feature[1]})
+	}
+	addDependencies(result, tagRequireName, tagRequireFlags, tagRequireVersion, requires)
+
+	conflicts := parseDependencies(configuration.Conflicts)
+	if len(conflicts) != 0 {
+		addDependencies(result, tagConflictName, tagConflictFlags, tagConflictVersion, conflicts)
+	}
+	return result, nil
+}
+
+func getRpmlibFeatures(compression string) [][2]string {
+	result := [][2]string{
+		{"CompressedFileNames", "3.0.4-1"},
+		{"FileDigests", "4.6.0-1"},
+		{"PayloadFilesHavePrefix", "4.0-1"},
+	}
+	switch compression {
+	case "xz":
+		result = append(result, [2]string{"PayloadIsXz", "5.2-1"})
+	case "zstd":
+		result = append(result, [2]string{"PayloadIsZstd", "5.4.18-1"})
+	}
+	return result
+}
+
+func addScripts(result *header, configuration *Configuration) error {
+	scripts := []struct {
+		tag     int32
+		progTag int32
+		file    string
+	}{
+		{tagPreIn, tagPreInProg, configuration.PreInstall},
+		{tagPostIn, tagPostInProg, configuration.PostInstall},
+		{tagPreUn, tagPreUnProg, configuration.PreRemove},
+		{tagPostUn, tagPostUnProg, configuration.PostRemove},
+	}
+	for _, script := range scripts {
+		if len(script.file) == 0 {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(script.file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		result.addString(script.tag, string(data))
+		result.addString(script.progTag, "/bin/sh")
+	}
+	return nil
+}
+
+func addFiles(result *header, entries []linuxPackage.FileEntry, mtime int64) error {
+	count := len(entries)
+	sizes := make([]int32, count)
+	modes := make([]uint16, count)
+	rdevs := make([]uint16, count)
+	mtimes := make([]int32, count)
+	digests := make([]string, count)
+	linkTos := make([]string, count)
+	flags := make([]int32, count)
+	owners := make([]string, count)
+	verifyFlags := make([]int32, count)
+	devices := make([]int32, count)
+	inodes := make([]int32, count)
+	langs := make([]string, count)
+	dirIndexes := make([]int32, count)
+	baseNames := make([]string, count)
+	var dirNames []string
+	dirNameToIndex := make(map[string]int32)
+
+	var totalSize int64
+	for index := range entries {
+		entry := &entries[index]
+		modes[index] = uint16(getFileMode(entry))
+		mtimes[index] = int32(mtime)
+		owners[index] = "root"
+		verifyFlags[index] = -1
+		devices[index] = 1
+		inodes[index] = int32(index + 1)
+		linkTos[index] = entry.LinkTarget
+
+		if len(entry.Source) != 0 {
+			sizes[index] = int32(entry.Size)
+			totalSize += entry.Size
+
+			hash := sha256.New()
+			err := linuxPackage.CopyFile(entry.Source, hash)
+			if err != nil {
+				return err
+			}
+			digests[index] = hex.EncodeToString(hash.Sum(nil))
+		} else if entry.IsSymlink() {
+			sizes[index] = int32(len(entry.LinkTarget))
+		} else {
+			sizes[index] = 4096
+		}
+
+		dirName := path.Dir(entry.Path) + "/"
+		dirIndex, ok := dirNameToIndex[dirName]
+		if !ok {
+			dirIndex = int32(len(dirNames))
+			dirNameToIndex[dirName] = dirIndex
+			dirNames = append(dirNames, dirName)
+		}
+		dirIndexes[index] = dirIndex
+		baseNames[index] = path.Base(entry.Path)
+	}
+
+	result.addInt32(tagSize, int32(totalSize))
+	result.addInt32(tagFileSizes, sizes...)
+	result.addInt16(tagFileModes, modes...)
+	result.addInt16(tagFileRdevs, rdevs...)
+	result.addInt32(tagFileMtimes, mtimes...)
+	result.addStringArray(tagFileDigests, digests)
+	result.addStringArray(tagFileLinkTos, linkTos)
+	result.addInt32(tagFileFlags, flags...)
+	result.addStringArray(tagFileUserName, owners)
+	result.addStringArray(tagFileGroupName, owners)
+	result.addInt32(tagFileVerifyFlags, verifyFlags...)
+	result.addInt32(tagFileDevices, devices...)
+	result.addInt32(tagFileInodes, inodes...)
+	result.addStringArray(tagFileLangs, langs)
+	result.addInt32(tagDirIndexes, dirIndexes...)
+	result.addStringArray(tagBaseNames, baseNames)
+	result.addStringArray(tagDirNames, dirNames)
+	result.addInt32(tagFileDigestAlgo, digestAlgoSha256)
+	return nil
+}
+
+// "name", "name >= 1.0"
+func parseDependencies(list []string) []dependency {
+	result := make([]dependency, 0, len(list))
+	for _, item := range list {
+		fields := strings.Fields(item)
+		if len(fields) != 3 {
+			result = append(result, dependency{name: strings.TrimSpace(item)})
+			continue
+		}
+
+		var flags int32
+		for _, c := range fields[1] {
+			switch c {
+			case '<':
+				flags |= senseLess
+			case '>':
+				flags |= senseGreater
+			case '=':
+				flags |= senseEqual
+			}
+		}
+		result = append(result, dependency{name: fields[0], flags: flags, version: fields[2]})
+	}
+	return result
+}
+
+func addDependencies(result *header, nameTag int32, flagsTag int32, versionTag int32, dependencies []dependency) {
+	names := make([]string, len(dependencies))
+	flags := make([]int32, len(dependencies))
+	versions := make([]string, len(dependencies))
+	for index, dependency := range dependencies {
+		names[index] = dependency.name
+		flags[index] = dependency.flags
+		versions[index] = dependency.version
+	}
+	result.addStringArray(nameTag, names)
+	result.addInt32(flagsTag, flags...)
+	result.addStringArray(versionTag, versions)
+}
+
+func createSignatureHeader(headerData []byte, payloadFile string, payloadSize int64, signOptions *gpg.SignOptions) (*header, error) {
+	payloadInfo, err := os.Stat(payloadFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	md5Hash := md5.New()
+	md5Hash.Write(headerData)
+	err = linuxPackage.CopyFile(payloadFile, md5Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	sha1Digest := sha1.Sum(headerData)
+	sha256Digest := sha256.Sum256(headerData)
+
+	result := newHeader(tagHeaderSignatures)
+	result.addInt32(sigTagSize, int32(int64(len(headerData))+payloadInfo.Size()))
+	result.addBinary(sigTagMd5, md5Hash.Sum(nil))
+	result.addInt32(sigTagPayloadSize, int32(payloadSize))
+	result.addString(sigTagSha1, hex.EncodeToString(sha1Digest[:]))
+	result.addString(sigTagSha256, hex.EncodeToString(sha256Digest[:]))
+
+	if signOptions != nil {
+		signature, err := gpg.SignData(headerData, signOptions)
+		if err != nil {
+			return nil, err
+		}
+		result.addBinary(sigTagRsa, signature)
+	}
+	return result, nil
+}
+
+func writePackage(output string, configuration *Configuration, signatureData []byte, headerData []byte, payloadFile string) error {
+	var buffer bytes.Buffer
+	buffer.Write(createLead(configuration.Name + "-" + configuration.Version + "-" + configuration.Release))
+	buffer.Write(signatureData)
+	// signature is 8-byte aligned
+	if buffer.Len()%8 != 0 {
+		buffer.Write(make([]byte, 8-buffer.Len()%8))
+	}
+	buffer.Write(headerData)
+
+	return fs.WriteFileAtomicWith(output, 0644, func(outFile *os.File) error {
+		_, err := outFile.Write(buffer.Bytes())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return linuxPackage.CopyFile(payloadFile, outFile)
+	})
+}
+
+// lead is obsolete, but still required (only magic and signature type are checked)
+func createLead(name string) []byte {
+	result := make([]byte, leadSize)
+	copy(result, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	// binary package (type 0), archnum is not used by rpm
+	binary.BigEndian.PutUint16(result[8:], 1)
+	if len(name) > 65 {
+		name = name[:65]
+	}
+	copy(result[10:76], name)
+	// os linux
+	binary.BigEndian.PutUint16(result[76:], 1)
+	binary.BigEndian.PutUint16(result[78:], signatureTypeHeader)
+	return result
+}
+
+func removeDir(dir string) {
+	err := os.RemoveAll(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Warn("cannot remove temporary dir")
+	}
+}
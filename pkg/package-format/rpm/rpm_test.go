@@ -0,0 +1,110 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/package-format/linuxPackage"
+	. "github.com/onsi/gomega"
+)
+
+type parsedHeader struct {
+	tags map[int32][]byte
+	// offset after header data
+	end int
+}
+
+func parseHeader(g *GomegaWithT, data []byte, offset int) parsedHeader {
+	g.Expect(data[offset : offset+4]).To(Equal([]byte{0x8e, 0xad, 0xe8, 0x01}))
+	indexCount := int(binary.BigEndian.Uint32(data[offset+8:]))
+	storeSize := int(binary.BigEndian.Uint32(data[offset+12:]))
+	storeOffset := offset + 16 + indexCount*16
+	store := data[storeOffset : storeOffset+storeSize]
+
+	result := parsedHeader{tags: make(map[int32][]byte), end: storeOffset + storeSize}
+	for index := 0; index < indexCount; index++ {
+		entry := data[offset+16+index*16:]
+		tag := int32(binary.BigEndian.Uint32(entry))
+		entryOffset := int(int32(binary.BigEndian.Uint32(entry[8:])))
+		result.tags[tag] = store[entryOffset:]
+	}
+	return result
+}
+
+func readString(data []byte) string {
+	return string(data[:bytes.IndexByte(data, 0)])
+}
+
+func TestBuild(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "rpm")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appDir := filepath.Join(tmpDir, "linux-unpacked")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "foo"), []byte("#!/bin/sh\n"), 0755)).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app.asar"), []byte("asar"), 0644)).NotTo(HaveOccurred())
+
+	output := filepath.Join(tmpDir, "foo.rpm")
+	configuration := &Configuration{
+		Layout:      linuxPackage.Layout{AppDir: appDir, Name: "foo", Executable: "foo"},
+		Version:     "1.0.0-beta.1",
+		Arch:        "x64",
+		Requires:    []string{"gtk3", "nss >= 3.0"},
+		Compression: "gzip",
+	}
+	g.Expect(Build(configuration, output, nil)).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(output)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data[:4]).To(Equal([]byte{0xed, 0xab, 0xee, 0xdb}))
+	g.Expect(readString(data[10:])).To(Equal("foo-1.0.0~beta.1-1"))
+
+	signature := parseHeader(g, data, leadSize)
+	g.Expect(signature.tags).To(HaveKey(int32(sigTagSha256)))
+	g.Expect(signature.tags).NotTo(HaveKey(int32(sigTagRsa)))
+
+	headerOffset := signature.end
+	if headerOffset%8 != 0 {
+		headerOffset += 8 - headerOffset%8
+	}
+	mainHeader := parseHeader(g, data, headerOffset)
+	g.Expect(readString(mainHeader.tags[tagName])).To(Equal("foo"))
+	g.Expect(readString(mainHeader.tags[tagVersion])).To(Equal("1.0.0~beta.1"))
+	g.Expect(readString(mainHeader.tags[tagArch])).To(Equal("x86_64"))
+	g.Expect(readString(mainHeader.tags[tagPayloadCompressor])).To(Equal("gzip"))
+	g.Expect(readString(mainHeader.tags[tagRequireName])).To(Equal("gtk3"))
+
+	// the whole header is covered by sha256 from signature
+	g.Expect(readString(signature.tags[sigTagSha256])).To(HaveLen(64))
+
+	payloadReader, err := gzip.NewReader(bytes.NewReader(data[mainHeader.end:]))
+	g.Expect(err).NotTo(HaveOccurred())
+	payload, err := ioutil.ReadAll(payloadReader)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(payload[:6])).To(Equal("070701"))
+	g.Expect(len(payload) % 4).To(Equal(0))
+	g.Expect(string(payload)).To(ContainSubstring("./opt/foo/resources/app.asar\x00"))
+	g.Expect(string(payload)).To(ContainSubstring("./usr/bin/foo\x00"))
+	g.Expect(string(payload)).To(ContainSubstring("TRAILER!!!"))
+	// system dirs are not owned by package
+	g.Expect(strings.Contains(string(payload), "./usr/bin\x00")).To(BeFalse())
+}
+
+func TestParseDependencies(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(parseDependencies([]string{"gtk3", "nss >= 3.0", "foo < 2"})).To(Equal([]dependency{
+		{name: "gtk3"},
+		{name: "nss", flags: senseGreater | senseEqual, version: "3.0"},
+		{name: "foo", flags: senseLess, version: "2"},
+	}))
+}
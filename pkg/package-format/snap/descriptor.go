@@ -0,0 +1,198 @@
+package snap
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+	"gopkg.in/yaml.v2"
+)
+
+// snapcraft metadata to render meta/snap.yaml when snap is built from template (snapcraft is not used in this case)
+type SnapConfiguration struct {
+	Name        string `json:"name" yaml:"name"`
+	Version     string `json:"version" yaml:"version"`
+	Summary     string `json:"summary" yaml:"summary"`
+	Description string `json:"description" yaml:"description"`
+
+	Base        string `json:"base" yaml:"base,omitempty"`
+	Grade       string `json:"grade" yaml:"grade"`
+	Confinement string `json:"confinement" yaml:"confinement"`
+
+	Architectures []string `json:"architectures" yaml:"architectures,omitempty"`
+
+	// key to value, e.g. LD_LIBRARY_PATH
+	Environment map[string]string `json:"environment" yaml:"environment,omitempty"`
+	// app name (executable name by default) to app
+	Apps map[string]*SnapApp `json:"apps" yaml:"apps"`
+	// plug name to attributes (interface, content, target and so on)
+	Plugs map[string]map[string]string `json:"plugs" yaml:"plugs,omitempty"`
+
+	DesktopEntry string `json:"desktopEntry" yaml:"-"`
+}
+
+type SnapApp struct {
+	Command   string   `json:"command" yaml:"command"`
+	Desktop   string   `json:"desktop" yaml:"desktop,omitempty"`
+	Autostart string   `json:"autostart" yaml:"autostart,omitempty"`
+	Plugs     []string `json:"plugs" yaml:"plugs,omitempty"`
+}
+
+// JSON string or base64 encoded JSON (as for appimage)
+func ParseSnapConfiguration(raw string) (*SnapConfiguration, error) {
+	data := []byte(raw)
+	if !strings.HasPrefix(raw, "{") {
+		var err error
+		data, err = base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var result SnapConfiguration
+	err := jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &result, nil
+}
+
+func ReadSnapConfiguration(file string) (*SnapConfiguration, error) {
+	var result SnapConfiguration
+	err := util.LoadConfig(file, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// nil if neither configuration file nor configuration is specified
+func readSnapConfiguration(options SnapOptions) (*SnapConfiguration, error) {
+	if options.configurationFile != nil && len(*options.configurationFile) != 0 {
+		return ReadSnapConfiguration(*options.configurationFile)
+	}
+	if options.configuration != nil && len(*options.configuration) != 0 {
+		return ParseSnapConfiguration(*options.configuration)
+	}
+	return nil, nil
+}
+
+func (t *SnapConfiguration) normalize(options SnapOptions) error {
+	if len(t.Name) == 0 {
+		return util.NewMessageError("snap name is not specified", "ERR_SNAP_NAME_NOT_SPECIFIED")
+	}
+	if len(t.Version) == 0 {
+		return util.NewMessageError("snap version is not specified", "ERR_SNAP_VERSION_NOT_SPECIFIED")
+	}
+
+	if len(t.Summary) == 0 {
+		t.Summary = t.Name
+	}
+	if len(t.Description) == 0 {
+		t.Description = t.Summary
+	}
+	if len(t.Grade) == 0 {
+		t.Grade = "stable"
+	}
+	if len(t.Confinement) == 0 {
+		t.Confinement = "strict"
+	}
+	if len(t.Architectures) == 0 {
+		t.Architectures = []string{toSnapArch(*options.arch)}
+	}
+
+	if len(t.Apps) == 0 {
+		appName := t.Name
+		if options.executableName != nil && len(*options.executableName) != 0 {
+			appName = *options.executableName
+		}
+		t.Apps = map[string]*SnapApp{
+			appName: {Command: "command.sh"},
+		}
+	}
+	for name, app := range t.Apps {
+		if app == nil || len(app.Command) == 0 {
+			return errors.Errorf("command is not specified for snap app %s", name)
+		}
+	}
+	return nil
+}
+
+// snap uses debian arch names
+func toSnapArch(arch string) string {
+	if arch == "armv7l" {
+		return "armhf"
+	}
+	return arch
+}
+
+// values are quoted by encoder if needed (e.g. summary with colon), map keys are sorted
+func renderSnapYaml(configuration *SnapConfiguration) ([]byte, error) {
+	result, err := yaml.Marshal(configuration)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+// writes meta/snap.yaml and meta/gui/<app>.desktop into the stage dir
+func writeSnapMetadata(configuration *SnapConfiguration, options SnapOptions) error {
+	err := configuration.normalize(options)
+	if err != nil {
+		return err
+	}
+
+	data, err := renderSnapYaml(configuration)
+	if err != nil {
+		return err
+	}
+
+	metaDir := filepath.Join(*options.stageDir, "meta")
+	err = fsutil.EnsureDir(metaDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(metaDir, "snap.yaml"), data, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(configuration.DesktopEntry) == 0 {
+		return nil
+	}
+
+	guiDir := filepath.Join(metaDir, "gui")
+	err = fsutil.EnsureDir(guiDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// snapd expects desktop file named as app
+	appNames := make([]string, 0, len(configuration.Apps))
+	for name := range configuration.Apps {
+		appNames = append(appNames, name)
+	}
+	sort.Strings(appNames)
+	err = ioutil.WriteFile(filepath.Join(guiDir, appNames[0]+".desktop"), []byte(configuration.DesktopEntry), 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// mksquashfs uses SOURCE_DATE_EPOCH (if supported) for all timestamps, so, output doesn't depend on build time
+func squashfsEnv() []string {
+	env := os.Environ()
+	if len(os.Getenv("SOURCE_DATE_EPOCH")) == 0 {
+		env = append(env, "SOURCE_DATE_EPOCH=0")
+	}
+	return env
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/develar/app-builder/pkg/download"
 	"github.com/develar/app-builder/pkg/fs"
 	"github.com/develar/app-builder/pkg/linuxTools"
+	"github.com/develar/app-builder/pkg/preflight"
+	"github.com/develar/app-builder/pkg/squashfs"
 	"github.com/develar/app-builder/pkg/util"
 	"github.com/develar/errors"
 	"github.com/mcuadros/go-version"
@@ -54,6 +56,10 @@ type SnapOptions struct {
 	hooksDir       *string
 	executableName *string
 
+	// snap.yaml is generated if specified (only for template build)
+	configuration     *string
+	configurationFile *string
+
 	dockerImage *string
 
 	arch   *string
@@ -77,11 +83,13 @@ func ConfigureCommand(app *kingpin.Application) {
 
 	//noinspection SpellCheckingInspection
 	options := SnapOptions{
-		appDir:         command.Flag("app", "The app dir.").Short('a').Required().String(),
-		stageDir:       command.Flag("stage", "The stage dir.").Short('s').Required().String(),
-		icon:           command.Flag("icon", "The path to the icon.").String(),
-		hooksDir:       command.Flag("hooks", "The hooks dir.").String(),
-		executableName: command.Flag("executable", "The executable file name to create command wrapper.").String(),
+		appDir:            command.Flag("app", "The app dir.").Short('a').Required().String(),
+		stageDir:          command.Flag("stage", "The stage dir.").Short('s').Required().String(),
+		icon:              command.Flag("icon", "The path to the icon.").String(),
+		hooksDir:          command.Flag("hooks", "The hooks dir.").String(),
+		executableName:    command.Flag("executable", "The executable file name to create command wrapper.").String(),
+		configuration:     command.Flag("configuration", "The snap metadata (JSON or base64 encoded JSON) to generate snap.yaml.").String(),
+		configurationFile: command.Flag("configuration-file", "The snap metadata file (JSON, JSON5, YAML or TOML), used instead of --configuration.").String(),
 
 		arch: command.Flag("arch", "The arch.").Default("amd64").Enum("amd64", "i386", "armv7l", "arm64"),
 
@@ -103,6 +111,9 @@ func ConfigureCommand(app *kingpin.Application) {
 		err = Snap(resolvedTemplateFile, isUseDocker, options)
 		if err != nil {
 			switch e := errors.Cause(err).(type) {
+			case *preflight.InsufficientDiskSpaceError:
+				return preflight.WriteUserError(err)
+
 			case util.MessageError:
 				log.Fatal(e.Error())
 
@@ -193,6 +204,16 @@ func DetectIsUseDocker(isUseDocker bool, isUseTemplateApp bool) bool {
 
 func Snap(templateFile string, isUseDocker bool, options SnapOptions) error {
 	stageDir := *options.stageDir
+	tempDir, err := util.DefaultTempDirManager.Root()
+	if err != nil {
+		return err
+	}
+
+	err = preflight.CheckPackaging([]string{*options.appDir}, stageDir, tempDir, *options.output)
+	if err != nil {
+		return err
+	}
+
 	isUseTemplateApp := len(templateFile) != 0
 	var snapMetaDir string
 	if isUseTemplateApp {
@@ -223,6 +244,20 @@ func Snap(templateFile string, isUseDocker bool, options SnapOptions) error {
 		}
 	}
 
+	if isUseTemplateApp {
+		configuration, err := readSnapConfiguration(options)
+		if err != nil {
+			return err
+		}
+
+		if configuration != nil {
+			err = writeSnapMetadata(configuration, options)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	switch {
 	case isUseTemplateApp:
 		return buildWithoutDockerUsingTemplate(templateFile, options)
@@ -277,14 +312,9 @@ func RemoveAdapter(snapFilePath string) error {
 func buildWithoutDockerUsingTemplate(templateFile string, options SnapOptions) error {
 	stageDir := *options.stageDir
 
-	mksquashfsPath, err := linuxTools.GetMksquashfs()
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
 	var args []string
 
-	args, err = linuxTools.ReadDirContentTo(templateFile, args)
+	args, err := linuxTools.ReadDirContentTo(templateFile, args)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -299,9 +329,24 @@ func buildWithoutDockerUsingTemplate(templateFile string, options SnapOptions) e
 		return errors.WithStack(err)
 	}
 
+	if util.IsEnvTrue("USE_BUILTIN_SQUASHFS") {
+		timestamp, err := squashfs.DefaultTimestamp()
+		if err != nil {
+			return err
+		}
+		return squashfs.Create(util.RootContext(), &squashfs.Options{Sources: args, Output: *options.output, Compression: "xz", Timestamp: timestamp})
+	}
+
+	mksquashfsPath, err := linuxTools.GetMksquashfs()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	args = append(args, *options.output, "-no-progress", "-quiet", "-noappend", "-comp", "xz", "-no-xattrs", "-no-fragments", "-all-root")
 
-	_, err = util.Execute(exec.Command(mksquashfsPath, args...), "")
+	command := exec.Command(mksquashfsPath, args...)
+	command.Env = squashfsEnv()
+	_, err = util.Execute(command, "")
 	if err != nil {
 		return errors.WithStack(err)
 	}
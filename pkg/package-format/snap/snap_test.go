@@ -20,4 +20,41 @@ func TestCheckWineVersion(t *testing.T) {
 
 	err = doCheckSnapVersion("2.12", "")
 	g.Expect(err).To(HaveOccurred())
-}
\ No newline at end of file
+}
+func TestRenderSnapYaml(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	configuration, err := ParseSnapConfiguration(`{"name": "foo", "version": "1.10", "summary": "Foo: \"bar\"", "environment": {"DISABLE_WAYLAND": "true"}, "plugs": {"gnome-3-26-1604": {"interface": "content", "target": "gnome-platform"}}}`)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	arch := "armv7l"
+	executableName := "foo-app"
+	err = configuration.normalize(SnapOptions{arch: &arch, executableName: &executableName})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := renderSnapYaml(configuration)
+	g.Expect(err).NotTo(HaveOccurred())
+	// version and environment value must stay strings
+	g.Expect(string(data)).To(Equal(`name: foo
+version: "1.10"
+summary: 'Foo: "bar"'
+description: 'Foo: "bar"'
+grade: stable
+confinement: strict
+architectures:
+- armhf
+environment:
+  DISABLE_WAYLAND: "true"
+apps:
+  foo-app:
+    command: command.sh
+plugs:
+  gnome-3-26-1604:
+    interface: content
+    target: gnome-platform
+`))
+
+	configuration, err = ParseSnapConfiguration(`{"version": "1.0.0"}`)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(configuration.normalize(SnapOptions{arch: &arch})).To(HaveOccurred())
+}
@@ -0,0 +1,359 @@
+package pe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/apex/log"
+	"github.com/develar/errors"
+)
+
+const (
+	dirResource  = 2
+	dirSecurity  = 4
+	dirBaseReloc = 5
+
+	sectionHeaderSize = 40
+
+	// IMAGE_SCN_CNT_INITIALIZED_DATA | IMAGE_SCN_MEM_READ
+	resourceSectionCharacteristics = 0x40000040
+)
+
+type Section struct {
+	Name           string
+	VirtualSize    uint32
+	VirtualAddress uint32
+	SizeOfRawData  uint32
+	// file offset
+	PointerToRawData uint32
+	Characteristics  uint32
+
+	// index in the section table
+	index int
+}
+
+type DataDirectory struct {
+	VirtualAddress uint32
+	Size           uint32
+}
+
+// File is a parsed PE image, only headers required to rewrite resource section are parsed (see debug/pe for the rest)
+type File struct {
+	data []byte
+
+	Machine          uint16
+	Is64             bool
+	sectionAlignment uint32
+	fileAlignment    uint32
+
+	optionalHeaderOffset int
+	sectionTableOffset   int
+	dataDirectoryOffset  int
+	numberOfDirectories  int
+
+	Sections []*Section
+}
+
+func Parse(data []byte) (*File, error) {
+	if len(data) < 0x40 || data[0] != 'M' || data[1] != 'Z' {
+		return nil, errors.New("not a PE file (MZ signature is missing)")
+	}
+
+	peOffset := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if peOffset+24 > len(data) || !bytes.Equal(data[peOffset:peOffset+4], []byte("PE\x00\x00")) {
+		return nil, errors.New("not a PE file (PE signature is missing)")
+	}
+
+	coffOffset := peOffset + 4
+	t := &File{
+		data:                 data,
+		Machine:              binary.LittleEndian.Uint16(data[coffOffset:]),
+		optionalHeaderOffset: coffOffset + 20,
+	}
+	numberOfSections := int(binary.LittleEndian.Uint16(data[coffOffset+2:]))
+	sizeOfOptionalHeader := int(binary.LittleEndian.Uint16(data[coffOffset+16:]))
+	t.sectionTableOffset = t.optionalHeaderOffset + sizeOfOptionalHeader
+	if t.sectionTableOffset+numberOfSections*sectionHeaderSize > len(data) {
+		return nil, errors.New("section table is truncated")
+	}
+
+	switch magic := binary.LittleEndian.Uint16(data[t.optionalHeaderOffset:]); magic {
+	case 0x10b:
+		t.dataDirectoryOffset = t.optionalHeaderOffset + 96
+	case 0x20b:
+		t.Is64 = true
+		t.dataDirectoryOffset = t.optionalHeaderOffset + 112
+	default:
+		return nil, errors.Errorf("unsupported optional header magic: %#x", magic)
+	}
+
+	t.sectionAlignment = binary.LittleEndian.Uint32(data[t.optionalHeaderOffset+32:])
+	t.fileAlignment = binary.LittleEndian.Uint32(data[t.optionalHeaderOffset+36:])
+	t.numberOfDirectories = int(binary.LittleEndian.Uint32(data[t.dataDirectoryOffset-4:]))
+
+	for index := 0; index < numberOfSections; index++ {
+		header := data[t.sectionTableOffset+index*sectionHeaderSize:]
+		t.Sections = append(t.Sections, &Section{
+			Name:             string(bytes.TrimRight(header[:8], "\x00")),
+			VirtualSize:      binary.LittleEndian.Uint32(header[8:]),
+			VirtualAddress:   binary.LittleEndian.Uint32(header[12:]),
+			SizeOfRawData:    binary.LittleEndian.Uint32(header[16:]),
+			PointerToRawData: binary.LittleEndian.Uint32(header[20:]),
+			Characteristics:  binary.LittleEndian.Uint32(header[36:]),
+			index:            index,
+		})
+	}
+	return t, nil
+}
+
+func (t *File) DataDirectory(index int) DataDirectory {
+	if index >= t.numberOfDirectories {
+		return DataDirectory{}
+	}
+	offset := t.dataDirectoryOffset + index*8
+	return DataDirectory{VirtualAddress: binary.LittleEndian.Uint32(t.data[offset:]), Size: binary.LittleEndian.Uint32(t.data[offset+4:])}
+}
+
+func (t *File) setDataDirectory(data []byte, index int, directory DataDirectory) {
+	offset := t.dataDirectoryOffset + index*8
+	binary.LittleEndian.PutUint32(data[offset:], directory.VirtualAddress)
+	binary.LittleEndian.PutUint32(data[offset+4:], directory.Size)
+}
+
+func (t *File) sectionByRva(rva uint32) *Section {
+	for _, section := range t.Sections {
+		size := section.VirtualSize
+		if size == 0 {
+			size = section.SizeOfRawData
+		}
+		if rva >= section.VirtualAddress && rva < section.VirtualAddress+size {
+			return section
+		}
+	}
+	return nil
+}
+
+// ReadRva returns data of image at rva (not initialized part of section is not returned)
+func (t *File) ReadRva(rva uint32, size uint32) ([]byte, error) {
+	section := t.sectionByRva(rva)
+	if section == nil {
+		return nil, errors.Errorf("rva %#x is not in any section", rva)
+	}
+
+	offset := rva - section.VirtualAddress
+	if offset+size > section.SizeOfRawData || int(section.PointerToRawData+offset+size) > len(t.data) {
+		return nil, errors.Errorf("data at rva %#x (size %d) is out of file", rva, size)
+	}
+	start := section.PointerToRawData + offset
+	return t.data[start : start+size], nil
+}
+
+// end of the last section data, the rest is overlay (e.g. installer payload) or certificate table
+func (t *File) sectionDataEnd() uint32 {
+	var result uint32
+	for _, section := range t.Sections {
+		if end := section.PointerToRawData + section.SizeOfRawData; section.SizeOfRawData != 0 && end > result {
+			result = end
+		}
+	}
+	return result
+}
+
+func align(value uint32, alignment uint32) uint32 {
+	if alignment == 0 {
+		return value
+	}
+	return (value + alignment - 1) / alignment * alignment
+}
+
+// ReplaceResources writes image with new resource section (serialized at the given rva by build).
+// If resource section is followed only by relocation section, both are rewritten in place (relocations are position independent),
+// otherwise new resource section is appended and the old one is kept as unreferenced data.
+// Authenticode signature is removed (it is invalid after modification), overlay data is preserved.
+func (t *File) ReplaceResources(build func(rva uint32) []byte) ([]byte, error) {
+	resourceSection := t.sectionByRva(t.DataDirectory(dirResource).VirtualAddress)
+	if t.DataDirectory(dirResource).VirtualAddress == 0 {
+		resourceSection = nil
+	}
+
+	sortedSections := make([]*Section, len(t.Sections))
+	copy(sortedSections, t.Sections)
+	sort.Slice(sortedSections, func(i, j int) bool {
+		return sortedSections[i].VirtualAddress < sortedSections[j].VirtualAddress
+	})
+
+	var movedSections []*Section
+	isInPlace := false
+	if resourceSection != nil {
+		isInPlace = true
+		relocDirectory := t.DataDirectory(dirBaseReloc)
+		for _, section := range sortedSections {
+			if section.VirtualAddress <= resourceSection.VirtualAddress {
+				continue
+			}
+			if relocDirectory.VirtualAddress == 0 || t.sectionByRva(relocDirectory.VirtualAddress) != section {
+				isInPlace = false
+				break
+			}
+			movedSections = append(movedSections, section)
+		}
+	}
+
+	security := t.DataDirectory(dirSecurity)
+	dataEnd := t.sectionDataEnd()
+	var overlay []byte
+	if int(dataEnd) < len(t.data) {
+		overlayEnd := uint32(len(t.data))
+		if security.VirtualAddress != 0 && security.VirtualAddress >= dataEnd {
+			overlayEnd = security.VirtualAddress
+		}
+		overlay = t.data[dataEnd:overlayEnd]
+	}
+	if security.VirtualAddress != 0 {
+		log.Warn("existing signature is removed, file must be signed again")
+	}
+
+	var result []byte
+	var newResource *Section
+	if isInPlace {
+		newResource = &Section{
+			Name:             resourceSection.Name,
+			VirtualAddress:   resourceSection.VirtualAddress,
+			PointerToRawData: resourceSection.PointerToRawData,
+			Characteristics:  resourceSection.Characteristics,
+			index:            resourceSection.index,
+		}
+		result = append(result, t.data[:resourceSection.PointerToRawData]...)
+	} else {
+		headerEnd := t.sectionTableOffset + (len(t.Sections)+1)*sectionHeaderSize
+		if uint32(headerEnd) > t.sizeOfHeaders() || uint32(headerEnd) > t.firstSectionOffset() {
+			return nil, errors.New("no space in section table to add resource section")
+		}
+
+		last := sortedSections[len(sortedSections)-1]
+		newResource = &Section{
+			Name:             ".rsrc",
+			VirtualAddress:   align(last.VirtualAddress+maxUint32(last.VirtualSize, last.SizeOfRawData), t.sectionAlignment),
+			PointerToRawData: align(dataEnd, t.fileAlignment),
+			Characteristics:  resourceSectionCharacteristics,
+			index:            len(t.Sections),
+		}
+		result = append(result, t.data[:dataEnd]...)
+		if resourceSection != nil {
+			// old data is kept because some other section may follow it
+			t.writeSectionName(result, resourceSection.index, ".oldrsrc")
+		}
+	}
+
+	resourceData := build(newResource.VirtualAddress)
+	newResource.VirtualSize = uint32(len(resourceData))
+	newResource.SizeOfRawData = align(uint32(len(resourceData)), t.fileAlignment)
+	result = appendPadded(result, newResource.PointerToRawData, resourceData, newResource.SizeOfRawData)
+
+	if !isInPlace {
+		newSectionCount := len(t.Sections) + 1
+		binary.LittleEndian.PutUint16(result[t.optionalHeaderOffset-20+2:], uint16(newSectionCount))
+	}
+	t.writeSectionHeader(result, newResource)
+
+	lastSection := newResource
+	nextRva := align(newResource.VirtualAddress+newResource.VirtualSize, t.sectionAlignment)
+	for _, section := range movedSections {
+		moved := *section
+		moved.VirtualAddress = nextRva
+		moved.PointerToRawData = uint32(len(result))
+		result = appendPadded(result, moved.PointerToRawData, t.data[section.PointerToRawData:section.PointerToRawData+section.SizeOfRawData], section.SizeOfRawData)
+		t.writeSectionHeader(result, &moved)
+
+		relocDirectory := t.DataDirectory(dirBaseReloc)
+		relocDirectory.VirtualAddress = relocDirectory.VirtualAddress - section.VirtualAddress + moved.VirtualAddress
+		t.setDataDirectory(result, dirBaseReloc, relocDirectory)
+
+		nextRva = align(moved.VirtualAddress+maxUint32(moved.VirtualSize, moved.SizeOfRawData), t.sectionAlignment)
+		lastSection = &moved
+	}
+
+	t.setDataDirectory(result, dirResource, DataDirectory{VirtualAddress: newResource.VirtualAddress, Size: newResource.VirtualSize})
+	t.setDataDirectory(result, dirSecurity, DataDirectory{})
+
+	sizeOfImage := binary.LittleEndian.Uint32(result[t.optionalHeaderOffset+56:])
+	if end := align(lastSection.VirtualAddress+maxUint32(lastSection.VirtualSize, lastSection.SizeOfRawData), t.sectionAlignment); end > sizeOfImage || isInPlace {
+		binary.LittleEndian.PutUint32(result[t.optionalHeaderOffset+56:], end)
+	}
+
+	result = append(result, overlay...)
+	binary.LittleEndian.PutUint32(result[t.optionalHeaderOffset+64:], computeChecksum(result, t.optionalHeaderOffset+64))
+	return result, nil
+}
+
+func (t *File) sizeOfHeaders() uint32 {
+	return binary.LittleEndian.Uint32(t.data[t.optionalHeaderOffset+60:])
+}
+
+func (t *File) firstSectionOffset() uint32 {
+	result := uint32(len(t.data))
+	for _, section := range t.Sections {
+		if section.SizeOfRawData != 0 && section.PointerToRawData < result {
+			result = section.PointerToRawData
+		}
+	}
+	return result
+}
+
+func (t *File) writeSectionName(data []byte, index int, name string) {
+	header := data[t.sectionTableOffset+index*sectionHeaderSize:]
+	var nameBytes [8]byte
+	copy(nameBytes[:], name)
+	copy(header, nameBytes[:])
+}
+
+func (t *File) writeSectionHeader(data []byte, section *Section) {
+	header := data[t.sectionTableOffset+section.index*sectionHeaderSize:]
+	t.writeSectionName(data, section.index, section.Name)
+	binary.LittleEndian.PutUint32(header[8:], section.VirtualSize)
+	binary.LittleEndian.PutUint32(header[12:], section.VirtualAddress)
+	binary.LittleEndian.PutUint32(header[16:], section.SizeOfRawData)
+	binary.LittleEndian.PutUint32(header[20:], section.PointerToRawData)
+	binary.LittleEndian.PutUint32(header[36:], section.Characteristics)
+}
+
+// data is written at offset (gap is zero filled) and padded to size
+func appendPadded(result []byte, offset uint32, data []byte, size uint32) []byte {
+	for uint32(len(result)) < offset {
+		result = append(result, 0)
+	}
+	result = append(result, data...)
+	for padding := int(size) - len(data); padding > 0; padding-- {
+		result = append(result, 0)
+	}
+	return result
+}
+
+func maxUint32(a uint32, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// the same algorithm as CheckSumMappedFile (checksum field itself is skipped)
+func computeChecksum(data []byte, checksumOffset int) uint32 {
+	var sum uint64
+	for offset := 0; offset < len(data); offset += 2 {
+		if offset == checksumOffset || offset == checksumOffset+2 {
+			continue
+		}
+
+		var word uint64
+		if offset+1 < len(data) {
+			word = uint64(binary.LittleEndian.Uint16(data[offset:]))
+		} else {
+			word = uint64(data[offset])
+		}
+		sum += word
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	sum = (sum & 0xffff) + (sum >> 16)
+	return uint32(sum) + uint32(len(data))
+}
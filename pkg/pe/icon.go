@@ -0,0 +1,133 @@
+package pe
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+type icoImage struct {
+	// ICONDIRENTRY without offset (width, height, color count, reserved, planes, bit count, bytes in resource)
+	header []byte
+	data   []byte
+}
+
+func parseIco(data []byte) ([]icoImage, error) {
+	if len(data) < 6 || !icons.IsIco(data) || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, errors.New("not an ICO file")
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+count*16 {
+		return nil, errors.New("ICO directory is empty or truncated")
+	}
+
+	result := make([]icoImage, count)
+	for index := range result {
+		entry := data[6+index*16:]
+		size := binary.LittleEndian.Uint32(entry[8:])
+		offset := binary.LittleEndian.Uint32(entry[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return nil, errors.Errorf("ICO image %d is out of file", index)
+		}
+		result[index] = icoImage{header: entry[:12], data: data[offset : offset+size]}
+	}
+	return result, nil
+}
+
+// readIcon reads ICO file, icon in other format (png, icns and so on) is converted to ICO
+func readIcon(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(data) >= 6 && icons.IsIco(data) {
+		return data, nil
+	}
+
+	tempDir, err := util.TempDir("", ".rcedit")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	icoFile := filepath.Join(tempDir, "icon.ico")
+	_, err = icons.ConvertIcon(util.RootContext(), &icons.IconConvertRequest{
+		Sources:      &[]string{file},
+		OutputFormat: "ico",
+		OutputFile:   icoFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ioutil.ReadFile(icoFile)
+	return data, errors.WithStack(err)
+}
+
+// SetIcon replaces the first icon group (application icon). Icons of the replaced group are removed.
+func SetIcon(resources *ResourceDirectory, icoData []byte) error {
+	images, err := parseIco(icoData)
+	if err != nil {
+		return err
+	}
+
+	groupName, language, groupData, exists := resources.First(TypeGroupIcon)
+	if exists {
+		iconDirectory := resources.Type(TypeIcon)
+		for _, id := range getGroupIconIds(groupData) {
+			if iconDirectory != nil {
+				iconDirectory.Remove(IntResource(id))
+			}
+		}
+	} else {
+		groupName = IntResource(1)
+		language = defaultLanguage
+	}
+
+	usedIds := make(map[uint16]bool)
+	if iconDirectory := resources.Type(TypeIcon); iconDirectory != nil {
+		for _, entry := range iconDirectory.Entries {
+			if !entry.IsName() {
+				usedIds[entry.Id.Id] = true
+			}
+		}
+	}
+
+	// GRPICONDIR: reserved, type (1 - icon), count, then GRPICONDIRENTRY (ICONDIRENTRY where offset is replaced with 2-byte id)
+	group := make([]byte, 6, 6+len(images)*14)
+	binary.LittleEndian.PutUint16(group[2:], 1)
+	binary.LittleEndian.PutUint16(group[4:], uint16(len(images)))
+	nextId := uint16(1)
+	for _, frame := range images {
+		for usedIds[nextId] {
+			nextId++
+		}
+		usedIds[nextId] = true
+
+		resources.Set(TypeIcon, IntResource(nextId), language, frame.data)
+		group = append(group, frame.header...)
+		group = append(group, byte(nextId), byte(nextId>>8))
+	}
+
+	resources.Set(TypeGroupIcon, groupName, language, group)
+	return nil
+}
+
+func getGroupIconIds(data []byte) []uint16 {
+	if len(data) < 6 {
+		return nil
+	}
+
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	var result []uint16
+	for index := 0; index < count && 6+(index+1)*14 <= len(data); index++ {
+		result = append(result, binary.LittleEndian.Uint16(data[6+index*14+12:]))
+	}
+	return result
+}
@@ -0,0 +1,409 @@
+package pe
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/errors"
+)
+
+// WIN_CERTIFICATE revision 2.0, type PKCS#7 SignedData
+const (
+	certificateRevision = 0x200
+	certificateTypePkcs = 2
+)
+
+var machineNames = map[uint16]string{0x14c: "ia32", 0x8664: "x64", 0xaa64: "arm64", 0x1c4: "armv7l"}
+
+var subsystemNames = map[uint16]string{1: "native", 2: "gui", 3: "console", 10: "efi-application", 11: "efi-boot-service-driver", 12: "efi-runtime-driver"}
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	// countersignature and RFC 3161 timestamp (Microsoft)
+	oidCounterSignature = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidRfc3161Timestamp = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+
+	digestAlgorithmNames = map[string]string{
+		"1.3.14.3.2.26":          "sha1",
+		"2.16.840.1.101.3.4.2.1": "sha256",
+		"2.16.840.1.101.3.4.2.2": "sha384",
+		"2.16.840.1.101.3.4.2.3": "sha512",
+	}
+)
+
+type Info struct {
+	File string `json:"file"`
+	// ia32, x64, arm64 or armv7l (hex value if unknown)
+	Machine string `json:"machine"`
+	Is64    bool   `json:"is64"`
+	// gui, console and so on
+	Subsystem string `json:"subsystem"`
+
+	Signature SignatureInfo `json:"signature"`
+	Version   *VersionInfo  `json:"version,omitempty"`
+	// the first group is the application icon (shown by Explorer and used for shortcuts)
+	IconGroups []IconGroup `json:"iconGroups"`
+}
+
+// SignatureInfo describes embedded Authenticode signature, signature is not verified (only structure and signer certificate are read)
+type SignatureInfo struct {
+	// unsigned, signed or malformed
+	Status string `json:"status"`
+	// reason if malformed
+	Error string `json:"error,omitempty"`
+
+	DigestAlgorithm string     `json:"digestAlgorithm,omitempty"`
+	Subject         string     `json:"subject,omitempty"`
+	Issuer          string     `json:"issuer,omitempty"`
+	NotAfter        *time.Time `json:"notAfter,omitempty"`
+	IsTimestamped   bool       `json:"isTimestamped"`
+}
+
+type VersionInfo struct {
+	// VS_FIXEDFILEINFO
+	FileVersion    string `json:"fileVersion"`
+	ProductVersion string `json:"productVersion"`
+	// the first string table
+	Strings map[string]string `json:"strings"`
+}
+
+type IconGroup struct {
+	// id or name
+	Name     string `json:"name"`
+	Language uint16 `json:"language"`
+	// unique widths, ascending
+	Sizes  []int       `json:"sizes"`
+	Images []IconImage `json:"images"`
+}
+
+type IconImage struct {
+	Id uint16 `json:"id"`
+	// actual size of image (not the one declared in the group)
+	Width    int `json:"width"`
+	Height   int `json:"height"`
+	BitCount int `json:"bitCount"`
+	// png or bmp, missing if icon resource doesn't exist
+	Format string `json:"format,omitempty"`
+	Size   int    `json:"size"`
+}
+
+func ConfigureInfoCommand(app *kingpin.Application) {
+	command := app.Command("pe-info", "Report machine, subsystem, Authenticode signature, version info and embedded icon sizes of Windows executable as JSON.")
+	file := command.Arg("file", "The executable (exe or dll).").Required().String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		info, err := ReadInfoFile(*file)
+		if err != nil {
+			return err
+		}
+
+		// encoding/json - version strings are a map
+		data, err := json.Marshal(info)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = os.Stdout.Write(data)
+		return errors.WithStack(err)
+	})
+}
+
+func ReadInfoFile(file string) (*Info, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	info, err := ReadInfo(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read %s", file)
+	}
+	info.File = file
+	return info, nil
+}
+
+func ReadInfo(data []byte) (*Info, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Machine:    machineNames[file.Machine],
+		Is64:       file.Is64,
+		IconGroups: []IconGroup{},
+	}
+	if len(info.Machine) == 0 {
+		info.Machine = fmt.Sprintf("%#x", file.Machine)
+	}
+
+	subsystem := binary.LittleEndian.Uint16(data[file.optionalHeaderOffset+68:])
+	info.Subsystem = subsystemNames[subsystem]
+	if len(info.Subsystem) == 0 {
+		info.Subsystem = strconv.Itoa(int(subsystem))
+	}
+
+	info.Signature = file.readSignature()
+
+	resources, err := file.ReadResources()
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, versionData, ok := resources.First(TypeVersion)
+	if ok {
+		info.Version, err = readVersionInfo(versionData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	info.IconGroups = readIconGroups(resources)
+	return info, nil
+}
+
+// pkcs7 structures (https://tools.ietf.org/html/rfc2315), only fields required to find signer are parsed
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// [0] element itself (inner value is not parsed for raw value)
+	Content asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	Crls             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// certificate table is pointed by file offset (not rva)
+func (t *File) readSignature() SignatureInfo {
+	directory := t.DataDirectory(dirSecurity)
+	if directory.VirtualAddress == 0 || directory.Size == 0 {
+		return SignatureInfo{Status: "unsigned"}
+	}
+
+	malformed := func(message string) SignatureInfo {
+		return SignatureInfo{Status: "malformed", Error: message}
+	}
+
+	if directory.Size < 8 || uint64(directory.VirtualAddress)+uint64(directory.Size) > uint64(len(t.data)) {
+		return malformed("certificate table is out of file")
+	}
+	// WIN_CERTIFICATE: length, revision, certificate type, certificate
+	certificate := t.data[directory.VirtualAddress : directory.VirtualAddress+directory.Size]
+	length := binary.LittleEndian.Uint32(certificate)
+	if length < 8 || length > directory.Size {
+		return malformed("invalid WIN_CERTIFICATE length")
+	}
+	if binary.LittleEndian.Uint16(certificate[4:]) != certificateRevision || binary.LittleEndian.Uint16(certificate[6:]) != certificateTypePkcs {
+		return malformed("unsupported WIN_CERTIFICATE revision or type")
+	}
+
+	var content contentInfo
+	_, err := asn1.Unmarshal(certificate[8:length], &content)
+	if err != nil || !content.ContentType.Equal(oidSignedData) {
+		return malformed("certificate is not PKCS#7 SignedData")
+	}
+
+	var signed signedData
+	_, err = asn1.Unmarshal(content.Content.Bytes, &signed)
+	if err != nil {
+		return malformed("cannot parse SignedData: " + err.Error())
+	}
+	if len(signed.SignerInfos) != 1 {
+		return malformed(fmt.Sprintf("Authenticode requires exactly one signer, found %d", len(signed.SignerInfos)))
+	}
+
+	certificates, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return malformed("cannot parse certificates: " + err.Error())
+	}
+
+	signer := signed.SignerInfos[0]
+	result := SignatureInfo{
+		Status:          "signed",
+		DigestAlgorithm: digestAlgorithmNames[signer.DigestAlgorithm.Algorithm.String()],
+		IsTimestamped:   isTimestamped(signer.UnauthenticatedAttributes.Bytes),
+	}
+	if len(result.DigestAlgorithm) == 0 {
+		result.DigestAlgorithm = signer.DigestAlgorithm.Algorithm.String()
+	}
+
+	for _, certificate := range certificates {
+		if certificate.SerialNumber.Cmp(signer.IssuerAndSerialNumber.SerialNumber) == 0 && bytes.Equal(certificate.RawIssuer, signer.IssuerAndSerialNumber.Issuer.FullBytes) {
+			result.Subject = certificate.Subject.String()
+			result.Issuer = certificate.Issuer.String()
+			result.NotAfter = &certificate.NotAfter
+			return result
+		}
+	}
+	return malformed("signer certificate is not found")
+}
+
+func isTimestamped(attributes []byte) bool {
+	for len(attributes) != 0 {
+		var item attribute
+		rest, err := asn1.Unmarshal(attributes, &item)
+		if err != nil {
+			return false
+		}
+		if item.Type.Equal(oidCounterSignature) || item.Type.Equal(oidRfc3161Timestamp) {
+			return true
+		}
+		attributes = rest
+	}
+	return false
+}
+
+func readVersionInfo(data []byte) (*VersionInfo, error) {
+	node, err := parseVersionInfo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VersionInfo{Strings: make(map[string]string)}
+	if len(node.Value) >= 52 && binary.LittleEndian.Uint32(node.Value) == fixedFileInfoSignature {
+		result.FileVersion = formatFixedVersion(node.Value[8:])
+		result.ProductVersion = formatFixedVersion(node.Value[16:])
+	}
+
+	stringFileInfo := node.child("StringFileInfo")
+	if stringFileInfo != nil && len(stringFileInfo.Children) != 0 {
+		for _, item := range stringFileInfo.Children[0].Children {
+			result.Strings[item.Key] = decodeUtf16(item.Value)
+		}
+	}
+	return result, nil
+}
+
+// MS and LS parts
+func formatFixedVersion(data []byte) string {
+	ms := binary.LittleEndian.Uint32(data)
+	ls := binary.LittleEndian.Uint32(data[4:])
+	return fmt.Sprintf("%d.%d.%d.%d", ms>>16, ms&0xffff, ls>>16, ls&0xffff)
+}
+
+func readIconGroups(resources *ResourceDirectory) []IconGroup {
+	result := []IconGroup{}
+	groups := resources.Type(TypeGroupIcon)
+	if groups == nil {
+		return result
+	}
+
+	iconDirectory := resources.Type(TypeIcon)
+	for _, nameEntry := range groups.sortedEntries() {
+		if nameEntry.Directory == nil || len(nameEntry.Directory.Entries) == 0 {
+			continue
+		}
+
+		languageEntry := nameEntry.Directory.sortedEntries()[0]
+		group := IconGroup{
+			Name:     nameEntry.Id.Name,
+			Language: languageEntry.Id.Id,
+			Sizes:    []int{},
+			Images:   []IconImage{},
+		}
+		if !nameEntry.IsName() {
+			group.Name = strconv.Itoa(int(nameEntry.Id.Id))
+		}
+
+		isSizeAdded := make(map[int]bool)
+		data := languageEntry.Data
+		for index := 0; len(data) >= 6 && index < int(binary.LittleEndian.Uint16(data[4:])) && 6+(index+1)*14 <= len(data); index++ {
+			// GRPICONDIRENTRY: width, height, color count, reserved, planes, bit count, bytes in resource, id
+			entry := data[6+index*14:]
+			image := IconImage{
+				Id:       binary.LittleEndian.Uint16(entry[12:]),
+				Width:    iconDimension(entry[0]),
+				Height:   iconDimension(entry[1]),
+				BitCount: int(binary.LittleEndian.Uint16(entry[6:])),
+			}
+
+			if iconDirectory != nil {
+				if iconData, ok := iconDirectory.firstLanguage(IntResource(image.Id)); ok {
+					image.Size = len(iconData)
+					readIconImageHeader(iconData, &image)
+				}
+			}
+
+			group.Images = append(group.Images, image)
+			if !isSizeAdded[image.Width] {
+				isSizeAdded[image.Width] = true
+				group.Sizes = append(group.Sizes, image.Width)
+			}
+		}
+		sort.Ints(group.Sizes)
+		result = append(result, group)
+	}
+	return result
+}
+
+// 0 means 256
+func iconDimension(value byte) int {
+	if value == 0 {
+		return 256
+	}
+	return int(value)
+}
+
+// PNG (IHDR) or BMP (BITMAPINFOHEADER, height includes mask) header
+func readIconImageHeader(data []byte, image *IconImage) {
+	if len(data) >= 24 && bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		image.Format = "png"
+		image.Width = int(binary.BigEndian.Uint32(data[16:]))
+		image.Height = int(binary.BigEndian.Uint32(data[20:]))
+	} else if len(data) >= 16 && binary.LittleEndian.Uint32(data) == 40 {
+		image.Format = "bmp"
+		image.Width = int(int32(binary.LittleEndian.Uint32(data[4:])))
+		image.Height = int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+		image.BitCount = int(binary.LittleEndian.Uint16(data[14:]))
+	}
+}
+
+// data of resource in the first language
+func (t *ResourceDirectory) firstLanguage(name ResourceId) ([]byte, bool) {
+	entry := t.Find(name)
+	if entry == nil || entry.Directory == nil {
+		return nil, false
+	}
+	for _, languageEntry := range entry.Directory.sortedEntries() {
+		if languageEntry.Directory == nil {
+			return languageEntry.Data, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,127 @@
+package pe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// WIN_CERTIFICATE with minimal SignedData (signature itself is not valid) is appended and referenced by security directory
+func appendTestSignature(g *GomegaWithT, data []byte) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "Test Publisher"},
+		NotBefore:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	certificateData, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	g.Expect(err).NotTo(HaveOccurred())
+	certificate, err := x509.ParseCertificate(certificateData)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	sha256 := pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}}
+	digestAlgorithms, err := asn1.Marshal([]pkix.AlgorithmIdentifier{sha256})
+	g.Expect(err).NotTo(HaveOccurred())
+	// SET instead of SEQUENCE
+	digestAlgorithms[0] = 0x31
+	indirectData, err := asn1.Marshal(struct{ Type asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}})
+	g.Expect(err).NotTo(HaveOccurred())
+	timestamp, err := asn1.Marshal(attribute{Type: oidRfc3161Timestamp, Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	signed, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{FullBytes: digestAlgorithms},
+		ContentInfo:      asn1.RawValue{FullBytes: indirectData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificateData},
+		SignerInfos: []signerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: certificate.RawIssuer}, SerialNumber: big.NewInt(42)},
+			DigestAlgorithm:           sha256,
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			EncryptedDigest:           []byte{1, 2, 3},
+			UnauthenticatedAttributes: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: timestamp},
+		}},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	// explicit tag is not added by marshaller for raw value
+	content, err := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	offset := align(uint32(len(data)), 8)
+	result := appendPadded(data, offset, make([]byte, 8), 8)
+	result = append(result, content...)
+	binary.LittleEndian.PutUint32(result[offset:], uint32(8+len(content)))
+	binary.LittleEndian.PutUint16(result[offset+4:], certificateRevision)
+	binary.LittleEndian.PutUint16(result[offset+6:], certificateTypePkcs)
+
+	file, err := Parse(result)
+	g.Expect(err).NotTo(HaveOccurred())
+	file.setDataDirectory(result, dirSecurity, DataDirectory{VirtualAddress: offset, Size: uint32(8 + len(content))})
+	return result
+}
+
+func TestReadInfo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	input := createTestExecutable(createTestResources(), []string{".text", ".rsrc", ".reloc"})
+	info, err := ReadInfo(input)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Machine).To(Equal("x64"))
+	g.Expect(info.Is64).To(BeTrue())
+	g.Expect(info.Subsystem).To(Equal("gui"))
+	g.Expect(info.Signature).To(Equal(SignatureInfo{Status: "unsigned"}))
+	g.Expect(info.Version).To(BeNil())
+	g.Expect(info.IconGroups).To(BeEmpty())
+
+	data, err := Edit(input, &EditOptions{
+		Icon:           filepath.Join(getTestDataPath(t), "icon.ico"),
+		VersionStrings: map[string]string{"ProductName": "Test App"},
+		FileVersion:    "1.2.3",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	data = appendTestSignature(g, data)
+
+	info, err = ReadInfo(data)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Version.FileVersion).To(Equal("1.2.3.0"))
+	g.Expect(info.Version.Strings).To(HaveKeyWithValue("ProductName", "Test App"))
+	g.Expect(info.Version.Strings).To(HaveKeyWithValue("FileVersion", "1.2.3"))
+
+	g.Expect(info.IconGroups).To(HaveLen(1))
+	group := info.IconGroups[0]
+	g.Expect(group.Name).To(Equal("1"))
+	g.Expect(group.Sizes).NotTo(BeEmpty())
+	g.Expect(group.Sizes[len(group.Sizes)-1]).To(Equal(256))
+	for _, image := range group.Images {
+		g.Expect(image.Format).To(Or(Equal("png"), Equal("bmp")))
+		g.Expect(image.Size).To(BeNumerically(">", 0))
+		g.Expect(image.Width).To(Equal(image.Height))
+	}
+
+	g.Expect(info.Signature.Status).To(Equal("signed"))
+	g.Expect(info.Signature.DigestAlgorithm).To(Equal("sha256"))
+	g.Expect(info.Signature.Subject).To(Equal("CN=Test Publisher"))
+	g.Expect(info.Signature.NotAfter.Year()).To(Equal(2030))
+	g.Expect(info.Signature.IsTimestamped).To(BeTrue())
+
+	// certificate table is out of file
+	file, err := Parse(data)
+	g.Expect(err).NotTo(HaveOccurred())
+	file.setDataDirectory(data, dirSecurity, DataDirectory{VirtualAddress: uint32(len(data)), Size: 16})
+	info, err = ReadInfo(data)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Signature.Status).To(Equal("malformed"))
+}
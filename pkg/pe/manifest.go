@@ -0,0 +1,58 @@
+package pe
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/develar/errors"
+)
+
+var executionLevels = []string{"asInvoker", "highestAvailable", "requireAdministrator"}
+
+var executionLevelRegExp = regexp.MustCompile(`(<(?:\w+:)?requestedExecutionLevel\b[^>]*?\blevel\s*=\s*)["'][^"']*["']`)
+
+const trustInfoTemplate = `  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="%s" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+`
+
+const manifestTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+%s</assembly>
+`
+
+func validateExecutionLevel(level string) error {
+	for _, name := range executionLevels {
+		if name == level {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid requested execution level %q (asInvoker, highestAvailable or requireAdministrator expected)", level)
+}
+
+// setExecutionLevel updates requestedExecutionLevel of manifest (trustInfo is added if not present, new manifest is created if manifest is nil)
+func setExecutionLevel(manifest []byte, level string) ([]byte, error) {
+	trustInfo := fmt.Sprintf(trustInfoTemplate, level)
+	if len(bytes.TrimSpace(manifest)) == 0 {
+		return []byte(fmt.Sprintf(manifestTemplate, trustInfo)), nil
+	}
+
+	if executionLevelRegExp.Match(manifest) {
+		return executionLevelRegExp.ReplaceAll(manifest, []byte(`${1}"`+level+`"`)), nil
+	}
+
+	end := bytes.LastIndex(manifest, []byte("</assembly>"))
+	if end < 0 {
+		return nil, errors.New("cannot set requested execution level: </assembly> is not found in manifest")
+	}
+
+	result := make([]byte, 0, len(manifest)+len(trustInfo))
+	result = append(result, manifest[:end]...)
+	result = append(result, trustInfo...)
+	return append(result, manifest[end:]...), nil
+}
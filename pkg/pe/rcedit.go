@@ -0,0 +1,209 @@
+package pe
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/errors"
+)
+
+type EditOptions struct {
+	// ICO file, image of other format is converted to ICO
+	Icon string
+	// StringFileInfo values (e.g. ProductName, FileDescription, CompanyName, LegalCopyright)
+	VersionStrings map[string]string
+	// 1.2.3 or 1.2.3.4, FileVersion string is also set if not specified explicitly
+	FileVersion    string
+	ProductVersion string
+
+	// asInvoker, highestAvailable or requireAdministrator
+	RequestedExecutionLevel string
+	// manifest file to embed (replaces existing one)
+	Manifest string
+	// JSON of asar header hashes, embedded as INTEGRITY/ELECTRONASAR resource (checked by Electron if asar integrity fuse is enabled)
+	AsarIntegrity []byte
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("rcedit", "Set icon, version info and manifest of Windows executable.")
+	input := command.Flag("input", "").Short('i').Required().String()
+	output := command.Flag("output", "The output file (default: input is modified in place).").Short('o').String()
+
+	options := EditOptions{VersionStrings: make(map[string]string)}
+	command.Flag("icon", "").StringVar(&options.Icon)
+	command.Flag("set-version-string", "Key=Value").StringMapVar(&options.VersionStrings)
+	command.Flag("file-version", "").StringVar(&options.FileVersion)
+	command.Flag("product-version", "").StringVar(&options.ProductVersion)
+	command.Flag("requested-execution-level", "").EnumVar(&options.RequestedExecutionLevel, executionLevels...)
+	command.Flag("manifest", "").StringVar(&options.Manifest)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		outputFile := *output
+		if len(outputFile) == 0 {
+			outputFile = *input
+		}
+		return EditFile(*input, outputFile, &options)
+	})
+}
+
+// EditFile patches resources of executable, output file is written atomically (so, can be the same as input)
+func EditFile(input string, output string, options *EditOptions) error {
+	data, err := ioutil.ReadFile(input)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	result, err := Edit(data, options)
+	if err != nil {
+		return errors.Wrapf(err, "cannot edit %s", input)
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.WriteFileAtomic(output, result, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"file": output, "size": len(result)}).Debug("resources updated")
+	return nil
+}
+
+// Edit returns executable data with updated resources
+func Edit(data []byte, options *EditOptions) ([]byte, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := file.ReadResources()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.Icon) != 0 {
+		icoData, err := readIcon(options.Icon)
+		if err != nil {
+			return nil, err
+		}
+		err = SetIcon(resources, icoData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot set icon %s", options.Icon)
+		}
+	}
+
+	if len(options.VersionStrings) != 0 || len(options.FileVersion) != 0 || len(options.ProductVersion) != 0 {
+		err = editVersionInfo(resources, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = editManifest(resources, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(options.AsarIntegrity) != 0 {
+		resources.SetCustom(asarIntegrityType, asarIntegrityName, defaultLanguage, options.AsarIntegrity)
+	}
+
+	return file.ReplaceResources(resources.Serialize)
+}
+
+func editVersionInfo(resources *ResourceDirectory, options *EditOptions) error {
+	name, language, data, exists := resources.First(TypeVersion)
+	var versionInfo *versionNode
+	if exists {
+		var err error
+		versionInfo, err = parseVersionInfo(data)
+		if err != nil {
+			return err
+		}
+	} else {
+		name = IntResource(1)
+		language = defaultLanguage
+		versionInfo = newVersionInfo()
+	}
+
+	// sorted to produce the same result for the same options
+	keys := make([]string, 0, len(options.VersionStrings))
+	for key := range options.VersionStrings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		versionInfo.setString(key, options.VersionStrings[key])
+	}
+
+	versions := []struct {
+		value  string
+		key    string
+		offset int
+	}{
+		{options.FileVersion, "FileVersion", 8},
+		{options.ProductVersion, "ProductVersion", 16},
+	}
+	for _, version := range versions {
+		if len(version.value) == 0 {
+			continue
+		}
+
+		parsed, err := ParseVersion(version.value)
+		if err != nil {
+			return err
+		}
+		err = versionInfo.setFixedVersion(version.offset, parsed)
+		if err != nil {
+			return err
+		}
+		if _, ok := options.VersionStrings[version.key]; !ok {
+			versionInfo.setString(version.key, version.value)
+		}
+	}
+
+	resources.Set(TypeVersion, name, language, versionInfo.serialize())
+	return nil
+}
+
+func editManifest(resources *ResourceDirectory, options *EditOptions) error {
+	if len(options.Manifest) == 0 && len(options.RequestedExecutionLevel) == 0 {
+		return nil
+	}
+
+	name, language, manifest, exists := resources.First(TypeManifest)
+	if !exists {
+		// CREATEPROCESS_MANIFEST_RESOURCE_ID
+		name = IntResource(1)
+		language = defaultLanguage
+	}
+
+	if len(options.Manifest) != 0 {
+		var err error
+		manifest, err = ioutil.ReadFile(options.Manifest)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(options.RequestedExecutionLevel) != 0 {
+		err := validateExecutionLevel(options.RequestedExecutionLevel)
+		if err != nil {
+			return err
+		}
+		manifest, err = setExecutionLevel(manifest, options.RequestedExecutionLevel)
+		if err != nil {
+			return err
+		}
+	}
+
+	resources.Set(TypeManifest, name, language, manifest)
+	return nil
+}
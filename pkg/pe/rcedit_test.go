@@ -0,0 +1,306 @@
+package pe
+
+import (
+	"bytes"
+	debugPe "debug/pe"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testManifest = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+</assembly>
+`
+
+var testOverlay = []byte("installer payload")
+
+// minimal PE32+ image: section data is placed sequentially, resource directory points to .rsrc, base relocation directory to .reloc
+func createTestExecutable(resources *ResourceDirectory, sections []string) []byte {
+	const sectionAlignment = 0x1000
+	const fileAlignment = 0x200
+	const optionalHeaderSize = 112 + 16*8
+
+	data := make([]byte, 0x200)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3c:], 0x40)
+	copy(data[0x40:], "PE\x00\x00")
+	// AMD64
+	binary.LittleEndian.PutUint16(data[0x44:], 0x8664)
+	binary.LittleEndian.PutUint16(data[0x46:], uint16(len(sections)))
+	binary.LittleEndian.PutUint16(data[0x44+16:], optionalHeaderSize)
+	binary.LittleEndian.PutUint16(data[0x44+18:], 0x22)
+
+	optionalHeader := data[0x58:]
+	binary.LittleEndian.PutUint16(optionalHeader, 0x20b)
+	binary.LittleEndian.PutUint32(optionalHeader[16:], 0x1000)
+	binary.LittleEndian.PutUint64(optionalHeader[24:], 0x140000000)
+	binary.LittleEndian.PutUint32(optionalHeader[32:], sectionAlignment)
+	binary.LittleEndian.PutUint32(optionalHeader[36:], fileAlignment)
+	binary.LittleEndian.PutUint16(optionalHeader[48:], 6)
+	binary.LittleEndian.PutUint32(optionalHeader[60:], 0x200)
+	// IMAGE_SUBSYSTEM_WINDOWS_GUI
+	binary.LittleEndian.PutUint16(optionalHeader[68:], 2)
+	binary.LittleEndian.PutUint32(optionalHeader[108:], 16)
+
+	rva := uint32(sectionAlignment)
+	for index, name := range sections {
+		// data is reallocated by append
+		optionalHeader = data[0x58:]
+		var sectionData []byte
+		switch name {
+		case ".rsrc":
+			sectionData = resources.Serialize(rva)
+			binary.LittleEndian.PutUint32(optionalHeader[112+dirResource*8:], rva)
+			binary.LittleEndian.PutUint32(optionalHeader[112+dirResource*8+4:], uint32(len(sectionData)))
+		case ".reloc":
+			// one block with two entries (IMAGE_REL_BASED_DIR64 at 0x10, padding)
+			sectionData = []byte{0x00, 0x10, 0, 0, 12, 0, 0, 0, 0x10, 0xa0, 0, 0}
+			binary.LittleEndian.PutUint32(optionalHeader[112+dirBaseReloc*8:], rva)
+			binary.LittleEndian.PutUint32(optionalHeader[112+dirBaseReloc*8+4:], uint32(len(sectionData)))
+		default:
+			sectionData = bytes.Repeat([]byte{0xc3}, 16)
+		}
+
+		header := data[0x58+optionalHeaderSize+index*sectionHeaderSize:]
+		copy(header, name)
+		binary.LittleEndian.PutUint32(header[8:], uint32(len(sectionData)))
+		binary.LittleEndian.PutUint32(header[12:], rva)
+		binary.LittleEndian.PutUint32(header[16:], align(uint32(len(sectionData)), fileAlignment))
+		binary.LittleEndian.PutUint32(header[20:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(header[36:], resourceSectionCharacteristics)
+
+		data = appendPadded(data, uint32(len(data)), sectionData, align(uint32(len(sectionData)), fileAlignment))
+		rva = align(rva+uint32(len(sectionData)), sectionAlignment)
+	}
+	binary.LittleEndian.PutUint32(data[0x58+56:], rva)
+	return append(data, testOverlay...)
+}
+
+func createTestResources() *ResourceDirectory {
+	resources := &ResourceDirectory{}
+	resources.Set(TypeManifest, IntResource(1), defaultLanguage, []byte(testManifest))
+	// named type and name must be preserved
+	resources.getOrCreateDirectory(ResourceId{Name: "CUSTOM"}).getOrCreateDirectory(ResourceId{Name: "Data"}).Entries = []*ResourceEntry{{Id: IntResource(0), Data: []byte("custom data")}}
+	return resources
+}
+
+func getTestDataPath(t *testing.T) string {
+	testData, err := filepath.Abs(filepath.Join("..", "..", "testData"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testData
+}
+
+func readTestResources(g *GomegaWithT, data []byte) *ResourceDirectory {
+	file, err := Parse(data)
+	g.Expect(err).NotTo(HaveOccurred())
+	resources, err := file.ReadResources()
+	g.Expect(err).NotTo(HaveOccurred())
+	return resources
+}
+
+func TestEditInPlace(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	icoFile := filepath.Join(getTestDataPath(t), "icon.ico")
+	input := createTestExecutable(createTestResources(), []string{".text", ".rsrc", ".reloc"})
+	result, err := Edit(input, &EditOptions{
+		Icon:                    icoFile,
+		VersionStrings:          map[string]string{"ProductName": "Test App", "LegalCopyright": "Copyright © 2019 Foo"},
+		FileVersion:             "1.2.3",
+		ProductVersion:          "1.2.3-beta.1",
+		RequestedExecutionLevel: "requireAdministrator",
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// valid for the standard parser
+	peFile, err := debugPe.NewFile(bytes.NewReader(result))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(peFile.Sections).To(HaveLen(3))
+	g.Expect(peFile.Sections[1].Name).To(Equal(".rsrc"))
+	reloc := peFile.Section(".reloc")
+	g.Expect(reloc.VirtualAddress).To(BeNumerically(">", peFile.Sections[1].VirtualAddress+peFile.Sections[1].VirtualSize))
+	relocData, err := reloc.Data()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(relocData[:12]).To(Equal([]byte{0x00, 0x10, 0, 0, 12, 0, 0, 0, 0x10, 0xa0, 0, 0}))
+
+	optionalHeader := peFile.OptionalHeader.(*debugPe.OptionalHeader64)
+	g.Expect(optionalHeader.DataDirectory[dirBaseReloc].VirtualAddress).To(Equal(reloc.VirtualAddress))
+	g.Expect(optionalHeader.SizeOfImage).To(Equal(align(reloc.VirtualAddress+reloc.VirtualSize, 0x1000)))
+	g.Expect(optionalHeader.CheckSum).To(Equal(computeChecksum(result, 0x58+64)))
+	g.Expect(bytes.HasSuffix(result, testOverlay)).To(BeTrue())
+
+	resources := readTestResources(g, result)
+
+	icoData, err := ioutil.ReadFile(icoFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	images, err := parseIco(icoData)
+	g.Expect(err).NotTo(HaveOccurred())
+	groupName, language, groupData, ok := resources.First(TypeGroupIcon)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(groupName).To(Equal(IntResource(1)))
+	g.Expect(language).To(Equal(uint16(defaultLanguage)))
+	ids := getGroupIconIds(groupData)
+	g.Expect(ids).To(HaveLen(len(images)))
+	for index, id := range ids {
+		entry := resources.Type(TypeIcon).Find(IntResource(id))
+		g.Expect(entry).NotTo(BeNil())
+		g.Expect(entry.Directory.Entries[0].Data).To(Equal(images[index].data))
+	}
+
+	_, _, versionData, ok := resources.First(TypeVersion)
+	g.Expect(ok).To(BeTrue())
+	versionInfo, err := parseVersionInfo(versionData)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versionInfo.getString("ProductName")).To(Equal("Test App"))
+	g.Expect(versionInfo.getString("LegalCopyright")).To(Equal("Copyright © 2019 Foo"))
+	g.Expect(versionInfo.getString("FileVersion")).To(Equal("1.2.3"))
+	g.Expect(versionInfo.getString("ProductVersion")).To(Equal("1.2.3-beta.1"))
+	g.Expect(binary.LittleEndian.Uint32(versionInfo.Value[8:])).To(Equal(uint32(1<<16 | 2)))
+	g.Expect(binary.LittleEndian.Uint32(versionInfo.Value[12:])).To(Equal(uint32(3 << 16)))
+	g.Expect(versionInfo.child("VarFileInfo")).NotTo(BeNil())
+
+	_, _, manifest, ok := resources.First(TypeManifest)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(string(manifest)).To(ContainSubstring(`<requestedExecutionLevel level="requireAdministrator" uiAccess="false"/>`))
+	g.Expect(string(manifest)).NotTo(ContainSubstring("asInvoker"))
+
+	custom := resources.Find(ResourceId{Name: "CUSTOM"})
+	g.Expect(custom).NotTo(BeNil())
+	g.Expect(custom.Directory.Find(ResourceId{Name: "Data"}).Directory.Entries[0].Data).To(Equal([]byte("custom data")))
+
+	// second edit replaces icon group and updates existing version info
+	result, err = Edit(result, &EditOptions{Icon: icoFile, VersionStrings: map[string]string{"ProductName": "Renamed"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	resources = readTestResources(g, result)
+	g.Expect(resources.Type(TypeIcon).Entries).To(HaveLen(len(images)))
+	g.Expect(resources.Type(TypeGroupIcon).Entries).To(HaveLen(1))
+	_, _, versionData, _ = resources.First(TypeVersion)
+	versionInfo, err = parseVersionInfo(versionData)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versionInfo.getString("ProductName")).To(Equal("Renamed"))
+	g.Expect(versionInfo.getString("LegalCopyright")).To(Equal("Copyright © 2019 Foo"))
+}
+
+func TestEditAppendsResourceSection(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	// .data after .rsrc cannot be moved
+	input := createTestExecutable(createTestResources(), []string{".text", ".rsrc", ".data"})
+	result, err := Edit(input, &EditOptions{FileVersion: "2.0.0"})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	peFile, err := debugPe.NewFile(bytes.NewReader(result))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(peFile.Sections).To(HaveLen(4))
+	g.Expect(peFile.Sections[1].Name).To(Equal(".oldrsrc"))
+	g.Expect(peFile.Sections[3].Name).To(Equal(".rsrc"))
+	g.Expect(peFile.OptionalHeader.(*debugPe.OptionalHeader64).DataDirectory[dirResource].VirtualAddress).To(Equal(peFile.Sections[3].VirtualAddress))
+	g.Expect(bytes.HasSuffix(result, testOverlay)).To(BeTrue())
+
+	resources := readTestResources(g, result)
+	_, _, manifest, ok := resources.First(TypeManifest)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(string(manifest)).To(Equal(testManifest))
+	_, _, versionData, ok := resources.First(TypeVersion)
+	g.Expect(ok).To(BeTrue())
+	versionInfo, err := parseVersionInfo(versionData)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versionInfo.getString("FileVersion")).To(Equal("2.0.0"))
+}
+
+func TestEditWithoutResources(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	input := createTestExecutable(nil, []string{".text"})
+	result, err := Edit(input, &EditOptions{RequestedExecutionLevel: "highestAvailable"})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	peFile, err := debugPe.NewFile(bytes.NewReader(result))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(peFile.Sections).To(HaveLen(2))
+
+	_, _, manifest, ok := readTestResources(g, result).First(TypeManifest)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(string(manifest)).To(ContainSubstring(`level="highestAvailable"`))
+	g.Expect(string(manifest)).To(HaveSuffix("</assembly>\n"))
+}
+
+func TestEditFile(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "rcedit-test")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "app.exe")
+	g.Expect(ioutil.WriteFile(file, createTestExecutable(createTestResources(), []string{".text", ".rsrc", ".reloc"}), 0755)).To(Succeed())
+
+	// not ICO icon is converted
+	err = EditFile(file, file, &EditOptions{Icon: filepath.Join(getTestDataPath(t), "512x512.png")})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, _, groupData, ok := readTestResources(g, data).First(TypeGroupIcon)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(len(getGroupIconIds(groupData))).To(BeNumerically(">", 1))
+
+	files, err := ioutil.ReadDir(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(HaveLen(1))
+}
+
+func TestEditAsarIntegrity(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	integrity := []byte(`[{"file":"resources\\app.asar","alg":"sha256","value":"abc"}]`)
+	input := createTestExecutable(createTestResources(), []string{".text", ".rsrc", ".reloc"})
+	result, err := Edit(input, &EditOptions{AsarIntegrity: integrity})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	resources := readTestResources(g, result)
+	names := resources.Find(asarIntegrityType)
+	g.Expect(names).NotTo(BeNil())
+	g.Expect(names.Directory.Find(asarIntegrityName).Directory.Find(IntResource(defaultLanguage)).Data).To(Equal(integrity))
+	_, _, manifest, _ := resources.First(TypeManifest)
+	g.Expect(string(manifest)).To(Equal(testManifest))
+}
+
+func TestSetExecutionLevel(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	result, err := setExecutionLevel([]byte(`<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0"></assembly>`), "asInvoker")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(result)).To(ContainSubstring(`<requestedExecutionLevel level="asInvoker" uiAccess="false"/>`))
+
+	_, err = setExecutionLevel([]byte("<broken"), "asInvoker")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(validateExecutionLevel("root")).To(HaveOccurred())
+}
+
+func TestParseVersion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	version, err := ParseVersion("v1.2.3-beta.1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version).To(Equal([4]uint16{1, 2, 3, 0}))
+
+	_, err = ParseVersion("1.2.3.4.5")
+	g.Expect(err).To(HaveOccurred())
+	_, err = ParseVersion("1.x")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,377 @@
+package pe
+
+import (
+	"encoding/binary"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/develar/errors"
+)
+
+// resource types (RT_ICON, RT_GROUP_ICON, RT_VERSION, RT_MANIFEST)
+const (
+	TypeIcon      = 3
+	TypeGroupIcon = 14
+	TypeVersion   = 16
+	TypeManifest  = 24
+)
+
+// en-US
+const defaultLanguage = 1033
+
+// resource read by Electron to validate asar archives
+var (
+	asarIntegrityType = ResourceId{Name: "INTEGRITY"}
+	asarIntegrityName = ResourceId{Name: "ELECTRONASAR"}
+)
+
+// ResourceId is either a name or an integer id (if name is empty)
+type ResourceId struct {
+	Name string
+	Id   uint16
+}
+
+func IntResource(id uint16) ResourceId {
+	return ResourceId{Id: id}
+}
+
+func (t ResourceId) IsName() bool {
+	return len(t.Name) != 0
+}
+
+// ResourceDirectory is a level of resource tree: type - name - language - data
+type ResourceDirectory struct {
+	Entries []*ResourceEntry
+}
+
+type ResourceEntry struct {
+	Id ResourceId
+	// either Directory or Data is set
+	Directory *ResourceDirectory
+	Data      []byte
+	CodePage  uint32
+}
+
+func (t *ResourceDirectory) Find(id ResourceId) *ResourceEntry {
+	for _, entry := range t.Entries {
+		if entry.Id == id {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (t *ResourceDirectory) Remove(id ResourceId) {
+	for index, entry := range t.Entries {
+		if entry.Id == id {
+			t.Entries = append(t.Entries[:index], t.Entries[index+1:]...)
+			return
+		}
+	}
+}
+
+func (t *ResourceDirectory) getOrCreateDirectory(id ResourceId) *ResourceDirectory {
+	entry := t.Find(id)
+	if entry == nil {
+		entry = &ResourceEntry{Id: id, Directory: &ResourceDirectory{}}
+		t.Entries = append(t.Entries, entry)
+	}
+	return entry.Directory
+}
+
+// Type returns directory of resources of the specified type (nil if there are no such resources)
+func (t *ResourceDirectory) Type(resourceType uint16) *ResourceDirectory {
+	entry := t.Find(IntResource(resourceType))
+	if entry == nil {
+		return nil
+	}
+	return entry.Directory
+}
+
+// Set adds or replaces resource data
+func (t *ResourceDirectory) Set(resourceType uint16, name ResourceId, language uint16, data []byte) {
+	t.SetCustom(IntResource(resourceType), name, language, data)
+}
+
+// SetCustom is the same as Set, but type can be named (e.g. INTEGRITY)
+func (t *ResourceDirectory) SetCustom(resourceType ResourceId, name ResourceId, language uint16, data []byte) {
+	languages := t.getOrCreateDirectory(resourceType).getOrCreateDirectory(name)
+	entry := languages.Find(IntResource(language))
+	if entry == nil {
+		languages.Entries = append(languages.Entries, &ResourceEntry{Id: IntResource(language), Data: data})
+	} else {
+		entry.Data = data
+	}
+}
+
+// First returns the first resource of the specified type (as Windows does, e.g. the first icon group is used as the application icon)
+func (t *ResourceDirectory) First(resourceType uint16) (name ResourceId, language uint16, data []byte, ok bool) {
+	names := t.Type(resourceType)
+	if names == nil {
+		return
+	}
+
+	for _, nameEntry := range names.sortedEntries() {
+		if nameEntry.Directory == nil {
+			continue
+		}
+		for _, languageEntry := range nameEntry.Directory.sortedEntries() {
+			if languageEntry.Directory == nil {
+				return nameEntry.Id, languageEntry.Id.Id, languageEntry.Data, true
+			}
+		}
+	}
+	return
+}
+
+// named entries are sorted (case-insensitive) before id entries, ids are sorted ascending
+func (t *ResourceDirectory) sortedEntries() []*ResourceEntry {
+	result := make([]*ResourceEntry, len(t.Entries))
+	copy(result, t.Entries)
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i].Id, result[j].Id
+		if a.IsName() != b.IsName() {
+			return a.IsName()
+		}
+		if a.IsName() {
+			return strings.ToUpper(a.Name) < strings.ToUpper(b.Name)
+		}
+		return a.Id < b.Id
+	})
+	return result
+}
+
+// ReadResources parses resource section (empty directory is returned if file doesn't have resources)
+func (t *File) ReadResources() (*ResourceDirectory, error) {
+	directory := t.DataDirectory(dirResource)
+	if directory.VirtualAddress == 0 || directory.Size == 0 {
+		return &ResourceDirectory{}, nil
+	}
+
+	section := t.sectionByRva(directory.VirtualAddress)
+	if section == nil {
+		return nil, errors.Errorf("resource directory rva %#x is not in any section", directory.VirtualAddress)
+	}
+
+	// offsets in resource tree are relative to the resource directory
+	data, err := t.ReadRva(directory.VirtualAddress, section.VirtualAddress+section.SizeOfRawData-directory.VirtualAddress)
+	if err != nil {
+		return nil, err
+	}
+	reader := &resourceReader{file: t, data: data}
+	return reader.readDirectory(0, 0)
+}
+
+type resourceReader struct {
+	file *File
+	data []byte
+}
+
+func (t *resourceReader) check(offset uint32, size uint32) error {
+	if uint64(offset)+uint64(size) > uint64(len(t.data)) {
+		return errors.Errorf("resource data at offset %#x is out of section", offset)
+	}
+	return nil
+}
+
+func (t *resourceReader) readDirectory(offset uint32, level int) (*ResourceDirectory, error) {
+	// type, name and language, deeper levels are not used by Windows
+	if level > 2 {
+		return nil, errors.New("resource tree is too deep")
+	}
+	err := t.check(offset, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	count := uint32(binary.LittleEndian.Uint16(t.data[offset+12:])) + uint32(binary.LittleEndian.Uint16(t.data[offset+14:]))
+	err = t.check(offset+16, count*8)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ResourceDirectory{}
+	for index := uint32(0); index < count; index++ {
+		entryOffset := offset + 16 + index*8
+		nameField := binary.LittleEndian.Uint32(t.data[entryOffset:])
+		dataField := binary.LittleEndian.Uint32(t.data[entryOffset+4:])
+
+		entry := &ResourceEntry{}
+		if nameField&0x80000000 != 0 {
+			entry.Id.Name, err = t.readName(nameField & 0x7fffffff)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			entry.Id.Id = uint16(nameField)
+		}
+
+		if dataField&0x80000000 != 0 {
+			entry.Directory, err = t.readDirectory(dataField&0x7fffffff, level+1)
+		} else {
+			err = t.readData(dataField, entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result, nil
+}
+
+func (t *resourceReader) readName(offset uint32) (string, error) {
+	err := t.check(offset, 2)
+	if err != nil {
+		return "", err
+	}
+
+	length := uint32(binary.LittleEndian.Uint16(t.data[offset:]))
+	err = t.check(offset+2, length*2)
+	if err != nil {
+		return "", err
+	}
+	return decodeUtf16(t.data[offset+2 : offset+2+length*2]), nil
+}
+
+func (t *resourceReader) readData(offset uint32, entry *ResourceEntry) error {
+	err := t.check(offset, 16)
+	if err != nil {
+		return err
+	}
+
+	rva := binary.LittleEndian.Uint32(t.data[offset:])
+	size := binary.LittleEndian.Uint32(t.data[offset+4:])
+	entry.CodePage = binary.LittleEndian.Uint32(t.data[offset+8:])
+	// data is usually in the resource section, but it is not required
+	data, err := t.file.ReadRva(rva, size)
+	if err != nil {
+		return errors.Wrapf(err, "cannot read resource %v", entry.Id)
+	}
+	// copy, because file data will be replaced
+	entry.Data = append([]byte(nil), data...)
+	return nil
+}
+
+// Serialize writes resource tree as resource section data located at the specified rva:
+// all directory tables (breadth-first), then names, then data entries, then data
+func (t *ResourceDirectory) Serialize(rva uint32) []byte {
+	var directories []*ResourceDirectory
+	var dataEntries []*ResourceEntry
+	var names []string
+	directoryOffsets := make(map[*ResourceDirectory]uint32)
+	dataEntryOffsets := make(map[*ResourceEntry]uint32)
+	nameOffsets := make(map[string]uint32)
+
+	tableSize := uint32(0)
+	queue := []*ResourceDirectory{t}
+	for len(queue) != 0 {
+		directory := queue[0]
+		queue = queue[1:]
+
+		directoryOffsets[directory] = tableSize
+		tableSize += 16 + uint32(len(directory.Entries))*8
+		directories = append(directories, directory)
+
+		for _, entry := range directory.sortedEntries() {
+			if entry.IsName() {
+				if _, ok := nameOffsets[entry.Id.Name]; !ok {
+					nameOffsets[entry.Id.Name] = 0
+					names = append(names, entry.Id.Name)
+				}
+			}
+			if entry.Directory != nil {
+				queue = append(queue, entry.Directory)
+			} else {
+				dataEntries = append(dataEntries, entry)
+			}
+		}
+	}
+
+	offset := tableSize
+	for _, name := range names {
+		nameOffsets[name] = offset
+		offset += 2 + uint32(len(utf16.Encode([]rune(name))))*2
+	}
+	offset = align(offset, 4)
+	for _, entry := range dataEntries {
+		dataEntryOffsets[entry] = offset
+		offset += 16
+	}
+
+	dataOffsets := make([]uint32, len(dataEntries))
+	for index, entry := range dataEntries {
+		offset = align(offset, 8)
+		dataOffsets[index] = offset
+		offset += uint32(len(entry.Data))
+	}
+
+	result := make([]byte, align(offset, 4))
+	for _, directory := range directories {
+		directoryOffset := directoryOffsets[directory]
+		// characteristics, time stamp and version are zero
+		entries := directory.sortedEntries()
+		var namedCount uint16
+		for _, entry := range entries {
+			if entry.IsName() {
+				namedCount++
+			}
+		}
+		binary.LittleEndian.PutUint16(result[directoryOffset+12:], namedCount)
+		binary.LittleEndian.PutUint16(result[directoryOffset+14:], uint16(len(entries))-namedCount)
+
+		for index, entry := range entries {
+			entryOffset := directoryOffset + 16 + uint32(index)*8
+			if entry.IsName() {
+				binary.LittleEndian.PutUint32(result[entryOffset:], 0x80000000|nameOffsets[entry.Id.Name])
+			} else {
+				binary.LittleEndian.PutUint32(result[entryOffset:], uint32(entry.Id.Id))
+			}
+
+			if entry.Directory != nil {
+				binary.LittleEndian.PutUint32(result[entryOffset+4:], 0x80000000|directoryOffsets[entry.Directory])
+			} else {
+				binary.LittleEndian.PutUint32(result[entryOffset+4:], dataEntryOffsets[entry])
+			}
+		}
+	}
+
+	for _, name := range names {
+		encoded := utf16.Encode([]rune(name))
+		nameOffset := nameOffsets[name]
+		binary.LittleEndian.PutUint16(result[nameOffset:], uint16(len(encoded)))
+		for index, c := range encoded {
+			binary.LittleEndian.PutUint16(result[nameOffset+2+uint32(index)*2:], c)
+		}
+	}
+
+	for index, entry := range dataEntries {
+		entryOffset := dataEntryOffsets[entry]
+		binary.LittleEndian.PutUint32(result[entryOffset:], rva+dataOffsets[index])
+		binary.LittleEndian.PutUint32(result[entryOffset+4:], uint32(len(entry.Data)))
+		binary.LittleEndian.PutUint32(result[entryOffset+8:], entry.CodePage)
+		copy(result[dataOffsets[index]:], entry.Data)
+	}
+	return result
+}
+
+func (t *ResourceEntry) IsName() bool {
+	return t.Id.IsName()
+}
+
+func decodeUtf16(data []byte) string {
+	chars := make([]uint16, len(data)/2)
+	for index := range chars {
+		chars[index] = binary.LittleEndian.Uint16(data[index*2:])
+	}
+	return string(utf16.Decode(chars))
+}
+
+func encodeUtf16(value string) []byte {
+	chars := utf16.Encode([]rune(value))
+	result := make([]byte, len(chars)*2)
+	for index, c := range chars {
+		binary.LittleEndian.PutUint16(result[index*2:], c)
+	}
+	return result
+}
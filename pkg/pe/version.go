@@ -0,0 +1,235 @@
+package pe
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/develar/errors"
+)
+
+const fixedFileInfoSignature = 0xfeef04bd
+
+// versionNode is a VS_VERSIONINFO block (VS_VERSIONINFO, StringFileInfo, StringTable, String, VarFileInfo, Var)
+type versionNode struct {
+	Key string
+	// text (1) or binary (0)
+	IsText bool
+	Value  []byte
+
+	Children []*versionNode
+}
+
+func parseVersionInfo(data []byte) (*versionNode, error) {
+	node, _, err := parseVersionNode(data, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse version info")
+	}
+	if node.Key != "VS_VERSION_INFO" {
+		return nil, errors.Errorf("cannot parse version info: unexpected key %q", node.Key)
+	}
+	return node, nil
+}
+
+func parseVersionNode(data []byte, offset int) (*versionNode, int, error) {
+	if offset+6 > len(data) {
+		return nil, 0, errors.New("node header is out of data")
+	}
+
+	length := int(binary.LittleEndian.Uint16(data[offset:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[offset+2:]))
+	end := offset + length
+	if length < 6 || end > len(data) {
+		return nil, 0, errors.Errorf("invalid node length %d at %d", length, offset)
+	}
+
+	node := &versionNode{IsText: binary.LittleEndian.Uint16(data[offset+4:]) == 1}
+	position := offset + 6
+	keyEnd := position
+	for keyEnd+1 < end && binary.LittleEndian.Uint16(data[keyEnd:]) != 0 {
+		keyEnd += 2
+	}
+	node.Key = decodeUtf16(data[position:keyEnd])
+	position = alignInt(keyEnd+2, 4)
+
+	if valueLength != 0 && position < end {
+		valueSize := valueLength
+		if node.IsText {
+			// length in words
+			valueSize *= 2
+		}
+		if position+valueSize > end {
+			// some compilers write length of text value in bytes
+			valueSize = end - position
+		}
+		node.Value = data[position : position+valueSize]
+		if node.IsText {
+			node.Value = trimUtf16Null(node.Value)
+		}
+		position = alignInt(position+valueSize, 4)
+	}
+
+	for position < end {
+		child, childEnd, err := parseVersionNode(data, position)
+		if err != nil {
+			return nil, 0, err
+		}
+		node.Children = append(node.Children, child)
+		position = alignInt(childEnd, 4)
+	}
+	return node, end, nil
+}
+
+func trimUtf16Null(value []byte) []byte {
+	for index := 0; index+1 < len(value); index += 2 {
+		if value[index] == 0 && value[index+1] == 0 {
+			return value[:index]
+		}
+	}
+	return value
+}
+
+func (t *versionNode) serialize() []byte {
+	result := make([]byte, 6)
+	var valueLength int
+	if t.IsText {
+		binary.LittleEndian.PutUint16(result[4:], 1)
+	}
+
+	result = append(result, encodeUtf16(t.Key)...)
+	result = append(result, 0, 0)
+	result = padTo4(result)
+
+	if t.IsText {
+		if len(t.Value) != 0 {
+			result = append(result, t.Value...)
+			result = append(result, 0, 0)
+			// length in words including terminating null
+			valueLength = len(t.Value)/2 + 1
+		}
+	} else {
+		result = append(result, t.Value...)
+		valueLength = len(t.Value)
+	}
+
+	for _, child := range t.Children {
+		result = padTo4(result)
+		result = append(result, child.serialize()...)
+	}
+
+	binary.LittleEndian.PutUint16(result[0:], uint16(len(result)))
+	binary.LittleEndian.PutUint16(result[2:], uint16(valueLength))
+	return result
+}
+
+func (t *versionNode) child(key string) *versionNode {
+	for _, child := range t.Children {
+		if child.Key == key {
+			return child
+		}
+	}
+	return nil
+}
+
+// setString sets value in all string tables (one per language and code page)
+func (t *versionNode) setString(key string, value string) {
+	stringFileInfo := t.child("StringFileInfo")
+	if stringFileInfo == nil {
+		stringFileInfo = &versionNode{Key: "StringFileInfo", IsText: true}
+		t.Children = append([]*versionNode{stringFileInfo}, t.Children...)
+	}
+	if len(stringFileInfo.Children) == 0 {
+		// en-US, Unicode
+		stringFileInfo.Children = append(stringFileInfo.Children, &versionNode{Key: "040904B0", IsText: true})
+	}
+
+	for _, table := range stringFileInfo.Children {
+		node := table.child(key)
+		if node == nil {
+			node = &versionNode{Key: key, IsText: true}
+			table.Children = append(table.Children, node)
+		}
+		node.Value = encodeUtf16(value)
+	}
+}
+
+func (t *versionNode) getString(key string) string {
+	stringFileInfo := t.child("StringFileInfo")
+	if stringFileInfo == nil {
+		return ""
+	}
+	for _, table := range stringFileInfo.Children {
+		if node := table.child(key); node != nil {
+			return decodeUtf16(node.Value)
+		}
+	}
+	return ""
+}
+
+// VS_FIXEDFILEINFO, offset of MS part of file version is 8, product version is 16
+func (t *versionNode) setFixedVersion(offset int, version [4]uint16) error {
+	if len(t.Value) < 52 || binary.LittleEndian.Uint32(t.Value) != fixedFileInfoSignature {
+		return errors.New("VS_FIXEDFILEINFO is missing")
+	}
+	binary.LittleEndian.PutUint32(t.Value[offset:], uint32(version[0])<<16|uint32(version[1]))
+	binary.LittleEndian.PutUint32(t.Value[offset+4:], uint32(version[2])<<16|uint32(version[3]))
+	return nil
+}
+
+func newVersionInfo() *versionNode {
+	fixedInfo := make([]byte, 52)
+	binary.LittleEndian.PutUint32(fixedInfo[0:], fixedFileInfoSignature)
+	// struct version 1.0
+	binary.LittleEndian.PutUint32(fixedInfo[4:], 0x10000)
+	// file flags mask
+	binary.LittleEndian.PutUint32(fixedInfo[24:], 0x3f)
+	// VOS_NT_WINDOWS32
+	binary.LittleEndian.PutUint32(fixedInfo[32:], 0x40004)
+	// VFT_APP
+	binary.LittleEndian.PutUint32(fixedInfo[36:], 1)
+
+	return &versionNode{
+		Key:   "VS_VERSION_INFO",
+		Value: fixedInfo,
+		Children: []*versionNode{
+			{Key: "StringFileInfo", IsText: true, Children: []*versionNode{{Key: "040904B0", IsText: true}}},
+			{Key: "VarFileInfo", IsText: true, Children: []*versionNode{
+				// en-US, Unicode
+				{Key: "Translation", Value: []byte{0x09, 0x04, 0xb0, 0x04}},
+			}},
+		},
+	}
+}
+
+// ParseVersion parses version as 4 numbers (1.2.3 is 1.2.3.0, prerelease suffix is ignored)
+func ParseVersion(version string) ([4]uint16, error) {
+	var result [4]uint16
+	normalized := strings.TrimPrefix(version, "v")
+	if index := strings.IndexAny(normalized, "-+"); index >= 0 {
+		normalized = normalized[:index]
+	}
+
+	parts := strings.Split(normalized, ".")
+	if len(parts) > 4 {
+		return result, errors.Errorf("invalid version %q (at most 4 numbers are allowed)", version)
+	}
+	for index, part := range parts {
+		value, err := strconv.ParseUint(part, 10, 16)
+		if err != nil {
+			return result, errors.Errorf("invalid version %q", version)
+		}
+		result[index] = uint16(value)
+	}
+	return result, nil
+}
+
+func alignInt(value int, alignment int) int {
+	return (value + alignment - 1) / alignment * alignment
+}
+
+func padTo4(data []byte) []byte {
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	return data
+}
@@ -0,0 +1,149 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("run", "Run plan of app-builder commands (icon conversion, copy, asar, sign, archive, publish) with declared dependencies in parallel")
+	planFile := command.Flag("plan", "plan file (JSON, JSON5, YAML or TOML)").Required().String()
+	parallelism := command.Flag("parallelism", "max number of nodes executed at once (default: parallelism of plan or number of CPUs)").Short('j').Int()
+	isKeepGoing := command.Flag("keep-going", "continue to start nodes that don't depend on failed one").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		plan, err := ReadPlan(*planFile)
+		if err != nil {
+			return err
+		}
+
+		baseDir, err := filepath.Abs(filepath.Dir(*planFile))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		ctx, cancel := util.CreateContext()
+		defer cancel()
+
+		runner := &Runner{
+			Parallelism: *parallelism,
+			KeepGoing:   *isKeepGoing,
+			BaseDir:     baseDir,
+		}
+		result, err := runner.Run(ctx, plan)
+		if err != nil {
+			return err
+		}
+
+		err = util.WriteJsonToStdOut(result)
+		if err != nil {
+			return err
+		}
+
+		failed := result.FailedNodes()
+		if len(failed) != 0 {
+			return util.NewMessageError(fmt.Sprintf("plan %s failed: %s", *planFile, strings.Join(failed, ", ")), "ERR_PLAN_FAILED")
+		}
+		return nil
+	})
+}
+
+// command flags are global state of kingpin, so, every node is executed by a child process.
+// Stdout of node is returned (commands write result as JSON), stderr (log) is inherited, progress events are forwarded.
+func executeNode(ctx context.Context, node *Node, baseDir string) ([]byte, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	command := exec.CommandContext(ctx, executable, append([]string{node.Command}, node.Args...)...)
+	command.Dir = baseDir
+	if len(node.Dir) != 0 {
+		command.Dir = filepath.Join(baseDir, node.Dir)
+		if filepath.IsAbs(node.Dir) {
+			command.Dir = node.Dir
+		}
+	}
+
+	command.Env = os.Environ()
+	for name, value := range node.Env {
+		command.Env = append(command.Env, name+"="+value)
+	}
+
+	// child joins trace and writes spans to temp file, spans are added to trace of this process (so, exported once)
+	traceFile := ""
+	if trace.IsEnabled() {
+		traceFile, err = util.DefaultTempDirManager.TempFile(".json")
+		if err != nil {
+			return nil, err
+		}
+		command.Env = append(command.Env, "TRACEPARENT="+trace.Traceparent(ctx), "APP_BUILDER_TRACE="+traceFile, "APP_BUILDER_TRACE_FORMAT=otlp", "OTEL_EXPORTER_OTLP_ENDPOINT=")
+	} else {
+		command.Env = append(command.Env, "APP_BUILDER_TRACE=", "OTEL_EXPORTER_OTLP_ENDPOINT=")
+	}
+
+	var stdout bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = os.Stderr
+
+	// fd of parent process is not inherited, child reports to pipe passed as the first extra file (fd 3, not supported on Windows)
+	var progressReader *os.File
+	if progress.IsEnabled() && runtime.GOOS != "windows" {
+		var progressWriter *os.File
+		progressReader, progressWriter, err = os.Pipe()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer util.Close(progressReader)
+		command.ExtraFiles = []*os.File{progressWriter}
+		command.Env = append(command.Env, "APP_BUILDER_PROGRESS_FD=3")
+		err = command.Start()
+		// child has own copy
+		util.Close(progressWriter)
+	} else {
+		command.Env = append(command.Env, "APP_BUILDER_PROGRESS_FD=0")
+		err = command.Start()
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if progressReader != nil {
+		scanner := bufio.NewScanner(progressReader)
+		for scanner.Scan() {
+			progress.WriteLine(scanner.Bytes())
+		}
+	}
+
+	err = command.Wait()
+	if len(traceFile) != 0 {
+		importTrace(traceFile)
+	}
+	if err != nil {
+		return stdout.Bytes(), errors.Wrapf(err, "%s %s", node.Command, strings.Join(node.Args, " "))
+	}
+	return stdout.Bytes(), nil
+}
+
+func importTrace(file string) {
+	spans, err := trace.ReadOtlpFile(file)
+	if err != nil {
+		log.WithError(err).Debug("cannot read trace of node")
+		return
+	}
+	trace.Import(spans)
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"strings"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// Plan is a graph of app-builder invocations, e.g.:
+//
+//	{
+//	  "parallelism": 4,
+//	  "nodes": [
+//	    {"id": "icon", "command": "icon", "args": ["--input", "build/icon.png", "--format", "icns", "--output", "out/stage/icon.icns"]},
+//	    {"id": "asar", "command": "asar-pack", "args": ["--input", "app", "--output", "out/stage/app.asar"]},
+//	    {"id": "zip", "command": "archive", "args": ["--input", "out/stage", "--output", "out/app.zip"], "dependsOn": ["icon", "asar"]}
+//	  ]
+//	}
+type Plan struct {
+	// 0 - number of CPUs, overridden by --parallelism
+	Parallelism int     `json:"parallelism"`
+	Nodes       []*Node `json:"nodes"`
+}
+
+type Node struct {
+	Id string `json:"id"`
+	// app-builder command (e.g. icon, copy, asar-pack, sign, archive, publish-s3)
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// working directory, relative to the dir of plan file
+	Dir string `json:"dir"`
+	// added to the environment of current process
+	Env       map[string]string `json:"env"`
+	DependsOn []string          `json:"dependsOn"`
+}
+
+// ReadPlan reads plan file (JSON, JSON5, YAML or TOML, see util.LoadConfig) and validates it
+func ReadPlan(file string) (*Plan, error) {
+	var plan Plan
+	err := util.LoadConfig(file, &plan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = plan.Validate()
+	if err != nil {
+		return nil, errors.WithMessage(err, "invalid plan "+file)
+	}
+	return &plan, nil
+}
+
+// Validate checks that node ids are unique, dependencies exist and there are no cycles
+func (t *Plan) Validate() error {
+	if len(t.Nodes) == 0 {
+		return errors.New("nodes are not specified")
+	}
+
+	nodes := make(map[string]*Node, len(t.Nodes))
+	for _, node := range t.Nodes {
+		if len(node.Id) == 0 {
+			return errors.New("node id is not specified")
+		}
+		if _, ok := nodes[node.Id]; ok {
+			return errors.Errorf("duplicated node id %q", node.Id)
+		}
+		if len(node.Command) == 0 {
+			return errors.Errorf("command of node %q is not specified", node.Id)
+		}
+		if node.Command == "run" {
+			return errors.Errorf("node %q: plan cannot run another plan", node.Id)
+		}
+		nodes[node.Id] = node
+	}
+
+	for _, node := range t.Nodes {
+		for _, dependency := range node.DependsOn {
+			if _, ok := nodes[dependency]; !ok {
+				return errors.Errorf("node %q depends on unknown node %q", node.Id, dependency)
+			}
+		}
+	}
+
+	// depth-first search, path is reported to simplify fixing of plan
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int, len(t.Nodes))
+	var path []string
+	var visit func(node *Node) error
+	visit = func(node *Node) error {
+		switch state[node.Id] {
+		case visited:
+			return nil
+		case visiting:
+			return errors.Errorf("cyclic dependency: %s -> %s", strings.Join(path, " -> "), node.Id)
+		}
+
+		state[node.Id] = visiting
+		path = append(path, node.Id)
+		for _, dependency := range node.DependsOn {
+			err := visit(nodes[dependency])
+			if err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[node.Id] = visited
+		return nil
+	}
+
+	for _, node := range t.Nodes {
+		err := visit(node)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
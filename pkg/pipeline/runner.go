@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"runtime"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/trace"
+	"github.com/develar/errors"
+)
+
+const (
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+	// dependency failed or plan is stopped because of failure of another node
+	StatusSkipped = "skipped"
+)
+
+type Result struct {
+	// milliseconds
+	Duration int64         `json:"duration"`
+	Nodes    []*NodeResult `json:"nodes"`
+}
+
+type NodeResult struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	// milliseconds since start of plan
+	Start    int64  `json:"start"`
+	Duration int64  `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	// JSON written by command to stdout is embedded as is, other output as string
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// Runner executes nodes of plan as soon as all dependencies are completed, not more than parallelism nodes at once
+type Runner struct {
+	Parallelism int
+	// by default, new nodes are not started after failure (running nodes are completed)
+	KeepGoing bool
+	// base dir of relative node dir
+	BaseDir string
+
+	// replaced in tests
+	execute func(ctx context.Context, node *Node) ([]byte, error)
+}
+
+type completion struct {
+	index  int
+	output []byte
+	err    error
+	end    time.Time
+}
+
+// Run returns result in the order of plan nodes, error is returned only if plan cannot be executed (result reports failed nodes)
+func (t *Runner) Run(ctx context.Context, plan *Plan) (*Result, error) {
+	err := plan.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	parallelism := t.Parallelism
+	if parallelism <= 0 {
+		parallelism = plan.Parallelism
+	}
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+
+	execute := t.execute
+	if execute == nil {
+		execute = func(ctx context.Context, node *Node) ([]byte, error) {
+			return executeNode(ctx, node, t.BaseDir)
+		}
+	}
+
+	indexes := make(map[string]int, len(plan.Nodes))
+	for index, node := range plan.Nodes {
+		indexes[node.Id] = index
+	}
+
+	pendingDependencies := make([]int, len(plan.Nodes))
+	dependents := make([][]int, len(plan.Nodes))
+	var ready []int
+	for index, node := range plan.Nodes {
+		pendingDependencies[index] = len(node.DependsOn)
+		for _, dependency := range node.DependsOn {
+			dependents[indexes[dependency]] = append(dependents[indexes[dependency]], index)
+		}
+		if len(node.DependsOn) == 0 {
+			ready = append(ready, index)
+		}
+	}
+
+	start := time.Now()
+	results := make([]*NodeResult, len(plan.Nodes))
+	completions := make(chan completion)
+	running := 0
+	isFailed := false
+
+	var skip func(index int)
+	skip = func(index int) {
+		if results[index] != nil {
+			return
+		}
+		results[index] = &NodeResult{Id: plan.Nodes[index].Id, Status: StatusSkipped}
+		for _, dependent := range dependents[index] {
+			skip(dependent)
+		}
+	}
+
+	for {
+		for len(ready) != 0 && running < parallelism && !(isFailed && !t.KeepGoing) && ctx.Err() == nil {
+			index := ready[0]
+			ready = ready[1:]
+			node := plan.Nodes[index]
+			nodeStart := time.Now()
+			results[index] = &NodeResult{Id: node.Id, Start: toMillis(nodeStart.Sub(start))}
+			running++
+			log.WithField("node", node.Id).WithField("command", node.Command).Info("starting")
+			go func() {
+				nodeContext, span := trace.Start(ctx, node.Id)
+				span.SetAttribute("command", node.Command)
+				output, err := execute(nodeContext, node)
+				span.End(err)
+				completions <- completion{index: index, output: output, err: err, end: time.Now()}
+			}()
+		}
+
+		if running == 0 {
+			break
+		}
+
+		c := <-completions
+		running--
+
+		result := results[c.index]
+		result.Duration = toMillis(c.end.Sub(start)) - result.Start
+		result.Output = toRawOutput(c.output)
+		logger := log.WithField("node", result.Id).WithField("duration", time.Duration(result.Duration)*time.Millisecond)
+		if c.err != nil {
+			isFailed = true
+			result.Status = StatusFailed
+			result.Error = c.err.Error()
+			logger.WithError(c.err).Error("failed")
+			for _, dependent := range dependents[c.index] {
+				skip(dependent)
+			}
+			continue
+		}
+
+		result.Status = StatusSuccess
+		logger.Info("completed")
+		for _, dependent := range dependents[c.index] {
+			pendingDependencies[dependent]--
+			if pendingDependencies[dependent] == 0 && results[dependent] == nil {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	// not started because of failure or cancellation
+	for index := range results {
+		skip(index)
+	}
+
+	if ctx.Err() != nil {
+		return nil, errors.WithStack(ctx.Err())
+	}
+	return &Result{Duration: toMillis(time.Since(start)), Nodes: results}, nil
+}
+
+// FailedNodes returns ids of failed nodes
+func (t *Result) FailedNodes() []string {
+	var result []string
+	for _, node := range t.Nodes {
+		if node.Status == StatusFailed {
+			result = append(result, node.Id)
+		}
+	}
+	return result
+}
+
+func toMillis(duration time.Duration) int64 {
+	return int64(duration / time.Millisecond)
+}
+
+func toRawOutput(output []byte) json.RawMessage {
+	if len(output) == 0 {
+		return nil
+	}
+	if json.Valid(output) {
+		return output
+	}
+
+	result, err := json.Marshal(string(output))
+	if err != nil {
+		return nil
+	}
+	return result
+}
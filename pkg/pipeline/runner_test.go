@@ -0,0 +1,139 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestValidatePlan(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	plan := &Plan{Nodes: []*Node{
+		{Id: "a", Command: "copy", DependsOn: []string{"c"}},
+		{Id: "b", Command: "copy", DependsOn: []string{"a"}},
+		{Id: "c", Command: "copy", DependsOn: []string{"b"}},
+	}}
+	g.Expect(plan.Validate()).To(MatchError("cyclic dependency: a -> c -> b -> a"))
+
+	plan = &Plan{Nodes: []*Node{{Id: "a", Command: "copy", DependsOn: []string{"unknown"}}}}
+	g.Expect(plan.Validate()).To(MatchError(`node "a" depends on unknown node "unknown"`))
+
+	plan = &Plan{Nodes: []*Node{{Id: "a", Command: "copy"}, {Id: "a", Command: "hash"}}}
+	g.Expect(plan.Validate()).To(MatchError(`duplicated node id "a"`))
+}
+
+func TestReadPlan(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "plan")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "plan.yml")
+	g.Expect(ioutil.WriteFile(file, []byte(`
+parallelism: 2
+nodes:
+  - id: icon
+    command: icon
+    args: [--input, icon.png, --format, icns, --output, out/icon.icns]
+  - id: zip
+    command: archive
+    args: [--input, out, --output, app.zip]
+    dependsOn: [icon]
+`), 0644)).To(Succeed())
+
+	plan, err := ReadPlan(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Parallelism).To(Equal(2))
+	g.Expect(plan.Nodes).To(HaveLen(2))
+	g.Expect(plan.Nodes[1].DependsOn).To(Equal([]string{"icon"}))
+}
+
+func TestRunPlan(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	plan := &Plan{Nodes: []*Node{
+		{Id: "icon", Command: "icon"},
+		{Id: "stage", Command: "copy"},
+		{Id: "asar", Command: "asar-pack", DependsOn: []string{"stage"}},
+		{Id: "zip", Command: "archive", DependsOn: []string{"icon", "asar"}},
+	}}
+
+	var mutex sync.Mutex
+	var completed []string
+	var running int32
+	var maxRunning int32
+	runner := &Runner{Parallelism: 2, execute: func(ctx context.Context, node *Node) ([]byte, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			value := atomic.LoadInt32(&maxRunning)
+			if current <= value || atomic.CompareAndSwapInt32(&maxRunning, value, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		for _, dependency := range node.DependsOn {
+			g.Expect(completed).To(ContainElement(dependency))
+		}
+		completed = append(completed, node.Id)
+		return []byte(`{"file":"` + node.Id + `"}` + "\n"), nil
+	}}
+
+	result, err := runner.Run(context.Background(), plan)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(completed).To(HaveLen(4))
+	g.Expect(maxRunning).To(Equal(int32(2)))
+	g.Expect(result.FailedNodes()).To(BeEmpty())
+	g.Expect(result.Nodes[3].Id).To(Equal("zip"))
+	g.Expect(result.Nodes[3].Status).To(Equal(StatusSuccess))
+	g.Expect(result.Nodes[3].Start).To(BeNumerically(">=", 40))
+	g.Expect(result.Nodes[3].Duration).To(BeNumerically(">=", 20))
+	g.Expect(string(result.Nodes[3].Output)).To(Equal(`{"file":"zip"}` + "\n"))
+	g.Expect(result.Duration).To(BeNumerically(">=", 60))
+}
+
+func TestRunPlanFailure(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	plan := &Plan{Nodes: []*Node{
+		{Id: "sign", Command: "sign"},
+		{Id: "zip", Command: "archive", DependsOn: []string{"sign"}},
+		{Id: "publish", Command: "publish-s3", DependsOn: []string{"zip"}},
+		{Id: "icon", Command: "icon"},
+	}}
+
+	execute := func(ctx context.Context, node *Node) ([]byte, error) {
+		if node.Id == "sign" {
+			return []byte("not signed"), errors.New("exit status 1")
+		}
+		return nil, nil
+	}
+
+	result, err := (&Runner{Parallelism: 1, execute: execute}).Run(context.Background(), plan)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.FailedNodes()).To(Equal([]string{"sign"}))
+	g.Expect(result.Nodes[0].Error).To(Equal("exit status 1"))
+	g.Expect(string(result.Nodes[0].Output)).To(Equal(`"not signed"`))
+	g.Expect(result.Nodes[2].Status).To(Equal(StatusSkipped))
+	// not started after failure
+	g.Expect(result.Nodes[3].Status).To(Equal(StatusSkipped))
+
+	result, err = (&Runner{Parallelism: 1, KeepGoing: true, execute: execute}).Run(context.Background(), plan)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Nodes[1].Status).To(Equal(StatusSkipped))
+	g.Expect(result.Nodes[3].Status).To(Equal(StatusSuccess))
+}
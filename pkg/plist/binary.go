@@ -0,0 +1,456 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+	"unicode/utf16"
+
+	"github.com/develar/errors"
+)
+
+// binary property list (bplist00). Objects are not deduplicated on encode.
+
+// dates are stored as seconds since 2001-01-01
+var binaryDateEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type binaryEncoder struct {
+	objects [][]byte
+	refSize int
+}
+
+func EncodeBinary(value interface{}) ([]byte, error) {
+	encoder := &binaryEncoder{refSize: 1}
+	count := countObjects(value)
+	for count > (1<<uint(8*encoder.refSize))-1 {
+		encoder.refSize *= 2
+	}
+
+	_, err := encoder.add(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	result.Write(binaryHeader)
+	offsets := make([]int, len(encoder.objects))
+	for index, object := range encoder.objects {
+		offsets[index] = result.Len()
+		result.Write(object)
+	}
+
+	offsetTableOffset := result.Len()
+	offsetSize := 1
+	for offsetTableOffset > (1<<uint(8*offsetSize))-1 {
+		offsetSize *= 2
+	}
+	for _, offset := range offsets {
+		result.Write(encodeSizedInt(uint64(offset), offsetSize))
+	}
+
+	trailer := make([]byte, 32)
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(encoder.refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(encoder.objects)))
+	// top object
+	binary.BigEndian.PutUint64(trailer[16:], 0)
+	binary.BigEndian.PutUint64(trailer[24:], uint64(offsetTableOffset))
+	result.Write(trailer)
+	return result.Bytes(), nil
+}
+
+func countObjects(value interface{}) int {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		count := 1
+		for _, item := range v {
+			count += 1 + countObjects(item)
+		}
+		return count
+	case []interface{}:
+		count := 1
+		for _, item := range v {
+			count += countObjects(item)
+		}
+		return count
+	default:
+		return 1
+	}
+}
+
+func encodeSizedInt(value uint64, size int) []byte {
+	result := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		result[i] = byte(value)
+		value >>= 8
+	}
+	return result
+}
+
+// marker with length in low nibble, or 0xF and int object if length >= 15
+func marker(kind byte, length int) []byte {
+	if length < 15 {
+		return []byte{kind<<4 | byte(length)}
+	}
+	return append([]byte{kind<<4 | 0xF}, encodeInt(int64(length))...)
+}
+
+func encodeInt(value int64) []byte {
+	switch {
+	case value >= 0 && value <= math.MaxUint8:
+		return []byte{0x10, byte(value)}
+	case value >= 0 && value <= math.MaxUint16:
+		return append([]byte{0x11}, encodeSizedInt(uint64(value), 2)...)
+	case value >= 0 && value <= math.MaxUint32:
+		return append([]byte{0x12}, encodeSizedInt(uint64(value), 4)...)
+	default:
+		// negative numbers are always 8 bytes
+		return append([]byte{0x13}, encodeSizedInt(uint64(value), 8)...)
+	}
+}
+
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *binaryEncoder) add(value interface{}) (int, error) {
+	index := len(t.objects)
+	t.objects = append(t.objects, nil)
+
+	switch v := value.(type) {
+	case bool:
+		if v {
+			t.objects[index] = []byte{0x09}
+		} else {
+			t.objects[index] = []byte{0x08}
+		}
+
+	case int:
+		t.objects[index] = encodeInt(int64(v))
+	case int64:
+		t.objects[index] = encodeInt(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			// 16 bytes integer is unsigned
+			t.objects[index] = append(append([]byte{0x14}, make([]byte, 8)...), encodeSizedInt(v, 8)...)
+		} else {
+			t.objects[index] = encodeInt(int64(v))
+		}
+
+	case float64:
+		t.objects[index] = append([]byte{0x23}, encodeSizedInt(math.Float64bits(v), 8)...)
+
+	case time.Time:
+		seconds := float64(v.Sub(binaryDateEpoch)) / float64(time.Second)
+		t.objects[index] = append([]byte{0x33}, encodeSizedInt(math.Float64bits(seconds), 8)...)
+
+	case []byte:
+		t.objects[index] = append(marker(0x4, len(v)), v...)
+
+	case string:
+		if isAscii(v) {
+			t.objects[index] = append(marker(0x5, len(v)), v...)
+		} else {
+			chars := utf16.Encode([]rune(v))
+			object := marker(0x6, len(chars))
+			for _, c := range chars {
+				object = append(object, byte(c>>8), byte(c))
+			}
+			t.objects[index] = object
+		}
+
+	case []interface{}:
+		refs := make([]int, 0, len(v))
+		for _, item := range v {
+			ref, err := t.add(item)
+			if err != nil {
+				return 0, err
+			}
+			refs = append(refs, ref)
+		}
+		t.objects[index] = t.encodeRefs(marker(0xA, len(v)), refs)
+
+	case map[string]interface{}:
+		keys := sortedKeys(v)
+		refs := make([]int, 0, 2*len(keys))
+		for _, key := range keys {
+			ref, err := t.add(key)
+			if err != nil {
+				return 0, err
+			}
+			refs = append(refs, ref)
+		}
+		for _, key := range keys {
+			ref, err := t.add(v[key])
+			if err != nil {
+				return 0, errors.Wrapf(err, "key %q", key)
+			}
+			refs = append(refs, ref)
+		}
+		t.objects[index] = t.encodeRefs(marker(0xD, len(keys)), refs)
+
+	default:
+		return 0, errors.Errorf("unsupported plist value type: %T", value)
+	}
+	return index, nil
+}
+
+func (t *binaryEncoder) encodeRefs(object []byte, refs []int) []byte {
+	for _, ref := range refs {
+		object = append(object, encodeSizedInt(uint64(ref), t.refSize)...)
+	}
+	return object
+}
+
+type binaryDecoder struct {
+	data    []byte
+	offsets []uint64
+	refSize int
+	// objects on the current path, reference cycle is an error
+	inProgress map[uint64]bool
+}
+
+func decodeBinary(data []byte) (interface{}, error) {
+	if len(data) < len(binaryHeader)+32 {
+		return nil, errors.New("binary plist is truncated")
+	}
+
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	decoder := &binaryDecoder{data: data, refSize: int(trailer[7]), inProgress: make(map[uint64]bool)}
+	objectCount := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if offsetSize < 1 || offsetSize > 8 || decoder.refSize < 1 || decoder.refSize > 8 {
+		return nil, errors.New("invalid binary plist trailer")
+	}
+	if offsetTableOffset > uint64(len(data)-32) || objectCount > (uint64(len(data)-32)-offsetTableOffset)/uint64(offsetSize) || topObject >= objectCount {
+		return nil, errors.New("invalid binary plist offset table")
+	}
+
+	decoder.offsets = make([]uint64, objectCount)
+	for index := range decoder.offsets {
+		start := offsetTableOffset + uint64(index*offsetSize)
+		decoder.offsets[index] = readSizedInt(data[start : start+uint64(offsetSize)])
+	}
+	return decoder.decodeObject(topObject)
+}
+
+func readSizedInt(data []byte) uint64 {
+	var result uint64
+	for _, b := range data {
+		result = result<<8 | uint64(b)
+	}
+	return result
+}
+
+func (t *binaryDecoder) bytes(offset uint64, size uint64) ([]byte, error) {
+	if offset > uint64(len(t.data)) || size > uint64(len(t.data))-offset {
+		return nil, errors.Errorf("object at %d is out of data", offset)
+	}
+	return t.data[offset : offset+size], nil
+}
+
+// returns length and offset of content
+func (t *binaryDecoder) readLength(offset uint64) (uint64, uint64, error) {
+	length := uint64(t.data[offset] & 0xF)
+	if length != 0xF {
+		return length, offset + 1, nil
+	}
+
+	intMarker, err := t.bytes(offset+1, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if intMarker[0]>>4 != 0x1 {
+		return 0, 0, errors.Errorf("invalid length of object at %d", offset)
+	}
+
+	size := uint64(1) << (intMarker[0] & 0xF)
+	data, err := t.bytes(offset+2, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readSizedInt(data), offset + 2 + size, nil
+}
+
+func (t *binaryDecoder) decodeObject(ref uint64) (interface{}, error) {
+	if ref >= uint64(len(t.offsets)) {
+		return nil, errors.Errorf("invalid object reference %d", ref)
+	}
+	if t.inProgress[ref] {
+		return nil, errors.Errorf("object reference cycle (%d)", ref)
+	}
+
+	offset := t.offsets[ref]
+	if offset >= uint64(len(t.data)) {
+		return nil, errors.Errorf("object %d is out of data", ref)
+	}
+
+	objectMarker := t.data[offset]
+	switch objectMarker >> 4 {
+	case 0x0:
+		switch objectMarker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		default:
+			return nil, errors.Errorf("unsupported object marker %#x", objectMarker)
+		}
+
+	case 0x1:
+		size := uint64(1) << (objectMarker & 0xF)
+		data, err := t.bytes(offset+1, size)
+		if err != nil {
+			return nil, err
+		}
+		switch size {
+		case 8:
+			return int64(readSizedInt(data)), nil
+		case 16:
+			// only unsigned values greater than max int64 are written as 16 bytes
+			return readSizedInt(data[8:]), nil
+		default:
+			return int64(readSizedInt(data)), nil
+		}
+
+	case 0x2:
+		size := uint64(1) << (objectMarker & 0xF)
+		data, err := t.bytes(offset+1, size)
+		if err != nil {
+			return nil, err
+		}
+		switch size {
+		case 4:
+			return float64(math.Float32frombits(uint32(readSizedInt(data)))), nil
+		case 8:
+			return math.Float64frombits(readSizedInt(data)), nil
+		default:
+			return nil, errors.Errorf("unsupported real size %d", size)
+		}
+
+	case 0x3:
+		data, err := t.bytes(offset+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(readSizedInt(data))
+		return binaryDateEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+
+	case 0x4, 0x5:
+		length, start, err := t.readLength(offset)
+		if err != nil {
+			return nil, err
+		}
+		data, err := t.bytes(start, length)
+		if err != nil {
+			return nil, err
+		}
+		if objectMarker>>4 == 0x5 {
+			return string(data), nil
+		}
+		return append([]byte(nil), data...), nil
+
+	case 0x6:
+		length, start, err := t.readLength(offset)
+		if err != nil {
+			return nil, err
+		}
+		data, err := t.bytes(start, length*2)
+		if err != nil {
+			return nil, err
+		}
+		chars := make([]uint16, length)
+		for index := range chars {
+			chars[index] = binary.BigEndian.Uint16(data[index*2:])
+		}
+		return string(utf16.Decode(chars)), nil
+
+	case 0x8:
+		// UID (NSKeyedArchiver), decoded as integer
+		data, err := t.bytes(offset+1, uint64(objectMarker&0xF)+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readSizedInt(data)), nil
+
+	case 0xA, 0xC:
+		refs, err := t.readRefs(offset, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		t.inProgress[ref] = true
+		defer delete(t.inProgress, ref)
+
+		result := make([]interface{}, len(refs))
+		for index, itemRef := range refs {
+			result[index], err = t.decodeObject(itemRef)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	case 0xD:
+		refs, err := t.readRefs(offset, 2)
+		if err != nil {
+			return nil, err
+		}
+
+		t.inProgress[ref] = true
+		defer delete(t.inProgress, ref)
+
+		count := len(refs) / 2
+		result := make(map[string]interface{}, count)
+		for index := 0; index < count; index++ {
+			key, err := t.decodeObject(refs[index])
+			if err != nil {
+				return nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, errors.Errorf("dict key must be a string, but %T found", key)
+			}
+			result[keyString], err = t.decodeObject(refs[count+index])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	default:
+		return nil, errors.Errorf("unsupported object marker %#x", objectMarker)
+	}
+}
+
+// count of refs is length * refsPerItem (2 for dict: keys, then values)
+func (t *binaryDecoder) readRefs(offset uint64, refsPerItem uint64) ([]uint64, error) {
+	length, start, err := t.readLength(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > uint64(len(t.data)) {
+		return nil, errors.Errorf("invalid length of object at %d", offset)
+	}
+	count := length * refsPerItem
+	data, err := t.bytes(start, count*uint64(t.refSize))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]uint64, count)
+	for index := range result {
+		result[index] = readSizedInt(data[index*t.refSize : (index+1)*t.refSize])
+	}
+	return result, nil
+}
@@ -0,0 +1,225 @@
+package plist
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/errors"
+)
+
+type BundleOptions struct {
+	// CFBundleIdentifier
+	Identifier string
+	// CFBundleVersion
+	Version string
+	// CFBundleShortVersionString
+	ShortVersion string
+	// .icns file, copied to Contents/Resources (file name of existing CFBundleIconFile is kept)
+	Icon string
+	// NSHighResolutionCapable
+	IsHighResolutionCapable *bool
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("plist", "Read and modify property list (binary or XML), format of file is preserved.")
+	file := command.Flag("file", "").Short('f').Required().String()
+	getKeys := command.Flag("get", "Key to print (JSON), whole dict is printed if not specified and nothing is modified.").Strings()
+	setValues := command.Flag("set", "Key=Value (string).").StringMap()
+	setJsonValues := command.Flag("set-json", "Key=Value (JSON: number, bool, array or dict).").StringMap()
+	deleteKeys := command.Flag("delete", "").Strings()
+	format := command.Flag("format", "Output format (default: format of input).").Enum("xml", "binary")
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		dict, fileFormat, err := ReadFile(*file)
+		if err != nil {
+			return err
+		}
+
+		isModified := len(*setValues) != 0 || len(*setJsonValues) != 0 || len(*deleteKeys) != 0 || len(*format) != 0
+		for key, value := range *setValues {
+			dict[key] = value
+		}
+		for key, value := range *setJsonValues {
+			dict[key], err = parseJsonValue(value)
+			if err != nil {
+				return errors.Wrapf(err, "invalid value of %s", key)
+			}
+		}
+		for _, key := range *deleteKeys {
+			delete(dict, key)
+		}
+
+		if isModified {
+			if len(*format) != 0 {
+				fileFormat, _ = ParseFormat(*format)
+			}
+			err = WriteFile(*file, dict, fileFormat)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(*getKeys) != 0 {
+			result := make(map[string]interface{}, len(*getKeys))
+			for _, key := range *getKeys {
+				result[key] = dict[key]
+			}
+			return writeJson(result)
+		}
+		if !isModified {
+			return writeJson(dict)
+		}
+		return nil
+	})
+
+	configureUpdateBundleCommand(app)
+}
+
+func configureUpdateBundleCommand(app *kingpin.Application) {
+	command := app.Command("update-bundle", "Update Info.plist and icon of macOS application bundle.")
+	appDir := command.Flag("app", "The .app directory.").Required().String()
+	options := BundleOptions{}
+	command.Flag("bundle-id", "").StringVar(&options.Identifier)
+	command.Flag("bundle-version", "").StringVar(&options.Version)
+	command.Flag("bundle-short-version", "").StringVar(&options.ShortVersion)
+	command.Flag("icon", "The .icns file.").StringVar(&options.Icon)
+	highResolutionCapable := command.Flag("high-resolution-capable", "").Enum("true", "false")
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		if len(*highResolutionCapable) != 0 {
+			value := *highResolutionCapable == "true"
+			options.IsHighResolutionCapable = &value
+		}
+		return UpdateBundle(*appDir, &options)
+	})
+}
+
+// UpdateBundle modifies Contents/Info.plist of application bundle (format is preserved) and replaces icon
+func UpdateBundle(appDir string, options *BundleOptions) error {
+	infoFile := filepath.Join(appDir, "Contents", "Info.plist")
+	dict, format, err := ReadFile(infoFile)
+	if err != nil {
+		return err
+	}
+
+	setString := func(key string, value string) {
+		if len(value) != 0 {
+			dict[key] = value
+		}
+	}
+	setString("CFBundleIdentifier", options.Identifier)
+	setString("CFBundleVersion", options.Version)
+	setString("CFBundleShortVersionString", options.ShortVersion)
+	if options.IsHighResolutionCapable != nil {
+		dict["NSHighResolutionCapable"] = *options.IsHighResolutionCapable
+	}
+
+	if len(options.Icon) != 0 {
+		err = setBundleIcon(appDir, dict, options.Icon)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = WriteFile(infoFile, dict, format)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{"file": infoFile, "format": format}).Debug("bundle info updated")
+	return nil
+}
+
+func setBundleIcon(appDir string, dict map[string]interface{}, icon string) error {
+	if !strings.HasSuffix(strings.ToLower(icon), ".icns") {
+		return errors.Errorf("icon %s must be .icns", icon)
+	}
+
+	iconName, _ := dict["CFBundleIconFile"].(string)
+	if len(iconName) == 0 {
+		iconName = filepath.Base(icon)
+	} else if filepath.Ext(iconName) == "" {
+		// extension is optional in CFBundleIconFile
+		iconName += ".icns"
+	}
+
+	resourceDir := filepath.Join(appDir, "Contents", "Resources")
+	err := os.MkdirAll(resourceDir, 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = fs.CopyDirOrFile(icon, filepath.Join(resourceDir, iconName))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dict["CFBundleIconFile"] = iconName
+	if _, ok := dict["CFBundleIconName"]; ok {
+		// icon from asset catalog (Assets.car) takes precedence over icns on macOS 11+
+		log.WithField("name", dict["CFBundleIconName"]).Warn("CFBundleIconName is removed to use the new icon")
+		delete(dict, "CFBundleIconName")
+	}
+	return nil
+}
+
+func parseJsonValue(value string) (interface{}, error) {
+	var result interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	err := decoder.Decode(&result)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return normalizeJsonValue(result)
+}
+
+// json.Number is converted to int64 or float64, null is not supported by plist
+func normalizeJsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case json.Number:
+		if intValue, err := v.Int64(); err == nil {
+			return intValue, nil
+		}
+		floatValue, err := v.Float64()
+		return floatValue, errors.WithStack(err)
+
+	case []interface{}:
+		for index, item := range v {
+			normalized, err := normalizeJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[index] = normalized
+		}
+		return v, nil
+
+	case map[string]interface{}:
+		for key, item := range v {
+			normalized, err := normalizeJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+		return v, nil
+
+	case nil:
+		return nil, errors.New("null is not supported")
+
+	default:
+		return v, nil
+	}
+}
+
+// data values are written as base64 strings, dates as RFC 3339
+func writeJson(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return errors.WithStack(encoder.Encode(value))
+}
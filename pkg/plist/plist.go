@@ -0,0 +1,103 @@
+package plist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/errors"
+)
+
+// Values are represented as:
+// dict - map[string]interface{}, array - []interface{}, string, bool, int64 (uint64 if greater than max int64), float64, []byte (data) and time.Time (date).
+// Encoder also accepts int.
+
+type Format int
+
+const (
+	XmlFormat Format = iota
+	BinaryFormat
+)
+
+func (t Format) String() string {
+	if t == BinaryFormat {
+		return "binary"
+	}
+	return "xml"
+}
+
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "xml", "xml1":
+		return XmlFormat, nil
+	case "binary", "binary1":
+		return BinaryFormat, nil
+	default:
+		return XmlFormat, errors.Errorf("unknown plist format %q (xml or binary expected)", name)
+	}
+}
+
+var binaryHeader = []byte("bplist00")
+
+// Decode detects format (binary or XML) and decodes property list
+func Decode(data []byte) (interface{}, Format, error) {
+	if bytes.HasPrefix(data, binaryHeader) {
+		value, err := decodeBinary(data)
+		return value, BinaryFormat, err
+	}
+
+	value, err := decodeXml(data)
+	return value, XmlFormat, err
+}
+
+func Encode(value interface{}, format Format) ([]byte, error) {
+	if format == BinaryFormat {
+		return EncodeBinary(value)
+	}
+	return EncodeXml(value)
+}
+
+// ReadFile reads property list with dict as the root object (e.g. Info.plist)
+func ReadFile(file string) (map[string]interface{}, Format, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, XmlFormat, errors.WithStack(err)
+	}
+
+	value, format, err := Decode(data)
+	if err != nil {
+		return nil, format, errors.Wrapf(err, "cannot parse %s", file)
+	}
+
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, format, errors.Errorf("root object of %s is not a dict", file)
+	}
+	return dict, format, nil
+}
+
+// WriteFile writes property list atomically (bundle is not left with truncated Info.plist if process is killed)
+func WriteFile(file string, value interface{}, format Format) error {
+	data, err := Encode(value, format)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(file); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return fs.WriteFileAtomic(file, data, mode)
+}
+
+func sortedKeys(dict map[string]interface{}) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+package plist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const testInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.github.Electron</string>
+	<key>CFBundleIconFile</key>
+	<string>electron</string>
+	<key>CFBundleIconName</key>
+	<string>AppIcon</string>
+	<key>LSMinimumSystemVersion</key>
+	<string>10.10.0</string>
+	<key>NSHighResolutionCapable</key>
+	<false/>
+	<key>NSSupportsAutomaticGraphicsSwitching</key>
+	<true/>
+	<key>CFBundleDocumentTypes</key>
+	<array>
+		<dict>
+			<key>CFBundleTypeExtensions</key>
+			<array><string>txt</string></array>
+			<key>CFBundleTypeRole</key>
+			<string>Editor &amp; Viewer</string>
+		</dict>
+	</array>
+	<key>Count</key>
+	<integer>-42</integer>
+	<key>Ratio</key>
+	<real>1.5</real>
+	<key>Created</key>
+	<date>2019-02-03T10:20:30Z</date>
+	<key>Data</key>
+	<data>
+	AAEC
+	/w==
+	</data>
+	<key>Empty</key>
+	<dict/>
+</dict>
+</plist>
+`
+
+func TestDecodeXml(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	value, format, err := Decode([]byte(testInfoPlist))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(format).To(Equal(XmlFormat))
+
+	dict := value.(map[string]interface{})
+	g.Expect(dict["CFBundleIdentifier"]).To(Equal("com.github.Electron"))
+	g.Expect(dict["NSHighResolutionCapable"]).To(Equal(false))
+	g.Expect(dict["NSSupportsAutomaticGraphicsSwitching"]).To(Equal(true))
+	g.Expect(dict["Count"]).To(Equal(int64(-42)))
+	g.Expect(dict["Ratio"]).To(Equal(1.5))
+	g.Expect(dict["Created"]).To(Equal(time.Date(2019, 2, 3, 10, 20, 30, 0, time.UTC)))
+	g.Expect(dict["Data"]).To(Equal([]byte{0, 1, 2, 0xff}))
+	g.Expect(dict["Empty"]).To(Equal(map[string]interface{}{}))
+	documentType := dict["CFBundleDocumentTypes"].([]interface{})[0].(map[string]interface{})
+	g.Expect(documentType["CFBundleTypeExtensions"]).To(Equal([]interface{}{"txt"}))
+	g.Expect(documentType["CFBundleTypeRole"]).To(Equal("Editor & Viewer"))
+}
+
+func TestRoundTrip(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	value, _, err := Decode([]byte(testInfoPlist))
+	g.Expect(err).NotTo(HaveOccurred())
+	dict := value.(map[string]interface{})
+	dict["Unicode"] = "Привет, 世界"
+	dict["Long"] = strings.Repeat("long string ", 10)
+	dict["Big"] = uint64(1<<64 - 1)
+	dict["Large"] = int64(1 << 40)
+	dict["Items"] = []interface{}{int64(1), int64(300), int64(70000), "a", true, []interface{}{}}
+
+	for _, format := range []Format{XmlFormat, BinaryFormat} {
+		data, err := Encode(dict, format)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(bytes.HasPrefix(data, binaryHeader)).To(Equal(format == BinaryFormat))
+
+		decoded, decodedFormat, err := Decode(data)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(decodedFormat).To(Equal(format))
+		g.Expect(decoded).To(Equal(dict), format.String())
+	}
+
+	data, err := EncodeXml(map[string]interface{}{"A": "<b>", "B": []interface{}{}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(HaveSuffix("<dict>\n\t<key>A</key>\n\t<string>&lt;b&gt;</string>\n\t<key>B</key>\n\t<array/>\n</dict>\n</plist>\n"))
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, _, err := Decode([]byte("<plist><dict><key>a</key></dict></plist>"))
+	g.Expect(err).To(HaveOccurred())
+	_, _, err = Decode([]byte("<plist><dict><string>a</string></dict></plist>"))
+	g.Expect(err).To(HaveOccurred())
+
+	data, err := EncodeBinary(map[string]interface{}{"a": []interface{}{"b"}})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, _, err = Decode(data[:len(data)-1])
+	g.Expect(err).To(HaveOccurred())
+
+	// array (object 0) refers to itself
+	cycle := append([]byte("bplist00"), 0xA1, 0x00)
+	cycle = append(cycle, 8)
+	trailer := make([]byte, 32)
+	trailer[6] = 1
+	trailer[7] = 1
+	trailer[15] = 1
+	trailer[31] = 10
+	_, _, err = Decode(append(cycle, trailer...))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("cycle"))
+}
+
+func TestUpdateBundle(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	appDir, err := ioutil.TempDir("", "plist-test")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(appDir)
+
+	value, _, err := Decode([]byte(testInfoPlist))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "Contents"), 0755)).To(Succeed())
+	infoFile := filepath.Join(appDir, "Contents", "Info.plist")
+	g.Expect(WriteFile(infoFile, value, BinaryFormat)).To(Succeed())
+
+	icon, err := filepath.Abs(filepath.Join("..", "..", "testData", "icon.icns"))
+	g.Expect(err).NotTo(HaveOccurred())
+	isHighResolutionCapable := true
+	err = UpdateBundle(appDir, &BundleOptions{
+		Identifier:              "org.example.app",
+		Version:                 "1.2.3.4",
+		ShortVersion:            "1.2.3",
+		Icon:                    icon,
+		IsHighResolutionCapable: &isHighResolutionCapable,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	dict, format, err := ReadFile(infoFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(format).To(Equal(BinaryFormat))
+	g.Expect(dict["CFBundleIdentifier"]).To(Equal("org.example.app"))
+	g.Expect(dict["CFBundleVersion"]).To(Equal("1.2.3.4"))
+	g.Expect(dict["CFBundleShortVersionString"]).To(Equal("1.2.3"))
+	g.Expect(dict["NSHighResolutionCapable"]).To(Equal(true))
+	g.Expect(dict["CFBundleIconFile"]).To(Equal("electron.icns"))
+	g.Expect(dict).NotTo(HaveKey("CFBundleIconName"))
+	// not modified keys are preserved
+	g.Expect(dict["LSMinimumSystemVersion"]).To(Equal("10.10.0"))
+
+	expectedIcon, err := ioutil.ReadFile(icon)
+	g.Expect(err).NotTo(HaveOccurred())
+	actualIcon, err := ioutil.ReadFile(filepath.Join(appDir, "Contents", "Resources", "electron.icns"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(actualIcon).To(Equal(expectedIcon))
+
+	g.Expect(UpdateBundle(appDir, &BundleOptions{Icon: filepath.Join(appDir, "icon.png")})).To(HaveOccurred())
+}
+
+func TestParseJsonValue(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	value, err := parseJsonValue(`{"a": [1, 2.5, true, "s"]}`)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal(map[string]interface{}{"a": []interface{}{int64(1), 2.5, true, "s"}}))
+
+	_, err = parseJsonValue("null")
+	g.Expect(err).To(HaveOccurred())
+}
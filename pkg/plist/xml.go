@@ -0,0 +1,279 @@
+package plist
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/develar/errors"
+)
+
+const xmlDateLayout = "2006-01-02T15:04:05Z"
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+`
+
+type xmlDecoder struct {
+	decoder *xml.Decoder
+}
+
+func decodeXml(data []byte) (interface{}, error) {
+	decoder := &xmlDecoder{decoder: xml.NewDecoder(bytes.NewReader(data))}
+	// Info.plist is always UTF-8 in practice
+	decoder.decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	for {
+		element, err := decoder.nextStart()
+		if err != nil {
+			return nil, err
+		}
+		if element.Name.Local == "plist" {
+			continue
+		}
+		return decoder.decodeValue(element)
+	}
+}
+
+// returns the next start element, end element (e.g. missing value of dict key) is an error
+func (t *xmlDecoder) nextStart() (xml.StartElement, error) {
+	for {
+		token, err := t.decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return xml.StartElement{}, errors.New("plist value is missing")
+			}
+			return xml.StartElement{}, errors.WithStack(err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token, nil
+		case xml.EndElement:
+			return xml.StartElement{}, errors.Errorf("unexpected </%s>", token.Name.Local)
+		}
+	}
+}
+
+func (t *xmlDecoder) readText(element xml.StartElement) (string, error) {
+	var text string
+	err := t.decoder.DecodeElement(&text, &element)
+	return text, errors.WithStack(err)
+}
+
+func (t *xmlDecoder) decodeValue(element xml.StartElement) (interface{}, error) {
+	switch element.Name.Local {
+	case "dict":
+		return t.decodeDict()
+
+	case "array":
+		result := make([]interface{}, 0)
+		for {
+			token, err := t.decoder.Token()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			switch token := token.(type) {
+			case xml.StartElement:
+				value, err := t.decodeValue(token)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, value)
+			case xml.EndElement:
+				return result, nil
+			}
+		}
+
+	case "true", "false":
+		err := t.decoder.Skip()
+		return element.Name.Local == "true", errors.WithStack(err)
+	}
+
+	text, err := t.readText(element)
+	if err != nil {
+		return nil, err
+	}
+
+	switch element.Name.Local {
+	case "string":
+		return text, nil
+
+	case "integer":
+		return parseInteger(strings.TrimSpace(text))
+
+	case "real":
+		value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		return value, errors.WithStack(err)
+
+	case "date":
+		value, err := time.Parse(xmlDateLayout, strings.TrimSpace(text))
+		return value, errors.WithStack(err)
+
+	case "data":
+		value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		return value, errors.WithStack(err)
+
+	default:
+		return nil, errors.Errorf("unsupported plist element <%s>", element.Name.Local)
+	}
+}
+
+func (t *xmlDecoder) decodeDict() (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for {
+		token, err := t.decoder.Token()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		switch token := token.(type) {
+		case xml.EndElement:
+			return result, nil
+
+		case xml.StartElement:
+			if token.Name.Local != "key" {
+				return nil, errors.Errorf("<key> expected in <dict>, but <%s> found", token.Name.Local)
+			}
+
+			key, err := t.readText(token)
+			if err != nil {
+				return nil, err
+			}
+
+			valueElement, err := t.nextStart()
+			if err != nil {
+				return nil, errors.Wrapf(err, "value of key %q", key)
+			}
+			result[key], err = t.decodeValue(valueElement)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func parseInteger(text string) (interface{}, error) {
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err == nil {
+		return value, nil
+	}
+
+	unsignedValue, unsignedErr := strconv.ParseUint(text, 10, 64)
+	if unsignedErr == nil {
+		return unsignedValue, nil
+	}
+	return nil, errors.WithStack(err)
+}
+
+// EncodeXml encodes value as Apple XML property list (keys are sorted, tab indent as plutil does)
+func EncodeXml(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.WriteString(xmlHeader)
+	err := encodeXmlValue(&buffer, value, 0)
+	if err != nil {
+		return nil, err
+	}
+	buffer.WriteString("</plist>\n")
+	return buffer.Bytes(), nil
+}
+
+func encodeXmlValue(buffer *bytes.Buffer, value interface{}, depth int) error {
+	indent := strings.Repeat("\t", depth)
+	buffer.WriteString(indent)
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			buffer.WriteString("<dict/>\n")
+			return nil
+		}
+
+		buffer.WriteString("<dict>\n")
+		for _, key := range sortedKeys(v) {
+			buffer.WriteString(indent + "\t<key>")
+			writeEscaped(buffer, key)
+			buffer.WriteString("</key>\n")
+			err := encodeXmlValue(buffer, v[key], depth+1)
+			if err != nil {
+				return errors.Wrapf(err, "key %q", key)
+			}
+		}
+		buffer.WriteString(indent + "</dict>\n")
+
+	case []interface{}:
+		if len(v) == 0 {
+			buffer.WriteString("<array/>\n")
+			return nil
+		}
+
+		buffer.WriteString("<array>\n")
+		for _, item := range v {
+			err := encodeXmlValue(buffer, item, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+		buffer.WriteString(indent + "</array>\n")
+
+	case string:
+		buffer.WriteString("<string>")
+		writeEscaped(buffer, v)
+		buffer.WriteString("</string>\n")
+
+	case bool:
+		if v {
+			buffer.WriteString("<true/>\n")
+		} else {
+			buffer.WriteString("<false/>\n")
+		}
+
+	case int:
+		buffer.WriteString("<integer>" + strconv.Itoa(v) + "</integer>\n")
+	case int64:
+		buffer.WriteString("<integer>" + strconv.FormatInt(v, 10) + "</integer>\n")
+	case uint64:
+		buffer.WriteString("<integer>" + strconv.FormatUint(v, 10) + "</integer>\n")
+
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return errors.Errorf("%v cannot be encoded", v)
+		}
+		buffer.WriteString("<real>" + strconv.FormatFloat(v, 'g', -1, 64) + "</real>\n")
+
+	case time.Time:
+		buffer.WriteString("<date>" + v.UTC().Format(xmlDateLayout) + "</date>\n")
+
+	case []byte:
+		buffer.WriteString("<data>\n" + indent + base64.StdEncoding.EncodeToString(v) + "\n" + indent + "</data>\n")
+
+	default:
+		return errors.Errorf("unsupported plist value type: %T", value)
+	}
+	return nil
+}
+
+// only &, < and > are escaped (quotes and new lines are kept as is, as Apple tools do)
+func writeEscaped(buffer *bytes.Buffer, value string) {
+	for _, c := range value {
+		switch c {
+		case '&':
+			buffer.WriteString("&amp;")
+		case '<':
+			buffer.WriteString("&lt;")
+		case '>':
+			buffer.WriteString("&gt;")
+		default:
+			buffer.WriteRune(c)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package preflight
+
+import (
+	"github.com/develar/errors"
+)
+
+// all paths are considered to be on the same volume, available space is not checked
+func volumeId(dir string) (string, error) {
+	return "", nil
+}
+
+func availableSpace(dir string) (uint64, error) {
+	return 0, errors.New("available disk space is not supported on this platform")
+}
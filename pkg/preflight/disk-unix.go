@@ -0,0 +1,30 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package preflight
+
+import (
+	"strconv"
+	"syscall"
+
+	"github.com/develar/errors"
+)
+
+func volumeId(dir string) (string, error) {
+	var stat syscall.Stat_t
+	err := syscall.Stat(dir, &stat)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return strconv.FormatUint(uint64(stat.Dev), 10), nil
+}
+
+// available to unprivileged user (reserved blocks are not counted)
+func availableSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
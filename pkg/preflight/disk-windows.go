@@ -0,0 +1,38 @@
+//go:build windows
+// +build windows
+
+package preflight
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/develar/errors"
+)
+
+var (
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procGetDiskFreeSpaceExW = kernel32.NewProc("GetDiskFreeSpaceExW")
+)
+
+// drive letter or UNC share
+func volumeId(dir string) (string, error) {
+	return strings.ToLower(filepath.VolumeName(dir)), nil
+}
+
+// available to the current user (disk quotas are taken into account)
+func availableSpace(dir string) (uint64, error) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var freeBytesAvailable uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(path)), uintptr(unsafe.Pointer(&freeBytesAvailable)), 0, 0)
+	if r == 0 {
+		return 0, errors.WithStack(err)
+	}
+	return freeBytesAvailable, nil
+}
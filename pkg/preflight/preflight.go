@@ -0,0 +1,244 @@
+package preflight
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/dustin/go-humanize"
+)
+
+// volume must not be filled completely - other processes (and file system metadata of the produced files) need some space too
+const reservedBytes = 64 * 1024 * 1024
+
+// replaced in tests (volumes of temp and output dirs are different)
+var getVolumeId = volumeId
+
+// Requirement is space required on the volume of Path (file or dir, doesn't have to exist yet)
+type Requirement struct {
+	Path  string
+	Bytes int64
+	// staging, archive or temp
+	Purpose string
+}
+
+// InsufficientDiskSpaceError is reported before packaging starts, instead of ENOSPC in the middle of writing
+type InsufficientDiskSpaceError struct {
+	// existing dir on the volume
+	Volume    string
+	Required  int64
+	Available int64
+	Purposes  []string
+}
+
+func (e *InsufficientDiskSpaceError) ErrorCode() string {
+	return "ERR_INSUFFICIENT_DISK_SPACE"
+}
+
+func (e *InsufficientDiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space on the volume of %s: %s required (%s), %s available (set ELECTRON_BUILDER_SKIP_DISK_SPACE_CHECK=true to skip the check)",
+		e.Volume, humanize.Bytes(uint64(e.Required)), strings.Join(e.Purposes, ", "), humanize.Bytes(uint64(e.Available)))
+}
+
+// UserError is written to stdout as JSON, consumers report it as a user error (not as a crash)
+type UserError struct {
+	Message string `json:"error"`
+	Code    string `json:"errorCode"`
+
+	Volume    string   `json:"volume"`
+	Required  int64    `json:"required"`
+	Available int64    `json:"available"`
+	Purposes  []string `json:"purposes"`
+}
+
+// WriteUserError writes InsufficientDiskSpaceError as JSON to stdout, other errors are returned as is
+func WriteUserError(err error) error {
+	diskSpaceError, ok := errors.Cause(err).(*InsufficientDiskSpaceError)
+	if !ok {
+		return err
+	}
+
+	log.Debugf("%+v\n", err)
+	return util.WriteJsonToStdOut(createUserError(diskSpaceError))
+}
+
+func createUserError(e *InsufficientDiskSpaceError) UserError {
+	return UserError{
+		Message:   e.Error(),
+		Code:      e.ErrorCode(),
+		Volume:    e.Volume,
+		Required:  e.Required,
+		Available: e.Available,
+		Purposes:  e.Purposes,
+	}
+}
+
+type volumeRequirement struct {
+	dir      string
+	required int64
+	purposes []string
+}
+
+// CheckDiskSpace sums requirements of the same volume and returns InsufficientDiskSpaceError for the first volume without enough available space.
+// Volume is not checked if available space cannot be determined (e.g. not supported by file system).
+func CheckDiskSpace(requirements []Requirement) error {
+	if util.IsEnvTrue("ELECTRON_BUILDER_SKIP_DISK_SPACE_CHECK") {
+		return nil
+	}
+
+	var volumes []*volumeRequirement
+	idToVolume := make(map[string]*volumeRequirement)
+	for _, requirement := range requirements {
+		if requirement.Bytes <= 0 {
+			continue
+		}
+
+		dir, err := existingDir(requirement.Path)
+		if err != nil {
+			return err
+		}
+
+		id, err := getVolumeId(dir)
+		if err != nil {
+			return err
+		}
+
+		volume := idToVolume[id]
+		if volume == nil {
+			volume = &volumeRequirement{dir: dir}
+			idToVolume[id] = volume
+			volumes = append(volumes, volume)
+		}
+		volume.required += requirement.Bytes
+		volume.purposes = append(volume.purposes, requirement.Purpose)
+	}
+
+	for _, volume := range volumes {
+		available, err := availableSpace(volume.dir)
+		if err != nil {
+			log.WithError(err).WithField("path", volume.dir).Debug("cannot get available disk space, check is skipped")
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"path":      volume.dir,
+			"required":  humanize.Bytes(uint64(volume.required)),
+			"available": humanize.Bytes(available),
+			"purposes":  strings.Join(volume.purposes, ", "),
+		}).Debug("check disk space")
+		if uint64(volume.required+reservedBytes) > available {
+			return &InsufficientDiskSpaceError{
+				Volume:    volume.dir,
+				Required:  volume.required,
+				Available: int64(available),
+				Purposes:  volume.purposes,
+			}
+		}
+	}
+	return nil
+}
+
+// EstimatePackaging returns requirements to package sources into outputFile: archive (size of sources, compression is not taken into account - worst case),
+// copy of sources in the stage dir (if stage dir is specified and is on another volume, hard links are used otherwise)
+// and intermediate files in the temp dir (if specified - command stages through temp dir).
+func EstimatePackaging(sources []string, stageDir string, tempDir string, outputFile string) ([]Requirement, error) {
+	size, err := Size(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	requirements := []Requirement{{Path: outputFile, Bytes: size, Purpose: "archive"}}
+	if len(stageDir) != 0 && len(sources) != 0 {
+		isSameVolume, err := isSameVolume(sources[0], stageDir)
+		if err != nil {
+			return nil, err
+		}
+		if !isSameVolume {
+			requirements = append(requirements, Requirement{Path: stageDir, Bytes: size, Purpose: "staging"})
+		}
+	}
+	if len(tempDir) != 0 {
+		requirements = append(requirements, Requirement{Path: tempDir, Bytes: size, Purpose: "temp"})
+	}
+	return requirements, nil
+}
+
+// CheckPackaging checks disk space required to package sources into outputFile (see EstimatePackaging)
+func CheckPackaging(sources []string, stageDir string, tempDir string, outputFile string) error {
+	requirements, err := EstimatePackaging(sources, stageDir, tempDir, outputFile)
+	if err != nil {
+		return err
+	}
+	return CheckDiskSpace(requirements)
+}
+
+// Size returns total size of regular files of paths (files or dirs), symlinks are not followed
+func Size(paths []string) (int64, error) {
+	var result int64
+	for _, path := range paths {
+		err := fs.Walk(path, 0, func(file string, info os.FileInfo) error {
+			if info.Mode().IsRegular() {
+				atomic.AddInt64(&result, info.Size())
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return result, nil
+}
+
+func isSameVolume(path1 string, path2 string) (bool, error) {
+	dir1, err := existingDir(path1)
+	if err != nil {
+		return false, err
+	}
+	dir2, err := existingDir(path2)
+	if err != nil {
+		return false, err
+	}
+
+	id1, err := getVolumeId(dir1)
+	if err != nil {
+		return false, err
+	}
+	id2, err := getVolumeId(dir2)
+	if err != nil {
+		return false, err
+	}
+	return id1 == id2, nil
+}
+
+// the nearest existing dir (output file and stage dir are not created yet)
+func existingDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				return path, nil
+			}
+			return filepath.Dir(path), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.WithStack(err)
+		}
+
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", errors.WithStack(err)
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,135 @@
+package preflight
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestEstimatePackaging(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "preflight")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	appDir := filepath.Join(tmpDir, "app")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "resources"), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "app"), make([]byte, 1000), 0644)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "resources", "app.asar"), make([]byte, 24), 0644)).To(Succeed())
+
+	size, err := Size([]string{appDir})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(size).To(Equal(int64(1024)))
+
+	// stage dir on the same volume - hard links are used
+	outputFile := filepath.Join(tmpDir, "out", "app.AppImage")
+	requirements, err := EstimatePackaging([]string{appDir}, filepath.Join(tmpDir, "stage"), "", outputFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requirements).To(Equal([]Requirement{{Path: outputFile, Bytes: 1024, Purpose: "archive"}}))
+
+	g.Expect(CheckDiskSpace(requirements)).To(Succeed())
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "preflight")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	available, err := availableSpace(tmpDir)
+	if err != nil {
+		t.Skip(err.Error())
+	}
+
+	// requirements of the same volume are summed
+	half := int64(available/2) + 1
+	err = CheckDiskSpace([]Requirement{
+		{Path: filepath.Join(tmpDir, "stage"), Bytes: half, Purpose: "staging"},
+		{Path: filepath.Join(tmpDir, "out", "app.zip"), Bytes: half, Purpose: "archive"},
+	})
+	g.Expect(err).To(HaveOccurred())
+	diskSpaceError, ok := errors.Cause(err).(*InsufficientDiskSpaceError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(diskSpaceError.Volume).To(Equal(tmpDir))
+	g.Expect(diskSpaceError.Required).To(Equal(2 * half))
+	g.Expect(diskSpaceError.Purposes).To(Equal([]string{"staging", "archive"}))
+	g.Expect(diskSpaceError.ErrorCode()).To(Equal("ERR_INSUFFICIENT_DISK_SPACE"))
+
+	g.Expect(CheckDiskSpace([]Requirement{{Path: tmpDir, Bytes: 1, Purpose: "archive"}})).To(Succeed())
+
+	err = os.Setenv("ELECTRON_BUILDER_SKIP_DISK_SPACE_CHECK", "true")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Unsetenv("ELECTRON_BUILDER_SKIP_DISK_SPACE_CHECK")
+	g.Expect(CheckDiskSpace([]Requirement{{Path: tmpDir, Bytes: math.MaxInt64 / 2, Purpose: "archive"}})).To(Succeed())
+}
+
+func TestCheckTempOnAnotherVolume(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "preflight")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	available, err := availableSpace(tmpDir)
+	if err != nil {
+		t.Skip(err.Error())
+	}
+
+	tempDir := filepath.Join(tmpDir, "temp")
+	g.Expect(os.MkdirAll(tempDir, 0755)).To(Succeed())
+	defer func() {
+		getVolumeId = volumeId
+	}()
+	getVolumeId = func(dir string) (string, error) {
+		if strings.HasPrefix(dir, tempDir) {
+			return "temp", nil
+		}
+		return "output", nil
+	}
+
+	appDir := filepath.Join(tmpDir, "app")
+	g.Expect(os.MkdirAll(appDir, 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "app"), make([]byte, 1024), 0644)).To(Succeed())
+
+	outputFile := filepath.Join(tmpDir, "out", "app.snap")
+	requirements, err := EstimatePackaging([]string{appDir}, "", tempDir, outputFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requirements).To(Equal([]Requirement{
+		{Path: outputFile, Bytes: 1024, Purpose: "archive"},
+		{Path: tempDir, Bytes: 1024, Purpose: "temp"},
+	}))
+
+	// not summed - every volume has enough space
+	half := int64(available / 2)
+	requirements = []Requirement{
+		{Path: outputFile, Bytes: half, Purpose: "archive"},
+		{Path: tempDir, Bytes: half, Purpose: "temp"},
+	}
+	g.Expect(CheckDiskSpace(requirements)).To(Succeed())
+
+	// temp volume is reported
+	requirements[1].Bytes = int64(available) * 2
+	err = CheckDiskSpace(requirements)
+	diskSpaceError, ok := errors.Cause(err).(*InsufficientDiskSpaceError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(diskSpaceError.Volume).To(Equal(tempDir))
+	g.Expect(diskSpaceError.Purposes).To(Equal([]string{"temp"}))
+
+	userError := createUserError(diskSpaceError)
+	g.Expect(userError.Code).To(Equal("ERR_INSUFFICIENT_DISK_SPACE"))
+	g.Expect(userError.Message).To(Equal(diskSpaceError.Error()))
+	g.Expect(userError.Volume).To(Equal(tempDir))
+	g.Expect(userError.Required).To(Equal(int64(available) * 2))
+
+	otherError := errors.New("other")
+	g.Expect(WriteUserError(otherError)).To(Equal(otherError))
+}
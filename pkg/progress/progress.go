@@ -0,0 +1,202 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+)
+
+// Event is a line of the progress protocol (line-delimited JSON), e.g. {"op":"download","transferred":N,"total":M}.
+// Total is 0 if unknown. The last event of operation has done set to true (and error set if operation failed).
+type Event struct {
+	Op          string `json:"op"`
+	Name        string `json:"name,omitempty"`
+	Transferred int64  `json:"transferred"`
+	Total       int64  `json:"total"`
+	Done        bool   `json:"done,omitempty"`
+	Error       bool   `json:"error,omitempty"`
+}
+
+const DefaultInterval = 200 * time.Millisecond
+
+var outputMutex sync.Mutex
+var output io.Writer
+
+// SetOutput sets writer for all reporters created by Start, nil disables reporting.
+func SetOutput(writer io.Writer) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	output = writer
+}
+
+func IsEnabled() bool {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	return output != nil
+}
+
+// WriteLine writes event reported by another process (line without trailing newline) to the output, ignored if reporting is disabled.
+func WriteLine(line []byte) {
+	outputMutex.Lock()
+	writer := output
+	outputMutex.Unlock()
+	if writer == nil {
+		return
+	}
+
+	_, err := writer.Write(append(line[:len(line):len(line)], '\n'))
+	if err != nil {
+		log.WithError(err).Debug("cannot report progress")
+	}
+}
+
+// --progress-fd 1 to report to stdout, any other fd (e.g. 3 passed as extra stdio by electron-builder) to report to dedicated pipe
+func ConfigureFlags(app *kingpin.Application) {
+	fd := app.Flag("progress-fd", "The file descriptor to report progress as JSON lines (1 for stdout).").Envar("APP_BUILDER_PROGRESS_FD").Default("0").Int()
+	app.PreAction(func(context *kingpin.ParseContext) error {
+		switch {
+		case *fd <= 0:
+			return nil
+		case *fd == 1:
+			SetOutput(os.Stdout)
+		case *fd == 2:
+			SetOutput(os.Stderr)
+		default:
+			file := os.NewFile(uintptr(*fd), "progress")
+			if file == nil {
+				return errors.Errorf("invalid progress file descriptor: %d", *fd)
+			}
+			SetOutput(file)
+		}
+		return nil
+	})
+}
+
+// Reporter reports progress of one operation, events are throttled (not more often than interval), except the final one.
+// All methods can be called on nil reporter (reporting is disabled).
+type Reporter struct {
+	op    string
+	name  string
+	total int64
+
+	transferred int64
+	// unix nano
+	lastReport int64
+
+	writer   io.Writer
+	interval time.Duration
+	mutex    sync.Mutex
+	isDone   bool
+}
+
+// Start returns reporter for the global output, nil if reporting is disabled.
+func Start(op string, name string, total int64) *Reporter {
+	outputMutex.Lock()
+	writer := output
+	outputMutex.Unlock()
+	return NewReporter(writer, op, name, total)
+}
+
+func NewReporter(writer io.Writer, op string, name string, total int64) *Reporter {
+	if writer == nil {
+		return nil
+	}
+	return &Reporter{
+		op:       op,
+		name:     name,
+		total:    total,
+		writer:   writer,
+		interval: DefaultInterval,
+	}
+}
+
+func (t *Reporter) SetTotal(total int64) {
+	if t != nil {
+		atomic.StoreInt64(&t.total, total)
+	}
+}
+
+func (t *Reporter) Add(count int64) {
+	if t == nil {
+		return
+	}
+
+	atomic.AddInt64(&t.transferred, count)
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&t.lastReport)
+	if now-last >= int64(t.interval) && atomic.CompareAndSwapInt64(&t.lastReport, last, now) {
+		t.report(false, false)
+	}
+}
+
+// Finish reports the final event, subsequent calls are ignored.
+func (t *Reporter) Finish(err error) {
+	if t != nil {
+		t.report(true, err != nil)
+	}
+}
+
+func (t *Reporter) report(isDone bool, isError bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.isDone {
+		return
+	}
+	t.isDone = isDone
+
+	event := Event{
+		Op:          t.op,
+		Name:        t.name,
+		Transferred: atomic.LoadInt64(&t.transferred),
+		Total:       atomic.LoadInt64(&t.total),
+		Done:        isDone,
+		Error:       isError,
+	}
+
+	data, err := jsoniter.ConfigFastest.Marshal(event)
+	if err == nil {
+		_, err = t.writer.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.WithError(err).Debug("cannot report progress")
+	}
+}
+
+// Writer counts written bytes.
+type Writer struct {
+	Writer   io.Writer
+	Reporter *Reporter
+}
+
+func (t *Writer) Write(data []byte) (int, error) {
+	n, err := t.Writer.Write(data)
+	t.Reporter.Add(int64(n))
+	return n, err
+}
+
+// MapAsync is util.MapAsync that reports one unit of progress per finished (or skipped) task.
+func MapAsync(reporter *Reporter, taskCount int, taskProducer func(taskIndex int) (func() error, error)) error {
+	return util.MapAsync(taskCount, func(taskIndex int) (func() error, error) {
+		task, err := taskProducer(taskIndex)
+		if err != nil || task == nil {
+			reporter.Add(1)
+			return task, err
+		}
+
+		return func() error {
+			err := task()
+			reporter.Add(1)
+			return err
+		}, nil
+	})
+}
@@ -0,0 +1,76 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/develar/errors"
+	"github.com/json-iterator/go"
+	. "github.com/onsi/gomega"
+)
+
+func readEvents(g *GomegaWithT, output *bytes.Buffer) []Event {
+	var result []Event
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var event Event
+		g.Expect(jsoniter.ConfigFastest.UnmarshalFromString(line, &event)).NotTo(HaveOccurred())
+		result = append(result, event)
+	}
+	return result
+}
+
+func TestThrottling(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	output := new(bytes.Buffer)
+	reporter := NewReporter(output, "download", "foo", 300)
+	reporter.interval = time.Hour
+	for i := 0; i < 3; i++ {
+		reporter.Add(100)
+	}
+	reporter.Finish(nil)
+	// final event is reported once
+	reporter.Finish(nil)
+
+	g.Expect(readEvents(g, output)).To(Equal([]Event{
+		{Op: "download", Name: "foo", Transferred: 100, Total: 300},
+		{Op: "download", Name: "foo", Transferred: 300, Total: 300, Done: true},
+	}))
+}
+
+func TestMapAsync(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	output := new(bytes.Buffer)
+	reporter := NewReporter(output, "icon", "", 4)
+	err := MapAsync(reporter, 4, func(taskIndex int) (func() error, error) {
+		if taskIndex == 0 {
+			return nil, nil
+		}
+		return func() error {
+			if taskIndex == 3 {
+				return errors.New("test")
+			}
+			return nil
+		}, nil
+	})
+	g.Expect(err).To(HaveOccurred())
+	reporter.Finish(err)
+
+	events := readEvents(g, output)
+	g.Expect(events[len(events)-1]).To(Equal(Event{Op: "icon", Transferred: 4, Total: 4, Done: true, Error: true}))
+}
+
+func TestDisabled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	SetOutput(nil)
+	reporter := Start("archive", "foo.zip", 0)
+	g.Expect(reporter).To(BeNil())
+	// no panic
+	reporter.SetTotal(1)
+	reporter.Add(1)
+	reporter.Finish(nil)
+}
@@ -0,0 +1,415 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/credentials"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// GitHub rejects assets of 2 GiB and larger
+const maxGitHubAssetSize = 2 * 1024 * 1024 * 1024
+
+// delay before the next upload attempt is doubled after each attempt
+var uploadRetryPolicy = util.RetryPolicy{MaxAttempts: 3, InitialDelay: 2 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+type GitHubOptions struct {
+	Owner string
+	Repo  string
+	Tag   string
+
+	ReleaseName  string
+	ReleaseNotes string
+	IsPrerelease bool
+	// by default assets are uploaded only to a draft release
+	IsAllowPublished bool
+
+	Token string
+	// default: https://api.github.com (GitHub Enterprise: https://host/api/v3)
+	ApiUrl string
+
+	Files []string
+}
+
+type gitHubRelease struct {
+	Id int64 `json:"id"`
+	// API url of release
+	Url       string        `json:"url"`
+	TagName   string        `json:"tag_name"`
+	IsDraft   bool          `json:"draft"`
+	UploadUrl string        `json:"upload_url"`
+	Assets    []gitHubAsset `json:"assets"`
+}
+
+type gitHubAsset struct {
+	Id    int64  `json:"id"`
+	Url   string `json:"url"`
+	Name  string `json:"name"`
+	Size  int64  `json:"size"`
+	State string `json:"state"`
+	// sha256:<hex>, not set for assets uploaded before GitHub started to compute digests
+	Digest string `json:"digest"`
+}
+
+type gitHubError struct {
+	StatusCode int
+	Message    string
+}
+
+func (t *gitHubError) Error() string {
+	return fmt.Sprintf("GitHub API error (status %d): %s", t.StatusCode, t.Message)
+}
+
+func ConfigurePublishToGitHubCommand(app *kingpin.Application) {
+	command := app.Command("publish-github", "Publish to GitHub Releases (draft release is created if not exists)")
+	options := GitHubOptions{}
+	command.Flag("owner", "").Required().StringVar(&options.Owner)
+	command.Flag("repo", "").Required().StringVar(&options.Repo)
+	command.Flag("tag", "").Required().StringVar(&options.Tag)
+	command.Flag("release-name", "").StringVar(&options.ReleaseName)
+	command.Flag("release-notes", "").StringVar(&options.ReleaseNotes)
+	command.Flag("prerelease", "").BoolVar(&options.IsPrerelease)
+	command.Flag("allow-published", "Upload to already published release.").BoolVar(&options.IsAllowPublished)
+	command.Flag("token", "The token (default: GH_TOKEN from the credential store or env, GITHUB_TOKEN env).").StringVar(&options.Token)
+	command.Flag("api-url", "").Default("https://api.github.com").Envar("GITHUB_API_URL").StringVar(&options.ApiUrl)
+	command.Flag("file", "").Short('f').Required().StringsVar(&options.Files)
+	isDryRun := command.Flag("dry-run", "write plan (release and assets to upload) as JSON without publishing").Bool()
+	getUploadOptions := configureUploadFlags(command)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		if *isDryRun {
+			plan, err := PlanGitHub(&options)
+			if err != nil {
+				return err
+			}
+			return util.WriteJsonToStdOut(plan)
+		}
+
+		uploadOptions, err := getUploadOptions()
+		if err != nil {
+			return err
+		}
+
+		credentials.Fill(&options.Token, "GH_TOKEN")
+		if len(options.Token) == 0 {
+			options.Token = os.Getenv("GITHUB_TOKEN")
+		}
+
+		publishContext, _ := util.CreateContext()
+		return PublishToGitHub(publishContext, &options, uploadOptions)
+	})
+}
+
+// PlanGitHub checks that files can be uploaded, release is not requested
+func PlanGitHub(options *GitHubOptions) (*PublishPlan, error) {
+	plan := newPublishPlan("github", fmt.Sprintf("%s/%s@%s", options.Owner, options.Repo, options.Tag))
+	for _, file := range options.Files {
+		upload, err := plan.add(file, filepath.Base(file), getMimeType(file))
+		if err != nil {
+			return nil, err
+		}
+		if upload.Size >= maxGitHubAssetSize {
+			return nil, errors.Errorf("%s is too large (%d bytes), GitHub release asset must be smaller than 2 GiB", file, upload.Size)
+		}
+	}
+	return plan, nil
+}
+
+func PublishToGitHub(context context.Context, options *GitHubOptions, uploadOptions *UploadOptions) error {
+	if len(options.Token) == 0 {
+		return errors.New("GitHub token is not specified (GH_TOKEN)")
+	}
+
+	// fail before creating release if some file cannot be uploaded
+	_, err := PlanGitHub(options)
+	if err != nil {
+		return err
+	}
+
+	client := &gitHubClient{
+		context:    context,
+		httpClient: createUploadHttpClient(uploadOptions),
+		apiUrl:     strings.TrimSuffix(options.ApiUrl, "/"),
+		token:      options.Token,
+	}
+	if len(client.apiUrl) == 0 {
+		client.apiUrl = "https://api.github.com"
+	}
+
+	release, err := client.getOrCreateRelease(options)
+	if err != nil {
+		return err
+	}
+
+	// sequential upload, GitHub limits concurrent requests of the same token
+	for _, file := range options.Files {
+		err = client.uploadAsset(release, file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type gitHubClient struct {
+	context    context.Context
+	httpClient *http.Client
+	apiUrl     string
+	token      string
+}
+
+func (t *gitHubClient) repoUrl(options *GitHubOptions) string {
+	return t.apiUrl + "/repos/" + url.PathEscape(options.Owner) + "/" + url.PathEscape(options.Repo)
+}
+
+// draft releases are not returned by /releases/tags/{tag}, so, list of releases is used
+func (t *gitHubClient) getOrCreateRelease(options *GitHubOptions) (*gitHubRelease, error) {
+	var releases []gitHubRelease
+	err := t.request(http.MethodGet, t.repoUrl(options)+"/releases?per_page=100", nil, &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseData := map[string]interface{}{"prerelease": options.IsPrerelease}
+	if len(options.ReleaseName) != 0 {
+		releaseData["name"] = options.ReleaseName
+	}
+	if len(options.ReleaseNotes) != 0 {
+		releaseData["body"] = options.ReleaseNotes
+	}
+
+	for index := range releases {
+		release := &releases[index]
+		if release.TagName != options.Tag {
+			continue
+		}
+
+		if !release.IsDraft && !options.IsAllowPublished {
+			return nil, errors.Errorf("release %s is already published (use --allow-published to upload to published release)", options.Tag)
+		}
+
+		logFields := log.Fields{"tag": options.Tag, "draft": release.IsDraft}
+		if release.IsDraft {
+			var updated gitHubRelease
+			err = t.request(http.MethodPatch, fmt.Sprintf("%s/releases/%d", t.repoUrl(options), release.Id), releaseData, &updated)
+			if err != nil {
+				return nil, err
+			}
+			log.WithFields(logFields).Info("release updated")
+			return &updated, nil
+		}
+
+		log.WithFields(logFields).Info("release exists")
+		return release, nil
+	}
+
+	releaseData["tag_name"] = options.Tag
+	releaseData["draft"] = true
+	if _, ok := releaseData["name"]; !ok {
+		releaseData["name"] = options.Tag
+	}
+
+	var release gitHubRelease
+	err = t.request(http.MethodPost, t.repoUrl(options)+"/releases", releaseData, &release)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("tag", options.Tag).Info("draft release created")
+	return &release, nil
+}
+
+// asset uploaded by previous (interrupted) publish is skipped if digest is the same,
+// asset with different or unknown content (no digest) and incomplete asset are replaced
+func (t *gitHubClient) uploadAsset(release *gitHubRelease, file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := filepath.Base(file)
+	logger := log.WithFields(log.Fields{"file": name, "size": info.Size()})
+	for _, asset := range release.Assets {
+		if asset.Name != name {
+			continue
+		}
+
+		isUploaded, err := isAssetUploaded(&asset, file, info.Size())
+		if err != nil {
+			return err
+		}
+		if isUploaded {
+			logger.Info("asset is already uploaded")
+			reporter := progress.Start("upload", name, info.Size())
+			reporter.Add(info.Size())
+			reporter.Finish(nil)
+			return nil
+		}
+
+		err = t.deleteAsset(&asset)
+		if err != nil {
+			return err
+		}
+	}
+
+	// upload url is a template: https://uploads.github.com/repos/o/r/releases/1/assets{?name,label}
+	uploadUrl := release.UploadUrl
+	if index := strings.IndexByte(uploadUrl, '{'); index >= 0 {
+		uploadUrl = uploadUrl[:index]
+	}
+	uploadUrl += "?name=" + url.QueryEscape(name)
+
+	policy := uploadRetryPolicy
+	policy.IsRetryable = func(err error) bool {
+		apiError, ok := errors.Cause(err).(*gitHubError)
+		return !ok || apiError.StatusCode >= 500 || apiError.StatusCode == http.StatusUnprocessableEntity
+	}
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		logger.WithError(err).WithFields(log.Fields{"attempt": attempt, "delay": delay}).Warn("cannot upload asset, retrying")
+	}
+	err = uploadFile(t.context, name, info.Size(), policy, func(ctx context.Context) error {
+		err := t.doUploadAsset(ctx, uploadUrl, file, info.Size())
+		if apiError, ok := errors.Cause(err).(*gitHubError); ok && apiError.StatusCode == http.StatusUnprocessableEntity {
+			// asset with the same name was created by the failed attempt
+			deleteErr := t.deleteAssetByName(release, name)
+			if deleteErr != nil {
+				return util.NonRetryable(deleteErr)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("asset uploaded")
+	return nil
+}
+
+func isAssetUploaded(asset *gitHubAsset, file string, size int64) (bool, error) {
+	if asset.State != "uploaded" || asset.Size != size || !strings.HasPrefix(asset.Digest, "sha256:") {
+		return false, nil
+	}
+
+	digest, err := fs.HashFile(file, "sha256")
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(strings.TrimPrefix(asset.Digest, "sha256:"), hex.EncodeToString(digest)), nil
+}
+
+// file is streamed (not loaded into memory), so, retry reopens file
+func (t *gitHubClient) doUploadAsset(ctx context.Context, uploadUrl string, file string, size int64) error {
+	reader, err := os.Open(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	request, err := t.newRequest(http.MethodPost, uploadUrl, reader)
+	if err != nil {
+		return err
+	}
+
+	request = request.WithContext(ctx)
+
+	request.ContentLength = size
+	request.Header.Set("Content-Type", getMimeType(file))
+	return t.do(request, nil)
+}
+
+func (t *gitHubClient) deleteAssetByName(release *gitHubRelease, name string) error {
+	var assets []gitHubAsset
+	err := t.request(http.MethodGet, release.Url+"/assets?per_page=100", nil, &assets)
+	if err != nil {
+		return err
+	}
+
+	for index := range assets {
+		if assets[index].Name == name {
+			return t.deleteAsset(&assets[index])
+		}
+	}
+	return nil
+}
+
+func (t *gitHubClient) deleteAsset(asset *gitHubAsset) error {
+	log.WithFields(log.Fields{"file": asset.Name, "state": asset.State}).Debug("delete asset")
+	return t.request(http.MethodDelete, asset.Url, nil, nil)
+}
+
+func (t *gitHubClient) request(method string, requestUrl string, data interface{}, result interface{}) error {
+	var body io.Reader
+	if data != nil {
+		serializedData, err := json.Marshal(data)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		body = bytes.NewReader(serializedData)
+	}
+
+	request, err := t.newRequest(method, requestUrl, body)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return t.do(request, result)
+}
+
+func (t *gitHubClient) newRequest(method string, requestUrl string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, requestUrl, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	request = request.WithContext(t.context)
+	request.Header.Set("Accept", "application/vnd.github.v3+json")
+	request.Header.Set("Authorization", "token "+t.token)
+	request.Header.Set("User-Agent", "app-builder")
+	return request, nil
+}
+
+func (t *gitHubClient) do(request *http.Request, result interface{}) error {
+	response, err := t.httpClient.Do(request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(response.Body)
+
+	if response.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+		var errorResponse struct {
+			Message string `json:"message"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &errorResponse) == nil && len(errorResponse.Message) != 0 {
+			message = errorResponse.Message
+		}
+		return errors.WithStack(&gitHubError{StatusCode: response.StatusCode, Message: message})
+	}
+
+	if result == nil {
+		return nil
+	}
+	return errors.WithStack(json.NewDecoder(response.Body).Decode(result))
+}
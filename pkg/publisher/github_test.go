@@ -0,0 +1,130 @@
+package publisher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPublishToGitHub(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	uploadRetryPolicy.InitialDelay = 0
+
+	dir, err := ioutil.TempDir("", "publish-github")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	files := []string{filepath.Join(dir, "foo.dmg"), filepath.Join(dir, "latest-mac.yml"), filepath.Join(dir, "foo.zip")}
+	for _, file := range files {
+		g.Expect(ioutil.WriteFile(file, []byte("data of "+filepath.Base(file)), 0644)).NotTo(HaveOccurred())
+	}
+
+	dmgHash := sha256.Sum256([]byte("data of foo.dmg"))
+	dmgDigest := hex.EncodeToString(dmgHash[:])
+
+	var mutex sync.Mutex
+	var requests []string
+	uploaded := make(map[string]string)
+	uploadAttempts := 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, request.Method+" "+request.URL.Path)
+		g.Expect(request.Header.Get("Authorization")).To(Equal("token secret"))
+
+		release := map[string]interface{}{
+			"id":         1,
+			"url":        server.URL + "/repos/o/r/releases/1",
+			"tag_name":   "v1.0.0",
+			"draft":      true,
+			"upload_url": server.URL + "/upload/repos/o/r/releases/1/assets{?name,label}",
+			"assets": []map[string]interface{}{
+				// previous publish was interrupted
+				{"id": 10, "url": server.URL + "/repos/o/r/releases/assets/10", "name": "foo.dmg", "size": 15, "state": "uploaded", "digest": "sha256:" + dmgDigest},
+				{"id": 11, "url": server.URL + "/repos/o/r/releases/assets/11", "name": "foo.zip", "size": 3, "state": "starter"},
+				// the same size, but content is unknown
+				{"id": 12, "url": server.URL + "/repos/o/r/releases/assets/12", "name": "latest-mac.yml", "size": 22, "state": "uploaded"},
+			},
+		}
+
+		switch request.Method + " " + request.URL.Path {
+		case "GET /repos/o/r/releases":
+			_ = json.NewEncoder(writer).Encode([]interface{}{})
+		case "POST /repos/o/r/releases":
+			var data map[string]interface{}
+			g.Expect(json.NewDecoder(request.Body).Decode(&data)).NotTo(HaveOccurred())
+			g.Expect(data).To(HaveKeyWithValue("draft", true))
+			g.Expect(data).To(HaveKeyWithValue("name", "v1.0.0"))
+			writer.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(writer).Encode(release)
+		case "DELETE /repos/o/r/releases/assets/11", "DELETE /repos/o/r/releases/assets/12":
+			writer.WriteHeader(http.StatusNoContent)
+		case "POST /upload/repos/o/r/releases/1/assets":
+			uploadAttempts++
+			if uploadAttempts == 1 {
+				writer.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			data, err := ioutil.ReadAll(request.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			name := request.URL.Query().Get("name")
+			uploaded[name] = request.Header.Get("Content-Type") + ": " + string(data)
+			writer.WriteHeader(http.StatusCreated)
+			_, _ = writer.Write([]byte("{}"))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	err = PublishToGitHub(context.Background(), &GitHubOptions{
+		Owner:  "o",
+		Repo:   "r",
+		Tag:    "v1.0.0",
+		Token:  "secret",
+		ApiUrl: server.URL,
+		Files:  files,
+	}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(uploaded).To(Equal(map[string]string{
+		"latest-mac.yml": "application/x-yaml: data of latest-mac.yml",
+		"foo.zip":        "application/zip: data of foo.zip",
+	}))
+	g.Expect(requests).To(ContainElement("DELETE /repos/o/r/releases/assets/11"))
+	g.Expect(requests).To(ContainElement("DELETE /repos/o/r/releases/assets/12"))
+	g.Expect(requests).NotTo(ContainElement("DELETE /repos/o/r/releases/assets/10"))
+	g.Expect(uploadAttempts).To(Equal(3))
+}
+
+func TestPublishToGitHubPublishedRelease(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	file, err := ioutil.TempFile("", "asset")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	g.Expect(file.Close()).NotTo(HaveOccurred())
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte(`[{"id": 1, "tag_name": "v1.0.0", "draft": false}]`))
+	}))
+	defer server.Close()
+
+	err = PublishToGitHub(context.Background(), &GitHubOptions{Owner: "o", Repo: "r", Tag: "v1.0.0", Token: "secret", ApiUrl: server.URL, Files: []string{file.Name()}}, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("release v1.0.0 is already published")))
+}
@@ -0,0 +1,381 @@
+package publisher
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/log-cli"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// HttpPublishConfiguration is passed as JSON on stdin (credentials are not visible in the process list)
+type HttpPublishConfiguration struct {
+	// base url, file is uploaded to url + path + file name
+	Url string `json:"url"`
+	// relative dir (e.g. version), parent collections are created if createDirs is set (WebDAV)
+	Path       string `json:"path"`
+	CreateDirs bool   `json:"createDirs"`
+
+	Files []string `json:"files"`
+
+	// basic auth
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// bearer auth
+	Token   string            `json:"token"`
+	Headers map[string]string `json:"headers"`
+
+	// X-Checksum-Sha256, X-Checksum-Sha1 and X-Checksum-Md5 headers (Artifactory, Nexus)
+	ChecksumHeaders bool `json:"checksumHeaders"`
+
+	// default: 3
+	Attempts int `json:"attempts"`
+	// milliseconds, delay before the second attempt (doubled after each attempt, randomized by 20%), default: 2000
+	RetryDelay int `json:"retryDelay"`
+}
+
+type httpStatusError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Message    string
+}
+
+func (t *httpStatusError) Error() string {
+	return fmt.Sprintf("%s %s failed (status %d): %s", t.Method, t.Url, t.StatusCode, t.Message)
+}
+
+// network errors, server errors and rate limit are retried, other client errors (e.g. 401, 409) are not
+func isRetryableHttpError(err error) bool {
+	if statusError, ok := errors.Cause(err).(*httpStatusError); ok {
+		return statusError.StatusCode >= 500 || statusError.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
+func ConfigurePublishToHttpCommand(app *kingpin.Application) {
+	command := app.Command("publish-http", "Publish to HTTP server (Nexus, Artifactory, WebDAV) using PUT, JSON configuration is read from stdin if configuration file is not specified.")
+	configFile := command.Flag("config", "The configuration file (JSON, JSON5, YAML or TOML).").Short('c').String()
+	isDryRun := command.Flag("dry-run", "write plan (URLs and sizes of files) as JSON without uploading").Bool()
+	getUploadOptions := configureUploadFlags(command)
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration HttpPublishConfiguration
+		if len(*configFile) == 0 {
+			err := json.NewDecoder(os.Stdin).Decode(&configuration)
+			if err != nil {
+				return errors.Wrap(err, "cannot read configuration from stdin")
+			}
+		} else {
+			err := util.LoadConfig(*configFile, &configuration)
+			if err != nil {
+				return err
+			}
+		}
+
+		if *isDryRun {
+			plan, err := PlanHttp(&configuration)
+			if err != nil {
+				return err
+			}
+			return util.WriteJsonToStdOut(plan)
+		}
+
+		log_cli.Redact(configuration.Token)
+		log_cli.Redact(configuration.Password)
+		for name, value := range configuration.Headers {
+			if log_cli.IsSensitiveName(name) {
+				log_cli.Redact(value)
+			}
+		}
+
+		uploadOptions, err := getUploadOptions()
+		if err != nil {
+			return err
+		}
+
+		publishContext, _ := util.CreateContext()
+		return PublishToHttp(publishContext, &configuration, uploadOptions)
+	})
+}
+
+// PlanHttp validates configuration and computes URLs of files, server is not requested
+func PlanHttp(configuration *HttpPublishConfiguration) (*PublishPlan, error) {
+	err := validateHttpConfiguration(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	dirUrl, _ := computeHttpDirUrls(configuration)
+	plan := newPublishPlan("http", dirUrl)
+	for _, file := range configuration.Files {
+		_, err = plan.add(file, dirUrl+url.PathEscape(filepath.Base(file)), getMimeType(file))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func validateHttpConfiguration(configuration *HttpPublishConfiguration) error {
+	baseUrl, err := url.Parse(configuration.Url)
+	if err != nil || len(baseUrl.Host) == 0 {
+		return errors.Errorf("invalid url %q", configuration.Url)
+	}
+	if len(configuration.Files) == 0 {
+		return errors.New("files must be specified")
+	}
+	return nil
+}
+
+// returns URL of the target dir and URLs of collections to create (from the top one to the target dir)
+func computeHttpDirUrls(configuration *HttpPublishConfiguration) (string, []string) {
+	dirUrl := strings.TrimSuffix(configuration.Url, "/") + "/"
+	var parents []string
+	for _, segment := range strings.Split(strings.Trim(filepath.ToSlash(configuration.Path), "/"), "/") {
+		if len(segment) == 0 {
+			continue
+		}
+
+		dirUrl += url.PathEscape(segment) + "/"
+		parents = append(parents, dirUrl)
+	}
+	return dirUrl, parents
+}
+
+func PublishToHttp(context context.Context, configuration *HttpPublishConfiguration, uploadOptions *UploadOptions) error {
+	err := validateHttpConfiguration(configuration)
+	if err != nil {
+		return err
+	}
+
+	publisher := &httpPublisher{
+		context:       context,
+		httpClient:    createUploadHttpClient(uploadOptions),
+		configuration: configuration,
+		retryPolicy:   util.DefaultRetryPolicy(),
+	}
+	publisher.retryPolicy.IsRetryable = isRetryableHttpError
+	if configuration.Attempts > 0 {
+		publisher.retryPolicy.MaxAttempts = configuration.Attempts
+	}
+	publisher.retryPolicy.InitialDelay = 2 * time.Second
+	if configuration.RetryDelay > 0 {
+		publisher.retryPolicy.InitialDelay = time.Duration(configuration.RetryDelay) * time.Millisecond
+	}
+
+	dirUrl, dirUrls := computeHttpDirUrls(configuration)
+	if configuration.CreateDirs {
+		for _, parentUrl := range dirUrls {
+			err = publisher.createDir(parentUrl)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range configuration.Files {
+		err = publisher.upload(file, dirUrl+url.PathEscape(filepath.Base(file)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type httpPublisher struct {
+	context       context.Context
+	httpClient    *http.Client
+	configuration *HttpPublishConfiguration
+
+	retryPolicy util.RetryPolicy
+}
+
+func (t *httpPublisher) upload(file string, fileUrl string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var checksums map[string]string
+	if t.configuration.ChecksumHeaders {
+		checksums, err = computeChecksumHeaders(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	logger := log.WithFields(log.Fields{"file": filepath.Base(file), "url": fileUrl})
+	if len(checksums) != 0 && t.isUploaded(fileUrl, info.Size(), checksums) {
+		logger.Info("file is already uploaded")
+		reporter := progress.Start("upload", filepath.Base(file), info.Size())
+		reporter.Add(info.Size())
+		reporter.Finish(nil)
+		return nil
+	}
+
+	err = uploadFile(t.context, filepath.Base(file), info.Size(), t.createRetryPolicy(logger), func(ctx context.Context) error {
+		reader, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		defer util.Close(reader)
+
+		request, err := t.newRequest(http.MethodPut, fileUrl, reader)
+		if err != nil {
+			return err
+		}
+
+		request = request.WithContext(ctx)
+
+		request.ContentLength = info.Size()
+		if info.Size() == 0 {
+			// otherwise body of unknown length is sent chunked
+			request.Body = http.NoBody
+		}
+		request.Header.Set("Content-Type", getMimeType(file))
+		for name, value := range checksums {
+			request.Header.Set(name, value)
+		}
+		return t.do(request)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Info("uploaded")
+	return nil
+}
+
+// MKCOL of existing collection returns 405 Method Not Allowed
+func (t *httpPublisher) createDir(dirUrl string) error {
+	return t.withRetry(log.WithField("url", dirUrl), func() error {
+		request, err := t.newRequest("MKCOL", dirUrl, nil)
+		if err != nil {
+			return err
+		}
+
+		err = t.do(request)
+		if statusError, ok := errors.Cause(err).(*httpStatusError); ok && statusError.StatusCode == http.StatusMethodNotAllowed {
+			return nil
+		}
+		return err
+	})
+}
+
+// file uploaded by interrupted publish is skipped if server reports the same size and SHA-256 checksum (Artifactory, Nexus)
+func (t *httpPublisher) isUploaded(fileUrl string, size int64, checksums map[string]string) bool {
+	request, err := t.newRequest(http.MethodHead, fileUrl, nil)
+	if err != nil {
+		return false
+	}
+
+	response, err := t.httpClient.Do(request)
+	if err != nil {
+		log.WithError(err).WithField("url", fileUrl).Debug("cannot check uploaded file")
+		return false
+	}
+
+	util.Close(response.Body)
+	return response.StatusCode == http.StatusOK && response.ContentLength == size && strings.EqualFold(response.Header.Get("X-Checksum-Sha256"), checksums["X-Checksum-Sha256"])
+}
+
+func (t *httpPublisher) createRetryPolicy(logger log.Interface) util.RetryPolicy {
+	policy := t.retryPolicy
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		logger.WithError(err).WithFields(log.Fields{"attempt": attempt, "delay": delay}).Warn("request failed, retrying")
+	}
+	return policy
+}
+
+func (t *httpPublisher) withRetry(logger log.Interface, task func() error) error {
+	return util.Retry(t.context, t.createRetryPolicy(logger), func(attempt int) error {
+		return task()
+	})
+}
+
+func (t *httpPublisher) newRequest(method string, requestUrl string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, requestUrl, body)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	request = request.WithContext(t.context)
+	request.Header.Set("User-Agent", "app-builder")
+	for name, value := range t.configuration.Headers {
+		request.Header.Set(name, value)
+	}
+
+	switch {
+	case len(t.configuration.Token) != 0:
+		request.Header.Set("Authorization", "Bearer "+t.configuration.Token)
+	case len(t.configuration.Username) != 0:
+		request.SetBasicAuth(t.configuration.Username, t.configuration.Password)
+	}
+	return request, nil
+}
+
+func (t *httpPublisher) do(request *http.Request) error {
+	response, err := t.httpClient.Do(request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(response.Body)
+
+	if response.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4*1024))
+		return errors.WithStack(&httpStatusError{Method: request.Method, Url: request.URL.String(), StatusCode: response.StatusCode, Message: strings.TrimSpace(string(data))})
+	}
+
+	_, err = io.Copy(ioutil.Discard, response.Body)
+	return errors.WithStack(err)
+}
+
+func computeChecksumHeaders(file string) (map[string]string, error) {
+	hashes := map[string]hash.Hash{
+		"X-Checksum-Sha256": sha256.New(),
+		"X-Checksum-Sha1":   sha1.New(),
+		"X-Checksum-Md5":    md5.New(),
+	}
+
+	reader, err := os.Open(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	writers := make([]io.Writer, 0, len(hashes))
+	for _, h := range hashes {
+		writers = append(writers, h)
+	}
+	_, err = io.Copy(io.MultiWriter(writers...), reader)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := make(map[string]string, len(hashes))
+	for name, h := range hashes {
+		result[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package publisher
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPublishToHttp(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "publish-http")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "Foo Setup.exe")
+	g.Expect(ioutil.WriteFile(file, []byte("data"), 0644)).NotTo(HaveOccurred())
+
+	var mutex sync.Mutex
+	var requests []string
+	var uploadedHeaders http.Header
+	var uploaded string
+	putCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, request.Method+" "+request.URL.EscapedPath())
+		username, password, _ := request.BasicAuth()
+		g.Expect(username + ":" + password).To(Equal("user:pass"))
+
+		switch request.Method {
+		case "MKCOL":
+			if request.URL.Path == "/dav/foo/" {
+				writer.WriteHeader(http.StatusMethodNotAllowed)
+			} else {
+				writer.WriteHeader(http.StatusCreated)
+			}
+		case http.MethodPut:
+			putCount++
+			if putCount == 1 {
+				writer.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			data, err := ioutil.ReadAll(request.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			uploaded = string(data)
+			uploadedHeaders = request.Header
+			writer.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer server.Close()
+
+	err = PublishToHttp(context.Background(), &HttpPublishConfiguration{
+		Url:             server.URL + "/dav/",
+		Path:            "foo/1.0.0",
+		CreateDirs:      true,
+		Files:           []string{file},
+		Username:        "user",
+		Password:        "pass",
+		Headers:         map[string]string{"X-Custom": "custom"},
+		ChecksumHeaders: true,
+		RetryDelay:      1,
+	}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(requests).To(Equal([]string{
+		"MKCOL /dav/foo/",
+		"MKCOL /dav/foo/1.0.0/",
+		// not uploaded yet (checksum is not returned)
+		"HEAD /dav/foo/1.0.0/Foo%20Setup.exe",
+		"PUT /dav/foo/1.0.0/Foo%20Setup.exe",
+		"PUT /dav/foo/1.0.0/Foo%20Setup.exe",
+	}))
+	g.Expect(uploaded).To(Equal("data"))
+	g.Expect(uploadedHeaders.Get("X-Custom")).To(Equal("custom"))
+	g.Expect(uploadedHeaders.Get("Content-Type")).To(Equal("application/octet-stream"))
+	g.Expect(uploadedHeaders.Get("X-Checksum-Sha256")).To(Equal("3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"))
+	g.Expect(uploadedHeaders.Get("X-Checksum-Md5")).To(Equal("8d777f385d3dfec8815d20f7496026dc"))
+}
+
+func TestPublishToHttpClientError(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	file, err := ioutil.TempFile("", "publish-http")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	g.Expect(file.Close()).NotTo(HaveOccurred())
+
+	putCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		putCount++
+		g.Expect(request.Header.Get("Authorization")).To(Equal("Bearer token"))
+		writer.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err = PublishToHttp(context.Background(), &HttpPublishConfiguration{Url: server.URL, Files: []string{file.Name()}, Token: "token", RetryDelay: 1}, nil)
+	g.Expect(err).To(MatchError(ContainSubstring("(status 403)")))
+	// client errors are not retried
+	g.Expect(putCount).To(Equal(1))
+}
+
+func TestPlanHttp(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "publish-http")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "Foo Setup.exe")
+	g.Expect(ioutil.WriteFile(file, []byte("data"), 0644)).NotTo(HaveOccurred())
+
+	plan, err := PlanHttp(&HttpPublishConfiguration{Url: "https://example.com/repo/", Path: "1.0.0", Files: []string{file}})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Target).To(Equal("https://example.com/repo/1.0.0/"))
+	g.Expect(plan.Uploads).To(Equal([]PlannedUpload{{File: file, Destination: "https://example.com/repo/1.0.0/Foo%20Setup.exe", Size: 4, ContentType: "application/octet-stream"}}))
+	g.Expect(plan.Size).To(Equal(int64(4)))
+
+	_, err = PlanHttp(&HttpPublishConfiguration{Url: "https://example.com/repo/", Files: []string{filepath.Join(dir, "missing.exe")}})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,44 @@
+package publisher
+
+import (
+	"os"
+
+	"github.com/develar/errors"
+)
+
+// PublishPlan is written instead of publishing in dry-run mode, server is not requested (so, credentials are not required)
+type PublishPlan struct {
+	// github, s3 or http
+	Provider string `json:"provider"`
+	// release, bucket or base URL
+	Target  string          `json:"target"`
+	Uploads []PlannedUpload `json:"uploads"`
+	// total size of files to upload (estimated work)
+	Size int64 `json:"size"`
+}
+
+type PlannedUpload struct {
+	File string `json:"file"`
+	// asset name, object key or URL
+	Destination string `json:"destination"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+	// for S3 multipart upload only
+	Parts int64 `json:"parts,omitempty"`
+}
+
+func newPublishPlan(provider string, target string) *PublishPlan {
+	return &PublishPlan{Provider: provider, Target: target, Uploads: []PlannedUpload{}}
+}
+
+// file must exist, the same as on publish
+func (t *PublishPlan) add(file string, destination string, contentType string) (*PlannedUpload, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	t.Uploads = append(t.Uploads, PlannedUpload{File: file, Destination: destination, Size: info.Size(), ContentType: contentType})
+	t.Size += info.Size()
+	return &t.Uploads[len(t.Uploads)-1], nil
+}
@@ -2,19 +2,27 @@ package publisher
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
 	"mime"
 	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/develar/app-builder/pkg/log-cli"
+	"github.com/develar/app-builder/pkg/progress"
 	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/app-builder/pkg/util/httpclient"
 	"github.com/develar/errors"
 )
 
@@ -29,6 +37,12 @@ type ObjectOptions struct {
 	acl          *string
 	storageClass *string
 	encryption   *string
+	// KMS key for aws:kms encryption
+	kmsKeyId *string
+
+	// MB, 0 - computed from file size (at least 5 MB, not more than 10000 parts)
+	partSize    *int64
+	concurrency *int
 
 	accessKey *string
 	secretKey *string
@@ -47,13 +61,34 @@ func ConfigurePublishToS3Command(app *kingpin.Application) {
 		acl:          command.Flag("acl", "").String(),
 		storageClass: command.Flag("storageClass", "").String(),
 		encryption:   command.Flag("encryption", "").String(),
+		kmsKeyId:     command.Flag("kmsKeyId", "").String(),
+
+		partSize:    command.Flag("partSize", "The multipart upload part size in MB.").Int64(),
+		concurrency: command.Flag("concurrency", "The number of parts uploaded in parallel.").Default("4").Int(),
 
 		accessKey: command.Flag("accessKey", "").String(),
 		secretKey: command.Flag("secretKey", "").String(),
 	}
 
+	isDryRun := command.Flag("dry-run", "write plan (object key, size and parts) as JSON without uploading").Bool()
+	getUploadOptions := configureUploadFlags(command)
+
 	command.Action(func(context *kingpin.ParseContext) error {
-		err := upload(&options)
+		if *isDryRun {
+			plan, err := planS3Upload(&options)
+			if err != nil {
+				return err
+			}
+			return util.WriteJsonToStdOut(plan)
+		}
+
+		uploadOptions, err := getUploadOptions()
+		if err != nil {
+			return err
+		}
+
+		log_cli.Redact(*options.secretKey)
+		err = upload(&options, uploadOptions)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -104,7 +139,7 @@ func getBucketRegion(awsConfig *aws.Config, bucket *string, context context.Cont
 	return *result.LocationConstraint, nil
 }
 
-func upload(options *ObjectOptions) error {
+func upload(options *ObjectOptions, uploadOptions *UploadOptions) error {
 	publishContext, _ := util.CreateContext()
 
 	httpClient := createHttpClient()
@@ -127,7 +162,7 @@ func upload(options *ObjectOptions) error {
 	case *options.region != "":
 		awsConfig.Region = options.region
 	case *options.endpoint != "":
-		awsConfig.Region = aws.String("us-east-1")
+		awsConfig.Region = aws.String(getEndpointRegion(*options.endpoint))
 	default:
 		// AWS SDK for Go requires region
 		region, err := getBucketRegion(awsConfig, options.bucket, publishContext, httpClient)
@@ -142,44 +177,275 @@ func upload(options *ObjectOptions) error {
 		return errors.WithStack(err)
 	}
 
-	uploader := s3manager.NewUploader(awsSession)
+	// only after session creation - custom CA bundle (AWS_CA_BUNDLE) is loaded by SDK only into http.Transport
+	wrapUploadTransport(httpClient, uploadOptions)
 
 	file, err := os.Open(*options.file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	defer util.Close(file)
+
+	fileInfo, err := file.Stat()
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	uploadInput := s3manager.UploadInput{
-		Bucket:      options.bucket,
-		Key:         options.key,
-		ContentType: aws.String(getMimeType(*options.key)),
-		Body:        file,
+	objectUploader := &s3Uploader{
+		client:  s3.New(awsSession),
+		options: options,
+		file:    file,
+		size:    fileInfo.Size(),
+	}
+
+	reporter := progress.Start("upload", *options.key, fileInfo.Size())
+	partSize := computePartSize(fileInfo.Size(), *options.partSize)
+	if fileInfo.Size() <= partSize {
+		// SDK retries request itself
+		err = objectUploader.putObject(withUploadProgress(publishContext, reporter))
+	} else {
+		err = objectUploader.uploadMultipart(publishContext, partSize, reporter)
 	}
-	if *options.acl != "" {
-		uploadInput.ACL = options.acl
+	reporter.Finish(err)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	if *options.storageClass != "" {
-		uploadInput.StorageClass = options.storageClass
+
+	return nil
+}
+
+type s3Uploader struct {
+	client  *s3.S3
+	options *ObjectOptions
+
+	file *os.File
+	size int64
+}
+
+func (t *s3Uploader) putObject(ctx context.Context) error {
+	input := &s3.PutObjectInput{
+		Bucket:        t.options.bucket,
+		Key:           t.options.key,
+		ContentType:   aws.String(getMimeType(*t.options.key)),
+		ContentLength: aws.Int64(t.size),
+		Body:          io.NewSectionReader(t.file, 0, t.size),
 	}
-	if *options.encryption != "" {
-		uploadInput.ServerSideEncryption = options.encryption
+	if *t.options.acl != "" {
+		input.ACL = t.options.acl
 	}
+	if *t.options.storageClass != "" {
+		input.StorageClass = t.options.storageClass
+	}
+	if *t.options.encryption != "" {
+		input.ServerSideEncryption = t.options.encryption
+	}
+	if *t.options.kmsKeyId != "" {
+		input.SSEKMSKeyId = t.options.kmsKeyId
+	}
+
+	_, err := t.client.PutObjectWithContext(ctx, input)
+	return errors.WithStack(err)
+}
+
+// multipart upload is not aborted on failure, parts uploaded by the interrupted publish are reused (if content is the same)
+func (t *s3Uploader) uploadMultipart(ctx context.Context, partSize int64, reporter *progress.Reporter) error {
+	parts := splitIntoParts(t.size, partSize)
+	uploadId, uploadedParts := t.findIncompleteUpload(ctx, parts)
+	if len(uploadId) == 0 {
+		input := &s3.CreateMultipartUploadInput{
+			Bucket:      t.options.bucket,
+			Key:         t.options.key,
+			ContentType: aws.String(getMimeType(*t.options.key)),
+		}
+		if *t.options.acl != "" {
+			input.ACL = t.options.acl
+		}
+		if *t.options.storageClass != "" {
+			input.StorageClass = t.options.storageClass
+		}
+		if *t.options.encryption != "" {
+			input.ServerSideEncryption = t.options.encryption
+		}
+		if *t.options.kmsKeyId != "" {
+			input.SSEKMSKeyId = t.options.kmsKeyId
+		}
 
-	_, err = uploader.UploadWithContext(publishContext, &uploadInput)
+		output, err := t.client.CreateMultipartUploadWithContext(ctx, input)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		uploadId = *output.UploadId
+	} else {
+		log.WithFields(log.Fields{"key": *t.options.key, "uploadedParts": len(uploadedParts), "parts": len(parts)}).Info("resume multipart upload")
+	}
+
+	completedParts := make([]*s3.CompletedPart, len(parts))
+	policy := uploadRetryPolicy
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		log.WithError(err).WithFields(log.Fields{"key": *t.options.key, "attempt": attempt, "delay": delay}).Warn("cannot upload part, retrying")
+	}
+	isUploaded := func(part uploadPart) bool {
+		eTag, ok := uploadedParts[part.Number]
+		if ok {
+			completedParts[part.Number-1] = &s3.CompletedPart{ETag: aws.String(eTag), PartNumber: aws.Int64(part.Number)}
+		}
+		return ok
+	}
+	err := uploadParts(ctx, parts, *t.options.concurrency, policy, reporter, isUploaded, func(ctx context.Context, part uploadPart) error {
+		output, err := t.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Bucket:        t.options.bucket,
+			Key:           t.options.key,
+			UploadId:      aws.String(uploadId),
+			PartNumber:    aws.Int64(part.Number),
+			ContentLength: aws.Int64(part.Size),
+			Body:          io.NewSectionReader(t.file, part.Offset, part.Size),
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		completedParts[part.Number-1] = &s3.CompletedPart{ETag: output.ETag, PartNumber: aws.Int64(part.Number)}
+		return nil
+	})
+	if err == nil {
+		_, err = t.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          t.options.bucket,
+			Key:             t.options.key,
+			UploadId:        aws.String(uploadId),
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: completedParts},
+		})
+	}
 	if err != nil {
+		log.WithFields(log.Fields{"key": *t.options.key, "uploadId": uploadId}).Warn("multipart upload is not completed, it will be resumed by the next publish")
 		return errors.WithStack(err)
 	}
-
 	return nil
 }
 
-func createHttpClient() *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: util.ProxyFromEnvironmentAndNpm,
-		},
+// returns ETag of uploaded parts by part number, parts with different size or content (MD5 if ETag is MD5) are not returned.
+// Resume is not possible if storage doesn't support listing of multipart uploads or permission is not granted - it is not an error.
+func (t *s3Uploader) findIncompleteUpload(ctx context.Context, parts []uploadPart) (string, map[int64]string) {
+	logger := log.WithField("key", *t.options.key)
+	uploads, err := t.client.ListMultipartUploadsWithContext(ctx, &s3.ListMultipartUploadsInput{
+		Bucket: t.options.bucket,
+		Prefix: t.options.key,
+	})
+	if err != nil {
+		logger.WithError(err).Debug("cannot list multipart uploads, upload is not resumed")
+		return "", nil
+	}
+
+	var upload *s3.MultipartUpload
+	for _, candidate := range uploads.Uploads {
+		if aws.StringValue(candidate.Key) == *t.options.key && (upload == nil || aws.TimeValue(candidate.Initiated).After(aws.TimeValue(upload.Initiated))) {
+			upload = candidate
+		}
+	}
+	if upload == nil {
+		return "", nil
+	}
+
+	uploadId := aws.StringValue(upload.UploadId)
+	result := make(map[int64]string)
+	// ETag of object encrypted by KMS is not MD5 of content
+	isVerifiable := *t.options.encryption != "aws:kms"
+	isPartSizeChanged := false
+	err = t.client.ListPartsPagesWithContext(ctx, &s3.ListPartsInput{Bucket: t.options.bucket, Key: t.options.key, UploadId: upload.UploadId}, func(output *s3.ListPartsOutput, isLastPage bool) bool {
+		for _, uploadedPart := range output.Parts {
+			number := aws.Int64Value(uploadedPart.PartNumber)
+			if number < 1 || number > int64(len(parts)) || aws.Int64Value(uploadedPart.Size) != parts[number-1].Size {
+				isPartSizeChanged = true
+				return false
+			}
+
+			eTag := aws.StringValue(uploadedPart.ETag)
+			if isVerifiable {
+				digest, err := computePartMd5(t.file, parts[number-1])
+				if err != nil || strings.Trim(eTag, `"`) != digest {
+					continue
+				}
+			}
+			result[number] = eTag
+		}
+		return true
+	})
+	if err != nil {
+		logger.WithError(err).Debug("cannot list parts, upload is not resumed")
+		return "", nil
+	}
+
+	if isPartSizeChanged {
+		// parts cannot be reused, so, incomplete upload is useless
+		logger.Debug("part size is changed, incomplete multipart upload is aborted")
+		_, err = t.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{Bucket: t.options.bucket, Key: t.options.key, UploadId: upload.UploadId})
+		if err != nil {
+			logger.WithError(err).Debug("cannot abort multipart upload")
+		}
+		return "", nil
 	}
+	return uploadId, result
+}
+
+func computePartMd5(file *os.File, part uploadPart) (string, error) {
+	hash := md5.New()
+	_, err := io.Copy(hash, io.NewSectionReader(file, part.Offset, part.Size))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// bucket region is not requested
+func planS3Upload(options *ObjectOptions) (*PublishPlan, error) {
+	target := "s3://" + *options.bucket
+	if *options.endpoint != "" {
+		target = strings.TrimSuffix(*options.endpoint, "/") + "/" + *options.bucket
+	}
+
+	plan := newPublishPlan("s3", target)
+	upload, err := plan.add(*options.file, *options.key, getMimeType(*options.key))
+	if err != nil {
+		return nil, err
+	}
+
+	// uploader uses single PutObject if file is smaller than part size
+	partSize := computePartSize(upload.Size, *options.partSize)
+	upload.Parts = 1
+	if upload.Size > partSize {
+		upload.Parts = (upload.Size + partSize - 1) / partSize
+	}
+	return plan, nil
+}
+
+// part size is increased for large files because number of parts is limited
+func computePartSize(fileSize int64, partSizeInMb int64) int64 {
+	result := partSizeInMb * 1024 * 1024
+	if minPartSize := (fileSize + s3manager.MaxUploadParts - 1) / s3manager.MaxUploadParts; result < minPartSize {
+		result = minPartSize
+	}
+	if result < s3manager.MinUploadPartSize {
+		result = s3manager.MinUploadPartSize
+	}
+	return result
+}
+
+// DigitalOcean Spaces endpoint contains region (nyc3.digitaloceanspaces.com),
+// Google Cloud Storage (storage.googleapis.com, interoperable mode) and other S3 compatible storages accept us-east-1
+func getEndpointRegion(endpoint string) string {
+	host := endpoint
+	if index := strings.Index(host, "://"); index >= 0 {
+		host = host[index+3:]
+	}
+	host = strings.SplitN(host, "/", 2)[0]
+
+	if strings.HasSuffix(host, ".digitaloceanspaces.com") {
+		return strings.Split(host, ".")[0]
+	}
+	return "us-east-1"
+}
+
+func createHttpClient() *http.Client {
+	return httpclient.NewClient()
 }
 
 func getMimeType(key string) string {
@@ -195,6 +461,10 @@ func getMimeType(key string) string {
 	if strings.HasSuffix(key, ".blockmap") {
 		return "application/gzip"
 	}
+	if strings.HasSuffix(key, ".yml") {
+		// update info, system mime types are not reliable for yaml
+		return "application/x-yaml"
+	}
 	if strings.HasSuffix(key, ".snap") {
 		return "application/vnd.snap"
 	}
@@ -0,0 +1,106 @@
+package publisher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/develar/app-builder/pkg/progress"
+	. "github.com/onsi/gomega"
+)
+
+func TestComputePartSize(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(computePartSize(100, 0)).To(Equal(int64(5 * 1024 * 1024)))
+	g.Expect(computePartSize(100, 16)).To(Equal(int64(16 * 1024 * 1024)))
+	// 100 GB file cannot be uploaded by 10000 parts of 5 MB
+	g.Expect(computePartSize(100*1024*1024*1024, 0)).To(Equal(int64(10737419)))
+}
+
+func TestGetEndpointRegion(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(getEndpointRegion("https://nyc3.digitaloceanspaces.com")).To(Equal("nyc3"))
+	g.Expect(getEndpointRegion("https://storage.googleapis.com")).To(Equal("us-east-1"))
+	g.Expect(getEndpointRegion("http://127.0.0.1:9000/")).To(Equal("us-east-1"))
+}
+
+func TestUploadToS3CompatibleStorage(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	file, err := ioutil.TempFile("", "publish-s3")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("data")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file.Close()).NotTo(HaveOccurred())
+
+	var mutex sync.Mutex
+	var uploadedHeaders http.Header
+	var uploadedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		uploadedPath = request.Method + " " + request.URL.Path
+		uploadedHeaders = request.Header
+	}))
+	defer server.Close()
+
+	progressOutput := new(bytes.Buffer)
+	progress.SetOutput(progressOutput)
+	defer progress.SetOutput(nil)
+
+	err = upload(&ObjectOptions{
+		file:         aws.String(file.Name()),
+		endpoint:     aws.String(server.URL),
+		region:       aws.String(""),
+		bucket:       aws.String("bucket"),
+		key:          aws.String("foo/latest.yml"),
+		acl:          aws.String("public-read"),
+		storageClass: aws.String("REDUCED_REDUNDANCY"),
+		encryption:   aws.String("aws:kms"),
+		kmsKeyId:     aws.String("key"),
+		partSize:     aws.Int64(0),
+		concurrency:  aws.Int(2),
+		accessKey:    aws.String("access"),
+		secretKey:    aws.String("secret"),
+	}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(uploadedPath).To(Equal("PUT /bucket/foo/latest.yml"))
+	g.Expect(uploadedHeaders.Get("Content-Type")).To(Equal("application/x-yaml"))
+	g.Expect(uploadedHeaders.Get("X-Amz-Acl")).To(Equal("public-read"))
+	g.Expect(uploadedHeaders.Get("X-Amz-Storage-Class")).To(Equal("REDUCED_REDUNDANCY"))
+	g.Expect(uploadedHeaders.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")).To(Equal("key"))
+	g.Expect(uploadedHeaders.Get("Authorization")).To(ContainSubstring("/us-east-1/s3/"))
+
+	lines := strings.Split(strings.TrimSpace(progressOutput.String()), "\n")
+	g.Expect(lines[len(lines)-1]).To(Equal(`{"op":"upload","name":"foo/latest.yml","transferred":4,"total":4,"done":true}`))
+}
+
+func TestPlanS3Upload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	file, err := ioutil.TempFile("", "publish-s3")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	g.Expect(file.Truncate(12 * 1024 * 1024)).To(Succeed())
+	g.Expect(file.Close()).To(Succeed())
+
+	empty := ""
+	partSize := int64(0)
+	plan, err := planS3Upload(&ObjectOptions{file: aws.String(file.Name()), bucket: aws.String("bucket"), key: aws.String("1.0.0/app.zip"), endpoint: &empty, partSize: &partSize})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plan.Target).To(Equal("s3://bucket"))
+	g.Expect(plan.Uploads).To(HaveLen(1))
+	g.Expect(plan.Uploads[0].Destination).To(Equal("1.0.0/app.zip"))
+	g.Expect(plan.Uploads[0].ContentType).To(Equal("application/zip"))
+	g.Expect(plan.Uploads[0].Parts).To(Equal(int64(3)))
+}
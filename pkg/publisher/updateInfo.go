@@ -0,0 +1,345 @@
+package publisher
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+	"github.com/json-iterator/go"
+	"gopkg.in/yaml.v2"
+)
+
+// UpdateInfo is the update feed (latest.yml) read by electron-updater
+type UpdateInfo struct {
+	Version string           `yaml:"version"`
+	Files   []UpdateFileInfo `yaml:"files"`
+
+	// deprecated (electron-updater < 4), equal to the first file
+	Path   string `yaml:"path"`
+	Sha512 string `yaml:"sha512"`
+
+	IsAdminRightsRequired bool   `yaml:"isAdminRightsRequired,omitempty"`
+	ReleaseName           string `yaml:"releaseName,omitempty"`
+	ReleaseNotes          string `yaml:"releaseNotes,omitempty"`
+	ReleaseDate           string `yaml:"releaseDate"`
+	StagingPercentage     *int   `yaml:"stagingPercentage,omitempty"`
+}
+
+type UpdateFileInfo struct {
+	Url    string `yaml:"url"`
+	Sha512 string `yaml:"sha512"`
+	Size   int64  `yaml:"size"`
+	// size of block map embedded into file (AppImage)
+	BlockMapSize int64 `yaml:"blockMapSize,omitempty"`
+}
+
+type UpdateInfoConfiguration struct {
+	Version string `json:"version"`
+	// windows, mac or linux
+	Platform string `json:"platform"`
+	// linux only, feed of not x64 arch has arch suffix (latest-linux-arm64.yml)
+	Arch string `json:"arch"`
+	// default: prerelease id of version (1.0.0-beta.1 - beta) or latest
+	Channel string `json:"channel"`
+	// whether to write feed also for less stable channels (release is suitable for beta and alpha users)
+	IsAllChannels bool `json:"allChannels"`
+
+	Files []UpdateFileConfiguration `json:"files"`
+
+	IsAdminRightsRequired bool   `json:"isAdminRightsRequired"`
+	ReleaseName           string `json:"releaseName"`
+	ReleaseNotes          string `json:"releaseNotes"`
+	// ISO 8601, default: current time
+	ReleaseDate       string `json:"releaseDate"`
+	StagingPercentage *int   `json:"stagingPercentage"`
+
+	OutputDir string `json:"outputDir"`
+}
+
+type UpdateFileConfiguration struct {
+	File string `json:"file"`
+	// default: file name
+	Url          string `json:"url"`
+	BlockMapSize int64  `json:"blockMapSize"`
+}
+
+type UpdateInfoFile struct {
+	Channel string `json:"channel"`
+	File    string `json:"file"`
+}
+
+// channels sorted by stability, feed of more stable channel is also written for less stable ones
+var channels = []string{"alpha", "beta", "latest"}
+
+var versionRegExp = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+func ConfigureUpdateInfoCommand(app *kingpin.Application) {
+	command := app.Command("update-info", "Generate update feed (latest.yml, latest-mac.yml, latest-linux.yml) for built artifacts.")
+	jsonConfig := command.Flag("configuration", "The configuration (JSON).").Short('c').String()
+	configFile := command.Flag("configuration-file", "The configuration file (JSON, JSON5, YAML or TOML), used instead of --configuration.").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		var configuration UpdateInfoConfiguration
+		var err error
+		switch {
+		case len(*configFile) != 0:
+			err = util.LoadConfig(*configFile, &configuration)
+			if err != nil {
+				return err
+			}
+		case len(*jsonConfig) != 0:
+			err = jsoniter.UnmarshalFromString(*jsonConfig, &configuration)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		default:
+			return errors.New("--configuration or --configuration-file must be specified")
+		}
+
+		result, err := WriteUpdateInfo(&configuration)
+		if err != nil {
+			return err
+		}
+		return util.WriteJsonToStdOut(result)
+	})
+
+	validateCommand := app.Command("validate-update-info", "Validate update feed file.")
+	file := validateCommand.Flag("file", "").Short('f').Required().String()
+	validateCommand.Action(func(context *kingpin.ParseContext) error {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = ParseUpdateInfo(data)
+		if err != nil {
+			return errors.Wrapf(err, "invalid update info %s", *file)
+		}
+		return nil
+	})
+}
+
+// WriteUpdateInfo computes size and sha512 of files and writes feed of each channel to output dir
+func WriteUpdateInfo(configuration *UpdateInfoConfiguration) ([]UpdateInfoFile, error) {
+	suffix, err := getFeedSuffix(configuration.Platform, configuration.Arch)
+	if err != nil {
+		return nil, err
+	}
+	if len(configuration.Files) == 0 {
+		return nil, errors.New("files must be specified")
+	}
+
+	info, err := CreateUpdateInfo(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(info)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// rendered feed is validated to not publish feed that electron-updater cannot read
+	_, err = ParseUpdateInfo(data)
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir := configuration.OutputDir
+	if len(outputDir) == 0 {
+		outputDir = filepath.Dir(configuration.Files[0].File)
+	}
+	err = fsutil.EnsureDir(outputDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var result []UpdateInfoFile
+	for _, channel := range getChannels(configuration) {
+		file := filepath.Join(outputDir, channel+suffix+".yml")
+		err = fs.WriteFileAtomic(file, data, 0644)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, UpdateInfoFile{Channel: channel, File: file})
+	}
+
+	log.WithFields(log.Fields{"version": info.Version, "files": len(result)}).Info("update info created")
+	return result, nil
+}
+
+func CreateUpdateInfo(configuration *UpdateInfoConfiguration) (*UpdateInfo, error) {
+	files := make([]UpdateFileInfo, len(configuration.Files))
+	err := util.MapAsync(len(configuration.Files), func(taskIndex int) (func() error, error) {
+		fileConfiguration := configuration.Files[taskIndex]
+		return func() error {
+			sha512Hash, size, err := computeSha512(fileConfiguration.File)
+			if err != nil {
+				return err
+			}
+
+			url := fileConfiguration.Url
+			if len(url) == 0 {
+				url = filepath.Base(fileConfiguration.File)
+			}
+			files[taskIndex] = UpdateFileInfo{Url: url, Sha512: sha512Hash, Size: size, BlockMapSize: fileConfiguration.BlockMapSize}
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	releaseDate := configuration.ReleaseDate
+	if len(releaseDate) == 0 {
+		releaseDate = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+
+	return &UpdateInfo{
+		Version:               strings.TrimPrefix(configuration.Version, "v"),
+		Files:                 files,
+		Path:                  files[0].Url,
+		Sha512:                files[0].Sha512,
+		IsAdminRightsRequired: configuration.IsAdminRightsRequired,
+		ReleaseName:           configuration.ReleaseName,
+		ReleaseNotes:          configuration.ReleaseNotes,
+		ReleaseDate:           releaseDate,
+		StagingPercentage:     configuration.StagingPercentage,
+	}, nil
+}
+
+// ParseUpdateInfo parses and validates update feed (unknown fields are not allowed)
+func ParseUpdateInfo(data []byte) (*UpdateInfo, error) {
+	var info UpdateInfo
+	err := yaml.UnmarshalStrict(data, &info)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &info, info.validate()
+}
+
+func (t *UpdateInfo) validate() error {
+	if !versionRegExp.MatchString(t.Version) {
+		return errors.Errorf("version %q is not a valid semver", t.Version)
+	}
+	if len(t.Files) == 0 {
+		return errors.New("files must be not empty")
+	}
+
+	for _, file := range t.Files {
+		if len(file.Url) == 0 {
+			return errors.New("file url must be specified")
+		}
+		if file.Size <= 0 {
+			return errors.Errorf("size of %s must be positive", file.Url)
+		}
+		err := validateSha512(file.Sha512)
+		if err != nil {
+			return errors.Wrapf(err, "invalid sha512 of %s", file.Url)
+		}
+	}
+
+	if t.Path != t.Files[0].Url || t.Sha512 != t.Files[0].Sha512 {
+		return errors.New("path and sha512 must be equal to the first file")
+	}
+
+	_, err := time.Parse(time.RFC3339, t.ReleaseDate)
+	if err != nil {
+		return errors.Errorf("release date %q is not ISO 8601", t.ReleaseDate)
+	}
+
+	if t.StagingPercentage != nil && (*t.StagingPercentage < 0 || *t.StagingPercentage > 100) {
+		return errors.Errorf("staging percentage %d is not in range 0..100", *t.StagingPercentage)
+	}
+	return nil
+}
+
+func validateSha512(value string) error {
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return errors.New("not base64")
+	}
+	if len(data) != sha512.Size {
+		return errors.Errorf("length is %d bytes, expected %d", len(data), sha512.Size)
+	}
+	return nil
+}
+
+func getFeedSuffix(platform string, arch string) (string, error) {
+	switch platform {
+	case "windows", "win32", "win":
+		return "", nil
+	case "mac", "darwin":
+		return "-mac", nil
+	case "linux":
+		if len(arch) == 0 || arch == "x64" {
+			return "-linux", nil
+		}
+		return "-linux-" + arch, nil
+	default:
+		return "", errors.Errorf("unsupported platform %q (windows, mac or linux expected)", platform)
+	}
+}
+
+func getChannels(configuration *UpdateInfoConfiguration) []string {
+	channel := configuration.Channel
+	if len(channel) == 0 {
+		channel = getVersionChannel(configuration.Version)
+	}
+
+	if !configuration.IsAllChannels {
+		return []string{channel}
+	}
+
+	for index, name := range channels {
+		if name == channel {
+			return channels[:index+1]
+		}
+	}
+	// custom channel
+	return []string{channel}
+}
+
+// 1.0.0-beta.1 - beta, 1.0.0 - latest
+func getVersionChannel(version string) string {
+	index := strings.IndexByte(version, '-')
+	if index < 0 {
+		return "latest"
+	}
+
+	prerelease := version[index+1:]
+	if end := strings.IndexAny(prerelease, ".+"); end >= 0 {
+		prerelease = prerelease[:end]
+	}
+	if len(prerelease) == 0 {
+		return "latest"
+	}
+	return strings.ToLower(prerelease)
+}
+
+func computeSha512(file string) (string, int64, error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	hash := sha512.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil)), size, nil
+}
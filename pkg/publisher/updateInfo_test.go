@@ -0,0 +1,75 @@
+package publisher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteUpdateInfo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "update-info")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	installer := filepath.Join(dir, "Foo Setup 1.0.0.exe")
+	g.Expect(ioutil.WriteFile(installer, []byte("installer"), 0644)).NotTo(HaveOccurred())
+
+	stagingPercentage := 50
+	result, err := WriteUpdateInfo(&UpdateInfoConfiguration{
+		Version:           "1.0.0-beta.2",
+		Platform:          "windows",
+		IsAllChannels:     true,
+		Files:             []UpdateFileConfiguration{{File: installer}},
+		ReleaseDate:       "2019-01-02T03:04:05.000Z",
+		StagingPercentage: &stagingPercentage,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result).To(Equal([]UpdateInfoFile{
+		{Channel: "alpha", File: filepath.Join(dir, "alpha.yml")},
+		{Channel: "beta", File: filepath.Join(dir, "beta.yml")},
+	}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "beta.yml"))
+	g.Expect(err).NotTo(HaveOccurred())
+	sha512 := "t3/i2G+8W9EW1qBz60R+dqdK3T+g0LgB+XU1ljJBvjzc4dvK7WA7ePAg0IRbLUv8iSzrKn0cjx2Yq8SBLvWvIQ=="
+	g.Expect(string(data)).To(Equal(`version: 1.0.0-beta.2
+files:
+- url: Foo Setup 1.0.0.exe
+  sha512: ` + sha512 + `
+  size: 9
+path: Foo Setup 1.0.0.exe
+sha512: ` + sha512 + `
+releaseDate: "2019-01-02T03:04:05.000Z"
+stagingPercentage: 50
+`))
+}
+
+func TestFeedName(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	suffix, err := getFeedSuffix("linux", "arm64")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(suffix).To(Equal("-linux-arm64"))
+	suffix, err = getFeedSuffix("mac", "arm64")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(suffix).To(Equal("-mac"))
+
+	g.Expect(getChannels(&UpdateInfoConfiguration{Version: "1.0.0", IsAllChannels: true})).To(Equal([]string{"alpha", "beta", "latest"}))
+	g.Expect(getChannels(&UpdateInfoConfiguration{Version: "1.0.0-alpha.1", IsAllChannels: true})).To(Equal([]string{"alpha"}))
+	g.Expect(getChannels(&UpdateInfoConfiguration{Version: "1.0.0-rc.1"})).To(Equal([]string{"rc"}))
+}
+
+func TestParseUpdateInfo(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, err := ParseUpdateInfo([]byte("version: 1.0.0\nfiles:\n- url: a.exe\n  sha512: abc\n  size: 1\npath: a.exe\nsha512: abc\nreleaseDate: '2019-01-02T03:04:05.000Z'\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("invalid sha512 of a.exe")))
+
+	_, err = ParseUpdateInfo([]byte("version: 1.0.0\nfile: a.exe\n"))
+	g.Expect(err).To(MatchError(ContainSubstring("field file not found")))
+}
@@ -0,0 +1,273 @@
+package publisher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/app-builder/pkg/util/httpclient"
+	"github.com/develar/errors"
+)
+
+// UploadOptions are common for all publishers
+type UploadOptions struct {
+	// bytes per second, 0 - not limited
+	Throttle int64
+}
+
+func configureUploadFlags(command *kingpin.CmdClause) func() (*UploadOptions, error) {
+	throttle := command.Flag("throttle", "The upload bandwidth limit per second (e.g. 512K, 2M), not limited by default.").Envar("APP_BUILDER_UPLOAD_THROTTLE").String()
+	return func() (*UploadOptions, error) {
+		bytesPerSecond, err := parseBandwidth(*throttle)
+		if err != nil {
+			return nil, err
+		}
+		return &UploadOptions{Throttle: bytesPerSecond}, nil
+	}
+}
+
+// number of bytes with optional K, M or G suffix (binary)
+func parseBandwidth(value string) (int64, error) {
+	value = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch value[len(value)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+
+	result, err := strconv.ParseFloat(value, 64)
+	if err != nil || result < 0 {
+		return 0, errors.Errorf("invalid bandwidth %q, number of bytes with optional K, M or G suffix is expected", value)
+	}
+	return int64(result * float64(multiplier)), nil
+}
+
+// createUploadHttpClient returns client that limits bandwidth of request bodies and reports sent bytes to the progress reporter of request context
+func createUploadHttpClient(options *UploadOptions) *http.Client {
+	client := httpclient.NewClient()
+	wrapUploadTransport(client, options)
+	return client
+}
+
+func wrapUploadTransport(client *http.Client, options *UploadOptions) {
+	var limiter *bandwidthLimiter
+	if options != nil && options.Throttle > 0 {
+		limiter = newBandwidthLimiter(options.Throttle)
+	}
+	client.Transport = &uploadTransport{transport: client.Transport, limiter: limiter}
+}
+
+type uploadProgressKey struct{}
+
+// withUploadProgress returns context to pass to requests, bytes sent by failed request are subtracted (so, progress is correct on retry)
+func withUploadProgress(ctx context.Context, reporter *progress.Reporter) context.Context {
+	if reporter == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, uploadProgressKey{}, reporter)
+}
+
+type uploadTransport struct {
+	transport http.RoundTripper
+	// nil if not limited
+	limiter *bandwidthLimiter
+}
+
+func (t *uploadTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.Body == nil || request.Body == http.NoBody {
+		return t.transport.RoundTrip(request)
+	}
+
+	reporter, _ := request.Context().Value(uploadProgressKey{}).(*progress.Reporter)
+	if reporter == nil && t.limiter == nil {
+		return t.transport.RoundTrip(request)
+	}
+
+	var bodies []*uploadBody
+	wrap := func(body io.ReadCloser) io.ReadCloser {
+		result := &uploadBody{body: body, context: request.Context(), limiter: t.limiter, reporter: reporter}
+		bodies = append(bodies, result)
+		return result
+	}
+
+	// round tripper must not modify request
+	clone := *request
+	clone.Body = wrap(request.Body)
+	if request.GetBody != nil {
+		clone.GetBody = func() (io.ReadCloser, error) {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			return wrap(body), nil
+		}
+	}
+
+	response, err := t.transport.RoundTrip(&clone)
+	if err != nil || response.StatusCode >= 300 {
+		for _, body := range bodies {
+			body.rollback()
+		}
+	}
+	return response, err
+}
+
+type uploadBody struct {
+	body     io.ReadCloser
+	context  context.Context
+	limiter  *bandwidthLimiter
+	reporter *progress.Reporter
+
+	sent         int64
+	isRolledBack int32
+}
+
+func (t *uploadBody) Read(data []byte) (int, error) {
+	if t.limiter != nil {
+		if len(data) > t.limiter.burst {
+			data = data[:t.limiter.burst]
+		}
+		err := t.limiter.wait(t.context, len(data))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := t.body.Read(data)
+	if n > 0 && atomic.LoadInt32(&t.isRolledBack) == 0 {
+		atomic.AddInt64(&t.sent, int64(n))
+		t.reporter.Add(int64(n))
+	}
+	return n, err
+}
+
+func (t *uploadBody) Close() error {
+	return t.body.Close()
+}
+
+func (t *uploadBody) rollback() {
+	if atomic.CompareAndSwapInt32(&t.isRolledBack, 0, 1) {
+		t.reporter.Add(-atomic.LoadInt64(&t.sent))
+	}
+}
+
+// bandwidthLimiter is shared by all concurrent requests, so, limit is applied to the total upload bandwidth
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	// max bytes read at once, to avoid bursts
+	burst int
+
+	mutex sync.Mutex
+	// time when the next read is allowed
+	next time.Time
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	burst := bytesPerSecond / 10
+	if burst < 1024 {
+		burst = 1024
+	}
+	if burst > 64*1024 {
+		burst = 64 * 1024
+	}
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond, burst: int(burst)}
+}
+
+// wait reserves time slot to send count bytes and waits until it starts
+func (t *bandwidthLimiter) wait(ctx context.Context, count int) error {
+	t.mutex.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(int64(count) * int64(time.Second) / t.bytesPerSecond))
+	t.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// uploadFile reports progress of the file upload (bytes sent by failed attempts are not counted), upload is retried according to the policy
+func uploadFile(ctx context.Context, name string, size int64, policy util.RetryPolicy, upload func(ctx context.Context) error) error {
+	reporter := progress.Start("upload", name, size)
+	ctx = withUploadProgress(ctx, reporter)
+	err := util.Retry(ctx, policy, func(attempt int) error {
+		return upload(ctx)
+	})
+	reporter.Finish(err)
+	return err
+}
+
+// uploadPart is a range of file uploaded by one request
+type uploadPart struct {
+	// 1-based
+	Number int64
+	Offset int64
+	Size   int64
+}
+
+// the last part can be smaller
+func splitIntoParts(size int64, partSize int64) []uploadPart {
+	var result []uploadPart
+	for offset := int64(0); offset < size; offset += partSize {
+		part := uploadPart{Number: int64(len(result) + 1), Offset: offset, Size: partSize}
+		if offset+partSize > size {
+			part.Size = size - offset
+		}
+		result = append(result, part)
+	}
+	return result
+}
+
+// uploadParts uploads parts concurrently, part is skipped if isUploaded returns true (resume of interrupted upload).
+// Every part is retried according to the policy, progress of skipped parts is reported at once.
+func uploadParts(ctx context.Context, parts []uploadPart, concurrency int, policy util.RetryPolicy, reporter *progress.Reporter, isUploaded func(part uploadPart) bool, upload func(ctx context.Context, part uploadPart) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx = withUploadProgress(ctx, reporter)
+	return util.MapAsyncConcurrency(len(parts), concurrency, func(taskIndex int) (func() error, error) {
+		part := parts[taskIndex]
+		if isUploaded != nil && isUploaded(part) {
+			reporter.Add(part.Size)
+			return nil, nil
+		}
+
+		return func() error {
+			return util.Retry(ctx, policy, func(attempt int) error {
+				return upload(ctx, part)
+			})
+		}, nil
+	})
+}
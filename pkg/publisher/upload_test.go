@@ -0,0 +1,156 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(parseBandwidth("")).To(Equal(int64(0)))
+	g.Expect(parseBandwidth("1000")).To(Equal(int64(1000)))
+	g.Expect(parseBandwidth("512K")).To(Equal(int64(512 * 1024)))
+	g.Expect(parseBandwidth("1.5mb")).To(Equal(int64(1536 * 1024)))
+
+	_, err := parseBandwidth("fast")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSplitIntoParts(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	g.Expect(splitIntoParts(25, 10)).To(Equal([]uploadPart{{Number: 1, Offset: 0, Size: 10}, {Number: 2, Offset: 10, Size: 10}, {Number: 3, Offset: 20, Size: 5}}))
+	g.Expect(splitIntoParts(20, 10)).To(HaveLen(2))
+}
+
+func TestUploadFileProgressAndThrottle(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	attempt := 0
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = ioutil.ReadAll(request.Body)
+		attempt++
+		if attempt == 1 {
+			writer.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	progressOutput := new(bytes.Buffer)
+	progress.SetOutput(progressOutput)
+	defer progress.SetOutput(nil)
+
+	data := bytes.Repeat([]byte("a"), 4096)
+	client := createUploadHttpClient(&UploadOptions{Throttle: 16 * 1024})
+	start := time.Now()
+	err := uploadFile(context.Background(), "file", int64(len(data)), util.RetryPolicy{MaxAttempts: 2}, func(ctx context.Context) error {
+		request, err := http.NewRequest(http.MethodPut, server.URL, bytes.NewReader(data))
+		g.Expect(err).NotTo(HaveOccurred())
+		response, err := client.Do(request.WithContext(ctx))
+		g.Expect(err).NotTo(HaveOccurred())
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", response.StatusCode)
+		}
+		return nil
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(attempt).To(Equal(2))
+	// 8 KB are sent (two attempts), the first 1.6 KB are not delayed
+	g.Expect(time.Since(start)).To(BeNumerically(">=", 350*time.Millisecond))
+
+	// bytes of the failed attempt are not counted
+	lines := strings.Split(strings.TrimSpace(progressOutput.String()), "\n")
+	g.Expect(lines[len(lines)-1]).To(Equal(`{"op":"upload","name":"file","transferred":4096,"total":4096,"done":true}`))
+}
+
+func TestResumeS3MultipartUpload(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	const partSize = 5 * 1024 * 1024
+	file, err := ioutil.TempFile("", "publish-s3")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file.Name())
+	firstPart := bytes.Repeat([]byte("a"), partSize)
+	_, err = file.Write(append(firstPart, []byte("rest")...))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(file.Close()).To(Succeed())
+
+	firstPartMd5 := md5.Sum(firstPart)
+
+	var mutex sync.Mutex
+	var requests []string
+	var completeBody string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		query := request.URL.Query()
+		requests = append(requests, request.Method+" "+request.URL.Path+" "+query.Get("partNumber"))
+		switch {
+		case request.Method == http.MethodGet && query["uploads"] != nil:
+			_, _ = writer.Write([]byte(`<ListMultipartUploadsResult><Bucket>bucket</Bucket><Upload><Key>app.zip</Key><UploadId>id1</UploadId><Initiated>2019-01-01T00:00:00.000Z</Initiated></Upload></ListMultipartUploadsResult>`))
+		case request.Method == http.MethodGet:
+			g.Expect(query.Get("uploadId")).To(Equal("id1"))
+			_, _ = fmt.Fprintf(writer, `<ListPartsResult><Bucket>bucket</Bucket><Key>app.zip</Key><UploadId>id1</UploadId><IsTruncated>false</IsTruncated><Part><PartNumber>1</PartNumber><ETag>"%s"</ETag><Size>%d</Size></Part></ListPartsResult>`, hex.EncodeToString(firstPartMd5[:]), partSize)
+		case request.Method == http.MethodPut:
+			data, err := ioutil.ReadAll(request.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(data)).To(Equal("rest"))
+			writer.Header().Set("ETag", `"etag2"`)
+		case request.Method == http.MethodPost:
+			data, err := ioutil.ReadAll(request.Body)
+			g.Expect(err).NotTo(HaveOccurred())
+			completeBody = string(data)
+			_, _ = writer.Write([]byte(`<CompleteMultipartUploadResult><Key>app.zip</Key></CompleteMultipartUploadResult>`))
+		}
+	}))
+	defer server.Close()
+
+	progressOutput := new(bytes.Buffer)
+	progress.SetOutput(progressOutput)
+	defer progress.SetOutput(nil)
+
+	empty := ""
+	err = upload(&ObjectOptions{
+		file:         aws.String(file.Name()),
+		endpoint:     aws.String(server.URL),
+		region:       &empty,
+		bucket:       aws.String("bucket"),
+		key:          aws.String("app.zip"),
+		acl:          &empty,
+		storageClass: &empty,
+		encryption:   &empty,
+		kmsKeyId:     &empty,
+		partSize:     aws.Int64(0),
+		concurrency:  aws.Int(2),
+		accessKey:    aws.String("access"),
+		secretKey:    aws.String("secret"),
+	}, &UploadOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the first part is not uploaded again
+	g.Expect(requests).To(Equal([]string{"GET /bucket ", "GET /bucket/app.zip ", "PUT /bucket/app.zip 2", "POST /bucket/app.zip "}))
+	g.Expect(completeBody).To(ContainSubstring(hex.EncodeToString(firstPartMd5[:])))
+	g.Expect(completeBody).To(ContainSubstring("etag2"))
+
+	lines := strings.Split(strings.TrimSpace(progressOutput.String()), "\n")
+	g.Expect(lines[len(lines)-1]).To(Equal(fmt.Sprintf(`{"op":"upload","name":"app.zip","transferred":%d,"total":%d,"done":true}`, partSize+4, partSize+4)))
+}
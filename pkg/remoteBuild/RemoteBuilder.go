@@ -16,6 +16,7 @@ import (
 	"github.com/apex/log"
 	"github.com/develar/app-builder/pkg/download"
 	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/app-builder/pkg/util/httpclient"
 	"github.com/develar/errors"
 	"github.com/dustin/go-humanize"
 	"github.com/json-iterator/go"
@@ -48,10 +49,8 @@ type RemoteBuilder struct {
 }
 
 func newRemoteBuilder() *RemoteBuilder {
-	transport := &http.Transport{
-		Proxy:           util.ProxyFromEnvironmentAndNpm,
-		TLSClientConfig: getTls(),
-	}
+	transport := httpclient.NewTransport()
+	transport.TLSClientConfig = getTls()
 	return &RemoteBuilder{
 		transport: transport,
 	}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/develar/app-builder/pkg/download"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/icons"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// params mirror flags of the corresponding commands
+func createMethods() map[string]Handler {
+	return map[string]Handler{
+		"ping": func(params json.RawMessage) (interface{}, error) {
+			return "pong", nil
+		},
+		"convert-icon":       convertIcon,
+		"convert-icon-batch": convertIconBatch,
+		"download":           downloadFile,
+		"download-artifact":  downloadArtifact,
+		"copy":               copyFile,
+		"hash":               hashFiles,
+	}
+}
+
+// result is the same as the result of icon-batch job (source image errors are reported in the error field, not as JSON-RPC error)
+func convertIcon(params json.RawMessage) (interface{}, error) {
+	var job icons.IconBatchJob
+	err := DecodeParams(params, &job)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := icons.ConvertIconBatch(util.RootContext(), []icons.IconBatchJob{job})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+func convertIconBatch(params json.RawMessage) (interface{}, error) {
+	var jobs []icons.IconBatchJob
+	err := DecodeParams(params, &jobs)
+	if err != nil {
+		return nil, err
+	}
+	return icons.ConvertIconBatch(util.RootContext(), jobs)
+}
+
+type downloadParams struct {
+	Url    string `json:"url"`
+	Output string `json:"output"`
+	Sha512 string `json:"sha512,omitempty"`
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+func downloadFile(params json.RawMessage) (interface{}, error) {
+	var p downloadParams
+	err := DecodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Url) == 0 || len(p.Output) == 0 {
+		return nil, &paramsError{errors.New("url and output are required")}
+	}
+
+	err = download.NewDownloader().DownloadWithChecksum(p.Url, p.Output, download.Checksum{Sha512: p.Sha512, Sha256: p.Sha256})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"file": p.Output}, nil
+}
+
+type downloadArtifactParams struct {
+	Name   string `json:"name"`
+	Url    string `json:"url,omitempty"`
+	Sha512 string `json:"sha512,omitempty"`
+}
+
+func downloadArtifact(params json.RawMessage) (interface{}, error) {
+	var p downloadArtifactParams
+	err := DecodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Name) == 0 {
+		return nil, &paramsError{errors.New("name is required")}
+	}
+
+	dir, err := download.DownloadArtifact(p.Name, p.Url, p.Sha512)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"dir": dir}, nil
+}
+
+type copyParams struct {
+	From            string `json:"from"`
+	To              string `json:"to"`
+	IsUseHardLinks  bool   `json:"hardLink,omitempty"`
+	IsUseReflink    *bool  `json:"reflink,omitempty"`
+	IsPreserveTimes *bool  `json:"preserveTimes,omitempty"`
+}
+
+// reflink and preserveTimes are true by default (as flags of copy command)
+func copyFile(params json.RawMessage) (interface{}, error) {
+	var p copyParams
+	err := DecodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.From) == 0 || len(p.To) == 0 {
+		return nil, &paramsError{errors.New("from and to are required")}
+	}
+
+	fileCopier := fs.FileCopier{
+		IsUseHardLinks:  p.IsUseHardLinks,
+		IsUseReflink:    p.IsUseReflink == nil || *p.IsUseReflink,
+		IsPreserveTimes: p.IsPreserveTimes == nil || *p.IsPreserveTimes,
+	}
+	return nil, errors.WithStack(fileCopier.CopyDirOrFile(p.From, p.To))
+}
+
+type hashParams struct {
+	Files       []string `json:"files"`
+	Algorithm   string   `json:"algorithm,omitempty"`
+	Encoding    string   `json:"encoding,omitempty"`
+	IsRecursive bool     `json:"recursive,omitempty"`
+}
+
+func hashFiles(params json.RawMessage) (interface{}, error) {
+	var p hashParams
+	err := DecodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Files) == 0 {
+		return nil, &paramsError{errors.New("files are required")}
+	}
+	return fs.HashFiles(p.Files, fs.HashOptions{Algorithm: p.Algorithm, Encoding: p.Encoding, IsRecursive: p.IsRecursive})
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/progress"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	errorCodeParse          = -32700
+	errorCodeInvalidRequest = -32600
+	errorCodeMethodNotFound = -32601
+	errorCodeInvalidParams  = -32602
+	errorCodeInternal       = -32000
+	// error caused by user input (util.MessageError), data contains errorCode
+	errorCodeUser = -32001
+)
+
+// Handler decodes params itself, result is serialized as JSON
+type Handler func(params json.RawMessage) (interface{}, error)
+
+type Server struct {
+	methods map[string]Handler
+
+	writer      io.Writer
+	writerMutex sync.Mutex
+}
+
+type request struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *responseError  `json:"error,omitempty"`
+}
+
+type notification struct {
+	JsonRpc string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type responseError struct {
+	Code    int                    `json:"code"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// params error is reported as invalid params, not as internal error
+type paramsError struct {
+	cause error
+}
+
+func (t *paramsError) Error() string {
+	return "invalid params: " + t.cause.Error()
+}
+
+func DecodeParams(params json.RawMessage, result interface{}) error {
+	if len(params) == 0 {
+		return &paramsError{errors.New("params are required")}
+	}
+	err := json.Unmarshal(params, result)
+	if err != nil {
+		return &paramsError{err}
+	}
+	return nil
+}
+
+// one warm process per build instead of spawning the binary per operation (expensive on Windows because of AV scans)
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("serve", "read JSON-RPC 2.0 requests (one per line) from stdin and write responses to stdout")
+	isProgress := command.Flag("progress", "send progress events as \"progress\" notifications").Bool()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		server := NewServer(os.Stdout)
+		if *isProgress {
+			progress.SetOutput(&progressNotifier{server: server})
+		}
+		return server.Serve(os.Stdin)
+	})
+}
+
+func NewServer(writer io.Writer) *Server {
+	return &Server{
+		methods: createMethods(),
+		writer:  writer,
+	}
+}
+
+func (t *Server) RegisterMethod(name string, handler Handler) {
+	t.methods[name] = handler
+}
+
+// Serve handles requests concurrently until EOF, waits for in-flight requests before return
+func (t *Server) Serve(reader io.Reader) error {
+	var waitGroup sync.WaitGroup
+	defer waitGroup.Wait()
+
+	bufferedReader := bufio.NewReader(reader)
+	for {
+		line, err := bufferedReader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) != 0 {
+			waitGroup.Add(1)
+			go func(line []byte) {
+				defer waitGroup.Done()
+				t.handle(line)
+			}(line)
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
+
+func (t *Server) handle(line []byte) {
+	if line[0] == '[' {
+		t.writeError(nil, &responseError{Code: errorCodeInvalidRequest, Message: "batch requests are not supported"})
+		return
+	}
+
+	var r request
+	err := json.Unmarshal(line, &r)
+	if err != nil {
+		t.writeError(nil, &responseError{Code: errorCodeParse, Message: err.Error()})
+		return
+	}
+
+	isNotification := len(r.Id) == 0
+	if r.JsonRpc != "2.0" || len(r.Method) == 0 {
+		if !isNotification {
+			t.writeError(r.Id, &responseError{Code: errorCodeInvalidRequest, Message: "jsonrpc must be 2.0 and method must be specified"})
+		}
+		return
+	}
+
+	handler, ok := t.methods[r.Method]
+	if !ok {
+		if !isNotification {
+			t.writeError(r.Id, &responseError{Code: errorCodeMethodNotFound, Message: fmt.Sprintf("method %q is not supported", r.Method)})
+		}
+		return
+	}
+
+	result, err := callHandler(handler, r.Params)
+	if isNotification {
+		if err != nil {
+			log.WithError(err).WithField("method", r.Method).Warn("notification failed")
+		}
+		return
+	}
+
+	if err != nil {
+		log.WithField("method", r.Method).Debugf("%+v\n", err)
+		t.writeError(r.Id, toResponseError(err))
+		return
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.writeError(r.Id, &responseError{Code: errorCodeInternal, Message: err.Error()})
+		return
+	}
+	t.write(&response{JsonRpc: "2.0", Id: r.Id, Result: data})
+}
+
+// panic in handler must not kill the server
+func callHandler(handler Handler, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.Errorf("panic: %v", recovered)
+		}
+	}()
+	return handler(params)
+}
+
+func toResponseError(err error) *responseError {
+	switch t := errors.Cause(err).(type) {
+	case *paramsError:
+		return &responseError{Code: errorCodeInvalidParams, Message: t.Error()}
+	case util.MessageError:
+		return &responseError{Code: errorCodeUser, Message: t.Error(), Data: map[string]interface{}{"errorCode": t.ErrorCode()}}
+	default:
+		return &responseError{Code: errorCodeInternal, Message: err.Error()}
+	}
+}
+
+func (t *Server) writeError(id json.RawMessage, responseError *responseError) {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	t.write(&response{JsonRpc: "2.0", Id: id, Error: responseError})
+}
+
+func (t *Server) Notify(method string, params json.RawMessage) {
+	t.write(&notification{JsonRpc: "2.0", Method: method, Params: params})
+}
+
+func (t *Server) write(message interface{}) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.WithError(err).Error("cannot serialize JSON-RPC message")
+		return
+	}
+
+	t.writerMutex.Lock()
+	defer t.writerMutex.Unlock()
+	_, err = t.writer.Write(append(data, '\n'))
+	if err != nil {
+		log.WithError(err).Error("cannot write JSON-RPC message")
+	}
+}
+
+// progress event (JSON line) is sent as params of "progress" notification
+type progressNotifier struct {
+	server *Server
+}
+
+func (t *progressNotifier) Write(data []byte) (int, error) {
+	t.server.Notify("progress", bytes.TrimSpace(data))
+	return len(data), nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func TestServe(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "server")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	sourceFile := filepath.Join(tmpDir, "source.txt")
+	g.Expect(ioutil.WriteFile(sourceFile, []byte("data"), 0644)).NotTo(HaveOccurred())
+	copyParams, err := json.Marshal(map[string]string{"from": sourceFile, "to": filepath.Join(tmpDir, "copy.txt")})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	input := strings.Join([]string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "ping"}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "unknown"}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "download"}`,
+		`{"jsonrpc": "2.0", "id": "4", "method": "copy", "params": ` + string(copyParams) + `}`,
+		// notification, no response
+		`{"jsonrpc": "2.0", "method": "ping"}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "panic"}`,
+		`not json`,
+	}, "\n")
+
+	var output bytes.Buffer
+	server := NewServer(&output)
+	server.RegisterMethod("panic", func(params json.RawMessage) (interface{}, error) {
+		panic("test")
+	})
+	g.Expect(server.Serve(strings.NewReader(input))).NotTo(HaveOccurred())
+
+	// requests are handled concurrently, so, order of responses is not defined
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	sort.Strings(lines)
+	g.Expect(lines[len(lines)-1]).To(HavePrefix(`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,`))
+	lines = lines[:len(lines)-1]
+	g.Expect(lines).To(Equal([]string{
+		`{"jsonrpc":"2.0","id":"4","result":null}`,
+		`{"jsonrpc":"2.0","id":1,"result":"pong"}`,
+		`{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method \"unknown\" is not supported"}}`,
+		`{"jsonrpc":"2.0","id":3,"error":{"code":-32602,"message":"invalid params: params are required"}}`,
+		`{"jsonrpc":"2.0","id":5,"error":{"code":-32000,"message":"panic: test"}}`,
+	}))
+	g.Expect(filepath.Join(tmpDir, "copy.txt")).To(BeAnExistingFile())
+}
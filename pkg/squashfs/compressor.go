@@ -0,0 +1,105 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"os/exec"
+	"strconv"
+
+	"github.com/develar/errors"
+)
+
+const (
+	gzipCompression = 1
+	xzCompression   = 4
+	zstdCompression = 6
+)
+
+type compressor interface {
+	id() uint16
+	compress(data []byte) ([]byte, error)
+}
+
+func newCompressor(ctx context.Context, name string, blockSize int) (compressor, error) {
+	switch name {
+	case "", "gzip":
+		return &zlibCompressor{}, nil
+
+	case "xz":
+		// kernel decoder supports only CRC32 (or none) check, dictionary is limited by block size (default of mksquashfs)
+		return newExternalCompressor(ctx, xzCompression, "xz", func(size int) []string {
+			return []string{"--format=xz", "--check=crc32", "--threads=1", "--lzma2=preset=6,dict=" + strconv.Itoa(blockSize), "--stdout", "--quiet"}
+		})
+
+	case "zstd":
+		// the same level as used for mksquashfs,
+		// stream size must be specified, otherwise window is not limited by input size and kernel decoder (window up to block size) rejects it
+		return newExternalCompressor(ctx, zstdCompression, "zstd", func(size int) []string {
+			return []string{"-19", "--no-check", "--stream-size=" + strconv.Itoa(size), "--stdout", "--quiet"}
+		})
+
+	default:
+		return nil, errors.Errorf("unsupported compression %q (gzip, xz or zstd expected)", name)
+	}
+}
+
+// squashfs "gzip" is a zlib stream (mksquashfs default: level 9, window 15)
+type zlibCompressor struct {
+}
+
+func (t *zlibCompressor) id() uint16 {
+	return gzipCompression
+}
+
+func (t *zlibCompressor) compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer, err := zlib.NewWriterLevel(&buffer, zlib.BestCompression)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// xz and zstd are not implemented in Go (and not a dependency), every block is compressed as independent stream by system tool
+type externalCompressor struct {
+	ctx           context.Context
+	compressionId uint16
+	tool          string
+	args          func(size int) []string
+}
+
+func newExternalCompressor(ctx context.Context, compressionId uint16, name string, args func(size int) []string) (compressor, error) {
+	tool, err := exec.LookPath(name)
+	if err != nil {
+		return nil, errors.Errorf("%s is required for %s compression, please install it", name, name)
+	}
+	return &externalCompressor{ctx: ctx, compressionId: compressionId, tool: tool, args: args}, nil
+}
+
+func (t *externalCompressor) id() uint16 {
+	return t.compressionId
+}
+
+func (t *externalCompressor) compress(data []byte) ([]byte, error) {
+	// process is killed on cancel
+	command := exec.CommandContext(t.ctx, t.tool, t.args(len(data))...)
+	command.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	output, err := command.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s failed: %s", t.tool, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return output, nil
+}
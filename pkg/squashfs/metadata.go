@@ -0,0 +1,67 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	metadataBlockSize        = 8192
+	metadataUncompressedFlag = 0x8000
+)
+
+// inode and directory tables are streams of metadata blocks (up to 8 KiB, each prefixed by 16-bit size)
+type metadataWriter struct {
+	compressor compressor
+
+	pending []byte
+	output  bytes.Buffer
+}
+
+// reference is a position of the metadata block in the table (upper 48 bits) and offset in the uncompressed block (lower 16 bits)
+func (t *metadataWriter) reference() uint64 {
+	return uint64(t.output.Len())<<16 | uint64(len(t.pending))
+}
+
+func (t *metadataWriter) write(data []byte) error {
+	t.pending = append(t.pending, data...)
+	for len(t.pending) >= metadataBlockSize {
+		err := t.flush(t.pending[:metadataBlockSize])
+		if err != nil {
+			return err
+		}
+		t.pending = append(t.pending[:0], t.pending[metadataBlockSize:]...)
+	}
+	return nil
+}
+
+// finish writes the last (not full) block and returns the table
+func (t *metadataWriter) finish() ([]byte, error) {
+	if len(t.pending) != 0 {
+		err := t.flush(t.pending)
+		if err != nil {
+			return nil, err
+		}
+		t.pending = nil
+	}
+	return t.output.Bytes(), nil
+}
+
+func (t *metadataWriter) flush(data []byte) error {
+	compressed, err := t.compressor.compress(data)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 2)
+	if len(compressed) < len(data) {
+		binary.LittleEndian.PutUint16(header, uint16(len(compressed)))
+		t.output.Write(header)
+		t.output.Write(compressed)
+	} else {
+		binary.LittleEndian.PutUint16(header, uint16(len(data))|metadataUncompressedFlag)
+		t.output.Write(header)
+		t.output.Write(data)
+	}
+	return nil
+}
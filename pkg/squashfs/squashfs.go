@@ -0,0 +1,695 @@
+package squashfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/preflight"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// https://dr-emann.github.io/squashfs/ (squashfs 4.0)
+
+const (
+	magic          = 0x73717368
+	superblockSize = 96
+
+	defaultBlockSize = 128 * 1024
+	minBlockSize     = 4 * 1024
+	maxBlockSize     = 1024 * 1024
+	// mksquashfs pads image to 4 KiB (required for loop device)
+	imageAlignment = 4096
+
+	invalidTable          = math.MaxUint64
+	invalidIndex          = math.MaxUint32
+	uncompressedBlockFlag = 1 << 24
+
+	flagNoFragments = 0x0010
+	flagNoXattrs    = 0x0200
+
+	basicDirectoryType    = 1
+	basicFileType         = 2
+	basicSymlinkType      = 3
+	basicFifoType         = 6
+	basicSocketType       = 7
+	extendedDirectoryType = 8
+	extendedFileType      = 9
+
+	maxDirectoryHeaderCount = 256
+	maxNameLength           = 256
+)
+
+type Options struct {
+	// if the only source is a dir, content of dir is the root, otherwise every source is added to the root (the same as mksquashfs does)
+	Sources []string
+	Output  string
+	// image is written at the offset (e.g. AppImage runtime is written before), bytes before offset are zero filled
+	Offset int64
+	// gzip (default), xz or zstd
+	Compression string
+	// power of two from 4 KiB to 1 MiB, default 128 KiB
+	BlockSize int
+	// modification time of all inodes and image (see DefaultTimestamp)
+	Timestamp uint32
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("squashfs", "Create squashfs image (reproducible: sorted entries, fixed timestamps, owned by root, no fragments and xattrs).")
+	sources := command.Arg("sources", "The dir (content is the root) or several files and dirs (added to the root).").Required().Strings()
+	options := Options{}
+	command.Flag("output", "The output file.").Short('o').Required().StringVar(&options.Output)
+	command.Flag("offset", "The offset to write image at.").Int64Var(&options.Offset)
+	command.Flag("compression", "").Default("gzip").EnumVar(&options.Compression, "gzip", "xz", "zstd")
+	command.Flag("block-size", "").Default(strconv.Itoa(defaultBlockSize)).IntVar(&options.BlockSize)
+	timestamp := command.Flag("timestamp", "The modification time of all files (unix time), default: SOURCE_DATE_EPOCH or 0.").String()
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		options.Sources = *sources
+		if len(*timestamp) == 0 {
+			var err error
+			options.Timestamp, err = DefaultTimestamp()
+			if err != nil {
+				return err
+			}
+		} else {
+			value, err := strconv.ParseUint(*timestamp, 10, 32)
+			if err != nil {
+				return errors.Wrap(err, "invalid timestamp")
+			}
+			options.Timestamp = uint32(value)
+		}
+
+		tempDir, err := util.DefaultTempDirManager.Root()
+		if err != nil {
+			return err
+		}
+
+		err = preflight.CheckPackaging(options.Sources, "", tempDir, options.Output)
+		if err != nil {
+			return preflight.WriteUserError(err)
+		}
+		return Create(util.RootContext(), &options)
+	})
+}
+
+// DefaultTimestamp returns SOURCE_DATE_EPOCH or 0 (build time is never used to get reproducible image)
+func DefaultTimestamp() (uint32, error) {
+	value := strings.TrimSpace(os.Getenv("SOURCE_DATE_EPOCH"))
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	result, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid SOURCE_DATE_EPOCH")
+	}
+	return uint32(result), nil
+}
+
+type node struct {
+	name string
+	file string
+	mode os.FileMode
+	size int64
+
+	children []*node
+
+	inodeNumber uint32
+}
+
+type directoryEntry struct {
+	name        string
+	reference   uint64
+	inodeNumber uint32
+	// basic type is used for extended inodes too
+	inodeType uint16
+}
+
+type writer struct {
+	ctx    context.Context
+	file   *os.File
+	offset int64
+	// relative to image start
+	position int64
+
+	compressor compressor
+	blockSize  int
+	timestamp  uint32
+
+	inodes      metadataWriter
+	directories metadataWriter
+}
+
+// Create writes squashfs image. Entries are sorted by name and inode numbers are assigned in the order of writing, so, the same input produces the same image.
+// Incomplete image is removed on cancel.
+func Create(ctx context.Context, options *Options) error {
+	err := create(ctx, options)
+	if err != nil && ctx.Err() != nil {
+		removeErr := os.Remove(options.Output)
+		if removeErr != nil && !os.IsNotExist(removeErr) {
+			log.WithError(removeErr).WithField("file", options.Output).Warn("cannot remove incomplete image")
+		}
+	}
+	return err
+}
+
+func create(ctx context.Context, options *Options) error {
+	blockSize := options.BlockSize
+	if blockSize == 0 {
+		blockSize = defaultBlockSize
+	}
+	if blockSize < minBlockSize || blockSize > maxBlockSize || bits.OnesCount(uint(blockSize)) != 1 {
+		return errors.Errorf("block size %d must be a power of two from %d to %d", blockSize, minBlockSize, maxBlockSize)
+	}
+
+	compressor, err := newCompressor(ctx, options.Compression, blockSize)
+	if err != nil {
+		return err
+	}
+
+	root, err := scanSources(options.Sources)
+	if err != nil {
+		return err
+	}
+
+	var inodeCount uint32
+	assignInodeNumbers(root, &inodeCount)
+
+	file, err := os.OpenFile(options.Output, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer util.Close(file)
+
+	t := &writer{
+		ctx:         ctx,
+		file:        file,
+		offset:      options.Offset,
+		position:    superblockSize,
+		compressor:  compressor,
+		blockSize:   blockSize,
+		timestamp:   options.Timestamp,
+		inodes:      metadataWriter{compressor: compressor},
+		directories: metadataWriter{compressor: compressor},
+	}
+
+	rootEntry, err := t.writeNode(root, inodeCount+1)
+	if err != nil {
+		return err
+	}
+
+	superblock, err := t.writeTables(rootEntry.reference)
+	if err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(superblock[0:], magic)
+	binary.LittleEndian.PutUint32(superblock[4:], inodeCount)
+	binary.LittleEndian.PutUint32(superblock[8:], options.Timestamp)
+	binary.LittleEndian.PutUint32(superblock[12:], uint32(blockSize))
+	binary.LittleEndian.PutUint16(superblock[20:], compressor.id())
+	binary.LittleEndian.PutUint16(superblock[22:], uint16(bits.TrailingZeros(uint(blockSize))))
+	binary.LittleEndian.PutUint16(superblock[24:], flagNoFragments|flagNoXattrs)
+	// the only id (root)
+	binary.LittleEndian.PutUint16(superblock[26:], 1)
+	binary.LittleEndian.PutUint16(superblock[28:], 4)
+	binary.LittleEndian.PutUint16(superblock[30:], 0)
+	_, err = file.WriteAt(superblock, options.Offset)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	log.WithFields(log.Fields{
+		"file":        options.Output,
+		"inodes":      inodeCount,
+		"size":        t.position,
+		"compression": options.Compression,
+	}).Debug("squashfs image created")
+	return nil
+}
+
+func scanSources(sources []string) (*node, error) {
+	if len(sources) == 0 {
+		return nil, errors.New("no sources specified")
+	}
+
+	if len(sources) == 1 {
+		info, err := os.Stat(sources[0])
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if info.IsDir() {
+			children, err := scanDir(sources[0])
+			if err != nil {
+				return nil, err
+			}
+			return &node{file: sources[0], mode: info.Mode(), children: children}, nil
+		}
+	}
+
+	root := &node{mode: os.ModeDir | 0755}
+	names := make(map[string]string)
+	for _, source := range sources {
+		info, err := os.Lstat(source)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		name := filepath.Base(source)
+		if existing, ok := names[name]; ok {
+			return nil, errors.Errorf("%s and %s have the same name", existing, source)
+		}
+		names[name] = source
+
+		child, err := newNode(source, info)
+		if err != nil {
+			return nil, err
+		}
+		root.children = append(root.children, child)
+	}
+	sortNodes(root.children)
+	return root, nil
+}
+
+func newNode(file string, info os.FileInfo) (*node, error) {
+	result := &node{name: info.Name(), file: file, mode: info.Mode(), size: info.Size()}
+	if len(result.name) > maxNameLength {
+		return nil, errors.Errorf("name of %s is longer than %d bytes", file, maxNameLength)
+	}
+
+	if info.IsDir() {
+		var err error
+		result.children, err = scanDir(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// ioutil.ReadDir returns entries sorted by name (byte order) and doesn't follow symlinks
+func scanDir(dir string) ([]*node, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	result := make([]*node, 0, len(infos))
+	for _, info := range infos {
+		child, err := newNode(filepath.Join(dir, info.Name()), info)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, child)
+	}
+	return result, nil
+}
+
+func sortNodes(nodes []*node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+}
+
+// the same order as inodes are written: children before parent dir
+func assignInodeNumbers(dir *node, counter *uint32) {
+	for _, child := range dir.children {
+		if child.mode.IsDir() {
+			assignInodeNumbers(child, counter)
+		} else {
+			*counter++
+			child.inodeNumber = *counter
+		}
+	}
+	*counter++
+	dir.inodeNumber = *counter
+}
+
+func (t *writer) writeData(data []byte) error {
+	_, err := t.file.WriteAt(data, t.offset+t.position)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	t.position += int64(len(data))
+	return nil
+}
+
+func (t *writer) writeNode(n *node, parentInodeNumber uint32) (*directoryEntry, error) {
+	switch {
+	case n.mode.IsDir():
+		return t.writeDirectory(n, parentInodeNumber)
+	case n.mode.IsRegular():
+		return t.writeFile(n)
+	case n.mode&os.ModeSymlink != 0:
+		return t.writeSymlink(n)
+	case n.mode&os.ModeNamedPipe != 0:
+		return t.writeInode(n, basicFifoType, basicFifoType, uint32LE(1))
+	case n.mode&os.ModeSocket != 0:
+		return t.writeInode(n, basicSocketType, basicSocketType, uint32LE(1))
+	default:
+		return nil, errors.Errorf("unsupported type of file %s (%s)", n.file, n.mode)
+	}
+}
+
+func (t *writer) writeInode(n *node, inodeType uint16, basicType uint16, data []byte) (*directoryEntry, error) {
+	header := make([]byte, 16, 16+len(data))
+	binary.LittleEndian.PutUint16(header[0:], inodeType)
+	binary.LittleEndian.PutUint16(header[2:], permissions(n.mode))
+	// uid and gid index 0 (root)
+	binary.LittleEndian.PutUint32(header[8:], t.timestamp)
+	binary.LittleEndian.PutUint32(header[12:], n.inodeNumber)
+
+	entry := &directoryEntry{name: n.name, reference: t.inodes.reference(), inodeNumber: n.inodeNumber, inodeType: basicType}
+	err := t.inodes.write(append(header, data...))
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func permissions(mode os.FileMode) uint16 {
+	result := uint16(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		result |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		result |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		result |= 01000
+	}
+	return result
+}
+
+func (t *writer) writeSymlink(n *node) (*directoryEntry, error) {
+	target, err := os.Readlink(n.file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	data := append(uint32LE(1), uint32LE(uint32(len(target)))...)
+	return t.writeInode(n, basicSymlinkType, basicSymlinkType, append(data, target...))
+}
+
+func (t *writer) writeFile(n *node) (*directoryEntry, error) {
+	blocksStart := t.position
+	blockSizes, sparseSize, err := t.writeFileBlocks(n)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	inodeType := uint16(basicFileType)
+	if blocksStart > math.MaxUint32 || n.size > math.MaxUint32 {
+		inodeType = extendedFileType
+		data = append(data, uint64LE(uint64(blocksStart))...)
+		data = append(data, uint64LE(uint64(n.size))...)
+		data = append(data, uint64LE(uint64(sparseSize))...)
+		// link count, fragment index, fragment offset, xattr index
+		data = append(data, uint32LE(1)...)
+		data = append(data, uint32LE(invalidIndex)...)
+		data = append(data, uint32LE(0)...)
+		data = append(data, uint32LE(invalidIndex)...)
+	} else {
+		data = append(data, uint32LE(uint32(blocksStart))...)
+		data = append(data, uint32LE(invalidIndex)...)
+		data = append(data, uint32LE(0)...)
+		data = append(data, uint32LE(uint32(n.size))...)
+	}
+
+	for _, size := range blockSizes {
+		data = append(data, uint32LE(size)...)
+	}
+	return t.writeInode(n, inodeType, basicFileType, data)
+}
+
+// blocks are compressed concurrently in batches, but written in order, the last block is not packed into fragment (as mksquashfs -no-fragments does)
+func (t *writer) writeFileBlocks(n *node) ([]uint32, int64, error) {
+	if n.size == 0 {
+		return nil, 0, nil
+	}
+
+	reader, err := os.Open(n.file)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	defer util.Close(reader)
+
+	blockCount := int((n.size + int64(t.blockSize) - 1) / int64(t.blockSize))
+	blockSizes := make([]uint32, 0, blockCount)
+	var sparseSize int64
+	batchSize := runtime.NumCPU() * 2
+	remaining := n.size
+	for len(blockSizes) < blockCount {
+		if t.ctx.Err() != nil {
+			return nil, 0, errors.WithStack(t.ctx.Err())
+		}
+
+		count := blockCount - len(blockSizes)
+		if count > batchSize {
+			count = batchSize
+		}
+
+		blocks := make([][]byte, count)
+		for index := range blocks {
+			size := int64(t.blockSize)
+			if remaining < size {
+				size = remaining
+			}
+			blocks[index] = make([]byte, size)
+			_, err = io.ReadFull(reader, blocks[index])
+			if err != nil {
+				return nil, 0, errors.Wrapf(err, "cannot read %s (file changed during build?)", n.file)
+			}
+			remaining -= size
+		}
+
+		compressed := make([][]byte, count)
+		err = util.MapAsync(count, func(taskIndex int) (func() error, error) {
+			if isZero(blocks[taskIndex]) {
+				return nil, nil
+			}
+			return func() error {
+				var err error
+				compressed[taskIndex], err = t.compressor.compress(blocks[taskIndex])
+				return err
+			}, nil
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for index, block := range blocks {
+			var size uint32
+			switch {
+			case compressed[index] == nil:
+				// sparse block (zero size) is not written, reader fills it with zeros
+				sparseSize += int64(len(block))
+				blockSizes = append(blockSizes, 0)
+				continue
+			case len(compressed[index]) < len(block):
+				block = compressed[index]
+				size = uint32(len(block))
+			default:
+				size = uint32(len(block)) | uncompressedBlockFlag
+			}
+
+			err = t.writeData(block)
+			if err != nil {
+				return nil, 0, err
+			}
+			blockSizes = append(blockSizes, size)
+		}
+	}
+	return blockSizes, sparseSize, nil
+}
+
+func isZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *writer) writeDirectory(n *node, parentInodeNumber uint32) (*directoryEntry, error) {
+	entries := make([]*directoryEntry, 0, len(n.children))
+	var linkCount uint32 = 2
+	for _, child := range n.children {
+		entry, err := t.writeNode(child, n.inodeNumber)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		if child.mode.IsDir() {
+			linkCount++
+		}
+	}
+
+	listingReference := t.directories.reference()
+	listing, err := encodeDirectoryListing(entries)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot write %s", n.file)
+	}
+	err = t.directories.write(listing)
+	if err != nil {
+		return nil, err
+	}
+
+	// size includes virtual "." and ".." entries
+	fileSize := len(listing) + 3
+	listingBlock := uint32(listingReference >> 16)
+	listingOffset := uint16(listingReference)
+
+	var data []byte
+	if fileSize > math.MaxUint16 {
+		data = append(data, uint32LE(linkCount)...)
+		data = append(data, uint32LE(uint32(fileSize))...)
+		data = append(data, uint32LE(listingBlock)...)
+		data = append(data, uint32LE(parentInodeNumber)...)
+		// no directory index (it is optional and used only to speed up lookup)
+		data = append(data, uint16LE(0)...)
+		data = append(data, uint16LE(listingOffset)...)
+		data = append(data, uint32LE(invalidIndex)...)
+		return t.writeInode(n, extendedDirectoryType, basicDirectoryType, data)
+	}
+
+	data = append(data, uint32LE(listingBlock)...)
+	data = append(data, uint32LE(linkCount)...)
+	data = append(data, uint16LE(uint16(fileSize))...)
+	data = append(data, uint16LE(listingOffset)...)
+	data = append(data, uint32LE(parentInodeNumber)...)
+	return t.writeInode(n, basicDirectoryType, basicDirectoryType, data)
+}
+
+// entries share header if inodes are in the same metadata block and inode number delta fits into int16
+func encodeDirectoryListing(entries []*directoryEntry) ([]byte, error) {
+	var buffer bytes.Buffer
+	for start := 0; start < len(entries); {
+		first := entries[start]
+		end := start + 1
+		for ; end < len(entries) && end-start < maxDirectoryHeaderCount; end++ {
+			entry := entries[end]
+			delta := int64(entry.inodeNumber) - int64(first.inodeNumber)
+			if entry.reference>>16 != first.reference>>16 || delta < math.MinInt16 || delta > math.MaxInt16 {
+				break
+			}
+		}
+
+		buffer.Write(uint32LE(uint32(end - start - 1)))
+		buffer.Write(uint32LE(uint32(first.reference >> 16)))
+		buffer.Write(uint32LE(first.inodeNumber))
+		for _, entry := range entries[start:end] {
+			if len(entry.name) == 0 {
+				return nil, errors.New("empty name")
+			}
+
+			buffer.Write(uint16LE(uint16(entry.reference)))
+			buffer.Write(uint16LE(uint16(int16(int64(entry.inodeNumber) - int64(first.inodeNumber)))))
+			buffer.Write(uint16LE(entry.inodeType))
+			buffer.Write(uint16LE(uint16(len(entry.name) - 1)))
+			buffer.WriteString(entry.name)
+		}
+		start = end
+	}
+	return buffer.Bytes(), nil
+}
+
+// writes inode, directory and id tables (no fragment, export and xattr tables), returns superblock with table positions
+func (t *writer) writeTables(rootReference uint64) ([]byte, error) {
+	superblock := make([]byte, superblockSize)
+
+	inodeTable, err := t.inodes.finish()
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(superblock[64:], uint64(t.position))
+	err = t.writeData(inodeTable)
+	if err != nil {
+		return nil, err
+	}
+
+	directoryTable, err := t.directories.finish()
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(superblock[72:], uint64(t.position))
+	err = t.writeData(directoryTable)
+	if err != nil {
+		return nil, err
+	}
+
+	// fragment table is empty
+	binary.LittleEndian.PutUint64(superblock[80:], uint64(t.position))
+	binary.LittleEndian.PutUint64(superblock[88:], invalidTable)
+	binary.LittleEndian.PutUint64(superblock[56:], invalidTable)
+
+	// id table: metadata block with ids and index (position of metadata blocks)
+	idTable := metadataWriter{compressor: t.compressor}
+	err = idTable.write(uint32LE(0))
+	if err != nil {
+		return nil, err
+	}
+	idBlock, err := idTable.finish()
+	if err != nil {
+		return nil, err
+	}
+	idBlockStart := t.position
+	err = t.writeData(idBlock)
+	if err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(superblock[48:], uint64(t.position))
+	err = t.writeData(uint64LE(uint64(idBlockStart)))
+	if err != nil {
+		return nil, err
+	}
+
+	bytesUsed := t.position
+	binary.LittleEndian.PutUint64(superblock[40:], uint64(bytesUsed))
+	binary.LittleEndian.PutUint64(superblock[32:], rootReference)
+
+	padding := (imageAlignment - bytesUsed%imageAlignment) % imageAlignment
+	if padding != 0 {
+		err = t.writeData(make([]byte, padding))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return superblock, nil
+}
+
+func uint16LE(value uint16) []byte {
+	result := make([]byte, 2)
+	binary.LittleEndian.PutUint16(result, value)
+	return result
+}
+
+func uint32LE(value uint32) []byte {
+	result := make([]byte, 4)
+	binary.LittleEndian.PutUint32(result, value)
+	return result
+}
+
+func uint64LE(value uint64) []byte {
+	result := make([]byte, 8)
+	binary.LittleEndian.PutUint64(result, value)
+	return result
+}
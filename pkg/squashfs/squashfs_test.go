@@ -0,0 +1,372 @@
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+// minimal reader to check written image
+type testImage struct {
+	data       []byte
+	blockSize  uint32
+	inodeCount uint32
+	flags      uint16
+	compressor uint16
+	root       uint64
+
+	inodeTable     *testMetadata
+	directoryTable *testMetadata
+}
+
+// all metadata blocks of table are decoded, map is from block position in table to offset in decoded data
+type testMetadata struct {
+	data   []byte
+	blocks map[uint64]int
+}
+
+type testFile struct {
+	mode        uint16
+	inodeNumber uint32
+	mtime       uint32
+	content     string
+	target      string
+	isDir       bool
+}
+
+func decompress(t *testing.T, compressor uint16, data []byte) []byte {
+	var command *exec.Cmd
+	switch compressor {
+	case gzipCompression:
+		reader, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := ioutil.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	case xzCompression:
+		command = exec.Command("xz", "--decompress", "--stdout")
+	case zstdCompression:
+		command = exec.Command("zstd", "--decompress", "--stdout")
+	}
+
+	command.Stdin = bytes.NewReader(data)
+	result, err := command.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func readTestImage(t *testing.T, data []byte) *testImage {
+	order := binary.LittleEndian
+	if order.Uint32(data) != magic {
+		t.Fatal("invalid magic")
+	}
+
+	image := &testImage{
+		data:       data,
+		inodeCount: order.Uint32(data[4:]),
+		blockSize:  order.Uint32(data[12:]),
+		compressor: order.Uint16(data[20:]),
+		flags:      order.Uint16(data[24:]),
+		root:       order.Uint64(data[32:]),
+	}
+
+	bytesUsed := order.Uint64(data[40:])
+	idTableStart := order.Uint64(data[48:])
+	inodeTableStart := order.Uint64(data[64:])
+	directoryTableStart := order.Uint64(data[72:])
+	fragmentTableStart := order.Uint64(data[80:])
+	if uint64(len(data))%imageAlignment != 0 || bytesUsed > uint64(len(data)) || idTableStart+8 != bytesUsed {
+		t.Fatalf("invalid size (image %d, used %d, id table %d)", len(data), bytesUsed, idTableStart)
+	}
+	if !(inodeTableStart < directoryTableStart && directoryTableStart <= fragmentTableStart) {
+		t.Fatal("invalid table order")
+	}
+
+	// the same check as kernel does: id metadata block is right before the index
+	idBlockStart := order.Uint64(data[idTableStart:])
+	ids := readTestMetadata(t, image.compressor, data[idBlockStart:idTableStart])
+	if !bytes.Equal(ids.data, []byte{0, 0, 0, 0}) {
+		t.Fatal("invalid id table")
+	}
+
+	image.inodeTable = readTestMetadata(t, image.compressor, data[inodeTableStart:directoryTableStart])
+	image.directoryTable = readTestMetadata(t, image.compressor, data[directoryTableStart:fragmentTableStart])
+	return image
+}
+
+func readTestMetadata(t *testing.T, compressor uint16, data []byte) *testMetadata {
+	result := &testMetadata{blocks: make(map[uint64]int)}
+	for position := 0; position < len(data); {
+		header := binary.LittleEndian.Uint16(data[position:])
+		size := int(header &^ metadataUncompressedFlag)
+		block := data[position+2 : position+2+size]
+		if header&metadataUncompressedFlag == 0 {
+			block = decompress(t, compressor, block)
+		}
+		result.blocks[uint64(position)] = len(result.data)
+		result.data = append(result.data, block...)
+		position += 2 + size
+	}
+	return result
+}
+
+func (t *testMetadata) slice(reference uint64) []byte {
+	start, ok := t.blocks[reference>>16]
+	if !ok {
+		panic("invalid metadata reference")
+	}
+	return t.data[start+int(reference&0xffff):]
+}
+
+func (image *testImage) readTree(t *testing.T, reference uint64, path string, result map[string]*testFile) {
+	order := binary.LittleEndian
+	inode := image.inodeTable.slice(reference)
+	file := &testFile{mode: order.Uint16(inode[2:]), mtime: order.Uint32(inode[8:]), inodeNumber: order.Uint32(inode[12:])}
+	if order.Uint16(inode[4:]) != 0 || order.Uint16(inode[6:]) != 0 {
+		t.Fatal("uid and gid must be root")
+	}
+	result[path] = file
+
+	switch order.Uint16(inode) {
+	case basicDirectoryType:
+		file.isDir = true
+		listingBlock := uint64(order.Uint32(inode[16:]))
+		fileSize := int(order.Uint16(inode[24:]))
+		listingOffset := uint64(order.Uint16(inode[26:]))
+		listing := image.directoryTable.slice(listingBlock<<16 | listingOffset)[:fileSize-3]
+		for len(listing) != 0 {
+			count := int(order.Uint32(listing)) + 1
+			inodeBlock := uint64(order.Uint32(listing[4:]))
+			baseNumber := int32(order.Uint32(listing[8:]))
+			listing = listing[12:]
+			for i := 0; i < count; i++ {
+				offset := uint64(order.Uint16(listing))
+				number := baseNumber + int32(int16(order.Uint16(listing[2:])))
+				nameSize := int(order.Uint16(listing[6:])) + 1
+				name := string(listing[8 : 8+nameSize])
+				listing = listing[8+nameSize:]
+
+				childPath := name
+				if len(path) != 0 {
+					childPath = path + "/" + name
+				}
+				image.readTree(t, inodeBlock<<16|offset, childPath, result)
+				if result[childPath].inodeNumber != uint32(number) {
+					t.Fatalf("inode number of %s in directory entry doesn't match inode", childPath)
+				}
+			}
+		}
+
+	case basicFileType:
+		start := order.Uint32(inode[16:])
+		size := order.Uint32(inode[28:])
+		blockCount := (size + image.blockSize - 1) / image.blockSize
+		var content []byte
+		position := start
+		for i := uint32(0); i < blockCount; i++ {
+			blockSize := order.Uint32(inode[32+i*4:])
+			switch {
+			case blockSize == 0:
+				content = append(content, make([]byte, image.blockSize)...)
+			case blockSize&uncompressedBlockFlag != 0:
+				blockSize &^= uncompressedBlockFlag
+				content = append(content, image.data[position:position+blockSize]...)
+			default:
+				content = append(content, decompress(t, image.compressor, image.data[position:position+blockSize])...)
+			}
+			position += blockSize
+		}
+		file.content = string(content[:size])
+
+	case basicSymlinkType:
+		size := order.Uint32(inode[20:])
+		file.target = string(inode[24 : 24+size])
+
+	default:
+		t.Fatalf("unexpected inode type %d", order.Uint16(inode))
+	}
+}
+
+func createTestTree(t *testing.T) string {
+	g := NewGomegaWithT(t)
+
+	dir, err := ioutil.TempDir("", "squashfs-test")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(os.MkdirAll(filepath.Join(dir, "usr", "lib"), 0755)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(dir, "empty"), 0700)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "AppRun"), []byte("#!/bin/sh\necho test\n"), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "usr", "lib", "empty.so"), nil, 0644)).To(Succeed())
+	// several blocks: compressible, random-like (stored uncompressed), zero (sparse) and short last block
+	var large bytes.Buffer
+	large.WriteString(strings.Repeat("compressible ", 5000))
+	seed := uint32(1)
+	for i := 0; i < 20000; i++ {
+		seed = seed*1103515245 + 12345
+		large.WriteByte(byte(seed >> 16))
+	}
+	large.Write(make([]byte, 8192))
+	large.WriteString("tail")
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "usr", "lib", "large.bin"), large.Bytes(), 0644)).To(Succeed())
+	g.Expect(os.Symlink("usr/lib/large.bin", filepath.Join(dir, "link"))).To(Succeed())
+	for i := 0; i < 300; i++ {
+		g.Expect(ioutil.WriteFile(filepath.Join(dir, "usr", strings.Repeat("n", 100)+string(rune('a'+i%26))+strings.Repeat("x", i/26)), []byte{byte(i)}, 0644)).To(Succeed())
+	}
+	return dir
+}
+
+func TestCreate(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := createTestTree(t)
+	defer os.RemoveAll(dir)
+
+	outDir, err := ioutil.TempDir("", "squashfs-test-out")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(outDir)
+
+	output := filepath.Join(outDir, "test.squashfs")
+	err = Create(context.Background(), &Options{Sources: []string{dir}, Output: output, BlockSize: 4096, Timestamp: 1234, Offset: 100})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(output)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(data[:100]).To(Equal(make([]byte, 100)))
+
+	image := readTestImage(t, data[100:])
+	g.Expect(image.flags).To(Equal(uint16(flagNoFragments | flagNoXattrs)))
+	files := make(map[string]*testFile)
+	image.readTree(t, image.root, "", files)
+	g.Expect(files).To(HaveLen(int(image.inodeCount)))
+	// root is written last
+	g.Expect(files[""].inodeNumber).To(Equal(image.inodeCount))
+	g.Expect(files[""].isDir).To(BeTrue())
+	g.Expect(files["AppRun"].mode).To(Equal(uint16(0755)))
+	g.Expect(files["AppRun"].content).To(Equal("#!/bin/sh\necho test\n"))
+	g.Expect(files["AppRun"].inodeNumber).To(Equal(uint32(1)))
+	g.Expect(files["AppRun"].mtime).To(Equal(uint32(1234)))
+	g.Expect(files["empty"].isDir).To(BeTrue())
+	g.Expect(files["empty"].mode).To(Equal(uint16(0700)))
+	g.Expect(files["link"].target).To(Equal("usr/lib/large.bin"))
+	g.Expect(files["usr/lib/empty.so"].content).To(BeEmpty())
+
+	expected, err := ioutil.ReadFile(filepath.Join(dir, "usr", "lib", "large.bin"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files["usr/lib/large.bin"].content).To(Equal(string(expected)))
+	// 300 entries in one dir (several directory headers)
+	g.Expect(files["usr/"+strings.Repeat("n", 101)+strings.Repeat("x", 11)].content).To(Equal(string([]byte{299 % 256})))
+}
+
+func TestReproducible(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := createTestTree(t)
+	defer os.RemoveAll(dir)
+
+	outDir, err := ioutil.TempDir("", "squashfs-test-out")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(outDir)
+
+	first := filepath.Join(outDir, "first.squashfs")
+	g.Expect(Create(context.Background(), &Options{Sources: []string{dir}, Output: first})).To(Succeed())
+
+	// modification time of source files doesn't matter
+	g.Expect(os.Chtimes(filepath.Join(dir, "AppRun"), time.Unix(0, 0), time.Unix(0, 0))).To(Succeed())
+	second := filepath.Join(outDir, "second.squashfs")
+	g.Expect(Create(context.Background(), &Options{Sources: []string{dir}, Output: second})).To(Succeed())
+
+	firstData, err := ioutil.ReadFile(first)
+	g.Expect(err).NotTo(HaveOccurred())
+	secondData, err := ioutil.ReadFile(second)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(bytes.Equal(firstData, secondData)).To(BeTrue())
+}
+
+func TestSeveralSources(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := createTestTree(t)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "..", filepath.Base(dir)+".squashfs")
+	defer os.Remove(output)
+
+	err := Create(context.Background(), &Options{Sources: []string{filepath.Join(dir, "usr", "lib"), filepath.Join(dir, "AppRun")}, Output: output})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	data, err := ioutil.ReadFile(output)
+	g.Expect(err).NotTo(HaveOccurred())
+	image := readTestImage(t, data)
+	files := make(map[string]*testFile)
+	image.readTree(t, image.root, "", files)
+	g.Expect(files).To(HaveKey("AppRun"))
+	g.Expect(files).To(HaveKey("lib/large.bin"))
+	g.Expect(files[""].mode).To(Equal(uint16(0755)))
+
+	err = Create(context.Background(), &Options{Sources: []string{filepath.Join(dir, "usr", "lib"), filepath.Join(dir, "lib")}, Output: output})
+	g.Expect(err).To(HaveOccurred())
+	err = Create(context.Background(), &Options{Sources: []string{filepath.Join(dir, "usr", "lib")}, Output: output, BlockSize: 5000})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCreateCancelled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	dir := createTestTree(t)
+	defer os.RemoveAll(dir)
+
+	output := filepath.Join(dir, "..", filepath.Base(dir)+".squashfs")
+	defer os.Remove(output)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Create(ctx, &Options{Sources: []string{dir}, Output: output})
+	g.Expect(errors.Cause(err)).To(Equal(context.Canceled))
+	// incomplete image is removed
+	g.Expect(output).NotTo(BeAnExistingFile())
+}
+
+func TestExternalCompression(t *testing.T) {
+	dir := createTestTree(t)
+	defer os.RemoveAll(dir)
+
+	for _, compression := range []string{"xz", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			if _, err := exec.LookPath(compression); err != nil {
+				t.Skip(compression + " is not installed")
+			}
+
+			g := NewGomegaWithT(t)
+			output := filepath.Join(dir, "..", filepath.Base(dir)+"."+compression+".squashfs")
+			defer os.Remove(output)
+
+			g.Expect(Create(context.Background(), &Options{Sources: []string{filepath.Join(dir, "usr", "lib")}, Output: output, Compression: compression})).To(Succeed())
+			data, err := ioutil.ReadFile(output)
+			g.Expect(err).NotTo(HaveOccurred())
+			image := readTestImage(t, data)
+			files := make(map[string]*testFile)
+			image.readTree(t, image.root, "", files)
+
+			expected, err := ioutil.ReadFile(filepath.Join(dir, "usr", "lib", "large.bin"))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(files["large.bin"].content).To(Equal(string(expected)))
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type chromeTrace struct {
+	TraceEvents     []chromeEvent `json:"traceEvents"`
+	DisplayTimeUnit string        `json:"displayTimeUnit"`
+}
+
+type chromeEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"ph"`
+	// microseconds
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur"`
+	Pid       int                    `json:"pid"`
+	Tid       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+func WriteChromeTraceFile(file string, spans []*Span) error {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer util.Close(out)
+	return WriteChromeTrace(out, spans)
+}
+
+// WriteChromeTrace writes spans as complete events. Concurrent spans are placed on different threads (tid), because viewer expects that events of thread are nested.
+func WriteChromeTrace(writer io.Writer, spans []*Span) error {
+	spans = sortSpans(spans)
+
+	var start time.Time
+	if len(spans) != 0 {
+		start = spans[0].StartTime
+	}
+
+	// end time of spans opened on thread, a span is placed on the first thread where it is nested in the innermost open span
+	var threads [][]time.Time
+	events := make([]chromeEvent, 0, len(spans))
+	pid := os.Getpid()
+	for _, span := range spans {
+		tid := -1
+		for index, stack := range threads {
+			for len(stack) != 0 && !stack[len(stack)-1].After(span.StartTime) {
+				stack = stack[:len(stack)-1]
+			}
+			threads[index] = stack
+			if tid == -1 && (len(stack) == 0 || !stack[len(stack)-1].Before(span.EndTime)) {
+				tid = index
+			}
+		}
+		if tid == -1 {
+			tid = len(threads)
+			threads = append(threads, nil)
+		}
+		threads[tid] = append(threads[tid], span.EndTime)
+
+		args := make(map[string]interface{}, len(span.Attributes)+1)
+		for key, value := range span.Attributes {
+			args[key] = value
+		}
+		if len(span.Error) != 0 {
+			args["error"] = span.Error
+		}
+
+		events = append(events, chromeEvent{
+			Name:      span.Name,
+			Phase:     "X",
+			Timestamp: int64(span.StartTime.Sub(start) / time.Microsecond),
+			Duration:  int64(span.EndTime.Sub(span.StartTime) / time.Microsecond),
+			Pid:       pid,
+			Tid:       tid + 1,
+			Args:      args,
+		})
+	}
+
+	// encoding/json, jsoniter cannot marshal map[string]interface{}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return errors.WithStack(encoder.Encode(chromeTrace{TraceEvents: events, DisplayTimeUnit: "ms"}))
+}
+
+// by start time, enclosing span first
+func sortSpans(spans []*Span) []*Span {
+	result := make([]*Span, 0, len(spans))
+	for _, span := range spans {
+		if !span.EndTime.IsZero() {
+			result = append(result, span)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].StartTime.Equal(result[j].StartTime) {
+			return result[i].EndTime.After(result[j].EndTime)
+		}
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result
+}
@@ -0,0 +1,251 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/develar/app-builder/pkg/util/httpclient"
+	"github.com/develar/errors"
+)
+
+// OTLP JSON encoding (https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding), ids are hex strings
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId      string `json:"traceId"`
+	SpanId       string `json:"spanId"`
+	ParentSpanId string `json:"parentSpanId,omitempty"`
+	Name         string `json:"name"`
+	// 1 - internal
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	// 1 - ok, 2 - error
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const serviceName = "app-builder"
+
+func toOtlp(spans []*Span) *otlpTraces {
+	result := make([]otlpSpan, 0, len(spans))
+	for _, span := range sortSpans(spans) {
+		status := otlpStatus{Code: 1}
+		if len(span.Error) != 0 {
+			status = otlpStatus{Code: 2, Message: span.Error}
+		}
+		result = append(result, otlpSpan{
+			TraceId:           span.TraceId,
+			SpanId:            span.SpanId,
+			ParentSpanId:      span.ParentId,
+			Name:              span.Name,
+			Kind:              1,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        toOtlpAttributes(span.Attributes),
+			Status:            status,
+		})
+	}
+
+	name := serviceName
+	return &otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{{Key: "service.name", Value: otlpValue{StringValue: &name}}}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: serviceName}, Spans: result}},
+	}}}
+}
+
+// sorted by key to get stable output
+func toOtlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		var value otlpValue
+		switch v := attributes[key].(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			continue
+		}
+		result = append(result, otlpAttribute{Key: key, Value: value})
+	}
+	return result
+}
+
+func fromOtlp(traces *otlpTraces) ([]*Span, error) {
+	var result []*Span
+	for _, resourceSpans := range traces.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, s := range scopeSpans.Spans {
+				start, err := strconv.ParseInt(s.StartTimeUnixNano, 10, 64)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				end, err := strconv.ParseInt(s.EndTimeUnixNano, 10, 64)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				span := &Span{
+					Name:      s.Name,
+					TraceId:   s.TraceId,
+					SpanId:    s.SpanId,
+					ParentId:  s.ParentSpanId,
+					StartTime: time.Unix(0, start),
+					EndTime:   time.Unix(0, end),
+				}
+				if s.Status.Code == 2 {
+					span.Error = s.Status.Message
+				}
+				for _, attribute := range s.Attributes {
+					span.SetAttribute(attribute.Key, attribute.Value.get())
+				}
+				result = append(result, span)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (t otlpValue) get() interface{} {
+	switch {
+	case t.StringValue != nil:
+		return *t.StringValue
+	case t.BoolValue != nil:
+		return *t.BoolValue
+	case t.IntValue != nil:
+		value, err := strconv.ParseInt(*t.IntValue, 10, 64)
+		if err != nil {
+			return *t.IntValue
+		}
+		return value
+	case t.DoubleValue != nil:
+		return *t.DoubleValue
+	default:
+		return nil
+	}
+}
+
+func WriteOtlpFile(file string, spans []*Span) error {
+	data, err := json.Marshal(toOtlp(spans))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(ioutil.WriteFile(file, data, 0644))
+}
+
+// ReadOtlpFile reads spans written by WriteOtlpFile (e.g. by child process)
+func ReadOtlpFile(file string) ([]*Span, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var traces otlpTraces
+	err = json.Unmarshal(data, &traces)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot parse "+file)
+	}
+	return fromOtlp(&traces)
+}
+
+// ExportOtlp sends spans to collector, OTEL_EXPORTER_OTLP_HEADERS (key=value pairs separated by comma) are added to request (e.g. API key)
+func ExportOtlp(endpoint string, spans []*Span) error {
+	data, err := json.Marshal(toOtlp(spans))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		index := strings.IndexRune(header, '=')
+		if index > 0 {
+			request.Header.Set(strings.TrimSpace(header[:index]), strings.TrimSpace(header[index+1:]))
+		}
+	}
+
+	response, err := httpclient.NewClient().Do(request)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(response.Body)
+		return errors.Errorf("cannot export spans to %s: %s %s", url, response.Status, string(body))
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/errors"
+)
+
+// Span is a timed operation (e.g. icon conversion, copying, compression). All methods can be called on nil span (tracing is disabled).
+type Span struct {
+	Name      string
+	TraceId   string
+	SpanId    string
+	ParentId  string
+	StartTime time.Time
+	EndTime   time.Time
+	// string, bool, int, int64 or float64
+	Attributes map[string]interface{}
+	Error      string
+
+	mutex sync.Mutex
+}
+
+type recorder struct {
+	mutex sync.Mutex
+	root  *Span
+	// finished spans
+	spans []*Span
+}
+
+var recorderMutex sync.Mutex
+
+// nil if tracing is disabled
+var currentRecorder *recorder
+
+type spanKey struct{}
+
+// IsEnabled returns true if spans are recorded
+func IsEnabled() bool {
+	return getRecorder() != nil
+}
+
+func getRecorder() *recorder {
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	return currentRecorder
+}
+
+// Enable starts recording, the root span is named after the command. Parent is W3C traceparent (e.g. of parent process), can be empty.
+func Enable(name string, parent string) {
+	root := &Span{Name: name, SpanId: newId(8), StartTime: time.Now()}
+	traceId, parentId, err := parseTraceparent(parent)
+	if err != nil {
+		log.WithError(err).Warn("invalid TRACEPARENT, new trace is started")
+	}
+	if len(traceId) == 0 {
+		traceId = newId(16)
+	}
+	root.TraceId = traceId
+	root.ParentId = parentId
+
+	recorderMutex.Lock()
+	defer recorderMutex.Unlock()
+	currentRecorder = &recorder{root: root}
+}
+
+// Disable stops recording and returns all recorded spans (the root span is ended)
+func Disable(err error) []*Span {
+	recorderMutex.Lock()
+	r := currentRecorder
+	currentRecorder = nil
+	recorderMutex.Unlock()
+
+	if r == nil {
+		return nil
+	}
+
+	r.root.End(err)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Span{r.root}, r.spans...)
+}
+
+// Start returns span (child of span of context or of the root span) and context to pass to nested operations, span is nil if tracing is disabled.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	r := getRecorder()
+	if r == nil {
+		return ctx, nil
+	}
+
+	parent := FromContext(ctx)
+	if parent == nil {
+		parent = r.root
+	}
+	span := &Span{Name: name, TraceId: parent.TraceId, SpanId: newId(8), ParentId: parent.SpanId, StartTime: time.Now()}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns span of context, nil if there is no span
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+func (t *Span) SetAttribute(key string, value interface{}) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.Attributes == nil {
+		t.Attributes = make(map[string]interface{})
+	}
+	t.Attributes[key] = value
+}
+
+// End records the span, error marks operation as failed. Subsequent calls are ignored.
+func (t *Span) End(err error) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	if !t.EndTime.IsZero() {
+		t.mutex.Unlock()
+		return
+	}
+	t.EndTime = time.Now()
+	if err != nil {
+		t.Error = err.Error()
+	}
+	t.mutex.Unlock()
+
+	r := getRecorder()
+	// root span is returned by Disable
+	if r != nil && r.root != t {
+		r.add(t)
+	}
+}
+
+func (t *recorder) add(spans ...*Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = append(t.spans, spans...)
+}
+
+// Import adds finished spans recorded by another process (e.g. child process that joined trace using Traceparent)
+func Import(spans []*Span) {
+	r := getRecorder()
+	if r != nil {
+		r.add(spans...)
+	}
+}
+
+// Traceparent returns W3C traceparent of span of context (or of the root span) to pass to child process, empty if tracing is disabled.
+func Traceparent(ctx context.Context) string {
+	r := getRecorder()
+	if r == nil {
+		return ""
+	}
+
+	span := FromContext(ctx)
+	if span == nil {
+		span = r.root
+	}
+	return fmt.Sprintf("00-%s-%s-01", span.TraceId, span.SpanId)
+}
+
+// version-traceId-parentId-flags
+func parseTraceparent(value string) (string, string, error) {
+	if len(value) == 0 {
+		return "", "", nil
+	}
+
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || !isHex(parts[1]) || !isHex(parts[2]) {
+		return "", "", errors.Errorf("unsupported traceparent format: %s", value)
+	}
+	return parts[1], parts[2], nil
+}
+
+func isHex(value string) bool {
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+// random hex id of the size (bytes), 16 for trace, 8 for span
+func newId(size int) string {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	if err != nil {
+		// ids must be unique only within trace
+		for index := range data {
+			data[index] = byte(time.Now().UnixNano() >> uint(index*8))
+		}
+	}
+	return hex.EncodeToString(data)
+}
+
+// --trace out/trace.json to write Chrome trace (chrome://tracing, https://ui.perfetto.dev) or OTLP JSON (--trace-format otlp),
+// --otlp-endpoint to export spans to OpenTelemetry collector (OTLP/HTTP JSON).
+// Call Finish after execution of command.
+func ConfigureFlags(app *kingpin.Application) {
+	file := app.Flag("trace", "The file to write timings of operations to (icon conversion, copying, compression, etc.).").Envar("APP_BUILDER_TRACE").String()
+	format := app.Flag("trace-format", "The format of trace file: chrome (trace event format) or otlp (OTLP JSON).").Envar("APP_BUILDER_TRACE_FORMAT").Default("chrome").Enum("chrome", "otlp")
+	endpoint := app.Flag("otlp-endpoint", "The OpenTelemetry collector URL to export spans to (OTLP/HTTP JSON, /v1/traces is appended).").Envar("OTEL_EXPORTER_OTLP_ENDPOINT").String()
+
+	app.PreAction(func(context *kingpin.ParseContext) error {
+		if len(*file) == 0 && len(*endpoint) == 0 {
+			return nil
+		}
+
+		name := "app-builder"
+		if context.SelectedCommand != nil {
+			name = context.SelectedCommand.FullCommand()
+		}
+		Enable(name, os.Getenv("TRACEPARENT"))
+		exportOptions = &ExportOptions{File: *file, Format: *format, Endpoint: *endpoint}
+		return nil
+	})
+}
+
+type ExportOptions struct {
+	File string
+	// chrome or otlp
+	Format   string
+	Endpoint string
+}
+
+// set by ConfigureFlags
+var exportOptions *ExportOptions
+
+// Finish ends the root span (error of command marks it as failed) and exports spans. Tracing must not fail the build, so, export errors are only logged.
+func Finish(commandError error) {
+	spans := Disable(commandError)
+	if len(spans) == 0 || exportOptions == nil {
+		return
+	}
+
+	err := Export(spans, exportOptions)
+	if err != nil {
+		log.WithError(err).Warn("cannot export trace")
+	}
+}
+
+func Export(spans []*Span, options *ExportOptions) error {
+	if len(options.File) != 0 {
+		var err error
+		if options.Format == "otlp" {
+			err = WriteOtlpFile(options.File, spans)
+		} else {
+			err = WriteChromeTraceFile(options.File, spans)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(options.Endpoint) != 0 {
+		return ExportOtlp(options.Endpoint, spans)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSpans(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, span := Start(context.Background(), "disabled")
+	g.Expect(span).To(BeNil())
+	// nil span is ignored
+	span.SetAttribute("key", "value")
+	span.End(nil)
+
+	Enable("run", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	ctx, parent := Start(context.Background(), "icon")
+	parent.SetAttribute("format", "icns")
+	_, child := Start(ctx, "download")
+	child.End(errors.New("not found"))
+	parent.End(nil)
+	g.Expect(Traceparent(ctx)).To(Equal("00-0af7651916cd43dd8448eb211c80319c-" + parent.SpanId + "-01"))
+	spans := Disable(nil)
+
+	g.Expect(spans).To(HaveLen(3))
+	root := spans[0]
+	g.Expect(root.Name).To(Equal("run"))
+	g.Expect(root.TraceId).To(Equal("0af7651916cd43dd8448eb211c80319c"))
+	g.Expect(root.ParentId).To(Equal("b7ad6b7169203331"))
+	g.Expect(spans[1]).To(Equal(child))
+	g.Expect(child.ParentId).To(Equal(parent.SpanId))
+	g.Expect(child.Error).To(Equal("not found"))
+	g.Expect(parent.ParentId).To(Equal(root.SpanId))
+	g.Expect(parent.Attributes).To(Equal(map[string]interface{}{"format": "icns"}))
+	g.Expect(IsEnabled()).To(BeFalse())
+}
+
+func TestChromeTrace(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	start := time.Unix(1000, 0)
+	span := func(name string, from int, to int) *Span {
+		return &Span{Name: name, StartTime: start.Add(time.Duration(from) * time.Millisecond), EndTime: start.Add(time.Duration(to) * time.Millisecond)}
+	}
+	copySpan := span("copy", 5, 20)
+	copySpan.SetAttribute("from", "app")
+	spans := []*Span{span("run", 0, 100), span("icon", 10, 30), copySpan, span("archive", 40, 90)}
+
+	var buffer bytes.Buffer
+	g.Expect(WriteChromeTrace(&buffer, spans)).To(Succeed())
+
+	var result struct {
+		TraceEvents []struct {
+			Name string                 `json:"name"`
+			Ts   int64                  `json:"ts"`
+			Dur  int64                  `json:"dur"`
+			Tid  int                    `json:"tid"`
+			Args map[string]interface{} `json:"args"`
+		} `json:"traceEvents"`
+	}
+	g.Expect(json.Unmarshal(buffer.Bytes(), &result)).To(Succeed())
+
+	tids := make(map[string]int)
+	for _, event := range result.TraceEvents {
+		tids[event.Name] = event.Tid
+	}
+	// icon is not nested in copy, so, it is placed on another thread
+	g.Expect(tids).To(Equal(map[string]int{"run": 1, "copy": 1, "icon": 2, "archive": 1}))
+	g.Expect(result.TraceEvents[1].Name).To(Equal("copy"))
+	g.Expect(result.TraceEvents[1].Ts).To(Equal(int64(5000)))
+	g.Expect(result.TraceEvents[1].Dur).To(Equal(int64(15000)))
+	g.Expect(result.TraceEvents[1].Args).To(Equal(map[string]interface{}{"from": "app"}))
+}
+
+func TestOtlp(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	span := &Span{Name: "archive", TraceId: newId(16), SpanId: newId(8), ParentId: newId(8), StartTime: time.Unix(10, 5), EndTime: time.Unix(12, 0), Error: "disk full"}
+	span.SetAttribute("format", "zip")
+	span.SetAttribute("compressionLevel", 9)
+
+	dir, err := ioutil.TempDir("", "trace")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "trace.json")
+	g.Expect(WriteOtlpFile(file, []*Span{span})).To(Succeed())
+	spans, err := ReadOtlpFile(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(spans).To(HaveLen(1))
+	g.Expect(spans[0].SpanId).To(Equal(span.SpanId))
+	g.Expect(spans[0].ParentId).To(Equal(span.ParentId))
+	g.Expect(spans[0].StartTime.Equal(span.StartTime)).To(BeTrue())
+	g.Expect(spans[0].Error).To(Equal("disk full"))
+	g.Expect(spans[0].Attributes).To(Equal(map[string]interface{}{"format": "zip", "compressionLevel": int64(9)}))
+
+	var body []byte
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		path = request.URL.Path
+		body, _ = ioutil.ReadAll(request.Body)
+	}))
+	defer server.Close()
+
+	g.Expect(ExportOtlp(server.URL+"/", []*Span{span})).To(Succeed())
+	g.Expect(path).To(Equal("/v1/traces"))
+	g.Expect(string(body)).To(ContainSubstring(`"name":"archive","kind":1,"startTimeUnixNano":"10000000005","endTimeUnixNano":"12000000000"`))
+	g.Expect(string(body)).To(ContainSubstring(`{"key":"service.name","value":{"stringValue":"app-builder"}}`))
+}
@@ -0,0 +1,567 @@
+package universal
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/asar"
+	"github.com/develar/app-builder/pkg/fs"
+	"github.com/develar/app-builder/pkg/macho"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+	"github.com/develar/go-fs-util"
+)
+
+type MergeOptions struct {
+	X64App   string
+	Arm64App string
+	Output   string
+
+	// patterns (as for asar unpack) of paths relative to the app (asar entries - <asar path>/<entry>)
+	// files that may differ, the version of the specified arch is used
+	PickX64   []string
+	PickArm64 []string
+	// files and dirs that may exist only in one of the apps
+	SingleArch []string
+}
+
+type MergeReport struct {
+	Output string `json:"output"`
+	// Mach-O files merged into fat ones
+	Lipo []string `json:"lipo"`
+	// merged asar archives
+	Asar []string `json:"asar"`
+	// files that differ or exist only in one app, but allowed by rules
+	Picked []string `json:"picked"`
+	// number of identical files
+	Copied    int        `json:"copied"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+type Conflict struct {
+	Path string `json:"path"`
+	// missing-x64, missing-arm64, type, link, arch (Mach-O files of the same arch) or content
+	Kind  string    `json:"kind"`
+	X64   *FileInfo `json:"x64,omitempty"`
+	Arm64 *FileInfo `json:"arm64,omitempty"`
+}
+
+type FileInfo struct {
+	// file, dir or link
+	Type   string   `json:"type"`
+	Size   int64    `json:"size,omitempty"`
+	Sha256 string   `json:"sha256,omitempty"`
+	Archs  []string `json:"archs,omitempty"`
+	Link   string   `json:"link,omitempty"`
+}
+
+// MergeConflictError is returned if apps cannot be merged, conflicts are listed in the report
+type MergeConflictError struct {
+	Conflicts int
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("cannot create universal app: %d conflicting files (see report, use pick and single arch rules if difference is expected)", e.Conflicts)
+}
+
+func (e *MergeConflictError) ErrorCode() string {
+	return "ERR_UNIVERSAL_CONFLICT"
+}
+
+type merger struct {
+	pickX64    asar.Globs
+	pickArm64  asar.Globs
+	singleArch asar.Globs
+
+	report *MergeReport
+	// path of merged asar (relative to the app) to header hash
+	asarHashes map[string]string
+	infoPlists []string
+}
+
+func ConfigureCommand(app *kingpin.Application) {
+	command := app.Command("universal", "Merge x64 and arm64 macOS apps into universal app: Mach-O files are merged into fat ones, asar archives are merged, other files must be identical (report is written as JSON).")
+	options := MergeOptions{}
+	command.Flag("x64", "The x64 app.").Required().StringVar(&options.X64App)
+	command.Flag("arm64", "The arm64 app.").Required().StringVar(&options.Arm64App)
+	command.Flag("output", "The output app (removed if exists).").Short('o').Required().StringVar(&options.Output)
+	command.Flag("pick-x64", "The pattern of files that may differ, x64 version is used.").StringsVar(&options.PickX64)
+	command.Flag("pick-arm64", "The pattern of files that may differ, arm64 version is used.").StringsVar(&options.PickArm64)
+	command.Flag("single-arch", "The pattern of files that may exist only in one app.").StringsVar(&options.SingleArch)
+
+	command.Action(func(context *kingpin.ParseContext) error {
+		report, err := Merge(options)
+		if report != nil {
+			writeErr := util.WriteJsonToStdOut(report)
+			if err == nil {
+				err = writeErr
+			}
+		}
+		return err
+	})
+}
+
+// Merge returns report and MergeConflictError if there are conflicts (output is removed in this case)
+func Merge(options MergeOptions) (*MergeReport, error) {
+	t := &merger{
+		report: &MergeReport{
+			Output:    options.Output,
+			Lipo:      []string{},
+			Asar:      []string{},
+			Picked:    []string{},
+			Conflicts: []Conflict{},
+		},
+		asarHashes: make(map[string]string),
+	}
+
+	var err error
+	t.pickX64, err = asar.CompileGlobs(options.PickX64)
+	if err != nil {
+		return nil, err
+	}
+	t.pickArm64, err = asar.CompileGlobs(options.PickArm64)
+	if err != nil {
+		return nil, err
+	}
+	t.singleArch, err = asar.CompileGlobs(options.SingleArch)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.RemoveAll(options.Output)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = t.mergeDir(options.X64App, options.Arm64App, options.Output, "")
+	if err == nil && len(t.report.Conflicts) == 0 {
+		err = t.updateAsarIntegrity(options.Output)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(t.report.Conflicts) != 0 {
+		err = os.RemoveAll(options.Output)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return t.report, &MergeConflictError{Conflicts: len(t.report.Conflicts)}
+	}
+
+	log.WithFields(log.Fields{
+		"output": options.Output,
+		"lipo":   len(t.report.Lipo),
+		"asar":   len(t.report.Asar),
+		"copied": t.report.Copied,
+	}).Debug("universal app created")
+	return t.report, nil
+}
+
+// prefix is the path of the merged dir in the report (the path of asar archive for its content)
+func (t *merger) mergeDir(x64Dir string, arm64Dir string, outDir string, prefix string) error {
+	x64Entries, err := collectEntries(x64Dir)
+	if err != nil {
+		return err
+	}
+	arm64Entries, err := collectEntries(arm64Dir)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(x64Entries))
+	for name := range x64Entries {
+		names = append(names, name)
+	}
+	for name := range arm64Entries {
+		if x64Entries[name] == nil {
+			names = append(names, name)
+		}
+	}
+	// parent is always before children
+	sort.Strings(names)
+
+	var skippedDirs []string
+	for _, name := range names {
+		if isInDirs(name, skippedDirs) {
+			continue
+		}
+
+		x64Info := x64Entries[name]
+		arm64Info := arm64Entries[name]
+		x64File := filepath.Join(x64Dir, filepath.FromSlash(name))
+		arm64File := filepath.Join(arm64Dir, filepath.FromSlash(name))
+		outFile := filepath.Join(outDir, filepath.FromSlash(name))
+		path := prefix + name
+
+		if x64Info == nil || arm64Info == nil {
+			// children are not checked separately
+			skippedDirs = append(skippedDirs, name)
+			err = t.mergeSingleArch(path, x64File, x64Info, arm64File, arm64Info, outFile)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		x64Type := entryType(x64Info)
+		if x64Type != entryType(arm64Info) {
+			skippedDirs = append(skippedDirs, name)
+			t.addConflict(path, "type", x64File, x64Info, arm64File, arm64Info)
+			continue
+		}
+
+		switch x64Type {
+		case "dir":
+			err = os.MkdirAll(outFile, x64Info.Mode().Perm())
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+		case "link":
+			x64Link, err := os.Readlink(x64File)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			arm64Link, err := os.Readlink(arm64File)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if x64Link != arm64Link {
+				t.addConflict(path, "link", x64File, x64Info, arm64File, arm64Info)
+				continue
+			}
+			err = os.Symlink(x64Link, outFile)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+		default:
+			isMergedAsar, err := t.mergeFile(path, x64File, x64Info, arm64File, outFile)
+			if err != nil {
+				return err
+			}
+			// unpacked files are written by asar packer
+			if isMergedAsar {
+				skippedDirs = append(skippedDirs, name+".unpacked")
+			}
+		}
+	}
+	return nil
+}
+
+func (t *merger) mergeSingleArch(path string, x64File string, x64Info os.FileInfo, arm64File string, arm64Info os.FileInfo, outFile string) error {
+	if t.singleArch.Match(path) {
+		from := x64File
+		if x64Info == nil {
+			from = arm64File
+		}
+		t.report.Picked = append(t.report.Picked, path)
+		return fs.CopyDirOrFile(from, outFile)
+	}
+
+	kind := "missing-arm64"
+	if x64Info == nil {
+		kind = "missing-x64"
+	}
+	t.addConflict(path, kind, x64File, x64Info, arm64File, arm64Info)
+	return nil
+}
+
+// returns true if file is asar archive merged from content of both archives
+func (t *merger) mergeFile(path string, x64File string, x64Info os.FileInfo, arm64File string, outFile string) (bool, error) {
+	x64Hash, err := fs.HashFile(x64File, "sha256")
+	if err != nil {
+		return false, err
+	}
+	arm64Hash, err := fs.HashFile(arm64File, "sha256")
+	if err != nil {
+		return false, err
+	}
+
+	if string(x64Hash) == string(arm64Hash) {
+		t.report.Copied++
+		return false, errors.WithStack(fsutil.CopyFile(x64File, outFile, x64Info.Mode()))
+	}
+
+	switch {
+	case t.pickX64.Match(path):
+		t.report.Picked = append(t.report.Picked, path)
+		return false, errors.WithStack(fsutil.CopyFile(x64File, outFile, x64Info.Mode()))
+	case t.pickArm64.Match(path):
+		t.report.Picked = append(t.report.Picked, path)
+		return false, errors.WithStack(fsutil.CopyFile(arm64File, outFile, x64Info.Mode()))
+	}
+
+	isX64MachO, err := macho.IsMachOFile(x64File)
+	if err != nil {
+		return false, err
+	}
+	isArm64MachO, err := macho.IsMachOFile(arm64File)
+	if err != nil {
+		return false, err
+	}
+	if isX64MachO && isArm64MachO {
+		return false, t.lipo(path, x64File, arm64File, outFile)
+	}
+
+	if strings.HasSuffix(path, ".asar") {
+		return true, t.mergeAsar(path, x64File, arm64File, outFile)
+	}
+
+	if filepath.Base(path) == "Info.plist" {
+		isEqual, err := isEqualIgnoringAsarIntegrity(x64File, arm64File)
+		if err != nil {
+			return false, err
+		}
+		if isEqual {
+			// integrity of merged asar is set when all files are merged
+			t.infoPlists = append(t.infoPlists, path)
+			return false, errors.WithStack(fsutil.CopyFile(x64File, outFile, x64Info.Mode()))
+		}
+	}
+
+	t.addConflict(path, "content", x64File, x64Info, arm64File, nil)
+	return false, nil
+}
+
+func (t *merger) lipo(path string, x64File string, arm64File string, outFile string) error {
+	x64Archs, err := readArchs(x64File)
+	if err != nil {
+		return err
+	}
+	arm64Archs, err := readArchs(arm64File)
+	if err != nil {
+		return err
+	}
+
+	for _, arch := range x64Archs {
+		for _, arm64Arch := range arm64Archs {
+			if arch == arm64Arch {
+				t.report.Conflicts = append(t.report.Conflicts, Conflict{
+					Path:  path,
+					Kind:  "arch",
+					X64:   &FileInfo{Type: "file", Archs: x64Archs},
+					Arm64: &FileInfo{Type: "file", Archs: arm64Archs},
+				})
+				return nil
+			}
+		}
+	}
+
+	err = macho.Lipo([]string{x64File, arm64File}, outFile)
+	if err != nil {
+		return err
+	}
+	t.report.Lipo = append(t.report.Lipo, path)
+	return nil
+}
+
+// archives are extracted, merged as dirs (native modules are merged into fat files) and packed again, unpacked files are kept unpacked
+func (t *merger) mergeAsar(path string, x64File string, arm64File string, outFile string) error {
+	unpackedNames := make(map[string]bool)
+	var extractedDirs []string
+	for _, file := range []string{x64File, arm64File} {
+		archive, err := asar.ReadArchive(file)
+		if err != nil {
+			return err
+		}
+
+		err = archive.Walk(func(name string, node *asar.Node) error {
+			if node.Unpacked {
+				unpackedNames[name] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		extractedDir, err := util.DefaultTempDirManager.TempDir("asar")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(extractedDir)
+
+		err = archive.Extract("", extractedDir)
+		if err != nil {
+			return err
+		}
+		extractedDirs = append(extractedDirs, extractedDir)
+	}
+
+	mergedDir, err := util.DefaultTempDirManager.TempDir("asar")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(mergedDir)
+
+	conflictCount := len(t.report.Conflicts)
+	err = t.mergeDir(extractedDirs[0], extractedDirs[1], mergedDir, path+"/")
+	if err != nil || len(t.report.Conflicts) != conflictCount {
+		return err
+	}
+
+	err = asar.PackWithUnpacked(mergedDir, outFile, unpackedNames)
+	if err != nil {
+		return err
+	}
+
+	archive, err := asar.ReadArchive(outFile)
+	if err != nil {
+		return err
+	}
+	t.asarHashes[path] = archive.HeaderHash
+	t.report.Asar = append(t.report.Asar, path)
+	return nil
+}
+
+// ElectronAsarIntegrity of Info.plist (keys are relative to Contents, e.g. Resources/app.asar) is updated for merged archives
+func (t *merger) updateAsarIntegrity(outDir string) error {
+	if len(t.asarHashes) == 0 {
+		return nil
+	}
+
+	for _, path := range t.infoPlists {
+		file := filepath.Join(outDir, filepath.FromSlash(path))
+		dict, format, err := plist.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		integrity, ok := dict[asar.InfoPlistIntegrityKey].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		contentsDir := strings.TrimSuffix(path, "Info.plist")
+		for key := range integrity {
+			hash, ok := t.asarHashes[contentsDir+key]
+			if ok {
+				integrity[key] = map[string]interface{}{"algorithm": "SHA256", "hash": hash}
+			}
+		}
+
+		err = plist.WriteFile(file, dict, format)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *merger) addConflict(path string, kind string, x64File string, x64Info os.FileInfo, arm64File string, arm64Info os.FileInfo) {
+	conflict := Conflict{Path: path, Kind: kind}
+	if x64Info != nil || kind == "content" {
+		conflict.X64 = describeFile(x64File)
+	}
+	if arm64Info != nil || kind == "content" {
+		conflict.Arm64 = describeFile(arm64File)
+	}
+	t.report.Conflicts = append(t.report.Conflicts, conflict)
+}
+
+// best effort, for report only
+func describeFile(file string) *FileInfo {
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil
+	}
+
+	result := &FileInfo{Type: entryType(info)}
+	switch result.Type {
+	case "link":
+		result.Link, _ = os.Readlink(file)
+	case "file":
+		result.Size = info.Size()
+		hash, err := fs.HashFile(file, "sha256")
+		if err == nil {
+			result.Sha256 = hex.EncodeToString(hash)
+		}
+		isMachO, err := macho.IsMachOFile(file)
+		if err == nil && isMachO {
+			result.Archs, _ = readArchs(file)
+		}
+	}
+	return result
+}
+
+func readArchs(file string) ([]string, error) {
+	slices, err := macho.ReadSlices(file)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(slices))
+	for _, slice := range slices {
+		result = append(result, slice.Arch())
+	}
+	return result, nil
+}
+
+func isEqualIgnoringAsarIntegrity(file1 string, file2 string) (bool, error) {
+	dict1, _, err := plist.ReadFile(file1)
+	if err != nil {
+		return false, err
+	}
+	dict2, _, err := plist.ReadFile(file2)
+	if err != nil {
+		return false, err
+	}
+
+	delete(dict1, asar.InfoPlistIntegrityKey)
+	delete(dict2, asar.InfoPlistIntegrityKey)
+	return reflect.DeepEqual(dict1, dict2), nil
+}
+
+// relative paths (forward slashes) of all entries of dir
+func collectEntries(dir string) (map[string]os.FileInfo, error) {
+	result := make(map[string]os.FileInfo)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(relativePath)] = info
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return result, nil
+}
+
+func entryType(info os.FileInfo) string {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return "link"
+	case info.IsDir():
+		return "dir"
+	default:
+		return "file"
+	}
+}
+
+func isInDirs(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package universal
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/develar/app-builder/pkg/asar"
+	"github.com/develar/app-builder/pkg/plist"
+	"github.com/develar/app-builder/pkg/util"
+	. "github.com/onsi/gomega"
+)
+
+func thinMachO(cpu macho.Cpu) []byte {
+	data := make([]byte, 32)
+	binary.LittleEndian.PutUint32(data[0:], macho.Magic64)
+	binary.LittleEndian.PutUint32(data[4:], uint32(cpu))
+	binary.LittleEndian.PutUint32(data[12:], uint32(macho.TypeExec))
+	return data
+}
+
+func createApp(g *GomegaWithT, dir string, cpu macho.Cpu, arch string) {
+	contentsDir := filepath.Join(dir, "Test.app", "Contents")
+	g.Expect(os.MkdirAll(filepath.Join(contentsDir, "MacOS"), 0755)).To(Succeed())
+	g.Expect(os.MkdirAll(filepath.Join(contentsDir, "Resources"), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(contentsDir, "MacOS", "Test"), thinMachO(cpu), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(contentsDir, "Resources", "en.lproj"), []byte("strings"), 0644)).To(Succeed())
+
+	appDir := filepath.Join(dir, "app")
+	g.Expect(os.MkdirAll(filepath.Join(appDir, "native"), 0755)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "index.js"), []byte("console.log()"), 0644)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "native", "addon.node"), thinMachO(cpu), 0644)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(appDir, "native", "arch-"+arch+".txt"), []byte(arch), 0644)).To(Succeed())
+	asarFile := filepath.Join(contentsDir, "Resources", "app.asar")
+	g.Expect(asar.Pack(appDir, asarFile, []string{"*.node"})).To(Succeed())
+
+	archive, err := asar.ReadArchive(asarFile)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(plist.WriteFile(filepath.Join(contentsDir, "Info.plist"), map[string]interface{}{
+		"CFBundleName": "Test",
+		asar.InfoPlistIntegrityKey: map[string]interface{}{
+			"Resources/app.asar": map[string]interface{}{"algorithm": "SHA256", "hash": archive.HeaderHash},
+		},
+	}, plist.XmlFormat)).To(Succeed())
+}
+
+func TestMerge(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "universal")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	createApp(g, filepath.Join(tmpDir, "x64"), macho.CpuAmd64, "x64")
+	createApp(g, filepath.Join(tmpDir, "arm64"), macho.CpuArm64, "arm64")
+
+	options := MergeOptions{
+		X64App:   filepath.Join(tmpDir, "x64", "Test.app"),
+		Arm64App: filepath.Join(tmpDir, "arm64", "Test.app"),
+		Output:   filepath.Join(tmpDir, "out", "Test.app"),
+	}
+	report, err := Merge(options)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err).To(BeAssignableToTypeOf(&MergeConflictError{}))
+	g.Expect(report.Conflicts).To(HaveLen(2))
+	g.Expect(report.Conflicts[0].Path).To(Equal("Contents/Resources/app.asar/native/arch-arm64.txt"))
+	g.Expect(report.Conflicts[0].Kind).To(Equal("missing-x64"))
+	g.Expect(report.Conflicts[0].X64).To(BeNil())
+	g.Expect(report.Conflicts[0].Arm64.Size).To(Equal(int64(5)))
+	g.Expect(report.Conflicts[1].Kind).To(Equal("missing-arm64"))
+	g.Expect(options.Output).NotTo(BeAnExistingFile())
+
+	options.SingleArch = []string{"**/arch-*.txt"}
+	report, err = Merge(options)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report.Conflicts).To(BeEmpty())
+	g.Expect(report.Lipo).To(Equal([]string{"Contents/MacOS/Test", "Contents/Resources/app.asar/native/addon.node"}))
+	g.Expect(report.Asar).To(Equal([]string{"Contents/Resources/app.asar"}))
+	g.Expect(report.Picked).To(HaveLen(2))
+
+	archs, err := readArchs(filepath.Join(options.Output, "Contents", "MacOS", "Test"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(archs).To(Equal([]string{"x86_64", "arm64"}))
+
+	// native module is kept unpacked
+	archive, err := asar.ReadArchive(filepath.Join(options.Output, "Contents", "Resources", "app.asar"))
+	g.Expect(err).NotTo(HaveOccurred())
+	node, err := archive.Find("native/addon.node")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(node.Unpacked).To(BeTrue())
+	g.Expect(filepath.Join(options.Output, "Contents", "Resources", "app.asar.unpacked", "native", "addon.node")).To(BeAnExistingFile())
+	node, err = archive.Find("native/arch-arm64.txt")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(node).NotTo(BeNil())
+
+	dict, _, err := plist.ReadFile(filepath.Join(options.Output, "Contents", "Info.plist"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(dict[asar.InfoPlistIntegrityKey]).To(Equal(map[string]interface{}{
+		"Resources/app.asar": map[string]interface{}{"algorithm": "SHA256", "hash": archive.HeaderHash},
+	}))
+}
+
+func TestMergeContentConflict(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := util.TempDir("", "universal")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	for _, arch := range []string{"x64", "arm64"} {
+		g.Expect(os.MkdirAll(filepath.Join(tmpDir, arch), 0755)).To(Succeed())
+		g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, arch, "config.json"), []byte(arch), 0644)).To(Succeed())
+	}
+
+	options := MergeOptions{X64App: filepath.Join(tmpDir, "x64"), Arm64App: filepath.Join(tmpDir, "arm64"), Output: filepath.Join(tmpDir, "out")}
+	report, err := Merge(options)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(report.Conflicts).To(HaveLen(1))
+	g.Expect(report.Conflicts[0].Kind).To(Equal("content"))
+	g.Expect(report.Conflicts[0].X64.Size).To(Equal(int64(3)))
+	g.Expect(report.Conflicts[0].Arm64.Sha256).NotTo(Equal(report.Conflicts[0].X64.Sha256))
+
+	options.PickArm64 = []string{"config.json"}
+	report, err = Merge(options)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report.Picked).To(Equal([]string{"config.json"}))
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "out", "config.json"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("arm64"))
+}
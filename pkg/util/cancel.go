@@ -4,21 +4,74 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/apex/log"
 )
 
+// exit codes of cancelled invocation, the same as shell reports for the process killed by signal (128 + signal number)
+const (
+	ExitCodeInterrupted = 130
+	ExitCodeTerminated  = 143
+)
+
+var rootContext context.Context
+var rootContextOnce sync.Once
+
+var cancelSignalMutex sync.Mutex
+var cancelSignal os.Signal
+
+// RootContext is cancelled on SIGINT or SIGTERM, long operations (downloads, archives, icon conversion) must be derived from it.
+// Process exits after operation is stopped and temp dir is removed (main), if signal is received twice - without waiting for operation.
+func RootContext() context.Context {
+	rootContextOnce.Do(func() {
+		var cancel context.CancelFunc
+		rootContext, cancel = context.WithCancel(context.Background())
+		signals := make(chan os.Signal, 2)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go onCancelSignal(signals, cancel)
+	})
+	return rootContext
+}
+
 func CreateContext() (context.Context, context.CancelFunc) {
-	downloadContext, cancel := context.WithCancel(context.Background())
-	go onCancelSignal(cancel)
-	return downloadContext, cancel
+	return context.WithCancel(RootContext())
 }
 
-func onCancelSignal(cancel context.CancelFunc) {
-	defer cancel()
-	signals := make(chan os.Signal, 2)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+func onCancelSignal(signals chan os.Signal, cancel context.CancelFunc) {
 	sig := <-signals
-	log.Infof("%v: canceling...\n", sig)
+	cancelSignalMutex.Lock()
+	cancelSignal = sig
+	cancelSignalMutex.Unlock()
+
+	log.Infof("%v: canceling...", sig)
+	cancel()
+
+	// not every code path checks context (e.g. file copying), second signal forces exit
+	sig = <-signals
+	log.Warnf("%v: operation is not stopped yet, exiting", sig)
+	DefaultTempDirManager.Cleanup()
+	os.Exit(CancelExitCode())
+}
+
+// IsCancelled returns true if invocation is cancelled by SIGINT or SIGTERM
+func IsCancelled() bool {
+	cancelSignalMutex.Lock()
+	defer cancelSignalMutex.Unlock()
+	return cancelSignal != nil
+}
+
+// CancelExitCode returns 130 for SIGINT and 143 for SIGTERM, 1 if invocation is not cancelled
+func CancelExitCode() int {
+	cancelSignalMutex.Lock()
+	defer cancelSignalMutex.Unlock()
+	switch cancelSignal {
+	case nil:
+		return 1
+	case syscall.SIGINT:
+		return ExitCodeInterrupted
+	default:
+		return ExitCodeTerminated
+	}
 }
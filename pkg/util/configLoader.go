@@ -0,0 +1,242 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/develar/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var envReferenceRegExp = regexp.MustCompile(`\$\{env\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadConfig reads configuration file (JSON, JSON5, YAML or TOML) and decodes it into the result (as JSON),
+// see LoadConfigValue about interpolation and extends
+func LoadConfig(file string, result interface{}) error {
+	value, err := LoadConfigValue(file)
+	if err != nil {
+		return err
+	}
+
+	// jsoniter cannot marshal map[string]interface{}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = json.Unmarshal(data, result)
+	if err != nil {
+		return errors.WithMessage(err, "cannot parse "+file)
+	}
+	return nil
+}
+
+// LoadConfigValue reads configuration object from the file, ${env.NAME} in string values is replaced with the value of environment variable.
+// extends (file or list of files, relative to the dir of configuration file) is applied as base configuration, objects are merged deeply and other values are overridden.
+func LoadConfigValue(file string) (map[string]interface{}, error) {
+	return loadConfigValue(file, nil)
+}
+
+func loadConfigValue(file string, parents []string) (map[string]interface{}, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, parent := range parents {
+		if parent == file {
+			return nil, errors.Errorf("cyclic extends: %s -> %s", strings.Join(parents, " -> "), file)
+		}
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	value, err := ParseConfig(data, file)
+	if err != nil {
+		return nil, err
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("%s must contain an object", file)
+	}
+
+	interpolated, err := InterpolateEnv(object)
+	if err != nil {
+		return nil, errors.WithMessage(err, file)
+	}
+	object = interpolated.(map[string]interface{})
+
+	var extends []string
+	switch v := object["extends"].(type) {
+	case nil:
+	case string:
+		extends = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			name, ok := item.(string)
+			if !ok {
+				return nil, errors.Errorf("%s: extends must be a string or an array of strings", file)
+			}
+			extends = append(extends, name)
+		}
+	default:
+		return nil, errors.Errorf("%s: extends must be a string or an array of strings", file)
+	}
+	delete(object, "extends")
+
+	if len(extends) == 0 {
+		return object, nil
+	}
+
+	chain := append(parents[:len(parents):len(parents)], file)
+	result := make(map[string]interface{})
+	for _, name := range extends {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(file), name)
+		}
+
+		base, err := loadConfigValue(name, chain)
+		if err != nil {
+			return nil, err
+		}
+		result = MergeConfigValues(result, base)
+	}
+	return MergeConfigValues(result, object), nil
+}
+
+// ParseConfig parses configuration according to the file extension, JSON is expected for unknown extension
+func ParseConfig(data []byte, file string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json5":
+		value, err = ParseJson5(data)
+
+	case ".toml":
+		value, err = ParseToml(data)
+
+	case ".yml", ".yaml":
+		var yamlValue interface{}
+		err = yaml.Unmarshal(data, &yamlValue)
+		if err == nil {
+			value, err = YamlToJsonValue(yamlValue)
+		}
+
+	default:
+		err = json.Unmarshal(data, &value)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", file)
+	}
+	return value, nil
+}
+
+// YamlToJsonValue converts YAML maps (interface{} keys) and numbers to the same values as encoding/json produces
+func YamlToJsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted, err := YamlToJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[fmt.Sprint(key)] = converted
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for index, item := range v {
+			converted, err := YamlToJsonValue(item)
+			if err != nil {
+				return nil, err
+			}
+			result[index] = converted
+		}
+		return result, nil
+
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case float32:
+		return float64(v), nil
+	case nil, bool, float64, string:
+		return v, nil
+	default:
+		return nil, errors.Errorf("unsupported YAML value %v (%T)", value, value)
+	}
+}
+
+// InterpolateEnv replaces ${env.NAME} in string values (not keys), error is returned if environment variable is not defined
+func InterpolateEnv(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var err error
+		result := envReferenceRegExp.ReplaceAllStringFunc(v, func(reference string) string {
+			name := envReferenceRegExp.FindStringSubmatch(reference)[1]
+			envValue, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = errors.Errorf("environment variable %s is not defined", name)
+			}
+			return envValue
+		})
+		return result, err
+
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted, err := InterpolateEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = converted
+		}
+		return result, nil
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for index, item := range v {
+			converted, err := InterpolateEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			result[index] = converted
+		}
+		return result, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// MergeConfigValues returns base overridden by override, objects are merged deeply, arrays and other values are replaced
+func MergeConfigValues(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range override {
+		baseObject, isBaseObject := result[key].(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if isBaseObject && isObject {
+			result[key] = MergeConfigValues(baseObject, object)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
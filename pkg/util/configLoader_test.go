@@ -0,0 +1,150 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseJson5(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	value, err := ParseJson5([]byte(`// comment
+	{
+		unquoted: 'single "quoted"',
+		"quoted": "line \
+continuation é 😀",
+		/* block
+		   comment */
+		hex: 0xFF,
+		numbers: [+1, -.5, 2., 1e3,],
+		nested: {flag: true, empty: null},
+	}`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal(map[string]interface{}{
+		"unquoted": `single "quoted"`,
+		"quoted":   "line continuation é 😀",
+		"hex":      float64(255),
+		"numbers":  []interface{}{float64(1), -0.5, float64(2), float64(1000)},
+		"nested":   map[string]interface{}{"flag": true, "empty": nil},
+	}))
+
+	_, err = ParseJson5([]byte("{a: 1\n b: 2}"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("line 2"))
+
+	_, err = ParseJson5([]byte("{a: 1} x"))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestParseToml(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	value, err := ParseToml([]byte(`# comment
+title = "Test \"app\"" # trailing comment
+size = 1_024
+mode = 0o755
+ratio = 1.5
+date = 1979-05-27T07:32:00Z
+site."example.com" = true
+list = [
+  'literal\path',
+  """multi
+line""",
+]
+point = { x = 1, y = -2 }
+
+[window]
+width = 540
+
+[window.inner]
+height = 380
+
+[[contents]]
+name = "a"
+
+[[contents]]
+name = "b"
+`))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal(map[string]interface{}{
+		"title": `Test "app"`,
+		"size":  float64(1024),
+		"mode":  float64(493),
+		"ratio": 1.5,
+		"date":  "1979-05-27T07:32:00Z",
+		"site":  map[string]interface{}{"example.com": true},
+		"list":  []interface{}{`literal\path`, "multi\nline"},
+		"point": map[string]interface{}{"x": float64(1), "y": float64(-2)},
+		"window": map[string]interface{}{
+			"width": float64(540),
+			"inner": map[string]interface{}{"height": float64(380)},
+		},
+		"contents": []interface{}{
+			map[string]interface{}{"name": "a"},
+			map[string]interface{}{"name": "b"},
+		},
+	}))
+
+	_, err = ParseToml([]byte("a = 1\na = 2\n"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("line 2"))
+
+	_, err = ParseToml([]byte("a = 1 b = 2\n"))
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestLoadConfig(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	tmpDir, err := ioutil.TempDir("", "config-loader")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(tmpDir)
+
+	g.Expect(os.Setenv("CONFIG_LOADER_TEST_TITLE", "From Env")).To(Succeed())
+	defer os.Unsetenv("CONFIG_LOADER_TEST_TITLE")
+
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "base.toml"), []byte("format = \"UDZO\"\n[window]\nwidth = 540\nheight = 380\n"), 0644)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "common.json5"), []byte("{iconSize: 80, contents: [{x: 1, y: 2}]}"), 0644)).To(Succeed())
+	file := filepath.Join(tmpDir, "dmg.yml")
+	g.Expect(ioutil.WriteFile(file, []byte("extends: [base.toml, common.json5]\ntitle: ${env.CONFIG_LOADER_TEST_TITLE} 1.0\nwindow:\n  height: 400\ncontents:\n  - x: 3\n    y: 4\n"), 0644)).To(Succeed())
+
+	var config struct {
+		Title    string `json:"title"`
+		Format   string `json:"format"`
+		IconSize int    `json:"iconSize"`
+		Window   struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"window"`
+		Contents []struct {
+			X int `json:"x"`
+			Y int `json:"y"`
+		} `json:"contents"`
+	}
+	g.Expect(LoadConfig(file, &config)).To(Succeed())
+	g.Expect(config.Title).To(Equal("From Env 1.0"))
+	g.Expect(config.Format).To(Equal("UDZO"))
+	g.Expect(config.IconSize).To(Equal(80))
+	g.Expect(config.Window.Width).To(Equal(540))
+	g.Expect(config.Window.Height).To(Equal(400))
+	// arrays are not merged
+	g.Expect(config.Contents).To(HaveLen(1))
+	g.Expect(config.Contents[0].X).To(Equal(3))
+
+	// undefined environment variable
+	g.Expect(ioutil.WriteFile(file, []byte("title: ${env.CONFIG_LOADER_TEST_UNDEFINED}\n"), 0644)).To(Succeed())
+	err = LoadConfig(file, &config)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("CONFIG_LOADER_TEST_UNDEFINED"))
+
+	// cyclic extends
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "a.json"), []byte(`{"extends": "b.json"}`), 0644)).To(Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(tmpDir, "b.json"), []byte(`{"extends": "a.json"}`), 0644)).To(Succeed())
+	_, err = LoadConfigValue(filepath.Join(tmpDir, "a.json"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("cyclic extends"))
+}
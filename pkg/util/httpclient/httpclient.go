@@ -0,0 +1,66 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/develar/app-builder/pkg/util"
+)
+
+// URL (http, https or file) or path of PAC file, if set, PAC is used instead of HTTP(S)_PROXY and npm proxy settings
+const pacUrlEnvName = "ELECTRON_BUILDER_PROXY_PAC_URL"
+
+var (
+	pacOnce         sync.Once
+	loadedPacScript *pacScript
+)
+
+// all network operations (download, publish, remote build) must use transport created by this function
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: Proxy,
+	}
+}
+
+func NewClient() *http.Client {
+	return &http.Client{
+		Transport: NewTransport(),
+	}
+}
+
+// NO_PROXY=* disables proxy, PAC file (if configured) has priority over HTTP_PROXY, HTTPS_PROXY and npm proxy settings
+func Proxy(request *http.Request) (*url.URL, error) {
+	if os.Getenv("NO_PROXY") == "*" {
+		return nil, nil
+	}
+
+	script := getPacScript()
+	if script != nil {
+		return script.findProxy(request.URL)
+	}
+	return util.ProxyFromEnvironmentAndNpm(request)
+}
+
+func getPacScript() *pacScript {
+	pacOnce.Do(func() {
+		pacUrl := os.Getenv(pacUrlEnvName)
+		if len(pacUrl) == 0 {
+			return
+		}
+
+		script, err := loadPacScript(pacUrl)
+		if err != nil {
+			// not fatal - proxy environment variables are used as fallback
+			log.WithFields(log.Fields{
+				"url":   pacUrl,
+				"error": err,
+			}).Warn("cannot load PAC file, proxy environment variables are used instead")
+			return
+		}
+		loadedPacScript = script
+	})
+	return loadedPacScript
+}
@@ -0,0 +1,502 @@
+package httpclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/develar/app-builder/pkg/util"
+	"github.com/develar/errors"
+)
+
+// There is no JavaScript engine in dependencies, so, only declarative subset of PAC is supported:
+//
+//	function FindProxyForURL(url, host) {
+//	  if (isPlainHostName(host) || dnsDomainIs(host, ".corp.example.com")) return "DIRECT";
+//	  if (shExpMatch(url, "http://*.example.com/*")) { return "PROXY a:8080; DIRECT"; } else return "SOCKS b:1080";
+//	  return "PROXY proxy:8080";
+//	}
+//
+// Conditions can use !, &&, || and parentheses; functions: isPlainHostName, dnsDomainIs, localHostOrDomainIs, shExpMatch, isInNet (IP hosts only).
+// Anything else is reported as error on load (and proxy environment variables are used instead).
+type pacScript struct {
+	body pacStatement
+}
+
+type pacStatement func(url string, host string) (string, bool)
+type pacCondition func(url string, host string) bool
+
+func loadPacScript(pacUrl string) (*pacScript, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(pacUrl, "http://") || strings.HasPrefix(pacUrl, "https://") {
+		// PAC file itself is not downloaded using proxy
+		client := &http.Client{Timeout: 30 * time.Second}
+		var response *http.Response
+		response, err = client.Get(pacUrl)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		defer util.Close(response.Body)
+		if response.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("cannot download PAC file %s: %s", pacUrl, response.Status)
+		}
+		data, err = ioutil.ReadAll(response.Body)
+	} else {
+		data, err = ioutil.ReadFile(strings.TrimPrefix(pacUrl, "file://"))
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return parsePacScript(string(data))
+}
+
+func (t *pacScript) findProxy(requestUrl *url.URL) (*url.URL, error) {
+	host := requestUrl.Hostname()
+	result, ok := t.body(requestUrl.String(), host)
+	if !ok {
+		return nil, nil
+	}
+	return parsePacResult(result)
+}
+
+// "PROXY a:8080; SOCKS b:1080; DIRECT" - only the first entry is used, Go transport doesn't support failover
+func parsePacResult(result string) (*url.URL, error) {
+	entry := strings.TrimSpace(strings.SplitN(result, ";", 2)[0])
+	fields := strings.Fields(entry)
+	if len(fields) == 0 || strings.EqualFold(fields[0], "DIRECT") {
+		return nil, nil
+	}
+	if len(fields) != 2 {
+		return nil, errors.Errorf("unsupported PAC result: %s", result)
+	}
+
+	var scheme string
+	switch strings.ToUpper(fields[0]) {
+	case "PROXY", "HTTP":
+		scheme = "http"
+	case "HTTPS":
+		scheme = "https"
+	case "SOCKS", "SOCKS5":
+		scheme = "socks5"
+	default:
+		return nil, errors.Errorf("unsupported PAC result: %s", result)
+	}
+	return &url.URL{Scheme: scheme, Host: fields[1]}, nil
+}
+
+type pacToken struct {
+	kind  byte // i - identifier, s - string, p - punctuation
+	value string
+}
+
+func tokenizePac(script string) ([]pacToken, error) {
+	var result []pacToken
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(script[i:], "//"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end == -1 {
+				i = len(script)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end == -1 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(script[i+1:], c)
+			if end == -1 {
+				return nil, errors.New("unterminated string")
+			}
+			result = append(result, pacToken{'s', script[i+1 : i+1+end]})
+			i += end + 2
+		case strings.HasPrefix(script[i:], "||") || strings.HasPrefix(script[i:], "&&"):
+			result = append(result, pacToken{'p', script[i : i+2]})
+			i += 2
+		case strings.IndexByte("(){};,!", c) != -1:
+			result = append(result, pacToken{'p', string(c)})
+			i++
+		case c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+			start := i
+			for i < len(script) && (script[i] == '_' || script[i] == '$' || (script[i] >= 'a' && script[i] <= 'z') || (script[i] >= 'A' && script[i] <= 'Z') || (script[i] >= '0' && script[i] <= '9')) {
+				i++
+			}
+			result = append(result, pacToken{'i', script[start:i]})
+		default:
+			return nil, errors.Errorf("unsupported character %q at %d", c, i)
+		}
+	}
+	return result, nil
+}
+
+type pacParser struct {
+	tokens []pacToken
+	index  int
+
+	urlParam  string
+	hostParam string
+}
+
+func parsePacScript(script string) (*pacScript, error) {
+	tokens, err := tokenizePac(script)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot parse PAC file")
+	}
+
+	parser := &pacParser{tokens: tokens}
+	body, err := parser.parseFunction()
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot parse PAC file (only declarative subset is supported)")
+	}
+	return &pacScript{body: body}, nil
+}
+
+func (t *pacParser) peek() pacToken {
+	if t.index >= len(t.tokens) {
+		return pacToken{}
+	}
+	return t.tokens[t.index]
+}
+
+func (t *pacParser) next() pacToken {
+	token := t.peek()
+	t.index++
+	return token
+}
+
+func (t *pacParser) isNext(value string) bool {
+	token := t.peek()
+	return token.kind != 's' && token.value == value
+}
+
+func (t *pacParser) expect(value string) error {
+	token := t.next()
+	if token.kind == 's' || token.value != value {
+		return errors.Errorf("expected %s, got %q", value, token.value)
+	}
+	return nil
+}
+
+func (t *pacParser) expectIdentifier() (string, error) {
+	token := t.next()
+	if token.kind != 'i' {
+		return "", errors.Errorf("expected identifier, got %q", token.value)
+	}
+	return token.value, nil
+}
+
+func (t *pacParser) parseFunction() (pacStatement, error) {
+	for _, value := range []string{"function", "FindProxyForURL", "("} {
+		err := t.expect(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	t.urlParam, err = t.expectIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	err = t.expect(",")
+	if err != nil {
+		return nil, err
+	}
+	t.hostParam, err = t.expectIdentifier()
+	if err != nil {
+		return nil, err
+	}
+	err = t.expect(")")
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := t.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+	if t.index < len(t.tokens) {
+		return nil, errors.Errorf("unexpected %q after FindProxyForURL", t.peek().value)
+	}
+	return body, nil
+}
+
+func (t *pacParser) parseBlock() (pacStatement, error) {
+	err := t.expect("{")
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []pacStatement
+	for !t.isNext("}") {
+		if t.index >= len(t.tokens) {
+			return nil, errors.New("unexpected end of file")
+		}
+
+		statement, err := t.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, statement)
+	}
+	t.index++
+
+	return func(url string, host string) (string, bool) {
+		for _, statement := range statements {
+			result, ok := statement(url, host)
+			if ok {
+				return result, true
+			}
+		}
+		return "", false
+	}, nil
+}
+
+func (t *pacParser) parseStatement() (pacStatement, error) {
+	switch {
+	case t.isNext("{"):
+		return t.parseBlock()
+
+	case t.isNext("return"):
+		t.index++
+		token := t.next()
+		if token.kind != 's' {
+			return nil, errors.Errorf("only string literal can be returned, got %q", token.value)
+		}
+		if t.isNext(";") {
+			t.index++
+		}
+		result := token.value
+		return func(url string, host string) (string, bool) {
+			return result, true
+		}, nil
+
+	case t.isNext("if"):
+		t.index++
+		err := t.expect("(")
+		if err != nil {
+			return nil, err
+		}
+		condition, err := t.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		err = t.expect(")")
+		if err != nil {
+			return nil, err
+		}
+
+		thenStatement, err := t.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		elseStatement := func(url string, host string) (string, bool) {
+			return "", false
+		}
+		if t.isNext("else") {
+			t.index++
+			elseStatement, err = t.parseStatement()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return func(url string, host string) (string, bool) {
+			if condition(url, host) {
+				return thenStatement(url, host)
+			}
+			return elseStatement(url, host)
+		}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported statement %q", t.peek().value)
+	}
+}
+
+func (t *pacParser) parseOr() (pacCondition, error) {
+	left, err := t.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for t.isNext("||") {
+		t.index++
+		right, err := t.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(url string, host string) bool {
+			return l(url, host) || right(url, host)
+		}
+	}
+	return left, nil
+}
+
+func (t *pacParser) parseAnd() (pacCondition, error) {
+	left, err := t.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for t.isNext("&&") {
+		t.index++
+		right, err := t.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(url string, host string) bool {
+			return l(url, host) && right(url, host)
+		}
+	}
+	return left, nil
+}
+
+func (t *pacParser) parseUnary() (pacCondition, error) {
+	if t.isNext("!") {
+		t.index++
+		condition, err := t.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(url string, host string) bool {
+			return !condition(url, host)
+		}, nil
+	}
+
+	if t.isNext("(") {
+		t.index++
+		condition, err := t.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return condition, t.expect(")")
+	}
+
+	return t.parseCall()
+}
+
+// argument is either string literal or parameter of FindProxyForURL
+type pacArgument func(url string, host string) string
+
+func (t *pacParser) parseCall() (pacCondition, error) {
+	name, err := t.expectIdentifier()
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.expect("(")
+	if err != nil {
+		return nil, err
+	}
+
+	var args []pacArgument
+	for !t.isNext(")") {
+		if len(args) > 0 {
+			err = t.expect(",")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		token := t.next()
+		switch {
+		case token.kind == 's':
+			value := token.value
+			args = append(args, func(url string, host string) string { return value })
+		case token.kind == 'i' && token.value == t.urlParam:
+			args = append(args, func(url string, host string) string { return url })
+		case token.kind == 'i' && token.value == t.hostParam:
+			args = append(args, func(url string, host string) string { return host })
+		default:
+			return nil, errors.Errorf("unsupported argument %q of %s", token.value, name)
+		}
+	}
+	t.index++
+
+	checkArgCount := func(expected int) error {
+		if len(args) != expected {
+			return errors.Errorf("%s expects %d arguments, got %d", name, expected, len(args))
+		}
+		return nil
+	}
+
+	switch name {
+	case "isPlainHostName":
+		if err := checkArgCount(1); err != nil {
+			return nil, err
+		}
+		return func(url string, host string) bool {
+			return !strings.Contains(args[0](url, host), ".")
+		}, nil
+
+	case "dnsDomainIs":
+		if err := checkArgCount(2); err != nil {
+			return nil, err
+		}
+		return func(url string, host string) bool {
+			return strings.HasSuffix(strings.ToLower(args[0](url, host)), strings.ToLower(args[1](url, host)))
+		}, nil
+
+	case "localHostOrDomainIs":
+		if err := checkArgCount(2); err != nil {
+			return nil, err
+		}
+		return func(url string, host string) bool {
+			value := strings.ToLower(args[0](url, host))
+			domain := strings.ToLower(args[1](url, host))
+			return value == domain || (!strings.Contains(value, ".") && strings.HasPrefix(domain, value+"."))
+		}, nil
+
+	case "shExpMatch":
+		if err := checkArgCount(2); err != nil {
+			return nil, err
+		}
+		return func(url string, host string) bool {
+			return shExpMatch(args[0](url, host), args[1](url, host))
+		}, nil
+
+	case "isInNet":
+		if err := checkArgCount(3); err != nil {
+			return nil, err
+		}
+		// only IP literal hosts are checked, DNS is not resolved
+		return func(url string, host string) bool {
+			ip := net.ParseIP(args[0](url, host))
+			pattern := net.ParseIP(args[1](url, host))
+			mask := net.ParseIP(args[2](url, host))
+			if ip == nil || pattern == nil || mask == nil || ip.To4() == nil || pattern.To4() == nil || mask.To4() == nil {
+				return false
+			}
+			ipMask := net.IPMask(mask.To4())
+			return ip.To4().Mask(ipMask).Equal(pattern.To4().Mask(ipMask))
+		}, nil
+
+	default:
+		return nil, errors.Errorf("unsupported function %s", name)
+	}
+}
+
+// shell expression: * matches any sequence, ? matches any single character
+func shExpMatch(value string, pattern string) bool {
+	expression := regexp.QuoteMeta(pattern)
+	expression = strings.Replace(expression, `\*`, ".*", -1)
+	expression = strings.Replace(expression, `\?`, ".", -1)
+	matched, err := regexp.MatchString(fmt.Sprintf("^%s$", expression), value)
+	return err == nil && matched
+}
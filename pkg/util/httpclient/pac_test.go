@@ -0,0 +1,57 @@
+package httpclient
+
+import (
+	"net/url"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testPac = `
+// comment
+function FindProxyForURL(url, host) {
+  /* local hosts */
+  if (isPlainHostName(host) || dnsDomainIs(host, ".corp.example.com")) {
+    return "DIRECT";
+  }
+  if (shExpMatch(url, "https://*.github.com/*") && !localHostOrDomainIs(host, "api.github.com"))
+    return 'PROXY github-proxy:3128; DIRECT';
+  else if (isInNet(host, "10.0.0.0", "255.0.0.0")) return "SOCKS socks:1080";
+  return "PROXY proxy:8080";
+}
+`
+
+func findProxy(g *GomegaWithT, script *pacScript, rawUrl string) string {
+	requestUrl, err := url.Parse(rawUrl)
+	g.Expect(err).NotTo(HaveOccurred())
+	proxyUrl, err := script.findProxy(requestUrl)
+	g.Expect(err).NotTo(HaveOccurred())
+	if proxyUrl == nil {
+		return "DIRECT"
+	}
+	return proxyUrl.String()
+}
+
+func TestPac(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	script, err := parsePacScript(testPac)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(findProxy(g, script, "http://intranet/foo")).To(Equal("DIRECT"))
+	g.Expect(findProxy(g, script, "https://build.corp.example.com/foo")).To(Equal("DIRECT"))
+	g.Expect(findProxy(g, script, "https://codeload.github.com/foo")).To(Equal("http://github-proxy:3128"))
+	g.Expect(findProxy(g, script, "https://api.github.com/foo")).To(Equal("http://proxy:8080"))
+	g.Expect(findProxy(g, script, "http://10.1.2.3:8000/foo")).To(Equal("socks5://socks:1080"))
+	g.Expect(findProxy(g, script, "https://example.org/")).To(Equal("http://proxy:8080"))
+}
+
+func TestUnsupportedPac(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	_, err := parsePacScript(`function FindProxyForURL(url, host) { var ip = dnsResolve(host); return "DIRECT"; }`)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = parsePacScript(`function FindProxyForURL(url, host) { if (myIpAddress(host)) return "DIRECT"; }`)
+	g.Expect(err).To(HaveOccurred())
+}
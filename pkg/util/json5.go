@@ -0,0 +1,340 @@
+package util
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/develar/errors"
+)
+
+// ParseJson5 parses JSON5 (comments, trailing commas, unquoted keys, single quoted strings, hex numbers, Infinity and NaN)
+// to the same values as encoding/json produces for interface{}
+func ParseJson5(data []byte) (interface{}, error) {
+	parser := &json5Parser{data: string(data), line: 1}
+	parser.skipWhitespace()
+	value, err := parser.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipWhitespace()
+	if parser.err != nil {
+		return nil, parser.err
+	}
+	if parser.offset < len(parser.data) {
+		return nil, parser.errorf("unexpected %q after value", parser.data[parser.offset])
+	}
+	return value, nil
+}
+
+type json5Parser struct {
+	data   string
+	offset int
+	line   int
+	err    error
+}
+
+func (t *json5Parser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("line %d: "+format, append([]interface{}{t.line}, args...)...)
+}
+
+func (t *json5Parser) peek() byte {
+	if t.offset < len(t.data) {
+		return t.data[t.offset]
+	}
+	return 0
+}
+
+// whitespace and comments
+func (t *json5Parser) skipWhitespace() {
+	for t.offset < len(t.data) {
+		c := t.data[t.offset]
+		switch {
+		case c == '\n':
+			t.line++
+			t.offset++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f':
+			t.offset++
+		case strings.HasPrefix(t.data[t.offset:], "//"):
+			end := strings.IndexByte(t.data[t.offset:], '\n')
+			if end < 0 {
+				t.offset = len(t.data)
+			} else {
+				t.offset += end
+			}
+		case strings.HasPrefix(t.data[t.offset:], "/*"):
+			end := strings.Index(t.data[t.offset+2:], "*/")
+			if end < 0 {
+				t.err = t.errorf("unterminated comment")
+				t.offset = len(t.data)
+				return
+			}
+			t.line += strings.Count(t.data[t.offset:t.offset+2+end], "\n")
+			t.offset += end + 4
+		case c >= utf8.RuneSelf:
+			r, size := utf8.DecodeRuneInString(t.data[t.offset:])
+			if !unicode.IsSpace(r) && r != '\uFEFF' {
+				return
+			}
+			t.offset += size
+		default:
+			return
+		}
+	}
+}
+
+func (t *json5Parser) parseValue() (interface{}, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	switch c := t.peek(); {
+	case c == 0:
+		return nil, t.errorf("unexpected end of input")
+	case c == '{':
+		return t.parseObject()
+	case c == '[':
+		return t.parseArray()
+	case c == '"' || c == '\'':
+		return t.parseString()
+	case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+		return t.parseNumber()
+	default:
+		identifier := t.parseIdentifier()
+		switch identifier {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "Infinity", "NaN":
+			t.offset -= len(identifier)
+			return t.parseNumber()
+		case "":
+			return nil, t.errorf("unexpected %q", c)
+		default:
+			return nil, t.errorf("unexpected identifier %q", identifier)
+		}
+	}
+}
+
+func (t *json5Parser) parseObject() (interface{}, error) {
+	// skip {
+	t.offset++
+	result := make(map[string]interface{})
+	for {
+		t.skipWhitespace()
+		if t.peek() == '}' {
+			t.offset++
+			return result, nil
+		}
+
+		var key string
+		if c := t.peek(); c == '"' || c == '\'' {
+			var err error
+			key, err = t.parseString()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			key = t.parseIdentifier()
+			if len(key) == 0 {
+				return nil, t.errorf("object key expected")
+			}
+		}
+
+		t.skipWhitespace()
+		if t.peek() != ':' {
+			return nil, t.errorf("':' expected after key %q", key)
+		}
+		t.offset++
+		t.skipWhitespace()
+
+		value, err := t.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+
+		t.skipWhitespace()
+		switch t.peek() {
+		case ',':
+			t.offset++
+		case '}':
+			t.offset++
+			return result, nil
+		default:
+			return nil, t.errorf("',' or '}' expected")
+		}
+	}
+}
+
+func (t *json5Parser) parseArray() (interface{}, error) {
+	// skip [
+	t.offset++
+	result := make([]interface{}, 0)
+	for {
+		t.skipWhitespace()
+		if t.peek() == ']' {
+			t.offset++
+			return result, nil
+		}
+
+		value, err := t.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+
+		t.skipWhitespace()
+		switch t.peek() {
+		case ',':
+			t.offset++
+		case ']':
+			t.offset++
+			return result, nil
+		default:
+			return nil, t.errorf("',' or ']' expected")
+		}
+	}
+}
+
+func (t *json5Parser) parseIdentifier() string {
+	start := t.offset
+	for t.offset < len(t.data) {
+		r, size := utf8.DecodeRuneInString(t.data[t.offset:])
+		if r == '_' || r == '$' || unicode.IsLetter(r) || (t.offset > start && unicode.IsDigit(r)) {
+			t.offset += size
+		} else {
+			break
+		}
+	}
+	return t.data[start:t.offset]
+}
+
+func (t *json5Parser) parseString() (string, error) {
+	quote := t.data[t.offset]
+	t.offset++
+
+	var builder strings.Builder
+	for {
+		if t.offset >= len(t.data) {
+			return "", t.errorf("unterminated string")
+		}
+
+		c := t.data[t.offset]
+		t.offset++
+		switch {
+		case c == quote:
+			return builder.String(), nil
+		case c == '\n':
+			return "", t.errorf("unescaped line break in string")
+		case c != '\\':
+			builder.WriteByte(c)
+			continue
+		}
+
+		if t.offset >= len(t.data) {
+			return "", t.errorf("unterminated string")
+		}
+		c = t.data[t.offset]
+		t.offset++
+		switch c {
+		case 'b':
+			builder.WriteByte('\b')
+		case 'f':
+			builder.WriteByte('\f')
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'v':
+			builder.WriteByte('\v')
+		case '0':
+			builder.WriteByte(0)
+		case '\n':
+			// line continuation
+			t.line++
+		case '\r':
+			if t.peek() == '\n' {
+				t.offset++
+			}
+			t.line++
+		case 'x', 'u':
+			length := 2
+			if c == 'u' {
+				length = 4
+			}
+			if t.offset+length > len(t.data) {
+				return "", t.errorf("invalid escape sequence")
+			}
+			code, err := strconv.ParseUint(t.data[t.offset:t.offset+length], 16, 32)
+			if err != nil {
+				return "", t.errorf("invalid escape sequence \\%c%s", c, t.data[t.offset:t.offset+length])
+			}
+			t.offset += length
+			// surrogate pair
+			if utf16.IsSurrogate(rune(code)) && strings.HasPrefix(t.data[t.offset:], "\\u") && t.offset+6 <= len(t.data) {
+				low, err := strconv.ParseUint(t.data[t.offset+2:t.offset+6], 16, 32)
+				if err == nil {
+					t.offset += 6
+					builder.WriteRune(utf16.DecodeRune(rune(code), rune(low)))
+					continue
+				}
+			}
+			builder.WriteRune(rune(code))
+		default:
+			builder.WriteByte(c)
+		}
+	}
+}
+
+func (t *json5Parser) parseNumber() (interface{}, error) {
+	start := t.offset
+	sign := 1.0
+	switch t.peek() {
+	case '-':
+		sign = -1
+		t.offset++
+	case '+':
+		t.offset++
+	}
+
+	rest := t.data[t.offset:]
+	switch {
+	case strings.HasPrefix(rest, "Infinity"):
+		t.offset += len("Infinity")
+		return math.Inf(int(sign)), nil
+	case strings.HasPrefix(rest, "NaN"):
+		t.offset += len("NaN")
+		return math.NaN(), nil
+	case strings.HasPrefix(rest, "0x") || strings.HasPrefix(rest, "0X"):
+		t.offset += 2
+		digitStart := t.offset
+		for t.offset < len(t.data) && strings.IndexByte("0123456789abcdefABCDEF", t.data[t.offset]) >= 0 {
+			t.offset++
+		}
+		value, err := strconv.ParseUint(t.data[digitStart:t.offset], 16, 64)
+		if err != nil {
+			return nil, t.errorf("invalid number %q", t.data[start:t.offset])
+		}
+		return sign * float64(value), nil
+	}
+
+	digitStart := t.offset
+	for t.offset < len(t.data) && strings.IndexByte("0123456789.eE+-", t.data[t.offset]) >= 0 {
+		t.offset++
+	}
+	value, err := strconv.ParseFloat(t.data[digitStart:t.offset], 64)
+	if err != nil {
+		return nil, t.errorf("invalid number %q", t.data[start:t.offset])
+	}
+	return sign * value, nil
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"context"
+	"math"
+	mathRand "math/rand"
+	"time"
+
+	"github.com/develar/errors"
+)
+
+// RetryPolicy describes how failed operation is retried: delay before the next attempt is InitialDelay multiplied by Multiplier
+// after each failed attempt (capped by MaxDelay) and randomized by Jitter, so, concurrent clients don't retry at the same time.
+type RetryPolicy struct {
+	// total number of attempts (including the first one), less than 1 means 1
+	MaxAttempts int
+	// 0 means no delay
+	InitialDelay time.Duration
+	// 0 means not limited
+	MaxDelay time.Duration
+	// less than 1 means constant delay
+	Multiplier float64
+	// fraction of delay (0-1) randomly added or subtracted
+	Jitter float64
+
+	// nil means that every error is retryable
+	IsRetryable func(err error) bool
+	// called before waiting for the next attempt (e.g. to log the error), attempt is the number of failed attempt (1-based)
+	OnRetry func(err error, attempt int, delay time.Duration)
+}
+
+// DefaultRetryPolicy returns 3 attempts with delay 1s and 2s (±20%)
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+	}
+}
+
+type nonRetryableError struct {
+	error
+}
+
+func (t *nonRetryableError) Cause() error {
+	return t.error
+}
+
+// NonRetryable marks error returned by retried operation to stop retrying regardless of policy (e.g. local I/O error in the middle of network operation)
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err}
+}
+
+// Retry calls fn (attempt is 1-based) until it succeeds, error is not retryable or attempts are exhausted - the last error is returned.
+// Context error is returned if context is cancelled while waiting for the next attempt.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if nonRetryable, ok := err.(*nonRetryableError); ok {
+			return nonRetryable.error
+		}
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || (policy.IsRetryable != nil && !policy.IsRetryable(err)) {
+			return err
+		}
+
+		delay := policy.ComputeDelay(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(err, attempt, delay)
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+// ComputeDelay returns delay after the failed attempt (1-based)
+func (t *RetryPolicy) ComputeDelay(attempt int) time.Duration {
+	multiplier := t.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(t.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if t.MaxDelay > 0 && delay > float64(t.MaxDelay) {
+		delay = float64(t.MaxDelay)
+	}
+	if t.Jitter > 0 {
+		delay += delay * t.Jitter * (2*mathRand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
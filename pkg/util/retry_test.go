@@ -0,0 +1,107 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/develar/errors"
+	. "github.com/onsi/gomega"
+)
+
+func TestRetry(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	var attempts []int
+	err := Retry(context.Background(), RetryPolicy{MaxAttempts: 3}, func(attempt int) error {
+		attempts = append(attempts, attempt)
+		if attempt < 2 {
+			return fmt.Errorf("failed %d", attempt)
+		}
+		return nil
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(attempts).To(Equal([]int{1, 2}))
+
+	// the last error is returned when attempts are exhausted
+	attempts = nil
+	var retried []int
+	err = Retry(context.Background(), RetryPolicy{MaxAttempts: 3, OnRetry: func(err error, attempt int, delay time.Duration) {
+		retried = append(retried, attempt)
+	}}, func(attempt int) error {
+		attempts = append(attempts, attempt)
+		return fmt.Errorf("failed %d", attempt)
+	})
+	g.Expect(err).To(MatchError("failed 3"))
+	g.Expect(attempts).To(Equal([]int{1, 2, 3}))
+	g.Expect(retried).To(Equal([]int{1, 2}))
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	fatalErr := fmt.Errorf("fatal")
+	policy := RetryPolicy{MaxAttempts: 5, IsRetryable: func(err error) bool {
+		return err != fatalErr
+	}}
+
+	attemptCount := 0
+	err := Retry(context.Background(), policy, func(attempt int) error {
+		attemptCount++
+		return fatalErr
+	})
+	g.Expect(err).To(Equal(fatalErr))
+	g.Expect(attemptCount).To(Equal(1))
+
+	attemptCount = 0
+	err = Retry(context.Background(), RetryPolicy{MaxAttempts: 5}, func(attempt int) error {
+		attemptCount++
+		return NonRetryable(fatalErr)
+	})
+	g.Expect(err).To(Equal(fatalErr))
+	g.Expect(attemptCount).To(Equal(1))
+}
+
+func TestRetryCancelled(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	attemptCount := 0
+	err := Retry(ctx, RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour}, func(attempt int) error {
+		attemptCount++
+		cancel()
+		return fmt.Errorf("failed")
+	})
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(attemptCount).To(Equal(1))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err = Retry(ctx, RetryPolicy{MaxAttempts: 5, InitialDelay: time.Hour}, func(attempt int) error {
+		return fmt.Errorf("failed")
+	})
+	g.Expect(errors.Cause(err)).To(Equal(context.Canceled))
+}
+
+func TestComputeDelay(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	policy := RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	g.Expect(policy.ComputeDelay(1)).To(Equal(time.Second))
+	g.Expect(policy.ComputeDelay(2)).To(Equal(2 * time.Second))
+	g.Expect(policy.ComputeDelay(3)).To(Equal(4 * time.Second))
+	g.Expect(policy.ComputeDelay(4)).To(Equal(5 * time.Second))
+
+	// constant delay
+	policy = RetryPolicy{InitialDelay: time.Second}
+	g.Expect(policy.ComputeDelay(3)).To(Equal(time.Second))
+
+	policy = RetryPolicy{InitialDelay: time.Second, Multiplier: 2, Jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		g.Expect(policy.ComputeDelay(2)).To(BeNumerically("~", 2*time.Second, 400*time.Millisecond))
+	}
+}
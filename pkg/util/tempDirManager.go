@@ -0,0 +1,89 @@
+package util
+
+import (
+	"os"
+	"sync"
+
+	"github.com/alecthomas/kingpin"
+	"github.com/apex/log"
+)
+
+// TempDirManager allocates temporary files and dirs in a per-invocation root dir that is removed on exit (including SIGINT and SIGTERM),
+// so, temporary files are not left on failure paths. TempFile and TempDir with empty dir use DefaultTempDirManager.
+type TempDirManager struct {
+	mutex  sync.Mutex
+	root   string
+	isKeep bool
+}
+
+var DefaultTempDirManager = &TempDirManager{}
+
+func ConfigureKeepTempFlag(app *kingpin.Application) {
+	isKeep := app.Flag("keep-temp", "Do not remove temporary files on exit (for debugging).").Envar("APP_BUILDER_KEEP_TEMP").Bool()
+	app.PreAction(func(context *kingpin.ParseContext) error {
+		DefaultTempDirManager.SetKeep(*isKeep)
+		return nil
+	})
+}
+
+func (t *TempDirManager) SetKeep(isKeep bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.isKeep = isKeep
+}
+
+// Root returns the root temp dir, created on first request.
+func (t *TempDirManager) Root() (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.root) != 0 {
+		return t.root, nil
+	}
+
+	root, err := TempDir(os.TempDir(), ".app-builder")
+	if err != nil {
+		return "", err
+	}
+
+	t.root = root
+	// signals are handled by the root context (operations are cancelled and temp dir is removed on exit)
+	RootContext()
+	return root, nil
+}
+
+func (t *TempDirManager) TempFile(suffix string) (string, error) {
+	root, err := t.Root()
+	if err != nil {
+		return "", err
+	}
+	return TempFile(root, suffix)
+}
+
+func (t *TempDirManager) TempDir(suffix string) (string, error) {
+	root, err := t.Root()
+	if err != nil {
+		return "", err
+	}
+	return TempDir(root, suffix)
+}
+
+// Cleanup removes the root temp dir (if created and keep is not requested). Manager can be used after cleanup, new root is created.
+func (t *TempDirManager) Cleanup() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if len(t.root) == 0 {
+		return
+	}
+
+	if t.isKeep {
+		log.WithField("dir", t.root).Info("temporary files are kept")
+	} else {
+		err := os.RemoveAll(t.root)
+		if err != nil {
+			log.WithError(err).WithField("dir", t.root).Warn("cannot remove temporary dir")
+		}
+	}
+	t.root = ""
+}
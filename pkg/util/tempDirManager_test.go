@@ -0,0 +1,39 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTempDirManager(t *testing.T) {
+	g := NewGomegaWithT(t)
+
+	manager := &TempDirManager{}
+	file, err := manager.TempFile(".txt")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ioutil.WriteFile(file, []byte("test"), 0644)).NotTo(HaveOccurred())
+
+	dir, err := manager.TempDir(".dir")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	root, err := manager.Root()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(filepath.Dir(file)).To(Equal(root))
+	g.Expect(filepath.Dir(dir)).To(Equal(root))
+
+	manager.Cleanup()
+	_, err = os.Stat(root)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+
+	// kept on request
+	manager.SetKeep(true)
+	root, err = manager.Root()
+	g.Expect(err).NotTo(HaveOccurred())
+	manager.Cleanup()
+	g.Expect(root).To(BeADirectory())
+	g.Expect(os.RemoveAll(root)).NotTo(HaveOccurred())
+}
@@ -0,0 +1,500 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/develar/errors"
+)
+
+// ParseToml parses TOML to the same values as encoding/json produces for interface{} (numbers are float64, dates are strings)
+func ParseToml(data []byte) (map[string]interface{}, error) {
+	parser := &tomlParser{data: strings.Replace(string(data), "\r\n", "\n", -1), line: 1}
+	root := make(map[string]interface{})
+	current := root
+	for {
+		parser.skipWhitespaceAndNewLines()
+		if parser.offset >= len(parser.data) {
+			return root, nil
+		}
+
+		var err error
+		if parser.peek() == '[' {
+			current, err = parser.parseTableHeader(root)
+		} else {
+			err = parser.parseKeyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		parser.skipWhitespace()
+		if parser.offset < len(parser.data) && parser.peek() != '\n' {
+			return nil, parser.errorf("unexpected %q, new line expected", parser.peek())
+		}
+	}
+}
+
+type tomlParser struct {
+	data   string
+	offset int
+	line   int
+}
+
+func (t *tomlParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("line %d: "+format, append([]interface{}{t.line}, args...)...)
+}
+
+func (t *tomlParser) peek() byte {
+	if t.offset < len(t.data) {
+		return t.data[t.offset]
+	}
+	return 0
+}
+
+// spaces and comment till the end of line
+func (t *tomlParser) skipWhitespace() {
+	for t.offset < len(t.data) {
+		switch t.data[t.offset] {
+		case ' ', '\t':
+			t.offset++
+		case '#':
+			end := strings.IndexByte(t.data[t.offset:], '\n')
+			if end < 0 {
+				t.offset = len(t.data)
+			} else {
+				t.offset += end
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (t *tomlParser) skipWhitespaceAndNewLines() {
+	for {
+		t.skipWhitespace()
+		if t.peek() != '\n' {
+			return
+		}
+		t.offset++
+		t.line++
+	}
+}
+
+// [table] or [[array of tables]]
+func (t *tomlParser) parseTableHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	isArray := strings.HasPrefix(t.data[t.offset:], "[[")
+	if isArray {
+		t.offset += 2
+	} else {
+		t.offset++
+	}
+
+	t.skipWhitespace()
+	keys, err := t.parseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	closing := "]"
+	if isArray {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(t.data[t.offset:], closing) {
+		return nil, t.errorf("%q expected", closing)
+	}
+	t.offset += len(closing)
+
+	parent, err := t.getTable(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := keys[len(keys)-1]
+	table := make(map[string]interface{})
+	if isArray {
+		existing, ok := parent[name]
+		if !ok {
+			parent[name] = []interface{}{table}
+			return table, nil
+		}
+		list, ok := existing.([]interface{})
+		if !ok {
+			return nil, t.errorf("%q is not an array of tables", strings.Join(keys, "."))
+		}
+		parent[name] = append(list, table)
+		return table, nil
+	}
+
+	switch existing := parent[name].(type) {
+	case nil:
+		parent[name] = table
+		return table, nil
+	case map[string]interface{}:
+		// table was implicitly created by dotted key or sub-table header
+		return existing, nil
+	default:
+		return nil, t.errorf("%q is already defined", strings.Join(keys, "."))
+	}
+}
+
+// nested table by keys, created if not exists (for array of tables the last element is used)
+func (t *tomlParser) getTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for index, key := range keys {
+		switch existing := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = existing
+		case []interface{}:
+			if len(existing) == 0 {
+				return nil, t.errorf("%q is not a table", strings.Join(keys[:index+1], "."))
+			}
+			child, ok := existing[len(existing)-1].(map[string]interface{})
+			if !ok {
+				return nil, t.errorf("%q is not a table", strings.Join(keys[:index+1], "."))
+			}
+			table = child
+		default:
+			return nil, t.errorf("%q is not a table", strings.Join(keys[:index+1], "."))
+		}
+	}
+	return table, nil
+}
+
+func (t *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := t.parseKey()
+	if err != nil {
+		return err
+	}
+	if t.peek() != '=' {
+		return t.errorf("'=' expected after key %q", strings.Join(keys, "."))
+	}
+	t.offset++
+	t.skipWhitespace()
+
+	value, err := t.parseValue()
+	if err != nil {
+		return err
+	}
+
+	table, err = t.getTable(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	name := keys[len(keys)-1]
+	if _, ok := table[name]; ok {
+		return t.errorf("%q is already defined", strings.Join(keys, "."))
+	}
+	table[name] = value
+	return nil
+}
+
+// dotted key, every part is bare or quoted
+func (t *tomlParser) parseKey() ([]string, error) {
+	var result []string
+	for {
+		var part string
+		switch t.peek() {
+		case '"':
+			value, err := t.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			part = value
+		case '\'':
+			value, err := t.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			part = value
+		default:
+			start := t.offset
+			for t.offset < len(t.data) && isTomlBareKeyChar(t.data[t.offset]) {
+				t.offset++
+			}
+			if start == t.offset {
+				return nil, t.errorf("key expected")
+			}
+			part = t.data[start:t.offset]
+		}
+		result = append(result, part)
+
+		t.skipWhitespace()
+		if t.peek() != '.' {
+			return result, nil
+		}
+		t.offset++
+		t.skipWhitespace()
+	}
+}
+
+func isTomlBareKeyChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+func (t *tomlParser) parseValue() (interface{}, error) {
+	rest := t.data[t.offset:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return t.parseMultiLineString(`"""`)
+	case strings.HasPrefix(rest, "'''"):
+		return t.parseMultiLineString("'''")
+	case strings.HasPrefix(rest, `"`):
+		return t.parseBasicString()
+	case strings.HasPrefix(rest, "'"):
+		return t.parseLiteralString()
+	case strings.HasPrefix(rest, "["):
+		return t.parseArray()
+	case strings.HasPrefix(rest, "{"):
+		return t.parseInlineTable()
+	}
+
+	// number, boolean or date-time
+	start := t.offset
+	for t.offset < len(t.data) && strings.IndexByte(" \t\n#,]}", t.data[t.offset]) < 0 {
+		t.offset++
+	}
+	// local date and time can be separated by space
+	if t.offset+1 < len(t.data) && t.data[t.offset] == ' ' && t.offset-start == 10 && t.data[start+4] == '-' && t.data[t.offset+1] >= '0' && t.data[t.offset+1] <= '9' {
+		t.offset++
+		for t.offset < len(t.data) && strings.IndexByte(" \t\n#,]}", t.data[t.offset]) < 0 {
+			t.offset++
+		}
+	}
+
+	raw := t.data[start:t.offset]
+	switch raw {
+	case "":
+		return nil, t.errorf("value expected")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf", "-inf", "nan", "+nan", "-nan":
+		return nil, t.errorf("%s is not supported", raw)
+	}
+
+	if len(raw) >= 10 && raw[4] == '-' && raw[7] == '-' {
+		return raw, nil
+	}
+	if len(raw) >= 8 && raw[2] == ':' && raw[5] == ':' {
+		return raw, nil
+	}
+
+	number := strings.Replace(raw, "_", "", -1)
+	if len(number) > 2 && number[0] == '0' {
+		base := 0
+		switch number[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 0 {
+			value, err := strconv.ParseUint(number[2:], base, 64)
+			if err != nil {
+				return nil, t.errorf("invalid number %q", raw)
+			}
+			return float64(value), nil
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return nil, t.errorf("invalid value %q", raw)
+	}
+	return value, nil
+}
+
+func (t *tomlParser) parseArray() (interface{}, error) {
+	// skip [
+	t.offset++
+	result := make([]interface{}, 0)
+	for {
+		t.skipWhitespaceAndNewLines()
+		if t.peek() == ']' {
+			t.offset++
+			return result, nil
+		}
+
+		value, err := t.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+
+		t.skipWhitespaceAndNewLines()
+		switch t.peek() {
+		case ',':
+			t.offset++
+		case ']':
+			t.offset++
+			return result, nil
+		default:
+			return nil, t.errorf("',' or ']' expected")
+		}
+	}
+}
+
+func (t *tomlParser) parseInlineTable() (interface{}, error) {
+	// skip {
+	t.offset++
+	result := make(map[string]interface{})
+	t.skipWhitespace()
+	if t.peek() == '}' {
+		t.offset++
+		return result, nil
+	}
+
+	for {
+		t.skipWhitespace()
+		err := t.parseKeyValue(result)
+		if err != nil {
+			return nil, err
+		}
+
+		t.skipWhitespace()
+		switch t.peek() {
+		case ',':
+			t.offset++
+		case '}':
+			t.offset++
+			return result, nil
+		default:
+			return nil, t.errorf("',' or '}' expected")
+		}
+	}
+}
+
+func (t *tomlParser) parseLiteralString() (string, error) {
+	// skip '
+	t.offset++
+	end := strings.IndexAny(t.data[t.offset:], "'\n")
+	if end < 0 || t.data[t.offset+end] != '\'' {
+		return "", t.errorf("unterminated string")
+	}
+	result := t.data[t.offset : t.offset+end]
+	t.offset += end + 1
+	return result, nil
+}
+
+func (t *tomlParser) parseBasicString() (string, error) {
+	// skip "
+	t.offset++
+	var builder strings.Builder
+	for {
+		if t.offset >= len(t.data) || t.data[t.offset] == '\n' {
+			return "", t.errorf("unterminated string")
+		}
+
+		c := t.data[t.offset]
+		switch c {
+		case '"':
+			t.offset++
+			return builder.String(), nil
+		case '\\':
+			err := t.parseEscape(&builder)
+			if err != nil {
+				return "", err
+			}
+		default:
+			builder.WriteByte(c)
+			t.offset++
+		}
+	}
+}
+
+func (t *tomlParser) parseMultiLineString(delimiter string) (string, error) {
+	t.offset += len(delimiter)
+	// new line immediately following the opening delimiter is trimmed
+	if t.peek() == '\n' {
+		t.offset++
+		t.line++
+	}
+
+	var builder strings.Builder
+	for {
+		if t.offset >= len(t.data) {
+			return "", t.errorf("unterminated string")
+		}
+
+		if strings.HasPrefix(t.data[t.offset:], delimiter) {
+			t.offset += len(delimiter)
+			// up to two quotes are allowed right before the closing delimiter
+			for index := 0; index < 2 && t.peek() == delimiter[0]; index++ {
+				builder.WriteByte(delimiter[0])
+				t.offset++
+			}
+			return builder.String(), nil
+		}
+
+		c := t.data[t.offset]
+		if c == '\\' && delimiter == `"""` {
+			// line ending backslash trims all whitespace up to the next non-whitespace
+			rest := strings.TrimLeft(t.data[t.offset+1:], " \t")
+			if strings.HasPrefix(rest, "\n") {
+				trimmed := strings.TrimLeft(rest, " \t\n")
+				t.line += strings.Count(rest[:len(rest)-len(trimmed)], "\n")
+				t.offset = len(t.data) - len(trimmed)
+				continue
+			}
+
+			err := t.parseEscape(&builder)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if c == '\n' {
+			t.line++
+		}
+		builder.WriteByte(c)
+		t.offset++
+	}
+}
+
+func (t *tomlParser) parseEscape(builder *strings.Builder) error {
+	// skip \
+	t.offset++
+	c := t.peek()
+	t.offset++
+	switch c {
+	case 'b':
+		builder.WriteByte('\b')
+	case 't':
+		builder.WriteByte('\t')
+	case 'n':
+		builder.WriteByte('\n')
+	case 'f':
+		builder.WriteByte('\f')
+	case 'r':
+		builder.WriteByte('\r')
+	case '"', '\\':
+		builder.WriteByte(c)
+	case 'u', 'U':
+		length := 4
+		if c == 'U' {
+			length = 8
+		}
+		if t.offset+length > len(t.data) {
+			return t.errorf("invalid escape sequence")
+		}
+		code, err := strconv.ParseUint(t.data[t.offset:t.offset+length], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return t.errorf("invalid escape sequence \\%c%s", c, t.data[t.offset:t.offset+length])
+		}
+		t.offset += length
+		builder.WriteRune(rune(code))
+	default:
+		return t.errorf("invalid escape sequence \\%c", c)
+	}
+	return nil
+}
@@ -160,6 +160,12 @@ func preCommandExecute(command *exec.Cmd, currentWorkingDirectory string) {
 }
 
 func LogErrorAndExit(err error) {
+	DefaultTempDirManager.Cleanup()
+	if IsCancelled() {
+		// error is caused by cancel (context canceled or killed child process), not interesting
+		log.WithError(err).Debug("cancelled")
+		os.Exit(CancelExitCode())
+	}
 	log.Fatalf("%+v\n", err)
 }
 